@@ -17,8 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
 	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
@@ -43,12 +46,55 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Stop gracefully on SIGTERM or SIGINT, also while starting up.
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigCh
+		glog.V(0).Infof("Received %v, shutting down", sig)
+		cancel()
+	}()
+
 	glog.V(0).Infof("Scaling namespace: %s, target: %s", config.Namespace, config.Target)
-	scaler, err := autoscaler.NewAutoScaler(config)
+	scaler, err := autoscaler.NewAutoScaler(ctx, config)
 	if err != nil {
 		glog.Errorf("%v", err)
 		os.Exit(1)
 	}
+	if config.SelfTest {
+		if err := scaler.SelfTest(ctx, os.Stdout); err != nil {
+			glog.Errorf("%v", err)
+			os.Exit(1)
+		}
+		glog.Flush()
+		os.Exit(0)
+	}
+	if config.Report {
+		if err := scaler.Report(ctx, os.Stdout); err != nil {
+			glog.Errorf("%v", err)
+			os.Exit(1)
+		}
+		glog.Flush()
+		os.Exit(0)
+	}
+
+	go func() {
+		<-ctx.Done()
+		scaler.Stop()
+	}()
+
+	// Run a scale cycle right away on SIGUSR1.
+	forceCh := make(chan os.Signal, 1)
+	signal.Notify(forceCh, syscall.SIGUSR1)
+	go func() {
+		for range forceCh {
+			glog.V(0).Infof("Received SIGUSR1, forcing a scale cycle")
+			scaler.ForceScale()
+		}
+	}()
+
 	// Begin autoscaling.
 	scaler.Run()
+	glog.Flush()
 }
@@ -22,44 +22,240 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
 )
 
 // AutoScalerConfig configures and runs an autoscaler server
 type AutoScalerConfig struct {
-	Namespace         string
-	Target            string
-	DefaultConfig     string
-	ConfigFile        string
-	PollPeriodSeconds int
-	Kubeconfig        string
-	PrintVer          bool
-	DryRun            bool
+	Namespace               string
+	Target                  string
+	ContainerPatchPath      string
+	UpdateLastApplied       bool
+	ServerSideValidation    bool
+	LabelPropagation        string
+	PinImageTags            []string
+	NodeGroupMinNodes       []string
+	NodeLabelWeights        []string
+	NodeWeightAggregation   string
+	SchedulingGate          bool
+	VPARecommendation       string
+	ArgoCDAnnotationCheck   bool
+	ArgoCDHelmParameter     string
+	ValidateTarget          bool
+	ReplicaSetByHash        bool
+	CoordinateHPA           bool
+	DaemonSetDeletePods     bool
+	DaemonSetDeleteInterval time.Duration
+	TargetCreationTimeout   time.Duration
+	DefaultConfig           string
+	ConfigFile              string
+	ManagedAnnotations      bool
+	ShadowConfig            string
+	RecommenderURL          string
+	RecommenderTimeout      time.Duration
+	RecommenderAuthHeader   string
+	PollPeriodSeconds       int
+	PollBackoffMaxPeriod    time.Duration
+	BackoffResetSuccesses   int
+	Kubeconfig              string
+	PodSelector             string
+	PodAnnotationsSelector  string
+	CountPendingPods        bool
+	CountCPUUtilization     bool
+	NodeAllocationThreshold int
+	CoresChangeThreshold    float64
+	MinEffectiveNodes       int
+	SkipZeroCPUNodes        bool
+	NodeOS                  string
+	TaintTolerationMatch    string
+	NodeReadyGracePeriod    time.Duration
+	MemoryWeightedNodes     bool
+	BaseNodeMemory          string
+	MasterNodeWeight        float64
+	ScaleOn                 string
+	MinMemoryToCPURatio     string
+	MaxMemoryToCPURatio     string
+	NodeCoresAnnotation     string
+	ClusterSizeCacheTTL     time.Duration
+	RolloutMaxUnavailable   string
+	RolloutMaxSurge         string
+	RestoreRollout          bool
+	ZeroNodesPolicy         string
+	AdditionalClusters      string
+	UnreachableClusters     string
+	MinNodes                int
+	MaxNodes                int
+	CloudWatchNamespace     string
+	CloudWatchRegion        string
+	CloudWatchDimensions    string
+	MetricsAddr             string
+	DogStatsDAddr           string
+	NATSURL                 string
+	GRPCAddr                string
+	APIAddr                 string
+	APITokenFile            string
+	HealthAddr              string
+	UnreadyAfterFailures    int
+	AuditLogFile            string
+	AuditLogMaxSizeMB       int
+	AuditLogMaxAgeDays      int
+	AuditLogFatal           bool
+	ParquetOutputPath       string
+	ParquetRotateInterval   time.Duration
+	AzureResourceID         string
+	AzureRegion             string
+	UpdateWindow            string
+	UpdateWindowTimezone    string
+	ApplyJitter             time.Duration
+	BootstrapStablePeriod   time.Duration
+	ResetReplacedTarget     bool
+	PodName                 string
+	PodNamespace            string
+	PodEventPeriodMinutes   int
+	PrintVer                bool
+	Report                  bool
+	SelfTest                bool
+	WatchHPAEvents          bool
+	DryRun                  bool
+	DryRunOutputFormat      string
+	QuantityPrecision       string
+	APIContentType          string
+	ImpersonateUser         string
+	ImpersonateGroups       string
 }
 
 // NewAutoScalerConfig returns a Autoscaler config
 func NewAutoScalerConfig() *AutoScalerConfig {
 	return &AutoScalerConfig{
 		// Defaults.
-		Namespace:         os.Getenv("MY_NAMESPACE"),
-		PollPeriodSeconds: 10,
-		PrintVer:          false,
-		DryRun:            false,
+		Namespace:               os.Getenv("MY_NAMESPACE"),
+		PollPeriodSeconds:       10,
+		NodeAllocationThreshold: 1,
+		CloudWatchRegion:        os.Getenv("AWS_REGION"),
+		MinEffectiveNodes:       1,
+		MasterNodeWeight:        1,
+		NodeWeightAggregation:   string(k8sclient.WeightFirstMatch),
+		DaemonSetDeleteInterval: k8sclient.DefaultDaemonSetPodDeletionInterval,
+		ScaleOn:                 k8sclient.ScaleOnNodes,
+		ZeroNodesPolicy:         "skip",
+		UnreachableClusters:     "fail",
+		AuditLogMaxSizeMB:       100,
+		ParquetRotateInterval:   time.Hour,
+		PodName:                 os.Getenv("POD_NAME"),
+		PodNamespace:            os.Getenv("POD_NAMESPACE"),
+		PrintVer:                false,
+		DryRun:                  false,
+		DryRunOutputFormat:      "json",
+		APIContentType:          "protobuf",
+		ContainerPatchPath:      k8sclient.DefaultContainerPath,
+		ArgoCDHelmParameter:     k8sclient.DefaultArgoCDHelmParameter,
+		RecommenderTimeout:      10 * time.Second,
+		UnreadyAfterFailures:    1,
+		BackoffResetSuccesses:   1,
 	}
 }
 
 // AddFlags adds flags to the specified FlagSet.
 func (c *AutoScalerConfig) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&c.Target, "target", c.Target, "The target object to scale. Format: deployment/* (not case sensitive).")
+	fs.StringVar(&c.ContainerPatchPath, "container-patch-path", c.ContainerPatchPath, "Where the containers are in the --target, in dotted form or as a JSON Pointer, e.g. \"/spec/template/spec/containers\".")
+	fs.BoolVar(&c.UpdateLastApplied, "update-last-applied", c.UpdateLastApplied, "Also merge the resources into the --target's kubectl.kubernetes.io/last-applied-configuration annotation, so that the next kubectl apply doesn't revert them.")
+	fs.BoolVar(&c.ServerSideValidation, "server-side-validation", c.ServerSideValidation, "Patch the --target with fieldValidation=Strict, so that the API server rejects a patch with unknown fields, e.g. from a policy bug, instead of dropping them. Requires Kubernetes 1.25 or later; older API servers ignore it.")
+	fs.StringVar(&c.LabelPropagation, "label-propagation", c.LabelPropagation, "Set labels of the --target's pod template to the most common values of node labels among the counted nodes, as comma-separated POD_LABEL=NODE_LABEL, e.g. \"cpva.io/instance-type=node.kubernetes.io/instance-type\". They are set along with the resources.")
+	fs.StringArrayVar(&c.PinImageTags, "pin-image-tag", c.PinImageTags, "CONTAINER=TAG, e.g. \"app=1.4.2\", to also set the tag of the container's image in every patch of its resources, so that scaling never pulls a moving tag such as latest. May be repeated. Images pinned by digest are left alone.")
+	fs.BoolVar(&c.SchedulingGate, "scheduling-gate", c.SchedulingGate, "Remove the cpva.io/resources-not-set scheduling gate from the --target's pods once they have the resources last applied. Add the gate to the target's pod template.")
+	fs.StringVar(&c.VPARecommendation, "vpa-recommendation", c.VPARecommendation, "If set, never update the --target, but write its resources as the recommendation of the VerticalPodAutoscaler of this name in --namespace, creating it with updateMode Off if need be. Requires the VPA CRD, and is skipped if it is not installed.")
+	fs.BoolVar(&c.ArgoCDAnnotationCheck, "argocd-annotation-check", c.ArgoCDAnnotationCheck, "If the --target has the argocd.argoproj.io/managed-by annotation, set the resources as Helm parameters of the Argo CD Application it names, instead of patching the target.")
+	fs.StringVar(&c.ArgoCDHelmParameter, "argocd-helm-parameter", c.ArgoCDHelmParameter, "The name of the Helm parameter of each resource with --argocd-annotation-check, with the placeholders {container}, {kind} (requests or limits) and {resource}.")
+	fs.DurationVar(&c.TargetCreationTimeout, "target-creation-timeout", c.TargetCreationTimeout, "If set, wait at startup for up to this long, e.g. \"5m\", for the --target to be created, rather than exiting if it doesn't exist yet.")
+	fs.BoolVar(&c.ReplicaSetByHash, "allow-replicaset-by-hash", c.ReplicaSetByHash, "Allow a --target of the form replicaset/pod-template-hash=HASH, which patches the one ReplicaSet with that label instead of its Deployment. For experiments only: the Deployment may overwrite the resources at any time.")
+	fs.BoolVar(&c.CoordinateHPA, "coordinate-hpa", c.CoordinateHPA, "Whenever the --target's requests change, scale the target utilization of the cpu and memory metrics of the HorizontalPodAutoscalers which scale it by the ratio of the old to the new requests per pod, so that their replica counts stay stable. Needs the autoscaling/v2 API, or autoscaling/v2beta2 before Kubernetes 1.23.")
+	fs.BoolVar(&c.DaemonSetDeletePods, "daemonset-delete-pods-on-update", c.DaemonSetDeletePods, "If the --target is a DaemonSet with the OnDelete update strategy, delete its pods which are not from the pod template of the last update, one at a time in the order of their nodes' names, so that they are recreated with the new resources.")
+	fs.DurationVar(&c.DaemonSetDeleteInterval, "daemonset-delete-pods-interval", c.DaemonSetDeleteInterval, "How long --daemonset-delete-pods-on-update waits after deleting a pod before it deletes the next one.")
+	fs.BoolVar(&c.ValidateTarget, "validate-target", c.ValidateTarget, "Check at startup that --namespace and the --target in it exist, and that the target has all containers named by --default-config, and exit if not. A config loaded later, from the --config-file or the API, is only loaded once the target has all of its containers.")
 	fs.StringVar(&c.Namespace, "namespace", c.Namespace, "The Namespace of the --target. Defaults to ${MY_NAMESPACE}.")
 	fs.StringVar(&c.DefaultConfig, "default-config", c.DefaultConfig, "The default configuration (in JSON format).")
 	fs.StringVar(&c.ConfigFile, "config-file", c.ConfigFile, "A config file (in JSON format), which overrides the --default-config.")
-	fs.IntVar(&c.PollPeriodSeconds, "poll-period-seconds", c.PollPeriodSeconds, "The period, in seconds, to poll cluster size and perform autoscaling.")
+	fs.BoolVar(&c.ManagedAnnotations, "managed-annotations", c.ManagedAnnotations, "Read the config, instead of from --config-file, from the ConfigMap named by the cpva.io/policy-configmap annotation of the --target, as the mutating webhook sets it, and only scale the target while its cpva.io/managed annotation is \"true\". Without --target, the target is the only Deployment of --namespace with that annotation.")
+	fs.StringVar(&c.ShadowConfig, "shadow-config", c.ShadowConfig, "A second configuration (in JSON format), which is evaluated and logged alongside the active one for comparison, but never applied.")
+	fs.StringVar(&c.RecommenderURL, "recommender-url", c.RecommenderURL, "If set, POST the cluster size to this external recommender whenever the resources are recalculated, e.g. not while the cluster changed by less than --node-allocation-threshold, and apply the resources which it answers with, bounded by the base and max of the config, instead of computing them.")
+	fs.DurationVar(&c.RecommenderTimeout, "recommender-timeout", c.RecommenderTimeout, "How long to wait for the --recommender-url to answer, after which its last recommendation is reused.")
+	fs.StringVar(&c.RecommenderAuthHeader, "recommender-auth-header-file", c.RecommenderAuthHeader, "A file whose content is sent to the --recommender-url as the Authorization header, e.g. \"Bearer TOKEN\". It is read on every request.")
+	fs.IntVar(&c.PollPeriodSeconds, "poll-period-seconds", c.PollPeriodSeconds, "The period, in seconds, to poll cluster size and perform autoscaling, besides whenever the watched nodes change.")
+	fs.DurationVar(&c.PollBackoffMaxPeriod, "poll-backoff-max-period", c.PollBackoffMaxPeriod, "If set, double the poll period after every failed scale cycle, up to this long, e.g. \"5m\", so that a struggling apiserver is polled less often.")
+	fs.IntVar(&c.BackoffResetSuccesses, "backoff-reset-successes", c.BackoffResetSuccesses, "How many scale cycles in a row must succeed before --poll-backoff-max-period goes back to --poll-period-seconds. More than 1 avoids flapping between fast and slow polling during an intermittent outage.")
 	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "Path to a kubeconfig. Only required if running out-of-cluster.")
+	fs.StringVar(&c.ImpersonateUser, "impersonate-user", c.ImpersonateUser, "If set, act as this user in the target's cluster, e.g. a per-tenant service account.")
+	fs.StringVar(&c.ImpersonateGroups, "impersonate-group", c.ImpersonateGroups, "Comma-separated groups to act as, along with --impersonate-user.")
+	fs.StringVar(&c.APIContentType, "api-content-type", c.APIContentType, "How to encode objects for the API server: protobuf, or json for API servers which don't support protobuf.")
+	fs.IntVar(&c.MinEffectiveNodes, "min-effective-nodes", c.MinEffectiveNodes, "The floor on the number of nodes used to compute the average cores per node.")
+	fs.DurationVar(&c.ClusterSizeCacheTTL, "cluster-size-cache-ttl", c.ClusterSizeCacheTTL, "If set, reuse a cluster size for this long, e.g. \"1m\", instead of listing the nodes on every poll.")
+	fs.StringVar(&c.RolloutMaxUnavailable, "rollout-max-unavailable", c.RolloutMaxUnavailable, "If set, set the Deployment's maxUnavailable, as a number of pods or a percentage, in the same patch as the resources.")
+	fs.StringVar(&c.RolloutMaxSurge, "rollout-max-surge", c.RolloutMaxSurge, "If set, set the Deployment's maxSurge, as a number of pods or a percentage, in the same patch as the resources.")
+	fs.BoolVar(&c.RestoreRollout, "restore-rollout-strategy", c.RestoreRollout, "Put back the maxUnavailable and maxSurge which --rollout-max-unavailable and --rollout-max-surge overrode, once the rollout is complete.")
+	fs.StringVar(&c.TaintTolerationMatch, "taint-toleration-match", c.TaintTolerationMatch, "If set, a taint as KEY=VALUE:EFFECT, e.g. \"dedicated=gpu:NoSchedule\", by which the counted nodes are split into the main pool and the tainted pool, for mainPoolNodeLadder and taintedPoolNodeLadder.")
+	fs.StringArrayVar(&c.NodeLabelWeights, "node-label-weight", c.NodeLabelWeights, "LABEL=VALUE:WEIGHT, e.g. \"node.kubernetes.io/instance-type=m5.large:0.5\", to count each node with the label as WEIGHT nodes with WEIGHT times its cores. May be repeated; the rules apply in order, after --master-node-weight.")
+	fs.StringVar(&c.NodeWeightAggregation, "node-weight-aggregation", c.NodeWeightAggregation, "How the weights of a node which matches several --master-node-weight and --node-label-weight rules are combined: \"first-match\" uses the first rule's, in order, \"multiply\" multiplies them, and \"max\" uses the largest.")
+	fs.StringVar(&c.NodeOS, "node-os", c.NodeOS, "If set, only count nodes of this operating system, by their kubernetes.io/os label, e.g. \"linux\".")
+	fs.DurationVar(&c.NodeReadyGracePeriod, "node-ready-grace-period", c.NodeReadyGracePeriod, "If set, do not count nodes which have not been Ready for longer than this, e.g. \"5m\". Nodes which are NotReady for a shorter time are still counted.")
+	fs.BoolVar(&c.MemoryWeightedNodes, "memory-weighted-nodes", c.MemoryWeightedNodes, "Count each node as its memory capacity divided by --base-node-memory, rather than as one node, for nodesPerStep and nodesLadder.")
+	fs.StringVar(&c.BaseNodeMemory, "base-node-memory", c.BaseNodeMemory, "The memory capacity, e.g. \"16Gi\", which counts as one node with --memory-weighted-nodes.")
+	fs.StringVar(&c.MinMemoryToCPURatio, "min-memory-to-cpu-ratio", c.MinMemoryToCPURatio, "If set, the least memory per core, e.g. \"512Mi\", which a container's requests or limits may have. Recommendations below it are not applied.")
+	fs.StringVar(&c.MaxMemoryToCPURatio, "max-memory-to-cpu-ratio", c.MaxMemoryToCPURatio, "If set, the most memory per core, e.g. \"16Gi\", which a container's requests or limits may have. Recommendations above it are not applied.")
+	fs.Float64Var(&c.MasterNodeWeight, "master-node-weight", c.MasterNodeWeight, "How much a node with a control-plane role label counts, from 0 to 1, both as a node and for its cores, e.g. 0.5 for half. 1 counts it fully, 0 not at all.")
+	fs.StringVar(&c.ScaleOn, "scale-on", c.ScaleOn, "The cluster metric which the metricPerStep and metricLadder parameters of the config count: nodes, cores, memory (in GiB), pods (see --pod-selector), gpus, or custom:NAME for the metric NAME of --namespace from the custom metrics API.")
+	fs.StringArrayVar(&c.NodeGroupMinNodes, "node-group-min-nodes", c.NodeGroupMinNodes, "GROUP=N, e.g. \"gpu-pool=2\", to count a node group with fewer than N nodes, including none, as having N nodes, e.g. so that a new or scaled-to-zero pool doesn't size workloads for no nodes. May be repeated. Only applies if the node groups are recognized from the node labels.")
+	fs.StringVar(&c.NodeCoresAnnotation, "node-cores-annotation", c.NodeCoresAnnotation, "If set, count a node annotated with this key, e.g. \"example.com/real-cores\", as having that many cores instead of its reported CPU capacity.")
+	fs.BoolVar(&c.SkipZeroCPUNodes, "skip-zero-cpu-nodes", c.SkipZeroCPUNodes, "Do not count nodes which report zero CPU capacity, e.g. some virtual nodes.")
+	fs.StringVar(&c.ZeroNodesPolicy, "zero-nodes-policy", c.ZeroNodesPolicy, "What to do when no nodes are counted: skip the poll, scale to the floor, or reuse the last-good cluster size.")
+	fs.StringVar(&c.AdditionalClusters, "additional-clusters", c.AdditionalClusters, "Comma-separated KUBECONFIG[#CONTEXT] of other clusters, whose nodes and cores are added to those of the target's cluster.")
+	fs.StringVar(&c.UnreachableClusters, "unreachable-cluster-policy", c.UnreachableClusters, "What to do when one of the --additional-clusters can't be reached: fail the poll, or count the partial cluster size.")
+	fs.IntVar(&c.MinNodes, "min-nodes", c.MinNodes, "If set, treat a cluster size of fewer nodes as an error and retry on the next poll, instead of scaling to it.")
+	fs.IntVar(&c.MaxNodes, "max-nodes", c.MaxNodes, "If set, treat a cluster size of more nodes as an error and retry on the next poll, instead of scaling to it.")
+	fs.StringVar(&c.PodAnnotationsSelector, "pod-annotations-selector", c.PodAnnotationsSelector, "A selector, in label selector syntax, of the annotations of pods in --namespace. Ready matching pods are counted for podsPerStep.")
+	fs.StringVar(&c.PodSelector, "pod-selector", c.PodSelector, "A label selector for pods in --namespace. Ready matching pods are counted for podsPerStep.")
+	fs.BoolVar(&c.CountPendingPods, "count-pending-pods", c.CountPendingPods, "Count the target's Pending pods, for use in pendingPodsLadder.")
+	fs.BoolVar(&c.CountCPUUtilization, "count-cpu-utilization", c.CountCPUUtilization, "Measure the percentage of the nodes' allocatable CPU which pods request, for use in cpuUtilizationLadder. Watches the pods of all namespaces.")
+	fs.Float64Var(&c.CoresChangeThreshold, "cores-change-threshold", c.CoresChangeThreshold, "If set, also recalculate resources when the total cores of the nodes have changed by at least this fraction since the last evaluation, e.g. 0.1, even if the number of nodes changed by less than --node-allocation-threshold, e.g. because nodes were resized in place. Smaller changes of the cores alone then do not recalculate them.")
+	fs.IntVar(&c.NodeAllocationThreshold, "node-allocation-threshold", c.NodeAllocationThreshold, "Only recalculate resources when the number of nodes has changed by at least this much since the last evaluation. While the number of nodes stays the same, any other change of the cluster, e.g. in its cores, recalculates them.")
+	fs.StringVar(&c.CloudWatchNamespace, "cloudwatch-namespace", c.CloudWatchNamespace, "If set, publish metrics to AWS CloudWatch in this namespace.")
+	fs.StringVar(&c.CloudWatchRegion, "cloudwatch-region", c.CloudWatchRegion, "The AWS region to publish CloudWatch metrics to. Defaults to ${AWS_REGION}.")
+	fs.StringVar(&c.CloudWatchDimensions, "cloudwatch-dimensions", c.CloudWatchDimensions, "Comma-separated name=value dimensions to add to all CloudWatch metrics.")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "If set, serve metrics for Prometheus on /metrics at this address, e.g. \":9102\".")
+	fs.StringVar(&c.DogStatsDAddr, "dogstatsd-addr", c.DogStatsDAddr, "If set, send metrics to the DogStatsD agent at this host:port.")
+	fs.StringVar(&c.NATSURL, "nats-url", c.NATSURL, "If set, publish an event to the NATS server at this URL (nats://host:port) whenever the target is updated.")
+	fs.StringVar(&c.GRPCAddr, "grpc-addr", c.GRPCAddr, "If set, serve the current recommendations over gRPC, without TLS, at this address, e.g. \":9103\".")
+	fs.StringVar(&c.HealthAddr, "health-addr", c.HealthAddr, "If set, serve a liveness probe on /healthz and a readiness probe on /readyz at this address, e.g. \":9105\".")
+	fs.IntVar(&c.UnreadyAfterFailures, "unready-after-failures", c.UnreadyAfterFailures, "How many scale cycles in a row must fail before /readyz of --health-addr reports not ready. It is ready again after the next successful cycle.")
+	fs.StringVar(&c.APIAddr, "api-addr", c.APIAddr, "If set, serve the REST API, which reports the state, config and plans and accepts a new policy, at this address, e.g. \"127.0.0.1:9104\". Reads are unauthenticated; see --api-token-file for changes.")
+	fs.StringVar(&c.APITokenFile, "api-token-file", c.APITokenFile, "The file which holds the bearer token that requests of --api-addr must present to change the autoscaler, i.e. to replace the policy or trigger a poll. It is read for every such request. Without it, changes are refused.")
+	fs.StringVar(&c.AuditLogFile, "audit-log-file", c.AuditLogFile, "If set, append every update of the target to this file, as a line of JSON, or write it to stdout for \"-\".")
+	fs.BoolVar(&c.AuditLogFatal, "audit-log-fatal", c.AuditLogFatal, "Exit if an update can't be written to --audit-log-file, rather than only logging the error.")
+	fs.IntVar(&c.AuditLogMaxSizeMB, "audit-log-max-size-mb", c.AuditLogMaxSizeMB, "Rotate --audit-log-file before it grows beyond this size. 0 for no limit.")
+	fs.IntVar(&c.AuditLogMaxAgeDays, "audit-log-max-age-days", c.AuditLogMaxAgeDays, "Delete rotated audit logs older than this many days. 0 to keep them all.")
+	fs.StringVar(&c.ParquetOutputPath, "parquet-output-path", c.ParquetOutputPath, "If set, write every update of the target to Parquet files named after this path, which is a file path, s3://BUCKET/KEY or gs://BUCKET/OBJECT.")
+	fs.DurationVar(&c.ParquetRotateInterval, "parquet-rotate-interval", c.ParquetRotateInterval, "How long to collect updates for before writing them out as a --parquet-output-path file.")
+	fs.StringVar(&c.AzureResourceID, "azure-resource-id", c.AzureResourceID, "If set, publish metrics to Azure Monitor against this resource ID, using the managed service identity.")
+	fs.StringVar(&c.AzureRegion, "azure-region", c.AzureRegion, "The Azure region of --azure-resource-id.")
+	fs.StringVar(&c.UpdateWindow, "update-window", c.UpdateWindow, "If set, only update the target within this recurring window, e.g. \"Sat,Sun 02:00-06:00\". Updates outside of it are deferred until it opens.")
+	fs.StringVar(&c.UpdateWindowTimezone, "update-window-timezone", c.UpdateWindowTimezone, "The timezone of --update-window, e.g. \"Europe/Berlin\". Defaults to UTC.")
+	fs.DurationVar(&c.BootstrapStablePeriod, "bootstrap-stable-period", c.BootstrapStablePeriod, "If set, hold the target at the floor of the config from startup until the number of nodes hasn't increased for this long, e.g. \"5m\", and only then apply the computed resources, so that a cluster which is being created doesn't restart the target for every batch of nodes.")
+	fs.DurationVar(&c.ApplyJitter, "apply-jitter", c.ApplyJitter, "If set, delay the first update after each config change, including at startup, by a random time of up to this long, e.g. \"10m\", so that a fleet of autoscalers doesn't restart its targets all at once.")
+	fs.BoolVar(&c.ResetReplacedTarget, "reset-replaced-target", c.ResetReplacedTarget, "When the config file switches to another target, reset the old target to the resources it had before it was first updated.")
+	fs.IntVar(&c.PodEventPeriodMinutes, "pod-event-period-minutes", c.PodEventPeriodMinutes, "If set, summarize the cluster size and computed resources in an event on our own pod (${POD_NAMESPACE}/${POD_NAME}) whenever they change, and at least this often.")
 	fs.BoolVar(&c.PrintVer, "version", c.PrintVer, "Print the version and exit.")
+	fs.BoolVar(&c.Report, "report", c.Report, "Print the current, used, and recommended requests of each container once and exit, without updating the target.")
+	fs.BoolVar(&c.SelfTest, "self-test", c.SelfTest, "Measure the cluster once with the configured filters, print its size and the recommended resources, and exit.  It does not need --target, and fails if the cluster can't be measured.")
+	fs.BoolVar(&c.WatchHPAEvents, "watch-hpa-events", c.WatchHPAEvents, "Also recalculate resources as soon as an HPA in --namespace rescales the --target.")
 	fs.BoolVar(&c.DryRun, "dry-run", c.PrintVer, "Calulate updates for a target but does not apply the update.")
+	fs.StringVar(&c.QuantityPrecision, "quantity-precision", c.QuantityPrecision, "The units in which quantities are written to the target, as comma-separated RESOURCE=UNIT, e.g. \"cpu=1m,memory=1Mi\". Quantities are rounded up to whole units. Only cpu, memory and ephemeral-storage are supported.")
+	fs.StringVar(&c.DryRunOutputFormat, "dry-run-output-format", c.DryRunOutputFormat, "How --dry-run prints each update: json or yaml for the patch, or table for the changes to each resource.")
 }
 
 // InitFlags no// WordSepNormalizeFunc changes all flags that contain "_" separators
@@ -82,21 +278,240 @@ func (c *AutoScalerConfig) ValidateFlags() error {
 	var errorsFound bool
 
 	c.Target = strings.ToLower(c.Target)
-	if !isTargetFormatValid(c.Target) {
+	if !((c.SelfTest || c.ManagedAnnotations) && c.Target == "") && !isTargetFormatValid(c.Target) {
+		errorsFound = true
+	}
+	if c.SelfTest && c.Report {
+		errorsFound = true
+		glog.Errorf("--self-test and --report are mutually exclusive")
+	}
+	if k8sclient.IsReplicaSetByHash(c.Target) && !c.ReplicaSetByHash {
+		errorsFound = true
+		glog.Errorf("--target %s selects a ReplicaSet by its pod-template-hash, which requires --allow-replicaset-by-hash", c.Target)
+	}
+	if _, err := k8sclient.ParseContainerPath(c.ContainerPatchPath); err != nil {
 		errorsFound = true
+		glog.Errorf("Invalid --container-patch-path: %v", err)
 	}
 	if c.Namespace == "" {
 		errorsFound = true
 		glog.Errorf("--namespace parameter not set and failed to fallback")
 	}
-	if c.DefaultConfig == "" && c.ConfigFile == "" {
+	if c.DefaultConfig == "" && c.ConfigFile == "" && !c.ManagedAnnotations {
 		errorsFound = true
-		glog.Errorf("Either --default-config or --config-file must be specified")
+		glog.Errorf("Either --default-config, --config-file or --managed-annotations must be specified")
+	}
+	if c.ManagedAnnotations && c.ConfigFile != "" {
+		errorsFound = true
+		glog.Errorf("--managed-annotations and --config-file are mutually exclusive")
 	}
 	if c.PollPeriodSeconds < 1 {
 		errorsFound = true
 		glog.Errorf("--poll-period-seconds cannot be less than 1")
 	}
+	if c.CloudWatchNamespace != "" && c.CloudWatchRegion == "" {
+		errorsFound = true
+		glog.Errorf("--cloudwatch-region must be set with --cloudwatch-namespace")
+	}
+	if c.AzureResourceID != "" && c.AzureRegion == "" {
+		errorsFound = true
+		glog.Errorf("--azure-region must be set with --azure-resource-id")
+	}
+	if c.ArgoCDAnnotationCheck {
+		if err := k8sclient.ValidateHelmParameter(c.ArgoCDHelmParameter); err != nil {
+			errorsFound = true
+			glog.Errorf("--argocd-helm-parameter: %v", err)
+		}
+		if c.VPARecommendation != "" {
+			errorsFound = true
+			glog.Errorf("--vpa-recommendation never updates the target, so it cannot be used with --argocd-annotation-check")
+		}
+	}
+	if _, err := k8sclient.ParseTaintMatch(c.TaintTolerationMatch); err != nil {
+		errorsFound = true
+		glog.Errorf("--taint-toleration-match: %v", err)
+	}
+	if _, err := k8sclient.ParseLabelPropagation(c.LabelPropagation); err != nil {
+		errorsFound = true
+		glog.Errorf("--label-propagation: %v", err)
+	}
+	if _, err := k8sclient.ParseImageTagPins(c.PinImageTags); err != nil {
+		errorsFound = true
+		glog.Errorf("--pin-image-tag: %v", err)
+	}
+	if _, err := k8sclient.ParseNodeGroupMinNodes(c.NodeGroupMinNodes); err != nil {
+		errorsFound = true
+		glog.Errorf("--node-group-min-nodes: %v", err)
+	}
+	if _, err := k8sclient.ParseNodeWeightRules(c.NodeLabelWeights); err != nil {
+		errorsFound = true
+		glog.Errorf("--node-label-weight: %v", err)
+	}
+	if _, err := k8sclient.ParseWeightAggregation(c.NodeWeightAggregation); err != nil {
+		errorsFound = true
+		glog.Errorf("--node-weight-aggregation: %v", err)
+	}
+	if _, err := k8sclient.ParseQuantityPrecision(c.QuantityPrecision); err != nil {
+		errorsFound = true
+		glog.Errorf("--quantity-precision: %v", err)
+	}
+	if _, err := k8sclient.ParseRolloutOverride(c.RolloutMaxUnavailable, c.RolloutMaxSurge, c.RestoreRollout); err != nil {
+		errorsFound = true
+		glog.Errorf("--rollout-max-unavailable or --rollout-max-surge: %v", err)
+	}
+	if c.RestoreRollout && c.RolloutMaxUnavailable == "" && c.RolloutMaxSurge == "" {
+		errorsFound = true
+		glog.Errorf("--restore-rollout-strategy requires --rollout-max-unavailable or --rollout-max-surge")
+	}
+	if c.VPARecommendation != "" && (c.DryRun || c.UpdateLastApplied || c.SchedulingGate || c.LabelPropagation != "" || len(c.PinImageTags) > 0 || c.RolloutMaxUnavailable != "" || c.RolloutMaxSurge != "" || c.CoordinateHPA || c.DaemonSetDeletePods) {
+		errorsFound = true
+		glog.Errorf("--vpa-recommendation never updates the target, so it cannot be used with --dry-run, --update-last-applied, --scheduling-gate, --label-propagation, --pin-image-tag, --rollout-max-unavailable, --rollout-max-surge, --coordinate-hpa or --daemonset-delete-pods-on-update")
+	}
+	if c.PollBackoffMaxPeriod != 0 && c.PollBackoffMaxPeriod < time.Second*time.Duration(c.PollPeriodSeconds) {
+		errorsFound = true
+		glog.Errorf("--poll-backoff-max-period cannot be less than --poll-period-seconds")
+	}
+	if c.BackoffResetSuccesses < 1 {
+		errorsFound = true
+		glog.Errorf("--backoff-reset-successes cannot be less than 1")
+	}
+	if c.UnreadyAfterFailures < 1 {
+		errorsFound = true
+		glog.Errorf("--unready-after-failures cannot be less than 1")
+	}
+	if c.BootstrapStablePeriod < 0 {
+		errorsFound = true
+		glog.Errorf("--bootstrap-stable-period cannot be negative")
+	}
+	if c.RecommenderURL != "" && c.RecommenderTimeout <= 0 {
+		errorsFound = true
+		glog.Errorf("--recommender-timeout must be positive")
+	}
+	if c.RecommenderURL == "" && c.RecommenderAuthHeader != "" {
+		errorsFound = true
+		glog.Errorf("--recommender-auth-header-file requires --recommender-url")
+	}
+	if c.APIAddr == "" && c.APITokenFile != "" {
+		errorsFound = true
+		glog.Errorf("--api-token-file requires --api-addr")
+	}
+	if c.ApplyJitter < 0 {
+		errorsFound = true
+		glog.Errorf("--apply-jitter cannot be negative")
+	}
+	if c.ClusterSizeCacheTTL < 0 {
+		errorsFound = true
+		glog.Errorf("--cluster-size-cache-ttl cannot be negative")
+	}
+	if c.DaemonSetDeleteInterval <= 0 {
+		errorsFound = true
+		glog.Errorf("--daemonset-delete-pods-interval must be positive")
+	}
+	if c.TargetCreationTimeout < 0 {
+		errorsFound = true
+		glog.Errorf("--target-creation-timeout cannot be negative")
+	}
+	if c.NodeReadyGracePeriod < 0 {
+		errorsFound = true
+		glog.Errorf("--node-ready-grace-period cannot be negative")
+	}
+	if _, err := c.BaseNodeMemoryQuantity(); err != nil {
+		errorsFound = true
+		glog.Errorf("%v", err)
+	}
+	if _, _, err := c.MemoryToCPURatioQuantities(); err != nil {
+		errorsFound = true
+		glog.Errorf("%v", err)
+	}
+	if on, err := k8sclient.ParseScaleMetric(c.ScaleOn); err != nil {
+		errorsFound = true
+		glog.Errorf("invalid --scale-on: %v", err)
+	} else if on.Kind == k8sclient.ScaleOnPods && c.PodSelector == "" && c.PodAnnotationsSelector == "" {
+		errorsFound = true
+		glog.Errorf("--scale-on=pods requires --pod-selector or --pod-annotations-selector")
+	}
+	if c.MasterNodeWeight < 0 || c.MasterNodeWeight > 1 {
+		errorsFound = true
+		glog.Errorf("--master-node-weight must be between 0 and 1")
+	}
+	if c.BaseNodeMemory != "" && !c.MemoryWeightedNodes {
+		errorsFound = true
+		glog.Errorf("--base-node-memory requires --memory-weighted-nodes")
+	}
+	if c.PodEventPeriodMinutes < 0 {
+		errorsFound = true
+		glog.Errorf("--pod-event-period-minutes cannot be negative")
+	}
+	if c.PodEventPeriodMinutes > 0 && (c.PodName == "" || c.PodNamespace == "") {
+		errorsFound = true
+		glog.Errorf("--pod-event-period-minutes requires ${POD_NAME} and ${POD_NAMESPACE} to be set")
+	}
+	if c.MinEffectiveNodes < 1 {
+		errorsFound = true
+		glog.Errorf("--min-effective-nodes cannot be less than 1")
+	}
+	switch c.ZeroNodesPolicy {
+	case "skip", "floor", "last-good":
+	default:
+		errorsFound = true
+		glog.Errorf("--zero-nodes-policy must be one of skip, floor or last-good")
+	}
+	switch c.UnreachableClusters {
+	case "fail", "partial":
+	default:
+		errorsFound = true
+		glog.Errorf("--unreachable-cluster-policy must be one of fail or partial")
+	}
+	for _, entry := range c.AdditionalClusterList() {
+		if _, _, err := k8sclient.ParseClusterSource(entry); err != nil {
+			errorsFound = true
+			glog.Errorf("Invalid --additional-clusters: %v", err)
+		}
+	}
+	if c.ImpersonateGroups != "" && c.ImpersonateUser == "" {
+		errorsFound = true
+		glog.Errorf("--impersonate-group requires --impersonate-user")
+	}
+	switch c.APIContentType {
+	case "protobuf", "json":
+	default:
+		errorsFound = true
+		glog.Errorf("--api-content-type must be one of protobuf or json")
+	}
+	switch c.DryRunOutputFormat {
+	case "json", "yaml", "table":
+	default:
+		errorsFound = true
+		glog.Errorf("--dry-run-output-format must be one of json, yaml or table")
+	}
+	if c.AuditLogMaxSizeMB < 0 || c.AuditLogMaxAgeDays < 0 {
+		errorsFound = true
+		glog.Errorf("--audit-log-max-size-mb and --audit-log-max-age-days cannot be negative")
+	}
+	if c.AuditLogFatal && c.AuditLogFile == "" {
+		errorsFound = true
+		glog.Errorf("--audit-log-fatal requires --audit-log-file")
+	}
+	if c.ParquetRotateInterval <= 0 {
+		errorsFound = true
+		glog.Errorf("--parquet-rotate-interval must be positive")
+	}
+	if c.MinNodes < 0 || c.MaxNodes < 0 {
+		errorsFound = true
+		glog.Errorf("--min-nodes and --max-nodes cannot be negative")
+	}
+	if c.MinNodes > 0 && c.MaxNodes > 0 && c.MinNodes > c.MaxNodes {
+		errorsFound = true
+		glog.Errorf("--min-nodes cannot be more than --max-nodes")
+	}
+	if c.NodeAllocationThreshold < 1 {
+		errorsFound = true
+		glog.Errorf("--node-allocation-threshold cannot be less than 1")
+	}
+	if c.CoresChangeThreshold < 0 {
+		errorsFound = true
+		glog.Errorf("--cores-change-threshold cannot be negative")
+	}
 
 	// Log all sanity check errors before returning a single error string
 	if errorsFound {
@@ -105,6 +520,85 @@ func (c *AutoScalerConfig) ValidateFlags() error {
 	return nil
 }
 
+// AdditionalClusterList splits --additional-clusters.
+func (c *AutoScalerConfig) AdditionalClusterList() []string {
+	return splitList(c.AdditionalClusters)
+}
+
+// ImpersonateGroupList splits --impersonate-group.
+func (c *AutoScalerConfig) ImpersonateGroupList() []string {
+	return splitList(c.ImpersonateGroups)
+}
+
+// MasterNodeWeightOption returns --master-node-weight, or nil if it is 1, so
+// that control-plane nodes count fully.
+func (c *AutoScalerConfig) MasterNodeWeightOption() *float64 {
+	if c.MasterNodeWeight == 1 {
+		return nil
+	}
+	weight := c.MasterNodeWeight
+	return &weight
+}
+
+// BaseNodeMemoryQuantity parses --base-node-memory, or returns nil without
+// --memory-weighted-nodes.
+func (c *AutoScalerConfig) BaseNodeMemoryQuantity() (*resource.Quantity, error) {
+	if !c.MemoryWeightedNodes {
+		return nil, nil
+	}
+	if c.BaseNodeMemory == "" {
+		return nil, fmt.Errorf("--memory-weighted-nodes requires --base-node-memory")
+	}
+	base, err := resource.ParseQuantity(c.BaseNodeMemory)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --base-node-memory %q: %v", c.BaseNodeMemory, err)
+	}
+	if base.Sign() <= 0 {
+		return nil, fmt.Errorf("--base-node-memory must be positive")
+	}
+	return &base, nil
+}
+
+// MemoryToCPURatioQuantities parses --min-memory-to-cpu-ratio and
+// --max-memory-to-cpu-ratio.  A bound which is not set is nil.
+func (c *AutoScalerConfig) MemoryToCPURatioQuantities() (min, max *resource.Quantity, err error) {
+	for _, bound := range []struct {
+		flag  string
+		value string
+		q     **resource.Quantity
+	}{
+		{"--min-memory-to-cpu-ratio", c.MinMemoryToCPURatio, &min},
+		{"--max-memory-to-cpu-ratio", c.MaxMemoryToCPURatio, &max},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(bound.value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s %q: %v", bound.flag, bound.value, err)
+		}
+		if q.Sign() <= 0 {
+			return nil, nil, fmt.Errorf("%s must be positive", bound.flag)
+		}
+		*bound.q = &q
+	}
+	if min != nil && max != nil && min.Cmp(*max) > 0 {
+		return nil, nil, fmt.Errorf("--min-memory-to-cpu-ratio cannot be more than --max-memory-to-cpu-ratio")
+	}
+	return min, max, nil
+}
+
+// splitList splits a comma-separated flag, dropping empty entries.
+func splitList(s string) []string {
+	entries := []string{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
 func isTargetFormatValid(target string) bool {
 	if target == "" {
 		glog.Errorf("--target parameter cannot be empty")
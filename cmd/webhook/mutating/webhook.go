@@ -0,0 +1,152 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// The annotations which an autoscaler run with --managed-annotations reads.
+const (
+	// ManagedAnnotation marks a Deployment as meant to be autoscaled.
+	ManagedAnnotation = k8sclient.ManagedAnnotation
+	// PolicyConfigMapAnnotation names the ConfigMap with the config to
+	// scale a Deployment by.
+	PolicyConfigMapAnnotation = k8sclient.PolicyConfigMapAnnotation
+)
+
+// maxBodyBytes limits the size of admission reviews.
+const maxBodyBytes = 1 << 20
+
+// mutator annotates the new Deployments whose labels match selector.
+type mutator struct {
+	selector  labels.Selector
+	configMap string
+}
+
+// deployment is the part of a Deployment which is mutated.
+type deployment struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+}
+
+// patchOperation is an operation of a JSON patch.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+func (m *mutator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("can't read the request: %v", err), http.StatusBadRequest)
+		return
+	}
+	// admission.k8s.io/v1 has the same fields as v1beta1, the version which is
+	// vendored, so either is answered with the apiVersion of the request.
+	ar := admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, &ar); err != nil || ar.Request == nil {
+		http.Error(w, "the request must be an AdmissionReview with a request", http.StatusBadRequest)
+		return
+	}
+	ar.Response = m.review(ar.Request)
+	ar.Request = nil
+	data, err := json.Marshal(ar)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// review allows every request.  The creation of a Deployment whose labels
+// match the selector is patched to add the annotations it lacks.
+func (m *mutator) review(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	resp := &admissionv1beta1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Operation != admissionv1beta1.Create || req.Kind.Kind != "Deployment" {
+		return resp
+	}
+	obj := deployment{}
+	if err := json.Unmarshal(req.Object.Raw, &obj); err != nil {
+		glog.Errorf("Can't decode Deployment %s/%s, leaving it as is: %v", req.Namespace, req.Name, err)
+		return resp
+	}
+	if !m.selector.Matches(labels.Set(obj.Metadata.Labels)) {
+		return resp
+	}
+	patch := annotationPatch(obj.Metadata.Annotations, map[string]string{
+		ManagedAnnotation:         "true",
+		PolicyConfigMapAnnotation: m.configMap,
+	})
+	if len(patch) == 0 {
+		return resp
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		glog.Errorf("Can't encode the patch of Deployment %s/%s, leaving it as is: %v", req.Namespace, req.Name, err)
+		return resp
+	}
+	glog.V(2).Infof("Annotating Deployment %s/%s: %s", req.Namespace, obj.Metadata.Name, data)
+	pt := admissionv1beta1.PatchTypeJSONPatch
+	resp.Patch = data
+	resp.PatchType = &pt
+	return resp
+}
+
+// annotationPatch returns the JSON patch which adds those of annotations
+// which existing lacks.  Annotations which are already set, to whatever value,
+// are left alone.
+func annotationPatch(existing, annotations map[string]string) []patchOperation {
+	if len(existing) == 0 {
+		return []patchOperation{{Op: "add", Path: "/metadata/annotations", Value: annotations}}
+	}
+	keys := []string{}
+	for k := range annotations {
+		if _, found := existing[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	patch := []patchOperation{}
+	for _, k := range keys {
+		patch = append(patch, patchOperation{Op: "add", Path: "/metadata/annotations/" + escapePointer(k), Value: annotations[k]})
+	}
+	return patch
+}
+
+// escapePointer escapes s as a JSON pointer token.
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
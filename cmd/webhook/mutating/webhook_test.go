@@ -0,0 +1,178 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestServeMutate(t *testing.T) {
+	sel, err := labels.Parse("cpva=enabled")
+	if err != nil {
+		t.Fatalf("invalid selector: %v", err)
+	}
+	m := &mutator{selector: sel, configMap: "cpva-policy"}
+
+	testCases := []struct {
+		name      string
+		kind      string
+		operation admissionv1beta1.Operation
+		object    string
+		patch     []patchOperation
+	}{
+		{
+			name: "matching without annotations", kind: "Deployment", operation: admissionv1beta1.Create,
+			object: `{"metadata": {"name": "foo", "labels": {"cpva": "enabled"}}}`,
+			patch: []patchOperation{{Op: "add", Path: "/metadata/annotations", Value: map[string]interface{}{
+				"cpva.io/managed": "true", "cpva.io/policy-configmap": "cpva-policy",
+			}}},
+		},
+		{
+			name: "matching with annotations", kind: "Deployment", operation: admissionv1beta1.Create,
+			object: `{"metadata": {"name": "foo", "labels": {"cpva": "enabled"}, "annotations": {"a": "b"}}}`,
+			patch: []patchOperation{
+				{Op: "add", Path: "/metadata/annotations/cpva.io~1managed", Value: "true"},
+				{Op: "add", Path: "/metadata/annotations/cpva.io~1policy-configmap", Value: "cpva-policy"},
+			},
+		},
+		{
+			name: "matching with its own ConfigMap", kind: "Deployment", operation: admissionv1beta1.Create,
+			object: `{"metadata": {"name": "foo", "labels": {"cpva": "enabled"}, "annotations": {"cpva.io/policy-configmap": "other"}}}`,
+			patch:  []patchOperation{{Op: "add", Path: "/metadata/annotations/cpva.io~1managed", Value: "true"}},
+		},
+		{
+			name: "already annotated", kind: "Deployment", operation: admissionv1beta1.Create,
+			object: `{"metadata": {"name": "foo", "labels": {"cpva": "enabled"}, "annotations": {"cpva.io/managed": "false", "cpva.io/policy-configmap": "other"}}}`,
+		},
+		{
+			name: "not matching", kind: "Deployment", operation: admissionv1beta1.Create,
+			object: `{"metadata": {"name": "foo", "labels": {"cpva": "disabled"}}}`,
+		},
+		{
+			name: "update", kind: "Deployment", operation: admissionv1beta1.Update,
+			object: `{"metadata": {"name": "foo", "labels": {"cpva": "enabled"}}}`,
+		},
+		{
+			name: "not a Deployment", kind: "StatefulSet", operation: admissionv1beta1.Create,
+			object: `{"metadata": {"name": "foo", "labels": {"cpva": "enabled"}}}`,
+		},
+		{
+			name: "undecodable", kind: "Deployment", operation: admissionv1beta1.Create,
+			object: `{"metadata": []}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		ar := admissionv1beta1.AdmissionReview{
+			Request: &admissionv1beta1.AdmissionRequest{
+				UID:       "1234",
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: tc.kind},
+				Operation: tc.operation,
+				Object:    runtime.RawExtension{Raw: []byte(tc.object)},
+			},
+		}
+		body, err := json.Marshal(ar)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("POST", "/mutate", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d: %s", tc.name, rec.Code, rec.Body.String())
+			continue
+		}
+		got := admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Response == nil {
+			t.Errorf("%s: expected an AdmissionReview with a response, got %s", tc.name, rec.Body.String())
+			continue
+		}
+		if got.Response.UID != "1234" || !got.Response.Allowed {
+			t.Errorf("%s: expected the request to be allowed, got %+v", tc.name, got.Response)
+		}
+		if tc.patch == nil {
+			if len(got.Response.Patch) != 0 || got.Response.PatchType != nil {
+				t.Errorf("%s: expected no patch, got %s", tc.name, got.Response.Patch)
+			}
+			continue
+		}
+		if got.Response.PatchType == nil || *got.Response.PatchType != admissionv1beta1.PatchTypeJSONPatch {
+			t.Errorf("%s: expected a JSON patch, got %v", tc.name, got.Response.PatchType)
+		}
+		patch := []patchOperation{}
+		if err := json.Unmarshal(got.Response.Patch, &patch); err != nil {
+			t.Errorf("%s: undecodable patch %s: %v", tc.name, got.Response.Patch, err)
+			continue
+		}
+		if !reflect.DeepEqual(patch, tc.patch) {
+			t.Errorf("%s: expected patch %+v, got %+v", tc.name, tc.patch, patch)
+		}
+	}
+}
+
+func TestServeMutateVersions(t *testing.T) {
+	m := &mutator{selector: labels.Everything(), configMap: "cpva-policy"}
+	for _, version := range []string{"admission.k8s.io/v1", "admission.k8s.io/v1beta1"} {
+		body := fmt.Sprintf(`{"apiVersion": %q, "kind": "AdmissionReview", "request": {"uid": "1234", "kind": {"group": "apps", "version": "v1", "kind": "Deployment"}, "operation": "CREATE", "object": {"metadata": {"name": "foo"}}}}`, version)
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("POST", "/mutate", strings.NewReader(body)))
+		got := admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Response == nil {
+			t.Errorf("%s: expected an AdmissionReview with a response, got %s", version, rec.Body.String())
+			continue
+		}
+		if got.APIVersion != version || got.Kind != "AdmissionReview" {
+			t.Errorf("%s: expected the request's version, got %s %s", version, got.APIVersion, got.Kind)
+		}
+		if got.Response.UID != "1234" || len(got.Response.Patch) == 0 {
+			t.Errorf("%s: expected a patch of 1234, got %+v", version, got.Response)
+		}
+	}
+}
+
+func TestServeMutateBadRequests(t *testing.T) {
+	m := &mutator{selector: labels.Everything(), configMap: "cpva-policy"}
+	testCases := []struct {
+		name   string
+		method string
+		body   string
+		code   int
+	}{
+		{name: "GET", method: "GET", code: http.StatusMethodNotAllowed},
+		{name: "undecodable", method: "POST", body: `{`, code: http.StatusBadRequest},
+		{name: "without a request", method: "POST", body: `{"kind": "AdmissionReview"}`, code: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(tc.method, "/mutate", bytes.NewReader([]byte(tc.body))))
+		if rec.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.code, rec.Code)
+		}
+	}
+}
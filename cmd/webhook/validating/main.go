@@ -0,0 +1,58 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command validating is a validating admission webhook, which rejects
+// ScalePolicy objects whose spec isn't a valid policy.
+package main
+
+import (
+	goflag "flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/version"
+)
+
+func main() {
+	addr := pflag.String("addr", ":8443", "The address to serve the webhook at, over HTTPS, on /validate.")
+	certFile := pflag.String("tls-cert-file", "", "The file of the serving certificate, which the API server must trust.")
+	keyFile := pflag.String("tls-key-file", "", "The file of the private key of --tls-cert-file.")
+	printVer := pflag.Bool("version", false, "Print the version and exit.")
+	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
+	pflag.Parse()
+	goflag.CommandLine.Parse([]string{})
+
+	if *printVer {
+		fmt.Printf("%s\n", version.VERSION)
+		os.Exit(0)
+	}
+	if *certFile == "" || *keyFile == "" {
+		glog.Errorf("--tls-cert-file and --tls-key-file must be set")
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate", serveValidate)
+	glog.V(0).Infof("Serving the ScalePolicy validating webhook on %s", *addr)
+	if err := http.ListenAndServeTLS(*addr, *certFile, *keyFile, mux); err != nil {
+		glog.Errorf("%v", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/glog"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api/v1alpha1"
+)
+
+// maxBodyBytes limits the size of admission reviews.
+const maxBodyBytes = 1 << 20
+
+// scalePolicy is the part of a ScalePolicy object which is validated.  Its
+// spec is a policy of the REST API.
+type scalePolicy struct {
+	Spec v1alpha1.Policy `json:"spec"`
+}
+
+// serveValidate answers an AdmissionReview of a ScalePolicy, allowing it only
+// if its spec is a valid policy.
+func serveValidate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("can't read the request: %v", err), http.StatusBadRequest)
+		return
+	}
+	// admission.k8s.io/v1 has the same fields as v1beta1, the version which is
+	// vendored, so either is answered with the apiVersion of the request.
+	ar := admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, &ar); err != nil || ar.Request == nil {
+		http.Error(w, "the request must be an AdmissionReview with a request", http.StatusBadRequest)
+		return
+	}
+	ar.Response = review(ar.Request)
+	ar.Request = nil
+	data, err := json.Marshal(ar)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// review allows a ScalePolicy whose spec is a valid policy, and denies it
+// with the reason otherwise.  Requests without an object, i.e. deletions,
+// are allowed.
+func review(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	resp := &admissionv1beta1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if len(req.Object.Raw) == 0 || string(req.Object.Raw) == "null" {
+		return resp
+	}
+	obj := scalePolicy{}
+	err := json.Unmarshal(req.Object.Raw, &obj)
+	if err == nil {
+		err = autoscaler.ValidatePolicy(obj.Spec)
+	}
+	if err != nil {
+		glog.V(2).Infof("Denying %s of %s %s/%s: %v", req.Operation, req.Kind.Kind, req.Namespace, req.Name, err)
+		resp.Allowed = false
+		resp.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("invalid ScalePolicy: %v", err),
+		}
+	}
+	return resp
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestServeValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		operation admissionv1beta1.Operation
+		object    string
+		allowed   bool
+		contains  string
+	}{
+		{
+			name: "valid", operation: admissionv1beta1.Create, allowed: true,
+			object: `{"kind": "ScalePolicy", "spec": {"containers": {"foo": {"requests": {"cpu": {"base": "10m"}}}}}}`,
+		},
+		{
+			name: "without containers", operation: admissionv1beta1.Create, contains: "at least one container",
+			object: `{"kind": "ScalePolicy", "spec": {}}`,
+		},
+		{
+			name: "invalid container config", operation: admissionv1beta1.Create, contains: "soak",
+			object: `{"kind": "ScalePolicy", "spec": {"containers": {"foo": {"requests": {"cpu": {"ladder": {"soakSeconds": -1}}}}}}}`,
+		},
+		{
+			name: "undecodable spec", operation: admissionv1beta1.Create, contains: "invalid ScalePolicy",
+			object: `{"kind": "ScalePolicy", "spec": []}`,
+		},
+		{
+			name: "delete", operation: admissionv1beta1.Delete, allowed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		ar := admissionv1beta1.AdmissionReview{
+			Request: &admissionv1beta1.AdmissionRequest{UID: "1234", Operation: tc.operation},
+		}
+		if tc.object != "" {
+			ar.Request.Object = runtime.RawExtension{Raw: []byte(tc.object)}
+		}
+		body, err := json.Marshal(ar)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		rec := httptest.NewRecorder()
+		serveValidate(rec, httptest.NewRequest("POST", "/validate", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d: %s", tc.name, rec.Code, rec.Body.String())
+			continue
+		}
+		got := admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Response == nil {
+			t.Errorf("%s: expected an AdmissionReview with a response, got %s", tc.name, rec.Body.String())
+			continue
+		}
+		if got.Response.UID != "1234" {
+			t.Errorf("%s: expected the request's UID, got %q", tc.name, got.Response.UID)
+		}
+		if got.Response.Allowed != tc.allowed {
+			t.Errorf("%s: expected allowed=%v, got %+v", tc.name, tc.allowed, got.Response)
+		}
+		if !tc.allowed && (got.Response.Result == nil || !strings.Contains(got.Response.Result.Message, tc.contains)) {
+			t.Errorf("%s: expected a reason containing %q, got %+v", tc.name, tc.contains, got.Response.Result)
+		}
+	}
+}
+
+func TestServeValidateVersions(t *testing.T) {
+	for _, version := range []string{"admission.k8s.io/v1", "admission.k8s.io/v1beta1"} {
+		body := fmt.Sprintf(`{"apiVersion": %q, "kind": "AdmissionReview", "request": {"uid": "1234", "operation": "CREATE", "object": {"spec": {}}}}`, version)
+		rec := httptest.NewRecorder()
+		serveValidate(rec, httptest.NewRequest("POST", "/validate", strings.NewReader(body)))
+		got := admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Response == nil {
+			t.Errorf("%s: expected an AdmissionReview with a response, got %s", version, rec.Body.String())
+			continue
+		}
+		if got.APIVersion != version || got.Kind != "AdmissionReview" {
+			t.Errorf("%s: expected the request's version, got %s %s", version, got.APIVersion, got.Kind)
+		}
+		if got.Response.UID != "1234" || got.Response.Allowed {
+			t.Errorf("%s: expected a denial of 1234, got %+v", version, got.Response)
+		}
+	}
+}
+
+func TestServeValidateBadRequests(t *testing.T) {
+	testCases := []struct {
+		name   string
+		method string
+		body   string
+		code   int
+	}{
+		{name: "GET", method: "GET", code: http.StatusMethodNotAllowed},
+		{name: "undecodable", method: "POST", body: `{`, code: http.StatusBadRequest},
+		{name: "without a request", method: "POST", body: `{"kind": "AdmissionReview"}`, code: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		serveValidate(rec, httptest.NewRequest(tc.method, "/validate", strings.NewReader(tc.body)))
+		if rec.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.code, rec.Code)
+		}
+	}
+}
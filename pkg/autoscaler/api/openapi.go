@@ -0,0 +1,225 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api/v1alpha1"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	quantityType = reflect.TypeOf(resource.Quantity{})
+	rawType      = reflect.TypeOf(json.RawMessage{})
+	typesPkgPath = reflect.TypeOf(v1alpha1.Status{}).PkgPath()
+)
+
+// OpenAPISpec returns an OpenAPI 3.0 document describing the API.  The
+// schemas are generated from the types in v1alpha1, so that they can't drift
+// apart.
+func OpenAPISpec() map[string]interface{} {
+	g := schemaGenerator{}
+	prefix := "/" + v1alpha1.Version
+	status := g.schemaFor(reflect.TypeOf(v1alpha1.Status{}))
+	paths := map[string]interface{}{
+		prefix + "/state": map[string]interface{}{
+			"get": operation("getState", "The state of the last poll.", nil, map[string]interface{}{
+				"200": response("The state.", g.schemaFor(reflect.TypeOf(v1alpha1.ScaleState{}))),
+				"503": response("No poll has completed yet.", status),
+			}),
+		},
+		prefix + "/config": map[string]interface{}{
+			"get": operation("getConfig", "The config in effect, as last loaded.", nil, map[string]interface{}{
+				"200": response("The config.", g.schemaFor(reflect.TypeOf(v1alpha1.Config{}))),
+				"503": response("No config was loaded yet.", status),
+			}),
+		},
+		prefix + "/plans": map[string]interface{}{
+			"get": map[string]interface{}{
+				"operationId": "listPlans",
+				"summary":     "The most recent plans, newest first.",
+				"parameters": []interface{}{map[string]interface{}{
+					"name":        "limit",
+					"in":          "query",
+					"description": "Return at most this many plans.",
+					"schema":      map[string]interface{}{"type": "integer", "minimum": 1},
+				}},
+				"responses": map[string]interface{}{
+					"200": response("The plans.", g.schemaFor(reflect.TypeOf(v1alpha1.ScalePlanList{}))),
+					"400": response("The limit is invalid.", status),
+				},
+			},
+		},
+		prefix + "/policy": map[string]interface{}{
+			"put": authorized(operation("replacePolicy", "Replace the config of the autoscaler from the next poll on.",
+				g.schemaFor(reflect.TypeOf(v1alpha1.Policy{})), map[string]interface{}{
+					"200": response("The policy was accepted.", g.schemaFor(reflect.TypeOf(v1alpha1.Policy{}))),
+					"400": response("The request can't be decoded.", status),
+					"415": response("The request is neither JSON nor YAML.", status),
+					"422": response("The policy is invalid.", status),
+				}), status),
+		},
+		prefix + "/snapshot": map[string]interface{}{
+			"get": operation("getSnapshot", "What the autoscaler last counted and patched, and its config, for debugging.", nil, map[string]interface{}{
+				"200": response("The snapshot.", g.schemaFor(reflect.TypeOf(v1alpha1.Snapshot{}))),
+			}),
+		},
+		SnapshotPath: map[string]interface{}{
+			"get": operation("getSnapshotUnversioned", "The same as "+prefix+"/snapshot.", nil, map[string]interface{}{
+				"200": response("The snapshot.", g.schemaFor(reflect.TypeOf(v1alpha1.Snapshot{}))),
+			}),
+		},
+		prefix + "/scale/trigger": map[string]interface{}{
+			"post": authorized(operation("triggerScale", "Poll as soon as possible.", nil, map[string]interface{}{
+				"202": response("A poll was triggered.", status),
+			}), status),
+		},
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "cluster-proportional-vertical-autoscaler",
+			"version": v1alpha1.Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g,
+			"securitySchemes": map[string]interface{}{
+				"apiToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// authorized adds the API token, and the responses without it, to op.
+func authorized(op map[string]interface{}, status map[string]interface{}) map[string]interface{} {
+	op["security"] = []interface{}{map[string]interface{}{"apiToken": []interface{}{}}}
+	responses := op["responses"].(map[string]interface{})
+	responses["401"] = response("The request has no valid API token.", status)
+	responses["403"] = response("Changes are disabled, since there is no API token.", status)
+	return op
+}
+
+// operation describes an operation, with a request body of the given schema
+// if it isn't nil.
+func operation(id, summary string, body map[string]interface{}, responses map[string]interface{}) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": id,
+		"summary":     summary,
+		"responses":   responses,
+	}
+	if body != nil {
+		op["requestBody"] = map[string]interface{}{"required": true, "content": content(body)}
+	}
+	return op
+}
+
+func response(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"description": description, "content": content(schema)}
+}
+
+// content lists the media types which a body of the given schema may be
+// encoded in.
+func content(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		mediaJSON: map[string]interface{}{"schema": schema},
+		mediaYAML: map[string]interface{}{"schema": schema},
+	}
+}
+
+// schemaGenerator collects the schemas of the named types of the API, which
+// other schemas refer to.
+type schemaGenerator map[string]interface{}
+
+// schemaFor returns the schema of t, as encoded by encoding/json.
+func (g schemaGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case quantityType:
+		return map[string]interface{}{"type": "string", "description": "A quantity, e.g. \"100m\" or \"1Gi\"."}
+	case rawType:
+		return map[string]interface{}{"type": "object"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaFor(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.PkgPath() != typesPkgPath {
+			return g.structSchema(t)
+		}
+		if _, found := g[t.Name()]; !found {
+			g[t.Name()] = nil // In case the type refers to itself.
+			g[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the schema of the struct t.  Fields without omitempty
+// are required.
+func (g schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaFor(f.Type)
+		omitEmpty := false
+		for _, opt := range tag[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,343 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package api serves a versioned REST API over HTTP, which reports the state,
+// the config and the plans of the autoscaler and lets clients replace its
+// policy.  The types of each version are in a package of their own, e.g.
+// v1alpha1.
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api/v1alpha1"
+)
+
+// The media types which requests and responses may be encoded in.
+const (
+	mediaJSON = "application/json"
+	mediaYAML = "application/yaml"
+)
+
+// SnapshotPath serves the same snapshot as /v1alpha1/snapshot, at a path
+// which doesn't change with the version of the API.
+const SnapshotPath = "/api/v1/snapshot"
+
+// maxBodyBytes limits the size of request bodies.
+const maxBodyBytes = 1 << 20
+
+// Backend carries out the requests which change the autoscaler.
+type Backend interface {
+	// SetPolicy validates p, and makes it the config from the next poll on.
+	SetPolicy(p v1alpha1.Policy) error
+	// Trigger polls as soon as possible, rather than at the next period.
+	Trigger()
+	// Snapshot returns what the autoscaler last counted and patched.
+	Snapshot() v1alpha1.Snapshot
+}
+
+// Server serves the API from a store and a backend.
+type Server struct {
+	store   *Store
+	backend Backend
+	// The file which holds the bearer token that requests which change the
+	// autoscaler must present, or "" if they are refused.
+	tokenFile string
+	mux       *http.ServeMux
+}
+
+// NewServer returns a server for the state and plans in store, which passes
+// changes on to backend if they present the token in tokenFile.
+func NewServer(store *Store, backend Backend, tokenFile string) *Server {
+	s := &Server{store: store, backend: backend, tokenFile: tokenFile, mux: http.NewServeMux()}
+	prefix := "/" + v1alpha1.Version
+	s.handle(prefix+"/state", http.MethodGet, s.getState)
+	s.handle(prefix+"/config", http.MethodGet, s.getConfig)
+	s.handle(prefix+"/plans", http.MethodGet, s.getPlans)
+	s.handle(prefix+"/policy", http.MethodPut, s.authorized(s.putPolicy))
+	s.handle(prefix+"/scale/trigger", http.MethodPost, s.authorized(s.postTrigger))
+	s.handle(prefix+"/openapi", http.MethodGet, s.getOpenAPI)
+	s.handle(prefix+"/snapshot", http.MethodGet, s.getSnapshot)
+	// The path which support tooling asks for, whatever the API version.
+	s.handle(SnapshotPath, http.MethodGet, s.getSnapshot)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		writeStatus(w, req, http.StatusNotFound, "no such resource "+req.URL.Path)
+	})
+	return s
+}
+
+// Start serves the API at addr, e.g. ":9104", until the process exits.  It
+// returns the address it listens on.  If tokenFile is set, it must hold a
+// token already.
+func Start(addr string, store *Store, backend Backend, tokenFile string) (net.Addr, error) {
+	if tokenFile != "" {
+		if _, err := readToken(tokenFile); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't serve the API on %q: %v", addr, err)
+	}
+	go func() {
+		if err := http.Serve(l, NewServer(store, backend, tokenFile)); err != nil {
+			glog.Errorf("Stopped serving the API: %v", err)
+		}
+	}()
+	return l.Addr(), nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+// handle routes requests for path to h, if they use method and accept one of
+// our media types.
+func (s *Server) handle(path, method string, h http.HandlerFunc) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			w.Header().Set("Allow", method)
+			writeStatus(w, req, http.StatusMethodNotAllowed, fmt.Sprintf("%s only supports %s", path, method))
+			return
+		}
+		if negotiate(req.Header.Get("Accept")) == "" {
+			writeStatus(w, req, http.StatusNotAcceptable, "responses are "+mediaJSON+" or "+mediaYAML)
+			return
+		}
+		h(w, req)
+	})
+}
+
+// authorized passes requests on to h only if they present the bearer token
+// of tokenFile.  The file is read for every request, so that the token can
+// be rotated, e.g. in a mounted Secret.
+func (s *Server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if s.tokenFile == "" {
+			writeStatus(w, req, http.StatusForbidden, "changes are disabled, since the autoscaler has no --api-token-file")
+			return
+		}
+		token, err := readToken(s.tokenFile)
+		if err != nil {
+			glog.Errorf("%v", err)
+			writeStatus(w, req, http.StatusInternalServerError, "can't read the API token")
+			return
+		}
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeStatus(w, req, http.StatusUnauthorized, "changes require the API token as a bearer token")
+			return
+		}
+		h(w, req)
+	}
+}
+
+// readToken returns the token in file, without surrounding white space.
+func readToken(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("can't read the API token: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("the API token file %s is empty", file)
+	}
+	return token, nil
+}
+
+func (s *Server) getState(w http.ResponseWriter, req *http.Request) {
+	state := s.store.State()
+	if state == nil {
+		writeStatus(w, req, http.StatusServiceUnavailable, "no poll has completed yet")
+		return
+	}
+	write(w, req, http.StatusOK, state)
+}
+
+func (s *Server) getConfig(w http.ResponseWriter, req *http.Request) {
+	config := s.store.Config()
+	if config == nil {
+		writeStatus(w, req, http.StatusServiceUnavailable, "no config was loaded yet")
+		return
+	}
+	write(w, req, http.StatusOK, config)
+}
+
+func (s *Server) getPlans(w http.ResponseWriter, req *http.Request) {
+	plans := s.store.Plans()
+	if v := req.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			writeStatus(w, req, http.StatusBadRequest, fmt.Sprintf("limit must be a positive integer, not %q", v))
+			return
+		}
+		if limit < len(plans) {
+			plans = plans[:limit]
+		}
+	}
+	write(w, req, http.StatusOK, v1alpha1.ScalePlanList{Items: plans})
+}
+
+func (s *Server) putPolicy(w http.ResponseWriter, req *http.Request) {
+	var policy v1alpha1.Policy
+	if code, err := decode(w, req, &policy); err != nil {
+		writeStatus(w, req, code, err.Error())
+		return
+	}
+	if err := ValidatePolicy(policy); err != nil {
+		writeStatus(w, req, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := s.backend.SetPolicy(policy); err != nil {
+		writeStatus(w, req, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	write(w, req, http.StatusOK, policy)
+}
+
+func (s *Server) postTrigger(w http.ResponseWriter, req *http.Request) {
+	s.backend.Trigger()
+	writeStatus(w, req, http.StatusAccepted, "poll triggered")
+}
+
+func (s *Server) getSnapshot(w http.ResponseWriter, req *http.Request) {
+	snapshot := s.backend.Snapshot()
+	snapshot.Config = s.store.Config()
+	write(w, req, http.StatusOK, snapshot)
+}
+
+func (s *Server) getOpenAPI(w http.ResponseWriter, req *http.Request) {
+	write(w, req, http.StatusOK, OpenAPISpec())
+}
+
+// ValidatePolicy checks what can be checked without the autoscaler; the
+// backend validates the containers' configs.
+func ValidatePolicy(p v1alpha1.Policy) error {
+	if len(p.Containers) == 0 {
+		return fmt.Errorf("the policy must configure at least one container")
+	}
+	return nil
+}
+
+// negotiate returns the media type to respond in, given the Accept header of
+// a request, or "" if none of ours is acceptable.  Without a header, it is
+// JSON.
+func negotiate(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return mediaJSON
+	}
+	best, bestQ := "", 0.0
+	for _, r := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, found := params["q"]; found {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		media := ""
+		switch mt {
+		case mediaJSON, "application/*", "*/*":
+			media = mediaJSON
+		case mediaYAML, "application/x-yaml", "text/yaml":
+			media = mediaYAML
+		}
+		if media != "" && q > bestQ {
+			best, bestQ = media, q
+		}
+	}
+	return best
+}
+
+// decode reads the body of req into v, as JSON or YAML depending on its
+// Content-Type.  Unknown fields are rejected.  On error, it also returns the
+// HTTP status to respond with.
+func decode(w http.ResponseWriter, req *http.Request, v interface{}) (int, error) {
+	media := mediaJSON
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return http.StatusUnsupportedMediaType, fmt.Errorf("invalid Content-Type %q: %v", ct, err)
+		}
+		switch mt {
+		case mediaJSON:
+		case mediaYAML, "application/x-yaml", "text/yaml":
+			media = mediaYAML
+		default:
+			return http.StatusUnsupportedMediaType, fmt.Errorf("requests must be %s or %s, not %s", mediaJSON, mediaYAML, mt)
+		}
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	if err != nil {
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("can't read the request: %v", err)
+	}
+	if media == mediaYAML {
+		if data, err = yaml.YAMLToJSON(data); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid YAML: %v", err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid request: %v", err)
+	}
+	return http.StatusOK, nil
+}
+
+// write responds with v, encoded as the request accepts.
+func write(w http.ResponseWriter, req *http.Request, code int, v interface{}) {
+	media := negotiate(req.Header.Get("Accept"))
+	if media == "" {
+		// Only errors are written regardless.
+		media = mediaJSON
+	}
+	data, err := json.Marshal(v)
+	if err == nil && media == mediaYAML {
+		data, err = yaml.JSONToYAML(data)
+	}
+	if err != nil {
+		glog.Errorf("Can't encode the API response: %v", err)
+		http.Error(w, "can't encode the response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", media)
+	w.WriteHeader(code)
+	if _, err := w.Write(data); err != nil {
+		glog.V(4).Infof("Can't write the API response: %v", err)
+	}
+}
+
+// writeStatus responds with a Status.
+func writeStatus(w http.ResponseWriter, req *http.Request, code int, msg string) {
+	write(w, req, code, v1alpha1.Status{Code: code, Message: msg})
+}
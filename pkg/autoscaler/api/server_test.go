@@ -0,0 +1,382 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api/v1alpha1"
+)
+
+type fakeBackend struct {
+	policies []v1alpha1.Policy
+	err      error
+	triggers int
+}
+
+func (b *fakeBackend) SetPolicy(p v1alpha1.Policy) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.policies = append(b.policies, p)
+	return nil
+}
+
+func (b *fakeBackend) Trigger() {
+	b.triggers++
+}
+
+func (b *fakeBackend) Snapshot() v1alpha1.Snapshot {
+	patchTime := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	return v1alpha1.Snapshot{
+		TakenAt:       patchTime.Add(time.Minute),
+		Target:        "Deployment default/foo",
+		ClusterSize:   &v1alpha1.ClusterSize{Nodes: 3, Cores: 12},
+		LastPatch:     json.RawMessage(`{"spec":{}}`),
+		LastPatchType: "application/strategic-merge-patch+json",
+		LastPatchTime: &patchTime,
+	}
+}
+
+func testPlan(nodes int) v1alpha1.ScalePlan {
+	return v1alpha1.ScalePlan{
+		Timestamp:   time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+		Target:      "deployment/foo",
+		ClusterSize: v1alpha1.ClusterSize{Nodes: nodes, Cores: 4 * nodes},
+		Resources: map[string]apiv1.ResourceRequirements{
+			"foo": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+		},
+	}
+}
+
+func TestServer(t *testing.T) {
+	store := NewStore(2)
+	withState := NewStore(2)
+	withState.SetState(v1alpha1.ScaleState{Target: "deployment/foo", Namespace: "default"})
+	withState.SetConfig(v1alpha1.Config{
+		Target:     "deployment/foo",
+		Source:     "file",
+		Containers: map[string]json.RawMessage{"foo": json.RawMessage(`{"requests":{"cpu":{"base":"10m"}}}`)},
+	})
+	for nodes := 1; nodes <= 3; nodes++ {
+		withState.AddPlan(testPlan(nodes))
+	}
+	policy := `{"containers": {"foo": {"requests": {"cpu": {"base": "10m"}}}}}`
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const token = "Bearer s3cret"
+
+	for _, tc := range []struct {
+		name        string
+		store       *Store
+		method      string
+		path        string
+		contentType string
+		accept      string
+		auth        string
+		// If set, the server has no token, rather than tokenFile's.
+		noToken    bool
+		body       string
+		backendErr error
+		code       int
+		respType   string
+		contains   []string
+		policies   int
+		triggers   int
+	}{
+		{
+			name: "no state yet", store: store, method: "GET", path: "/v1alpha1/state",
+			code: http.StatusServiceUnavailable, respType: mediaJSON, contains: []string{`"code":503`},
+		},
+		{
+			name: "state", store: withState, method: "GET", path: "/v1alpha1/state",
+			code: http.StatusOK, respType: mediaJSON, contains: []string{`"target":"deployment/foo"`, `"namespace":"default"`},
+		},
+		{
+			name: "state as YAML", store: withState, method: "GET", path: "/v1alpha1/state", accept: "application/yaml",
+			code: http.StatusOK, respType: mediaYAML, contains: []string{"target: deployment/foo\n"},
+		},
+		{
+			name: "preferred media type", store: withState, method: "GET", path: "/v1alpha1/state", accept: "application/json;q=0.5, application/yaml",
+			code: http.StatusOK, respType: mediaYAML,
+		},
+		{
+			name: "unacceptable media type", store: withState, method: "GET", path: "/v1alpha1/state", accept: "text/html",
+			code: http.StatusNotAcceptable, respType: mediaJSON,
+		},
+		{
+			name: "wrong method", store: withState, method: "POST", path: "/v1alpha1/state",
+			code: http.StatusMethodNotAllowed, respType: mediaJSON,
+		},
+		{
+			name: "unknown path", store: withState, method: "GET", path: "/v1alpha1/nothing",
+			code: http.StatusNotFound, respType: mediaJSON,
+		},
+		{
+			name: "no config yet", store: store, method: "GET", path: "/v1alpha1/config",
+			code: http.StatusServiceUnavailable, respType: mediaJSON, contains: []string{`"code":503`},
+		},
+		{
+			name: "config", store: withState, method: "GET", path: "/v1alpha1/config",
+			code: http.StatusOK, respType: mediaJSON, contains: []string{`"source":"file"`, `"containers":{"foo":{"requests":{"cpu":{"base":"10m"}}}}`},
+		},
+		{
+			name: "plans, newest first", store: withState, method: "GET", path: "/v1alpha1/plans",
+			code: http.StatusOK, respType: mediaJSON, contains: []string{`"nodes":3,"cores":12`, `"nodes":2,"cores":8`},
+		},
+		{
+			name: "limited plans", store: withState, method: "GET", path: "/v1alpha1/plans?limit=1",
+			code: http.StatusOK, respType: mediaJSON, contains: []string{`{"items":[{"timestamp":"2017-07-14T02:40:00Z","target":"deployment/foo","clusterSize":{"nodes":3,`},
+		},
+		{
+			name: "invalid limit", store: withState, method: "GET", path: "/v1alpha1/plans?limit=0",
+			code: http.StatusBadRequest, respType: mediaJSON,
+		},
+		{
+			name: "snapshot", store: withState, method: "GET", path: "/v1alpha1/snapshot",
+			code: http.StatusOK, respType: mediaJSON, contains: []string{
+				`"target":"Deployment default/foo"`, `"clusterSize":{"nodes":3,"cores":12,`, `"config":{"target":"deployment/foo",`,
+				`"lastPatch":{"spec":{}},"lastPatchType":"application/strategic-merge-patch+json","lastPatchTime":"2017-07-14T02:40:00Z"`,
+			},
+		},
+		{
+			name: "snapshot at its unversioned path", store: withState, method: "GET", path: "/api/v1/snapshot",
+			code: http.StatusOK, respType: mediaJSON, contains: []string{`"target":"Deployment default/foo"`, `"config":{"target":"deployment/foo",`},
+		},
+		{
+			name: "snapshot without a config", store: store, method: "GET", path: "/v1alpha1/snapshot",
+			code: http.StatusOK, respType: mediaJSON, contains: []string{`"target":"Deployment default/foo"`},
+		},
+		{
+			name: "policy", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, body: policy,
+			code: http.StatusOK, respType: mediaJSON, contains: []string{`"containers":{"foo":`}, policies: 1,
+		},
+		{
+			name: "policy as YAML", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, contentType: "application/yaml",
+			body: "containers:\n  foo:\n    requests:\n      cpu:\n        base: 10m\n",
+			code: http.StatusOK, respType: mediaJSON, policies: 1,
+		},
+		{
+			name: "policy of unsupported media type", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, contentType: "text/plain", body: policy,
+			code: http.StatusUnsupportedMediaType, respType: mediaJSON,
+		},
+		{
+			name: "undecodable policy", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, body: `{"containers": [`,
+			code: http.StatusBadRequest, respType: mediaJSON,
+		},
+		{
+			name: "policy with unknown fields", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, body: `{"containrs": {}}`,
+			code: http.StatusBadRequest, respType: mediaJSON,
+		},
+		{
+			name: "policy without containers", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, body: `{"containers": {}}`,
+			code: http.StatusUnprocessableEntity, respType: mediaJSON,
+		},
+		{
+			name: "policy with a target", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, body: `{"target": "deployment/bar", "containers": {"foo": {}}}`,
+			code: http.StatusBadRequest, respType: mediaJSON, contains: []string{"target"},
+		},
+		{
+			name: "policy rejected by the backend", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, body: policy,
+			backendErr: fmt.Errorf("bad config"),
+			code:       http.StatusUnprocessableEntity, respType: mediaJSON, contains: []string{"bad config"},
+		},
+		{
+			name: "trigger", store: store, method: "POST", path: "/v1alpha1/scale/trigger", auth: token,
+			code: http.StatusAccepted, respType: mediaJSON, triggers: 1,
+		},
+		{
+			name: "policy without a token", store: store, method: "PUT", path: "/v1alpha1/policy", body: policy,
+			code: http.StatusUnauthorized, respType: mediaJSON,
+		},
+		{
+			name: "policy with a wrong token", store: store, method: "PUT", path: "/v1alpha1/policy", auth: "Bearer s3cre", body: policy,
+			code: http.StatusUnauthorized, respType: mediaJSON,
+		},
+		{
+			name: "trigger without a token", store: store, method: "POST", path: "/v1alpha1/scale/trigger", auth: "Basic czNjcmV0",
+			code: http.StatusUnauthorized, respType: mediaJSON,
+		},
+		{
+			name: "policy when changes are disabled", store: store, method: "PUT", path: "/v1alpha1/policy", auth: token, noToken: true, body: policy,
+			code: http.StatusForbidden, respType: mediaJSON, contains: []string{"--api-token-file"},
+		},
+		{
+			name: "trigger when changes are disabled", store: store, method: "POST", path: "/v1alpha1/scale/trigger", auth: token, noToken: true,
+			code: http.StatusForbidden, respType: mediaJSON,
+		},
+		{
+			name: "OpenAPI", store: store, method: "GET", path: "/v1alpha1/openapi",
+			code: http.StatusOK, respType: mediaJSON, contains: []string{`"openapi":"3.0.3"`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := &fakeBackend{err: tc.backendErr}
+			file := tokenFile
+			if tc.noToken {
+				file = ""
+			}
+			srv := httptest.NewServer(NewServer(tc.store, backend, file))
+			defer srv.Close()
+
+			req, err := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.code {
+				t.Errorf("expected status %d, got %d: %s", tc.code, resp.StatusCode, body)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tc.respType {
+				t.Errorf("expected a response of type %q, got %q", tc.respType, got)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(string(body), s) {
+					t.Errorf("expected the response to contain %q, got %s", s, body)
+				}
+			}
+			if len(backend.policies) != tc.policies || backend.triggers != tc.triggers {
+				t.Errorf("expected %d policies and %d triggers, got %d and %d", tc.policies, tc.triggers, len(backend.policies), backend.triggers)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		media  string
+	}{
+		{"", mediaJSON},
+		{"*/*", mediaJSON},
+		{"application/*", mediaJSON},
+		{"application/json", mediaJSON},
+		{"application/yaml", mediaYAML},
+		{"text/yaml", mediaYAML},
+		{"text/html, application/yaml;q=0.1", mediaYAML},
+		{"application/yaml;q=0.9, application/json", mediaJSON},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+	} {
+		if got := negotiate(tc.accept); got != tc.media {
+			t.Errorf("Accept %q: expected %q, got %q", tc.accept, tc.media, got)
+		}
+	}
+}
+
+func TestStoreKeepsTheNewestPlans(t *testing.T) {
+	store := NewStore(2)
+	if store.LastPlan() != nil || len(store.Plans()) != 0 {
+		t.Fatalf("expected an empty store")
+	}
+	for nodes := 1; nodes <= 3; nodes++ {
+		store.AddPlan(testPlan(nodes))
+	}
+	plans := store.Plans()
+	if len(plans) != 2 || plans[0].ClusterSize.Nodes != 3 || plans[1].ClusterSize.Nodes != 2 {
+		t.Errorf("expected the plans for 3 and 2 nodes, got %+v", plans)
+	}
+	if last := store.LastPlan(); last == nil || last.ClusterSize.Nodes != 3 {
+		t.Errorf("expected the last plan to be for 3 nodes, got %+v", last)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	data, err := json.Marshal(OpenAPISpec())
+	if err != nil {
+		t.Fatalf("can't encode the spec: %v", err)
+	}
+	if _, err := yaml.JSONToYAML(data); err != nil {
+		t.Fatalf("can't convert the spec to YAML: %v", err)
+	}
+	var spec struct {
+		Paths      map[string]map[string]interface{}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{}
+				Required   []string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("can't decode the spec: %v", err)
+	}
+	for path, method := range map[string]string{
+		"/v1alpha1/state":         "get",
+		"/v1alpha1/config":        "get",
+		"/v1alpha1/plans":         "get",
+		"/v1alpha1/policy":        "put",
+		"/v1alpha1/scale/trigger": "post",
+	} {
+		if _, found := spec.Paths[path][method]; !found {
+			t.Errorf("expected %s %s in the spec", method, path)
+		}
+	}
+	for _, name := range []string{"ScaleState", "Config", "ScalePlan", "ScalePlanList", "ClusterSize", "Policy", "Status"} {
+		if _, found := spec.Components.Schemas[name]; !found {
+			t.Errorf("expected a schema for %s", name)
+		}
+	}
+	// Every reference must resolve.
+	for _, ref := range strings.Split(string(data), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		if _, found := spec.Components.Schemas[name]; !found {
+			t.Errorf("unresolved reference to %s", name)
+		}
+	}
+	policy := spec.Components.Schemas["Policy"]
+	if _, found := policy.Properties["containers"]; !found || len(policy.Required) != 1 || policy.Required[0] != "containers" {
+		t.Errorf("expected containers to be the only required property of a policy, got %+v", policy)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"sync"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api/v1alpha1"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// DefaultMaxPlans is how many plans a store keeps by default.
+const DefaultMaxPlans = 20
+
+// Store holds the latest state of the autoscaler, its config and its most
+// recent plans, for the API to serve.  The autoscaler sets them from its
+// poll loop, and the server reads them concurrently.  Neither modifies them
+// afterwards.
+type Store struct {
+	mu       sync.Mutex
+	state    *v1alpha1.ScaleState
+	config   *v1alpha1.Config
+	plans    []v1alpha1.ScalePlan // Oldest first.
+	maxPlans int
+}
+
+// NewStore returns an empty store which keeps up to maxPlans plans.
+func NewStore(maxPlans int) *Store {
+	return &Store{maxPlans: maxPlans}
+}
+
+// SetState replaces the state.
+func (s *Store) SetState(state v1alpha1.ScaleState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = &state
+}
+
+// State returns the state, or nil if there is none yet.
+func (s *Store) State() *v1alpha1.ScaleState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// SetConfig replaces the config.
+func (s *Store) SetConfig(config v1alpha1.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = &config
+}
+
+// Config returns the config, or nil if none was loaded yet.
+func (s *Store) Config() *v1alpha1.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config
+}
+
+// AddPlan adds a plan, dropping the oldest one if the store is full.
+func (s *Store) AddPlan(plan v1alpha1.ScalePlan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plans = append(s.plans, plan)
+	if len(s.plans) > s.maxPlans {
+		s.plans = append([]v1alpha1.ScalePlan(nil), s.plans[len(s.plans)-s.maxPlans:]...)
+	}
+}
+
+// LastPlan returns the newest plan, or nil if there is none yet.
+func (s *Store) LastPlan() *v1alpha1.ScalePlan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.plans) == 0 {
+		return nil
+	}
+	plan := s.plans[len(s.plans)-1]
+	return &plan
+}
+
+// Plans returns the plans, newest first.
+func (s *Store) Plans() []v1alpha1.ScalePlan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plans := make([]v1alpha1.ScalePlan, 0, len(s.plans))
+	for i := len(s.plans) - 1; i >= 0; i-- {
+		plans = append(plans, s.plans[i])
+	}
+	return plans
+}
+
+// NewClusterSize converts a cluster size to its API representation.
+func NewClusterSize(size *k8sclient.ClusterSize) v1alpha1.ClusterSize {
+	return v1alpha1.ClusterSize{
+		Nodes:            size.Nodes,
+		Cores:            size.Cores,
+		MatchingPods:     size.MatchingPods,
+		PendingPods:      size.PendingPods,
+		AverageNodeCores: size.AverageNodeCores,
+		CPUUtilization:   size.CPUUtilization,
+	}
+}
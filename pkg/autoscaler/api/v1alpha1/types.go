@@ -0,0 +1,122 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 holds the types of version v1alpha1 of the autoscaler's
+// REST API.
+package v1alpha1
+
+import (
+	"encoding/json"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Version is the path prefix of this version of the API.
+const Version = "v1alpha1"
+
+// ClusterSize is what the autoscaler counted in the cluster.
+type ClusterSize struct {
+	Nodes            int `json:"nodes"`
+	Cores            int `json:"cores"`
+	MatchingPods     int `json:"matchingPods"`
+	PendingPods      int `json:"pendingPods"`
+	AverageNodeCores int `json:"averageNodeCores"`
+	CPUUtilization   int `json:"cpuUtilization"`
+}
+
+// ScaleState is what the autoscaler last saw and did.
+type ScaleState struct {
+	// Target is the resource being scaled, e.g. "deployment/foo".
+	Target    string `json:"target"`
+	Namespace string `json:"namespace"`
+	// PolledAt is the time of the last poll, and ClusterSize what it
+	// counted.
+	PolledAt    time.Time   `json:"polledAt"`
+	ClusterSize ClusterSize `json:"clusterSize"`
+	// Applied are the resources of each container which were last applied
+	// to the target, if any.
+	Applied map[string]apiv1.ResourceRequirements `json:"applied,omitempty"`
+}
+
+// ScalePlan is the resources computed for each container from a cluster
+// size.  Plans are computed on every poll, whether or not they are applied.
+type ScalePlan struct {
+	Timestamp   time.Time                             `json:"timestamp"`
+	Target      string                                `json:"target"`
+	ClusterSize ClusterSize                           `json:"clusterSize"`
+	Resources   map[string]apiv1.ResourceRequirements `json:"resources"`
+}
+
+// ScalePlanList is the most recent plans, newest first.
+type ScalePlanList struct {
+	Items []ScalePlan `json:"items"`
+}
+
+// Policy replaces the config of the autoscaler, as a config file would.  It
+// can't change the target, since the API isn't authenticated: only the
+// config file can.
+type Policy struct {
+	// Containers maps the name of each container to its config, in the
+	// format of the config file.
+	Containers map[string]json.RawMessage `json:"containers"`
+}
+
+// Config is the config which the autoscaler currently scales with, as of
+// the last time it was loaded.
+type Config struct {
+	// Target is the resource being scaled, e.g. "deployment/foo", and
+	// ContainerPath where its containers are.
+	Target        string `json:"target"`
+	ContainerPath string `json:"containerPath"`
+	// Source is where the config was loaded from: "file" for the config
+	// file, "policy" for a policy set through the API, or "default" for
+	// the --default-config alone.
+	Source   string    `json:"source"`
+	LoadedAt time.Time `json:"loadedAt"`
+	// Version identifies the config, as the audit log records it.
+	Version string `json:"version"`
+	// Containers maps the name of each container to its config as parsed,
+	// with the --default-config merged in and every field present.  The
+	// fields are capitalized, e.g. "Base", which the config file and
+	// policies accept as well.
+	Containers map[string]json.RawMessage `json:"containers"`
+}
+
+// Snapshot is everything a support engineer first needs to debug the
+// autoscaler: what it last counted, the config it scales with, and the last
+// patch it applied to the target.
+type Snapshot struct {
+	TakenAt time.Time `json:"takenAt"`
+	// Target is the resource being scaled, e.g. "Deployment default/foo".
+	Target string `json:"target"`
+	// ClusterSize is what the last poll counted, if one did yet.
+	ClusterSize *ClusterSize `json:"clusterSize,omitempty"`
+	// Config is the config in effect, if one was loaded yet.
+	Config *Config `json:"config,omitempty"`
+	// LastPatch is the last patch applied to the target, of LastPatchType,
+	// e.g. "application/strategic-merge-patch+json", at LastPatchTime, if
+	// one was yet.
+	LastPatch     json.RawMessage `json:"lastPatch,omitempty"`
+	LastPatchType string          `json:"lastPatchType,omitempty"`
+	LastPatchTime *time.Time      `json:"lastPatchTime,omitempty"`
+}
+
+// Status describes why a request failed.
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api/v1alpha1"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+
+	"github.com/golang/glog"
+)
+
+// apiPolicy is a policy set through the REST API, which the poll loop has
+// not picked up yet.
+type apiPolicy struct {
+	config ScaleConfig
+}
+
+// SetPolicy validates p, and hands it to the poll loop, which replaces the
+// config with it on the next poll.  Like the config file, the policy's
+// containers are merged into the --default-config.  A policy stays in
+// effect until the config file changes.  It implements api.Backend.
+func (s *AutoScaler) SetPolicy(p v1alpha1.Policy) error {
+	cfg, err := policyConfig(p, s.defaultConfig)
+	if err != nil {
+		return err
+	}
+	if err := cfg.validatePools(s.taintPool); err != nil {
+		return err
+	}
+	s.policyMu.Lock()
+	s.pendingPolicy = &apiPolicy{config: cfg}
+	s.policyMu.Unlock()
+	glog.V(0).Infof("Accepted a policy through the API")
+	s.Trigger()
+	return nil
+}
+
+// ValidatePolicy checks a policy on its own, e.g. before it is stored: the
+// config of its containers, as SetPolicy would with an empty
+// --default-config.
+func ValidatePolicy(p v1alpha1.Policy) error {
+	if err := api.ValidatePolicy(p); err != nil {
+		return err
+	}
+	_, err := policyConfig(p, ScaleConfig{})
+	return err
+}
+
+// policyConfig returns the containers of p merged into base, once they are
+// validated.
+func policyConfig(p v1alpha1.Policy, base ScaleConfig) (ScaleConfig, error) {
+	data, err := json.Marshal(p.Containers)
+	if err != nil {
+		return nil, err
+	}
+	cfg := base.DeepCopy()
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid containers: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Trigger makes the poll loop poll as soon as possible.  Triggers which
+// arrive while a poll is pending are coalesced.  It implements api.Backend.
+func (s *AutoScaler) Trigger() {
+	select {
+	case s.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+// Snapshot returns what the k8s client last measured and patched.  The
+// server adds the config in effect.  It implements api.Backend.
+func (s *AutoScaler) Snapshot() v1alpha1.Snapshot {
+	k8sSnapshot := s.k8sClient.TakeSnapshot()
+	snapshot := v1alpha1.Snapshot{
+		TakenAt: s.clock.Now(),
+		Target:  k8sSnapshot.Target,
+	}
+	if k8sSnapshot.ClusterSize != nil {
+		size := api.NewClusterSize(k8sSnapshot.ClusterSize)
+		snapshot.ClusterSize = &size
+	}
+	if k8sSnapshot.LastPatch != nil {
+		t := k8sSnapshot.LastPatchTime
+		snapshot.LastPatch = k8sSnapshot.LastPatch
+		snapshot.LastPatchType = string(k8sSnapshot.LastPatchType)
+		snapshot.LastPatchTime = &t
+	}
+	return snapshot
+}
+
+// peekPolicy returns the pending policy, if any.
+func (s *AutoScaler) peekPolicy() *apiPolicy {
+	s.policyMu.Lock()
+	defer s.policyMu.Unlock()
+	return s.pendingPolicy
+}
+
+// clearPolicy drops p once it is in effect, unless it was replaced meanwhile.
+func (s *AutoScaler) clearPolicy(p *apiPolicy) {
+	s.policyMu.Lock()
+	defer s.policyMu.Unlock()
+	if s.pendingPolicy == p {
+		s.pendingPolicy = nil
+	}
+}
+
+// storeState makes the outcome of a poll available over the REST API, if
+// configured.
+func (s *AutoScaler) storeState(clusterSize *k8sclient.ClusterSize) {
+	if s.apiStore == nil {
+		return
+	}
+	s.apiStore.SetState(v1alpha1.ScaleState{
+		Target:      s.target,
+		Namespace:   s.namespace,
+		PolledAt:    s.clock.Now(),
+		ClusterSize: api.NewClusterSize(clusterSize),
+		Applied:     s.lastReqs,
+	})
+}
+
+// storeConfig makes the config in effect available over the REST API, if
+// configured.
+func (s *AutoScaler) storeConfig() {
+	if s.apiStore == nil {
+		return
+	}
+	containers := map[string]json.RawMessage{}
+	for ctr, cfg := range s.currentConfig {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			glog.Errorf("Can't encode the config of container %q for the API: %v", ctr, err)
+			continue
+		}
+		containers[ctr] = data
+	}
+	s.apiStore.SetConfig(v1alpha1.Config{
+		Target:        s.target,
+		ContainerPath: s.containerPath.String(),
+		Source:        s.configSource,
+		LoadedAt:      s.clock.Now(),
+		Version:       s.currentConfig.Version(),
+		Containers:    containers,
+	})
+}
+
+// storePlan makes a new plan available over the REST API, if configured.
+// Like recommendations, unchanged plans are not stored again.
+func (s *AutoScaler) storePlan(clusterSize *k8sclient.ClusterSize, reqs map[string]apiv1.ResourceRequirements) {
+	if s.apiStore == nil {
+		return
+	}
+	size := api.NewClusterSize(clusterSize)
+	if last := s.apiStore.LastPlan(); last != nil && last.Target == s.target && last.ClusterSize == size && requirementsEqual(last.Resources, reqs) {
+		return
+	}
+	s.apiStore.AddPlan(v1alpha1.ScalePlan{
+		Timestamp:   s.clock.Now(),
+		Target:      s.target,
+		ClusterSize: size,
+		Resources:   reqs,
+	})
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api/v1alpha1"
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestSetPolicy(t *testing.T) {
+	defaults := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m"}}}}`), &defaults); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16}
+	store := api.NewStore(api.DefaultMaxPlans)
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		defaultTarget: "deployment/foo",
+		k8sClient:     mockK8s,
+		defaultConfig: defaults,
+		apiStore:      store,
+		triggerCh:     make(chan struct{}, 1),
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+	autoScaler.pollAPIServer(context.Background())
+	if state := store.State(); state == nil || state.ClusterSize.Nodes != 4 || state.Target != "deployment/foo" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	if plans := store.Plans(); len(plans) != 1 {
+		t.Fatalf("expected one plan, got %+v", plans)
+	}
+	if config := store.Config(); config == nil || config.Source != "default" || len(config.Containers) != 1 {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+
+	for _, containers := range []string{
+		`{"foo": {"requests": {"cpu": {"ladder": {"soakSeconds": -1}}}}}`,
+		`{"foo": []}`,
+	} {
+		p := v1alpha1.Policy{}
+		if err := json.Unmarshal([]byte(containers), &p.Containers); err != nil {
+			t.Fatalf("invalid containers: %v", err)
+		}
+		if err := autoScaler.SetPolicy(p); err == nil {
+			t.Errorf("expected an error for containers %s", containers)
+		}
+	}
+	if autoScaler.peekPolicy() != nil || len(autoScaler.triggerCh) != 0 {
+		t.Fatalf("expected invalid policies to be dropped")
+	}
+
+	p := v1alpha1.Policy{}
+	if err := json.Unmarshal([]byte(`{"bar": {"requests": {"cpu": {"base": "50m"}}}}`), &p.Containers); err != nil {
+		t.Fatalf("invalid containers: %v", err)
+	}
+	if err := autoScaler.SetPolicy(p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(autoScaler.triggerCh) != 1 {
+		t.Errorf("expected a poll to be triggered")
+	}
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.peekPolicy() != nil {
+		t.Errorf("expected the policy to be picked up")
+	}
+	// A policy can't change the target.
+	if autoScaler.target != "deployment/foo" || mockK8s.Target != "" {
+		t.Errorf("expected target deployment/foo, got %q (client %q)", autoScaler.target, mockK8s.Target)
+	}
+	// The policy is merged into the default config.
+	if len(autoScaler.currentConfig) != 2 {
+		t.Errorf("expected configs for foo and bar, got %v", autoScaler.currentConfig)
+	}
+	config := store.Config()
+	if config == nil || config.Source != "policy" || config.Target != "deployment/foo" || config.Version != autoScaler.currentConfig.Version() {
+		t.Errorf("unexpected config: %+v", config)
+	} else if bar := string(config.Containers["bar"]); !strings.Contains(bar, `"Base":"50m"`) {
+		t.Errorf("expected the config of bar to be served, got %s", bar)
+	}
+	cpu := autoScaler.lastReqs["bar"].Requests["cpu"]
+	if cpu.MilliValue() != 50 {
+		t.Errorf("expected 50m for bar, got %s", cpu.String())
+	}
+	plans := store.Plans()
+	if len(plans) != 2 || plans[0].Target != "deployment/foo" {
+		t.Errorf("expected a plan for deployment/foo, got %+v", plans)
+	}
+
+	// Unchanged plans are not stored again.
+	autoScaler.pollAPIServer(context.Background())
+	if plans := store.Plans(); len(plans) != 2 {
+		t.Errorf("expected two plans, got %d", len(plans))
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ApplyJitter delays the first update after each config change by a random
+// time of up to Max, so that autoscalers across a fleet which get the same
+// change at once don't all restart their targets at once.  The cluster is
+// still sampled meanwhile, and the latest recommendation is applied once the
+// delay is over.
+type ApplyJitter struct {
+	Max time.Duration
+	// Returns a random number in [0, n).  Defaults to rand.Int63n.
+	random func(n int64) int64
+	// When the pending update may be applied, or zero if none is pending.
+	notBefore time.Time
+}
+
+// NewApplyJitter returns an ApplyJitter of up to max.  The random delays are
+// seeded from the time, so that autoscalers which start together differ.
+func NewApplyJitter(max time.Duration) *ApplyJitter {
+	return &ApplyJitter{Max: max, random: rand.New(rand.NewSource(time.Now().UnixNano())).Int63n}
+}
+
+// ConfigChanged chooses the delay of the next update, from now.
+func (j *ApplyJitter) ConfigChanged(now time.Time) {
+	var delay time.Duration
+	if j.Max > 0 {
+		random := j.random
+		if random == nil {
+			random = rand.Int63n
+		}
+		delay = time.Duration(random(int64(j.Max)))
+	}
+	j.notBefore = now.Add(delay)
+	glog.V(0).Infof("Delaying the next update by %v, until %v", delay, j.notBefore.Format(time.RFC3339))
+}
+
+// Pending returns whether an update is held back, or was and hasn't been
+// applied yet.
+func (j *ApplyJitter) Pending() bool {
+	return !j.notBefore.IsZero()
+}
+
+// Delays returns whether an update must wait at now.
+func (j *ApplyJitter) Delays(now time.Time) bool {
+	return j.Pending() && now.Before(j.notBefore)
+}
+
+// Applied records that the pending update, if any, was applied or turned out
+// not to be needed.
+func (j *ApplyJitter) Applied() {
+	j.notBefore = time.Time{}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestApplyJitter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var max int64
+	j := &ApplyJitter{Max: 10 * time.Minute, random: func(n int64) int64 {
+		max = n
+		return int64(3 * time.Minute)
+	}}
+	if j.Pending() || j.Delays(now) {
+		t.Fatalf("expected nothing to be pending before a config change")
+	}
+	j.ConfigChanged(now)
+	if max != int64(10*time.Minute) {
+		t.Errorf("expected a delay of up to 10m, asked for up to %v", time.Duration(max))
+	}
+	for _, tc := range []struct {
+		after  time.Duration
+		delays bool
+	}{
+		{0, true},
+		{3*time.Minute - time.Second, true},
+		{3 * time.Minute, false},
+		{time.Hour, false},
+	} {
+		if got := j.Delays(now.Add(tc.after)); got != tc.delays {
+			t.Errorf("after %v: expected delays %v, got %v", tc.after, tc.delays, got)
+		}
+	}
+	if !j.Pending() {
+		t.Errorf("expected the update to be pending until it is applied")
+	}
+	j.Applied()
+	if j.Pending() || j.Delays(now) {
+		t.Errorf("expected nothing to be pending once applied")
+	}
+}
+
+func TestApplyJitterDelaysOnlyTheUpdate(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "coresPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	fakeClock := clock.NewFakeClock(time.Now())
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16}
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		defaultTarget: "deployment/foo",
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+		deltaScaler:   &DeltaScaler{Threshold: 1},
+		applyJitter: &ApplyJitter{Max: 10 * time.Minute, random: func(n int64) int64 {
+			return int64(5 * time.Minute)
+		}},
+		clock: fakeClock,
+	}
+
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.lastReqs != nil {
+		t.Fatalf("expected the first update to be delayed")
+	}
+	// The cluster is still sampled while the update waits, and the latest
+	// recommendation is applied, even though the number of nodes didn't
+	// change.
+	mockK8s.NumOfCores = 20
+	fakeClock.Step(4 * time.Minute)
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.lastReqs != nil {
+		t.Fatalf("expected the update to be delayed for 5m")
+	}
+	fakeClock.Step(time.Minute)
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.lastReqs == nil {
+		t.Fatalf("expected the update to be applied after 5m")
+	}
+	cpu := autoScaler.lastReqs["foo"].Requests["cpu"]
+	if cpu.MilliValue() != 300 {
+		t.Errorf("expected the latest recommendation of 300m, got %s", cpu.String())
+	}
+	if autoScaler.applyJitter.Pending() {
+		t.Errorf("expected nothing to be pending once applied")
+	}
+
+	// Later changes of the cluster are applied at once.
+	mockK8s.NumOfNodes, mockK8s.NumOfCores = 8, 32
+	autoScaler.pollAPIServer(context.Background())
+	cpu = autoScaler.lastReqs["foo"].Requests["cpu"]
+	if cpu.MilliValue() != 420 {
+		t.Errorf("expected 420m, got %s", cpu.String())
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jsonl keeps an audit log of the applied scale plans, as a file of
+// JSON lines.  Each line holds the hash of the line before it, so that
+// changes to the log can be detected.
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/publishers"
+)
+
+var _ = publishers.EventPublisher(&JSONLinesAuditWriter{})
+
+// Stdout is the path which stands for standard output.
+const Stdout = "-"
+
+// Entry is one line of the audit log.
+type Entry struct {
+	Timestamp time.Time            `json:"timestamp"`
+	Plan      publishers.ScalePlan `json:"plan"`
+	// The resources of the containers before the plan was applied, by
+	// container name, if known.
+	Previous map[string]apiv1.ResourceRequirements `json:"previous,omitempty"`
+	// Identifies the config the plan was computed from.
+	ConfigVersion string `json:"configVersion,omitempty"`
+	// The hex SHA-256 of the previous line, without its newline, or empty
+	// for the first entry.
+	PrevHash string `json:"prevHash"`
+}
+
+// logFile is where the lines of the log go.
+type logFile interface {
+	io.WriteCloser
+	// Sync commits what was written to stable storage.
+	Sync() error
+}
+
+// JSONLinesAuditWriter appends an Entry per scale event to a log file, which
+// is rotated by size and age, see rotatingFile.  The hash chain continues
+// across rotations and restarts.  Every entry is synced before Publish
+// returns.
+type JSONLinesAuditWriter struct {
+	mu       sync.Mutex
+	file     logFile
+	prevHash string
+}
+
+// NewJSONLinesAuditWriter opens the log at path, or writes to standard output
+// for Stdout.  A file is rotated once it would grow beyond maxSizeMB
+// megabytes, and rotated files older than maxAgeDays days are deleted.
+// Either limit may be 0 for none.
+func NewJSONLinesAuditWriter(path string, maxSizeMB, maxAgeDays int) (*JSONLinesAuditWriter, error) {
+	if path == Stdout {
+		// The chain starts afresh, as what was written before can't be
+		// read back.
+		return &JSONLinesAuditWriter{file: stdoutFile{os.Stdout}}, nil
+	}
+	prevHash, err := lastLineHash(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read audit log %q: %v", path, err)
+	}
+	file, err := openRotatingFile(path, maxSizeMB, maxAgeDays)
+	if err != nil {
+		return nil, fmt.Errorf("can't open audit log %q: %v", path, err)
+	}
+	return &JSONLinesAuditWriter{file: file, prevHash: prevHash}, nil
+}
+
+// Name returns the name of the publisher.
+func (a *JSONLinesAuditWriter) Name() string {
+	return "audit-log"
+}
+
+// Publish appends the event to the log.
+func (a *JSONLinesAuditWriter) Publish(ev *publishers.ScaleEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	line, err := json.Marshal(&Entry{
+		Timestamp:     ev.Timestamp,
+		Plan:          ev.Plan,
+		Previous:      ev.Previous,
+		ConfigVersion: ev.ConfigVersion,
+		PrevHash:      a.prevHash,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("can't write audit log: %v", err)
+	}
+	// The line is in the log, even if it isn't synced yet.
+	a.prevHash = hashLine(line)
+	if err := a.file.Sync(); err != nil {
+		return fmt.Errorf("can't sync audit log: %v", err)
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (a *JSONLinesAuditWriter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// stdoutFile writes the log to standard output, which is neither synced nor
+// closed.
+type stdoutFile struct {
+	io.Writer
+}
+
+func (stdoutFile) Sync() error {
+	return nil
+}
+
+func (stdoutFile) Close() error {
+	return nil
+}
+
+func hashLine(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// lastLineHash returns the hash of the last line of the file at path, or
+// empty if there is none.
+func lastLineHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var last []byte
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimRight(line, "\n"); len(line) > 0 {
+			last = line
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if last == nil {
+		return "", nil
+	}
+	return hashLine(last), nil
+}
+
+// Verify reads a log and checks that each entry holds the hash of the one
+// before it.  It returns the hash of the last line, to verify a log that was
+// rotated from this one, and an error naming the first line that doesn't
+// match.  prevHash is the hash that the first entry should hold.
+func Verify(r io.Reader, prevHash string) (string, error) {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\n")
+		if len(line) > 0 {
+			entry := &Entry{}
+			if err := json.Unmarshal(line, entry); err != nil {
+				return "", fmt.Errorf("line %d: %v", n, err)
+			}
+			if entry.PrevHash != prevHash {
+				return "", fmt.Errorf("line %d: expected previous hash %q, found %q", n, prevHash, entry.PrevHash)
+			}
+			prevHash = hashLine(line)
+		}
+		if err == io.EOF {
+			return prevHash, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
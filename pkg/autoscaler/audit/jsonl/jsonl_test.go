@@ -0,0 +1,239 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/publishers"
+)
+
+func TestPublishChainsEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpva-audit")
+	if err != nil {
+		t.Fatalf("can't create dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	for _, nodes := range []int{1, 2} {
+		a, err := NewJSONLinesAuditWriter(path, 0, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Reopening continues the chain.
+		for i := 0; i < 2; i++ {
+			ev := &publishers.ScaleEvent{Timestamp: time.Unix(1500000000, 0), Plan: publishers.ScalePlan{Nodes: nodes}}
+			if err := a.Publish(ev); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		a.Close()
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("can't read log: %v", err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 4 {
+		t.Errorf("expected 4 lines, got %d", n)
+	}
+	if _, err := Verify(bytes.NewReader(data), ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tampered := bytes.Replace(data, []byte(`"nodes":1`), []byte(`"nodes":9`), 1)
+	if _, err := Verify(bytes.NewReader(tampered), ""); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+}
+
+func TestEntryFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpva-audit")
+	if err != nil {
+		t.Fatalf("can't create dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	a, err := NewJSONLinesAuditWriter(path, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Close()
+	requests := func(cpu string) map[string]apiv1.ResourceRequirements {
+		return map[string]apiv1.ResourceRequirements{
+			"dns": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu)}},
+		}
+	}
+	events := []*publishers.ScaleEvent{
+		{
+			Timestamp: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+			Plan: publishers.ScalePlan{
+				Namespace:        "kube-system",
+				TargetKind:       "deployment",
+				TargetName:       "dns",
+				Nodes:            5,
+				Cores:            20,
+				AverageNodeCores: 4,
+				Resources:        requests("300m"),
+			},
+			Previous:      requests("200m"),
+			ConfigVersion: "3b0c44298fc1",
+		},
+		{
+			Timestamp: time.Date(2017, 7, 14, 2, 50, 0, 0, time.UTC),
+			Plan: publishers.ScalePlan{
+				Namespace:  "kube-system",
+				TargetKind: "deployment",
+				TargetName: "dns",
+				Nodes:      6,
+				Resources:  requests("400m"),
+			},
+		},
+	}
+	for _, ev := range events {
+		if err := a.Publish(ev); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("can't read log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	expected := []string{
+		`{"timestamp":"2017-07-14T02:40:00Z","plan":{"namespace":"kube-system","targetKind":"deployment","targetName":"dns","nodes":5,"cores":20,"matchingPods":0,"pendingPods":0,"averageNodeCores":4,"resources":{"dns":{"requests":{"cpu":"300m"}}}},"previous":{"dns":{"requests":{"cpu":"200m"}}},"configVersion":"3b0c44298fc1","prevHash":""}`,
+		// Without the optional fields.
+		`{"timestamp":"2017-07-14T02:50:00Z","plan":{"namespace":"kube-system","targetKind":"deployment","targetName":"dns","nodes":6,"cores":0,"matchingPods":0,"pendingPods":0,"averageNodeCores":0,"resources":{"dns":{"requests":{"cpu":"400m"}}}},"prevHash":"` + hashLine([]byte(lines[0])) + `"}`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d: expected\n%s\ngot\n%s", i+1, expected[i], lines[i])
+		}
+	}
+}
+
+func TestStdout(t *testing.T) {
+	a, err := NewJSONLinesAuditWriter(Stdout, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	a.file = stdoutFile{&buf}
+	for _, nodes := range []int{1, 2} {
+		if err := a.Publish(&publishers.ScaleEvent{Plan: publishers.ScalePlan{Nodes: nodes}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := Verify(&buf, ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpva-audit")
+	if err != nil {
+		t.Fatalf("can't create dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	r, err := openRotatingFile(path, 1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Close()
+	// The first two blocks fit into one megabyte, the third doesn't.
+	blocks := []string{"a", "b", "c"}
+	for _, b := range blocks {
+		if _, err := r.Write([]byte(strings.Repeat(b, 400*1024-1) + "\n")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := r.Sync(); err != nil {
+			t.Fatalf("unexpected sync error: %v", err)
+		}
+	}
+	backups, err := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v (%v)", backups, err)
+	}
+	if data, err := ioutil.ReadFile(backups[0]); err != nil || len(data) != 800*1024 || data[0] != 'a' {
+		t.Errorf("expected the first two blocks in %s, got %d bytes (%v)", backups[0], len(data), err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || len(data) != 400*1024 || data[0] != 'c' {
+		t.Errorf("expected the third block in the log, got %d bytes (%v)", len(data), err)
+	}
+}
+
+func TestPublishChainsAcrossRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpva-audit")
+	if err != nil {
+		t.Fatalf("can't create dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	a, err := NewJSONLinesAuditWriter(path, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Close()
+	for nodes := 1; nodes <= 3; nodes++ {
+		if err := a.Publish(&publishers.ScaleEvent{Plan: publishers.ScalePlan{Nodes: nodes}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if nodes == 2 {
+			if err := a.file.(*rotatingFile).Rotate(); err != nil {
+				t.Fatalf("can't rotate: %v", err)
+			}
+		}
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v (%v)", backups, err)
+	}
+	prevHash := ""
+	for _, name := range []string{backups[0], path} {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("can't open %s: %v", name, err)
+		}
+		prevHash, err = Verify(f, prevHash)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonl
+
+import (
+	"math"
+	"os"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// rotatingFile is an append-only file which is moved aside once it would grow
+// beyond a size, and whose moved files are deleted once older than an age.
+// The moved files are named e.g. audit-2017-07-14T02-40-00.000.jsonl for
+// audit.jsonl.
+type rotatingFile struct {
+	*lumberjack.Logger
+}
+
+// openRotatingFile opens the file at path, creating it if needed, so that
+// e.g. a directory which isn't writable is noticed at startup.  Either limit
+// may be 0 for none.
+func openRotatingFile(path string, maxSizeMB, maxAgeDays int) (*rotatingFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if maxSizeMB == 0 {
+		// The Logger takes 0 for its default of 100MB.
+		maxSizeMB = math.MaxInt32
+	}
+	return &rotatingFile{&lumberjack.Logger{
+		Filename: path,
+		MaxSize:  maxSizeMB,
+		MaxAge:   maxAgeDays,
+	}}, nil
+}
+
+// Sync commits the current file to stable storage.  The Logger doesn't expose
+// its file, so it is opened again: fsync flushes a file whichever descriptor
+// it was written through.
+func (r *rotatingFile) Sync() error {
+	f, err := os.OpenFile(r.Filename, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package auth provides the credentials of the cloud provider APIs which the
+// autoscaler calls, the way the providers' SDKs find them: from the
+// environment, from the pod's service account through IRSA or Workload
+// Identity, or from the node.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Cached credentials are refreshed this long before they expire.
+const refreshBefore = 5 * time.Minute
+
+// AwsCredentials sign requests to AWS APIs.
+type AwsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// Empty for long-term credentials.
+	SessionToken string
+	// Zero for credentials which don't expire.
+	Expires time.Time
+}
+
+// AwsCredentialSource provides AWS credentials.
+type AwsCredentialSource interface {
+	// Retrieve returns credentials which are valid for at least a few
+	// minutes.
+	Retrieve() (AwsCredentials, error)
+}
+
+var _ = AwsCredentialSource(&AwsCredentialProvider{})
+
+// AwsCredentialProvider finds AWS credentials with the default chain of the
+// AWS SDK, e.g. from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, from
+// AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE as set by IRSA (IAM roles for
+// service accounts), or from the role of the node.  Temporary credentials are
+// cached until shortly before they expire.
+type AwsCredentialProvider struct {
+	region string
+
+	lock        sync.Mutex
+	credentials aws.CredentialsProvider
+}
+
+// NewAwsCredentialProvider returns a provider which calls STS in region, or
+// in the region of the SDK's config, e.g. AWS_REGION, if region is empty.
+func NewAwsCredentialProvider(region string) *AwsCredentialProvider {
+	return &AwsCredentialProvider{region: region}
+}
+
+// Retrieve returns the first credentials found.
+func (p *AwsCredentialProvider) Retrieve() (AwsCredentials, error) {
+	credentials, err := p.provider()
+	if err != nil {
+		return AwsCredentials{}, err
+	}
+	c, err := credentials.Retrieve(context.Background())
+	if err != nil {
+		return AwsCredentials{}, fmt.Errorf("can't get AWS credentials: %v", err)
+	}
+	creds := AwsCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken}
+	if c.CanExpire {
+		creds.Expires = c.Expires
+	}
+	return creds, nil
+}
+
+// provider loads the SDK's config on first use, so that a broken shared
+// config file only fails the calls which need credentials.
+func (p *AwsCredentialProvider) provider() (aws.CredentialsProvider, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.credentials != nil {
+		return p.credentials, nil
+	}
+	opts := []func(*config.LoadOptions) error{
+		config.WithCredentialsCacheOptions(func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = refreshBefore
+		}),
+	}
+	if p.region != "" {
+		opts = append(opts, config.WithRegion(p.region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("can't load the AWS config: %v", err)
+	}
+	p.credentials = cfg.Credentials
+	return p.credentials, nil
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setenv sets the environment variables, and returns a func which restores
+// them.
+func setenv(vars map[string]string) func() {
+	old := map[string]*string{}
+	for k, v := range vars {
+		if prev, found := os.LookupEnv(k); found {
+			old[k] = &prev
+		} else {
+			old[k] = nil
+		}
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, prev := range old {
+			if prev != nil {
+				os.Setenv(k, *prev)
+			} else {
+				os.Unsetenv(k)
+			}
+		}
+	}
+}
+
+// awsTestEnv keeps the SDK from reading the user's config files, and from
+// calling the instance metadata service, unless vars say otherwise.
+func awsTestEnv(dir string, vars map[string]string) map[string]string {
+	env := map[string]string{
+		"AWS_CONFIG_FILE":             filepath.Join(dir, "config"),
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(dir, "credentials"),
+		"AWS_EC2_METADATA_DISABLED":   "true",
+	}
+	for k, v := range vars {
+		env[k] = v
+	}
+	return env
+}
+
+func TestAwsCredentialsFromEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer setenv(awsTestEnv(dir, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "SECRET",
+		"AWS_SESSION_TOKEN":     "SESSION",
+		// Ignored, as the keys come first.
+		"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/cpvpa",
+		"AWS_WEB_IDENTITY_TOKEN_FILE": "/nonexistent",
+	}))()
+	creds, err := NewAwsCredentialProvider("us-east-1").Retrieve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds != (AwsCredentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "SESSION"}) {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+}
+
+func TestAwsCredentialsFromWebIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("JWT"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := 0
+	var expires time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		req.ParseForm()
+		if req.PostForm.Get("Action") != "AssumeRoleWithWebIdentity" || req.PostForm.Get("WebIdentityToken") != "JWT" ||
+			req.PostForm.Get("RoleArn") != "arn:aws:iam::123456789012:role/cpvpa" || req.PostForm.Get("RoleSessionName") != "session" {
+			t.Errorf("unexpected request: %v", req.PostForm)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIA</AccessKeyId>
+      <SecretAccessKey>SECRET</SecretAccessKey>
+      <SessionToken>SESSION</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`, expires.UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+	defer setenv(awsTestEnv(dir, map[string]string{
+		"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/cpvpa",
+		"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile,
+		"AWS_ROLE_SESSION_NAME":       "session",
+		"AWS_ENDPOINT_URL_STS":        server.URL,
+	}))()
+
+	p := NewAwsCredentialProvider("us-east-1")
+	for _, tc := range []struct {
+		name      string
+		expiresIn time.Duration
+		calls     int
+	}{
+		{"first", 4 * time.Minute, 1},
+		// The cached credentials are about to expire.
+		{"refreshed", time.Hour, 2},
+		{"cached", time.Hour, 2},
+	} {
+		if calls < tc.calls {
+			expires = time.Now().Add(tc.expiresIn).Truncate(time.Second)
+		}
+		creds, err := p.Retrieve()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		// The SDK moves the expiry forward by the refresh window.
+		expected := AwsCredentials{AccessKeyID: "ASIA", SecretAccessKey: "SECRET", SessionToken: "SESSION", Expires: expires.Add(-refreshBefore)}
+		if !creds.Expires.Equal(expected.Expires) || creds.AccessKeyID != expected.AccessKeyID ||
+			creds.SecretAccessKey != expected.SecretAccessKey || creds.SessionToken != expected.SessionToken {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, expected, creds)
+		}
+		if calls != tc.calls {
+			t.Errorf("%s: expected %d calls to STS, got %d", tc.name, tc.calls, calls)
+		}
+	}
+}
+
+func TestAwsCredentialsFromInstanceRole(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// The SDK refreshes instance role credentials at least hourly.
+	expires := time.Now().Add(30 * time.Minute).Truncate(time.Second).UTC()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/latest/api/token" {
+			if req.Method != "PUT" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			w.Write([]byte("IMDSTOKEN"))
+			return
+		}
+		if req.Header.Get("X-aws-ec2-metadata-token") != "IMDSTOKEN" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("node-role"))
+		case "/latest/meta-data/iam/security-credentials/node-role":
+			fmt.Fprintf(w, `{"Code": "Success", "AccessKeyId": "ASIA", "SecretAccessKey": "SECRET", "Token": "SESSION", "Expiration": %q}`,
+				expires.Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defer setenv(awsTestEnv(dir, map[string]string{
+		"AWS_EC2_METADATA_DISABLED":         "false",
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT": server.URL,
+	}))()
+
+	creds, err := NewAwsCredentialProvider("").Retrieve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.AccessKeyID != "ASIA" || creds.SessionToken != "SESSION" || !creds.Expires.Equal(expires.Add(-refreshBefore)) {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+
+	server.Close()
+	if _, err := NewAwsCredentialProvider("").Retrieve(); err == nil {
+		t.Errorf("expected an error without any credentials")
+	}
+}
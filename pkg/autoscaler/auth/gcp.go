@@ -0,0 +1,73 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// The scope of the tokens, which covers GCS.  Tokens from the metadata server
+// have the scopes of the node or service account instead.
+const gcpScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// GcpTokenSource provides OAuth2 access tokens for Google Cloud APIs.
+type GcpTokenSource interface {
+	// Token returns a token which is valid for at least a few minutes.
+	Token() (string, error)
+}
+
+var _ = GcpTokenSource(&GcpCredentialProvider{})
+
+// GcpCredentialProvider gets tokens from Application Default Credentials:
+// the key file which GOOGLE_APPLICATION_CREDENTIALS names, gcloud's
+// credentials, or the metadata server, which with GKE Workload Identity hands
+// out the tokens of the Google service account bound to the pod's Kubernetes
+// service account.  Tokens are cached until shortly before they expire.
+type GcpCredentialProvider struct {
+	lock   sync.Mutex
+	tokens oauth2.TokenSource
+}
+
+// NewGcpCredentialProvider returns a provider which uses Application Default
+// Credentials.
+func NewGcpCredentialProvider() *GcpCredentialProvider {
+	return &GcpCredentialProvider{}
+}
+
+// Token returns a cached access token, fetching a new one if it is about to
+// expire.
+func (p *GcpCredentialProvider) Token() (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.tokens == nil {
+		creds, err := google.FindDefaultCredentials(context.Background(), gcpScope)
+		if err != nil {
+			return "", fmt.Errorf("can't find GCP credentials: %v", err)
+		}
+		p.tokens = creds.TokenSource
+	}
+	tok, err := p.tokens.Token()
+	if err != nil {
+		return "", fmt.Errorf("can't get GCP access token: %v", err)
+	}
+	return tok.AccessToken, nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gcpTestEnv keeps Application Default Credentials from finding the user's
+// gcloud credentials, unless vars say otherwise.
+func gcpTestEnv(dir string, vars map[string]string) map[string]string {
+	env := map[string]string{
+		"HOME":                           dir,
+		"GOOGLE_APPLICATION_CREDENTIALS": "",
+	}
+	for k, v := range vars {
+		env[k] = v
+	}
+	return env
+}
+
+func TestGcpCredentialsFromKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("unexpected request: %v", req.PostForm)
+		}
+		tokens++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "TOKEN", "expires_in": 3600, "token_type": "Bearer"}`))
+	}))
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyFile, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "cpvpa@project.iam.gserviceaccount.com",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"token_uri":      server.URL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyPath := filepath.Join(dir, "key.json")
+	if err := ioutil.WriteFile(keyPath, keyFile, 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer setenv(gcpTestEnv(dir, map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": keyPath}))()
+
+	p := NewGcpCredentialProvider()
+	// The token is cached.
+	for i := 0; i < 2; i++ {
+		token, err := p.Token()
+		if err != nil || token != "TOKEN" {
+			t.Errorf("call %d: expected TOKEN, got %q, %v", i, token, err)
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("expected 1 token to be fetched, got %d", tokens)
+	}
+}
+
+func TestGcpCredentialsFromMetadataServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if req.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		tokens++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "TOKEN", "expires_in": 3600, "token_type": "Bearer"}`))
+	}))
+	defer server.Close()
+	defer setenv(gcpTestEnv(dir, map[string]string{
+		"GCE_METADATA_HOST": strings.TrimPrefix(server.URL, "http://"),
+	}))()
+
+	p := NewGcpCredentialProvider()
+	for i := 0; i < 2; i++ {
+		token, err := p.Token()
+		if err != nil || token != "TOKEN" {
+			t.Errorf("call %d: expected TOKEN, got %q, %v", i, token, err)
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("expected 1 token to be fetched, got %d", tokens)
+	}
+
+	server.Close()
+	if _, err := NewGcpCredentialProvider().Token(); err == nil {
+		t.Errorf("expected an error without a metadata server")
+	}
+}
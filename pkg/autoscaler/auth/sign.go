@@ -0,0 +1,50 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// SignAwsRequest adds an AWS Signature Version 4 to req, whose body is body,
+// for service in region, with the credentials of creds.
+func SignAwsRequest(req *http.Request, body []byte, creds AwsCredentialSource, service, region string, now time.Time) error {
+	c, err := creds.Retrieve()
+	if err != nil {
+		return fmt.Errorf("can't get AWS credentials: %v", err)
+	}
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	signer := v4.NewSigner()
+	if service == "s3" {
+		// S3 wants the payload hash as a header, and object keys escaped once.
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+		signer = v4.NewSigner(func(o *v4.SignerOptions) {
+			o.DisableURIPathEscaping = true
+		})
+	}
+	awsCreds := aws.Credentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken}
+	return signer.SignHTTP(context.Background(), awsCreds, req, payloadHash, service, region, now)
+}
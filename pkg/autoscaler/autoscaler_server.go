@@ -18,12 +18,18 @@ package autoscaler
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
-	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
@@ -31,28 +37,134 @@ import (
 	"k8s.io/apimachinery/pkg/util/clock"
 
 	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/api"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/audit/jsonl"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/auth"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters/azuremonitor"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters/cloudwatch"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters/dogstatsd"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters/parquet"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters/prometheus"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/grpcserver"
 	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/publishers"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/publishers/nats"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/recommender"
 
 	"github.com/golang/glog"
 )
 
 // AutoScaler determines the number of replicas to run
 type AutoScaler struct {
-	k8sClient     k8sclient.K8sClient
-	defaultConfig ScaleConfig
-	configFile    string
-	lastFileInfo  os.FileInfo
-	currentConfig ScaleConfig
-	lastReqs      map[string]apiv1.ResourceRequirements
-	pollPeriod    time.Duration
-	clock         clock.Clock
-	stopCh        chan struct{}
-	readyCh       chan<- struct{} // For testing.
-}
-
-// NewAutoScaler returns a new AutoScaler
-func NewAutoScaler(c *options.AutoScalerConfig) (*AutoScaler, error) {
-	newK8sClient, err := k8sclient.NewK8sClient(c.Namespace, c.Target, c.Kubeconfig, c.DryRun)
+	namespace string
+	// The target currently managed, and the one from --target, which is
+	// used when the config file does not name one.
+	target        string
+	defaultTarget string
+	// Where the containers of the target are, and where they are by
+	// default, from --container-patch-path.
+	containerPath        k8sclient.ContainerPath
+	defaultContainerPath k8sclient.ContainerPath
+	// If set, a target that is replaced via the config file gets back the
+	// resources it had before we first updated it.
+	resetReplacedTarget bool
+	originalReqs        map[string]apiv1.ResourceRequirements
+	k8sClient           k8sclient.K8sClient
+	defaultConfig       ScaleConfig
+	configFile          string
+	lastFileInfo        os.FileInfo
+	// If set, the config is instead read from the ConfigMap named by the
+	// target's annotations, and lastManaged is the last one read.
+	managedAnnotations bool
+	lastManaged        *k8sclient.ManagedConfig
+	currentConfig       ScaleConfig
+	// The last valid config, to fall back on when an update of the config
+	// file fails to parse.  Its active policy is currentConfig.
+	policies PolicyStore
+	// Where currentConfig was loaded from, as served by the REST API.
+	configSource string
+	lastReqs     map[string]apiv1.ResourceRequirements
+	lastSize     *k8sclient.ClusterSize // At the time of lastReqs.
+	// Evaluated alongside the active config for comparison, but never
+	// applied.  Nil if not configured.
+	shadowConfig   ScaleConfig
+	lastShadowReqs map[string]apiv1.ResourceRequirements
+	// If set, records whether the scale cycles succeed, for the readiness
+	// probe.
+	readiness *Readiness
+	// If set, lengthens the poll period while the cycles fail.
+	pollBackoff *PollBackoff
+	// If set, asked for the resources instead of computing them, and its
+	// last valid answer, which is reused if it fails.
+	recommender      *recommender.HTTPRecommender
+	lastExternalReqs map[string]apiv1.ResourceRequirements
+	// The env variables which the config's patches last set.
+	lastEnv     map[string][]apiv1.EnvVar
+	deltaScaler *DeltaScaler
+	// Holds back higher ladder rungs until they have soaked.
+	ladderSoak *LadderSoak
+	// Whether the nodes are split by the --taint-toleration-match taint.
+	taintPool bool
+	// Whether every config is only loaded if the target has all of its
+	// containers, as for --validate-target.
+	validateTarget bool
+	// What to do when no nodes are counted, and the size to fall back to.
+	zeroNodesPolicy ZeroNodesPolicy
+	lastGoodSize    *k8sclient.ClusterSize
+	// The floor on the number of nodes used as a divisor.
+	minEffectiveNodes int
+	// Caches the cluster size between polls.  Nil if not configured.
+	clusterSizeCache *k8sclient.CachingClusterSizeProvider
+	exporters        []exporters.MetricsExporter
+	// Failed updates since startup, by target.
+	updateFailures map[exporters.Target]int
+	// The changes to the requests which were applied since the metrics were
+	// last exported.
+	requestChanges []exporters.RequestChange
+	publishers     []publishers.EventPublisher
+	// If set, failing to write the audit log is fatal.
+	auditLogFatal bool
+	updateWindow  *UpdateWindow
+	// Delays the first update after a config change.  Nil if not
+	// configured.
+	applyJitter *ApplyJitter
+	// Holds the target at the floor while a new cluster grows.  Nil if not
+	// configured.
+	bootstrapHold *BootstrapHold
+	// The metric of the metricPerStep and metricLadder axes.
+	scaleOn k8sclient.ScaleMetric
+	// Bounds the memory per core of the recommendations.  Nil if not
+	// configured.
+	memoryToCPURatio *MemoryToCPURatio
+	planEvents       *PlanEventRecorder
+	// If set, the scheduling gate is removed from the target's pods once
+	// their resources are set, see releaseGatedPods.
+	schedulingGate bool
+	// The latest recommendation, served over gRPC.  Nil if not configured.
+	recommendations *grpcserver.Store
+	// The state and plans served by the REST API.  Nil if not configured.
+	apiStore *api.Store
+	// A policy from the REST API, which replaces the config on the next
+	// poll.  Nil if there is none.
+	policyMu      sync.Mutex
+	pendingPolicy *apiPolicy
+	watchHPA      bool
+	triggerCh     chan struct{}
+	// Forces a scale cycle, see ForceScale.
+	forceCh chan struct{}
+	// The latest cluster size from the node watch, see watchNodes.
+	nodeCh     chan *k8sclient.ClusterSize
+	pollPeriod time.Duration
+	clock      clock.Clock
+	stopCh     chan struct{}
+	readyCh    chan<- struct{} // For testing.
+}
+
+// NewAutoScaler returns a new AutoScaler.  Cancelling ctx aborts the API
+// discovery of the target.
+func NewAutoScaler(ctx context.Context, c *options.AutoScalerConfig) (*AutoScaler, error) {
+	formatter, err := k8sclient.NewPatchFormatter(c.DryRunOutputFormat)
 	if err != nil {
 		return nil, err
 	}
@@ -61,101 +173,1176 @@ func NewAutoScaler(c *options.AutoScalerConfig) (*AutoScaler, error) {
 		if err := json.Unmarshal([]byte(c.DefaultConfig), &cfg); err != nil {
 			return nil, fmt.Errorf("invalid default config: %v", err)
 		}
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid default config: %v", err)
+		}
+		if err := cfg.LoadLookupTables(); err != nil {
+			return nil, fmt.Errorf("invalid default config: %v", err)
+		}
+	}
+	baseNodeMemory, err := c.BaseNodeMemoryQuantity()
+	if err != nil {
+		return nil, err
+	}
+	scaleOn, err := k8sclient.ParseScaleMetric(c.ScaleOn)
+	if err != nil {
+		return nil, err
+	}
+	containerPath, err := k8sclient.ParseContainerPath(c.ContainerPatchPath)
+	if err != nil {
+		return nil, err
+	}
+	taintPool, err := k8sclient.ParseTaintMatch(c.TaintTolerationMatch)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.validatePools(taintPool != nil); err != nil {
+		return nil, fmt.Errorf("invalid default config: %v", err)
+	}
+	rollout, err := k8sclient.ParseRolloutOverride(c.RolloutMaxUnavailable, c.RolloutMaxSurge, c.RestoreRollout)
+	if err != nil {
+		return nil, err
+	}
+	precision, err := k8sclient.ParseQuantityPrecision(c.QuantityPrecision)
+	if err != nil {
+		return nil, err
+	}
+	labelPropagation, err := k8sclient.ParseLabelPropagation(c.LabelPropagation)
+	if err != nil {
+		return nil, err
 	}
-	return &AutoScaler{
-		k8sClient:     newK8sClient,
-		defaultConfig: cfg,
-		configFile:    c.ConfigFile,
-		pollPeriod:    time.Second * time.Duration(c.PollPeriodSeconds),
-		clock:         clock.RealClock{},
-		stopCh:        make(chan struct{}),
-		readyCh:       make(chan struct{}, 1),
-	}, nil
+	pins, err := k8sclient.ParseImageTagPins(c.PinImageTags)
+	if err != nil {
+		return nil, err
+	}
+	groupMins, err := k8sclient.ParseNodeGroupMinNodes(c.NodeGroupMinNodes)
+	if err != nil {
+		return nil, err
+	}
+	weightRules, err := k8sclient.ParseNodeWeightRules(c.NodeLabelWeights)
+	if err != nil {
+		return nil, err
+	}
+	weightAggregation, err := k8sclient.ParseWeightAggregation(c.NodeWeightAggregation)
+	if err != nil {
+		return nil, err
+	}
+	newK8sClient, err := k8sclient.NewK8sClient(ctx, c.Namespace, c.Target, c.Kubeconfig, k8sclient.Options{
+		PodSelector:           c.PodSelector,
+		PodAnnotationSelector: c.PodAnnotationsSelector,
+		CountPendingPods:      c.CountPendingPods,
+		CountCPUUtilization:   c.CountCPUUtilization,
+		SkipZeroCPUNodes:      c.SkipZeroCPUNodes,
+		NodeOS:                c.NodeOS,
+		TaintPool:             taintPool,
+		NodeReadyGracePeriod:  c.NodeReadyGracePeriod,
+		BaseNodeMemory:        baseNodeMemory,
+		MasterNodeWeight:      c.MasterNodeWeightOption(),
+		NodeWeightRules:       weightRules,
+		WeightAggregation:     weightAggregation,
+		CustomMetric:          scaleOn.Name,
+		NodeCoresAnnotation:   c.NodeCoresAnnotation,
+		AdditionalClusters:    c.AdditionalClusterList(),
+		PartialClusterSizes:   c.UnreachableClusters == "partial",
+		MinNodes:              c.MinNodes,
+		MaxNodes:              c.MaxNodes,
+		ValidateTarget:        c.ValidateTarget,
+		ReplicaSetByHash:      c.ReplicaSetByHash,
+		CoordinateHPA:         c.CoordinateHPA,
+		ManagedAnnotations:    c.ManagedAnnotations,
+		DeleteOutdatedPods:    c.DaemonSetDeletePods,
+		PodDeletionInterval:   c.DaemonSetDeleteInterval,
+		TargetCreationTimeout: c.TargetCreationTimeout,
+		Containers:            sortedConfigNames(cfg),
+		DryRun:                c.DryRun,
+		DryRunFormatter:       formatter,
+		RolloutOverride:       rollout,
+		ContainerPath:         containerPath,
+		QuantityPrecision:     precision,
+		ArgoCDAnnotationCheck: c.ArgoCDAnnotationCheck,
+		ArgoCDHelmParameter:   c.ArgoCDHelmParameter,
+		UpdateLastApplied:     c.UpdateLastApplied,
+		ServerSideValidation:  c.ServerSideValidation,
+		LabelPropagation:      labelPropagation,
+		ImageTagPins:          pins,
+		NodeGroupMinNodes:     groupMins,
+		VPARecommendation:     c.VPARecommendation,
+		APIContentType:        c.APIContentType,
+		ImpersonateUser:       c.ImpersonateUser,
+		ImpersonateGroups:     c.ImpersonateGroupList(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	zeroNodes, err := ParseZeroNodesPolicy(c.ZeroNodesPolicy)
+	if err != nil {
+		return nil, err
+	}
+	var external *recommender.HTTPRecommender
+	if c.RecommenderURL != "" {
+		external, err = recommender.NewHTTPRecommender(c.RecommenderURL, c.RecommenderTimeout, c.RecommenderAuthHeader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var shadow ScaleConfig
+	if c.ShadowConfig != "" {
+		if err := json.Unmarshal([]byte(c.ShadowConfig), &shadow); err != nil {
+			return nil, fmt.Errorf("invalid shadow config: %v", err)
+		}
+		if err := shadow.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid shadow config: %v", err)
+		}
+		if err := shadow.validatePools(taintPool != nil); err != nil {
+			return nil, fmt.Errorf("invalid shadow config: %v", err)
+		}
+		if err := shadow.LoadLookupTables(); err != nil {
+			return nil, fmt.Errorf("invalid shadow config: %v", err)
+		}
+	}
+	// Shared, so that temporary credentials are cached once.
+	awsCreds, gcpTokens := auth.NewAwsCredentialProvider(c.CloudWatchRegion), auth.NewGcpCredentialProvider()
+	exps, err := newExporters(c, awsCreds)
+	if err != nil {
+		return nil, err
+	}
+	pubs, err := newPublishers(c, awsCreds, gcpTokens)
+	if err != nil {
+		return nil, err
+	}
+	var window *UpdateWindow
+	if c.UpdateWindow != "" {
+		window, err = ParseUpdateWindow(c.UpdateWindow, c.UpdateWindowTimezone)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var bootstrapHold *BootstrapHold
+	if c.BootstrapStablePeriod > 0 {
+		bootstrapHold = &BootstrapHold{StablePeriod: c.BootstrapStablePeriod}
+	}
+	var memoryToCPURatio *MemoryToCPURatio
+	minRatio, maxRatio, err := c.MemoryToCPURatioQuantities()
+	if err != nil {
+		return nil, err
+	}
+	if minRatio != nil || maxRatio != nil {
+		memoryToCPURatio = &MemoryToCPURatio{Min: minRatio, Max: maxRatio}
+	}
+	var jitter *ApplyJitter
+	if c.ApplyJitter > 0 {
+		jitter = NewApplyJitter(c.ApplyJitter)
+	}
+	var recommendations *grpcserver.Store
+	if c.GRPCAddr != "" {
+		recommendations = grpcserver.NewStore()
+		addr, err := grpcserver.Start(c.GRPCAddr, recommendations)
+		if err != nil {
+			return nil, err
+		}
+		glog.Infof("Serving recommendations over gRPC on %v", addr)
+	}
+	var apiStore *api.Store
+	if c.APIAddr != "" {
+		apiStore = api.NewStore(api.DefaultMaxPlans)
+	}
+	var clusterSizeCache *k8sclient.CachingClusterSizeProvider
+	if c.ClusterSizeCacheTTL > 0 {
+		clusterSizeCache = k8sclient.NewCachingClusterSizeProvider(newK8sClient, c.ClusterSizeCacheTTL, clock.RealClock{})
+	}
+	var planEvents *PlanEventRecorder
+	if c.PodEventPeriodMinutes > 0 {
+		planEvents = &PlanEventRecorder{
+			PodNamespace: c.PodNamespace,
+			PodName:      c.PodName,
+			Period:       time.Minute * time.Duration(c.PodEventPeriodMinutes),
+		}
+	}
+	s := &AutoScaler{
+		namespace:            c.Namespace,
+		target:               c.Target,
+		defaultTarget:        c.Target,
+		containerPath:        containerPath,
+		defaultContainerPath: containerPath,
+		resetReplacedTarget:  c.ResetReplacedTarget,
+		k8sClient:            newK8sClient,
+		defaultConfig:        cfg,
+		shadowConfig:         shadow,
+		recommender:          external,
+		configFile:           c.ConfigFile,
+		managedAnnotations:   c.ManagedAnnotations,
+		zeroNodesPolicy:      zeroNodes,
+		taintPool:            taintPool != nil,
+		validateTarget:       c.ValidateTarget,
+		deltaScaler:          &DeltaScaler{Threshold: c.NodeAllocationThreshold, CoresThreshold: c.CoresChangeThreshold, ScaleOn: scaleOn},
+		ladderSoak:           NewLadderSoak(clock.RealClock{}),
+		minEffectiveNodes:    c.MinEffectiveNodes,
+		clusterSizeCache:     clusterSizeCache,
+		exporters:            exps,
+		publishers:           pubs,
+		auditLogFatal:        c.AuditLogFatal,
+		updateWindow:         window,
+		applyJitter:          jitter,
+		memoryToCPURatio:     memoryToCPURatio,
+		bootstrapHold:        bootstrapHold,
+		scaleOn:              scaleOn,
+		planEvents:           planEvents,
+		schedulingGate:       c.SchedulingGate,
+		recommendations:      recommendations,
+		apiStore:             apiStore,
+		watchHPA:             c.WatchHPAEvents,
+		triggerCh:            make(chan struct{}, 1),
+		forceCh:              make(chan struct{}, 1),
+		nodeCh:               make(chan *k8sclient.ClusterSize, 1),
+		pollPeriod:           time.Second * time.Duration(c.PollPeriodSeconds),
+		clock:                clock.RealClock{},
+		stopCh:               make(chan struct{}),
+		readyCh:              make(chan struct{}, 1),
+	}
+	if c.PollBackoffMaxPeriod > 0 {
+		s.pollBackoff = NewPollBackoff(s.pollPeriod, c.PollBackoffMaxPeriod, c.BackoffResetSuccesses)
+	}
+	if c.HealthAddr != "" {
+		s.readiness = NewReadiness(c.UnreadyAfterFailures)
+		addr, err := startHealthServer(c.HealthAddr, s.readiness)
+		if err != nil {
+			return nil, err
+		}
+		glog.Infof("Serving the health checks on %v", addr)
+	}
+	if apiStore != nil {
+		addr, err := api.Start(c.APIAddr, apiStore, s, c.APITokenFile)
+		if err != nil {
+			return nil, err
+		}
+		glog.Infof("Serving the REST API on %v", addr)
+	}
+	return s, nil
+}
+
+// newExporters returns the metrics exporters which are configured.
+func newExporters(c *options.AutoScalerConfig, awsCreds auth.AwsCredentialSource) ([]exporters.MetricsExporter, error) {
+	exps := []exporters.MetricsExporter{}
+	if c.CloudWatchNamespace != "" {
+		dims, err := cloudwatch.ParseDimensions(c.CloudWatchDimensions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --cloudwatch-dimensions: %v", err)
+		}
+		exp, err := cloudwatch.NewCloudWatchExporter(c.CloudWatchNamespace, c.CloudWatchRegion, dims, awsCreds)
+		if err != nil {
+			return nil, err
+		}
+		// Its requests, and fetching its credentials, can take seconds.
+		exps = append(exps, exporters.NewAsyncExporter(exp))
+	}
+	if c.MetricsAddr != "" {
+		exp, err := prometheus.NewPrometheusExporter(c.MetricsAddr)
+		if err != nil {
+			return nil, err
+		}
+		exps = append(exps, exp)
+	}
+	if c.DogStatsDAddr != "" {
+		exp, err := dogstatsd.NewDogStatsDExporter(c.DogStatsDAddr)
+		if err != nil {
+			return nil, err
+		}
+		exps = append(exps, exp)
+	}
+	if c.AzureResourceID != "" {
+		exp, err := azuremonitor.NewAzureMonitorExporter(c.AzureResourceID, c.AzureRegion)
+		if err != nil {
+			return nil, err
+		}
+		// Like CloudWatch, it fetches a token and posts to a cloud API.
+		exps = append(exps, exporters.NewAsyncExporter(exp))
+	}
+	return exps, nil
 }
 
-// Run periodically counts the number of nodes and cores, estimates the expected
-// number of replicas, compares them to the actual replicas, and
-// updates the target resource with the expected replicas if necessary.
+// newPublishers returns the event publishers which are configured.
+func newPublishers(c *options.AutoScalerConfig, awsCreds auth.AwsCredentialSource, gcpTokens auth.GcpTokenSource) ([]publishers.EventPublisher, error) {
+	pubs := []publishers.EventPublisher{}
+	if c.NATSURL != "" {
+		pub, err := nats.NewNATSPublisher(c.NATSURL)
+		if err != nil {
+			return nil, err
+		}
+		pubs = append(pubs, pub)
+	}
+	if c.AuditLogFile != "" {
+		pub, err := jsonl.NewJSONLinesAuditWriter(c.AuditLogFile, c.AuditLogMaxSizeMB, c.AuditLogMaxAgeDays)
+		if err != nil {
+			return nil, err
+		}
+		pubs = append(pubs, pub)
+	}
+	if c.ParquetOutputPath != "" {
+		pub, err := parquet.NewParquetExporter(c.ParquetOutputPath, c.ParquetRotateInterval, awsCreds, gcpTokens)
+		if err != nil {
+			return nil, err
+		}
+		pubs = append(pubs, pub)
+	}
+	return pubs, nil
+}
+
+// closePublishers closes the publishers which hold resources, e.g. files, or
+// rows which are yet to be written, and the exporters which hold snapshots
+// which are yet to be exported.
+func (s *AutoScaler) closePublishers() {
+	for _, pub := range s.publishers {
+		if c, ok := pub.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				glog.Errorf("Failed to close %s: %v", pub.Name(), err)
+			}
+		}
+	}
+	for _, exp := range s.exporters {
+		if c, ok := exp.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				glog.Errorf("Failed to close %s: %v", exp.Name(), err)
+			}
+		}
+	}
+}
+
+// Run counts the number of nodes and cores whenever they change, and
+// periodically, estimates the expected resources, compares them to the actual
+// ones, and updates the target resource with the expected ones if necessary.
 func (s *AutoScaler) Run() {
-	ticker := s.clock.NewTicker(s.pollPeriod)
+	period := s.pollPeriod
+	ticker := s.clock.NewTicker(period)
 	s.readyCh <- struct{}{} // For testing.
 
+	// In-flight API calls are aborted when we are stopped.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stopCh
+		cancel()
+	}()
+
+	go s.watchNodes(ctx)
+	if s.watchHPA {
+		go s.watchHPAEvents(ctx)
+	}
+
 	// Don't wait for ticker and execute pollAPIServer() for the first time.
-	s.pollAPIServer()
+	s.pollAPIServer(ctx)
 
 	for {
 		select {
 		case <-ticker.C():
-			s.pollAPIServer()
+			s.pollAPIServer(ctx)
+		case <-s.triggerCh:
+			glog.V(2).Infof("Poll triggered")
+			s.pollAPIServer(ctx)
+		case <-s.forceCh:
+			glog.V(0).Infof("Forcing a scale cycle")
+			s.poll(ctx, true)
+		case size := <-s.nodeCh:
+			glog.V(2).Infof("Nodes changed")
+			s.pollWatched(ctx, size)
 		case <-s.stopCh:
+			s.closePublishers()
 			return
 		}
+		if s.pollBackoff != nil && s.pollBackoff.Period() != period {
+			period = s.pollBackoff.Period()
+			ticker.Stop()
+			ticker = s.clock.NewTicker(period)
+		}
+	}
+}
+
+// watchHPAEvents triggers a poll whenever an HPA rescales something, until
+// ctx is cancelled.
+func (s *AutoScaler) watchHPAEvents(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := s.k8sClient.WatchHPAEvents(ctx, s.Trigger); err != nil {
+			glog.Errorf("Error watching HPA events: %v", err)
+			select {
+			case <-s.clock.After(s.pollPeriod):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// watchNodes polls with the new cluster size whenever the nodes change, until
+// ctx is cancelled.  The ticker still polls too, for what the watch doesn't
+// see, e.g. the config file, pods, and the nodes of --additional-clusters.
+func (s *AutoScaler) watchNodes(ctx context.Context) {
+	if err := s.k8sClient.WatchNodes(ctx, s.nodesChanged); err != nil && ctx.Err() == nil {
+		glog.Errorf("Error watching nodes: %v", err)
 	}
 }
 
-func (s *AutoScaler) pollAPIServer() {
+// nodesChanged hands a cluster size from the node watch to the poll loop.
+// Only the latest one matters, so one which is still pending is replaced.
+func (s *AutoScaler) nodesChanged(size *k8sclient.ClusterSize) {
+	select {
+	case <-s.nodeCh:
+	default:
+	}
+	select {
+	case s.nodeCh <- size:
+	default:
+	}
+}
+
+// Stop causes Run to return.  It must be called at most once.
+func (s *AutoScaler) Stop() {
+	close(s.stopCh)
+}
+
+// ForceScale makes the poll loop run a full scale cycle as soon as possible:
+// the cluster size is measured afresh, bypassing --cluster-size-cache-ttl,
+// and the resources are recomputed and applied even if the number of nodes
+// changed by less than --node-allocation-threshold.  Requests which arrive
+// while one is pending are coalesced.
+func (s *AutoScaler) ForceScale() {
+	select {
+	case s.forceCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *AutoScaler) pollAPIServer(ctx context.Context) {
+	s.poll(ctx, false)
+}
+
+// poll runs a scale cycle.  If force is set, it neither uses a cached
+// cluster size nor skips small changes of the cluster.
+func (s *AutoScaler) poll(ctx context.Context, force bool) {
+	s.pollWith(ctx, nil, force)
+}
+
+// pollWatched polls with a cluster size from the node watch.
+func (s *AutoScaler) pollWatched(ctx context.Context, size *k8sclient.ClusterSize) {
+	// A cached size is older, and must not undo this one on the next poll.
+	if s.clusterSizeCache != nil {
+		s.clusterSizeCache.Invalidate()
+	}
+	s.pollWith(ctx, size, false)
+}
+
+// pollWith runs a scale cycle with the watched cluster size, or, if it is
+// nil, with one queried from the apiserver.
+func (s *AutoScaler) pollWith(ctx context.Context, watched *k8sclient.ClusterSize, force bool) {
+	// Set by whatever fails the cycle, for the readiness probe.
+	var cycleErr error
+	defer func() { s.recordCycle(cycleErr) }()
+	if force && s.clusterSizeCache != nil {
+		s.clusterSizeCache.Invalidate()
+	}
+	if err := s.k8sClient.RestoreRolloutStrategy(); err != nil {
+		glog.Errorf("Can't restore the rolling update parameters of %s: %v", s.target, err)
+	}
+	if err := s.k8sClient.DeleteOutdatedPods(); err != nil {
+		glog.Errorf("Can't delete the outdated pods of %s: %v", s.target, err)
+	}
 	// Query the apiserver for the cluster status --- number of nodes and cores
-	clusterSize, err := s.k8sClient.GetClusterSize()
-	if err != nil {
-		glog.Errorf("Error getting cluster size: %v", err)
+	clusterSize := watched
+	if clusterSize != nil {
+		s.adjustClusterSize(clusterSize)
+	} else {
+		var err error
+		clusterSize, err = s.getClusterSize(ctx)
+		if err != nil {
+			glog.Errorf("Error getting cluster size: %v", err)
+			cycleErr = err
+			return
+		}
+	}
+	clusterSize, ok := s.handleZeroNodes(clusterSize)
+	if !ok {
 		return
 	}
+	defer s.exportMetrics(clusterSize)
+	defer s.storeState(clusterSize)
+	defer s.recordPlanEvent(clusterSize)
+	defer s.releaseGatedPods(ctx)
 	glog.V(4).Infof("Nodes %5d", clusterSize.Nodes)
 	glog.V(4).Infof("Cores %5d", clusterSize.Cores)
+	glog.V(4).Infof("Pods  %5d", clusterSize.MatchingPods)
+	glog.V(4).Infof("Pending %3d", clusterSize.PendingPods)
+	glog.V(4).Infof("CPU   %4d%%", clusterSize.CPUUtilization)
+	if len(clusterSize.NodeGroups) > 0 {
+		glog.V(4).Infof("Node groups %v", clusterSize.NodeGroups)
+	}
+	if s.taintPool {
+		glog.V(4).Infof("Main pool nodes %d, tainted pool nodes %d", clusterSize.MainPoolNodes, clusterSize.TaintedPoolNodes)
+	}
 
-	fileBytes, err := s.readConfigFileIfChanged()
+	configChanged, err := s.refreshConfig()
 	if err != nil {
-		glog.Errorf("Failed to read config file %q: %v", s.configFile, err)
+		glog.Errorf("%v", err)
+		cycleErr = err
 		return
 	}
-	if s.currentConfig == nil || len(fileBytes) > 0 {
-		cfg := s.defaultConfig.DeepCopy()
-		if len(fileBytes) > 0 {
-			if err := json.Unmarshal(fileBytes, &cfg); err != nil {
-				glog.Errorf("Failed to unmarshal config file %q: %v", s.configFile, err)
-				return
-			}
+	if configChanged && s.applyJitter != nil {
+		s.applyJitter.ConfigChanged(s.clock.Now())
+	}
+	// A rung which is held back must be evaluated again once it has soaked,
+	// even if the cluster doesn't change meanwhile, and so must an update
+	// which was delayed.
+	soaking := s.ladderSoak != nil && s.ladderSoak.Pending()
+	jittering := s.applyJitter != nil && s.applyJitter.Pending()
+	// Including the poll which ends the hold.
+	bootstrapping := s.bootstrapHold != nil && !s.bootstrapHold.Done()
+	if !force && !configChanged && !soaking && !jittering && !bootstrapping && s.deltaScaler != nil {
+		change := NewClusterSizeChange(s.lastSize, clusterSize)
+		if !s.deltaScaler.ShouldScale(change) {
+			glog.V(4).Infof("Cluster changed by %d nodes and %d cores, below threshold of %d nodes", change.Delta, change.CoresDelta, s.deltaScaler.Threshold)
+			return
 		}
-		s.currentConfig = cfg
-		glog.V(0).Infof("setting config = %s", s.currentConfig)
 	}
 
-	newReqs := map[string]apiv1.ResourceRequirements{}
-	for ctr, ctrcfg := range s.currentConfig {
-		newReqs[ctr] = apiv1.ResourceRequirements{
-			Requests: map[apiv1.ResourceName]resource.Quantity{},
-			Limits:   map[apiv1.ResourceName]resource.Quantity{},
-		}
-		for res, cfg := range ctrcfg.Requests {
-			want := calculate(cfg, clusterSize)
-			r := resource.NewQuantity(0, guessFormat(res))
-			r.SetMilli(want)
-			newReqs[ctr].Requests[apiv1.ResourceName(res)] = *r
-			glog.V(4).Infof("Calculated %s requests[%q] = %v", ctr, res, r)
-		}
-		for res, cfg := range ctrcfg.Limits {
-			want := calculate(cfg, clusterSize)
-			r := resource.NewQuantity(0, guessFormat(res))
-			r.SetMilli(want)
-			newReqs[ctr].Limits[apiv1.ResourceName(res)] = *r
-			glog.V(4).Infof("Calculated %s limits[%q] = %v", ctr, res, r)
-		}
-	}
-	if reflect.DeepEqual(s.lastReqs, newReqs) {
+	recSize := clusterSize
+	if bootstrapping && s.bootstrapHold.Holds(clusterSize.Nodes, s.clock.Now()) {
+		glog.V(2).Infof("Holding at the floor until the number of nodes, now %d, has been stable for %v",
+			clusterSize.Nodes, s.bootstrapHold.StablePeriod)
+		recSize = &k8sclient.ClusterSize{}
+	}
+	newReqs := s.recommend(recSize)
+	if err := s.resolveRelative(s.currentConfig, newReqs); err != nil {
+		glog.Errorf("%v", err)
+		cycleErr = err
+		return
+	}
+	if s.recommender != nil {
+		var ok bool
+		if newReqs, ok = s.recommendExternally(ctx, recSize); !ok {
+			cycleErr = fmt.Errorf("the external recommender has never succeeded")
+			return
+		}
+	}
+	s.evaluateShadow(recSize, newReqs)
+	s.storeRecommendation(clusterSize, newReqs)
+	s.storePlan(clusterSize, newReqs)
+	env, err := s.currentConfig.containerEnv(recSize)
+	if err != nil {
+		glog.Errorf("%v", err)
+		cycleErr = err
+		return
+	}
+	if requirementsEqual(s.lastReqs, newReqs) && envEqual(s.lastEnv, env) {
+		s.lastSize = clusterSize
+		if s.applyJitter != nil {
+			s.applyJitter.Applied()
+		}
+		return
+	}
+
+	if s.memoryToCPURatio != nil {
+		if err := s.memoryToCPURatio.Check(newReqs); err != nil {
+			// Most likely a bug in the config, so don't apply anything.
+			cycleErr = fmt.Errorf("unbalanced recommendation: %v", err)
+			s.recordUpdateFailure(s.target, cycleErr)
+			return
+		}
+	}
+
+	if s.applyJitter != nil && s.applyJitter.Delays(s.clock.Now()) {
+		glog.V(2).Infof("Delaying the update after a config change, for nodes: %d, cores: %d",
+			clusterSize.Nodes, clusterSize.Cores)
 		return
 	}
 
+	if s.updateWindow != nil && !s.updateWindow.Contains(s.clock.Now()) {
+		// lastReqs is unchanged, so the latest value is recomputed and
+		// applied once the window opens.
+		glog.V(0).Infof("Outside of the update window, deferring update for nodes: %d, cores: %d",
+			clusterSize.Nodes, clusterSize.Cores)
+		return
+	}
+
+	if s.resetReplacedTarget && s.originalReqs == nil {
+		s.saveOriginalResources()
+	}
 	glog.V(0).Infof("Updating resource for nodes: %d, cores: %d",
 		clusterSize.Nodes, clusterSize.Cores)
 	logRequirements(newReqs)
+	previous := s.previousResources(newReqs)
+	s.k8sClient.SetContainerEnv(env)
 	// Update resource target with new resources.
-	if err = s.k8sClient.UpdateResources(newReqs); err != nil {
-		glog.Errorf("Update failure: %s", err)
+	err = s.k8sClient.UpdateResources(newReqs)
+	if err == k8sclient.ErrTargetGone {
+		// Nothing was applied, so the next poll tries again, e.g. once the
+		// target is recreated.
+		glog.V(0).Infof("Not updating %s in namespace %s, which is gone", s.target, s.namespace)
+		return
+	}
+	if err != nil {
+		cycleErr = err
+		s.recordUpdateFailure(s.target, err)
 	} else {
+		glog.V(0).Infof("Updated %s in namespace %s", s.target, s.namespace)
+		if len(s.exporters) > 0 {
+			s.requestChanges = append(s.requestChanges, requestChanges(s.lastReqs, newReqs)...)
+		}
 		s.lastReqs = newReqs
+		s.lastEnv = env
+		s.lastSize = clusterSize
+		if s.applyJitter != nil {
+			s.applyJitter.Applied()
+		}
+		s.publishScaleEvent(clusterSize, newReqs, previous)
+	}
+}
+
+// recordCycle records the outcome of a scale cycle, which failed if err isn't
+// nil.
+func (s *AutoScaler) recordCycle(err error) {
+	if s.readiness != nil {
+		s.readiness.Record(err)
+	}
+	if s.pollBackoff != nil {
+		s.pollBackoff.Record(err)
+	}
+}
+
+// recordUpdateFailure logs and counts a failed update of target.  The next
+// poll tries again.
+func (s *AutoScaler) recordUpdateFailure(target string, err error) {
+	glog.Errorf("Failed to update %s in namespace %s: %v", target, s.namespace, err)
+	kind, name := splitTarget(target)
+	if s.updateFailures == nil {
+		s.updateFailures = map[exporters.Target]int{}
+	}
+	s.updateFailures[exporters.Target{Kind: kind, Name: name}]++
+}
+
+// exportMetrics publishes the cluster size and the last applied requests to
+// all of the configured exporters.
+func (s *AutoScaler) exportMetrics(clusterSize *k8sclient.ClusterSize) {
+	if len(s.exporters) == 0 {
+		return
+	}
+	kind, name := splitTarget(s.target)
+	m := &exporters.Metrics{
+		Timestamp:      s.clock.Now(),
+		TargetKind:     kind,
+		TargetName:     name,
+		Namespace:      s.namespace,
+		ClusterNodes:   clusterSize.Nodes,
+		ClusterCores:   clusterSize.Cores,
+		Requests:       map[string]apiv1.ResourceList{},
+		UpdateFailures: map[exporters.Target]int{},
+	}
+	for ctr, reqs := range s.lastReqs {
+		// A container which left the config is no longer managed, so its
+		// series are dropped even before an update without it is applied.
+		if _, found := s.currentConfig[ctr]; !found {
+			continue
+		}
+		// Copied, as some exporters read m in the background.
+		m.Requests[ctr] = reqs.Requests.DeepCopy()
+	}
+	if s.lastShadowReqs != nil {
+		m.ShadowRequests = map[string]apiv1.ResourceList{}
+		for ctr, reqs := range s.lastShadowReqs {
+			m.ShadowRequests[ctr] = reqs.Requests.DeepCopy()
+		}
+	}
+	for target, n := range s.updateFailures {
+		m.UpdateFailures[target] = n
+	}
+	m.PolicyParseErrors = s.policies.ParseErrors()
+	for _, pub := range s.publishers {
+		if d, ok := pub.(publishers.DroppingPublisher); ok {
+			if m.DroppedEvents == nil {
+				m.DroppedEvents = map[string]int{}
+			}
+			m.DroppedEvents[pub.Name()] = d.Dropped()
+		}
+	}
+	for _, exp := range s.exporters {
+		if d, ok := exp.(exporters.DroppingExporter); ok {
+			if m.DroppedSnapshots == nil {
+				m.DroppedSnapshots = map[string]int{}
+			}
+			m.DroppedSnapshots[exp.Name()] = d.Dropped()
+		}
+	}
+	m.RequestChanges, s.requestChanges = s.requestChanges, nil
+	if s.clusterSizeCache != nil {
+		ratio := s.clusterSizeCache.CacheHitRatio()
+		m.ClusterSizeCacheHitRatio = &ratio
+	}
+	for _, exp := range s.exporters {
+		if err := exp.Export(m); err != nil {
+			glog.Errorf("Failed to export metrics to %s: %v", exp.Name(), err)
+		}
 	}
 }
 
+// requestChanges returns the changes from old to new requests, by container
+// and resource.  Requests which are new or were zero have no relative change
+// and are left out.
+func requestChanges(old, new map[string]apiv1.ResourceRequirements) []exporters.RequestChange {
+	changes := []exporters.RequestChange{}
+	ctrs := map[string]bool{}
+	for ctr := range new {
+		ctrs[ctr] = true
+	}
+	for _, ctr := range sortedNames(ctrs) {
+		names := map[string]bool{}
+		for res := range new[ctr].Requests {
+			names[string(res)] = true
+		}
+		for _, name := range sortedNames(names) {
+			res := apiv1.ResourceName(name)
+			was, found := old[ctr].Requests[res]
+			if !found || was.IsZero() {
+				continue
+			}
+			now := new[ctr].Requests[res]
+			if now.Cmp(was) == 0 {
+				continue
+			}
+			changes = append(changes, exporters.RequestChange{
+				Container: ctr,
+				Resource:  res,
+				Old:       float64(was.MilliValue()) / 1000,
+				New:       float64(now.MilliValue()) / 1000,
+			})
+		}
+	}
+	return changes
+}
+
+// previousResources returns the resources of the containers in reqs before
+// they are updated, for the publishers: those we last applied, or else those
+// of the target.  Nil if there are no publishers, or if they can't be read.
+func (s *AutoScaler) previousResources(reqs map[string]apiv1.ResourceRequirements) map[string]apiv1.ResourceRequirements {
+	if len(s.publishers) == 0 {
+		return nil
+	}
+	if s.lastReqs != nil {
+		return s.lastReqs
+	}
+	current, err := s.k8sClient.GetCurrentResources()
+	if err != nil {
+		glog.Errorf("Can't read the resources of %s before updating them: %v", s.target, err)
+		return nil
+	}
+	previous := map[string]apiv1.ResourceRequirements{}
+	for ctr := range reqs {
+		if res, found := current[ctr]; found {
+			previous[ctr] = res
+		}
+	}
+	return previous
+}
+
+// publishScaleEvent announces the applied requirements to all of the
+// configured publishers.
+func (s *AutoScaler) publishScaleEvent(clusterSize *k8sclient.ClusterSize, reqs, previous map[string]apiv1.ResourceRequirements) {
+	if len(s.publishers) == 0 {
+		return
+	}
+	kind, name := splitTarget(s.target)
+	ev := &publishers.ScaleEvent{
+		Timestamp: s.clock.Now(),
+		Plan: publishers.ScalePlan{
+			Namespace:        s.namespace,
+			TargetKind:       kind,
+			TargetName:       name,
+			Nodes:            clusterSize.Nodes,
+			Cores:            clusterSize.Cores,
+			MatchingPods:     clusterSize.MatchingPods,
+			PendingPods:      clusterSize.PendingPods,
+			AverageNodeCores: clusterSize.AverageNodeCores,
+			Resources:        reqs,
+		},
+		Previous:      previous,
+		ConfigVersion: s.currentConfig.Version(),
+	}
+	for _, pub := range s.publishers {
+		err := pub.Publish(ev)
+		if err == nil {
+			continue
+		}
+		if _, ok := pub.(*jsonl.JSONLinesAuditWriter); ok {
+			if s.auditLogFatal {
+				glog.Fatalf("AUDIT LOG FAILURE: the update of %s was applied but not recorded, exiting: %v", s.target, err)
+			}
+			glog.Errorf("AUDIT LOG FAILURE: the update of %s was applied but not recorded: %v", s.target, err)
+			continue
+		}
+		glog.Errorf("Failed to publish scale event to %s: %v", pub.Name(), err)
+	}
+}
+
+// splitTarget splits e.g. "deployment/foo" into its kind and name.
+func splitTarget(target string) (kind, name string) {
+	if i := strings.Index(target, "/"); i >= 0 {
+		return target[:i], target[i+1:]
+	}
+	return target, ""
+}
+
+// storeRecommendation makes a new recommendation available over gRPC, if
+// configured.  Unchanged recommendations are not stored again, so that
+// watchers are only woken up by changes.
+func (s *AutoScaler) storeRecommendation(clusterSize *k8sclient.ClusterSize, reqs map[string]apiv1.ResourceRequirements) {
+	if s.recommendations == nil {
+		return
+	}
+	if cur, _ := s.recommendations.Get(); cur != nil && cur.ClusterSize.Equal(clusterSize) && requirementsEqual(cur.Resources, reqs) {
+		return
+	}
+	s.recommendations.Set(&grpcserver.Recommendation{
+		Timestamp:   s.clock.Now(),
+		ClusterSize: *clusterSize,
+		Resources:   reqs,
+	})
+}
+
+// recordPlanEvent summarizes the cluster size and the last applied requests
+// in an event on our own pod, if configured.
+func (s *AutoScaler) recordPlanEvent(clusterSize *k8sclient.ClusterSize) {
+	if s.planEvents == nil {
+		return
+	}
+	s.planEvents.Record(s.k8sClient, s.clock.Now(), clusterSize, s.lastReqs)
+}
+
+// getClusterSize queries the cluster size, and applies our adjustments to it.
+func (s *AutoScaler) getClusterSize(ctx context.Context) (*k8sclient.ClusterSize, error) {
+	var provider k8sclient.ClusterSizeProvider = s.k8sClient
+	if s.clusterSizeCache != nil {
+		provider = s.clusterSizeCache
+	}
+	clusterSize, err := provider.GetClusterSizeWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.adjustClusterSize(clusterSize)
+	return clusterSize, nil
+}
+
+// adjustClusterSize applies our adjustments to a cluster size.
+func (s *AutoScaler) adjustClusterSize(clusterSize *k8sclient.ClusterSize) {
+	clusterSize.AverageNodeCores = k8sclient.AverageNodeCores(clusterSize.Cores, clusterSize.Nodes, s.minEffectiveNodes)
+}
+
+// refreshConfig loads the config, if it has never been loaded, if the config
+// file has changed, or if a policy was set through the REST API.  It returns
+// whether the config changed.
+func (s *AutoScaler) refreshConfig() (bool, error) {
+	fileBytes, err := s.readConfigIfChanged()
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %v", s.configName(), err)
+	}
+	policy := s.peekPolicy()
+	if s.currentConfig != nil && len(fileBytes) == 0 && policy == nil {
+		reloaded, err := s.currentConfig.reloadChangedLookupTables()
+		if reloaded {
+			s.storeConfig()
+		}
+		return reloaded, err
+	}
+	cfg := s.defaultConfig.DeepCopy()
+	target := s.defaultTarget
+	path := s.defaultContainerPath
+	source := s.configName()
+	configSource := "default"
+	if policy != nil {
+		// The policy is newer than the config file.
+		cfg = policy.config.DeepCopy()
+		source = "API policy"
+		configSource = "policy"
+	} else if len(fileBytes) > 0 {
+		configSource = "file"
+		s.policies.Stage(fileBytes)
+		header, err := parseConfigFile(s.policies.Pending(), &cfg)
+		if err != nil {
+			return false, s.rejectConfigFile(fmt.Errorf("failed to unmarshal %s: %v", source, err))
+		}
+		if err := cfg.validatePools(s.taintPool); err != nil {
+			return false, s.rejectConfigFile(fmt.Errorf("invalid %s: %v", source, err))
+		}
+		if header.target != "" {
+			target = header.target
+		}
+		if header.containerPath != "" {
+			if path, err = k8sclient.ParseContainerPath(header.containerPath); err != nil {
+				return false, s.rejectConfigFile(fmt.Errorf("invalid %s: %v", source, err))
+			}
+		}
+	}
+	if err := cfg.LoadLookupTables(); err != nil {
+		// Try again on the next poll.
+		s.retryConfig()
+		return false, fmt.Errorf("not loading the config from %s: %v", source, err)
+	}
+	if target != s.target || path.String() != s.containerPath.String() {
+		if err := s.switchTarget(target, path); err != nil {
+			// Try again on the next poll.
+			s.retryConfig()
+			return false, fmt.Errorf("not switching to target %s with containers at %s from %s: %v", target, path, source, err)
+		}
+	}
+	if s.validateTarget {
+		// The config file or policy may name containers which the
+		// --default-config doesn't.
+		if err := s.k8sClient.ValidateContainers(sortedConfigNames(cfg)); err != nil {
+			// Try again on the next poll, e.g. once the target has them.
+			s.retryConfig()
+			return false, fmt.Errorf("not loading the config from %s: %v", source, err)
+		}
+	}
+	if policy != nil {
+		s.clearPolicy(policy)
+	}
+	s.policies.Promote(cfg)
+	s.currentConfig = s.policies.Active()
+	s.configSource = configSource
+	glog.V(0).Infof("setting config = %s", s.currentConfig)
+	s.storeConfig()
+	return true, nil
+}
+
+// rejectConfigFile drops the config file, which failed to parse with err.
+// It returns nil, after logging err, if the last valid config stays in
+// effect, and err if there is none yet.  The file isn't read again until it
+// changes.
+func (s *AutoScaler) rejectConfigFile(err error) error {
+	if !s.policies.Reject() {
+		return err
+	}
+	glog.Errorf("%v; keeping the last valid config", err)
+	return nil
+}
+
+// configFileHeader holds the settings of the config file besides the
+// containers.  Empty settings are not set.
+type configFileHeader struct {
+	target        string
+	containerPath string
+}
+
+// parseConfigFile decodes the config file into cfg.  Besides the containers,
+// the file may name the target, as a string under the "target" key, and
+// where the target's containers are, as a string under the "containerPath"
+// key, e.g. {"target": "deployment/foo", "foo": {...}}.  These can not clash
+// with a container, whose config is always an object.
+func parseConfigFile(data []byte, cfg *ScaleConfig) (configFileHeader, error) {
+	header := configFileHeader{}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return header, err
+	}
+	for _, setting := range []struct {
+		key   string
+		value *string
+	}{
+		{"target", &header.target},
+		{"containerPath", &header.containerPath},
+	} {
+		if raw, found := fields[setting.key]; found {
+			if err := json.Unmarshal(raw, setting.value); err == nil {
+				delete(fields, setting.key)
+			}
+		}
+	}
+	header.target = strings.ToLower(header.target)
+	if _, err := k8sclient.ParseContainerPath(header.containerPath); err != nil {
+		return header, err
+	}
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return header, err
+	}
+	if err := json.Unmarshal(rest, cfg); err != nil {
+		return header, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return header, err
+	}
+	return header, nil
+}
+
+// switchTarget starts managing another target, or other containers of the
+// same one.  The new target is validated first, and all state about the old
+// one is dropped.
+func (s *AutoScaler) switchTarget(target string, path k8sclient.ContainerPath) error {
+	old, oldPath, original := s.target, s.containerPath, s.originalReqs
+	if err := s.k8sClient.SetTarget(target, path); err != nil {
+		return err
+	}
+	glog.V(0).Infof("Target changed from %s (containers at %s) to %s (containers at %s)", old, oldPath, target, path)
+	s.target = target
+	s.containerPath = path
+	s.lastReqs = nil
+	s.lastEnv = nil
+	s.lastSize = nil
+	s.originalReqs = nil
+	// The original resources are reset without the env of the patches.
+	s.k8sClient.SetContainerEnv(nil)
+	if !s.resetReplacedTarget || original == nil {
+		return nil
+	}
+	// The client now points at the new target, so switch back briefly.
+	if err := s.k8sClient.SetTarget(old, oldPath); err != nil {
+		glog.Errorf("Failed to reset the resources of %s: %v", old, err)
+	} else {
+		glog.V(0).Infof("Resetting the resources of %s", old)
+		logRequirements(original)
+		if err := s.k8sClient.UpdateResources(original); err == k8sclient.ErrTargetGone {
+			glog.V(0).Infof("Not resetting the resources of %s, which is gone", old)
+		} else if err != nil {
+			s.recordUpdateFailure(old, err)
+		} else {
+			glog.V(0).Infof("Reset the resources of %s in namespace %s", old, s.namespace)
+		}
+	}
+	return s.k8sClient.SetTarget(target, path)
+}
+
+// saveOriginalResources remembers the resources of the configured containers
+// before the target is first updated, so that they can be reset later.
+func (s *AutoScaler) saveOriginalResources() {
+	current, err := s.k8sClient.GetCurrentResources()
+	if err != nil {
+		glog.Errorf("Can't save the original resources of %s: %v", s.target, err)
+		return
+	}
+	s.originalReqs = map[string]apiv1.ResourceRequirements{}
+	for ctr := range s.currentConfig {
+		if reqs, found := current[ctr]; found {
+			s.originalReqs[ctr] = reqs
+		}
+	}
+}
+
+// recommend computes the requirements of every configured container.
+func (s *AutoScaler) recommend(clusterSize *k8sclient.ClusterSize) map[string]apiv1.ResourceRequirements {
+	reqs := recommendFor(s.currentConfig, clusterSize, MultiAxisEvaluator{Soak: s.ladderSoak, ScaleOn: s.scaleOn})
+	if s.currentConfig.hasBudget() {
+		NewResourceBudget(clusterSize).Cap(s.currentConfig, reqs)
+	}
+	return reqs
+}
+
+// recommendFor computes the requirements of every container in cfg.
+func recommendFor(cfg ScaleConfig, clusterSize *k8sclient.ClusterSize, eval MultiAxisEvaluator) map[string]apiv1.ResourceRequirements {
+	newReqs := map[string]apiv1.ResourceRequirements{}
+	for ctr, ctrcfg := range cfg {
+		newReqs[ctr] = eval.Evaluate(ctr, ctrcfg, clusterSize)
+	}
+	return newReqs
+}
+
+// evaluateShadow computes the requirements from the shadow config, if any,
+// for the cluster size which the active config was evaluated for, i.e. the
+// floor while the bootstrap hold lasts, and logs how they differ from active,
+// the requirements which the active config recommended.  The differences are
+// logged prominently only when the shadow result changes.
+func (s *AutoScaler) evaluateShadow(clusterSize *k8sclient.ClusterSize, active map[string]apiv1.ResourceRequirements) {
+	if s.shadowConfig == nil {
+		return
+	}
+	// Rungs of the shadow config are not held back, as its ladders would
+	// share the soak of the active config's.
+	shadow := recommendFor(s.shadowConfig, clusterSize, MultiAxisEvaluator{ScaleOn: s.scaleOn})
+	if err := s.resolveRelative(s.shadowConfig, shadow); err != nil {
+		glog.Errorf("Shadow config: %v", err)
+		return
+	}
+	level := glog.Level(4)
+	if !requirementsEqual(shadow, s.lastShadowReqs) {
+		level = 0
+	}
+	s.lastShadowReqs = shadow
+	if s.memoryToCPURatio != nil {
+		if err := s.memoryToCPURatio.Check(shadow); err != nil {
+			glog.V(level).Infof("Shadow config would not be applied, unbalanced recommendation: %v", err)
+		}
+	}
+
+	ctrs := map[string]bool{}
+	for ctr := range active {
+		ctrs[ctr] = true
+	}
+	for ctr := range shadow {
+		ctrs[ctr] = true
+	}
+	for _, ctr := range sortedNames(ctrs) {
+		logShadowDelta(level, ctr, "requests", active[ctr].Requests, shadow[ctr].Requests)
+		logShadowDelta(level, ctr, "limits", active[ctr].Limits, shadow[ctr].Limits)
+	}
+}
+
+func logShadowDelta(level glog.Level, ctr, kind string, active, shadow apiv1.ResourceList) {
+	names := map[string]bool{}
+	for res := range active {
+		names[string(res)] = true
+	}
+	for res := range shadow {
+		names[string(res)] = true
+	}
+	for _, res := range sortedNames(names) {
+		a, haveActive := active[apiv1.ResourceName(res)]
+		sh, haveShadow := shadow[apiv1.ResourceName(res)]
+		switch {
+		case !haveShadow:
+			glog.V(level).Infof("Shadow %s %s[%q]: active %s, shadow unset", ctr, kind, res, a.String())
+		case !haveActive:
+			glog.V(level).Infof("Shadow %s %s[%q]: active unset, shadow %s", ctr, kind, res, sh.String())
+		case a.MilliValue() == 0:
+			glog.V(level).Infof("Shadow %s %s[%q]: active %s, shadow %s", ctr, kind, res, a.String(), sh.String())
+		default:
+			pct := float64(sh.MilliValue()-a.MilliValue()) * 100 / float64(a.MilliValue())
+			glog.V(level).Infof("Shadow %s %s[%q]: active %s, shadow %s (%+.1f%%)", ctr, kind, res, a.String(), sh.String(), pct)
+		}
+	}
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := []string{}
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requirementsEqual compares two sets of per-container requirements by value,
+// so that e.g. 1Gi and 1024Mi are considered equal.
+func requirementsEqual(a, b map[string]apiv1.ResourceRequirements) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ctr, ra := range a {
+		rb, found := b[ctr]
+		if !found {
+			return false
+		}
+		if !resourceListsEqual(ra.Requests, rb.Requests) || !resourceListsEqual(ra.Limits, rb.Limits) {
+			return false
+		}
+	}
+	return true
+}
+
+func resourceListsEqual(a, b apiv1.ResourceList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for res, qa := range a {
+		qb, found := b[res]
+		if !found || qa.Cmp(qb) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func logRequirements(reqs map[string]apiv1.ResourceRequirements) {
 	for ctr, req := range reqs {
 		for res, r := range req.Requests {
@@ -167,6 +1354,53 @@ func logRequirements(reqs map[string]apiv1.ResourceRequirements) {
 	}
 }
 
+// configName describes where the config is read from, for messages.
+func (s *AutoScaler) configName() string {
+	if s.managedAnnotations {
+		name := ""
+		if s.lastManaged != nil {
+			name = s.lastManaged.ConfigMap
+		}
+		return fmt.Sprintf("ConfigMap %q", name)
+	}
+	return fmt.Sprintf("config file %q", s.configFile)
+}
+
+// readConfigIfChanged returns the config file, or the ConfigMap named by the
+// target's annotations, if it changed since it was last read, and nil
+// otherwise.
+func (s *AutoScaler) readConfigIfChanged() ([]byte, error) {
+	if s.managedAnnotations {
+		return s.readManagedConfigIfChanged()
+	}
+	return s.readConfigFileIfChanged()
+}
+
+// retryConfig makes the next readConfigIfChanged read the config again,
+// even if it didn't change.
+func (s *AutoScaler) retryConfig() {
+	s.lastFileInfo = nil
+	s.lastManaged = nil
+}
+
+func (s *AutoScaler) readManagedConfigIfChanged() ([]byte, error) {
+	mc, err := s.k8sClient.ReadManagedConfig()
+	if err != nil {
+		return nil, err
+	}
+	if s.defaultTarget == "" {
+		// The client found the target by its annotations.
+		s.target = mc.Target
+		s.defaultTarget = mc.Target
+	}
+	last := s.lastManaged
+	s.lastManaged = mc
+	if last != nil && last.Target == mc.Target && last.ConfigMap == mc.ConfigMap && last.ResourceVersion == mc.ResourceVersion {
+		return nil, nil
+	}
+	return mc.Data, nil
+}
+
 func (s *AutoScaler) readConfigFileIfChanged() ([]byte, error) {
 	if s.configFile == "" {
 		return nil, nil
@@ -188,6 +1422,13 @@ func (s *AutoScaler) readConfigFileIfChanged() ([]byte, error) {
 }
 
 func calculate(cfg ResourceScaleConfig, cluster *k8sclient.ClusterSize) int64 {
+	return calculateSoaked(cfg, cluster, k8sclient.ScaleMetric{}, nil, "")
+}
+
+// calculateSoaked is like calculate, but the metric axes count on, and the
+// ladder's higher rungs may be held back by soak, see LadderSoak.  key
+// identifies the resource.
+func calculateSoaked(cfg ResourceScaleConfig, cluster *k8sclient.ClusterSize, on k8sclient.ScaleMetric, soak *LadderSoak, key string) int64 {
 	var base int64
 	if cfg.Base != nil {
 		base = asInt64(cfg.Base)
@@ -208,19 +1449,79 @@ func calculate(cfg ResourceScaleConfig, cluster *k8sclient.ClusterSize) int64 {
 	if cfg.NodesPerStep != nil {
 		npi = *cfg.NodesPerStep
 	}
-	wantByCores := base + (step * int64(increments(cluster.Cores, cpi)))
-	if max < 0 && wantByCores > max {
+	nodes := cluster.Nodes
+	if cfg.BaselineNodes != nil {
+		nodes -= *cfg.BaselineNodes
+		if nodes < 0 {
+			nodes = 0
+		}
+	}
+	var ppi int
+	if cfg.PodsPerStep != nil {
+		ppi = *cfg.PodsPerStep
+	}
+	var api int
+	if cfg.AverageNodeCoresPerStep != nil {
+		api = *cfg.AverageNodeCoresPerStep
+	}
+	var mpi int
+	if cfg.MetricPerStep != nil {
+		mpi = *cfg.MetricPerStep
+	}
+	var gpi int
+	if cfg.MemoryPerStep != nil {
+		gpi = int(*cfg.MemoryPerStep)
+	}
+	wantByCores := base + (step * int64(increments(cluster.Cores, cpi, cfg.Rounding)))
+	if max > 0 && wantByCores > max {
 		wantByCores = max
 	}
-	wantByNodes := base + (step * int64(increments(cluster.Nodes, npi)))
+	wantByNodes := base + (step * int64(increments(nodes, npi, cfg.Rounding)))
 	if max > 0 && wantByNodes > max {
 		wantByNodes = max
 	}
+	// If no pods match, this is just the base.
+	wantByPods := base + (step * int64(increments(cluster.MatchingPods, ppi, cfg.Rounding)))
+	if max > 0 && wantByPods > max {
+		wantByPods = max
+	}
+	wantByAverage := base + (step * int64(increments(cluster.AverageNodeCores, api, cfg.Rounding)))
+	if max > 0 && wantByAverage > max {
+		wantByAverage = max
+	}
+	wantByMetric := base + (step * int64(increments(cluster.Count(on), mpi, cfg.Rounding)))
+	if max > 0 && wantByMetric > max {
+		wantByMetric = max
+	}
+	wantByMemory := base + (step * int64(increments(memoryGiB(cluster), gpi, cfg.Rounding)))
+	if max > 0 && wantByMemory > max {
+		wantByMemory = max
+	}
 	want := wantByCores
 	if wantByNodes > want {
 		want = wantByNodes
 	}
-	return want
+	if wantByPods > want {
+		want = wantByPods
+	}
+	if wantByAverage > want {
+		want = wantByAverage
+	}
+	if wantByMetric > want {
+		want = wantByMetric
+	}
+	if wantByMemory > want {
+		want = wantByMemory
+	}
+	if cfg.Ladder != nil {
+		if byLadder, ok := cfg.Ladder.soakedValue(cluster, on, soak, key); ok && byLadder > want {
+			want = byLadder
+			if max > 0 && want > max {
+				want = max
+			}
+		}
+	}
+	return cfg.CPUUnits.round(want, cfg.Rounding)
 }
 
 func asInt64(q *resource.Quantity) int64 {
@@ -230,19 +1531,49 @@ func asInt64(q *resource.Quantity) int64 {
 	return q.MilliValue()
 }
 
-func increments(count int, per int) int {
+// increments returns the number of steps for count, at per counts each.
+// Partial steps are rounded in the given direction, up by default.
+func increments(count int, per int, rounding RoundingDirection) int {
 	if per == 0 {
 		return 0
 	}
 	if per == 1 {
 		return count
 	}
+	switch rounding {
+	case RoundDown:
+		return count / per
+	case RoundNearest:
+		// Halves are rounded up.
+		return (2*count + per) / (2 * per)
+	}
 	return (count + (per - 1)) / per
 }
 
+// RoundingDirection says how partial steps are rounded.
+type RoundingDirection string
+
+const (
+	// RoundUp counts any partial step as a whole one.  This is the default,
+	// so that a resource is never under-provisioned.
+	RoundUp RoundingDirection = "up"
+	// RoundDown ignores partial steps.
+	RoundDown RoundingDirection = "down"
+	// RoundNearest counts partial steps of at least half a step.
+	RoundNearest RoundingDirection = "nearest"
+)
+
+func (r RoundingDirection) validate() error {
+	switch r {
+	case "", RoundUp, RoundDown, RoundNearest:
+		return nil
+	}
+	return fmt.Errorf("unknown rounding %q, must be %q, %q or %q", string(r), RoundUp, RoundDown, RoundNearest)
+}
+
 func guessFormat(res string) resource.Format {
 	switch res {
-	case string(apiv1.ResourceMemory), string(apiv1.ResourceStorage):
+	case string(apiv1.ResourceMemory), string(apiv1.ResourceStorage), string(apiv1.ResourceEphemeralStorage):
 		return resource.DecimalSI
 	}
 	return resource.BinarySI
@@ -255,11 +1586,22 @@ type ScaleConfig map[string]ContainerScaleConfig
 type ContainerScaleConfig struct {
 	Requests map[string]ResourceScaleConfig
 	Limits   map[string]ResourceScaleConfig
+	// If set, the cpu and memory requests are looked up in a table instead,
+	// see LookupTableConfig.
+	LookupTable *LookupTableConfig
+	// If set, the fraction of the cluster's cores and memory at which the
+	// cpu and memory requests are capped, see ResourceBudget.
+	BudgetFraction *float64
+	// If set, other fields of the container which are set along with its
+	// resources, see ContainerPatch.
+	Patch ContainerPatch
 }
 
 // ResourceScaleConfig holds the coefficients for a single resource scaling
-// function. The final result will be the base plus the larger of the by-cores
-// scaling and the by-nodes scaling, bounded by the max value.
+// function. The final result will be the base plus the largest of the by-cores,
+// by-nodes, by-pods, by-average-node-cores, by-metric and by-memory scaling,
+// bounded by the max value.  If a ladder is configured and yields a larger
+// value, that is used instead, also bounded by the max value.
 //
 // Example:
 //   Base = 10
@@ -268,7 +1610,8 @@ type ContainerScaleConfig struct {
 //   CoresPerStep = 4
 //   NodesPerStep = 2
 //
-//   The core and node counts are rounded up to the next whole step.
+//   The core and node counts are rounded up to the next whole step, unless
+//   Rounding says otherwise.
 //
 //   If we find 64 cores and 4 nodes we get scalars of:
 //     by-cores: 10 + (2 * (round(64, 4)/4)) = 10 + 32 = 42
@@ -290,6 +1633,206 @@ type ResourceScaleConfig struct {
 	CoresPerStep *int
 	// The number of nodes required to trigger an increase.
 	NodesPerStep *int
+	// If set, the number of nodes which Base is sized for: NodesPerStep
+	// only counts the nodes above it, e.g. to add 100m per node beyond 10.
+	BaselineNodes *int
+	// The number of ready pods matching --pod-selector and/or
+	// --pod-annotations-selector required to trigger an increase.
+	PodsPerStep *int
+	// The average number of cores per node required to trigger an increase.
+	AverageNodeCoresPerStep *int
+	// The count of the --scale-on metric required to trigger an increase.
+	MetricPerStep *int
+	// The total memory capacity of the nodes, in GiB, required to trigger
+	// an increase.  Unlike MetricPerStep, it doesn't depend on --scale-on,
+	// so that memory can follow the cluster's memory while cpu follows its
+	// cores.
+	MemoryPerStep *GiB
+	// Step functions of cluster metrics, see LadderConfig.
+	Ladder *LadderConfig
+	// How partial steps of the per-step counts above are rounded.  Defaults
+	// to RoundUp.
+	Rounding RoundingDirection
+	// Whether a cpu resource is emitted in whole cores or millicores, see
+	// CPUUnits.  Defaults to CPUMillicores.
+	CPUUnits CPUUnits
+	// If set, the resource is a percentage of another container's instead,
+	// see RelativeConfig.  Base is the floor, and Max the cap.
+	RelativeTo *RelativeConfig
+}
+
+// Validate checks what the JSON decoding can't: that the rounding directions
+// are known, that ladder soak periods aren't negative, that relative
+// resources don't refer to other relative ones, and the quantities of
+// resources which have stricter rules than the generic quantity syntax.
+// Ephemeral storage is counted in whole bytes, so its quantities must be
+// non-negative and must not have fractions of a byte, e.g. "1.5" or "100m".
+func (sc ScaleConfig) Validate() error {
+	if err := sc.validateBudgetFractions(); err != nil {
+		return err
+	}
+	for _, ctr := range sortedConfigNames(sc) {
+		if err := sc[ctr].Patch.validate(); err != nil {
+			return fmt.Errorf("container %q: %v", ctr, err)
+		}
+		if ltc := sc[ctr].LookupTable; ltc != nil {
+			if err := ltc.validate(); err != nil {
+				return fmt.Errorf("container %q: %v", ctr, err)
+			}
+			for _, res := range []apiv1.ResourceName{apiv1.ResourceCPU, apiv1.ResourceMemory} {
+				if _, found := sc[ctr].Requests[string(res)]; found {
+					return fmt.Errorf("container %q: requests[%q] is looked up in the lookupTable", ctr, res)
+				}
+			}
+		}
+		for _, kind := range []struct {
+			name string
+			cfgs map[string]ResourceScaleConfig
+		}{
+			{"requests", sc[ctr].Requests},
+			{"limits", sc[ctr].Limits},
+		} {
+			names := map[string]bool{}
+			for res := range kind.cfgs {
+				names[res] = true
+			}
+			for _, res := range sortedNames(names) {
+				rcfg := kind.cfgs[res]
+				if err := rcfg.Rounding.validate(); err != nil {
+					return fmt.Errorf("container %q: %s[%q]: %v", ctr, kind.name, res, err)
+				}
+				if rcfg.CPUUnits != "" && res != string(apiv1.ResourceCPU) {
+					return fmt.Errorf("container %q: %s[%q]: cpuUnits only applies to %q", ctr, kind.name, res, apiv1.ResourceCPU)
+				}
+				if err := rcfg.CPUUnits.validate(rcfg); err != nil {
+					return fmt.Errorf("container %q: %s[%q]: %v", ctr, kind.name, res, err)
+				}
+				if rcfg.Ladder != nil {
+					if err := rcfg.Ladder.validate(); err != nil {
+						return fmt.Errorf("container %q: %s[%q]: %v", ctr, kind.name, res, err)
+					}
+				}
+				if rcfg.MemoryPerStep != nil && *rcfg.MemoryPerStep < 0 {
+					return fmt.Errorf("container %q: %s[%q]: memoryPerStep cannot be negative", ctr, kind.name, res)
+				}
+				if rcfg.BaselineNodes != nil && *rcfg.BaselineNodes < 0 {
+					return fmt.Errorf("container %q: %s[%q]: baselineNodes cannot be negative", ctr, kind.name, res)
+				}
+				if rcfg.RelativeTo != nil {
+					if err := rcfg.RelativeTo.validate(ctr); err != nil {
+						return fmt.Errorf("container %q: %s[%q]: %v", ctr, kind.name, res, err)
+					}
+					if err := sc.validateReference(kind.name, res, rcfg.RelativeTo.Container); err != nil {
+						return fmt.Errorf("container %q: %s[%q]: %v", ctr, kind.name, res, err)
+					}
+				}
+				if res != string(apiv1.ResourceEphemeralStorage) {
+					continue
+				}
+				if err := validateStorageQuantities(rcfg); err != nil {
+					return fmt.Errorf("container %q: %s[%q]: %v", ctr, kind.name, res, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validatePools checks that the mainPoolNodeLadder and taintedPoolNodeLadder
+// are only used if --taint-toleration-match splits the nodes into the pools.
+// Without it, no node is counted in either.
+func (sc ScaleConfig) validatePools(taintPool bool) error {
+	if taintPool {
+		return nil
+	}
+	for _, ctr := range sortedConfigNames(sc) {
+		for _, kind := range []struct {
+			name string
+			cfgs map[string]ResourceScaleConfig
+		}{
+			{"requests", sc[ctr].Requests},
+			{"limits", sc[ctr].Limits},
+		} {
+			names := map[string]bool{}
+			for res := range kind.cfgs {
+				names[res] = true
+			}
+			for _, res := range sortedNames(names) {
+				ladder := kind.cfgs[res].Ladder
+				if ladder == nil {
+					continue
+				}
+				if len(ladder.MainPoolNodeLadder) > 0 || len(ladder.TaintedPoolNodeLadder) > 0 {
+					return fmt.Errorf("container %q: %s[%q]: mainPoolNodeLadder and taintedPoolNodeLadder require --taint-toleration-match", ctr, kind.name, res)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateStorageQuantities(rcfg ResourceScaleConfig) error {
+	fields := []struct {
+		name string
+		q    *resource.Quantity
+	}{
+		{"Base", rcfg.Base},
+		{"Max", rcfg.Max},
+		{"Step", rcfg.Step},
+	}
+	if rcfg.Ladder != nil {
+		for _, ladder := range []struct {
+			name  string
+			rungs []LadderRung
+		}{
+			{"CoreLadder", rcfg.Ladder.CoreLadder},
+			{"NodeLadder", rcfg.Ladder.NodeLadder},
+			{"PendingPodsLadder", rcfg.Ladder.PendingPodsLadder},
+			{"MemoryLadder", memoryRungs(rcfg.Ladder.MemoryLadder)},
+			{"CPUUtilizationLadder", rcfg.Ladder.CPUUtilizationLadder},
+			{"MetricLadder", rcfg.Ladder.MetricLadder},
+			{"MainPoolNodeLadder", rcfg.Ladder.MainPoolNodeLadder},
+			{"TaintedPoolNodeLadder", rcfg.Ladder.TaintedPoolNodeLadder},
+		} {
+			for i, rung := range ladder.rungs {
+				fields = append(fields, struct {
+					name string
+					q    *resource.Quantity
+				}{fmt.Sprintf("Ladder.%s[%d].Value", ladder.name, i), rung.Value})
+			}
+		}
+	}
+	for _, f := range fields {
+		if f.q == nil {
+			continue
+		}
+		if f.q.Sign() < 0 || f.q.MilliValue()%1000 != 0 {
+			return fmt.Errorf("%s must be a non-negative whole number of bytes, got %q", f.name, f.q.String())
+		}
+	}
+	return nil
+}
+
+// Version identifies the config by the SHA-256 of its JSON, e.g. for the
+// audit log.  Equal configs have the same version.
+func (sc ScaleConfig) Version() string {
+	// The copy has the same form whether or not sc is a copy itself, e.g.
+	// empty rather than nil maps.
+	data, err := json.Marshal(sc.DeepCopy())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func sortedConfigNames(sc ScaleConfig) []string {
+	names := []string{}
+	for name := range sc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (sc ScaleConfig) String() string {
@@ -312,7 +1855,17 @@ func (csc ContainerScaleConfig) String() string {
 	for k, v := range csc.Limits {
 		buf.WriteString(fmt.Sprintf("[%s]: %s", k, v))
 	}
-	buf.WriteString("} }")
+	buf.WriteString("} ")
+	if csc.LookupTable != nil {
+		buf.WriteString(fmt.Sprintf("lookupTable: %s ", csc.LookupTable))
+	}
+	if csc.BudgetFraction != nil {
+		buf.WriteString(fmt.Sprintf("budgetFraction: %v ", *csc.BudgetFraction))
+	}
+	if csc.Patch != nil {
+		buf.WriteString(fmt.Sprintf("patch: %v ", map[string]interface{}(csc.Patch)))
+	}
+	buf.WriteString("}")
 	return buf.String()
 }
 
@@ -334,6 +1887,33 @@ func (rsc ResourceScaleConfig) String() string {
 	if rsc.NodesPerStep != nil {
 		buf.WriteString(fmt.Sprintf("nodes_incr=%d ", *rsc.NodesPerStep))
 	}
+	if rsc.BaselineNodes != nil {
+		buf.WriteString(fmt.Sprintf("baseline_nodes=%d ", *rsc.BaselineNodes))
+	}
+	if rsc.PodsPerStep != nil {
+		buf.WriteString(fmt.Sprintf("pods_incr=%d ", *rsc.PodsPerStep))
+	}
+	if rsc.AverageNodeCoresPerStep != nil {
+		buf.WriteString(fmt.Sprintf("avg_node_cores_incr=%d ", *rsc.AverageNodeCoresPerStep))
+	}
+	if rsc.MetricPerStep != nil {
+		buf.WriteString(fmt.Sprintf("metric_incr=%d ", *rsc.MetricPerStep))
+	}
+	if rsc.MemoryPerStep != nil {
+		buf.WriteString(fmt.Sprintf("memory_incr=%dGi ", *rsc.MemoryPerStep))
+	}
+	if rsc.Ladder != nil {
+		buf.WriteString(fmt.Sprintf("ladder=%s ", rsc.Ladder))
+	}
+	if rsc.Rounding != "" {
+		buf.WriteString(fmt.Sprintf("rounding=%s ", rsc.Rounding))
+	}
+	if rsc.CPUUnits != "" {
+		buf.WriteString(fmt.Sprintf("cpu_units=%s ", rsc.CPUUnits))
+	}
+	if rsc.RelativeTo != nil {
+		buf.WriteString(fmt.Sprintf("relative_to=%d%%(%s) ", rsc.RelativeTo.Percent, rsc.RelativeTo.Container))
+	}
 	buf.WriteString("}")
 	return buf.String()
 }
@@ -357,6 +1937,14 @@ func (csc ContainerScaleConfig) DeepCopy() ContainerScaleConfig {
 	for k, v := range csc.Limits {
 		out.Limits[k] = v.DeepCopy()
 	}
+	if csc.LookupTable != nil {
+		out.LookupTable = csc.LookupTable.DeepCopy()
+	}
+	if csc.BudgetFraction != nil {
+		f := *csc.BudgetFraction
+		out.BudgetFraction = &f
+	}
+	out.Patch = csc.Patch.DeepCopy()
 	return out
 
 }
@@ -381,5 +1969,35 @@ func (rsc ResourceScaleConfig) DeepCopy() ResourceScaleConfig {
 		out.NodesPerStep = new(int)
 		*out.NodesPerStep = *rsc.NodesPerStep
 	}
+	if rsc.BaselineNodes != nil {
+		out.BaselineNodes = new(int)
+		*out.BaselineNodes = *rsc.BaselineNodes
+	}
+	if rsc.PodsPerStep != nil {
+		out.PodsPerStep = new(int)
+		*out.PodsPerStep = *rsc.PodsPerStep
+	}
+	if rsc.AverageNodeCoresPerStep != nil {
+		out.AverageNodeCoresPerStep = new(int)
+		*out.AverageNodeCoresPerStep = *rsc.AverageNodeCoresPerStep
+	}
+	if rsc.MetricPerStep != nil {
+		out.MetricPerStep = new(int)
+		*out.MetricPerStep = *rsc.MetricPerStep
+	}
+	if rsc.MemoryPerStep != nil {
+		out.MemoryPerStep = new(GiB)
+		*out.MemoryPerStep = *rsc.MemoryPerStep
+	}
+	if rsc.Ladder != nil {
+		l := rsc.Ladder.DeepCopy()
+		out.Ladder = &l
+	}
+	out.Rounding = rsc.Rounding
+	out.CPUUnits = rsc.CPUUnits
+	if rsc.RelativeTo != nil {
+		rel := *rsc.RelativeTo
+		out.RelativeTo = &rel
+	}
 	return out
 }
@@ -17,13 +17,22 @@ limitations under the License.
 package autoscaler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/publishers"
+	realk8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
 	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/clock"
 )
 
@@ -260,3 +269,865 @@ func TestCalculatePerNodes(t *testing.T) {
 		}
 	}
 }
+
+func TestCalculateBaselineNodes(t *testing.T) {
+	cfg := ScaleConfig{}
+	conf := `{"fake-agent": {"requests": {"cpu": {"base": "1", "step": "100m", "nodesPerStep": 1, "baselineNodes": 10}}}}`
+	if err := json.Unmarshal([]byte(conf), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		numNodes int
+		expVal   int64
+	}{
+		{0, 1000},
+		{10, 1000},
+		{11, 1100},
+		{25, 2500},
+	} {
+		sz := &realk8sclient.ClusterSize{Nodes: tt.numNodes}
+		if val := calculate(cfg["fake-agent"].Requests["cpu"], sz); val != tt.expVal {
+			t.Errorf("%d nodes: expected %d got %d", tt.numNodes, tt.expVal, val)
+		}
+	}
+
+	negative := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"fake-agent": {"requests": {"cpu": {"baselineNodes": -1}}}}`), &negative); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	if err := negative.Validate(); err == nil {
+		t.Errorf("expected a negative baselineNodes to be rejected")
+	}
+}
+
+func TestCalculateRounding(t *testing.T) {
+	var rounded = `
+{
+  "fake-agent": {
+    "requests": {
+      "cpu": {
+        "base": "10m", "step": "10m", "max": "%dm", "nodesPerStep": %d, "rounding": %q
+      }
+    }
+  }
+}
+`
+	for _, tt := range []struct {
+		name     string
+		numNodes int
+		perStep  int
+		max      int
+		rounding string
+		expVal   int64
+	}{
+		{"half step, default", 5, 2, 0, "", 40},
+		{"half step, up", 5, 2, 0, "up", 40},
+		{"half step, down", 5, 2, 0, "down", 30},
+		{"half step, nearest", 5, 2, 0, "nearest", 40},
+		{"quarter step, up", 9, 4, 0, "up", 40},
+		{"quarter step, down", 9, 4, 0, "down", 30},
+		{"quarter step, nearest", 9, 4, 0, "nearest", 30},
+		{"three quarter step, nearest", 11, 4, 0, "nearest", 40},
+		{"whole steps, down", 8, 4, 0, "down", 30},
+		{"bounded by max, up", 5, 2, 35, "up", 35},
+		{"below max, down", 5, 2, 35, "down", 30},
+	} {
+		mockK8s := k8sclient.MockK8sClient{NumOfNodes: tt.numNodes}
+		conf := fmt.Sprintf(rounded, tt.max, tt.perStep, tt.rounding)
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(conf), &cfg); err != nil {
+			t.Fatalf("invalid default config: %v", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("%s: invalid default config: %v", tt.name, err)
+		}
+
+		sz, err := mockK8s.GetClusterSize()
+		if err != nil {
+			t.Errorf("failed to get cluster size")
+		}
+		val := calculate(cfg["fake-agent"].Requests["cpu"], sz)
+		if val != tt.expVal {
+			t.Errorf("%s: expected %d got %d", tt.name, tt.expVal, val)
+		}
+	}
+}
+
+func TestCalculateMax(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		config   string
+		numNodes int
+		numCores int
+		expVal   int64
+	}{
+		{"by cores, below max", `{"base": "100m", "max": "1", "step": "100m", "coresPerStep": 16}`, 10, 80, 600},
+		{"by cores, above max", `{"base": "100m", "max": "1", "step": "100m", "coresPerStep": 16}`, 50, 800, 1000},
+		{"by nodes, above max", `{"base": "100m", "max": "1", "step": "100m", "nodesPerStep": 2}`, 50, 800, 1000},
+		{"no max", `{"base": "100m", "step": "100m", "coresPerStep": 16}`, 50, 800, 5100},
+	} {
+		rcfg := ResourceScaleConfig{}
+		if err := json.Unmarshal([]byte(tt.config), &rcfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tt.name, err)
+		}
+		mockK8s := k8sclient.MockK8sClient{NumOfNodes: tt.numNodes, NumOfCores: tt.numCores}
+		sz, err := mockK8s.GetClusterSize()
+		if err != nil {
+			t.Fatalf("failed to get cluster size")
+		}
+		if val := calculate(rcfg, sz); val != tt.expVal {
+			t.Errorf("%s: expected %d got %d", tt.name, tt.expVal, val)
+		}
+	}
+}
+
+func TestCalculatePerPods(t *testing.T) {
+	var podsPerStep = `
+{
+  "fake-agent": {
+    "requests": {
+      "cpu": {
+        "base": "%dm", "step":"%dm", "podsPerStep":%d
+      }
+    }
+  }
+}
+`
+	for _, tt := range []struct {
+		name    string
+		numPods int
+		expVal  int64
+		base    int
+		step    int
+		perStep int
+	}{
+		{
+			"base 10, step 1, per step 1",
+			5,
+			15,
+			10,
+			1,
+			1,
+		},
+		{
+			"base 10, step 2, per step 2",
+			5,
+			16,
+			10,
+			2,
+			2,
+		},
+		{
+			"base 10, step 1, no matching pods",
+			0,
+			10,
+			10,
+			1,
+			1,
+		},
+	} {
+		mockK8s := k8sclient.MockK8sClient{
+			NumOfMatchingPods: tt.numPods,
+		}
+		conf := fmt.Sprintf(podsPerStep, tt.base, tt.step, tt.perStep)
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(conf), &cfg); err != nil {
+			t.Fatalf("invalid default config: %v", err)
+		}
+
+		sz, err := mockK8s.GetClusterSize()
+		if err != nil {
+			t.Errorf("failed to get cluster size")
+		}
+		val := calculate(cfg["fake-agent"].Requests["cpu"], sz)
+		if val != tt.expVal {
+			t.Errorf("%s: expected %d got %d", tt.name, tt.expVal, val)
+		}
+	}
+}
+
+func TestRequirementsEqual(t *testing.T) {
+	reqs := func(res apiv1.ResourceName, qty string) map[string]apiv1.ResourceRequirements {
+		return map[string]apiv1.ResourceRequirements{
+			"fake-agent": {
+				Requests: apiv1.ResourceList{res: resource.MustParse(qty)},
+				Limits:   apiv1.ResourceList{},
+			},
+		}
+	}
+	for _, tt := range []struct {
+		name    string
+		current map[string]apiv1.ResourceRequirements
+		want    map[string]apiv1.ResourceRequirements
+		expVal  bool
+	}{
+		{"same string", reqs(apiv1.ResourceMemory, "1Gi"), reqs(apiv1.ResourceMemory, "1Gi"), true},
+		{"same value", reqs(apiv1.ResourceMemory, "1Gi"), reqs(apiv1.ResourceMemory, "1024Mi"), true},
+		{"milli value", reqs(apiv1.ResourceCPU, "1"), reqs(apiv1.ResourceCPU, "1000m"), true},
+		{"different value", reqs(apiv1.ResourceMemory, "1Gi"), reqs(apiv1.ResourceMemory, "1025Mi"), false},
+		{"different resource", reqs(apiv1.ResourceMemory, "1"), reqs(apiv1.ResourceCPU, "1"), false},
+		{"no current", nil, reqs(apiv1.ResourceCPU, "1"), false},
+	} {
+		if val := requirementsEqual(tt.current, tt.want); val != tt.expVal {
+			t.Errorf("%s: expected %v got %v", tt.name, tt.expVal, val)
+		}
+	}
+}
+
+func TestCalculatePerAverageNodeCores(t *testing.T) {
+	var conf = `
+{
+  "fake-agent": {
+    "requests": {
+      "cpu": {
+        "base": "10m", "step":"1m", "averageNodeCoresPerStep":1
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(conf), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	for _, tt := range []struct {
+		name     string
+		numNodes int
+		numCores int
+		minNodes int
+		expVal   int64
+	}{
+		{"4 nodes of 8 cores", 4, 32, 1, 18},
+		{"1 node, no floor", 1, 32, 1, 42},
+		{"1 node, floor 4", 1, 32, 4, 18},
+		{"4 nodes, floor 4", 4, 32, 4, 18},
+		{"8 nodes, floor 4", 8, 32, 4, 14},
+	} {
+		autoScaler := &AutoScaler{
+			k8sClient: &k8sclient.MockK8sClient{
+				NumOfNodes: tt.numNodes,
+				NumOfCores: tt.numCores,
+			},
+			minEffectiveNodes: tt.minNodes,
+		}
+		sz, err := autoScaler.getClusterSize(context.Background())
+		if err != nil {
+			t.Errorf("failed to get cluster size")
+		}
+		val := calculate(cfg["fake-agent"].Requests["cpu"], sz)
+		if val != tt.expVal {
+			t.Errorf("%s: expected %d got %d", tt.name, tt.expVal, val)
+		}
+	}
+}
+
+func TestCalculatePerMemory(t *testing.T) {
+	// cpu follows the cores of the cluster, and memory its memory.
+	var conf = `
+{
+  "fake-agent": {
+    "requests": {
+      "cpu": {
+        "base": "100m", "step": "100m", "coresPerStep": 4
+      },
+      "memory": {
+        "base": "256Mi", "step": "64Mi", "memoryPerStep": "32Gi"
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(conf), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	type pool struct {
+		nodes     int
+		cores     int // Per node.
+		memoryGiB int64
+	}
+	compute := pool{cores: 16, memoryGiB: 32}
+	memory := pool{cores: 4, memoryGiB: 128}
+	for _, tt := range []struct {
+		name      string
+		pools     []pool
+		expCPU    string
+		expMemory string
+	}{
+		{"compute-optimized", []pool{{4, compute.cores, compute.memoryGiB}}, "1700m", "512Mi"},
+		{"memory-optimized", []pool{{4, memory.cores, memory.memoryGiB}}, "500m", "1280Mi"},
+		{"mixed", []pool{{2, compute.cores, compute.memoryGiB}, {2, memory.cores, memory.memoryGiB}}, "1100m", "896Mi"},
+		{"no nodes", nil, "100m", "256Mi"},
+	} {
+		mockK8s := &k8sclient.MockK8sClient{}
+		for _, p := range tt.pools {
+			mockK8s.NumOfNodes += p.nodes
+			mockK8s.NumOfCores += p.nodes * p.cores
+			mockK8s.Memory.Add(*resource.NewQuantity(int64(p.nodes)*p.memoryGiB<<30, resource.BinarySI))
+		}
+		autoScaler := &AutoScaler{k8sClient: mockK8s}
+		sz, err := autoScaler.getClusterSize(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get cluster size")
+		}
+		for _, res := range []struct {
+			name     string
+			expected string
+		}{
+			{"cpu", tt.expCPU},
+			{"memory", tt.expMemory},
+		} {
+			val := calculate(cfg["fake-agent"].Requests[res.name], sz)
+			if expected := resource.MustParse(res.expected); val != expected.MilliValue() {
+				t.Errorf("%s: expected %s %s, got %s", tt.name, res.name, res.expected, resource.NewMilliQuantity(val, resource.BinarySI))
+			}
+		}
+	}
+
+	bad := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"memory": {"memoryPerStep": -1}}}}`), &bad); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if err := bad.Validate(); err == nil {
+		t.Errorf("expected an error for a negative memoryPerStep")
+	}
+}
+
+func TestRefreshConfigSwitchesTarget(t *testing.T) {
+	f, err := ioutil.TempFile("", "cpva-config")
+	if err != nil {
+		t.Fatalf("can't create config file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"target": "DaemonSet/other", "foo": {"requests": {"cpu": {"base": "10m"}}}}`); err != nil {
+		t.Fatalf("can't write config file: %v", err)
+	}
+	f.Close()
+
+	mockK8s := &k8sclient.MockK8sClient{
+		Current: map[string]apiv1.ResourceRequirements{
+			"foo": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("5m")}},
+		},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:           mockK8s,
+		target:              "deployment/thing",
+		defaultTarget:       "deployment/thing",
+		resetReplacedTarget: true,
+		configFile:          f.Name(),
+		lastReqs:            map[string]apiv1.ResourceRequirements{},
+		originalReqs:        map[string]apiv1.ResourceRequirements{},
+	}
+	changed, err := autoScaler.refreshConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Errorf("expected the config to change")
+	}
+	if autoScaler.target != "daemonset/other" || mockK8s.Target != "daemonset/other" {
+		t.Errorf("expected target daemonset/other, got %q (client %q)", autoScaler.target, mockK8s.Target)
+	}
+	if autoScaler.lastReqs != nil || autoScaler.originalReqs != nil {
+		t.Errorf("expected the state of the old target to be dropped")
+	}
+	if _, found := autoScaler.currentConfig["foo"]; !found || len(autoScaler.currentConfig) != 1 {
+		t.Errorf("unexpected config: %v", autoScaler.currentConfig)
+	}
+}
+
+func TestRefreshConfigSwitchesContainerPath(t *testing.T) {
+	f, err := ioutil.TempFile("", "cpva-config")
+	if err != nil {
+		t.Fatalf("can't create config file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"containerPath": "/spec/controller/template/spec/containers", "foo": {"requests": {"cpu": {"base": "10m"}}}}`); err != nil {
+		t.Fatalf("can't write config file: %v", err)
+	}
+	f.Close()
+
+	mockK8s := &k8sclient.MockK8sClient{}
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		target:        "deployment/thing",
+		defaultTarget: "deployment/thing",
+		configFile:    f.Name(),
+		lastReqs:      map[string]apiv1.ResourceRequirements{},
+	}
+	if _, err := autoScaler.refreshConfig(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mockK8s.Target != "deployment/thing" || mockK8s.ContainerPath.String() != ".spec.controller.template.spec.containers" {
+		t.Errorf("expected the containers of deployment/thing at .spec.controller.template.spec.containers, got %q at %s", mockK8s.Target, mockK8s.ContainerPath)
+	}
+	if autoScaler.containerPath.String() != mockK8s.ContainerPath.String() || autoScaler.lastReqs != nil {
+		t.Errorf("expected the state of the old containers to be dropped")
+	}
+}
+
+func TestRefreshConfigManagedAnnotations(t *testing.T) {
+	mockK8s := &k8sclient.MockK8sClient{
+		ManagedConfig: &realk8sclient.ManagedConfig{
+			Target:          "deployment/thing",
+			ConfigMap:       "thing-policy",
+			ResourceVersion: "1",
+			Data:            []byte(`{"foo": {"requests": {"cpu": {"base": "10m"}}}}`),
+		},
+	}
+	// The client found the target by its annotations.
+	autoScaler := &AutoScaler{
+		k8sClient:          mockK8s,
+		managedAnnotations: true,
+	}
+	if changed, err := autoScaler.refreshConfig(); err != nil || !changed {
+		t.Fatalf("expected the config to change, got %v, %v", changed, err)
+	}
+	if autoScaler.target != "deployment/thing" || mockK8s.Target != "" {
+		t.Errorf("expected target deployment/thing without a switch, got %q (client %q)", autoScaler.target, mockK8s.Target)
+	}
+	if _, found := autoScaler.currentConfig["foo"]; !found || autoScaler.configSource != "file" {
+		t.Errorf("unexpected config from %s: %v", autoScaler.configSource, autoScaler.currentConfig)
+	}
+
+	if changed, err := autoScaler.refreshConfig(); err != nil || changed {
+		t.Errorf("expected the same ConfigMap not to change the config, got %v, %v", changed, err)
+	}
+
+	mockK8s.ManagedConfig = &realk8sclient.ManagedConfig{
+		Target:          "deployment/thing",
+		ConfigMap:       "thing-policy",
+		ResourceVersion: "2",
+		Data:            []byte(`{"bar": {"requests": {"cpu": {"base": "10m"}}}}`),
+	}
+	if changed, err := autoScaler.refreshConfig(); err != nil || !changed {
+		t.Fatalf("expected the updated ConfigMap to change the config, got %v, %v", changed, err)
+	}
+	if _, found := autoScaler.currentConfig["bar"]; !found {
+		t.Errorf("unexpected config: %v", autoScaler.currentConfig)
+	}
+
+	mockK8s.ManagedConfigErr = fmt.Errorf("not managed")
+	if _, err := autoScaler.refreshConfig(); err == nil {
+		t.Errorf("expected an error once the target isn't managed")
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	testCases := []struct {
+		name      string
+		data      string
+		expTarget string
+		expCtrs   int
+		expError  bool
+	}{
+		{"containers only", `{"foo": {}, "bar": {}}`, "", 2, false},
+		{"with target", `{"target": "Deployment/foo", "foo": {}}`, "deployment/foo", 1, false},
+		{"container named target", `{"target": {"requests": {}}}`, "", 1, false},
+		{"with container path", `{"containerPath": ".spec.worker.template.spec.containers", "foo": {}}`, "", 1, false},
+		{"invalid container path", `{"containerPath": "spec.worker", "foo": {}}`, "", 0, true},
+		{"container named containerPath", `{"containerPath": {"requests": {}}}`, "", 1, false},
+		{"invalid", `{"foo": 1}`, "", 0, true},
+		{"ephemeral storage", `{"foo": {"requests": {"ephemeral-storage": {"base": "1Gi", "step": "512Mi", "nodesPerStep": 10}}, "limits": {"ephemeral-storage": {"base": "2Gi"}}}}`, "", 1, false},
+		{"invalid ephemeral storage", `{"foo": {"limits": {"ephemeral-storage": {"base": "lots"}}}}`, "", 0, true},
+		{"fractional ephemeral storage", `{"foo": {"requests": {"ephemeral-storage": {"step": "100m"}}}}`, "", 0, true},
+		{"rounding", `{"foo": {"requests": {"cpu": {"base": "10m", "rounding": "nearest"}}}}`, "", 1, false},
+		{"unknown rounding", `{"foo": {"requests": {"cpu": {"base": "10m", "rounding": "sideways"}}}}`, "", 0, true},
+		{"negative ephemeral storage ladder", `{"foo": {"requests": {"ephemeral-storage": {"ladder": {"nodeLadder": [{"threshold": 0, "value": "-1Gi"}]}}}}}`, "", 0, true},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{}
+		header, err := parseConfigFile([]byte(tc.data), &cfg)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%s: expected an error", tc.name)
+			continue
+		}
+		if header.target != tc.expTarget {
+			t.Errorf("%s: expected target %q, got %q", tc.name, tc.expTarget, header.target)
+		}
+		if len(cfg) != tc.expCtrs {
+			t.Errorf("%s: expected %d containers, got %v", tc.name, tc.expCtrs, cfg)
+		}
+	}
+}
+
+func TestEvaluateEphemeralStorage(t *testing.T) {
+	base := resource.MustParse("1Gi")
+	step := resource.MustParse("512Mi")
+	nodesPerStep := 10
+	rcfg := ResourceScaleConfig{Base: &base, Step: &step, NodesPerStep: &nodesPerStep}
+	cfg := ContainerScaleConfig{
+		Requests: map[string]ResourceScaleConfig{"ephemeral-storage": rcfg},
+		Limits:   map[string]ResourceScaleConfig{"ephemeral-storage": rcfg},
+	}
+	mockK8s := k8sclient.MockK8sClient{NumOfNodes: 15}
+	sz, err := mockK8s.GetClusterSize()
+	if err != nil {
+		t.Fatalf("failed to get cluster size")
+	}
+	reqs := MultiAxisEvaluator{}.Evaluate("foo", cfg, sz)
+	want := resource.MustParse("2Gi")
+	for kind, list := range map[string]apiv1.ResourceList{"requests": reqs.Requests, "limits": reqs.Limits} {
+		got, found := list[apiv1.ResourceEphemeralStorage]
+		if !found {
+			t.Errorf("expected %s[ephemeral-storage], got %v", kind, list)
+			continue
+		}
+		if got.Cmp(want) != 0 {
+			t.Errorf("expected %s[ephemeral-storage] = %s, got %s", kind, want.String(), got.String())
+		}
+	}
+}
+
+// fakeExporter remembers the last exported metrics.
+type fakeExporter struct {
+	last *exporters.Metrics
+}
+
+func (e *fakeExporter) Name() string { return "fake" }
+
+func (e *fakeExporter) Export(m *exporters.Metrics) error {
+	e.last = m
+	return nil
+}
+
+type fakePublisher struct {
+	events []*publishers.ScaleEvent
+}
+
+func (p *fakePublisher) Name() string { return "fake" }
+
+func (p *fakePublisher) Publish(ev *publishers.ScaleEvent) error {
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func TestShadowConfig(t *testing.T) {
+	parse := func(data string) ScaleConfig {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+			t.Fatalf("invalid config: %v", err)
+		}
+		return cfg
+	}
+	exp := &fakeExporter{}
+	autoScaler := &AutoScaler{
+		k8sClient:     &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16},
+		currentConfig: parse(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "coresPerStep": 1}}}}`),
+		shadowConfig:  parse(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "20m", "coresPerStep": 1}}}}`),
+		exporters:     []exporters.MetricsExporter{exp},
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+	clusterSize, err := autoScaler.getClusterSize(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	autoScaler.evaluateShadow(clusterSize, autoScaler.recommend(clusterSize))
+	autoScaler.exportMetrics(clusterSize)
+
+	if autoScaler.lastReqs != nil {
+		t.Errorf("the shadow config must not be applied")
+	}
+	got := exp.last.ShadowRequests["foo"][apiv1.ResourceCPU]
+	if expected := resource.MustParse("420m"); got.Cmp(expected) != 0 {
+		t.Errorf("expected shadow cpu %v, got %v", &expected, &got)
+	}
+}
+
+func TestExportMetricsDropsRemovedContainers(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m"}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	exp := &fakeExporter{}
+	autoScaler := &AutoScaler{
+		currentConfig: cfg,
+		lastReqs: map[string]apiv1.ResourceRequirements{
+			"foo": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+			"bar": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("200m")}},
+		},
+		exporters: []exporters.MetricsExporter{exp},
+		clock:     clock.NewFakeClock(time.Now()),
+	}
+	autoScaler.exportMetrics(&realk8sclient.ClusterSize{Nodes: 1, Cores: 1})
+	if _, found := exp.last.Requests["bar"]; found {
+		t.Errorf("expected container bar, which left the config, to be dropped")
+	}
+	if _, found := exp.last.Requests["foo"]; !found {
+		t.Errorf("expected container foo to be exported")
+	}
+}
+
+func TestRequestChanges(t *testing.T) {
+	reqs := func(cpu, mem string) apiv1.ResourceRequirements {
+		list := apiv1.ResourceList{}
+		if cpu != "" {
+			list[apiv1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if mem != "" {
+			list[apiv1.ResourceMemory] = resource.MustParse(mem)
+		}
+		return apiv1.ResourceRequirements{Requests: list}
+	}
+	old := map[string]apiv1.ResourceRequirements{
+		"a": reqs("100m", "1Gi"),
+		"b": reqs("0", "64Mi"),
+	}
+	new := map[string]apiv1.ResourceRequirements{
+		"a": reqs("150m", "512Mi"),
+		"b": reqs("100m", "64Mi"),
+		"c": reqs("1", ""),
+	}
+	expected := []exporters.RequestChange{
+		{Container: "a", Resource: apiv1.ResourceCPU, Old: 0.1, New: 0.15},
+		{Container: "a", Resource: apiv1.ResourceMemory, Old: 1 << 30, New: 1 << 29},
+	}
+	changes := requestChanges(old, new)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, changes)
+	}
+	if f := changes[0].Fraction(); f < 0.4999 || f > 0.5001 || changes[0].Direction() != "up" {
+		t.Errorf("expected cpu to go up by 0.5, got %s by %v", changes[0].Direction(), f)
+	}
+	if f := changes[1].Fraction(); f != 0.5 || changes[1].Direction() != "down" {
+		t.Errorf("expected memory to go down by 0.5, got %s by %v", changes[1].Direction(), f)
+	}
+	if changes := requestChanges(nil, new); len(changes) != 0 {
+		t.Errorf("expected no changes from no requests, got %+v", changes)
+	}
+}
+
+func TestUpdateFailuresAreCounted(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "coresPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	exp := &fakeExporter{}
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16, UpdateErr: fmt.Errorf("patch failed")}
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		k8sClient:     mockK8s,
+		currentConfig: cfg,
+		exporters:     []exporters.MetricsExporter{exp},
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+	target := exporters.Target{Kind: "deployment", Name: "foo"}
+
+	autoScaler.pollAPIServer(context.Background())
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.lastReqs != nil {
+		t.Errorf("failed updates must not be remembered as applied")
+	}
+	if got := exp.last.UpdateFailures[target]; got != 2 {
+		t.Errorf("expected 2 failures, got %d", got)
+	}
+
+	// Once the target can be updated again, the count stays.
+	mockK8s.UpdateErr = nil
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.lastReqs == nil {
+		t.Errorf("expected the update to be applied")
+	}
+	if got := exp.last.UpdateFailures[target]; got != 2 {
+		t.Errorf("expected 2 failures, got %d", got)
+	}
+}
+
+func TestPollTargetGone(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "coresPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	pub := &fakePublisher{}
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16, UpdateErr: realk8sclient.ErrTargetGone}
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		k8sClient:     mockK8s,
+		currentConfig: cfg,
+		deltaScaler:   &DeltaScaler{Threshold: 1},
+		publishers:    []publishers.EventPublisher{pub},
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.lastReqs != nil || autoScaler.lastSize != nil {
+		t.Errorf("an update of a target which is gone must not be remembered as applied")
+	}
+	if len(pub.events) != 0 {
+		t.Errorf("expected no scale events, got %d", len(pub.events))
+	}
+	if len(autoScaler.updateFailures) != 0 {
+		t.Errorf("expected no update failures, got %v", autoScaler.updateFailures)
+	}
+
+	// Once the target is back, the same cluster size updates it.
+	mockK8s.UpdateErr = nil
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.lastReqs == nil {
+		t.Errorf("expected the update to be applied")
+	}
+	if len(pub.events) != 1 {
+		t.Errorf("expected 1 scale event, got %d", len(pub.events))
+	}
+}
+
+func TestForceScale(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "nodesPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16}
+	fakeClock := clock.NewFakeClock(time.Now())
+	autoScaler := &AutoScaler{
+		namespace:        "default",
+		target:           "deployment/foo",
+		defaultTarget:    "deployment/foo",
+		k8sClient:        mockK8s,
+		defaultConfig:    cfg,
+		deltaScaler:      &DeltaScaler{Threshold: 5},
+		clusterSizeCache: realk8sclient.NewCachingClusterSizeProvider(mockK8s, time.Hour, fakeClock),
+		forceCh:          make(chan struct{}, 1),
+		clock:            fakeClock,
+	}
+	autoScaler.pollAPIServer(context.Background())
+	cpu := autoScaler.lastReqs["foo"].Requests["cpu"]
+	if cpu.MilliValue() != 140 {
+		t.Fatalf("expected 140m, got %s", cpu.String())
+	}
+
+	// A change below the threshold is ignored, and cached anyway.
+	mockK8s.NumOfNodes = 5
+	autoScaler.pollAPIServer(context.Background())
+	cpu = autoScaler.lastReqs["foo"].Requests["cpu"]
+	if cpu.MilliValue() != 140 {
+		t.Errorf("expected the change to be ignored, got %s", cpu.String())
+	}
+
+	// Requests are coalesced.
+	autoScaler.ForceScale()
+	autoScaler.ForceScale()
+	if len(autoScaler.forceCh) != 1 {
+		t.Errorf("expected one pending forced cycle, got %d", len(autoScaler.forceCh))
+	}
+	autoScaler.poll(context.Background(), true)
+	cpu = autoScaler.lastReqs["foo"].Requests["cpu"]
+	if cpu.MilliValue() != 150 {
+		t.Errorf("expected a forced cycle to apply 150m, got %s", cpu.String())
+	}
+}
+
+func TestPollNodesResizedInPlace(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "coresPerStep": 4}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	for _, tc := range []struct {
+		coresThreshold float64
+		newCores       int
+		expMilli       int64
+	}{
+		{0, 32, 180},
+		{0.1, 32, 180},
+		{0, 17, 150},
+		{0.1, 17, 140},
+	} {
+		mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16}
+		autoScaler := &AutoScaler{
+			namespace:     "default",
+			target:        "deployment/foo",
+			defaultTarget: "deployment/foo",
+			k8sClient:     mockK8s,
+			defaultConfig: cfg,
+			deltaScaler:   &DeltaScaler{Threshold: 5, CoresThreshold: tc.coresThreshold},
+			clock:         clock.NewFakeClock(time.Now()),
+		}
+		autoScaler.pollAPIServer(context.Background())
+		// The number of nodes stays the same, but they are bigger.
+		mockK8s.NumOfCores = tc.newCores
+		autoScaler.pollAPIServer(context.Background())
+		cpu := autoScaler.lastReqs["foo"].Requests["cpu"]
+		if cpu.MilliValue() != tc.expMilli {
+			t.Errorf("cores threshold %v, %d cores: expected %dm, got %s", tc.coresThreshold, tc.newCores, tc.expMilli, cpu.String())
+		}
+	}
+}
+
+func TestPollWatched(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "nodesPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16}
+	fakeClock := clock.NewFakeClock(time.Now())
+	autoScaler := &AutoScaler{
+		namespace:        "default",
+		target:           "deployment/foo",
+		defaultTarget:    "deployment/foo",
+		k8sClient:        mockK8s,
+		defaultConfig:    cfg,
+		clusterSizeCache: realk8sclient.NewCachingClusterSizeProvider(mockK8s, time.Hour, fakeClock),
+		nodeCh:           make(chan *realk8sclient.ClusterSize, 1),
+		clock:            fakeClock,
+	}
+	autoScaler.pollAPIServer(context.Background())
+	cpu := autoScaler.lastReqs["foo"].Requests["cpu"]
+	if cpu.MilliValue() != 140 {
+		t.Fatalf("expected 140m, got %s", cpu.String())
+	}
+
+	// Only the latest watched size is polled with.
+	autoScaler.nodesChanged(&realk8sclient.ClusterSize{Nodes: 6, Cores: 24})
+	autoScaler.nodesChanged(&realk8sclient.ClusterSize{Nodes: 8, Cores: 32})
+	if len(autoScaler.nodeCh) != 1 {
+		t.Fatalf("expected one pending cluster size, got %d", len(autoScaler.nodeCh))
+	}
+	autoScaler.pollWatched(context.Background(), <-autoScaler.nodeCh)
+	cpu = autoScaler.lastReqs["foo"].Requests["cpu"]
+	if cpu.MilliValue() != 180 {
+		t.Errorf("expected the watched size to apply 180m, got %s", cpu.String())
+	}
+
+	// The cluster size cached before is not used again.
+	mockK8s.NumOfNodes = 8
+	autoScaler.pollAPIServer(context.Background())
+	cpu = autoScaler.lastReqs["foo"].Requests["cpu"]
+	if cpu.MilliValue() != 180 {
+		t.Errorf("expected a fresh cluster size to keep 180m, got %s", cpu.String())
+	}
+}
+
+func TestScaleConfigVersion(t *testing.T) {
+	parse := func(data string) ScaleConfig {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+			t.Fatalf("invalid config: %v", err)
+		}
+		return cfg
+	}
+	a := parse(`{"foo": {"requests": {"cpu": {"base": "10m", "step": "1m", "nodesPerStep": 2}}}, "bar": {}}`)
+	reordered := parse(`{"bar": {}, "foo": {"requests": {"cpu": {"nodesPerStep": 2, "step": "1m", "base": "10m"}}}}`)
+	changed := parse(`{"foo": {"requests": {"cpu": {"base": "10m", "step": "1m", "nodesPerStep": 3}}}, "bar": {}}`)
+	if a.Version() == "" || a.Version() != reordered.Version() {
+		t.Errorf("expected equal configs to have the same version, got %q and %q", a.Version(), reordered.Version())
+	}
+	if a.Version() == changed.Version() {
+		t.Errorf("expected different configs to have different versions, got %q", a.Version())
+	}
+	if a.Version() != a.DeepCopy().Version() {
+		t.Errorf("expected a copy to have the same version")
+	}
+}
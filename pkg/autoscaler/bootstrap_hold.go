@@ -0,0 +1,60 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// BootstrapHold holds the target at the floor of the config while a new
+// cluster is still growing, so that it isn't restarted once for every batch
+// of nodes that joins.  Once the number of nodes hasn't increased for
+// StablePeriod, the computed resources are applied, and the target is never
+// held again.  This is separate from everything else that holds updates back,
+// such as the --node-allocation-threshold.
+type BootstrapHold struct {
+	StablePeriod time.Duration
+	// The most nodes seen so far, and when they were first seen.
+	maxNodes int
+	since    time.Time
+	done     bool
+}
+
+// Done returns whether the hold is over.
+func (b *BootstrapHold) Done() bool {
+	return b.done
+}
+
+// Holds records that nodes were counted at now, and returns whether the
+// target is still held at the floor.
+func (b *BootstrapHold) Holds(nodes int, now time.Time) bool {
+	if b.done {
+		return false
+	}
+	if b.since.IsZero() || nodes > b.maxNodes {
+		b.maxNodes = nodes
+		b.since = now
+	}
+	if now.Sub(b.since) < b.StablePeriod {
+		return true
+	}
+	glog.V(0).Infof("The number of nodes has been stable at up to %d for %v, ending the bootstrap hold", b.maxNodes, b.StablePeriod)
+	b.done = true
+	return false
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestBootstrapHold(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &BootstrapHold{StablePeriod: 5 * time.Minute}
+	for i, tc := range []struct {
+		after time.Duration
+		nodes int
+		holds bool
+	}{
+		{0, 1, true},
+		{4 * time.Minute, 3, true},
+		// Fewer nodes don't restart the period.
+		{6 * time.Minute, 2, true},
+		{9*time.Minute - time.Second, 3, true},
+		{9 * time.Minute, 3, false},
+		// Nor does growth once the hold is over.
+		{10 * time.Minute, 10, false},
+	} {
+		if got := b.Holds(tc.nodes, now.Add(tc.after)); got != tc.holds {
+			t.Errorf("[%d] %d nodes after %v: expected holds %v, got %v", i, tc.nodes, tc.after, tc.holds, got)
+		}
+	}
+	if !b.Done() {
+		t.Errorf("expected the hold to be done")
+	}
+}
+
+func TestBootstrapSequence(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "nodesPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 1, NumOfCores: 4}
+	fakeClock := clock.NewFakeClock(time.Now())
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		defaultTarget: "deployment/foo",
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+		deltaScaler:   &DeltaScaler{Threshold: 50},
+		bootstrapHold: &BootstrapHold{StablePeriod: 5 * time.Minute},
+		clock:         fakeClock,
+	}
+	expectCPU := func(step string, milli int64) {
+		t.Helper()
+		cpu := autoScaler.lastReqs["foo"].Requests["cpu"]
+		if cpu.MilliValue() != milli {
+			t.Errorf("%s: expected %dm, got %s", step, milli, cpu.String())
+		}
+	}
+
+	// The cluster grows, and the target stays at the floor.
+	autoScaler.pollAPIServer(context.Background())
+	expectCPU("1 node", 100)
+	for _, nodes := range []int{2, 3} {
+		fakeClock.Step(2 * time.Minute)
+		mockK8s.NumOfNodes = nodes
+		autoScaler.pollAPIServer(context.Background())
+		expectCPU("growing", 100)
+	}
+	fakeClock.Step(4 * time.Minute)
+	autoScaler.pollAPIServer(context.Background())
+	expectCPU("not yet stable", 100)
+
+	// Once stable, the computed value is applied even though the change is
+	// below the delta threshold, and only once.
+	fakeClock.Step(time.Minute)
+	autoScaler.pollAPIServer(context.Background())
+	expectCPU("stable", 130)
+	if len(mockK8s.Updates) != 2 {
+		t.Errorf("expected the floor and the computed value to be applied, got %d updates", len(mockK8s.Updates))
+	}
+	fakeClock.Step(time.Minute)
+	autoScaler.pollAPIServer(context.Background())
+	if len(mockK8s.Updates) != 2 {
+		t.Errorf("expected no more updates, got %d", len(mockK8s.Updates))
+	}
+
+	// From now on, the delta threshold decides again.
+	mockK8s.NumOfNodes = 4
+	autoScaler.pollAPIServer(context.Background())
+	expectCPU("after the hold", 130)
+}
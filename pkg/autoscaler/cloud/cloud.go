@@ -0,0 +1,102 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cloud recognizes the managed Kubernetes services of cloud
+// providers by the labels which they put on nodes.
+package cloud
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// CloudMetadataProvider reads what a cloud provider's managed Kubernetes
+// service records about a node in its labels.
+type CloudMetadataProvider interface {
+	// Name identifies the provider in logs, e.g. "gke".
+	Name() string
+	// NodeGroupLabel is the label whose value names the group of nodes, e.g.
+	// the node pool, which a node belongs to.
+	NodeGroupLabel() string
+}
+
+// GKE is Google Kubernetes Engine, whose nodes are in node pools.
+type GKE struct{}
+
+// Name returns "gke".
+func (GKE) Name() string { return "gke" }
+
+// NodeGroupLabel returns the label of the node pool.
+func (GKE) NodeGroupLabel() string { return "cloud.google.com/gke-nodepool" }
+
+// EKS is Amazon Elastic Kubernetes Service, whose nodes are in managed node
+// groups.
+type EKS struct{}
+
+// Name returns "eks".
+func (EKS) Name() string { return "eks" }
+
+// NodeGroupLabel returns the label of the managed node group.
+func (EKS) NodeGroupLabel() string { return "eks.amazonaws.com/nodegroup" }
+
+// AKS is Azure Kubernetes Service, whose nodes are in agent pools.
+type AKS struct{}
+
+// Name returns "aks".
+func (AKS) Name() string { return "aks" }
+
+// NodeGroupLabel returns the label of the agent pool.
+func (AKS) NodeGroupLabel() string { return "kubernetes.azure.com/agentpool" }
+
+// Providers are the providers which Detect recognizes.
+var Providers = []CloudMetadataProvider{GKE{}, EKS{}, AKS{}}
+
+// Detect returns the provider whose node group label most of the nodes have,
+// or nil if none of them has any.  Ties go to the earlier of Providers.
+func Detect(nodes []apiv1.Node) CloudMetadataProvider {
+	var best CloudMetadataProvider
+	bestCount := 0
+	for _, p := range Providers {
+		count := 0
+		for i := range nodes {
+			if _, found := NodeGroup(p, &nodes[i]); found {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = p, count
+		}
+	}
+	return best
+}
+
+// NodeGroup returns the name of the node's group according to p, and whether
+// the node has one.
+func NodeGroup(p CloudMetadataProvider, node *apiv1.Node) (string, bool) {
+	group, found := node.Labels[p.NodeGroupLabel()]
+	return group, found && group != ""
+}
+
+// CountNodeGroups returns the number of nodes in each group according to p,
+// by the name of the group.  Nodes without a group are left out.
+func CountNodeGroups(p CloudMetadataProvider, nodes []apiv1.Node) map[string]int {
+	groups := map[string]int{}
+	for i := range nodes {
+		if group, found := NodeGroup(p, &nodes[i]); found {
+			groups[group]++
+		}
+	}
+	return groups
+}
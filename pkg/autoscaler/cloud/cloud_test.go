@@ -0,0 +1,71 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func nodeWithLabels(labels map[string]string) apiv1.Node {
+	return apiv1.Node{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+}
+
+func TestDetect(t *testing.T) {
+	gke := nodeWithLabels(map[string]string{"cloud.google.com/gke-nodepool": "default-pool"})
+	eks := nodeWithLabels(map[string]string{"eks.amazonaws.com/nodegroup": "ng-1"})
+	aks := nodeWithLabels(map[string]string{"kubernetes.azure.com/agentpool": "nodepool1"})
+	plain := nodeWithLabels(map[string]string{"kubernetes.io/os": "linux"})
+	unnamed := nodeWithLabels(map[string]string{"eks.amazonaws.com/nodegroup": ""})
+
+	testCases := []struct {
+		name     string
+		nodes    []apiv1.Node
+		expected CloudMetadataProvider
+	}{
+		{"no nodes", nil, nil},
+		{"self-managed", []apiv1.Node{plain, plain}, nil},
+		{"gke", []apiv1.Node{gke, plain}, GKE{}},
+		{"eks", []apiv1.Node{eks}, EKS{}},
+		{"aks", []apiv1.Node{plain, aks}, AKS{}},
+		{"most nodes win", []apiv1.Node{gke, eks, eks}, EKS{}},
+		{"ties go to the first provider", []apiv1.Node{aks, gke}, GKE{}},
+		{"empty groups don't count", []apiv1.Node{unnamed, unnamed, aks}, AKS{}},
+	}
+	for _, tc := range testCases {
+		if got := Detect(tc.nodes); got != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestCountNodeGroups(t *testing.T) {
+	label := GKE{}.NodeGroupLabel()
+	nodes := []apiv1.Node{
+		nodeWithLabels(map[string]string{label: "default-pool"}),
+		nodeWithLabels(map[string]string{label: "gpu-pool"}),
+		nodeWithLabels(map[string]string{label: "default-pool"}),
+		nodeWithLabels(nil),
+	}
+	expected := map[string]int{"default-pool": 2, "gpu-pool": 1}
+	if got := CountNodeGroups(GKE{}, nodes); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ContainerPatch is a strategic merge patch of a container, which is set
+// along with its resources.  Only the fields in allowedPatchFields may be
+// patched, so that a config can't e.g. change the image or the security
+// context, and the values are templates of the cluster size, e.g.
+// "{{.Nodes}}".
+//
+// Example:
+//
+//	"patch": {
+//	  "env": [{"name": "CLUSTER_NODES", "value": "{{.Nodes}}"}]
+//	}
+type ContainerPatch map[string]interface{}
+
+// allowedPatchFields are the container fields which a ContainerPatch may set.
+var allowedPatchFields = []string{"env"}
+
+// patchValues is what the templates in a ContainerPatch are executed with.
+type patchValues struct {
+	Nodes int
+	Cores int
+}
+
+// validate checks that only allowed fields are patched, that every env
+// variable has a valid name, which isn't given twice, and a template value,
+// and that the templates execute.
+func (p ContainerPatch) validate() error {
+	for _, field := range sortedPatchFields(p) {
+		if !isAllowedPatchField(field) {
+			return fmt.Errorf("patch of %q is not allowed, only of %s", field, strings.Join(allowedPatchFields, ", "))
+		}
+	}
+	_, err := p.env(patchValues{})
+	return err
+}
+
+// env returns the env variables of the patch, with their values executed
+// with values.
+func (p ContainerPatch) env(values patchValues) ([]apiv1.EnvVar, error) {
+	raw, found := p["env"]
+	if !found {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("patch of env must be a list")
+	}
+	env := []apiv1.EnvVar{}
+	seen := map[string]bool{}
+	for i, item := range list {
+		v, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("patch of env[%d] must be an object", i)
+		}
+		for field := range v {
+			if field != "name" && field != "value" {
+				return nil, fmt.Errorf("patch of env[%d].%s is not allowed, only of name and value", i, field)
+			}
+		}
+		name, _ := v["name"].(string)
+		if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+			return nil, fmt.Errorf("patch of env[%d]: invalid name %q: %s", i, name, strings.Join(errs, "; "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("patch of env: %s is given twice", name)
+		}
+		seen[name] = true
+		text, ok := v["value"].(string)
+		if !ok {
+			return nil, fmt.Errorf("patch of env %s: value must be a string", name)
+		}
+		value, err := executePatchTemplate(text, values)
+		if err != nil {
+			return nil, fmt.Errorf("patch of env %s: %v", name, err)
+		}
+		env = append(env, apiv1.EnvVar{Name: name, Value: value})
+	}
+	return env, nil
+}
+
+func executePatchTemplate(text string, values patchValues) (string, error) {
+	tmpl, err := template.New("value").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func isAllowedPatchField(field string) bool {
+	for _, f := range allowedPatchFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedPatchFields(p ContainerPatch) []string {
+	fields := []string{}
+	for field := range p {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// DeepCopy returns a copy of the patch which shares nothing with it.
+func (p ContainerPatch) DeepCopy() ContainerPatch {
+	if p == nil {
+		return nil
+	}
+	return ContainerPatch(runtime.DeepCopyJSON(p))
+}
+
+// containerEnv returns the env variables which the patches of the containers
+// set for the cluster size, by container name, or nil if there are none.
+func (sc ScaleConfig) containerEnv(size *k8sclient.ClusterSize) (map[string][]apiv1.EnvVar, error) {
+	var env map[string][]apiv1.EnvVar
+	values := patchValues{Nodes: size.Nodes, Cores: size.Cores}
+	for _, ctr := range sortedConfigNames(sc) {
+		vars, err := sc[ctr].Patch.env(values)
+		if err != nil {
+			return nil, fmt.Errorf("container %q: %v", ctr, err)
+		}
+		if len(vars) == 0 {
+			continue
+		}
+		if env == nil {
+			env = map[string][]apiv1.EnvVar{}
+		}
+		env[ctr] = vars
+	}
+	return env, nil
+}
+
+// envEqual compares two sets of per-container env variables by value.
+func envEqual(a, b map[string][]apiv1.EnvVar) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ctr, vars := range a {
+		other, found := b[ctr]
+		if !found || len(other) != len(vars) {
+			return false
+		}
+		for i := range vars {
+			if vars[i] != other[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestValidateContainerPatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patch    string
+		expError bool
+	}{
+		{"env", `{"env": [{"name": "CLUSTER_NODES", "value": "{{.Nodes}}"}, {"name": "CLUSTER_CORES", "value": "{{.Cores}}"}]}`, false},
+		{"constant", `{"env": [{"name": "MODE", "value": "large"}]}`, false},
+		{"empty", `{}`, false},
+		{"image", `{"image": "evil:latest"}`, true},
+		{"security context", `{"securityContext": {"privileged": true}}`, true},
+		{"resources", `{"resources": {"limits": {"cpu": "100"}}}`, true},
+		{"value from", `{"env": [{"name": "TOKEN", "valueFrom": {"secretKeyRef": {"name": "s", "key": "k"}}}]}`, true},
+		{"env not a list", `{"env": {"name": "X", "value": "1"}}`, true},
+		{"invalid name", `{"env": [{"name": "1X", "value": "1"}]}`, true},
+		{"duplicate name", `{"env": [{"name": "X", "value": "1"}, {"name": "X", "value": "2"}]}`, true},
+		{"value not a string", `{"env": [{"name": "X", "value": 1}]}`, true},
+		{"bad template", `{"env": [{"name": "X", "value": "{{.Nodes"}]}`, true},
+		{"unknown field", `{"env": [{"name": "X", "value": "{{.Pods}}"}]}`, true},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(`{"foo": {"patch": `+tc.patch+`}}`), &cfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tc.name, err)
+		}
+		err := cfg.Validate()
+		if tc.expError && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.expError && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+}
+
+func TestPollContainerPatchEnv(t *testing.T) {
+	cfg := ScaleConfig{}
+	data := `{"foo": {
+		"requests": {"cpu": {"base": "100m", "max": "2", "step": "100m", "nodesPerStep": 4}},
+		"patch": {"env": [{"name": "CLUSTER_NODES", "value": "{{.Nodes}}"}, {"name": "CLUSTER_CORES", "value": "{{.Cores}}"}]}
+	}, "bar": {"requests": {"cpu": {"base": "100m"}}}}`
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 2, NumOfCores: 8}
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		defaultTarget: "deployment/foo",
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+	for i, step := range []struct {
+		nodes, cores int
+		expUpdates   int
+		expEnv       []apiv1.EnvVar
+	}{
+		{2, 8, 1, []apiv1.EnvVar{{Name: "CLUSTER_NODES", Value: "2"}, {Name: "CLUSTER_CORES", Value: "8"}}},
+		// The cpu request doesn't change, but the env does.
+		{3, 12, 2, []apiv1.EnvVar{{Name: "CLUSTER_NODES", Value: "3"}, {Name: "CLUSTER_CORES", Value: "12"}}},
+		// Neither changes.
+		{3, 12, 2, []apiv1.EnvVar{{Name: "CLUSTER_NODES", Value: "3"}, {Name: "CLUSTER_CORES", Value: "12"}}},
+	} {
+		mockK8s.NumOfNodes, mockK8s.NumOfCores = step.nodes, step.cores
+		autoScaler.pollAPIServer(context.Background())
+		if len(mockK8s.Updates) != step.expUpdates {
+			t.Errorf("step %d: expected %d updates, got %d", i, step.expUpdates, len(mockK8s.Updates))
+		}
+		if _, found := mockK8s.Env["bar"]; found {
+			t.Errorf("step %d: expected no env for bar, got %v", i, mockK8s.Env["bar"])
+		}
+		if !envEqual(mockK8s.Env, map[string][]apiv1.EnvVar{"foo": step.expEnv}) {
+			t.Errorf("step %d: expected env %v, got %v", i, step.expEnv, mockK8s.Env["foo"])
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// CPUUnits says in which units a cpu resource is computed and emitted.  The
+// formulas always compute in millicores, so that e.g. a step of "0.5" every
+// 10 nodes means the same in both units; whole cores round the result.
+type CPUUnits string
+
+const (
+	// CPUMillicores emits the computed millicores as they are.  This is the
+	// default.
+	CPUMillicores CPUUnits = "millicores"
+	// CPUCores rounds the computed millicores to whole cores, in the
+	// direction of the resource's Rounding.
+	CPUCores CPUUnits = "cores"
+)
+
+func (u CPUUnits) validate(rcfg ResourceScaleConfig) error {
+	switch u {
+	case "", CPUMillicores:
+		return nil
+	case CPUCores:
+		// Otherwise rounding up could exceed the max.
+		if rcfg.Max != nil && rcfg.Max.MilliValue()%1000 != 0 {
+			return fmt.Errorf("max must be a whole number of cores with cpuUnits %q, got %q", u, rcfg.Max.String())
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown cpuUnits %q, must be %q or %q", string(u), CPUMillicores, CPUCores)
+}
+
+// round returns milli rounded to the units.
+func (u CPUUnits) round(milli int64, rounding RoundingDirection) int64 {
+	if u != CPUCores {
+		return milli
+	}
+	return int64(increments(int(milli), 1000, rounding)) * 1000
+}
+
+// newQuantity returns the computed milli-units of res as a quantity.  Whole
+// cores are formatted as such, e.g. "3" rather than "3000m".
+func newQuantity(res string, rcfg ResourceScaleConfig, milli int64) *resource.Quantity {
+	if rcfg.CPUUnits == CPUCores {
+		return resource.NewQuantity(milli/1000, resource.DecimalSI)
+	}
+	r := resource.NewQuantity(0, guessFormat(res))
+	r.SetMilli(milli)
+	return r
+}
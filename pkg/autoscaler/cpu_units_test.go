@@ -0,0 +1,129 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestCPUUnits(t *testing.T) {
+	// Half a core every 10 nodes.
+	var config = `
+{
+  "fake-agent": {
+    "requests": {
+      "cpu": {
+        "base": "1", "step": "0.5", "max": "%s", "nodesPerStep": 10, "rounding": %q, "cpuUnits": %q
+      }
+    }
+  }
+}
+`
+	for _, tt := range []struct {
+		name     string
+		numNodes int
+		max      string
+		rounding string
+		units    string
+		expQty   string
+	}{
+		{"default is millicores", 30, "0", "", "", "2500m"},
+		{"millicores", 30, "0", "", "millicores", "2500m"},
+		{"millicores, whole", 20, "0", "", "millicores", "2"},
+		{"cores, rounded up", 30, "0", "", "cores", "3"},
+		{"cores, rounded down", 30, "0", "down", "cores", "2"},
+		{"cores, rounded nearest", 30, "0", "nearest", "cores", "3"},
+		{"cores, whole", 20, "0", "", "cores", "2"},
+		{"cores, partial node step rounded up twice", 21, "0", "", "cores", "3"},
+		{"cores, bounded by max", 100, "4", "", "cores", "4"},
+		{"millicores, bounded by fractional max", 100, "4.5", "", "millicores", "4500m"},
+	} {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(fmt.Sprintf(config, tt.max, tt.rounding, tt.units)), &cfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tt.name, err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("%s: invalid config: %v", tt.name, err)
+		}
+		sz, err := (&k8sclient.MockK8sClient{NumOfNodes: tt.numNodes}).GetClusterSize()
+		if err != nil {
+			t.Fatalf("%s: failed to get cluster size", tt.name)
+		}
+		reqs := MultiAxisEvaluator{}.Evaluate("fake-agent", cfg["fake-agent"], sz)
+		qty := reqs.Requests[apiv1.ResourceCPU]
+		if qty.String() != tt.expQty {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expQty, qty.String())
+		}
+		if tt.units == "cores" && qty.MilliValue()%1000 != 0 {
+			t.Errorf("%s: expected whole cores, got %s", tt.name, qty.String())
+		}
+	}
+}
+
+func TestCPUUnitsRelative(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{
+  "main": {"requests": {"cpu": {"base": "3"}}},
+  "sidecar": {"requests": {"cpu": {"relativeTo": {"container": "main", "percent": 25}, "cpuUnits": "cores"}}}
+}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	sz, _ := (&k8sclient.MockK8sClient{NumOfNodes: 1}).GetClusterSize()
+	reqs := map[string]apiv1.ResourceRequirements{}
+	for ctr, ccfg := range cfg {
+		reqs[ctr] = MultiAxisEvaluator{}.Evaluate(ctr, ccfg, sz)
+	}
+	applyRelative(cfg, reqs, nil)
+	if qty := reqs["sidecar"].Requests[apiv1.ResourceCPU]; qty.String() != "1" {
+		t.Errorf("expected 750m to be rounded up to 1 core, got %s", qty.String())
+	}
+}
+
+func TestCPUUnitsValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"cores", `{"a": {"requests": {"cpu": {"base": "1.5", "step": "0.5", "max": "4", "cpuUnits": "cores"}}}}`, ""},
+		{"millicores", `{"a": {"limits": {"cpu": {"max": "4.5", "cpuUnits": "millicores"}}}}`, ""},
+		{"unknown", `{"a": {"requests": {"cpu": {"cpuUnits": "vcpus"}}}}`, `unknown cpuUnits "vcpus"`},
+		{"fractional max", `{"a": {"requests": {"cpu": {"max": "4.5", "cpuUnits": "cores"}}}}`, `max must be a whole number of cores`},
+		{"not cpu", `{"a": {"requests": {"memory": {"cpuUnits": "cores"}}}}`, `cpuUnits only applies to "cpu"`},
+	} {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(tt.config), &cfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tt.name, err)
+		}
+		err := cfg.Validate()
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
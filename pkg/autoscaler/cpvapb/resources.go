@@ -0,0 +1,53 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpvapb
+
+import (
+	"sort"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// ContainerResourcesOf returns the resources of each container, by name, as
+// ContainerResources messages sorted by container name.
+func ContainerResourcesOf(resources map[string]apiv1.ResourceRequirements) []*ContainerResources {
+	ctrs := []string{}
+	for ctr := range resources {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	msgs := []*ContainerResources{}
+	for _, ctr := range ctrs {
+		msgs = append(msgs, &ContainerResources{
+			Name:     ctr,
+			Requests: quantities(resources[ctr].Requests),
+			Limits:   quantities(resources[ctr].Limits),
+		})
+	}
+	return msgs
+}
+
+func quantities(list apiv1.ResourceList) map[string]string {
+	if len(list) == 0 {
+		return nil
+	}
+	m := map[string]string{}
+	for name, q := range list {
+		m[string(name)] = q.String()
+	}
+	return m
+}
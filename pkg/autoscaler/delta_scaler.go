@@ -0,0 +1,136 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"math"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// ClusterSizeChange describes how the cluster changed between two
+// observations.
+type ClusterSizeChange struct {
+	Previous *k8sclient.ClusterSize
+	Current  *k8sclient.ClusterSize
+	// Delta is Current.Nodes - Previous.Nodes.
+	Delta int
+	// CoresDelta is Current.Cores - Previous.Cores.
+	CoresDelta int
+}
+
+// NewClusterSizeChange returns the change from previous to current.  If
+// previous is nil, the whole current cluster counts as the change.
+func NewClusterSizeChange(previous, current *k8sclient.ClusterSize) ClusterSizeChange {
+	delta, coresDelta := current.Nodes, current.Cores
+	if previous != nil {
+		delta = current.Nodes - previous.Nodes
+		coresDelta = current.Cores - previous.Cores
+	}
+	return ClusterSizeChange{
+		Previous:   previous,
+		Current:    current,
+		Delta:      delta,
+		CoresDelta: coresDelta,
+	}
+}
+
+// DeltaScaler decides whether a change in cluster size is large enough to
+// warrant adjusting resources.
+type DeltaScaler struct {
+	// Threshold is the number of nodes by which the cluster must grow or
+	// shrink, relative to the last evaluation, before resources are
+	// evaluated again.  This avoids flapping when the node count hovers
+	// around a step or ladder boundary.
+	Threshold int
+	// CoresThreshold, if not 0, is the fraction of the previous number of
+	// cores, e.g. 0.1, by which the cores must change for resources to be
+	// evaluated again even if the number of nodes changed by less than
+	// Threshold, e.g. when nodes are resized in place.
+	CoresThreshold float64
+	// ScaleOn is the metric which the steps count instead of the nodes, as
+	// in --scale-on.  Any change in it counts, unless it is the cores and
+	// CoresThreshold is set.
+	ScaleOn k8sclient.ScaleMetric
+}
+
+// ShouldScale returns true if the cluster changed by at least Threshold nodes,
+// or, with a CoresThreshold, by at least that fraction of its cores.  The
+// first observation (no Previous) always does, and so does any change in the
+// pod counts, the CPU utilization, the custom metric or the ScaleOn metric,
+// which are not tied to the number of nodes.  If the number of nodes didn't
+// change, any other change does too, e.g. in the cores or memory of nodes
+// resized in place, or in the nodes of each group or pool.
+func (d *DeltaScaler) ShouldScale(change ClusterSizeChange) bool {
+	if change.Previous == nil {
+		return true
+	}
+	if change.Current.MatchingPods != change.Previous.MatchingPods ||
+		change.Current.PendingPods != change.Previous.PendingPods ||
+		change.Current.CPUUtilization != change.Previous.CPUUtilization ||
+		change.Current.CustomMetric != change.Previous.CustomMetric {
+		return true
+	}
+	if d.scaleOnChanged(change) {
+		return true
+	}
+	if d.coresChanged(change) {
+		return true
+	}
+	delta := change.Delta
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta == 0 {
+		current := *change.Current
+		if d.CoresThreshold > 0 {
+			// The cores only count once they changed by CoresThreshold.
+			current.Cores = change.Previous.Cores
+			current.AverageNodeCores = change.Previous.AverageNodeCores
+			current.CPUAllocatable = change.Previous.CPUAllocatable
+		}
+		return !current.Equal(change.Previous)
+	}
+	return delta >= d.Threshold
+}
+
+// scaleOnChanged returns whether the ScaleOn metric changed.  Changes in the
+// nodes count against Threshold, and in the cores against CoresThreshold if
+// it is set.
+func (d *DeltaScaler) scaleOnChanged(change ClusterSizeChange) bool {
+	switch d.ScaleOn.Kind {
+	case "", k8sclient.ScaleOnNodes:
+		return false
+	case k8sclient.ScaleOnCores:
+		if d.CoresThreshold > 0 {
+			return false
+		}
+	}
+	return change.Current.Count(d.ScaleOn) != change.Previous.Count(d.ScaleOn)
+}
+
+// coresChanged returns whether the cores changed by at least CoresThreshold.
+// Any cores count as a change from none.
+func (d *DeltaScaler) coresChanged(change ClusterSizeChange) bool {
+	if d.CoresThreshold <= 0 || change.CoresDelta == 0 {
+		return false
+	}
+	if change.Previous.Cores == 0 {
+		return true
+	}
+	return math.Abs(float64(change.CoresDelta))/float64(change.Previous.Cores) >= d.CoresThreshold
+}
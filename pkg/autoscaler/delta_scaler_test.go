@@ -0,0 +1,110 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"testing"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDeltaScaler(t *testing.T) {
+	ds := &DeltaScaler{Threshold: 3}
+	for _, tt := range []struct {
+		name     string
+		previous *k8sclient.ClusterSize
+		current  *k8sclient.ClusterSize
+		expDelta int
+		expScale bool
+	}{
+		{"first observation", nil, &k8sclient.ClusterSize{Nodes: 1}, 1, true},
+		{"no change", &k8sclient.ClusterSize{Nodes: 5}, &k8sclient.ClusterSize{Nodes: 5}, 0, false},
+		{"small growth", &k8sclient.ClusterSize{Nodes: 5}, &k8sclient.ClusterSize{Nodes: 7}, 2, false},
+		{"growth at threshold", &k8sclient.ClusterSize{Nodes: 5}, &k8sclient.ClusterSize{Nodes: 8}, 3, true},
+		{"small shrink", &k8sclient.ClusterSize{Nodes: 5}, &k8sclient.ClusterSize{Nodes: 3}, -2, false},
+		{"large shrink", &k8sclient.ClusterSize{Nodes: 10}, &k8sclient.ClusterSize{Nodes: 3}, -7, true},
+		{"pods changed", &k8sclient.ClusterSize{Nodes: 5, MatchingPods: 2}, &k8sclient.ClusterSize{Nodes: 5, MatchingPods: 3}, 0, true},
+		{"pending pods changed", &k8sclient.ClusterSize{Nodes: 5}, &k8sclient.ClusterSize{Nodes: 5, PendingPods: 1}, 0, true},
+		{"cpu utilization changed", &k8sclient.ClusterSize{Nodes: 5, CPUUtilization: 40}, &k8sclient.ClusterSize{Nodes: 5, CPUUtilization: 41}, 0, true},
+		{"cores changed in place", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 5, Cores: 40}, 0, true},
+		{"cores changed with a small growth", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 6, Cores: 24}, 1, false},
+		{"nodes tainted", &k8sclient.ClusterSize{Nodes: 5, MainPoolNodes: 5}, &k8sclient.ClusterSize{Nodes: 5, MainPoolNodes: 3, TaintedPoolNodes: 2}, 0, true},
+		{"node groups changed", &k8sclient.ClusterSize{Nodes: 5, NodeGroups: map[string]int{"a": 5}}, &k8sclient.ClusterSize{Nodes: 5, NodeGroups: map[string]int{"a": 4, "b": 1}}, 0, true},
+	} {
+		change := NewClusterSizeChange(tt.previous, tt.current)
+		if change.Delta != tt.expDelta {
+			t.Errorf("%s: expected delta %d got %d", tt.name, tt.expDelta, change.Delta)
+		}
+		if scale := ds.ShouldScale(change); scale != tt.expScale {
+			t.Errorf("%s: expected %v got %v", tt.name, tt.expScale, scale)
+		}
+	}
+}
+
+func TestDeltaScalerCoresThreshold(t *testing.T) {
+	// The nodes are resized in place: their number stays the same while
+	// their cores change.
+	ds := &DeltaScaler{Threshold: 3, CoresThreshold: 0.1}
+	for _, tt := range []struct {
+		name     string
+		previous *k8sclient.ClusterSize
+		current  *k8sclient.ClusterSize
+		expScale bool
+	}{
+		{"no change", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, false},
+		{"small growth", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 5, Cores: 21}, false},
+		{"growth at threshold", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 5, Cores: 22}, true},
+		{"nodes doubled in place", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 5, Cores: 40}, true},
+		{"small shrink", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 5, Cores: 19}, false},
+		{"large shrink", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 5, Cores: 10}, true},
+		{"from no cores", &k8sclient.ClusterSize{Nodes: 5}, &k8sclient.ClusterSize{Nodes: 5, Cores: 1}, true},
+		{"nodes still count", &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 8, Cores: 20}, true},
+	} {
+		change := NewClusterSizeChange(tt.previous, tt.current)
+		if scale := ds.ShouldScale(change); scale != tt.expScale {
+			t.Errorf("%s: expected %v got %v", tt.name, tt.expScale, scale)
+		}
+	}
+}
+
+func TestDeltaScalerMetrics(t *testing.T) {
+	// Only the metric changes, along with fewer nodes than the threshold.
+	for _, tt := range []struct {
+		name     string
+		scaleOn  k8sclient.ScaleMetric
+		previous *k8sclient.ClusterSize
+		current  *k8sclient.ClusterSize
+		expScale bool
+	}{
+		{"gpus in place", k8sclient.ScaleMetric{}, &k8sclient.ClusterSize{Nodes: 5, GPUs: 4}, &k8sclient.ClusterSize{Nodes: 5, GPUs: 8}, true},
+		{"memory in place", k8sclient.ScaleMetric{}, &k8sclient.ClusterSize{Nodes: 5, Memory: resource.MustParse("20Gi")}, &k8sclient.ClusterSize{Nodes: 5, Memory: resource.MustParse("40Gi")}, true},
+		{"gpus with a node", k8sclient.ScaleMetric{}, &k8sclient.ClusterSize{Nodes: 5, GPUs: 4}, &k8sclient.ClusterSize{Nodes: 6, GPUs: 8}, false},
+		{"scaled on gpus", k8sclient.ScaleMetric{Kind: k8sclient.ScaleOnGPUs}, &k8sclient.ClusterSize{Nodes: 5, GPUs: 4}, &k8sclient.ClusterSize{Nodes: 6, GPUs: 8}, true},
+		{"scaled on memory", k8sclient.ScaleMetric{Kind: k8sclient.ScaleOnMemory}, &k8sclient.ClusterSize{Nodes: 5, Memory: resource.MustParse("20Gi")}, &k8sclient.ClusterSize{Nodes: 6, Memory: resource.MustParse("24Gi")}, true},
+		{"scaled on cores", k8sclient.ScaleMetric{Kind: k8sclient.ScaleOnCores}, &k8sclient.ClusterSize{Nodes: 5, Cores: 20}, &k8sclient.ClusterSize{Nodes: 6, Cores: 24}, true},
+		{"custom metric", k8sclient.ScaleMetric{}, &k8sclient.ClusterSize{Nodes: 5, CustomMetric: 100}, &k8sclient.ClusterSize{Nodes: 6, CustomMetric: 120}, true},
+		{"scaled on a custom metric", k8sclient.ScaleMetric{Kind: k8sclient.ScaleOnCustom, Name: "queue"}, &k8sclient.ClusterSize{Nodes: 5, CustomMetric: 100}, &k8sclient.ClusterSize{Nodes: 5, CustomMetric: 120}, true},
+		{"no change", k8sclient.ScaleMetric{Kind: k8sclient.ScaleOnGPUs}, &k8sclient.ClusterSize{Nodes: 5, GPUs: 4}, &k8sclient.ClusterSize{Nodes: 5, GPUs: 4}, false},
+	} {
+		ds := &DeltaScaler{Threshold: 3, ScaleOn: tt.scaleOn}
+		change := NewClusterSizeChange(tt.previous, tt.current)
+		if scale := ds.ShouldScale(change); scale != tt.expScale {
+			t.Errorf("%s: expected %v got %v", tt.name, tt.expScale, scale)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package e2e holds benchmarks of the k8sclient against a real API server, to
+// catch regressions when the patch path changes, e.g. from strategic merge to
+// server-side apply.  They are only built with the e2e tag, and start their
+// own etcd and API server, as envtest does, from the binaries which
+// $TEST_ASSET_ETCD and $TEST_ASSET_KUBE_APISERVER name.  The API server must
+// still have --insecure-port, i.e. be 1.19 or older:
+//
+//	ASSETS=$(setup-envtest use -p path 1.19.x)
+//	TEST_ASSET_ETCD=$ASSETS/etcd TEST_ASSET_KUBE_APISERVER=$ASSETS/kube-apiserver make bench-e2e
+//
+// BenchmarkUpdateResources reports the P50, P95 and P99 latency of
+// UpdateResources.  If $CPVPA_E2E_BASELINE names a JSON file of the same
+// metrics, e.g. {"p50-ms": 8, "p95-ms": 20, "p99-ms": 35}, the benchmark
+// fails if any of them is more than 20% above its baseline.  The control
+// plane is stopped when the benchmarks are done.
+package e2e
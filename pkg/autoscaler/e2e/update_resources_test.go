@@ -0,0 +1,256 @@
+//go:build e2e
+// +build e2e
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/testing_frameworks/integration"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+const (
+	// Where the control plane's binaries are, e.g. from setup-envtest.
+	apiServerEnv = "TEST_ASSET_KUBE_APISERVER"
+	etcdEnv      = "TEST_ASSET_ETCD"
+	baselineEnv  = "CPVPA_E2E_BASELINE"
+	// How many Deployments the API server holds, and how many of them are
+	// updated at once.
+	deployments = 1000
+	concurrency = 100
+	// How much slower than the baseline a latency may be.
+	tolerance = 1.2
+)
+
+// setup starts a local API server with a namespace of Deployments.  It
+// returns a kubeconfig for the API server, the namespace, and a func which
+// stops the API server.
+func setup(b *testing.B) (kubeconfig, namespace string, teardown func()) {
+	b.Helper()
+	for _, env := range []string{apiServerEnv, etcdEnv} {
+		if os.Getenv(env) == "" {
+			b.Skipf("$%s is not set", env)
+		}
+	}
+	dir, err := ioutil.TempDir("", "cpva-e2e")
+	if err != nil {
+		b.Fatal(err)
+	}
+	controlPlane := &integration.ControlPlane{}
+	teardown = func() {
+		if err := controlPlane.Stop(); err != nil {
+			b.Errorf("can't stop the control plane: %v", err)
+		}
+		os.RemoveAll(dir)
+	}
+	if err := controlPlane.Start(); err != nil {
+		teardown()
+		b.Fatalf("can't start the control plane: %v", err)
+	}
+	kubeconfig, err = writeKubeconfig(dir, controlPlane.APIURL().String())
+	if err != nil {
+		teardown()
+		b.Fatalf("can't write kubeconfig: %v", err)
+	}
+
+	// Creating the Deployments shouldn't be throttled.
+	client := kubernetes.NewForConfigOrDie(&rest.Config{Host: controlPlane.APIURL().String(), QPS: 1000, Burst: 1000})
+	ns, err := client.CoreV1().Namespaces().Create(&apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "cpva-e2e-"},
+	})
+	if err != nil {
+		teardown()
+		b.Fatalf("can't create namespace: %v", err)
+	}
+
+	names := make(chan string)
+	errs := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				if err := createDeployment(client, ns.Name, name); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < deployments; i++ {
+		names <- deploymentName(i)
+	}
+	close(names)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		teardown()
+		b.Fatalf("can't create deployment: %v", err)
+	}
+	return kubeconfig, ns.Name, teardown
+}
+
+// writeKubeconfig writes a kubeconfig for the API server at host into dir,
+// and returns its path.
+func writeKubeconfig(dir, host string) (string, error) {
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	config := clientcmdapi.NewConfig()
+	config.Clusters["e2e"] = &clientcmdapi.Cluster{Server: host}
+	config.Contexts["e2e"] = &clientcmdapi.Context{Cluster: "e2e"}
+	config.CurrentContext = "e2e"
+	return kubeconfig, clientcmd.WriteToFile(*config, kubeconfig)
+}
+
+func deploymentName(i int) string {
+	return fmt.Sprintf("bench-%04d", i)
+}
+
+func createDeployment(client kubernetes.Interface, namespace, name string) error {
+	_, err := client.AppsV1().Deployments(namespace).Create(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{Name: "app", Image: "k8s.gcr.io/pause:3.1"}},
+				},
+			},
+		},
+	})
+	return err
+}
+
+// percentile returns the p-th percentile of the sorted latencies, by the
+// nearest rank.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// checkBaseline fails the benchmark if a metric is above its baseline, if
+// one is given.
+func checkBaseline(b *testing.B, metrics map[string]float64) {
+	b.Helper()
+	file := os.Getenv(baselineEnv)
+	if file == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		b.Fatalf("can't read $%s: %v", baselineEnv, err)
+	}
+	baseline := map[string]float64{}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		b.Fatalf("invalid $%s: %v", baselineEnv, err)
+	}
+	for unit, want := range baseline {
+		got, found := metrics[unit]
+		if !found {
+			b.Errorf("baseline of unknown metric %q", unit)
+			continue
+		}
+		if got > want*tolerance {
+			b.Errorf("%s is %.2f, more than %.0f%% above its baseline of %.2f", unit, got, (tolerance-1)*100, want)
+		}
+	}
+}
+
+// BenchmarkUpdateResources updates concurrency of the Deployments at once, b.N
+// times, each to a new cpu request.
+func BenchmarkUpdateResources(b *testing.B) {
+	kubeconfig, namespace, teardown := setup(b)
+	defer teardown()
+	// One client per target, spread over the Deployments.
+	clients := make([]k8sclient.K8sClient, concurrency)
+	for i := range clients {
+		target := "deployment/" + deploymentName(i*deployments/concurrency)
+		client, err := k8sclient.NewK8sClient(context.Background(), namespace, target, kubeconfig, k8sclient.Options{})
+		if err != nil {
+			b.Fatalf("can't create client for %s: %v", target, err)
+		}
+		clients[i] = client
+	}
+
+	latencies := make([]time.Duration, 0, b.N*concurrency)
+	var mu sync.Mutex
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		resources := map[string]apiv1.ResourceRequirements{
+			"app": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: *resource.NewMilliQuantity(int64(100+n), resource.DecimalSI)}},
+		}
+		var wg sync.WaitGroup
+		for _, client := range clients {
+			wg.Add(1)
+			go func(client k8sclient.K8sClient) {
+				defer wg.Done()
+				start := time.Now()
+				err := client.UpdateResources(resources)
+				elapsed := time.Since(start)
+				if err != nil {
+					b.Errorf("can't update resources: %v", err)
+					return
+				}
+				mu.Lock()
+				latencies = append(latencies, elapsed)
+				mu.Unlock()
+			}(client)
+		}
+		wg.Wait()
+	}
+	b.StopTimer()
+	if len(latencies) == 0 {
+		return
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	metrics := map[string]float64{}
+	for _, p := range []float64{50, 95, 99} {
+		unit := fmt.Sprintf("p%.0f-ms", p)
+		metrics[unit] = float64(percentile(latencies, p)) / float64(time.Millisecond)
+		b.ReportMetric(metrics[unit], unit)
+	}
+	checkBaseline(b, metrics)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporters
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+var _ = DroppingExporter(&AsyncExporter{})
+
+// asyncQueueSize is how many snapshots can wait to be exported.  A snapshot
+// only matters until the next one, so a few are enough to ride out a slow
+// request.
+const asyncQueueSize = 10
+
+// DroppingExporter is an exporter which may drop snapshots, e.g. while its
+// system is slow, rather than hold up scaling.
+type DroppingExporter interface {
+	MetricsExporter
+	// Dropped returns the number of snapshots which were dropped since
+	// startup.
+	Dropped() int
+}
+
+// AsyncExporter exports the snapshots of another exporter in the
+// background, so that an exporter which makes slow requests, e.g. to a cloud
+// API, doesn't hold up scaling.  Meanwhile snapshots wait in a bounded queue,
+// and are dropped once it is full.
+type AsyncExporter struct {
+	exp     MetricsExporter
+	queue   chan *Metrics
+	stop    chan struct{}
+	done    chan struct{}
+	dropped int64
+}
+
+// NewAsyncExporter returns an exporter which exports to exp in the
+// background.
+func NewAsyncExporter(exp MetricsExporter) *AsyncExporter {
+	a := newAsyncExporter(exp, asyncQueueSize)
+	go a.run()
+	return a
+}
+
+// newAsyncExporter returns an exporter which doesn't export its snapshots
+// yet.
+func newAsyncExporter(exp MetricsExporter, size int) *AsyncExporter {
+	return &AsyncExporter{
+		exp:   exp,
+		queue: make(chan *Metrics, size),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Name returns the name of the wrapped exporter.
+func (a *AsyncExporter) Name() string {
+	return a.exp.Name()
+}
+
+// Export queues one snapshot to be exported.  m must not be changed
+// afterwards.  If the queue is full, the snapshot is dropped and an error
+// returned.
+func (a *AsyncExporter) Export(m *Metrics) error {
+	select {
+	case a.queue <- m:
+		return nil
+	default:
+		atomic.AddInt64(&a.dropped, 1)
+		return fmt.Errorf("dropped the snapshot, %d snapshots are already waiting", cap(a.queue))
+	}
+}
+
+// Dropped returns the number of snapshots which were dropped since startup.
+func (a *AsyncExporter) Dropped() int {
+	return int(atomic.LoadInt64(&a.dropped))
+}
+
+// Close exports the snapshots which are still queued, and returns once they
+// are.
+func (a *AsyncExporter) Close() error {
+	close(a.stop)
+	<-a.done
+	return nil
+}
+
+// run exports the queued snapshots until the exporter is closed.
+func (a *AsyncExporter) run() {
+	defer close(a.done)
+	for {
+		select {
+		case m := <-a.queue:
+			a.export(m)
+		case <-a.stop:
+			for {
+				select {
+				case m := <-a.queue:
+					a.export(m)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *AsyncExporter) export(m *Metrics) {
+	if err := a.exp.Export(m); err != nil {
+		glog.Errorf("Failed to export metrics to %s: %v", a.exp.Name(), err)
+	}
+}
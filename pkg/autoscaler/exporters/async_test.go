@@ -0,0 +1,93 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporters
+
+import (
+	"errors"
+	"testing"
+)
+
+// blockingExporter records the snapshots which it exports, once it is
+// released.
+type blockingExporter struct {
+	release  chan struct{}
+	exported []*Metrics
+}
+
+func (e *blockingExporter) Name() string {
+	return "blocking"
+}
+
+func (e *blockingExporter) Export(m *Metrics) error {
+	<-e.release
+	e.exported = append(e.exported, m)
+	return errors.New("recorded")
+}
+
+func TestAsyncExporter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		snapshots  int
+		expDropped int
+	}{
+		{"none", 0, 0},
+		{"queued", 2, 0},
+		{"full", 5, 3},
+	}
+	for _, tc := range testCases {
+		inner := &blockingExporter{release: make(chan struct{})}
+		a := newAsyncExporter(inner, 2)
+		var snapshots []*Metrics
+		for i := 0; i < tc.snapshots; i++ {
+			m := &Metrics{ClusterNodes: i}
+			if err := a.Export(m); err == nil {
+				snapshots = append(snapshots, m)
+			}
+		}
+		if n := a.Dropped(); n != tc.expDropped {
+			t.Errorf("%s: expected %d dropped snapshots, got %d", tc.name, tc.expDropped, n)
+		}
+		// Nothing is exported before run, which Close waits for.
+		go a.run()
+		close(inner.release)
+		if err := a.Close(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if len(inner.exported) != len(snapshots) {
+			t.Fatalf("%s: expected %d exported snapshots, got %d", tc.name, len(snapshots), len(inner.exported))
+		}
+		for i := range snapshots {
+			if inner.exported[i] != snapshots[i] {
+				t.Errorf("%s: snapshot %d: expected nodes %d, got %d", tc.name, i, snapshots[i].ClusterNodes, inner.exported[i].ClusterNodes)
+			}
+		}
+	}
+}
+
+func TestAsyncExporterDoesNotBlock(t *testing.T) {
+	inner := &blockingExporter{release: make(chan struct{})}
+	a := NewAsyncExporter(inner)
+	// The first snapshot holds up run, and the rest fill the queue.
+	for i := 0; i < asyncQueueSize+2; i++ {
+		a.Export(&Metrics{ClusterNodes: i})
+	}
+	if n := a.Dropped(); n < 1 {
+		t.Errorf("expected snapshots to be dropped, got %d", n)
+	}
+	close(inner.release)
+	a.Close()
+}
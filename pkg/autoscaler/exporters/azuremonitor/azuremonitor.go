@@ -0,0 +1,230 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package azuremonitor publishes autoscaler metrics as Azure Monitor custom
+// metrics, authenticating with the managed service identity (MSI) of the VM.
+package azuremonitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+)
+
+var _ = exporters.MetricsExporter(&AzureMonitorExporter{})
+
+const (
+	// The metric namespace of everything we publish.
+	metricNamespace = "CPVPA"
+	// The audience of the tokens for the custom metrics API.
+	monitoringResource = "https://monitoring.azure.com/"
+	// The instance metadata service, which hands out MSI tokens.
+	defaultMetadataEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// AzureMonitorExporter publishes ClusterNodes, ClusterCores, CpuRequest and
+// MemoryRequest against an Azure resource, usually the AKS cluster.  The
+// request metrics carry a Container dimension.
+type AzureMonitorExporter struct {
+	resourceID       string
+	region           string
+	ingestEndpoint   string
+	metadataEndpoint string
+	client           *http.Client
+	now              func() time.Time
+
+	lock        sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewAzureMonitorExporter returns an exporter which publishes metrics for the
+// given resource ID, in the given region.
+func NewAzureMonitorExporter(resourceID, region string) (*AzureMonitorExporter, error) {
+	if !strings.HasPrefix(resourceID, "/subscriptions/") {
+		return nil, fmt.Errorf("invalid Azure resource ID %q", resourceID)
+	}
+	if region == "" {
+		return nil, fmt.Errorf("Azure region must be set")
+	}
+	return &AzureMonitorExporter{
+		resourceID:       resourceID,
+		region:           region,
+		ingestEndpoint:   fmt.Sprintf("https://%s.monitoring.azure.com", region),
+		metadataEndpoint: defaultMetadataEndpoint,
+		client:           &http.Client{Timeout: 10 * time.Second},
+		now:              time.Now,
+	}, nil
+}
+
+// Name returns the name of the exporter.
+func (e *AzureMonitorExporter) Name() string {
+	return "azuremonitor"
+}
+
+// customMetric is the body of a custom metrics API request.
+type customMetric struct {
+	Time string `json:"time"`
+	Data struct {
+		BaseData struct {
+			Metric    string   `json:"metric"`
+			Namespace string   `json:"namespace"`
+			DimNames  []string `json:"dimNames,omitempty"`
+			Series    []series `json:"series"`
+		} `json:"baseData"`
+	} `json:"data"`
+}
+
+type series struct {
+	DimValues []string `json:"dimValues,omitempty"`
+	Min       float64  `json:"min"`
+	Max       float64  `json:"max"`
+	Sum       float64  `json:"sum"`
+	Count     int      `json:"count"`
+}
+
+func gauge(dimValues []string, v float64) series {
+	return series{DimValues: dimValues, Min: v, Max: v, Sum: v, Count: 1}
+}
+
+// Export publishes one snapshot.
+func (e *AzureMonitorExporter) Export(m *exporters.Metrics) error {
+	ts := m.Timestamp
+	if ts.IsZero() {
+		ts = e.now()
+	}
+
+	ctrs := []string{}
+	for ctr := range m.Requests {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	cpu := []series{}
+	mem := []series{}
+	for _, ctr := range ctrs {
+		if q, found := m.Requests[ctr][apiv1.ResourceCPU]; found {
+			cpu = append(cpu, gauge([]string{ctr}, float64(q.MilliValue())/1000))
+		}
+		if q, found := m.Requests[ctr][apiv1.ResourceMemory]; found {
+			mem = append(mem, gauge([]string{ctr}, float64(q.Value())))
+		}
+	}
+
+	for _, metric := range []struct {
+		name     string
+		dimNames []string
+		series   []series
+	}{
+		{"ClusterNodes", nil, []series{gauge(nil, float64(m.ClusterNodes))}},
+		{"ClusterCores", nil, []series{gauge(nil, float64(m.ClusterCores))}},
+		{"CpuRequest", []string{"Container"}, cpu},
+		{"MemoryRequest", []string{"Container"}, mem},
+	} {
+		if len(metric.series) == 0 {
+			continue
+		}
+		cm := customMetric{Time: ts.UTC().Format(time.RFC3339)}
+		cm.Data.BaseData.Metric = metric.name
+		cm.Data.BaseData.Namespace = metricNamespace
+		cm.Data.BaseData.DimNames = metric.dimNames
+		cm.Data.BaseData.Series = metric.series
+		if err := e.post(&cm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *AzureMonitorExporter) post(cm *customMetric) error {
+	token, err := e.getToken()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(cm)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.ingestEndpoint+e.resourceID+"/metrics", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting metric %s failed: %v", cm.Data.BaseData.Metric, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("posting metric %s failed: %s: %s", cm.Data.BaseData.Metric, resp.Status, msg)
+	}
+	return nil
+}
+
+// getToken returns a cached MSI token, fetching a new one if it is about to
+// expire.
+func (e *AzureMonitorExporter) getToken() (string, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.token != "" && e.now().Add(time.Minute).Before(e.tokenExpiry) {
+		return e.token, nil
+	}
+
+	q := url.Values{}
+	q.Set("api-version", "2018-02-01")
+	q.Set("resource", monitoringResource)
+	req, err := http.NewRequest("GET", e.metadataEndpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("can't get MSI token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("can't get MSI token: %s: %s", resp.Status, msg)
+	}
+	tok := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("can't decode MSI token: %v", err)
+	}
+	expiresOn, err := strconv.ParseInt(tok.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid MSI token expiry %q", tok.ExpiresOn)
+	}
+	e.token = tok.AccessToken
+	e.tokenExpiry = time.Unix(expiresOn, 0)
+	return e.token, nil
+}
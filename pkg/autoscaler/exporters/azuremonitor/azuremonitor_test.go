@@ -0,0 +1,102 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuremonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+)
+
+func TestExport(t *testing.T) {
+	const resourceID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerService/managedClusters/thing"
+	now := time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC)
+	tokenRequests := 0
+	metrics := map[string]customMetric{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/token":
+			tokenRequests++
+			if req.Header.Get("Metadata") != "true" || req.URL.Query().Get("resource") != monitoringResource {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token": "tok", "expires_on": "%d"}`, now.Add(time.Hour).Unix())
+		case resourceID + "/metrics":
+			if req.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			cm := customMetric{}
+			if err := json.NewDecoder(req.Body).Decode(&cm); err != nil {
+				t.Fatalf("unexpected decoding error: %v", err)
+			}
+			metrics[cm.Data.BaseData.Metric] = cm
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	exp, err := NewAzureMonitorExporter(resourceID, "westeurope")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp.ingestEndpoint = server.URL
+	exp.metadataEndpoint = server.URL + "/token"
+	exp.now = func() time.Time { return now }
+
+	m := &exporters.Metrics{
+		Timestamp:    now,
+		ClusterNodes: 4,
+		ClusterCores: 16,
+		Requests: map[string]apiv1.ResourceList{
+			"thing": {apiv1.ResourceCPU: resource.MustParse("250m")},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if err := exp.Export(m); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if tokenRequests != 1 {
+		t.Errorf("expected the token to be cached, got %d token requests", tokenRequests)
+	}
+	if len(metrics) != 3 {
+		t.Errorf("expected 3 metrics, got %v", metrics)
+	}
+	if s := metrics["ClusterNodes"].Data.BaseData.Series; len(s) != 1 || s[0].Sum != 4 {
+		t.Errorf("unexpected ClusterNodes series: %v", s)
+	}
+	cpu := metrics["CpuRequest"].Data.BaseData
+	if len(cpu.DimNames) != 1 || cpu.DimNames[0] != "Container" ||
+		len(cpu.Series) != 1 || cpu.Series[0].DimValues[0] != "thing" || cpu.Series[0].Max != 0.25 {
+		t.Errorf("unexpected CpuRequest: %+v", cpu)
+	}
+	if metrics["ClusterCores"].Time != "2017-07-14T00:00:00Z" {
+		t.Errorf("unexpected time: %q", metrics["ClusterCores"].Time)
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cloudwatch publishes autoscaler metrics as AWS CloudWatch custom
+// metrics, via the PutMetricData API.
+package cloudwatch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/auth"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+)
+
+var _ = exporters.MetricsExporter(&CloudWatchExporter{})
+
+// PutMetricData accepts at most this many metrics per call.
+const maxMetricsPerCall = 20
+
+// CloudWatchExporter publishes ClusterNodes, ClusterCores, CpuRequest and
+// MemoryRequest.  The request metrics carry a Container dimension.
+//
+// Requests are signed with the credentials from an auth.AwsCredentialSource,
+// e.g. those of the pod's IAM role with IRSA.
+type CloudWatchExporter struct {
+	namespace   string
+	region      string
+	dimensions  map[string]string
+	endpoint    string
+	credentials auth.AwsCredentialSource
+	client      *http.Client
+	now         func() time.Time
+}
+
+// NewCloudWatchExporter returns an exporter which publishes into the given
+// CloudWatch namespace and region, with credentials.  The dimensions are added
+// to every metric.
+func NewCloudWatchExporter(namespace, region string, dimensions map[string]string, credentials auth.AwsCredentialSource) (*CloudWatchExporter, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("CloudWatch namespace must be set")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("CloudWatch region must be set")
+	}
+	return &CloudWatchExporter{
+		namespace:   namespace,
+		region:      region,
+		dimensions:  dimensions,
+		endpoint:    fmt.Sprintf("https://monitoring.%s.amazonaws.com/", region),
+		credentials: credentials,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		now:         time.Now,
+	}, nil
+}
+
+// ParseDimensions parses a comma-separated list of name=value pairs.
+func ParseDimensions(s string) (map[string]string, error) {
+	dims := map[string]string{}
+	if s == "" {
+		return dims, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid dimension %q, must be name=value", kv)
+		}
+		dims[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return dims, nil
+}
+
+// Name returns the name of the exporter.
+func (e *CloudWatchExporter) Name() string {
+	return "cloudwatch"
+}
+
+type datum struct {
+	name       string
+	value      float64
+	unit       string
+	dimensions map[string]string
+}
+
+// Export publishes one snapshot.
+func (e *CloudWatchExporter) Export(m *exporters.Metrics) error {
+	data := []datum{
+		{name: "ClusterNodes", value: float64(m.ClusterNodes), unit: "Count"},
+		{name: "ClusterCores", value: float64(m.ClusterCores), unit: "Count"},
+	}
+	ctrs := []string{}
+	for ctr := range m.Requests {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	for _, ctr := range ctrs {
+		dims := map[string]string{"Container": ctr}
+		if q, found := m.Requests[ctr][apiv1.ResourceCPU]; found {
+			data = append(data, datum{name: "CpuRequest", value: float64(q.MilliValue()) / 1000, unit: "None", dimensions: dims})
+		}
+		if q, found := m.Requests[ctr][apiv1.ResourceMemory]; found {
+			data = append(data, datum{name: "MemoryRequest", value: float64(q.Value()), unit: "Bytes", dimensions: dims})
+		}
+	}
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxMetricsPerCall {
+			n = maxMetricsPerCall
+		}
+		if err := e.put(m.Timestamp, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (e *CloudWatchExporter) put(ts time.Time, data []datum) error {
+	params := url.Values{}
+	params.Set("Action", "PutMetricData")
+	params.Set("Version", "2010-08-01")
+	params.Set("Namespace", e.namespace)
+	for i, d := range data {
+		prefix := fmt.Sprintf("MetricData.member.%d.", i+1)
+		params.Set(prefix+"MetricName", d.name)
+		params.Set(prefix+"Value", strconv.FormatFloat(d.value, 'f', -1, 64))
+		params.Set(prefix+"Unit", d.unit)
+		if !ts.IsZero() {
+			params.Set(prefix+"Timestamp", ts.UTC().Format(time.RFC3339))
+		}
+		j := 1
+		for _, dims := range []map[string]string{e.dimensions, d.dimensions} {
+			for _, name := range sortedKeys(dims) {
+				params.Set(fmt.Sprintf("%sDimensions.member.%d.Name", prefix, j), name)
+				params.Set(fmt.Sprintf("%sDimensions.member.%d.Value", prefix, j), dims[name])
+				j++
+			}
+		}
+	}
+	body := params.Encode()
+
+	req, err := http.NewRequest("POST", e.endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if err := auth.SignAwsRequest(req, []byte(body), e.credentials, "monitoring", e.region, e.now()); err != nil {
+		return err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("PutMetricData failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("PutMetricData failed: %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
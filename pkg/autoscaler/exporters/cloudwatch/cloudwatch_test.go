@@ -0,0 +1,134 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudwatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/auth"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+)
+
+func TestExport(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	var got url.Values
+	var authHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			t.Fatalf("unexpected form error: %v", err)
+		}
+		got = req.PostForm
+		authHeader = req.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dims, err := ParseDimensions("cluster=prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp, err := NewCloudWatchExporter("CPVPA", "us-east-1", dims, auth.NewAwsCredentialProvider("us-east-1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp.endpoint = server.URL + "/"
+	exp.now = func() time.Time { return time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC) }
+
+	err = exp.Export(&exporters.Metrics{
+		ClusterNodes: 4,
+		ClusterCores: 16,
+		Requests: map[string]apiv1.ResourceList{
+			"thing": {
+				apiv1.ResourceCPU:    resource.MustParse("250m"),
+				apiv1.ResourceMemory: resource.MustParse("1Mi"),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for k, v := range map[string]string{
+		"Action":                         "PutMetricData",
+		"Namespace":                      "CPVPA",
+		"MetricData.member.1.MetricName": "ClusterNodes",
+		"MetricData.member.1.Value":      "4",
+		"MetricData.member.1.Dimensions.member.1.Name":  "cluster",
+		"MetricData.member.1.Dimensions.member.1.Value": "prod",
+		"MetricData.member.2.MetricName":                "ClusterCores",
+		"MetricData.member.2.Value":                     "16",
+		"MetricData.member.3.MetricName":                "CpuRequest",
+		"MetricData.member.3.Value":                     "0.25",
+		"MetricData.member.3.Dimensions.member.2.Name":  "Container",
+		"MetricData.member.3.Dimensions.member.2.Value": "thing",
+		"MetricData.member.4.MetricName":                "MemoryRequest",
+		"MetricData.member.4.Value":                     "1048576",
+		"MetricData.member.4.Unit":                      "Bytes",
+	} {
+		if got.Get(k) != v {
+			t.Errorf("expected %s=%q, got %q", k, v, got.Get(k))
+		}
+	}
+	if !strings.HasPrefix(authHeader, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20170714/us-east-1/monitoring/aws4_request, ") {
+		t.Errorf("unexpected Authorization header: %q", authHeader)
+	}
+}
+
+func TestParseDimensions(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expDims  map[string]string
+		expError bool
+	}{
+		{"", map[string]string{}, false},
+		{"a=b", map[string]string{"a": "b"}, false},
+		{"a=b, c=d=e", map[string]string{"a": "b", "c": "d=e"}, false},
+		{"a", nil, true},
+		{"=b", nil, true},
+	}
+	for _, tc := range testCases {
+		dims, err := ParseDimensions(tc.in)
+		if err != nil && !tc.expError {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+			continue
+		} else if err == nil && tc.expError {
+			t.Errorf("%q: expected error, got none", tc.in)
+			continue
+		}
+		if len(dims) != len(tc.expDims) {
+			t.Errorf("%q: expected %v, got %v", tc.in, tc.expDims, dims)
+		}
+		for k, v := range tc.expDims {
+			if dims[k] != v {
+				t.Errorf("%q: expected %v, got %v", tc.in, tc.expDims, dims)
+			}
+		}
+	}
+}
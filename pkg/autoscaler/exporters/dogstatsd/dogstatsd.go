@@ -0,0 +1,115 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dogstatsd publishes autoscaler metrics as gauges to a Datadog agent,
+// over the DogStatsD protocol.
+package dogstatsd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+)
+
+var _ = exporters.MetricsExporter(&DogStatsDExporter{})
+
+// Keep datagrams below a typical MTU.
+const maxDatagramSize = 1432
+
+// DogStatsDExporter emits cpva.cluster.nodes, cpva.cluster.cores,
+// cpva.container.cpu_request and cpva.container.memory_request.  All of them
+// are tagged with target_name, target_kind and namespace, and the container
+// metrics also with container_name.
+type DogStatsDExporter struct {
+	conn net.Conn
+}
+
+// NewDogStatsDExporter returns an exporter which sends to the agent at addr,
+// e.g. "localhost:8125".
+func NewDogStatsDExporter(addr string) (*DogStatsDExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to DogStatsD at %q: %v", addr, err)
+	}
+	return &DogStatsDExporter{conn: conn}, nil
+}
+
+// Name returns the name of the exporter.
+func (e *DogStatsDExporter) Name() string {
+	return "dogstatsd"
+}
+
+// Export publishes one snapshot.
+func (e *DogStatsDExporter) Export(m *exporters.Metrics) error {
+	tags := []string{
+		"target_name:" + m.TargetName,
+		"target_kind:" + m.TargetKind,
+		"namespace:" + m.Namespace,
+	}
+	lines := []string{
+		gauge("cpva.cluster.nodes", float64(m.ClusterNodes), tags),
+		gauge("cpva.cluster.cores", float64(m.ClusterCores), tags),
+	}
+
+	ctrs := []string{}
+	for ctr := range m.Requests {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	for _, ctr := range ctrs {
+		ctrTags := append(append([]string{}, tags...), "container_name:"+ctr)
+		if q, found := m.Requests[ctr][apiv1.ResourceCPU]; found {
+			lines = append(lines, gauge("cpva.container.cpu_request", float64(q.MilliValue())/1000, ctrTags))
+		}
+		if q, found := m.Requests[ctr][apiv1.ResourceMemory]; found {
+			lines = append(lines, gauge("cpva.container.memory_request", float64(q.Value()), ctrTags))
+		}
+	}
+
+	// Pack as many lines as fit into each datagram.
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxDatagramSize {
+			if err := e.send(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	return e.send(buf.Bytes())
+}
+
+func (e *DogStatsDExporter) send(b []byte) error {
+	if _, err := e.conn.Write(b); err != nil {
+		return fmt.Errorf("can't send to DogStatsD: %v", err)
+	}
+	return nil
+}
+
+func gauge(name string, value float64, tags []string) string {
+	return fmt.Sprintf("%s:%s|g|#%s", name, strconv.FormatFloat(value, 'f', -1, 64), strings.Join(tags, ","))
+}
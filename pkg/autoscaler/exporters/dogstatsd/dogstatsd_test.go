@@ -0,0 +1,74 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dogstatsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+)
+
+func TestExport(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %v", err)
+	}
+	defer agent.Close()
+
+	exp, err := NewDogStatsDExporter(agent.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = exp.Export(&exporters.Metrics{
+		TargetKind:   "deployment",
+		TargetName:   "thing",
+		Namespace:    "default",
+		ClusterNodes: 4,
+		ClusterCores: 16,
+		Requests: map[string]apiv1.ResourceList{
+			"thing": {
+				apiv1.ResourceCPU:    resource.MustParse("250m"),
+				apiv1.ResourceMemory: resource.MustParse("1Mi"),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	agent.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := agent.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("can't read: %v", err)
+	}
+	expLines := []string{
+		"cpva.cluster.nodes:4|g|#target_name:thing,target_kind:deployment,namespace:default",
+		"cpva.cluster.cores:16|g|#target_name:thing,target_kind:deployment,namespace:default",
+		"cpva.container.cpu_request:0.25|g|#target_name:thing,target_kind:deployment,namespace:default,container_name:thing",
+		"cpva.container.memory_request:1048576|g|#target_name:thing,target_kind:deployment,namespace:default,container_name:thing",
+	}
+	if got := string(buf[:n]); got != strings.Join(expLines, "\n") {
+		t.Errorf("unexpected datagram:\n%s", got)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package exporters defines how the autoscaler publishes its metrics to
+// external monitoring systems.  Each system lives in a sub-package.
+package exporters
+
+import (
+	"math"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Metrics is a snapshot of what the autoscaler observed and applied.
+type Metrics struct {
+	// When the snapshot was taken.
+	Timestamp time.Time
+	// The kind of the target, as given by --target, e.g. "deployment".
+	TargetKind string
+	// The name of the target.
+	TargetName string
+	// The namespace of the target.
+	Namespace string
+	// The number of nodes in the cluster.
+	ClusterNodes int
+	// The number of cores in the cluster.
+	ClusterCores int
+	// The requests last applied to each container of the target which is
+	// still in the config, by container name.
+	Requests map[string]apiv1.ResourceList
+	// The requests that the shadow config computes for each container, by
+	// container name.  They are never applied.  Nil if there is no shadow
+	// config.
+	ShadowRequests map[string]apiv1.ResourceList
+	// The number of failed updates since startup, by target.  Targets which
+	// were replaced through the config file are still included.
+	UpdateFailures map[Target]int
+	// The number of updates of the config file which failed to parse since
+	// startup.  The last valid config stays in effect meanwhile.
+	PolicyParseErrors int
+	// The number of scale events which were dropped since startup, by the
+	// name of the publisher which dropped them.  Only publishers which may
+	// drop events are included.
+	DroppedEvents map[string]int
+	// The number of snapshots which were dropped since startup, by the name
+	// of the exporter which dropped them.  Only exporters which may drop
+	// snapshots are included.
+	DroppedSnapshots map[string]int
+	// The fraction of cluster sizes which were served from the cache since
+	// startup.  Nil if the cluster size isn't cached.
+	ClusterSizeCacheHitRatio *float64
+	// The changes to the requests of the containers which were applied since
+	// the last snapshot, if any.
+	RequestChanges []RequestChange
+}
+
+// RequestChange is a change to the request of one resource of a container.
+type RequestChange struct {
+	Container string
+	Resource  apiv1.ResourceName
+	// The requests before and after the change, in cores or bytes.
+	Old float64
+	New float64
+}
+
+// Fraction returns the size of the change relative to the old request, e.g.
+// 0.5 for 100m to 150m or to 50m.
+func (c RequestChange) Fraction() float64 {
+	return math.Abs(c.New-c.Old) / c.Old
+}
+
+// Direction returns "up" if the request grew, and "down" otherwise.
+func (c RequestChange) Direction() string {
+	if c.New > c.Old {
+		return "up"
+	}
+	return "down"
+}
+
+// Target identifies a target in Namespace.
+type Target struct {
+	// The kind, as given by --target, e.g. "deployment".
+	Kind string
+	Name string
+}
+
+// MetricsExporter publishes metrics to an external system.
+type MetricsExporter interface {
+	// Name identifies the exporter in logs.
+	Name() string
+	// Export publishes one snapshot.
+	Export(m *Metrics) error
+}
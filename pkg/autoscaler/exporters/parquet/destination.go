@@ -0,0 +1,187 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/auth"
+)
+
+// destination is where the files go.
+type destination interface {
+	// path is the output path which the files are named after.
+	path() string
+	// put writes a whole file.
+	put(name string, data []byte) error
+}
+
+// parseDestination parses a local file path, "s3://BUCKET/KEY" or
+// "gs://BUCKET/OBJECT", which is written with the credentials of awsCreds or
+// gcpTokens.
+func parseDestination(outputPath string, awsCreds auth.AwsCredentialSource, gcpTokens auth.GcpTokenSource) (destination, error) {
+	for _, scheme := range []string{"s3", "gs"} {
+		prefix := scheme + "://"
+		if !strings.HasPrefix(outputPath, prefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(outputPath, prefix), "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid Parquet output path %q, must be %sBUCKET/PATH", outputPath, prefix)
+		}
+		client := &http.Client{Timeout: 30 * time.Second}
+		if scheme == "gs" {
+			return &gcsDestination{
+				bucket:         parts[0],
+				object:         parts[1],
+				uploadEndpoint: "https://storage.googleapis.com/upload/storage/v1",
+				tokens:         gcpTokens,
+				client:         client,
+			}, nil
+		}
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			return nil, fmt.Errorf("AWS_REGION must be set for a Parquet output path on S3")
+		}
+		return &s3Destination{
+			key:         parts[1],
+			region:      region,
+			endpoint:    fmt.Sprintf("https://%s.s3.%s.amazonaws.com", parts[0], region),
+			credentials: awsCreds,
+			client:      client,
+			now:         time.Now,
+		}, nil
+	}
+	if outputPath == "" || strings.Contains(outputPath, "://") {
+		return nil, fmt.Errorf("invalid Parquet output path %q, must be a file path, s3://BUCKET/KEY or gs://BUCKET/OBJECT", outputPath)
+	}
+	return localDestination(outputPath), nil
+}
+
+// localDestination writes the files next to a local path.
+type localDestination string
+
+func (d localDestination) path() string {
+	return string(d)
+}
+
+// put writes the file under a temporary name first, so that readers never
+// see part of it.
+func (d localDestination) put(name string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// s3Destination uploads the files to S3 with PutObject.
+type s3Destination struct {
+	key         string
+	region      string
+	endpoint    string
+	credentials auth.AwsCredentialSource
+	client      *http.Client
+	now         func() time.Time
+}
+
+func (d *s3Destination) path() string {
+	return d.key
+}
+
+func (d *s3Destination) put(name string, data []byte) error {
+	u := &url.URL{Path: "/" + name}
+	req, err := http.NewRequest("PUT", d.endpoint+u.EscapedPath(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if err := auth.SignAwsRequest(req, data, d.credentials, "s3", d.region, d.now()); err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("S3 PutObject failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("S3 PutObject failed: %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// gcsDestination uploads the files to GCS.
+type gcsDestination struct {
+	bucket         string
+	object         string
+	uploadEndpoint string
+	tokens         auth.GcpTokenSource
+	client         *http.Client
+}
+
+func (d *gcsDestination) path() string {
+	return d.object
+}
+
+func (d *gcsDestination) put(name string, data []byte) error {
+	token, err := d.tokens.Token()
+	if err != nil {
+		return err
+	}
+	q := url.Values{}
+	q.Set("uploadType", "media")
+	q.Set("name", name)
+	u := fmt.Sprintf("%s/b/%s/o?%s", d.uploadEndpoint, url.PathEscape(d.bucket), q.Encode())
+	req, err := http.NewRequest("POST", u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("GCS upload failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("GCS upload failed: %s: %s", resp.Status, msg)
+	}
+	return nil
+}
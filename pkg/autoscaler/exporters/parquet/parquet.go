@@ -0,0 +1,260 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package parquet exports the applied scale plans as Parquet files, one per
+// rotation interval, for offline analytics, e.g. in BigQuery or Athena.  The
+// files go to a local directory, or to S3 or GCS.
+package parquet
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/auth"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/publishers"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/version"
+)
+
+var _ = publishers.DroppingPublisher(&ParquetExporter{})
+
+// fileTimeFormat is part of the names of the files, e.g.
+// plans-2017-07-14T02-40-00.000.parquet for plans.parquet.
+const fileTimeFormat = "2006-01-02T15-04-05.000"
+
+// maxRetainedRows is how many rows wait to be written at most.  While files
+// can't be written, the oldest rows beyond it are dropped.
+const maxRetainedRows = 100000
+
+// Row is one row of the files: a resource of a container in an applied plan.
+type Row struct {
+	// When the plan was applied.
+	Timestamp time.Time
+	// The target, and the cluster size the plan was computed from.
+	Namespace        string
+	TargetKind       string
+	TargetName       string
+	Nodes            int64
+	Cores            int64
+	MatchingPods     int64
+	PendingPods      int64
+	AverageNodeCores int64
+	Container        string
+	// "requests" or "limits".
+	Kind string
+	// The resource, e.g. "cpu", and its quantity, in cores for cpu and in
+	// bytes for memory.
+	Resource string
+	Value    float64
+	// Identifies the config the plan was computed from.
+	ConfigVersion string
+}
+
+// Rows flattens a scale event into its rows, sorted by container, kind and
+// resource.
+func Rows(ev *publishers.ScaleEvent) []Row {
+	p := ev.Plan
+	ctrs := []string{}
+	for ctr := range p.Resources {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	rows := []Row{}
+	for _, ctr := range ctrs {
+		for _, kind := range []struct {
+			name string
+			list apiv1.ResourceList
+		}{
+			{"requests", p.Resources[ctr].Requests},
+			{"limits", p.Resources[ctr].Limits},
+		} {
+			names := []string{}
+			for name := range kind.list {
+				names = append(names, string(name))
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				q := kind.list[apiv1.ResourceName(name)]
+				rows = append(rows, Row{
+					Timestamp:        ev.Timestamp,
+					Namespace:        p.Namespace,
+					TargetKind:       p.TargetKind,
+					TargetName:       p.TargetName,
+					Nodes:            int64(p.Nodes),
+					Cores:            int64(p.Cores),
+					MatchingPods:     int64(p.MatchingPods),
+					PendingPods:      int64(p.PendingPods),
+					AverageNodeCores: int64(p.AverageNodeCores),
+					Container:        ctr,
+					Kind:             kind.name,
+					Resource:         name,
+					Value:            float64(q.MilliValue()) / 1000,
+					ConfigVersion:    ev.ConfigVersion,
+				})
+			}
+		}
+	}
+	return rows
+}
+
+// ParquetExporter collects the rows of the scale events in memory, and
+// writes them out as a Parquet file once the first of them is a rotation
+// interval old, and on Close.  A file which can't be written is retried with
+// the next one; until then, its rows stay in memory, up to maxRows.
+type ParquetExporter struct {
+	dest     destination
+	interval time.Duration
+	maxRows  int
+	now      func() time.Time
+	// Schedules the writing of a file, after the interval.
+	afterFunc func(d time.Duration, f func()) *time.Timer
+
+	mu sync.Mutex
+	// The rows of the next file, and when its first row arrived.
+	rows    []Row
+	started time.Time
+	timer   *time.Timer
+	// The number of rows dropped since startup.
+	dropped int
+}
+
+// NewParquetExporter returns an exporter which writes to outputPath: a local
+// file path, "s3://BUCKET/KEY" or "gs://BUCKET/OBJECT".  Each file is named
+// after outputPath, with the time of its first row before the extension.
+// S3 needs the region in ${AWS_REGION}, and is written with awsCreds, and GCS
+// with gcpTokens.
+func NewParquetExporter(outputPath string, rotateInterval time.Duration, awsCreds auth.AwsCredentialSource, gcpTokens auth.GcpTokenSource) (*ParquetExporter, error) {
+	if rotateInterval <= 0 {
+		return nil, fmt.Errorf("the Parquet rotate interval must be positive")
+	}
+	dest, err := parseDestination(outputPath, awsCreds, gcpTokens)
+	if err != nil {
+		return nil, err
+	}
+	return &ParquetExporter{
+		dest:      dest,
+		interval:  rotateInterval,
+		maxRows:   maxRetainedRows,
+		now:       time.Now,
+		afterFunc: time.AfterFunc,
+	}, nil
+}
+
+// Name returns the name of the publisher.
+func (e *ParquetExporter) Name() string {
+	return "parquet"
+}
+
+// Publish adds the rows of the event to the next file.
+func (e *ParquetExporter) Publish(ev *publishers.ScaleEvent) error {
+	rows := Rows(ev)
+	if len(rows) == 0 {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.rows) == 0 {
+		e.started = e.now()
+		e.scheduleLocked()
+	}
+	e.rows = append(e.rows, rows...)
+	e.trimLocked()
+	return nil
+}
+
+// trimLocked drops the oldest rows beyond maxRows.
+func (e *ParquetExporter) trimLocked() {
+	n := len(e.rows) - e.maxRows
+	if n <= 0 {
+		return
+	}
+	glog.Errorf("Dropped the %d oldest rows for Parquet, %d rows are already waiting to be written", n, e.maxRows)
+	e.rows = append([]Row(nil), e.rows[n:]...)
+	e.dropped += n
+}
+
+// Dropped returns the number of rows which were dropped since startup.
+func (e *ParquetExporter) Dropped() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+func (e *ParquetExporter) scheduleLocked() {
+	if e.timer != nil {
+		return
+	}
+	e.timer = e.afterFunc(e.interval, func() {
+		e.mu.Lock()
+		e.timer = nil
+		e.mu.Unlock()
+		if err := e.Flush(); err != nil {
+			glog.Errorf("Failed to write Parquet file: %v", err)
+		}
+	})
+}
+
+// Flush writes the collected rows out as a file, if there are any.
+func (e *ParquetExporter) Flush() error {
+	e.mu.Lock()
+	rows, started := e.rows, e.started
+	e.rows = nil
+	e.mu.Unlock()
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err := writeFile(&buf, rows, "cluster-proportional-vertical-autoscaler version "+version.VERSION)
+	if err == nil {
+		err = e.dest.put(fileName(e.dest.path(), started), buf.Bytes())
+	}
+	if err != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.rows = append(rows, e.rows...)
+		e.started = started
+		e.trimLocked()
+		e.scheduleLocked()
+		return err
+	}
+	glog.V(2).Infof("Wrote %d rows to Parquet file %s", len(rows), fileName(e.dest.path(), started))
+	return nil
+}
+
+// Close writes out the collected rows.
+func (e *ParquetExporter) Close() error {
+	e.mu.Lock()
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	e.mu.Unlock()
+	return e.Flush()
+}
+
+// fileName inserts the time t before the extension of p.
+func fileName(p string, t time.Time) string {
+	ext := path.Ext(p)
+	return strings.TrimSuffix(p, ext) + "-" + t.UTC().Format(fileTimeFormat) + ext
+}
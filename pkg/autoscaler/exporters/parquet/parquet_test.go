@@ -0,0 +1,286 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/auth"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/publishers"
+)
+
+var testTime = time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+func testEvent() *publishers.ScaleEvent {
+	return &publishers.ScaleEvent{
+		Timestamp: testTime,
+		Plan: publishers.ScalePlan{
+			Namespace:  "default",
+			TargetKind: "deployment",
+			TargetName: "thing",
+			Nodes:      3,
+			Cores:      12,
+			Resources: map[string]apiv1.ResourceRequirements{
+				"sidecar": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")}},
+				"app": {
+					Requests: apiv1.ResourceList{
+						apiv1.ResourceMemory: resource.MustParse("1Gi"),
+						apiv1.ResourceCPU:    resource.MustParse("250m"),
+					},
+					Limits: apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("2Gi")},
+				},
+			},
+		},
+		ConfigVersion: "abc",
+	}
+}
+
+func TestRows(t *testing.T) {
+	rows := Rows(testEvent())
+	got := []string{}
+	for _, r := range rows {
+		if r.Timestamp != testTime || r.TargetName != "thing" || r.Nodes != 3 || r.ConfigVersion != "abc" {
+			t.Errorf("unexpected row: %+v", r)
+		}
+		got = append(got, fmt.Sprintf("%s/%s/%s=%v", r.Container, r.Kind, r.Resource, r.Value))
+	}
+	expected := []string{
+		"app/requests/cpu=0.25",
+		"app/requests/memory=1.073741824e+09",
+		"app/limits/memory=2.147483648e+09",
+		"sidecar/requests/cpu=0.01",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected rows %v, got %v", expected, got)
+	}
+}
+
+// fakeDestination records the files, or fails.
+type fakeDestination struct {
+	files map[string][]byte
+	err   error
+}
+
+func (d *fakeDestination) path() string {
+	return "plans/plans.parquet"
+}
+
+func (d *fakeDestination) put(name string, data []byte) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.files[name] = data
+	return nil
+}
+
+func TestParquetExporter(t *testing.T) {
+	dest := &fakeDestination{files: map[string][]byte{}}
+	now := testTime
+	var scheduled []func()
+	e := &ParquetExporter{
+		dest:     dest,
+		interval: time.Hour,
+		maxRows:  10,
+		now:      func() time.Time { return now },
+		afterFunc: func(d time.Duration, f func()) *time.Timer {
+			if d != time.Hour {
+				t.Errorf("expected the file to be written after an hour, got %v", d)
+			}
+			scheduled = append(scheduled, f)
+			return time.NewTimer(time.Hour)
+		},
+	}
+
+	if err := e.Publish(&publishers.ScaleEvent{Timestamp: testTime}); err != nil || len(scheduled) != 0 {
+		t.Fatalf("expected an event without resources to be ignored, got %v, %d scheduled", err, len(scheduled))
+	}
+	if err := e.Publish(testEvent()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := e.Publish(testEvent()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scheduled) != 1 || len(dest.files) != 0 {
+		t.Fatalf("expected one file to be scheduled and none written, got %d and %d", len(scheduled), len(dest.files))
+	}
+
+	// A failed write is retried with the next file.
+	dest.err = fmt.Errorf("boom")
+	scheduled[0]()
+	if len(scheduled) != 2 || len(dest.files) != 0 {
+		t.Fatalf("expected the failed file to be rescheduled, got %d scheduled and %d written", len(scheduled), len(dest.files))
+	}
+	dest.err = nil
+	scheduled[1]()
+	data, found := dest.files["plans/plans-2017-07-14T02-40-00.000.parquet"]
+	if !found || len(dest.files) != 1 {
+		t.Fatalf("expected one file named after the first row, got %v", dest.files)
+	}
+	if n := openFile(t, data).GetNumRows(); n != 8 {
+		t.Errorf("expected 8 rows, got %d", n)
+	}
+
+	// Close writes what's left.
+	now = now.Add(2 * time.Hour)
+	if err := e.Publish(testEvent()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := dest.files["plans/plans-2017-07-14T04-41-00.000.parquet"]; !found || len(dest.files) != 2 {
+		t.Errorf("expected Close to write a second file, got %d files", len(dest.files))
+	}
+
+	// While files can't be written, the oldest rows beyond maxRows are
+	// dropped.
+	dest.err = fmt.Errorf("boom")
+	for i := 0; i < 3; i++ {
+		if err := e.Publish(testEvent()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := e.Flush(); err == nil {
+		t.Fatalf("expected the write to fail")
+	}
+	if len(e.rows) != 10 || e.Dropped() != 2 {
+		t.Errorf("expected 10 rows to be kept and 2 dropped, got %d and %d", len(e.rows), e.Dropped())
+	}
+}
+
+func TestParseDestination(t *testing.T) {
+	os.Setenv("AWS_REGION", "us-west-2")
+	defer os.Unsetenv("AWS_REGION")
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/var/lib/cpvpa/plans.parquet", expected: "local /var/lib/cpvpa/plans.parquet"},
+		{path: "s3://bucket/cpvpa/plans.parquet", expected: "s3 https://bucket.s3.us-west-2.amazonaws.com cpvpa/plans.parquet"},
+		{path: "gs://bucket/cpvpa/plans.parquet", expected: "gs bucket cpvpa/plans.parquet"},
+		{path: "s3://bucket"},
+		{path: "gs:///plans.parquet"},
+		{path: "https://example.com/plans.parquet"},
+		{path: ""},
+	}
+	for _, tc := range testCases {
+		dest, err := parseDestination(tc.path, nil, nil)
+		got := ""
+		switch d := dest.(type) {
+		case localDestination:
+			got = "local " + d.path()
+		case *s3Destination:
+			got = "s3 " + d.endpoint + " " + d.path()
+		case *gcsDestination:
+			got = "gs " + d.bucket + " " + d.path()
+		}
+		if got != tc.expected || (err == nil) != (tc.expected != "") {
+			t.Errorf("%q: expected %q, got %q, %v", tc.path, tc.expected, got, err)
+		}
+	}
+}
+
+func TestLocalDestination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "plans-1.parquet")
+	if err := localDestination(filepath.Join(dir, "plans.parquet")).put(name, []byte("data")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if data, err := ioutil.ReadFile(name); err != nil || string(data) != "data" || len(files) != 1 {
+		t.Errorf("expected only %s, with the data, got %v and %q, %v", name, files, data, err)
+	}
+}
+
+// staticCredentials provides fixed AWS credentials and GCP tokens.
+type staticCredentials struct {
+	aws   auth.AwsCredentials
+	token string
+}
+
+func (c staticCredentials) Retrieve() (auth.AwsCredentials, error) {
+	return c.aws, nil
+}
+
+func (c staticCredentials) Token() (string, error) {
+	return c.token, nil
+}
+
+func TestS3Destination(t *testing.T) {
+	creds := staticCredentials{aws: auth.AwsCredentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "SESSION"}}
+	var got *http.Request
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		got, body = req, string(data)
+	}))
+	defer server.Close()
+
+	d := &s3Destination{key: "cpvpa/plans.parquet", region: "us-west-2", endpoint: server.URL, credentials: creds,
+		client: server.Client(), now: func() time.Time { return testTime }}
+	if err := d.put("cpvpa/plans-1.parquet", []byte("data")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Method != "PUT" || got.URL.Path != "/cpvpa/plans-1.parquet" || body != "data" {
+		t.Errorf("unexpected request: %s %s %q", got.Method, got.URL.Path, body)
+	}
+	auth := got.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20170714/us-west-2/s3/aws4_request, ") ||
+		!strings.Contains(auth, "x-amz-content-sha256") {
+		t.Errorf("unexpected Authorization %q", auth)
+	}
+	if got.Header.Get("X-Amz-Security-Token") != "SESSION" {
+		t.Errorf("unexpected session token %q", got.Header.Get("X-Amz-Security-Token"))
+	}
+	if got.Header.Get("X-Amz-Content-Sha256") != "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7" {
+		t.Errorf("unexpected payload hash %q", got.Header.Get("X-Amz-Content-Sha256"))
+	}
+}
+
+func TestGCSDestination(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+	}))
+	defer server.Close()
+
+	d := &gcsDestination{bucket: "bucket", object: "cpvpa/plans.parquet", uploadEndpoint: server.URL + "/upload",
+		tokens: staticCredentials{token: "TOKEN"}, client: server.Client()}
+	if err := d.put("cpvpa/plans-1.parquet", []byte("data")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.URL.Path != "/upload/b/bucket/o" || got.URL.Query().Get("name") != "cpvpa/plans-1.parquet" ||
+		got.URL.Query().Get("uploadType") != "media" || got.Header.Get("Authorization") != "Bearer TOKEN" {
+		t.Errorf("unexpected request: %s %v", got.URL, got.Header)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquet
+
+import (
+	"io"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// fileRow is how a Row is laid out in the files.
+type fileRow struct {
+	Timestamp        int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Namespace        string  `parquet:"name=namespace, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TargetKind       string  `parquet:"name=target_kind, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TargetName       string  `parquet:"name=target_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Nodes            int64   `parquet:"name=nodes, type=INT64"`
+	Cores            int64   `parquet:"name=cores, type=INT64"`
+	MatchingPods     int64   `parquet:"name=matching_pods, type=INT64"`
+	PendingPods      int64   `parquet:"name=pending_pods, type=INT64"`
+	AverageNodeCores int64   `parquet:"name=average_node_cores, type=INT64"`
+	Container        string  `parquet:"name=container, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Kind             string  `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Resource         string  `parquet:"name=resource, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Value            float64 `parquet:"name=value, type=DOUBLE"`
+	ConfigVersion    string  `parquet:"name=config_version, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// writeFile writes rows as a Snappy-compressed Parquet file.  createdBy
+// names the writer in the footer.
+func writeFile(w io.Writer, rows []Row, createdBy string) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(fileRow), 1)
+	if err != nil {
+		return err
+	}
+	pw.Footer.CreatedBy = &createdBy
+	for _, r := range rows {
+		if err := pw.Write(fileRow{
+			Timestamp:        r.Timestamp.UnixNano() / 1e6,
+			Namespace:        r.Namespace,
+			TargetKind:       r.TargetKind,
+			TargetName:       r.TargetName,
+			Nodes:            r.Nodes,
+			Cores:            r.Cores,
+			MatchingPods:     r.MatchingPods,
+			PendingPods:      r.PendingPods,
+			AverageNodeCores: r.AverageNodeCores,
+			Container:        r.Container,
+			Kind:             r.Kind,
+			Resource:         r.Resource,
+			Value:            r.Value,
+			ConfigVersion:    r.ConfigVersion,
+		}); err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
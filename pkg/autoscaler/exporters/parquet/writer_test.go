@@ -0,0 +1,121 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// openFile opens a file with the parquet-go reader.
+func openFile(t *testing.T, data []byte) *reader.ParquetReader {
+	file, err := buffer.NewBufferFile(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pr, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		t.Fatalf("can't read the file: %v", err)
+	}
+	return pr
+}
+
+func TestWriteFile(t *testing.T) {
+	ts := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	rows := []Row{
+		{Timestamp: ts, Namespace: "default", TargetKind: "deployment", TargetName: "thing", Nodes: 3, Cores: 12,
+			Container: "app", Kind: "requests", Resource: "cpu", Value: 0.25, ConfigVersion: "abc"},
+		{Timestamp: ts, Namespace: "default", TargetKind: "deployment", TargetName: "thing", Nodes: 3, Cores: 12,
+			Container: "app", Kind: "requests", Resource: "memory", Value: 1 << 30, ConfigVersion: "abc"},
+	}
+	var buf bytes.Buffer
+	if err := writeFile(&buf, rows, "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pr := openFile(t, buf.Bytes())
+	defer pr.ReadStop()
+	if pr.Footer.GetCreatedBy() != "test" || pr.GetNumRows() != 2 {
+		t.Errorf("expected 2 rows created by test, got %d created by %q", pr.GetNumRows(), pr.Footer.GetCreatedBy())
+	}
+
+	expectedSchema := []struct {
+		name      string
+		typ       parquet.Type
+		converted *parquet.ConvertedType
+	}{
+		{"timestamp", parquet.Type_INT64, parquet.ConvertedTypePtr(parquet.ConvertedType_TIMESTAMP_MILLIS)},
+		{"namespace", parquet.Type_BYTE_ARRAY, parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)},
+		{"target_kind", parquet.Type_BYTE_ARRAY, parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)},
+		{"target_name", parquet.Type_BYTE_ARRAY, parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)},
+		{"nodes", parquet.Type_INT64, nil},
+		{"cores", parquet.Type_INT64, nil},
+		{"matching_pods", parquet.Type_INT64, nil},
+		{"pending_pods", parquet.Type_INT64, nil},
+		{"average_node_cores", parquet.Type_INT64, nil},
+		{"container", parquet.Type_BYTE_ARRAY, parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)},
+		{"kind", parquet.Type_BYTE_ARRAY, parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)},
+		{"resource", parquet.Type_BYTE_ARRAY, parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)},
+		{"value", parquet.Type_DOUBLE, nil},
+		{"config_version", parquet.Type_BYTE_ARRAY, parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)},
+	}
+	// The reader renames the columns after Go fields, so the names in the
+	// file are those of the schema handler.
+	schema, names := pr.Footer.Schema, pr.SchemaHandler.Infos
+	if len(schema) != len(expectedSchema)+1 {
+		t.Fatalf("expected %d columns, got schema %v", len(expectedSchema), schema)
+	}
+	for i, expected := range expectedSchema {
+		elem := schema[i+1]
+		if names[i+1].ExName != expected.name || elem.GetType() != expected.typ ||
+			elem.GetRepetitionType() != parquet.FieldRepetitionType_REQUIRED ||
+			!reflect.DeepEqual(elem.ConvertedType, expected.converted) {
+			t.Errorf("column %d: expected %+v, got %v", i, expected, elem)
+		}
+	}
+
+	// Without a schema, the reader returns each row as a struct of the
+	// file's columns, named after them.
+	read, err := pr.ReadByNumber(3)
+	if err != nil {
+		t.Fatalf("can't read the rows: %v", err)
+	}
+	if len(read) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(read))
+	}
+	for i, row := range read {
+		v := reflect.ValueOf(row)
+		for name, expected := range map[string]interface{}{
+			"Timestamp":      ts.UnixNano() / 1e6,
+			"Target_name":    "thing",
+			"Nodes":          int64(3),
+			"Resource":       rows[i].Resource,
+			"Value":          rows[i].Value,
+			"Config_version": "abc",
+		} {
+			if got := v.FieldByName(name).Interface(); got != expected {
+				t.Errorf("row %d, column %s: expected %v, got %v", i, name, expected, got)
+			}
+		}
+	}
+}
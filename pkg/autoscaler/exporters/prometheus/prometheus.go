@@ -0,0 +1,172 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package prometheus serves autoscaler metrics for Prometheus to scrape, in
+// its text exposition format.
+package prometheus
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/golang/glog"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+)
+
+var _ = exporters.MetricsExporter(&PrometheusExporter{})
+
+// PrometheusExporter serves cpva_cluster_nodes, cpva_cluster_cores,
+// cpva_container_resource_requests, cpva_applied_cpu_millicores,
+// cpva_applied_memory_bytes, cpva_target_update_failures_total,
+// cpva_policy_parse_errors_total, if an event publisher may drop events,
+// cpva_dropped_scale_events_total, if an exporter may drop snapshots,
+// cpva_dropped_metrics_snapshots_total, if a shadow config is evaluated,
+// cpva_shadow_container_resource_requests, if the cluster size is cached,
+// cpva_cluster_size_cache_hit_ratio, and the histogram
+// cpva_container_resource_change_fraction.  CPU is in cores and memory in
+// bytes, except where the name says otherwise.
+type PrometheusExporter struct {
+	registry       *Registry
+	nodes          *GaugeVec
+	cores          *GaugeVec
+	requests       *GaugeVec
+	appliedCPU     *GaugeVec
+	appliedMemory  *GaugeVec
+	shadowRequests *GaugeVec
+	updateFailures *CounterVec
+	parseErrors    *CounterVec
+	droppedEvents  *CounterVec
+	droppedExports *CounterVec
+	cacheHitRatio  *GaugeVec
+	changeFraction *HistogramVec
+}
+
+// changeFractionBuckets bound the relative sizes of request changes, from 1%
+// to tenfold.
+var changeFractionBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10}
+
+// NewPrometheusExporter returns an exporter which serves its metrics on
+// /metrics at addr, e.g. ":9102".
+func NewPrometheusExporter(addr string) (*PrometheusExporter, error) {
+	e := newPrometheusExporter()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't serve metrics on %q: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e.registry)
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			glog.Errorf("Stopped serving metrics: %v", err)
+		}
+	}()
+	return e, nil
+}
+
+func newPrometheusExporter() *PrometheusExporter {
+	r := NewRegistry()
+	targetLabels := []string{"namespace", "target_kind", "target_name"}
+	ctrLabels := append(append([]string{}, targetLabels...), "container", "resource")
+	appliedLabels := append(append([]string{}, targetLabels...), "container")
+	return &PrometheusExporter{
+		registry: r,
+		nodes:    r.NewGaugeVec("cpva_cluster_nodes", "The number of nodes in the cluster.", targetLabels...),
+		cores:    r.NewGaugeVec("cpva_cluster_cores", "The number of cores in the cluster.", targetLabels...),
+		requests: r.NewGaugeVec("cpva_container_resource_requests",
+			"The requests last applied to a container, in cores or bytes.", ctrLabels...),
+		appliedCPU: r.NewGaugeVec("cpva_applied_cpu_millicores",
+			"The cpu request last applied to a container, in millicores.", appliedLabels...),
+		appliedMemory: r.NewGaugeVec("cpva_applied_memory_bytes",
+			"The memory request last applied to a container, in bytes.", appliedLabels...),
+		shadowRequests: r.NewGaugeVec("cpva_shadow_container_resource_requests",
+			"The requests that the shadow config computes for a container, in cores or bytes.  They are never applied.", ctrLabels...),
+		updateFailures: r.NewCounterVec("cpva_target_update_failures_total",
+			"The number of times that updating a target failed.", targetLabels...),
+		parseErrors: r.NewCounterVec("cpva_policy_parse_errors_total",
+			"The number of updates of the config which failed to parse.", targetLabels...),
+		droppedEvents: r.NewCounterVec("cpva_dropped_scale_events_total",
+			"The number of scale events which a publisher dropped.", append(append([]string{}, targetLabels...), "publisher")...),
+		droppedExports: r.NewCounterVec("cpva_dropped_metrics_snapshots_total",
+			"The number of metrics snapshots which an exporter dropped.", append(append([]string{}, targetLabels...), "exporter")...),
+		cacheHitRatio: r.NewGaugeVec("cpva_cluster_size_cache_hit_ratio",
+			"The fraction of cluster sizes which were served from the cache.", targetLabels...),
+		changeFraction: r.NewHistogramVec("cpva_container_resource_change_fraction",
+			"The size of each change to a container's requests, relative to the old request.", changeFractionBuckets,
+			append(append([]string{}, ctrLabels...), "direction")...),
+	}
+}
+
+// Registry returns the registry which the metrics are served from, so that
+// more can be added to it.
+func (e *PrometheusExporter) Registry() *Registry {
+	return e.registry
+}
+
+// Name returns the name of the exporter.
+func (e *PrometheusExporter) Name() string {
+	return "prometheus"
+}
+
+// Export updates the served metrics.
+func (e *PrometheusExporter) Export(m *exporters.Metrics) error {
+	e.nodes.Set(float64(m.ClusterNodes), m.Namespace, m.TargetKind, m.TargetName)
+	e.cores.Set(float64(m.ClusterCores), m.Namespace, m.TargetKind, m.TargetName)
+	setRequests(e.requests, m, m.Requests)
+	setApplied(e.appliedCPU, m, apiv1.ResourceCPU, 1)
+	setApplied(e.appliedMemory, m, apiv1.ResourceMemory, 1000)
+	setRequests(e.shadowRequests, m, m.ShadowRequests)
+	for target, n := range m.UpdateFailures {
+		e.updateFailures.Set(float64(n), m.Namespace, target.Kind, target.Name)
+	}
+	e.parseErrors.Set(float64(m.PolicyParseErrors), m.Namespace, m.TargetKind, m.TargetName)
+	for pub, n := range m.DroppedEvents {
+		e.droppedEvents.Set(float64(n), m.Namespace, m.TargetKind, m.TargetName, pub)
+	}
+	for exp, n := range m.DroppedSnapshots {
+		e.droppedExports.Set(float64(n), m.Namespace, m.TargetKind, m.TargetName, exp)
+	}
+	if m.ClusterSizeCacheHitRatio != nil {
+		e.cacheHitRatio.Set(*m.ClusterSizeCacheHitRatio, m.Namespace, m.TargetKind, m.TargetName)
+	}
+	for _, c := range m.RequestChanges {
+		e.changeFraction.Observe(c.Fraction(), m.Namespace, m.TargetKind, m.TargetName, c.Container, string(c.Resource), c.Direction())
+	}
+	return nil
+}
+
+func setRequests(g *GaugeVec, m *exporters.Metrics, requests map[string]apiv1.ResourceList) {
+	g.Reset()
+	for ctr, list := range requests {
+		for res, q := range list {
+			g.Set(float64(q.MilliValue())/1000, m.Namespace, m.TargetKind, m.TargetName, ctr, string(res))
+		}
+	}
+}
+
+// setApplied sets g to the request of res of each container, in milli-units
+// divided by scale.  Containers which are no longer in m are dropped.
+func setApplied(g *GaugeVec, m *exporters.Metrics, res apiv1.ResourceName, scale int64) {
+	g.Reset()
+	for ctr, list := range m.Requests {
+		if q, found := list[res]; found {
+			g.Set(float64(q.MilliValue()/scale), m.Namespace, m.TargetKind, m.TargetName, ctr)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/exporters"
+)
+
+func TestExport(t *testing.T) {
+	e := newPrometheusExporter()
+	ratio := 0.75
+	m := &exporters.Metrics{
+		TargetKind:   "deployment",
+		TargetName:   "thing",
+		Namespace:    "default",
+		ClusterNodes: 4,
+		ClusterCores: 16,
+		Requests: map[string]apiv1.ResourceList{
+			"thing": {
+				apiv1.ResourceCPU:    resource.MustParse("250m"),
+				apiv1.ResourceMemory: resource.MustParse("1Mi"),
+			},
+		},
+		ShadowRequests: map[string]apiv1.ResourceList{
+			"thing": {apiv1.ResourceCPU: resource.MustParse("500m")},
+		},
+		UpdateFailures: map[exporters.Target]int{
+			{Kind: "deployment", Name: "thing"}: 1,
+			{Kind: "daemonset", Name: "old"}:    3,
+		},
+		PolicyParseErrors:        2,
+		DroppedEvents:            map[string]int{"nats": 5},
+		DroppedSnapshots:         map[string]int{"cloudwatch": 1},
+		ClusterSizeCacheHitRatio: &ratio,
+		RequestChanges: []exporters.RequestChange{
+			{Container: "thing", Resource: apiv1.ResourceCPU, Old: 0.2, New: 0.25},
+			{Container: "thing", Resource: apiv1.ResourceMemory, Old: 4, New: 1},
+		},
+	}
+	if err := e.Export(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Containers which are gone are dropped, and changes are added up.
+	m.Requests = map[string]apiv1.ResourceList{
+		"other": {apiv1.ResourceCPU: resource.MustParse("2")},
+	}
+	m.RequestChanges = []exporters.RequestChange{
+		{Container: "thing", Resource: apiv1.ResourceCPU, Old: 0.25, New: 1},
+	}
+	if err := e.Export(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	e.Registry().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `# HELP cpva_cluster_nodes The number of nodes in the cluster.
+# TYPE cpva_cluster_nodes gauge
+cpva_cluster_nodes{namespace="default",target_kind="deployment",target_name="thing"} 4
+# HELP cpva_cluster_cores The number of cores in the cluster.
+# TYPE cpva_cluster_cores gauge
+cpva_cluster_cores{namespace="default",target_kind="deployment",target_name="thing"} 16
+# HELP cpva_container_resource_requests The requests last applied to a container, in cores or bytes.
+# TYPE cpva_container_resource_requests gauge
+cpva_container_resource_requests{namespace="default",target_kind="deployment",target_name="thing",container="other",resource="cpu"} 2
+# HELP cpva_applied_cpu_millicores The cpu request last applied to a container, in millicores.
+# TYPE cpva_applied_cpu_millicores gauge
+cpva_applied_cpu_millicores{namespace="default",target_kind="deployment",target_name="thing",container="other"} 2000
+# HELP cpva_applied_memory_bytes The memory request last applied to a container, in bytes.
+# TYPE cpva_applied_memory_bytes gauge
+# HELP cpva_shadow_container_resource_requests The requests that the shadow config computes for a container, in cores or bytes.  They are never applied.
+# TYPE cpva_shadow_container_resource_requests gauge
+cpva_shadow_container_resource_requests{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu"} 0.5
+# HELP cpva_target_update_failures_total The number of times that updating a target failed.
+# TYPE cpva_target_update_failures_total counter
+cpva_target_update_failures_total{namespace="default",target_kind="daemonset",target_name="old"} 3
+cpva_target_update_failures_total{namespace="default",target_kind="deployment",target_name="thing"} 1
+# HELP cpva_policy_parse_errors_total The number of updates of the config which failed to parse.
+# TYPE cpva_policy_parse_errors_total counter
+cpva_policy_parse_errors_total{namespace="default",target_kind="deployment",target_name="thing"} 2
+# HELP cpva_dropped_scale_events_total The number of scale events which a publisher dropped.
+# TYPE cpva_dropped_scale_events_total counter
+cpva_dropped_scale_events_total{namespace="default",target_kind="deployment",target_name="thing",publisher="nats"} 5
+# HELP cpva_dropped_metrics_snapshots_total The number of metrics snapshots which an exporter dropped.
+# TYPE cpva_dropped_metrics_snapshots_total counter
+cpva_dropped_metrics_snapshots_total{namespace="default",target_kind="deployment",target_name="thing",exporter="cloudwatch"} 1
+# HELP cpva_cluster_size_cache_hit_ratio The fraction of cluster sizes which were served from the cache.
+# TYPE cpva_cluster_size_cache_hit_ratio gauge
+cpva_cluster_size_cache_hit_ratio{namespace="default",target_kind="deployment",target_name="thing"} 0.75
+# HELP cpva_container_resource_change_fraction The size of each change to a container's requests, relative to the old request.
+# TYPE cpva_container_resource_change_fraction histogram
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="0.01"} 0
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="0.05"} 0
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="0.1"} 0
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="0.25"} 1
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="0.5"} 1
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="1"} 1
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="2"} 1
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="5"} 2
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="10"} 2
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up",le="+Inf"} 2
+cpva_container_resource_change_fraction_sum{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up"} 3.25
+cpva_container_resource_change_fraction_count{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="cpu",direction="up"} 2
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="0.01"} 0
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="0.05"} 0
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="0.1"} 0
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="0.25"} 0
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="0.5"} 0
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="1"} 1
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="2"} 1
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="5"} 1
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="10"} 1
+cpva_container_resource_change_fraction_bucket{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down",le="+Inf"} 1
+cpva_container_resource_change_fraction_sum{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down"} 0.75
+cpva_container_resource_change_fraction_count{namespace="default",target_kind="deployment",target_name="thing",container="thing",resource="memory",direction="down"} 1
+`
+	if got := rec.Body.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestExportAppliedLabelLifecycle(t *testing.T) {
+	e := newPrometheusExporter()
+	m := &exporters.Metrics{TargetKind: "deployment", TargetName: "thing", Namespace: "default"}
+	series := func() map[string]bool {
+		rec := httptest.NewRecorder()
+		e.Registry().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		found := map[string]bool{}
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if strings.HasPrefix(line, "cpva_applied_") {
+				found[line] = true
+			}
+		}
+		return found
+	}
+	for _, step := range []struct {
+		name     string
+		requests map[string]apiv1.ResourceList
+		expected []string
+	}{
+		{"nothing applied yet", nil, nil},
+		{
+			"two containers",
+			map[string]apiv1.ResourceList{
+				"app":     {apiv1.ResourceCPU: resource.MustParse("1500m"), apiv1.ResourceMemory: resource.MustParse("1Gi")},
+				"sidecar": {apiv1.ResourceCPU: resource.MustParse("50m")},
+			},
+			[]string{
+				`cpva_applied_cpu_millicores{namespace="default",target_kind="deployment",target_name="thing",container="app"} 1500`,
+				`cpva_applied_cpu_millicores{namespace="default",target_kind="deployment",target_name="thing",container="sidecar"} 50`,
+				`cpva_applied_memory_bytes{namespace="default",target_kind="deployment",target_name="thing",container="app"} 1.073741824e+09`,
+			},
+		},
+		{
+			"sidecar left the config",
+			map[string]apiv1.ResourceList{
+				"app": {apiv1.ResourceCPU: resource.MustParse("2"), apiv1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+			[]string{
+				`cpva_applied_cpu_millicores{namespace="default",target_kind="deployment",target_name="thing",container="app"} 2000`,
+				`cpva_applied_memory_bytes{namespace="default",target_kind="deployment",target_name="thing",container="app"} 1.073741824e+09`,
+			},
+		},
+		{"all gone", map[string]apiv1.ResourceList{}, nil},
+	} {
+		m.Requests = step.requests
+		if err := e.Export(m); err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		got := series()
+		if len(got) != len(step.expected) {
+			t.Errorf("%s: expected %d series, got %v", step.name, len(step.expected), got)
+		}
+		for _, line := range step.expected {
+			if !got[line] {
+				t.Errorf("%s: missing %s, got %v", step.name, line, got)
+			}
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	testCases := []struct {
+		names    []string
+		values   []string
+		expected string
+	}{
+		{nil, nil, ""},
+		{[]string{"a"}, []string{"x"}, `{a="x"}`},
+		{[]string{"a", "b"}, []string{`q"uo\te`, "new\nline"}, `{a="q\"uo\\te",b="new\nline"}`},
+	}
+	for _, tc := range testCases {
+		if got := formatLabels(tc.names, tc.values); got != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, got)
+		}
+	}
+}
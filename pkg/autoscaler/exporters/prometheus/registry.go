@@ -0,0 +1,259 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector is a metric family which can write itself in the Prometheus text
+// exposition format.
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds metric families, and serves them to Prometheus.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// ServeHTTP writes all metrics, in the order that they were registered.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+	r.mu.Lock()
+	for _, c := range r.collectors {
+		c.write(&buf)
+	}
+	r.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// GaugeVec is a family of gauges, which are told apart by their labels.
+type GaugeVec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]float64 // By label values, see seriesKey.
+}
+
+// NewGaugeVec registers a new family of gauges.
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := newGaugeVec(name, help, "gauge", labelNames)
+	r.register(g)
+	return g
+}
+
+func newGaugeVec(name, help, typ string, labelNames []string) *GaugeVec {
+	return &GaugeVec{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		values:     map[string]float64{},
+	}
+}
+
+// CounterVec is a family of counters.  The autoscaler keeps the running
+// totals itself and exports snapshots of them, so counters are set like
+// gauges, but must only ever be set to larger values.
+type CounterVec struct {
+	*GaugeVec
+}
+
+// NewCounterVec registers a new family of counters.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{newGaugeVec(name, help, "counter", labelNames)}
+	r.register(c.GaugeVec)
+	return c
+}
+
+// Set sets the gauge with the given label values, in the order of the label
+// names.
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[seriesKey(labelValues)] = value
+}
+
+// Reset removes all gauges, e.g. so that ones which are no longer set don't
+// linger.
+func (g *GaugeVec) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values = map[string]float64{}
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeHeader(w, g.name, g.help, g.typ)
+	for _, key := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labelNames, splitSeriesKey(key)), formatValue(g.values[key]))
+	}
+}
+
+// seriesKey joins label values with a byte which can't appear in UTF-8 text.
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func splitSeriesKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// formatLabels formats e.g. {container="foo",resource="cpu"}.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := []string{}
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escape.Replace(value)))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// HistogramVec is a family of histograms, which are told apart by their
+// labels.  Unlike gauges and counters, it is fed single observations.
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	// The upper bounds of the buckets, in increasing order.  The +Inf
+	// bucket is implied.
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram // By label values, see seriesKey.
+}
+
+type histogram struct {
+	// counts[i] is the number of observations in buckets[i], or in the +Inf
+	// bucket for the last one.  They are made cumulative when written.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a new family of histograms with the given bucket
+// upper bounds, which are sorted.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    sorted,
+		series:     map[string]*histogram{},
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds a value to the histogram with the given label values, in the
+// order of the label names.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := seriesKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	s.counts[sort.SearchFloat64s(h.buckets, value)]++
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	keys := []string{}
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		values := splitSeriesKey(key)
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatValue(h.buckets[i])
+			}
+			labels := formatLabels(append(append([]string{}, h.labelNames...), "le"), append(append([]string{}, values...), le))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, cumulative)
+		}
+		labels := formatLabels(h.labelNames, values)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	}
+}
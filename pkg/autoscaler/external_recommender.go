@@ -0,0 +1,89 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/recommender"
+)
+
+// recommendExternally asks the external recommender for the resources of the
+// configured containers, bounded by the config.  If it fails, its last
+// recommendation is reused; if it has never succeeded, nothing is applied
+// and ok is false.
+func (s *AutoScaler) recommendExternally(ctx context.Context, clusterSize *k8sclient.ClusterSize) (reqs map[string]apiv1.ResourceRequirements, ok bool) {
+	reqs, err := s.recommender.Recommend(ctx, &recommender.Request{
+		Target:      s.target,
+		Namespace:   s.namespace,
+		Containers:  sortedConfigNames(s.currentConfig),
+		ClusterSize: recommender.NewClusterSize(clusterSize),
+	})
+	if err != nil {
+		if s.lastExternalReqs == nil {
+			glog.Errorf("External recommender failed, and has never succeeded, not updating: %v", err)
+			return nil, false
+		}
+		glog.Errorf("External recommender failed, reusing its last recommendation: %v", err)
+		return s.lastExternalReqs, true
+	}
+	boundRequirements(s.currentConfig, reqs)
+	s.lastExternalReqs = reqs
+	return reqs, true
+}
+
+// boundRequirements raises each quantity in reqs to the base, and caps it at
+// the max, of its resource in cfg, if any.
+func boundRequirements(cfg ScaleConfig, reqs map[string]apiv1.ResourceRequirements) {
+	for ctr, res := range reqs {
+		ctrcfg := cfg[ctr]
+		for _, kind := range []struct {
+			name string
+			cfgs map[string]ResourceScaleConfig
+			list apiv1.ResourceList
+		}{
+			{"requests", ctrcfg.Requests, res.Requests},
+			{"limits", ctrcfg.Limits, res.Limits},
+		} {
+			for name, q := range kind.list {
+				rcfg, found := kind.cfgs[string(name)]
+				if !found {
+					continue
+				}
+				want := q.MilliValue()
+				if rcfg.Base != nil && want < asInt64(rcfg.Base) {
+					want = asInt64(rcfg.Base)
+				}
+				if rcfg.Max != nil && asInt64(rcfg.Max) > 0 && want > asInt64(rcfg.Max) {
+					want = asInt64(rcfg.Max)
+				}
+				if want == q.MilliValue() {
+					continue
+				}
+				r := resource.NewQuantity(0, guessFormat(string(name)))
+				r.SetMilli(want)
+				glog.V(2).Infof("Bounded the recommended %s %s[%q] of %v to %v", ctr, kind.name, name, q.String(), r)
+				kind.list[name] = *r
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/recommender"
+)
+
+func TestPollExternalRecommender(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "max": "2", "step": "10m", "coresPerStep": 4}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	response := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if response == "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+	external, err := recommender.NewHTTPRecommender(server.URL, time.Second, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16}
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		defaultTarget: "deployment/foo",
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+		recommender:   external,
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+	for i, step := range []struct {
+		response   string
+		expUpdates int
+		expCPU     string
+	}{
+		// Nothing is applied until the recommender has answered.
+		{"", 0, ""},
+		{`{"resources": {"foo": {"requests": {"cpu": "50m"}}}}`, 1, "100m"},
+		{`{"resources": {"foo": {"requests": {"cpu": "1500m"}}}}`, 2, "1500m"},
+		// Capped at the max.
+		{`{"resources": {"foo": {"requests": {"cpu": "5"}}}}`, 3, "2"},
+		// The last recommendation is reused.
+		{"", 3, "2"},
+		{`{"resources": {"foo": {"requests": {"cpu": "-1"}}}}`, 3, "2"},
+	} {
+		response = step.response
+		autoScaler.pollAPIServer(context.Background())
+		if len(mockK8s.Updates) != step.expUpdates {
+			t.Errorf("step %d: expected %d updates, got %d", i, step.expUpdates, len(mockK8s.Updates))
+		}
+		if step.expCPU == "" {
+			continue
+		}
+		cpu := autoScaler.lastReqs["foo"].Requests["cpu"]
+		if cpu.String() != step.expCPU {
+			t.Errorf("step %d: expected cpu %s, got %s", i, step.expCPU, cpu.String())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/cpvapb"
+)
+
+// Server implements the Recommendations service.
+type Server struct {
+	cpvapb.UnimplementedRecommendationsServer
+	store *Store
+}
+
+// NewServer returns a server for the recommendations in store.
+func NewServer(store *Store) *Server {
+	return &Server{store: store}
+}
+
+// Start serves the recommendations in store at addr, e.g. ":9103", without
+// TLS, until the process exits.  It returns the address it listens on.
+func Start(addr string, store *Store) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't serve gRPC on %q: %v", addr, err)
+	}
+	srv := grpc.NewServer()
+	cpvapb.RegisterRecommendationsServer(srv, NewServer(store))
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			glog.Errorf("Stopped serving gRPC: %v", err)
+		}
+	}()
+	return l.Addr(), nil
+}
+
+// GetRecommendation returns the current recommendation.
+func (s *Server) GetRecommendation(ctx context.Context, req *cpvapb.GetRecommendationRequest) (*cpvapb.Recommendation, error) {
+	rec, _ := s.store.Get()
+	if rec == nil {
+		return nil, status.Error(codes.Unavailable, "no recommendation yet")
+	}
+	return rec.Proto(), nil
+}
+
+// WatchRecommendations sends every recommendation until the client goes
+// away.
+func (s *Server) WatchRecommendations(req *cpvapb.WatchRecommendationsRequest, stream cpvapb.Recommendations_WatchRecommendationsServer) error {
+	for {
+		rec, changed := s.store.Get()
+		if rec != nil {
+			if err := stream.Send(rec.Proto()); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
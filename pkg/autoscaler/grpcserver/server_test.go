@@ -0,0 +1,118 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/cpvapb"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// newClient starts a server for store, and returns a client of it, and its
+// connection.
+func newClient(t *testing.T, store *Store) (cpvapb.RecommendationsClient, *grpc.ClientConn) {
+	addr, err := Start("127.0.0.1:0", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.NewClient(addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cpvapb.NewRecommendationsClient(conn), conn
+}
+
+func testRecommendation(nodes int) *Recommendation {
+	return &Recommendation{
+		Timestamp:   time.Unix(1, 0),
+		ClusterSize: k8sclient.ClusterSize{Nodes: nodes, Cores: 4 * nodes},
+		Resources: map[string]apiv1.ResourceRequirements{
+			"foo": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+		},
+	}
+}
+
+func TestGetRecommendation(t *testing.T) {
+	store := NewStore()
+	client, conn := newClient(t, store)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.GetRecommendation(ctx, &cpvapb.GetRecommendationRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected UNAVAILABLE before the first recommendation, got %v", err)
+	}
+
+	store.Set(testRecommendation(3))
+	got, err := client.GetRecommendation(ctx, &cpvapb.GetRecommendationRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &cpvapb.Recommendation{
+		TimestampUnixNanos: 1e9,
+		ClusterSize:        &cpvapb.ClusterSize{Nodes: 3, Cores: 12},
+		Containers:         []*cpvapb.ContainerResources{{Name: "foo", Requests: map[string]string{"cpu": "100m"}}},
+	}
+	if !proto.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestWatchRecommendations(t *testing.T) {
+	store := NewStore()
+	client, conn := newClient(t, store)
+	defer conn.Close()
+	store.Set(testRecommendation(3))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchRecommendations(ctx, &cpvapb.WatchRecommendationsRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec, err := stream.Recv(); err != nil || rec.ClusterSize.Nodes != 3 {
+		t.Errorf("expected the current recommendation first, got %v, %v", rec, err)
+	}
+	store.Set(testRecommendation(5))
+	if rec, err := stream.Recv(); err != nil || rec.ClusterSize.Nodes != 5 {
+		t.Errorf("expected the new recommendation, got %v, %v", rec, err)
+	}
+}
+
+func TestProto(t *testing.T) {
+	rec := &Recommendation{ClusterSize: k8sclient.ClusterSize{Nodes: 1}}
+	data, err := proto.Marshal(rec.Proto())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// cluster_size (2) holding nodes (1) = 1; no timestamp or containers.
+	expected := []byte{0x12, 0x02, 0x08, 0x01}
+	if string(data) != string(expected) {
+		t.Errorf("expected %x, got %x", expected, data)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package grpcserver serves the autoscaler's recommendations over gRPC, as
+// described by recommendations.proto.
+package grpcserver
+
+import (
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/cpvapb"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// Recommendation is the cluster size and the resources computed from it.
+type Recommendation struct {
+	Timestamp   time.Time
+	ClusterSize k8sclient.ClusterSize
+	Resources   map[string]apiv1.ResourceRequirements
+}
+
+// Proto returns the recommendation as a message of recommendations.proto.
+func (r *Recommendation) Proto() *cpvapb.Recommendation {
+	msg := &cpvapb.Recommendation{
+		ClusterSize: &cpvapb.ClusterSize{
+			Nodes:            int64(r.ClusterSize.Nodes),
+			Cores:            int64(r.ClusterSize.Cores),
+			MatchingPods:     int64(r.ClusterSize.MatchingPods),
+			PendingPods:      int64(r.ClusterSize.PendingPods),
+			AverageNodeCores: int64(r.ClusterSize.AverageNodeCores),
+		},
+		Containers: cpvapb.ContainerResourcesOf(r.Resources),
+	}
+	if !r.Timestamp.IsZero() {
+		msg.TimestampUnixNanos = r.Timestamp.UnixNano()
+	}
+	return msg
+}
+
+// Store holds the latest recommendation, and lets watchers wait for the next
+// one.
+type Store struct {
+	mu      sync.Mutex
+	current *Recommendation
+	changed chan struct{}
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{changed: make(chan struct{})}
+}
+
+// Set replaces the recommendation, and wakes up all watchers.
+func (s *Store) Set(r *Recommendation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = r
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Get returns the current recommendation, or nil if there is none yet, and a
+// channel which is closed when it is replaced.
+func (s *Store) Get() (*Recommendation, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current, s.changed
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/golang/glog"
+)
+
+// ArgoCDManagedByAnnotation is the annotation of a target which Argo CD
+// manages.  Its value names the Application, as "NAME" or "NAMESPACE/NAME";
+// the namespace defaults to DefaultArgoCDNamespace.
+const ArgoCDManagedByAnnotation = "argocd.argoproj.io/managed-by"
+
+// ArgoCDGroupVersion is the API of Argo CD Applications.
+const ArgoCDGroupVersion = "argoproj.io/v1alpha1"
+
+// DefaultArgoCDNamespace is where Argo CD Applications are by default.
+const DefaultArgoCDNamespace = "argocd"
+
+// DefaultArgoCDHelmParameter is the name of the Helm parameter of each
+// resource, see HelmParameterName.
+const DefaultArgoCDHelmParameter = "{container}.resources.{kind}.{resource}"
+
+// argoApplication holds the parts of an Argo CD Application that we read.
+type argoApplication struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Source *struct {
+			Helm *struct {
+				Parameters []argoHelmParameter `json:"parameters,omitempty"`
+			} `json:"helm,omitempty"`
+		} `json:"source,omitempty"`
+	} `json:"spec"`
+}
+
+type argoHelmParameter struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	ForceString bool   `json:"forceString,omitempty"`
+}
+
+// ValidateHelmParameter checks that a Helm parameter template tells the
+// requests and limits of every resource apart.
+func ValidateHelmParameter(template string) error {
+	for _, placeholder := range []string{"{kind}", "{resource}"} {
+		if !strings.Contains(template, placeholder) {
+			return fmt.Errorf("Helm parameter %q must contain %s", template, placeholder)
+		}
+	}
+	return nil
+}
+
+// HelmParameterName fills in the {container}, {kind} ("requests" or
+// "limits") and {resource} placeholders of template.  Dots in the names are
+// escaped, so that e.g. "nvidia.com/gpu" stays one key for Helm.
+func HelmParameterName(template, container, kind string, resource apiv1.ResourceName) string {
+	escape := strings.NewReplacer(".", `\.`)
+	return strings.NewReplacer(
+		"{container}", escape.Replace(container),
+		"{kind}", kind,
+		"{resource}", escape.Replace(string(resource)),
+	).Replace(template)
+}
+
+// parseArgoCDApplication splits the value of ArgoCDManagedByAnnotation into
+// the namespace and name of the Application.
+func parseArgoCDApplication(ref string) (namespace, name string, err error) {
+	parts := strings.Split(ref, "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return DefaultArgoCDNamespace, parts[0], nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return parts[0], parts[1], nil
+	}
+	return "", "", fmt.Errorf("%s %q must be NAME or NAMESPACE/NAME", ArgoCDManagedByAnnotation, ref)
+}
+
+// mergeHelmParameters sets the parameter of every resource in resources,
+// keeping the order and the other parameters of params.  New parameters are
+// added at the end, sorted.
+func mergeHelmParameters(params []argoHelmParameter, template string, resources map[string]apiv1.ResourceRequirements) ([]argoHelmParameter, error) {
+	values := map[string]string{}
+	for ctr, reqs := range resources {
+		for _, list := range []struct {
+			kind string
+			list apiv1.ResourceList
+		}{
+			{"requests", reqs.Requests},
+			{"limits", reqs.Limits},
+		} {
+			for res, q := range list.list {
+				name := HelmParameterName(template, ctr, list.kind, res)
+				if _, found := values[name]; found {
+					return nil, fmt.Errorf("Helm parameter %q is set for two resources, add {container} to the parameter template", name)
+				}
+				values[name] = q.String()
+			}
+		}
+	}
+	merged := []argoHelmParameter{}
+	for _, p := range params {
+		if v, found := values[p.Name]; found {
+			p.Value = v
+			delete(values, p.Name)
+		}
+		merged = append(merged, p)
+	}
+	added := []string{}
+	for name := range values {
+		added = append(added, name)
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		merged = append(merged, argoHelmParameter{Name: name, Value: values[name]})
+	}
+	return merged, nil
+}
+
+// argoCDPatch returns a merge patch which sets the Helm parameters of an
+// Application.  It fails if the Application changed since resourceVersion.
+func argoCDPatch(resourceVersion string, params []argoHelmParameter) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": resourceVersion},
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{
+				"helm": map[string]interface{}{"parameters": params},
+			},
+		},
+	})
+}
+
+// argoCDPath returns the path of an Argo CD Application.
+func argoCDPath(namespace, name string) []string {
+	return []string{"/apis", ArgoCDGroupVersion, "namespaces", namespace, "applications", name}
+}
+
+// updateArgoCDApplication writes resources as Helm parameters of the Argo CD
+// Application ref, instead of patching the target, whose changes Argo CD
+// would revert.  current are the target's resources, for dry-run output.
+func (k *k8sClient) updateArgoCDApplication(ref string, resources, current map[string]apiv1.ResourceRequirements) error {
+	namespace, name, err := parseArgoCDApplication(ref)
+	if err != nil {
+		return err
+	}
+	data, err := k.clientset.Discovery().RESTClient().Get().
+		AbsPath(argoCDPath(namespace, name)...).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("can't get Argo CD Application %s/%s: %v", namespace, name, err)
+	}
+	app := &argoApplication{}
+	if err := json.Unmarshal(data, app); err != nil {
+		return fmt.Errorf("can't decode Argo CD Application %s/%s: %v", namespace, name, err)
+	}
+	if app.Spec.Source == nil || app.Spec.Source.Helm == nil {
+		return fmt.Errorf("Argo CD Application %s/%s has no spec.source.helm to set parameters in", namespace, name)
+	}
+	params, err := mergeHelmParameters(app.Spec.Source.Helm.Parameters, k.argoCDHelmParameter, resources)
+	if err != nil {
+		return err
+	}
+	patch, err := argoCDPatch(app.ResourceVersion, params)
+	if err != nil {
+		return err
+	}
+
+	if k.dryRun {
+		glog.Infof("Performing dry-run, no updates will take affect.")
+		return k.dryRunFormatter.Format(k.dryRunOut, &DryRunPatch{
+			Target:      fmt.Sprintf("Application %s/%s", namespace, name),
+			PatchType:   types.MergePatchType,
+			Data:        patch,
+			Current:     current,
+			Recommended: resources,
+		})
+	}
+	_, err = k.clientset.Discovery().RESTClient().Patch(types.MergePatchType).
+		AbsPath(argoCDPath(namespace, name)...).
+		Body(patch).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("can't patch Argo CD Application %s/%s: %v", namespace, name, err)
+	}
+	glog.V(0).Infof("Set the Helm parameters of Argo CD Application %s/%s, which manages %s %s/%s",
+		namespace, name, k.target.Kind, k.target.Namespace, k.target.Name)
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestParseArgoCDApplication(t *testing.T) {
+	testCases := []struct {
+		ref          string
+		expNamespace string
+		expName      string
+		expError     bool
+	}{
+		{"dns", "argocd", "dns", false},
+		{"gitops/dns", "gitops", "dns", false},
+		{"", "", "", true},
+		{"gitops/", "", "", true},
+		{"/dns", "", "", true},
+		{"a/b/c", "", "", true},
+	}
+	for _, tc := range testCases {
+		namespace, name, err := parseArgoCDApplication(tc.ref)
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.ref, err)
+			continue
+		}
+		if namespace != tc.expNamespace || name != tc.expName {
+			t.Errorf("%q: expected %s/%s, got %s/%s", tc.ref, tc.expNamespace, tc.expName, namespace, name)
+		}
+	}
+}
+
+func TestHelmParameterName(t *testing.T) {
+	testCases := []struct {
+		template  string
+		container string
+		kind      string
+		resource  apiv1.ResourceName
+		expected  string
+	}{
+		{DefaultArgoCDHelmParameter, "coredns", "requests", apiv1.ResourceCPU, "coredns.resources.requests.cpu"},
+		{DefaultArgoCDHelmParameter, "dns.v2", "limits", "nvidia.com/gpu", `dns\.v2.resources.limits.nvidia\.com/gpu`},
+		{"resources.{kind}.{resource}", "coredns", "requests", apiv1.ResourceMemory, "resources.requests.memory"},
+	}
+	for _, tc := range testCases {
+		if name := HelmParameterName(tc.template, tc.container, tc.kind, tc.resource); name != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, name)
+		}
+	}
+
+	if err := ValidateHelmParameter(DefaultArgoCDHelmParameter); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, bad := range []string{"{container}.resources.{kind}", "{container}.{resource}", ""} {
+		if err := ValidateHelmParameter(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestMergeHelmParameters(t *testing.T) {
+	resources := map[string]apiv1.ResourceRequirements{
+		"dns": {
+			Requests: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse("300m"),
+				apiv1.ResourceMemory: resource.MustParse("70Mi"),
+			},
+			Limits: apiv1.ResourceList{
+				apiv1.ResourceMemory: resource.MustParse("170Mi"),
+			},
+		},
+	}
+	params := []argoHelmParameter{
+		{Name: "replicas", Value: "2"},
+		{Name: "dns.resources.requests.cpu", Value: "100m", ForceString: true},
+	}
+	merged, err := mergeHelmParameters(params, DefaultArgoCDHelmParameter, resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []argoHelmParameter{
+		{Name: "replicas", Value: "2"},
+		{Name: "dns.resources.requests.cpu", Value: "300m", ForceString: true},
+		{Name: "dns.resources.limits.memory", Value: "170Mi"},
+		{Name: "dns.resources.requests.memory", Value: "70Mi"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %+v, got %+v", expected, merged)
+	}
+
+	resources["sidecar"] = resources["dns"]
+	if _, err := mergeHelmParameters(params, "resources.{kind}.{resource}", resources); err == nil {
+		t.Errorf("expected an error for two containers with the same parameters")
+	}
+}
+
+func TestUpdateResourcesArgoCD(t *testing.T) {
+	var patch []byte
+	target := &targetObject{}
+	target.Annotations = map[string]string{ArgoCDManagedByAnnotation: "gitops/dns"}
+	target.Spec.Template.Spec.Containers = []apiv1.Container{{Name: "dns"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var obj interface{}
+		switch req.URL.Path {
+		case "/api":
+			obj = &metav1.APIVersions{Versions: []string{"apps/v1"}}
+		case "/apis/apps/v1":
+			obj = &metav1.APIResourceList{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{{Name: "deployments", Namespaced: true, Kind: "Deployment"}},
+			}
+		case "/apis/apps/v1/namespaces/kube-system/deployments/dns":
+			if req.Method != "GET" {
+				t.Errorf("unexpected %s of the target", req.Method)
+			}
+			obj = target
+		case "/apis/argoproj.io/v1alpha1/namespaces/gitops/applications/dns":
+			if req.Method == "PATCH" {
+				patch, _ = ioutil.ReadAll(req.Body)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"metadata": {"name": "dns", "namespace": "gitops", "resourceVersion": "42"},
+				"spec": {"source": {"helm": {"parameters": [{"name": "replicas", "value": "2"}]}}}}`))
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		output, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+	defer server.Close()
+
+	client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+	tgt, err := makeTarget(context.Background(), client, "deployment/dns", "kube-system", nil)
+	if err != nil {
+		t.Fatalf("error making target: %v", err)
+	}
+	k8scli := &k8sClient{
+		clientset:             client,
+		target:                tgt,
+		argoCDAnnotationCheck: true,
+		argoCDHelmParameter:   DefaultArgoCDHelmParameter,
+	}
+	resources := map[string]apiv1.ResourceRequirements{
+		"dns": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("300m")}},
+	}
+	if err := k8scli.UpdateResources(resources); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"metadata":{"resourceVersion":"42"},"spec":{"source":{"helm":{"parameters":[{"name":"replicas","value":"2"},{"name":"dns.resources.requests.cpu","value":"300m"}]}}}}`
+	if string(patch) != expected {
+		t.Errorf("expected patch %s, got %s", expected, patch)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// gpuResources are the extended resources which count as GPUs.
+var gpuResources = []apiv1.ResourceName{"nvidia.com/gpu", "amd.com/gpu"}
+
+// countGPUs returns the number of GPUs which the nodes report.
+func countGPUs(nodes []apiv1.Node) int {
+	total := 0
+	for _, node := range nodes {
+		for _, res := range gpuResources {
+			if q, found := node.Status.Capacity[res]; found {
+				total += int(q.Value())
+			}
+		}
+	}
+	return total
+}
+
+// metricValueList holds the parts of a custom.metrics.k8s.io MetricValueList
+// that we read.
+type metricValueList struct {
+	Items []struct {
+		Value resource.Quantity `json:"value"`
+	} `json:"items"`
+}
+
+// readCustomMetric reads the value of a metric of the target's namespace from
+// the custom metrics API, rounded up to a whole number.
+func (k *k8sClient) readCustomMetric(ctx context.Context, name string) (int, error) {
+	data, err := k.clientset.Discovery().RESTClient().Get().
+		AbsPath("/apis/custom.metrics.k8s.io/v1beta1/namespaces", k.namespace, "metrics", name).
+		SetHeader("Accept", "application/json").
+		Context(ctx).
+		DoRaw()
+	if err != nil {
+		return 0, fmt.Errorf("can't get custom metric %s: %v", name, err)
+	}
+	metrics := &metricValueList{}
+	if err := json.Unmarshal(data, metrics); err != nil {
+		return 0, fmt.Errorf("can't decode custom metric %s: %v", name, err)
+	}
+	if len(metrics.Items) == 0 {
+		return 0, fmt.Errorf("custom metric %s has no value for namespace %s", name, k.namespace)
+	}
+	return int(metrics.Items[0].Value.Value()), nil
+}
+
+// The cluster metrics which a ScaleMetric can be.
+const (
+	ScaleOnNodes  = "nodes"
+	ScaleOnCores  = "cores"
+	ScaleOnMemory = "memory"
+	ScaleOnPods   = "pods"
+	ScaleOnGPUs   = "gpus"
+	ScaleOnCustom = "custom"
+)
+
+// ScaleMetric is a cluster metric to scale on, see --scale-on.  The zero
+// value is the number of nodes.
+type ScaleMetric struct {
+	// One of the ScaleOn constants.
+	Kind string
+	// The name of the custom metric, with ScaleOnCustom.
+	Name string
+}
+
+// ParseScaleMetric parses "nodes", "cores", "memory", "pods", "gpus", or
+// "custom:NAME".
+func ParseScaleMetric(s string) (ScaleMetric, error) {
+	if strings.HasPrefix(s, ScaleOnCustom+":") {
+		name := strings.TrimPrefix(s, ScaleOnCustom+":")
+		if name == "" || strings.Contains(name, "/") {
+			return ScaleMetric{}, fmt.Errorf("invalid custom metric name %q", name)
+		}
+		return ScaleMetric{Kind: ScaleOnCustom, Name: name}, nil
+	}
+	switch s {
+	case ScaleOnNodes, ScaleOnCores, ScaleOnMemory, ScaleOnPods, ScaleOnGPUs:
+		return ScaleMetric{Kind: s}, nil
+	}
+	return ScaleMetric{}, fmt.Errorf("unknown metric %q: must be nodes, cores, memory, pods, gpus or custom:NAME", s)
+}
+
+func (m ScaleMetric) String() string {
+	if m.Kind == "" {
+		return ScaleOnNodes
+	}
+	if m.Kind == ScaleOnCustom {
+		return ScaleOnCustom + ":" + m.Name
+	}
+	return m.Kind
+}
+
+// Count returns the value of the metric m, where memory is in whole GiB,
+// rounded down, and pods are the matching pods.
+func (c *ClusterSize) Count(m ScaleMetric) int {
+	switch m.Kind {
+	case ScaleOnCores:
+		return c.Cores
+	case ScaleOnMemory:
+		// Value rounds up fractions of a byte, which don't matter here.
+		return int(c.Memory.Value() >> 30)
+	case ScaleOnPods:
+		return c.MatchingPods
+	case ScaleOnGPUs:
+		return c.GPUs
+	case ScaleOnCustom:
+		return c.CustomMetric
+	}
+	return c.Nodes
+}
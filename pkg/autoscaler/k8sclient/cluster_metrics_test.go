@@ -0,0 +1,140 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestParseScaleMetric(t *testing.T) {
+	testCases := []struct {
+		in       string
+		exp      ScaleMetric
+		expError bool
+	}{
+		{"nodes", ScaleMetric{Kind: ScaleOnNodes}, false},
+		{"cores", ScaleMetric{Kind: ScaleOnCores}, false},
+		{"memory", ScaleMetric{Kind: ScaleOnMemory}, false},
+		{"pods", ScaleMetric{Kind: ScaleOnPods}, false},
+		{"gpus", ScaleMetric{Kind: ScaleOnGPUs}, false},
+		{"custom:queue_length", ScaleMetric{Kind: ScaleOnCustom, Name: "queue_length"}, false},
+		{"custom:", ScaleMetric{}, true},
+		{"custom:a/b", ScaleMetric{}, true},
+		{"Nodes", ScaleMetric{}, true},
+		{"", ScaleMetric{}, true},
+	}
+	for _, tc := range testCases {
+		m, err := ParseScaleMetric(tc.in)
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tc.in, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+			continue
+		}
+		if m != tc.exp {
+			t.Errorf("%q: expected %v, got %v", tc.in, tc.exp, m)
+		}
+		if m.String() != tc.in {
+			t.Errorf("%q: expected it back, got %q", tc.in, m.String())
+		}
+	}
+}
+
+func TestGetClusterSizeGPUs(t *testing.T) {
+	withGPUs := func(res apiv1.ResourceName, n string) apiv1.Node {
+		node := nodeWithCPU("8")
+		node.Status.Capacity[res] = resource.MustParse(n)
+		return node
+	}
+	server := newNodeServer(t, []apiv1.Node{
+		nodeWithCPU("8"),
+		withGPUs("nvidia.com/gpu", "4"),
+		withGPUs("amd.com/gpu", "2"),
+		withGPUs("example.com/fpga", "1"),
+	})
+	defer server.Close()
+
+	k8scli := &k8sClient{
+		clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+	}
+	sz, err := k8scli.GetClusterSize()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sz.GPUs != 6 {
+		t.Errorf("expected 6 GPUs, got %d", sz.GPUs)
+	}
+	if n := sz.Count(ScaleMetric{Kind: ScaleOnGPUs}); n != 6 {
+		t.Errorf("expected to count 6 GPUs, got %d", n)
+	}
+}
+
+func TestReadCustomMetric(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		code     int
+		exp      int
+		expError bool
+	}{
+		{"value", `{"items": [{"metricName": "queue_length", "value": "42"}]}`, http.StatusOK, 42, false},
+		{"rounded up", `{"items": [{"metricName": "queue_length", "value": "1500m"}]}`, http.StatusOK, 2, false},
+		{"no value", `{"items": []}`, http.StatusOK, 0, true},
+		{"not served", `{}`, http.StatusNotFound, 0, true},
+	}
+	for _, tc := range testCases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/apis/custom.metrics.k8s.io/v1beta1/namespaces/kube-system/metrics/queue_length" {
+				t.Errorf("%s: unexpected request for %s", tc.name, req.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(tc.code)
+			w.Write([]byte(tc.body))
+		}))
+		k8scli := &k8sClient{
+			namespace: "kube-system",
+			clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+		}
+		n, err := k8scli.readCustomMetric(context.Background(), "queue_length")
+		server.Close()
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %d", tc.name, n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if n != tc.exp {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.exp, n)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// ClusterSizeProvider measures the size of the cluster.  Every K8sClient is
+// one.
+type ClusterSizeProvider interface {
+	GetClusterSizeWithContext(ctx context.Context) (*ClusterSize, error)
+}
+
+// CachingClusterSizeProvider returns the last cluster size of another
+// provider for a while, instead of listing the nodes again, e.g. when the
+// poll period is short or HPA events trigger extra polls.  Errors are not
+// cached.
+type CachingClusterSizeProvider struct {
+	provider ClusterSizeProvider
+	ttl      time.Duration
+	clock    clock.Clock
+
+	mu      sync.RWMutex
+	cached  *ClusterSize
+	fetched time.Time
+	// The number of sizes returned from the cache, and from the provider.
+	hits   int
+	misses int
+}
+
+// NewCachingClusterSizeProvider returns a provider which caches the cluster
+// sizes of provider for ttl.
+func NewCachingClusterSizeProvider(provider ClusterSizeProvider, ttl time.Duration, clock clock.Clock) *CachingClusterSizeProvider {
+	return &CachingClusterSizeProvider{provider: provider, ttl: ttl, clock: clock}
+}
+
+// GetClusterSizeWithContext returns the cached cluster size if it was fetched
+// within the TTL, and fetches it otherwise.  Callers get their own copy,
+// which they may change.
+func (c *CachingClusterSizeProvider) GetClusterSizeWithContext(ctx context.Context) (*ClusterSize, error) {
+	if size := c.fresh(); size != nil {
+		return size, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another caller may have fetched it in the meantime.
+	if c.cached != nil && c.clock.Since(c.fetched) < c.ttl {
+		c.hits++
+		return copyClusterSize(c.cached), nil
+	}
+	size, err := c.provider.GetClusterSizeWithContext(ctx)
+	c.misses++
+	if err != nil {
+		return nil, err
+	}
+	c.cached = copyClusterSize(size)
+	c.fetched = c.clock.Now()
+	return size, nil
+}
+
+// fresh returns a copy of the cached cluster size if it is within the TTL,
+// and counts the hit.
+func (c *CachingClusterSizeProvider) fresh() *ClusterSize {
+	c.mu.RLock()
+	if c.cached == nil || c.clock.Since(c.fetched) >= c.ttl {
+		c.mu.RUnlock()
+		return nil
+	}
+	size := copyClusterSize(c.cached)
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	c.hits++
+	c.mu.Unlock()
+	return size
+}
+
+// Invalidate drops the cached cluster size, so that the next call fetches it
+// again.
+func (c *CachingClusterSizeProvider) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cached = nil
+}
+
+// CacheHitRatio returns the fraction of cluster sizes which were returned
+// from the cache, or 0 if none were returned yet.
+func (c *CachingClusterSizeProvider) CacheHitRatio() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.hits+c.misses == 0 {
+		return 0
+	}
+	return float64(c.hits) / float64(c.hits+c.misses)
+}
+
+func copyClusterSize(size *ClusterSize) *ClusterSize {
+	out := *size
+	out.Memory = size.Memory.DeepCopy()
+	return &out
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// countingProvider returns a cluster size of as many nodes as it was called,
+// or err.
+type countingProvider struct {
+	calls int
+	err   error
+}
+
+func (p *countingProvider) GetClusterSizeWithContext(ctx context.Context) (*ClusterSize, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &ClusterSize{Nodes: p.calls, Memory: resource.MustParse("1Gi")}, nil
+}
+
+func TestCachingClusterSizeProvider(t *testing.T) {
+	provider := &countingProvider{}
+	clk := clock.NewFakeClock(time.Now())
+	cache := NewCachingClusterSizeProvider(provider, time.Minute, clk)
+	ctx := context.Background()
+
+	steps := []struct {
+		advance  time.Duration
+		err      error
+		expNodes int
+		expError bool
+		expRatio float64
+	}{
+		{0, nil, 1, false, 0},
+		{30 * time.Second, nil, 1, false, 0.5},
+		{29 * time.Second, nil, 1, false, 2.0 / 3},
+		// Expired.
+		{time.Second, nil, 2, false, 0.5},
+		// Errors are not cached.
+		{time.Minute, fmt.Errorf("unreachable"), 0, true, 0.4},
+		{0, nil, 4, false, 2.0 / 6},
+		{0, nil, 4, false, 3.0 / 7},
+	}
+	for i, step := range steps {
+		clk.Step(step.advance)
+		provider.err = step.err
+		size, err := cache.GetClusterSizeWithContext(ctx)
+		if step.expError {
+			if err == nil {
+				t.Errorf("step %d: expected an error", i)
+			}
+		} else if err != nil {
+			t.Errorf("step %d: unexpected error: %v", i, err)
+		} else {
+			if size.Nodes != step.expNodes {
+				t.Errorf("step %d: expected %d nodes, got %d", i, step.expNodes, size.Nodes)
+			}
+			// Callers may adjust their copy.
+			size.Nodes = 100
+			size.Memory.Add(resource.MustParse("1Gi"))
+		}
+		if got := cache.CacheHitRatio(); got != step.expRatio {
+			t.Errorf("step %d: expected hit ratio %v, got %v", i, step.expRatio, got)
+		}
+	}
+	size, _ := cache.GetClusterSizeWithContext(ctx)
+	if exp := resource.MustParse("1Gi"); size.Memory.Cmp(exp) != 0 {
+		t.Errorf("expected the cached memory to be unchanged, got %s", size.Memory.String())
+	}
+}
+
+func TestCachingClusterSizeProviderConcurrent(t *testing.T) {
+	provider := &countingProvider{}
+	cache := NewCachingClusterSizeProvider(provider, time.Hour, clock.NewFakeClock(time.Now()))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.GetClusterSizeWithContext(context.Background()); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if provider.calls != 1 {
+		t.Errorf("expected the nodes to be listed once, got %d", provider.calls)
+	}
+	if got, exp := cache.CacheHitRatio(), 19.0/20; got != exp {
+		t.Errorf("expected hit ratio %v, got %v", exp, got)
+	}
+}
+
+func TestCachingClusterSizeProviderInvalidate(t *testing.T) {
+	provider := &countingProvider{}
+	cache := NewCachingClusterSizeProvider(provider, time.Minute, clock.NewFakeClock(time.Now()))
+	ctx := context.Background()
+	for i, expNodes := range []int{1, 1, 2} {
+		if i == 2 {
+			cache.Invalidate()
+		}
+		size, err := cache.GetClusterSizeWithContext(ctx)
+		if err != nil {
+			t.Fatalf("call %d: unexpected error: %v", i, err)
+		}
+		if size.Nodes != expNodes {
+			t.Errorf("call %d: expected %d nodes, got %d", i, expNodes, size.Nodes)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// clusterSource is another cluster whose nodes are counted into the cluster
+// size, along with the nodes of the target's cluster.
+type clusterSource struct {
+	// For logs, e.g. "/etc/fleet/kubeconfig#eu-west".
+	name      string
+	clientset kubernetes.Interface
+}
+
+// ParseClusterSource splits an additional cluster, given as
+// "KUBECONFIG[#CONTEXT]", into the kubeconfig path and the context, which is
+// empty for the kubeconfig's current context.
+func ParseClusterSource(entry string) (kubeconfig, context string, err error) {
+	parts := strings.SplitN(entry, "#", 2)
+	kubeconfig = strings.TrimSpace(parts[0])
+	if len(parts) == 2 {
+		context = strings.TrimSpace(parts[1])
+		if context == "" {
+			return "", "", fmt.Errorf("invalid cluster %q: empty context after '#'", entry)
+		}
+	}
+	if kubeconfig == "" {
+		return "", "", fmt.Errorf("invalid cluster %q: must be KUBECONFIG[#CONTEXT]", entry)
+	}
+	return kubeconfig, context, nil
+}
+
+func newClusterSource(entry, contentType string) (*clusterSource, error) {
+	kubeconfig, context, err := ParseClusterSource(entry)
+	if err != nil {
+		return nil, err
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("can't load cluster %q: %v", entry, err)
+	}
+	config.UserAgent = userAgent()
+	if err := setContentType(config, contentType); err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("can't create a client for cluster %q: %v", entry, err)
+	}
+	return &clusterSource{name: entry, clientset: clientset}, nil
+}
+
+// listNodes lists all nodes of a cluster.
+func listNodes(ctx context.Context, client kubernetes.Interface) ([]apiv1.Node, error) {
+	nodes, err := listNodeList(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return nodes.Items, nil
+}
+
+// listNodeList is like listNodes, but also returns the resource version of
+// the list, to watch from.
+func listNodeList(ctx context.Context, client kubernetes.Interface) (*apiv1.NodeList, error) {
+	opt := metav1.ListOptions{Watch: false}
+
+	// The typed Nodes() client does not take a context, so build the same
+	// request by hand.
+	nodes := &apiv1.NodeList{}
+	err := client.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		VersionedParams(&opt, scheme.ParameterCodec).
+		Context(ctx).
+		Do().
+		Into(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
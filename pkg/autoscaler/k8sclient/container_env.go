@@ -0,0 +1,122 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SetContainerEnv sets the environment variables, by container name, which
+// the next updates set on the containers along with their resources.  Nil
+// stops setting any.
+func (k *k8sClient) SetContainerEnv(env map[string][]apiv1.EnvVar) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.containerEnv = env
+}
+
+// envChanges returns the variables of env, by container name, which the
+// containers in resources don't have yet, or have with another value.
+func envChanges(current []apiv1.Container, resources map[string]apiv1.ResourceRequirements, env map[string][]apiv1.EnvVar) map[string][]apiv1.EnvVar {
+	changes := map[string][]apiv1.EnvVar{}
+	for _, ctr := range current {
+		if _, patched := resources[ctr.Name]; !patched {
+			continue
+		}
+		for _, v := range env[ctr.Name] {
+			if j := envIndex(ctr.Env, v.Name); j >= 0 && ctr.Env[j].ValueFrom == nil && ctr.Env[j].Value == v.Value {
+				continue
+			}
+			changes[ctr.Name] = append(changes[ctr.Name], v)
+		}
+	}
+	return changes
+}
+
+// envIndex returns the index of the variable called name in env, or -1.
+func envIndex(env []apiv1.EnvVar, name string) int {
+	for j, v := range env {
+		if v.Name == name {
+			return j
+		}
+	}
+	return -1
+}
+
+// addContainerEnv adds the environment variables of the containers to a
+// patch of their resources.  Variables which the containers already have are
+// replaced, and a valueFrom of theirs with them.
+func addContainerEnv(pt types.PatchType, data []byte, current []apiv1.Container, env map[string][]apiv1.EnvVar, path ContainerPath) ([]byte, error) {
+	if len(env) == 0 {
+		return data, nil
+	}
+	switch pt {
+	case types.JSONPatchType:
+		ops := []interface{}{}
+		if err := json.Unmarshal(data, &ops); err != nil {
+			return nil, err
+		}
+		for i, ctr := range current {
+			vars := env[ctr.Name]
+			if len(vars) == 0 {
+				continue
+			}
+			prefix := fmt.Sprintf("%s/%d/env", path.Pointer(), i)
+			if ctr.Env == nil {
+				ops = append(ops, map[string]interface{}{"op": "add", "path": prefix, "value": vars})
+				continue
+			}
+			for _, v := range vars {
+				if j := envIndex(ctr.Env, v.Name); j >= 0 {
+					ops = append(ops, map[string]interface{}{"op": "replace", "path": fmt.Sprintf("%s/%d", prefix, j), "value": v})
+				} else {
+					ops = append(ops, map[string]interface{}{"op": "add", "path": prefix + "/-", "value": v})
+				}
+			}
+		}
+		return json.Marshal(ops)
+	case types.StrategicMergePatchType:
+		patch := map[string]interface{}{}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return nil, err
+		}
+		fields := path.fields()
+		obj := nestedMap(patch, fields[:len(fields)-1]...)
+		ctrs, _ := obj[fields[len(fields)-1]].([]interface{})
+		for _, c := range ctrs {
+			ctr, _ := c.(map[string]interface{})
+			name, _ := ctr["name"].(string)
+			vars := env[name]
+			if len(vars) == 0 {
+				continue
+			}
+			// The env of a container is merged by name, and a valueFrom of
+			// the same variable has to be deleted explicitly.
+			merged := []interface{}{}
+			for _, v := range vars {
+				merged = append(merged, map[string]interface{}{"name": v.Name, "value": v.Value, "valueFrom": nil})
+			}
+			ctr["env"] = merged
+		}
+		return json.Marshal(patch)
+	}
+	return nil, fmt.Errorf("unsupported patch type %s", pt)
+}
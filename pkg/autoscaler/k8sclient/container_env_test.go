@@ -0,0 +1,86 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestAddContainerEnv(t *testing.T) {
+	resources := map[string]apiv1.ResourceRequirements{
+		"app":     {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+		"sidecar": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")}},
+	}
+	current := []apiv1.Container{
+		{Name: "sidecar"},
+		{Name: "app", Env: []apiv1.EnvVar{
+			{Name: "LOG_LEVEL", Value: "info"},
+			{Name: "CLUSTER_NODES", Value: "2"},
+			{Name: "CLUSTER_CORES", Value: "8"},
+		}},
+		{Name: "logger"},
+	}
+	// CLUSTER_CORES is already set, and the logger isn't patched.
+	vars := []apiv1.EnvVar{{Name: "CLUSTER_NODES", Value: "3"}, {Name: "CLUSTER_CORES", Value: "8"}, {Name: "CLUSTER_SIZE", Value: "small"}}
+	env := envChanges(current, resources, map[string][]apiv1.EnvVar{"app": vars, "sidecar": vars[:1], "logger": vars})
+	expected := map[string][]apiv1.EnvVar{
+		"app":     {{Name: "CLUSTER_NODES", Value: "3"}, {Name: "CLUSTER_SIZE", Value: "small"}},
+		"sidecar": {{Name: "CLUSTER_NODES", Value: "3"}},
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected %v, got %v", expected, env)
+	}
+
+	k8scli := &k8sClient{target: &targetSpec{Kind: "Deployment", GroupVersion: "apps/v1", Name: "thing"}}
+	pt, jb, err := k8scli.strategicMergeContainers(resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jb, err = addContainerEnv(pt, jb, current, env, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"thing"},"spec":{"template":{"spec":{"containers":[` +
+		`{"env":[{"name":"CLUSTER_NODES","value":"3","valueFrom":null},{"name":"CLUSTER_SIZE","value":"small","valueFrom":null}],"name":"app","resources":{"requests":{"cpu":"100m"}}},` +
+		`{"env":[{"name":"CLUSTER_NODES","value":"3","valueFrom":null}],"name":"sidecar","resources":{"requests":{"cpu":"10m"}}}]}}}}`
+	if string(jb) != exp {
+		t.Errorf("expected %s, got %s", exp, string(jb))
+	}
+
+	pt, jb, err = jsonPatchContainers(current, resources, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jb, err = addContainerEnv(pt, jb, current, env, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp = `[{"op":"test","path":"/spec/template/spec/containers/0/name","value":"sidecar"},` +
+		`{"op":"add","path":"/spec/template/spec/containers/0/resources","value":{"requests":{"cpu":"10m"}}},` +
+		`{"op":"test","path":"/spec/template/spec/containers/1/name","value":"app"},` +
+		`{"op":"add","path":"/spec/template/spec/containers/1/resources","value":{"requests":{"cpu":"100m"}}},` +
+		`{"op":"add","path":"/spec/template/spec/containers/0/env","value":[{"name":"CLUSTER_NODES","value":"3"}]},` +
+		`{"op":"replace","path":"/spec/template/spec/containers/1/env/1","value":{"name":"CLUSTER_NODES","value":"3"}},` +
+		`{"op":"add","path":"/spec/template/spec/containers/1/env/-","value":{"name":"CLUSTER_SIZE","value":"small"}}]`
+	if string(jb) != exp {
+		t.Errorf("expected %s, got %s", exp, string(jb))
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// DefaultContainerPath is where the built-in workload kinds keep the
+// containers of their pod template.
+const DefaultContainerPath = ".spec.template.spec.containers"
+
+// ContainerPath is the list of object fields which lead from the root of the
+// target to its containers array.  Nil stands for DefaultContainerPath.
+type ContainerPath []string
+
+// ParseContainerPath parses a path either in dotted form, e.g.
+// ".spec.template.spec.containers", or as a JSON Pointer, e.g.
+// "/spec/template/spec/containers".  An empty path is the default.
+func ParseContainerPath(s string) (ContainerPath, error) {
+	if s == "" || s == DefaultContainerPath {
+		return nil, nil
+	}
+	var fields []string
+	switch s[0] {
+	case '.':
+		fields = strings.Split(s[1:], ".")
+	case '/':
+		// RFC 6901 escapes "/" as "~1" and "~" as "~0", in that order.
+		unescape := strings.NewReplacer("~1", "/", "~0", "~")
+		for _, field := range strings.Split(s[1:], "/") {
+			fields = append(fields, unescape.Replace(field))
+		}
+	default:
+		return nil, fmt.Errorf("container path %q must start with \".\" or \"/\"", s)
+	}
+	for _, field := range fields {
+		if field == "" {
+			return nil, fmt.Errorf("container path %q has an empty field", s)
+		}
+	}
+	return ContainerPath(fields), nil
+}
+
+// fields returns the fields of the path, resolving the default.
+func (p ContainerPath) fields() []string {
+	if len(p) == 0 {
+		return []string{"spec", "template", "spec", "containers"}
+	}
+	return p
+}
+
+// isDefault returns whether the containers are where targetObject decodes
+// them from.
+func (p ContainerPath) isDefault() bool {
+	fields := p.fields()
+	return len(fields) == 4 && strings.Join(fields, ".") == "spec.template.spec.containers"
+}
+
+// Pointer returns the path as a JSON Pointer, e.g.
+// "/spec/template/spec/containers".
+func (p ContainerPath) Pointer() string {
+	escape := strings.NewReplacer("~", "~0", "/", "~1")
+	var buf strings.Builder
+	for _, field := range p.fields() {
+		buf.WriteString("/")
+		buf.WriteString(escape.Replace(field))
+	}
+	return buf.String()
+}
+
+// String returns the path in dotted form.
+func (p ContainerPath) String() string {
+	return "." + strings.Join(p.fields(), ".")
+}
+
+// nest returns an object with value at the path, e.g. for a merge patch.
+func (p ContainerPath) nest(value interface{}) map[string]interface{} {
+	fields := p.fields()
+	obj := map[string]interface{}{fields[len(fields)-1]: value}
+	for i := len(fields) - 2; i >= 0; i-- {
+		obj = map[string]interface{}{fields[i]: obj}
+	}
+	return obj
+}
+
+// containers decodes the containers array at the path of the JSON object in
+// data.  A missing array is an error, so that a wrong path is noticed.
+func (p ContainerPath) containers(data []byte) ([]apiv1.Container, error) {
+	raw := json.RawMessage(data)
+	for _, field := range p.fields() {
+		obj := map[string]json.RawMessage{}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("can't decode the containers at %s: %v", p, err)
+		}
+		next, found := obj[field]
+		if !found {
+			return nil, fmt.Errorf("no containers at %s: field %q not found", p, field)
+		}
+		raw = next
+	}
+	ctrs := []apiv1.Container{}
+	if err := json.Unmarshal(raw, &ctrs); err != nil {
+		return nil, fmt.Errorf("can't decode the containers at %s: %v", p, err)
+	}
+	return ctrs, nil
+}
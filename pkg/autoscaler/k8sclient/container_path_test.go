@@ -0,0 +1,188 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseContainerPath(t *testing.T) {
+	testCases := []struct {
+		path       string
+		expFields  []string
+		expPointer string
+		expError   bool
+	}{
+		{"", nil, "/spec/template/spec/containers", false},
+		{DefaultContainerPath, nil, "/spec/template/spec/containers", false},
+		{"/spec/template/spec/containers", []string{"spec", "template", "spec", "containers"}, "/spec/template/spec/containers", false},
+		{".spec.workload.containers", []string{"spec", "workload", "containers"}, "/spec/workload/containers", false},
+		{"/spec/example.com~1pod/containers", []string{"spec", "example.com/pod", "containers"}, "/spec/example.com~1pod/containers", false},
+		{"/spec/a~0b/containers", []string{"spec", "a~b", "containers"}, "/spec/a~0b/containers", false},
+		{"spec.containers", nil, "", true},
+		{".spec..containers", nil, "", true},
+		{"/spec/", nil, "", true},
+	}
+	for _, tc := range testCases {
+		path, err := ParseContainerPath(tc.path)
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", tc.path, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.path, err)
+			continue
+		}
+		if !reflect.DeepEqual([]string(path), tc.expFields) {
+			t.Errorf("%q: expected fields %q, got %q", tc.path, tc.expFields, []string(path))
+		}
+		if got := path.Pointer(); got != tc.expPointer {
+			t.Errorf("%q: expected pointer %s, got %s", tc.path, tc.expPointer, got)
+		}
+	}
+}
+
+func TestContainerPathContainers(t *testing.T) {
+	data := []byte(`{"spec": {"workload": {"containers": [{"name": "app", "resources": {"requests": {"cpu": "100m"}}}]}}}`)
+	path, err := ParseContainerPath(".spec.workload.containers")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctrs, err := path.containers(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ctrs) != 1 || ctrs[0].Name != "app" {
+		t.Fatalf("expected container app, got %+v", ctrs)
+	}
+	if cpu := ctrs[0].Resources.Requests[apiv1.ResourceCPU]; cpu.Cmp(resource.MustParse("100m")) != 0 {
+		t.Errorf("expected a request of 100m, got %s", cpu.String())
+	}
+
+	for _, missing := range []string{".spec.template.spec.containers", ".spec.workload", ".spec.workload.containers.name"} {
+		path, err := ParseContainerPath(missing)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ctrs, err := path.containers(data); err == nil {
+			t.Errorf("%s: expected error, got %+v", missing, ctrs)
+		}
+	}
+}
+
+func TestPatchContainersAtPath(t *testing.T) {
+	path, err := ParseContainerPath("/spec/workload/containers")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resources := map[string]apiv1.ResourceRequirements{
+		"app": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+	}
+
+	k8scli := &k8sClient{target: &targetSpec{Kind: "Workload", GroupVersion: "example.com/v1", Name: "thing", containerPath: path}}
+	_, jb, err := k8scli.strategicMergeContainers(resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := `{"apiVersion":"example.com/v1","kind":"Workload","metadata":{"name":"thing"},"spec":{"workload":{"containers":[{"name":"app","resources":{"requests":{"cpu":"100m"}}}]}}}`
+	if string(jb) != exp {
+		t.Errorf("expected %s, got %s", exp, string(jb))
+	}
+
+	_, jb, err = jsonPatchContainers([]apiv1.Container{{Name: "sidecar"}, {Name: "app"}}, resources, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp = `[{"op":"test","path":"/spec/workload/containers/1/name","value":"app"},{"op":"add","path":"/spec/workload/containers/1/resources","value":{"requests":{"cpu":"100m"}}}]`
+	if string(jb) != exp {
+		t.Errorf("expected %s, got %s", exp, string(jb))
+	}
+}
+
+func TestContainerPathTwoTemplates(t *testing.T) {
+	// A custom resource with a pod template for its workers and one for its
+	// controller, whose containers share a name.
+	data := []byte(`{"spec": {
+		"worker": {"template": {"spec": {"containers": [{"name": "app", "resources": {"requests": {"cpu": "1"}}}]}}},
+		"controller": {"template": {"spec": {"containers": [{"name": "sidecar"}, {"name": "app", "resources": {"requests": {"cpu": "100m"}}}]}}}}}`)
+	resources := map[string]apiv1.ResourceRequirements{
+		"app": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("200m")}},
+	}
+
+	for _, tc := range []struct {
+		path     string
+		expCPU   string
+		expMerge string
+		expJSON  string
+	}{
+		{
+			".spec.worker.template.spec.containers",
+			"1",
+			`{"apiVersion":"example.com/v1","kind":"Pipeline","metadata":{"name":"thing"},"spec":{"worker":{"template":{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"200m"}}}]}}}}}`,
+			`[{"op":"test","path":"/spec/worker/template/spec/containers/0/name","value":"app"},{"op":"add","path":"/spec/worker/template/spec/containers/0/resources","value":{"requests":{"cpu":"200m"}}}]`,
+		},
+		{
+			"/spec/controller/template/spec/containers",
+			"100m",
+			`{"apiVersion":"example.com/v1","kind":"Pipeline","metadata":{"name":"thing"},"spec":{"controller":{"template":{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"200m"}}}]}}}}}`,
+			`[{"op":"test","path":"/spec/controller/template/spec/containers/1/name","value":"app"},{"op":"add","path":"/spec/controller/template/spec/containers/1/resources","value":{"requests":{"cpu":"200m"}}}]`,
+		},
+	} {
+		path, err := ParseContainerPath(tc.path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.path, err)
+		}
+		ctrs, err := path.containers(data)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.path, err)
+		}
+		var app *apiv1.Container
+		for i := range ctrs {
+			if ctrs[i].Name == "app" {
+				app = &ctrs[i]
+			}
+		}
+		if app == nil {
+			t.Fatalf("%s: expected container app, got %+v", tc.path, ctrs)
+		}
+		if cpu := app.Resources.Requests[apiv1.ResourceCPU]; cpu.Cmp(resource.MustParse(tc.expCPU)) != 0 {
+			t.Errorf("%s: expected the app's request of %s, got %s", tc.path, tc.expCPU, cpu.String())
+		}
+
+		k8scli := &k8sClient{target: &targetSpec{Kind: "Pipeline", GroupVersion: "example.com/v1", Name: "thing", containerPath: path}}
+		_, jb, err := k8scli.strategicMergeContainers(resources)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.path, err)
+		}
+		if string(jb) != tc.expMerge {
+			t.Errorf("%s: expected %s, got %s", tc.path, tc.expMerge, string(jb))
+		}
+		_, jb, err = jsonPatchContainers(ctrs, resources, path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.path, err)
+		}
+		if string(jb) != tc.expJSON {
+			t.Errorf("%s: expected %s, got %s", tc.path, tc.expJSON, string(jb))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// CPUUtilizationProvider measures how much of the allocatable CPU of a
+// cluster's nodes is requested by the pods scheduled to them.
+//
+// The pods of all namespaces are read from the k8sClient's pod informer.
+type CPUUtilizationProvider struct {
+	pods *podInformer
+}
+
+// Measure returns the CPU requested by the pods on nodes, and the nodes'
+// allocatable CPU.
+func (p *CPUUtilizationProvider) Measure(ctx context.Context, nodes []apiv1.Node) (requested, allocatable resource.Quantity, err error) {
+	pods, err := p.pods.list(ctx, "", nil)
+	if err != nil {
+		return requested, allocatable, err
+	}
+	requested, allocatable = sumCPU(nodes, pods)
+	return requested, allocatable, nil
+}
+
+// sumCPU returns the CPU requested by those pods which are scheduled to one
+// of nodes, and the nodes' allocatable CPU.
+func sumCPU(nodes []apiv1.Node, pods []*apiv1.Pod) (requested, allocatable resource.Quantity) {
+	names := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		names[node.Name] = true
+		allocatable.Add(node.Status.Allocatable[apiv1.ResourceCPU])
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || !names[pod.Spec.NodeName] {
+			continue
+		}
+		requested.Add(podCPURequest(pod))
+	}
+	return requested, allocatable
+}
+
+// podCPURequest returns the CPU which the scheduler reserves for the pod: the
+// sum of its containers' requests, or the largest request of an init
+// container if that is more.
+func podCPURequest(pod *apiv1.Pod) resource.Quantity {
+	var sum resource.Quantity
+	for _, ctr := range pod.Spec.Containers {
+		sum.Add(ctr.Resources.Requests[apiv1.ResourceCPU])
+	}
+	for _, ctr := range pod.Spec.InitContainers {
+		if req := ctr.Resources.Requests[apiv1.ResourceCPU]; req.Cmp(sum) > 0 {
+			sum = req
+		}
+	}
+	return sum
+}
+
+// CPUUtilization returns requested as a percentage of allocatable, rounded
+// down.  With no allocatable CPU, e.g. before any node is ready, it is 0.
+func CPUUtilization(requested, allocatable resource.Quantity) int {
+	if allocatable.IsZero() {
+		if !requested.IsZero() {
+			glog.V(2).Infof("Counting a CPU utilization of 0, as there is no allocatable CPU for the %s requested", requested.String())
+		}
+		return 0
+	}
+	return int(requested.MilliValue() * 100 / allocatable.MilliValue())
+}
@@ -0,0 +1,198 @@
+/*
+ Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func allocatableNode(name, cpu string) apiv1.Node {
+	return apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: apiv1.NodeStatus{
+			Capacity:    apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu)},
+			Allocatable: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu)},
+		},
+	}
+}
+
+func podOn(node string, cpus ...string) apiv1.Pod {
+	pod := apiv1.Pod{Spec: apiv1.PodSpec{NodeName: node}}
+	for _, cpu := range cpus {
+		pod.Spec.Containers = append(pod.Spec.Containers, apiv1.Container{
+			Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu)}},
+		})
+	}
+	return pod
+}
+
+// holdWatch answers a watch in which nothing changes, until the informer
+// which started it stops.
+func holdWatch(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	<-req.Context().Done()
+}
+
+func TestCPUUtilization(t *testing.T) {
+	testCases := []struct {
+		requested   string
+		allocatable string
+		exp         int
+	}{
+		{"0", "8", 0},
+		{"2", "8", 25},
+		{"2500m", "8", 31},
+		{"8", "8", 100},
+		{"10", "8", 125},
+		{"0", "0", 0},
+		{"2", "0", 0},
+	}
+	for _, tc := range testCases {
+		if got := CPUUtilization(resource.MustParse(tc.requested), resource.MustParse(tc.allocatable)); got != tc.exp {
+			t.Errorf("%s of %s: expected %d%%, got %d%%", tc.requested, tc.allocatable, tc.exp, got)
+		}
+	}
+}
+
+func TestPodCPURequest(t *testing.T) {
+	withInit := func(pod apiv1.Pod, cpu string) apiv1.Pod {
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, apiv1.Container{
+			Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu)}},
+		})
+		return pod
+	}
+	testCases := []struct {
+		name string
+		pod  apiv1.Pod
+		exp  string
+	}{
+		{"no containers", podOn("a"), "0"},
+		{"one container", podOn("a", "250m"), "250m"},
+		{"containers are summed", podOn("a", "250m", "1"), "1250m"},
+		{"smaller init container", withInit(podOn("a", "250m", "1"), "500m"), "1250m"},
+		{"larger init container", withInit(podOn("a", "250m"), "2"), "2"},
+	}
+	for _, tc := range testCases {
+		got := podCPURequest(&tc.pod)
+		if exp := resource.MustParse(tc.exp); got.Cmp(exp) != 0 {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.exp, got.String())
+		}
+	}
+}
+
+func TestSumCPU(t *testing.T) {
+	nodes := []apiv1.Node{allocatableNode("a", "4"), allocatableNode("b", "8")}
+	pods := []apiv1.Pod{
+		podOn("a", "1"),
+		podOn("b", "500m", "500m"),
+		// Not scheduled yet.
+		podOn("", "4"),
+		// On a node which isn't counted.
+		podOn("c", "4"),
+	}
+	var ptrs []*apiv1.Pod
+	for i := range pods {
+		ptrs = append(ptrs, &pods[i])
+	}
+	requested, allocatable := sumCPU(nodes, ptrs)
+	if exp := resource.MustParse("2"); requested.Cmp(exp) != 0 {
+		t.Errorf("expected 2 cores requested, got %s", requested.String())
+	}
+	if exp := resource.MustParse("12"); allocatable.Cmp(exp) != 0 {
+		t.Errorf("expected 12 cores allocatable, got %s", allocatable.String())
+	}
+}
+
+func TestGetClusterSizeCPUUtilization(t *testing.T) {
+	nodes := []apiv1.Node{allocatableNode("a", "4"), allocatableNode("b", "4"), allocatableNode("c", "0")}
+	pods := []apiv1.Pod{podOn("a", "1", "1"), podOn("b", "1"), podOn("c", "2")}
+	for i := range pods {
+		pods[i].Name = fmt.Sprintf("pod-%d", i)
+	}
+	var fieldSelector string
+	var podLists int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var list interface{}
+		switch req.URL.Path {
+		case "/api/v1/nodes":
+			list = &apiv1.NodeList{Items: nodes}
+		case "/api/v1/pods":
+			if req.URL.Query().Get("watch") == "true" {
+				holdWatch(w, req)
+				return
+			}
+			fieldSelector = req.URL.Query().Get("fieldSelector")
+			atomic.AddInt32(&podLists, 1)
+			list = &apiv1.PodList{Items: pods}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		output, err := json.Marshal(list)
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cs := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+	k8scli := &k8sClient{
+		clientset:        cs,
+		cpuUtilization:   &CPUUtilizationProvider{pods: newPodInformer(ctx, cs, "")},
+		skipZeroCPUNodes: true,
+	}
+	sz, err := k8scli.GetClusterSize()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := k8scli.GetClusterSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&podLists); n != 1 {
+		t.Errorf("expected the pods to be listed once for two polls, got %d lists", n)
+	}
+	if fieldSelector != "status.phase!=Succeeded,status.phase!=Failed" {
+		t.Errorf("expected finished pods to be left out, got field selector %q", fieldSelector)
+	}
+	if exp := resource.MustParse("3"); sz.CPURequested.Cmp(exp) != 0 {
+		t.Errorf("expected 3 cores requested, got %s", sz.CPURequested.String())
+	}
+	if exp := resource.MustParse("8"); sz.CPUAllocatable.Cmp(exp) != 0 {
+		t.Errorf("expected 8 cores allocatable, got %s", sz.CPUAllocatable.String())
+	}
+	if sz.CPUUtilization != 37 {
+		t.Errorf("expected 37%% CPU utilization, got %d%%", sz.CPUUtilization)
+	}
+}
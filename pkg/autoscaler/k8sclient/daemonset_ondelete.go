@@ -0,0 +1,155 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultDaemonSetPodDeletionInterval is how long DeleteOutdatedPods waits
+// between deleting two pods, unless set otherwise.
+const DefaultDaemonSetPodDeletionInterval = 30 * time.Second
+
+const (
+	// templateGenerationAnnotation is the annotation in which the API server
+	// keeps the generation of a DaemonSet's pod template.
+	templateGenerationAnnotation = "deprecated.daemonset.template.generation"
+	// podTemplateGenerationLabel is the label in which the DaemonSet
+	// controller keeps the template generation a pod was created from.
+	podTemplateGenerationLabel = "pod-template-generation"
+)
+
+// DeleteOutdatedPods deletes a pod of a target DaemonSet with the OnDelete
+// update strategy which was created from an older pod template, so that the
+// DaemonSet replaces it with one from the current template.  This is only
+// done while the current template is the one which the last update of the
+// autoscaler produced, see recordTemplateGeneration, so that other changes
+// of the DaemonSet are left to whoever made them.  Pods are compared by their
+// template generation, as the DaemonSet controller does, rather than by
+// their resources, which admission controllers such as LimitRanges may have
+// changed.  It deletes at most one pod, and only once the interval since the
+// last deletion has passed and no pod of the DaemonSet is unavailable or
+// being deleted, so that the update rolls through the nodes one at a time,
+// in the order of their names.  Other targets are left alone.
+func (k *k8sClient) DeleteOutdatedPods() error {
+	if !k.deleteOutdatedPods || k.target == nil || !strings.EqualFold(k.target.Kind, "daemonset") {
+		return nil
+	}
+	if k.patchedGeneration == "" {
+		return nil
+	}
+	if since := time.Since(k.lastPodDeletion); since < k.podDeletionInterval {
+		glog.V(4).Infof("Not deleting pods of %s for another %v", k.target.Name, k.podDeletionInterval-since)
+		return nil
+	}
+	obj, err := k.target.Get(k.clientset)
+	if err != nil {
+		return fmt.Errorf("can't get target: %v", err)
+	}
+	if obj.Spec.UpdateStrategy == nil || obj.Spec.UpdateStrategy.Type != appsv1.OnDeleteDaemonSetStrategyType {
+		return nil
+	}
+	generation := obj.Annotations[templateGenerationAnnotation]
+	if generation != k.patchedGeneration {
+		glog.V(2).Infof("Not deleting pods of %s, whose template generation %q is not that of the last update, %q", k.target.Name, generation, k.patchedGeneration)
+		return nil
+	}
+	if obj.Status.NumberUnavailable > 0 {
+		glog.V(2).Infof("Not deleting pods of %s while %d of them are unavailable", k.target.Name, obj.Status.NumberUnavailable)
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid target selector: %v", err)
+	}
+	pods, err := k.clientset.CoreV1().Pods(k.target.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return fmt.Errorf("failed to list pods of the target: %v", err)
+	}
+	pod, wait := nextOutdatedPod(pods.Items, generation)
+	if wait {
+		glog.V(2).Infof("Not deleting pods of %s while one is being deleted", k.target.Name)
+		return nil
+	}
+	if pod == nil {
+		return nil
+	}
+	if k.dryRun {
+		glog.Infof("Performing dry-run, not deleting outdated pod %s/%s on node %q.", pod.Namespace, pod.Name, pod.Spec.NodeName)
+		return nil
+	}
+	if err := k.clientset.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("can't delete outdated pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	k.lastPodDeletion = time.Now()
+	glog.V(0).Infof("Deleted pod %s/%s on node %q, which is not from template generation %s of %s", pod.Namespace, pod.Name, pod.Spec.NodeName, generation, k.target.Name)
+	return nil
+}
+
+// recordTemplateGeneration remembers the template generation of a target
+// DaemonSet after a patch, if the patch changed it from that of before, the
+// DaemonSet as it was read for the patch.  A patch which left the template as
+// it was doesn't change what DeleteOutdatedPods rolls out.
+func (k *k8sClient) recordTemplateGeneration(before *targetObject) {
+	if !strings.EqualFold(k.target.Kind, "daemonset") {
+		return
+	}
+	after, err := k.target.Get(k.clientset)
+	if err != nil {
+		// The generation the pods are rolled to is no longer current.
+		glog.Warningf("Can't read the template generation of %s, not deleting its outdated pods: %v", k.target.Name, err)
+		k.patchedGeneration = ""
+		return
+	}
+	generation := after.Annotations[templateGenerationAnnotation]
+	if generation != before.Annotations[templateGenerationAnnotation] {
+		k.patchedGeneration = generation
+	}
+}
+
+// nextOutdatedPod returns the pod which is not from the given template
+// generation and whose node comes first by name, or nil if there is none.  If
+// a pod is being deleted, it returns wait instead.
+func nextOutdatedPod(pods []apiv1.Pod, generation string) (pod *apiv1.Pod, wait bool) {
+	outdated := []*apiv1.Pod{}
+	for i := range pods {
+		if pods[i].DeletionTimestamp != nil {
+			return nil, true
+		}
+		if pods[i].Labels[podTemplateGenerationLabel] != generation {
+			outdated = append(outdated, &pods[i])
+		}
+	}
+	if len(outdated) == 0 {
+		return nil, false
+	}
+	sort.Slice(outdated, func(i, j int) bool {
+		if outdated[i].Spec.NodeName != outdated[j].Spec.NodeName {
+			return outdated[i].Spec.NodeName < outdated[j].Spec.NodeName
+		}
+		return outdated[i].Name < outdated[j].Name
+	})
+	return outdated[0], false
+}
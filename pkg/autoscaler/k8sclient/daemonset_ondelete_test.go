@@ -0,0 +1,221 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestDeleteOutdatedPods(t *testing.T) {
+	podOn := func(name, node, generation string) apiv1.Pod {
+		pod := apiv1.Pod{}
+		pod.Name = name
+		pod.Namespace = "default"
+		pod.Labels = map[string]string{"app": "agent", podTemplateGenerationLabel: generation}
+		pod.Spec.NodeName = node
+		pod.Spec.Containers = []apiv1.Container{{
+			Name: "agent",
+			Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+				apiv1.ResourceCPU: resource.MustParse("100m"),
+			}},
+		}}
+		return pod
+	}
+	terminating := podOn("agent-c", "node-c", "2")
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	testCases := []struct {
+		name              string
+		strategy          appsv1.DaemonSetUpdateStrategyType
+		patchedGeneration string
+		unavailable       int32
+		pods              []apiv1.Pod
+		lastDeletion      time.Time
+		expDeleted        string
+	}{
+		{
+			name:              "rolling update",
+			strategy:          appsv1.RollingUpdateDaemonSetStrategyType,
+			patchedGeneration: "3",
+			pods:              []apiv1.Pod{podOn("agent-a", "node-a", "2")},
+		},
+		{
+			// The resources of the pods don't matter, e.g. if a LimitRange
+			// changed them.
+			name:              "all updated",
+			strategy:          appsv1.OnDeleteDaemonSetStrategyType,
+			patchedGeneration: "3",
+			pods:              []apiv1.Pod{podOn("agent-a", "node-a", "3"), podOn("agent-b", "node-b", "3")},
+		},
+		{
+			name:              "first node first",
+			strategy:          appsv1.OnDeleteDaemonSetStrategyType,
+			patchedGeneration: "3",
+			pods:              []apiv1.Pod{podOn("agent-a", "node-b", "2"), podOn("agent-b", "node-a", "1"), podOn("agent-c", "node-0", "3")},
+			expDeleted:        "agent-b",
+		},
+		{
+			name:     "not updated by the autoscaler",
+			strategy: appsv1.OnDeleteDaemonSetStrategyType,
+			pods:     []apiv1.Pod{podOn("agent-a", "node-a", "2")},
+		},
+		{
+			name:              "changed since the update",
+			strategy:          appsv1.OnDeleteDaemonSetStrategyType,
+			patchedGeneration: "2",
+			pods:              []apiv1.Pod{podOn("agent-a", "node-a", "1")},
+		},
+		{
+			name:              "pod unavailable",
+			strategy:          appsv1.OnDeleteDaemonSetStrategyType,
+			patchedGeneration: "3",
+			unavailable:       1,
+			pods:              []apiv1.Pod{podOn("agent-a", "node-a", "2")},
+		},
+		{
+			name:              "pod being deleted",
+			strategy:          appsv1.OnDeleteDaemonSetStrategyType,
+			patchedGeneration: "3",
+			pods:              []apiv1.Pod{podOn("agent-a", "node-a", "2"), terminating},
+		},
+		{
+			name:              "within the interval",
+			strategy:          appsv1.OnDeleteDaemonSetStrategyType,
+			patchedGeneration: "3",
+			pods:              []apiv1.Pod{podOn("agent-a", "node-a", "2")},
+			lastDeletion:      time.Now(),
+		},
+	}
+	for _, tc := range testCases {
+		var deleted string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var obj interface{}
+			switch {
+			case req.URL.Path == "/apis/apps/v1/namespaces/default/daemonsets/agent":
+				ds := &appsv1.DaemonSet{}
+				ds.Name = "agent"
+				ds.Annotations = map[string]string{templateGenerationAnnotation: "3"}
+				ds.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "agent"}}
+				ds.Spec.UpdateStrategy.Type = tc.strategy
+				ds.Spec.Template.Spec.Containers = []apiv1.Container{{
+					Name: "agent",
+					Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+						apiv1.ResourceCPU: resource.MustParse("200m"),
+					}},
+				}}
+				ds.Status.NumberUnavailable = tc.unavailable
+				obj = ds
+			case req.URL.Path == "/api/v1/namespaces/default/pods" && req.Method == "GET":
+				if sel := req.URL.Query().Get("labelSelector"); sel != "app=agent" {
+					t.Errorf("%s: expected the pods of the DaemonSet, got selector %q", tc.name, sel)
+				}
+				obj = &apiv1.PodList{Items: tc.pods}
+			case strings.HasPrefix(req.URL.Path, "/api/v1/namespaces/default/pods/") && req.Method == "DELETE":
+				deleted = strings.TrimPrefix(req.URL.Path, "/api/v1/namespaces/default/pods/")
+				obj = &metav1.Status{Status: metav1.StatusSuccess}
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			output, err := json.Marshal(obj)
+			if err != nil {
+				t.Fatalf("unexpected encoding error: %v", err)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(output)
+		}))
+
+		target, err := newTargetSpec("DaemonSet", map[string]bool{"apps/v1": true}, "default", "agent")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		k8scli := &k8sClient{
+			clientset:           clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			target:              target,
+			deleteOutdatedPods:  true,
+			podDeletionInterval: time.Minute,
+			lastPodDeletion:     tc.lastDeletion,
+			patchedGeneration:   tc.patchedGeneration,
+		}
+		if err := k8scli.DeleteOutdatedPods(); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		server.Close()
+		if deleted != tc.expDeleted {
+			t.Errorf("%s: expected pod %q to be deleted, got %q", tc.name, tc.expDeleted, deleted)
+		}
+		if tc.expDeleted != "" && k8scli.lastPodDeletion.IsZero() {
+			t.Errorf("%s: expected the deletion to be remembered", tc.name)
+		}
+	}
+}
+
+func TestRecordTemplateGeneration(t *testing.T) {
+	testCases := []struct {
+		name          string
+		before, after string
+		getCode       int
+		expGeneration string
+	}{
+		{"template changed", "2", "3", http.StatusOK, "3"},
+		{"template unchanged", "3", "3", http.StatusOK, "1"},
+		{"read fails", "2", "3", http.StatusInternalServerError, ""},
+	}
+	for _, tc := range testCases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/apis/apps/v1/namespaces/default/daemonsets/agent" || tc.getCode != http.StatusOK {
+				w.WriteHeader(tc.getCode)
+				return
+			}
+			ds := &appsv1.DaemonSet{}
+			ds.Name = "agent"
+			ds.Annotations = map[string]string{templateGenerationAnnotation: tc.after}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ds)
+		}))
+
+		target, err := newTargetSpec("DaemonSet", map[string]bool{"apps/v1": true}, "default", "agent")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		k8scli := &k8sClient{
+			clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			target:    target,
+			// From an earlier update.
+			patchedGeneration: "1",
+		}
+		before := &targetObject{}
+		before.Annotations = map[string]string{templateGenerationAnnotation: tc.before}
+		k8scli.recordTemplateGeneration(before)
+		server.Close()
+		if k8scli.patchedGeneration != tc.expGeneration {
+			t.Errorf("%s: expected generation %q, got %q", tc.name, tc.expGeneration, k8scli.patchedGeneration)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/golang/glog"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// OriginalUtilizationAnnotation holds, as JSON by resource name, the target
+// utilization of each cpu and memory metric of an HPA from before
+// coordinateHPAs first adjusted it, and the requests per pod it was set for.
+// Every adjustment scales that original, so that rounding doesn't add up.
+const OriginalUtilizationAnnotation = "cpva.kubernetes.io/original-utilization"
+
+// The API groups which coordinateHPAs tries, in order.  autoscaling/v2 is
+// served from Kubernetes 1.23 on, and autoscaling/v2beta2 until 1.25.  The
+// vendored client predates autoscaling/v2, but its HorizontalPodAutoscaler
+// has the same JSON as that of autoscaling/v2beta2, so the v2beta2 types
+// are used for both.
+const (
+	hpaAPIVersion       = "autoscaling/v2"
+	legacyHPAAPIVersion = "autoscaling/v2beta2"
+)
+
+// originalUtilization is the value of OriginalUtilizationAnnotation for one
+// resource.
+type originalUtilization struct {
+	// The target utilization which the HPA had for Requests per pod.
+	Utilization int32             `json:"utilization"`
+	Requests    resource.Quantity `json:"requests"`
+	// The target utilization which coordinateHPAs last set.  If the HPA no
+	// longer has it, it was changed by hand, and becomes the new original.
+	Applied int32 `json:"applied"`
+}
+
+// podRequests returns the total cpu and memory requests of a pod with ctrs,
+// with the requests of the containers in resources replaced by theirs.
+// Resources which the pod doesn't request are missing.
+func podRequests(ctrs []apiv1.Container, resources map[string]apiv1.ResourceRequirements) apiv1.ResourceList {
+	total := apiv1.ResourceList{}
+	for _, ctr := range ctrs {
+		for _, name := range []apiv1.ResourceName{apiv1.ResourceCPU, apiv1.ResourceMemory} {
+			q, found := ctr.Resources.Requests[name]
+			if r, ok := resources[ctr.Name].Requests[name]; ok {
+				q, found = r, true
+			}
+			if !found {
+				continue
+			}
+			sum := total[name]
+			sum.Add(q)
+			total[name] = sum
+		}
+	}
+	return total
+}
+
+// hpaUtilizationPatch returns the JSON patch which sets the target
+// utilization of each cpu and memory metric of hpa to its original scaled
+// by the ratio of the original requests per pod to after, so that the same
+// usage per pod gives the same number of replicas.  The original is read
+// from the OriginalUtilizationAnnotation, or if there is none, or the target
+// was changed by hand since, is the current target for the requests before,
+// and the patch saves it.  It is nil if no target changes.  Each target is
+// tested first, so that a concurrent change of the HPA fails the patch.
+func hpaUtilizationPatch(hpa *autoscalingv2beta2.HorizontalPodAutoscaler, before, after apiv1.ResourceList) ([]byte, error) {
+	originals := map[apiv1.ResourceName]originalUtilization{}
+	if saved, ok := hpa.Annotations[OriginalUtilizationAnnotation]; ok {
+		if err := json.Unmarshal([]byte(saved), &originals); err != nil {
+			glog.Warningf("Ignoring the invalid %s annotation of HorizontalPodAutoscaler %s/%s: %v", OriginalUtilizationAnnotation, hpa.Namespace, hpa.Name, err)
+			originals = map[apiv1.ResourceName]originalUtilization{}
+		}
+	}
+	patch := []map[string]interface{}{}
+	for i, metric := range hpa.Spec.Metrics {
+		if metric.Type != autoscalingv2beta2.ResourceMetricSourceType || metric.Resource == nil {
+			continue
+		}
+		target := metric.Resource.Target
+		if target.Type != autoscalingv2beta2.UtilizationMetricType || target.AverageUtilization == nil {
+			continue
+		}
+		name := metric.Resource.Name
+		current := *target.AverageUtilization
+		original, ok := originals[name]
+		if !ok || original.Applied != current || original.Requests.IsZero() {
+			original = originalUtilization{Utilization: current, Requests: before[name]}
+		}
+		to := after[name]
+		if original.Requests.IsZero() || to.IsZero() {
+			delete(originals, name)
+			continue
+		}
+		original.Applied = scaleUtilization(original.Utilization, original.Requests, to)
+		originals[name] = original
+		if original.Applied == current {
+			continue
+		}
+		path := fmt.Sprintf("/spec/metrics/%d/resource/target/averageUtilization", i)
+		patch = append(patch,
+			map[string]interface{}{"op": "test", "path": path, "value": current},
+			map[string]interface{}{"op": "replace", "path": path, "value": original.Applied})
+	}
+	if len(patch) == 0 {
+		return nil, nil
+	}
+	saved, err := json.Marshal(originals)
+	if err != nil {
+		return nil, err
+	}
+	if hpa.Annotations == nil {
+		patch = append(patch, map[string]interface{}{"op": "add", "path": "/metadata/annotations",
+			"value": map[string]string{OriginalUtilizationAnnotation: string(saved)}})
+	} else {
+		path := "/metadata/annotations/" + strings.Replace(OriginalUtilizationAnnotation, "/", "~1", -1)
+		patch = append(patch, map[string]interface{}{"op": "add", "path": path, "value": string(saved)})
+	}
+	return json.Marshal(patch)
+}
+
+// scaleUtilization returns utilization scaled by from/to, rounded to the
+// nearest percent and at least 1.
+func scaleUtilization(utilization int32, from, to resource.Quantity) int32 {
+	scaled := math.Round(float64(utilization) * float64(from.MilliValue()) / float64(to.MilliValue()))
+	if scaled < 1 {
+		return 1
+	}
+	if scaled > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int32(scaled)
+}
+
+// hpaPath returns the path of the HorizontalPodAutoscalers of the target's
+// namespace, in hpaAPIVersion if the server has it, else in
+// legacyHPAAPIVersion.  The group is discovered on the first call.
+func (k *k8sClient) hpaPath() (string, error) {
+	k.mu.Lock()
+	gv := k.hpaGroupVersion
+	k.mu.Unlock()
+	if gv == "" {
+		gv = hpaAPIVersion
+		if _, err := k.clientset.Discovery().ServerResourcesForGroupVersion(gv); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return "", fmt.Errorf("can't discover %s: %v", gv, err)
+			}
+			glog.V(2).Infof("The server has no %s, using %s", gv, legacyHPAAPIVersion)
+			gv = legacyHPAAPIVersion
+		}
+		k.mu.Lock()
+		k.hpaGroupVersion = gv
+		k.mu.Unlock()
+	}
+	return fmt.Sprintf("/apis/%s/namespaces/%s/horizontalpodautoscalers", gv, k.target.Namespace), nil
+}
+
+// coordinateHPAs adjusts the target utilization of the HPAs which scale the
+// target, now that its containers' requests changed from those of ctrs to
+// resources.  Errors are logged rather than returned, since the target is
+// already updated.
+func (k *k8sClient) coordinateHPAs(ctrs []apiv1.Container, resources map[string]apiv1.ResourceRequirements) {
+	before, after := podRequests(ctrs, nil), podRequests(ctrs, resources)
+	path, err := k.hpaPath()
+	if err != nil {
+		glog.Errorf("Can't find the HorizontalPodAutoscaler API: %v", err)
+		return
+	}
+	rest := k.clientset.AutoscalingV1().RESTClient()
+	data, err := rest.Get().AbsPath(path).SetHeader("Accept", "application/json").DoRaw()
+	if err != nil {
+		glog.Errorf("Can't list the HorizontalPodAutoscalers of %s %s/%s: %v", k.target.Kind, k.target.Namespace, k.target.Name, err)
+		return
+	}
+	hpas := &autoscalingv2beta2.HorizontalPodAutoscalerList{}
+	if err := json.Unmarshal(data, hpas); err != nil {
+		glog.Errorf("Can't decode the HorizontalPodAutoscalers of %s %s/%s: %v", k.target.Kind, k.target.Namespace, k.target.Name, err)
+		return
+	}
+	for i := range hpas.Items {
+		hpa := &hpas.Items[i]
+		ref := hpa.Spec.ScaleTargetRef
+		if !strings.EqualFold(ref.Kind, k.target.Kind) || ref.Name != k.target.Name {
+			continue
+		}
+		data, err := hpaUtilizationPatch(hpa, before, after)
+		if err != nil {
+			glog.Errorf("Can't marshal the patch of HorizontalPodAutoscaler %s/%s: %v", hpa.Namespace, hpa.Name, err)
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		if k.dryRun {
+			glog.Infof("Performing dry-run, not patching HorizontalPodAutoscaler %s/%s with %s", hpa.Namespace, hpa.Name, data)
+			continue
+		}
+		if _, err := rest.Patch(types.JSONPatchType).AbsPath(path, hpa.Name).Body(data).DoRaw(); err != nil {
+			glog.Errorf("Can't adjust the target utilization of HorizontalPodAutoscaler %s/%s: %v", hpa.Namespace, hpa.Name, err)
+			continue
+		}
+		glog.V(2).Infof("Adjusted the target utilization of HorizontalPodAutoscaler %s/%s: %s", hpa.Namespace, hpa.Name, data)
+	}
+}
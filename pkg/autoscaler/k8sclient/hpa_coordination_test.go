@@ -0,0 +1,276 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func hpaWith(kind, name string, metrics ...autoscalingv2beta2.MetricSpec) autoscalingv2beta2.HorizontalPodAutoscaler {
+	return autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: name + "-hpa", Namespace: "default"},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: kind, Name: name},
+			Metrics:        metrics,
+		},
+	}
+}
+
+func utilizationMetric(name apiv1.ResourceName, utilization int32) autoscalingv2beta2.MetricSpec {
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name:   name,
+			Target: autoscalingv2beta2.MetricTarget{Type: autoscalingv2beta2.UtilizationMetricType, AverageUtilization: &utilization},
+		},
+	}
+}
+
+func withAnnotation(hpa autoscalingv2beta2.HorizontalPodAutoscaler, original string) autoscalingv2beta2.HorizontalPodAutoscaler {
+	hpa.Annotations = map[string]string{OriginalUtilizationAnnotation: original}
+	return hpa
+}
+
+func TestPodRequests(t *testing.T) {
+	ctrs := []apiv1.Container{
+		{Name: "app", Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU: resource.MustParse("100m"), apiv1.ResourceMemory: resource.MustParse("100Mi"),
+		}}},
+		{Name: "sidecar", Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU: resource.MustParse("50m"),
+		}}},
+	}
+	testCases := []struct {
+		name      string
+		resources map[string]apiv1.ResourceRequirements
+		cpu       string
+		memory    string
+	}{
+		{name: "current", cpu: "150m", memory: "100Mi"},
+		{
+			name: "changed",
+			resources: map[string]apiv1.ResourceRequirements{
+				"app":     {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("250m")}},
+				"sidecar": {Requests: apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("28Mi")}},
+			},
+			cpu: "300m", memory: "128Mi",
+		},
+	}
+	for _, tc := range testCases {
+		total := podRequests(ctrs, tc.resources)
+		if cpu := total[apiv1.ResourceCPU]; cpu.Cmp(resource.MustParse(tc.cpu)) != 0 {
+			t.Errorf("%s: expected cpu %s, got %s", tc.name, tc.cpu, cpu.String())
+		}
+		if memory := total[apiv1.ResourceMemory]; memory.Cmp(resource.MustParse(tc.memory)) != 0 {
+			t.Errorf("%s: expected memory %s, got %s", tc.name, tc.memory, memory.String())
+		}
+	}
+}
+
+func TestHPAUtilizationPatch(t *testing.T) {
+	requests := func(cpu, memory string) apiv1.ResourceList {
+		list := apiv1.ResourceList{}
+		if cpu != "" {
+			list[apiv1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if memory != "" {
+			list[apiv1.ResourceMemory] = resource.MustParse(memory)
+		}
+		return list
+	}
+	averageValue := autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name:   apiv1.ResourceCPU,
+			Target: autoscalingv2beta2.MetricTarget{Type: autoscalingv2beta2.AverageValueMetricType},
+		},
+	}
+	testCases := []struct {
+		name          string
+		hpa           autoscalingv2beta2.HorizontalPodAutoscaler
+		before, after apiv1.ResourceList
+		expected      string
+	}{
+		{
+			name:   "cpu doubled",
+			hpa:    hpaWith("Deployment", "thing", utilizationMetric(apiv1.ResourceCPU, 80)),
+			before: requests("100m", ""), after: requests("200m", ""),
+			expected: `[{"op":"test","path":"/spec/metrics/0/resource/target/averageUtilization","value":80},` +
+				`{"op":"replace","path":"/spec/metrics/0/resource/target/averageUtilization","value":40},` +
+				`{"op":"add","path":"/metadata/annotations","value":{"cpva.kubernetes.io/original-utilization":` +
+				`"{\"cpu\":{\"utilization\":80,\"requests\":\"100m\",\"applied\":40}}"}}]`,
+		},
+		{
+			name:   "memory shrunk, after an average value",
+			hpa:    hpaWith("Deployment", "thing", averageValue, utilizationMetric(apiv1.ResourceMemory, 50)),
+			before: requests("100m", "300Mi"), after: requests("200m", "200Mi"),
+			expected: `[{"op":"test","path":"/spec/metrics/1/resource/target/averageUtilization","value":50},` +
+				`{"op":"replace","path":"/spec/metrics/1/resource/target/averageUtilization","value":75},` +
+				`{"op":"add","path":"/metadata/annotations","value":{"cpva.kubernetes.io/original-utilization":` +
+				`"{\"memory\":{\"utilization\":50,\"requests\":\"300Mi\",\"applied\":75}}"}}]`,
+		},
+		{
+			name: "scaled from the original",
+			hpa: withAnnotation(hpaWith("Deployment", "thing", utilizationMetric(apiv1.ResourceCPU, 27)),
+				`{"cpu":{"utilization":80,"requests":"100m","applied":27}}`),
+			before: requests("300m", ""), after: requests("700m", ""),
+			expected: `[{"op":"test","path":"/spec/metrics/0/resource/target/averageUtilization","value":27},` +
+				`{"op":"replace","path":"/spec/metrics/0/resource/target/averageUtilization","value":11},` +
+				`{"op":"add","path":"/metadata/annotations/cpva.kubernetes.io~1original-utilization",` +
+				`"value":"{\"cpu\":{\"utilization\":80,\"requests\":\"100m\",\"applied\":11}}"}]`,
+		},
+		{
+			name: "changed by hand since",
+			hpa: withAnnotation(hpaWith("Deployment", "thing", utilizationMetric(apiv1.ResourceCPU, 60)),
+				`{"cpu":{"utilization":80,"requests":"100m","applied":27}}`),
+			before: requests("300m", ""), after: requests("600m", ""),
+			expected: `[{"op":"test","path":"/spec/metrics/0/resource/target/averageUtilization","value":60},` +
+				`{"op":"replace","path":"/spec/metrics/0/resource/target/averageUtilization","value":30},` +
+				`{"op":"add","path":"/metadata/annotations/cpva.kubernetes.io~1original-utilization",` +
+				`"value":"{\"cpu\":{\"utilization\":60,\"requests\":\"300m\",\"applied\":30}}"}]`,
+		},
+		{
+			name:   "invalid annotation",
+			hpa:    withAnnotation(hpaWith("Deployment", "thing", utilizationMetric(apiv1.ResourceCPU, 80)), `80`),
+			before: requests("100m", ""), after: requests("200m", ""),
+			expected: `[{"op":"test","path":"/spec/metrics/0/resource/target/averageUtilization","value":80},` +
+				`{"op":"replace","path":"/spec/metrics/0/resource/target/averageUtilization","value":40},` +
+				`{"op":"add","path":"/metadata/annotations/cpva.kubernetes.io~1original-utilization",` +
+				`"value":"{\"cpu\":{\"utilization\":80,\"requests\":\"100m\",\"applied\":40}}"}]`,
+		},
+		{
+			name:   "never below 1",
+			hpa:    hpaWith("Deployment", "thing", utilizationMetric(apiv1.ResourceCPU, 1)),
+			before: requests("100m", ""), after: requests("1", ""),
+			expected: "",
+		},
+		{
+			name:   "unchanged",
+			hpa:    hpaWith("Deployment", "thing", utilizationMetric(apiv1.ResourceCPU, 80)),
+			before: requests("100m", "100Mi"), after: requests("100m", "200Mi"),
+		},
+		{
+			name:   "not requested",
+			hpa:    hpaWith("Deployment", "thing", utilizationMetric(apiv1.ResourceMemory, 80)),
+			before: requests("100m", ""), after: requests("200m", ""),
+		},
+		{
+			name:   "average value only",
+			hpa:    hpaWith("Deployment", "thing", averageValue),
+			before: requests("100m", ""), after: requests("200m", ""),
+		},
+	}
+	for _, tc := range testCases {
+		data, err := hpaUtilizationPatch(&tc.hpa, tc.before, tc.after)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if string(data) != tc.expected {
+			t.Errorf("%s: expected patch %s, got %s", tc.name, tc.expected, data)
+		}
+	}
+}
+
+func TestCoordinateHPAs(t *testing.T) {
+	hpas := &autoscalingv2beta2.HorizontalPodAutoscalerList{Items: []autoscalingv2beta2.HorizontalPodAutoscaler{
+		hpaWith("Deployment", "thing", utilizationMetric(apiv1.ResourceCPU, 60)),
+		hpaWith("Deployment", "other", utilizationMetric(apiv1.ResourceCPU, 60)),
+		hpaWith("StatefulSet", "thing", utilizationMetric(apiv1.ResourceCPU, 60)),
+	}}
+	hpas.Items[2].Name = "statefulset-hpa"
+	ctrs := []apiv1.Container{{Name: "app", Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+		apiv1.ResourceCPU: resource.MustParse("100m"),
+	}}}}
+	resources := map[string]apiv1.ResourceRequirements{
+		"app": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("150m")}},
+	}
+	expected := `[{"op":"test","path":"/spec/metrics/0/resource/target/averageUtilization","value":60},` +
+		`{"op":"replace","path":"/spec/metrics/0/resource/target/averageUtilization","value":40},` +
+		`{"op":"add","path":"/metadata/annotations","value":{"cpva.kubernetes.io/original-utilization":` +
+		`"{\"cpu\":{\"utilization\":60,\"requests\":\"100m\",\"applied\":40}}"}}]`
+
+	testCases := []struct {
+		name         string
+		v2           bool
+		groupVersion string
+	}{
+		{name: "autoscaling/v2", v2: true, groupVersion: "autoscaling/v2"},
+		{name: "autoscaling/v2beta2 only", groupVersion: "autoscaling/v2beta2"},
+	}
+	for _, tc := range testCases {
+		discoveries := 0
+		patched := map[string]string{}
+		prefix := "/apis/" + tc.groupVersion + "/namespaces/default/horizontalpodautoscalers"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case req.Method == "GET" && req.URL.Path == "/apis/autoscaling/v2":
+				discoveries++
+				if !tc.v2 {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"kind":"APIResourceList","groupVersion":"autoscaling/v2","resources":[]}`))
+			case req.Method == "GET" && req.URL.Path == prefix:
+				data, _ := json.Marshal(hpas)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(data)
+			case req.Method == "PATCH" && strings.HasPrefix(req.URL.Path, prefix+"/"):
+				body, _ := ioutil.ReadAll(req.Body)
+				patched[req.URL.Path[len(prefix)+1:]] = string(body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		k := &k8sClient{
+			clientset:     clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			target:        &targetSpec{Kind: "deployment", GroupVersion: "apps/v1", Namespace: "default", Name: "thing"},
+			coordinateHPA: true,
+		}
+		k.coordinateHPAs(ctrs, resources)
+		if len(patched) != 1 || patched["thing-hpa"] != expected {
+			t.Errorf("%s: expected only thing-hpa to be patched with %s, got %v", tc.name, expected, patched)
+		}
+
+		patched = map[string]string{}
+		k.dryRun = true
+		k.coordinateHPAs(ctrs, resources)
+		if len(patched) != 0 {
+			t.Errorf("%s: expected no patches in a dry run, got %v", tc.name, patched)
+		}
+		if discoveries != 1 {
+			t.Errorf("%s: expected autoscaling/v2 to be discovered once, got %d", tc.name, discoveries)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ImageTagPins is the tag, by container name, to which the image of each
+// container is pinned whenever its resources are patched.
+type ImageTagPins map[string]string
+
+// tagPattern is what the Docker distribution spec allows as a tag.
+var tagPattern = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+// ParseImageTagPins parses entries of the form CONTAINER=TAG, e.g.
+// "app=1.4.2".
+func ParseImageTagPins(entries []string) (ImageTagPins, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	pins := ImageTagPins{}
+	for _, entry := range entries {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("image tag pin %q must be CONTAINER=TAG", entry)
+		}
+		if errs := validation.IsDNS1123Label(kv[0]); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid container name %q: %s", kv[0], strings.Join(errs, "; "))
+		}
+		if !tagPattern.MatchString(kv[1]) {
+			return nil, fmt.Errorf("invalid image tag %q of container %s", kv[1], kv[0])
+		}
+		if _, found := pins[kv[0]]; found {
+			return nil, fmt.Errorf("image tag of container %s given twice", kv[0])
+		}
+		pins[kv[0]] = kv[1]
+	}
+	return pins, nil
+}
+
+// pinTag returns image with its tag replaced by tag, e.g.
+// "registry:5000/app:latest" to "registry:5000/app:1.4.2".  An image which is
+// pinned by digest is returned as it is.
+func pinTag(image, tag string) string {
+	if strings.Contains(image, "@") {
+		return image
+	}
+	name := image
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name = image[:i]
+	}
+	return name + ":" + tag
+}
+
+// pinnedImages returns the images, by container name, of the containers in
+// resources whose tag is pinned and differs from the current one.
+func (p ImageTagPins) pinnedImages(current []apiv1.Container, resources map[string]apiv1.ResourceRequirements) map[string]string {
+	images := map[string]string{}
+	for _, ctr := range current {
+		tag, found := p[ctr.Name]
+		if _, patched := resources[ctr.Name]; !found || !patched {
+			continue
+		}
+		image := pinTag(ctr.Image, tag)
+		if image == ctr.Image {
+			if strings.Contains(image, "@") {
+				glog.V(4).Infof("Not pinning the tag of container %s, whose image %s is pinned by digest", ctr.Name, image)
+			}
+			continue
+		}
+		images[ctr.Name] = image
+	}
+	return images
+}
+
+// addPinnedImages adds the images of the containers to a patch of their
+// resources.
+func addPinnedImages(pt types.PatchType, data []byte, current []apiv1.Container, images map[string]string, path ContainerPath) ([]byte, error) {
+	if len(images) == 0 {
+		return data, nil
+	}
+	switch pt {
+	case types.JSONPatchType:
+		ops := []interface{}{}
+		if err := json.Unmarshal(data, &ops); err != nil {
+			return nil, err
+		}
+		for i, ctr := range current {
+			image, found := images[ctr.Name]
+			if !found {
+				continue
+			}
+			ops = append(ops, map[string]interface{}{
+				"op":    "replace",
+				"path":  fmt.Sprintf("%s/%d/image", path.Pointer(), i),
+				"value": image,
+			})
+		}
+		return json.Marshal(ops)
+	case types.StrategicMergePatchType:
+		patch := map[string]interface{}{}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return nil, err
+		}
+		fields := path.fields()
+		obj := nestedMap(patch, fields[:len(fields)-1]...)
+		ctrs, _ := obj[fields[len(fields)-1]].([]interface{})
+		for _, c := range ctrs {
+			ctr, _ := c.(map[string]interface{})
+			name, _ := ctr["name"].(string)
+			if image, found := images[name]; found {
+				ctr["image"] = image
+			}
+		}
+		return json.Marshal(patch)
+	}
+	return nil, fmt.Errorf("unsupported patch type %s", pt)
+}
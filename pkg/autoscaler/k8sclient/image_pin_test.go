@@ -0,0 +1,122 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseImageTagPins(t *testing.T) {
+	testCases := []struct {
+		entries  []string
+		expected ImageTagPins
+		expError bool
+	}{
+		{nil, nil, false},
+		{[]string{"app=1.4.2"}, ImageTagPins{"app": "1.4.2"}, false},
+		{[]string{"app=1.4.2", " sidecar=v2_rc-1 "}, ImageTagPins{"app": "1.4.2", "sidecar": "v2_rc-1"}, false},
+		{[]string{"app"}, nil, true},
+		{[]string{"app="}, nil, true},
+		{[]string{"app=-1"}, nil, true},
+		{[]string{"app=1.4:2"}, nil, true},
+		{[]string{"App=1.4.2"}, nil, true},
+		{[]string{"app=1", "app=2"}, nil, true},
+	}
+	for _, tc := range testCases {
+		pins, err := ParseImageTagPins(tc.entries)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%q: unexpected error: %v", tc.entries, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%q: expected an error, got none", tc.entries)
+			continue
+		}
+		if !reflect.DeepEqual(pins, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.entries, tc.expected, pins)
+		}
+	}
+}
+
+func TestPinTag(t *testing.T) {
+	testCases := []struct {
+		image    string
+		expected string
+	}{
+		{"nginx", "nginx:1.4.2"},
+		{"nginx:latest", "nginx:1.4.2"},
+		{"registry:5000/team/app", "registry:5000/team/app:1.4.2"},
+		{"registry:5000/team/app:latest", "registry:5000/team/app:1.4.2"},
+		{"nginx@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "nginx@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+	}
+	for _, tc := range testCases {
+		if got := pinTag(tc.image, "1.4.2"); got != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.image, tc.expected, got)
+		}
+	}
+}
+
+func TestAddPinnedImages(t *testing.T) {
+	resources := map[string]apiv1.ResourceRequirements{
+		"app":     {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+		"sidecar": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")}},
+	}
+	current := []apiv1.Container{
+		{Name: "sidecar", Image: "proxy:1.0"},
+		{Name: "app", Image: "registry:5000/app:latest"},
+		{Name: "logger", Image: "logger:latest"},
+	}
+	// The sidecar is already at its tag, and the logger isn't patched.
+	pins := ImageTagPins{"app": "1.4.2", "sidecar": "1.0", "logger": "2.0"}
+	images := pins.pinnedImages(current, resources)
+	if expected := map[string]string{"app": "registry:5000/app:1.4.2"}; !reflect.DeepEqual(images, expected) {
+		t.Fatalf("expected %v, got %v", expected, images)
+	}
+
+	k8scli := &k8sClient{target: &targetSpec{Kind: "Deployment", GroupVersion: "apps/v1", Name: "thing"}}
+	pt, jb, err := k8scli.strategicMergeContainers(map[string]apiv1.ResourceRequirements{"app": resources["app"]})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jb, err = addPinnedImages(pt, jb, current, images, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"thing"},"spec":{"template":{"spec":{"containers":[{"image":"registry:5000/app:1.4.2","name":"app","resources":{"requests":{"cpu":"100m"}}}]}}}}`
+	if string(jb) != exp {
+		t.Errorf("expected %s, got %s", exp, string(jb))
+	}
+
+	pt, jb, err = jsonPatchContainers(current, map[string]apiv1.ResourceRequirements{"app": resources["app"]}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jb, err = addPinnedImages(pt, jb, current, images, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp = `[{"op":"test","path":"/spec/template/spec/containers/1/name","value":"app"},{"op":"add","path":"/spec/template/spec/containers/1/resources","value":{"requests":{"cpu":"100m"}}},{"op":"replace","path":"/spec/template/spec/containers/1/image","value":"registry:5000/app:1.4.2"}]`
+	if string(jb) != exp {
+		t.Errorf("expected %s, got %s", exp, string(jb))
+	}
+}
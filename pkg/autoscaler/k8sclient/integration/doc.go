@@ -0,0 +1,27 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package integration holds tests of the k8sclient, and of the autoscaler
+// built on it, against a real API server.  They are only built with the
+// integration tag, and need $CPVPA_INTEGRATION_KUBECONFIG to point at a
+// disposable cluster, e.g. an API server started by envtest's setup-envtest
+// or a kind cluster:
+//
+//	CPVPA_INTEGRATION_KUBECONFIG=/tmp/kubeconfig make test-integration
+//
+// The tests create namespaces and fake nodes, and delete them when they are
+// done.
+package integration
@@ -0,0 +1,381 @@
+//go:build integration
+// +build integration
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+const (
+	kubeconfigEnv = "CPVPA_INTEGRATION_KUBECONFIG"
+	// The label on the fake nodes which the tests create.
+	nodeLabel = "cpva-integration"
+	timeout   = 30 * time.Second
+)
+
+// The config for the tests' targets, whose container is named "app".
+const scaleByNodes = `{"app": {"requests": {"cpu": {"base": "100m", "step": "10m", "nodesPerStep": 1}}}}`
+
+// env is a fresh namespace in the cluster under test.
+type env struct {
+	kubeconfig string
+	config     *rest.Config
+	client     kubernetes.Interface
+	namespace  string
+}
+
+// setup creates the namespace, and returns a func which deletes it.
+func setup(t *testing.T) (*env, func()) {
+	t.Helper()
+	kubeconfig := os.Getenv(kubeconfigEnv)
+	if kubeconfig == "" {
+		t.Skipf("$%s is not set", kubeconfigEnv)
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		t.Fatalf("invalid $%s: %v", kubeconfigEnv, err)
+	}
+	client := kubernetes.NewForConfigOrDie(config)
+	ns, err := client.CoreV1().Namespaces().Create(&apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "cpva-integration-"},
+	})
+	if err != nil {
+		t.Fatalf("can't create namespace: %v", err)
+	}
+	e := &env{kubeconfig: kubeconfig, config: config, client: client, namespace: ns.Name}
+	return e, func() {
+		if err := client.CoreV1().Namespaces().Delete(ns.Name, &metav1.DeleteOptions{}); err != nil {
+			t.Errorf("can't delete namespace %s: %v", ns.Name, err)
+		}
+	}
+}
+
+// addNode creates a fake node with the given CPU capacity, and returns a func
+// which deletes it.
+func (e *env) addNode(t *testing.T, cpu string) func() {
+	t.Helper()
+	node, err := e.client.CoreV1().Nodes().Create(&apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "cpva-integration-", Labels: map[string]string{nodeLabel: "true"}},
+		Status: apiv1.NodeStatus{Capacity: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse(cpu),
+			apiv1.ResourceMemory: resource.MustParse("4Gi"),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	return func() {
+		if err := e.client.CoreV1().Nodes().Delete(node.Name, &metav1.DeleteOptions{}); err != nil {
+			t.Errorf("can't delete node %s: %v", node.Name, err)
+		}
+	}
+}
+
+func podTemplate(name string) apiv1.PodTemplateSpec {
+	return apiv1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: "app", Image: "k8s.gcr.io/pause:3.1"}},
+		},
+	}
+}
+
+func (e *env) createDeployment(t *testing.T, name string) {
+	t.Helper()
+	_, err := e.client.AppsV1().Deployments(e.namespace).Create(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Template: podTemplate(name),
+		},
+	})
+	if err != nil {
+		t.Fatalf("can't create deployment: %v", err)
+	}
+}
+
+func (e *env) createDaemonSet(t *testing.T, name string) {
+	t.Helper()
+	_, err := e.client.AppsV1().DaemonSets(e.namespace).Create(&appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Template: podTemplate(name),
+		},
+	})
+	if err != nil {
+		t.Fatalf("can't create daemonset: %v", err)
+	}
+}
+
+// deploymentCPU returns the CPU request of the deployment's "app" container.
+func (e *env) deploymentCPU(name string) (resource.Quantity, error) {
+	d, err := e.client.AppsV1().Deployments(e.namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+	return d.Spec.Template.Spec.Containers[0].Resources.Requests[apiv1.ResourceCPU], nil
+}
+
+// waitFor polls cond until it returns true, or fails the test after the
+// timeout.
+func waitFor(t *testing.T, what string, cond func() (bool, error)) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		ok, err := cond()
+		if ok {
+			return
+		}
+		lastErr = err
+		time.Sleep(200 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s, last error: %v", what, lastErr)
+}
+
+// waitForCPU waits until the deployment's CPU request is want.
+func (e *env) waitForCPU(t *testing.T, name, want string) {
+	t.Helper()
+	exp := resource.MustParse(want)
+	waitFor(t, fmt.Sprintf("cpu request %s", want), func() (bool, error) {
+		got, err := e.deploymentCPU(name)
+		if err != nil {
+			return false, err
+		}
+		return got.Cmp(exp) == 0, fmt.Errorf("cpu request is %s", got.String())
+	})
+}
+
+// expectedCPU is what scaleByNodes gives for the cluster's current size.
+func expectedCPU(t *testing.T, client k8sclient.K8sClient, extraNodes int) string {
+	t.Helper()
+	sz, err := client.GetClusterSize()
+	if err != nil {
+		t.Fatalf("can't get cluster size: %v", err)
+	}
+	return fmt.Sprintf("%dm", 100+10*(sz.Nodes+extraNodes))
+}
+
+// startAutoScaler runs an autoscaler for the target, polling every second,
+// and returns a func which stops it.
+func startAutoScaler(t *testing.T, kubeconfig, namespace, target string) func() {
+	t.Helper()
+	c := options.NewAutoScalerConfig()
+	c.Kubeconfig = kubeconfig
+	c.Namespace = namespace
+	c.Target = target
+	c.DefaultConfig = scaleByNodes
+	c.PollPeriodSeconds = 1
+	as, err := autoscaler.NewAutoScaler(context.Background(), c)
+	if err != nil {
+		t.Fatalf("can't create autoscaler: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		as.Run()
+		close(done)
+	}()
+	return func() {
+		as.Stop()
+		<-done
+	}
+}
+
+func TestDeploymentPatching(t *testing.T) {
+	e, teardown := setup(t)
+	defer teardown()
+	e.createDeployment(t, "foo")
+
+	client, err := k8sclient.NewK8sClient(context.Background(), e.namespace, "deployment/foo", e.kubeconfig, k8sclient.Options{ValidateTarget: true})
+	if err != nil {
+		t.Fatalf("can't create client: %v", err)
+	}
+	want := map[string]apiv1.ResourceRequirements{
+		"app": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("150m")},
+			Limits:   apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("128Mi")},
+		},
+	}
+	if err := client.UpdateResources(want); err != nil {
+		t.Fatalf("can't update resources: %v", err)
+	}
+	got, err := client.GetCurrentResources()
+	if err != nil {
+		t.Fatalf("can't get resources: %v", err)
+	}
+	cpu := got["app"].Requests[apiv1.ResourceCPU]
+	mem := got["app"].Limits[apiv1.ResourceMemory]
+	if cpu.Cmp(resource.MustParse("150m")) != 0 || mem.Cmp(resource.MustParse("128Mi")) != 0 {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDaemonSetPatching(t *testing.T) {
+	e, teardown := setup(t)
+	defer teardown()
+	e.createDaemonSet(t, "bar")
+
+	client, err := k8sclient.NewK8sClient(context.Background(), e.namespace, "daemonset/bar", e.kubeconfig, k8sclient.Options{ValidateTarget: true})
+	if err != nil {
+		t.Fatalf("can't create client: %v", err)
+	}
+	want := map[string]apiv1.ResourceRequirements{
+		"app": {Requests: apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("96Mi")}},
+	}
+	if err := client.UpdateResources(want); err != nil {
+		t.Fatalf("can't update resources: %v", err)
+	}
+	ds, err := e.client.AppsV1().DaemonSets(e.namespace).Get("bar", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("can't get daemonset: %v", err)
+	}
+	mem := ds.Spec.Template.Spec.Containers[0].Resources.Requests[apiv1.ResourceMemory]
+	if mem.Cmp(resource.MustParse("96Mi")) != 0 {
+		t.Errorf("expected memory request 96Mi, got %s", mem.String())
+	}
+}
+
+func TestNodeCountChangeUpdatesResources(t *testing.T) {
+	e, teardown := setup(t)
+	defer teardown()
+	e.createDeployment(t, "foo")
+	// An envtest API server has no nodes at all.
+	defer e.addNode(t, "2")()
+
+	client, err := k8sclient.NewK8sClient(context.Background(), e.namespace, "deployment/foo", e.kubeconfig, k8sclient.Options{})
+	if err != nil {
+		t.Fatalf("can't create client: %v", err)
+	}
+	defer startAutoScaler(t, e.kubeconfig, e.namespace, "deployment/foo")()
+	e.waitForCPU(t, "foo", expectedCPU(t, client, 0))
+
+	defer e.addNode(t, "2")()
+	e.waitForCPU(t, "foo", expectedCPU(t, client, 0))
+}
+
+// flakyProxy forwards to the API server, or fails every request with 503
+// while it is down.
+type flakyProxy struct {
+	proxy *httputil.ReverseProxy
+	down  int32
+}
+
+func (p *flakyProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if atomic.LoadInt32(&p.down) != 0 {
+		http.Error(w, "down for the test", http.StatusServiceUnavailable)
+		return
+	}
+	p.proxy.ServeHTTP(w, req)
+}
+
+// startFlakyProxy returns a proxy to the API server, a kubeconfig for it, and
+// a func which stops it.  The proxy authenticates to the API server itself.
+func (e *env) startFlakyProxy(t *testing.T) (*flakyProxy, string, func()) {
+	t.Helper()
+	host, err := url.Parse(e.config.Host)
+	if err != nil {
+		t.Fatalf("invalid API server URL %q: %v", e.config.Host, err)
+	}
+	if host.Scheme == "" {
+		host.Scheme = "https"
+	}
+	transport, err := rest.TransportFor(e.config)
+	if err != nil {
+		t.Fatalf("can't create transport: %v", err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(host)
+	proxy.Transport = transport
+	p := &flakyProxy{proxy: proxy}
+	server := httptest.NewServer(p)
+
+	dir, err := ioutil.TempDir("", "cpva-integration")
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	stop := func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	config := clientcmdapi.NewConfig()
+	config.Clusters["proxy"] = &clientcmdapi.Cluster{Server: server.URL}
+	config.Contexts["proxy"] = &clientcmdapi.Context{Cluster: "proxy"}
+	config.CurrentContext = "proxy"
+	if err := clientcmd.WriteToFile(*config, kubeconfig); err != nil {
+		stop()
+		t.Fatalf("can't write kubeconfig: %v", err)
+	}
+	return p, kubeconfig, stop
+}
+
+func TestAPIServerUnavailableRetries(t *testing.T) {
+	e, teardown := setup(t)
+	defer teardown()
+	e.createDeployment(t, "foo")
+	defer e.addNode(t, "2")()
+
+	client, err := k8sclient.NewK8sClient(context.Background(), e.namespace, "deployment/foo", e.kubeconfig, k8sclient.Options{})
+	if err != nil {
+		t.Fatalf("can't create client: %v", err)
+	}
+	proxy, kubeconfig, stopProxy := e.startFlakyProxy(t)
+	defer stopProxy()
+	defer startAutoScaler(t, kubeconfig, e.namespace, "deployment/foo")()
+	e.waitForCPU(t, "foo", expectedCPU(t, client, 0))
+
+	// While the API server is unreachable, polls fail and nothing changes.
+	atomic.StoreInt32(&proxy.down, 1)
+	before := expectedCPU(t, client, 0)
+	defer e.addNode(t, "2")()
+	time.Sleep(3 * time.Second)
+	if got, err := e.deploymentCPU("foo"); err != nil || got.Cmp(resource.MustParse(before)) != 0 {
+		t.Fatalf("expected cpu request %s while the API server is down, got %s (%v)", before, got.String(), err)
+	}
+
+	// Once it is back, the next poll catches up.
+	atomic.StoreInt32(&proxy.down, 0)
+	e.waitForCPU(t, "foo", expectedCPU(t, client, 0))
+}
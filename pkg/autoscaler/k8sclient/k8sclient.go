@@ -17,42 +17,362 @@ limitations under the License.
 package k8sclient
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/cloud"
 	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/version"
 
+	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// SkipContainersAnnotation is a pod template annotation on the target which
+// lists, comma-separated, containers whose resources must not be changed.
+const SkipContainersAnnotation = "cpva.kubernetes.io/skip-containers"
+
+// ErrTargetGone is returned by UpdateResources if the target was deleted, or
+// is being deleted, so that it wasn't updated.
+var ErrTargetGone = errors.New("the target is gone")
+
 // K8sClient - Wraps all needed client functionalities for autoscaler
 type K8sClient interface {
 	// GetClusterSize counts schedulable nodes and cores in the cluster
 	GetClusterSize() (*ClusterSize, error)
-	// UpdateResources updates the resource needs for the containers in the target
+	// GetClusterSizeWithContext is like GetClusterSize, but the API call is
+	// aborted when ctx is cancelled.
+	GetClusterSizeWithContext(ctx context.Context) (*ClusterSize, error)
+	// UpdateResources updates the resource needs for the containers in the
+	// target, or returns ErrTargetGone if there is no target to update
 	UpdateResources(resources map[string]apiv1.ResourceRequirements) error
+	// GetCurrentResources returns the resources of the containers in the
+	// target's pod template
+	GetCurrentResources() (map[string]apiv1.ResourceRequirements, error)
+	// GetContainerUsage returns the average usage of the containers in the
+	// target's pods, from the metrics API
+	GetContainerUsage(ctx context.Context) (map[string]apiv1.ResourceList, error)
+	// WatchHPAEvents calls handler whenever an HPA in the target's namespace
+	// rescales something, until ctx is cancelled
+	WatchHPAEvents(ctx context.Context, handler func()) error
+	// WatchNodes calls onChange with the new cluster size whenever a change
+	// to the nodes changes it, starting with the current one, until ctx is
+	// cancelled.  Errors are retried.
+	WatchNodes(ctx context.Context, onChange func(*ClusterSize)) error
+	// ValidateTarget checks that the target's namespace and the target
+	// exist, and that the target has all of the containers which the config
+	// names
+	ValidateTarget() error
+	// ValidateContainers checks like ValidateTarget, but that the target
+	// has all of the given containers, e.g. those of a reloaded config
+	ValidateContainers(containers []string) error
+	// SetTarget validates the new target, which must exist and have
+	// containers at path, and then manages it instead of the current one
+	SetTarget(target string, path ContainerPath) error
+	// RecordPodEvent creates a Normal event with reason and message on the
+	// given pod
+	RecordPodEvent(namespace, name, reason, message string) error
+	// RestoreRolloutStrategy puts back the rolling update parameters which
+	// an update overrode, once the rollout it caused is complete
+	RestoreRolloutStrategy() error
+	// DeleteOutdatedPods deletes a pod of a DaemonSet with the OnDelete
+	// update strategy which doesn't have the resources of its template yet
+	DeleteOutdatedPods() error
+	// ListGatedPods returns the target's pods which have the
+	// SchedulingGate
+	ListGatedPods(ctx context.Context) ([]GatedPod, error)
+	// RemoveSchedulingGate removes the SchedulingGate from the given pod
+	RemoveSchedulingGate(podName, namespace string) error
+	// SetContainerEnv sets the environment variables, by container name,
+	// which the next updates set on the containers along with their
+	// resources
+	SetContainerEnv(env map[string][]apiv1.EnvVar)
+	// TakeSnapshot returns the last cluster size measured and the last
+	// patch applied to the target
+	TakeSnapshot() *ClusterSizeSnapshot
+	// ReadManagedConfig returns the config of the target from the ConfigMap
+	// named by its annotations, see Options.ManagedAnnotations
+	ReadManagedConfig() (*ManagedConfig, error)
 }
 
 // k8sClient - Wraps all Kubernetes API client functionality.
 type k8sClient struct {
+	// Serializes measuring the cluster size, which WatchNodes does on its
+	// own goroutine, with switching the target.
+	mu            sync.Mutex
+	namespace     string
 	target        *targetSpec
 	clientset     kubernetes.Interface
 	clusterStatus *ClusterSize
-	dryRun        bool
+	podSelector   labels.Selector
+	// If set, only pods whose annotations match are counted as matching.
+	podAnnotationSelector labels.Selector
+	pendingPods           *PendingPodsProvider
+	cpuUtilization        *CPUUtilizationProvider
+	// Caches the active pods for the pod selectors and the CPU utilization;
+	// nil if neither is set.
+	pods *podInformer
+	// If set, nodes with zero CPU capacity are not counted at all.
+	skipZeroCPUNodes bool
+	// If set, only nodes of this operating system are counted.
+	nodeOS string
+	// If set, the counted nodes are split into those with and without this
+	// taint, see ClusterSize.TaintedPoolNodes.
+	taintPool *apiv1.Taint
+	// If set, nodes which have not been Ready for longer than its grace
+	// period are not counted.
+	nodeReadiness *NodeReadiness
+	// The cloud provider whose node group labels the nodes have, detected
+	// from the first nodes of the target's cluster.  Nil if none was
+	// recognized.
+	cloudProvider cloud.CloudMetadataProvider
+	cloudDetected bool
+	// If set, nodes are counted by their memory capacity in units of this
+	// much, see weightedNodes.
+	baseNodeMemory *resource.Quantity
+	// If set, how much a control-plane node counts, see nodeWeight.
+	masterNodeWeight *float64
+	// How much nodes with certain labels count, after the control-plane
+	// nodes, and how the weights of a node matching several are combined.
+	nodeWeightRules   NodeWeightRules
+	weightAggregation WeightAggregation
+	// If set, this custom metric of the namespace is read into
+	// ClusterSize.CustomMetric.
+	customMetric string
+	// If set, the node annotation whose value overrides a node's CPU
+	// capacity, see nodeCores.
+	nodeCoresAnnotation string
+	// Other clusters whose nodes are counted too, and whether to count
+	// without those which can't be reached.
+	additionalClusters  []*clusterSource
+	partialClusterSizes bool
+	// Plausible bounds on the number of nodes, or 0 for none.
+	minNodes int
+	maxNodes int
+	dryRun   bool
+	// Where and how dry-run patches are printed.
+	dryRunOut       io.Writer
+	dryRunFormatter PatchFormatter
+	// The containers which the config names, see ValidateTarget.
+	containers []string
+	// If set, the rolling update parameters which are set along with the
+	// resources.
+	rollout *RolloutOverride
+	// Where the containers are in the target, and in any target it is
+	// switched to.
+	containerPath ContainerPath
+	// If set, the resources are also merged into the target's kubectl
+	// last-applied configuration.
+	updateLastApplied bool
+	// If set, patches of the target ask the API server to reject unknown
+	// fields.
+	serverSideValidation bool
+	// If set, the labels which are set on the target's pod template along
+	// with the resources, and their values from the last measured nodes.
+	labelPropagation LabelPropagation
+	templateLabels   map[string]string
+	// If set, the image tags which are set along with the resources.
+	imageTagPins ImageTagPins
+	// If set, the least number of nodes each node group is counted as.
+	nodeGroupMinNodes NodeGroupMinNodes
+	// The last patch applied to the target, see TakeSnapshot.
+	lastPatch     []byte
+	lastPatchType types.PatchType
+	lastPatchTime time.Time
+	// The environment variables which are set along with the resources, see
+	// SetContainerEnv.
+	containerEnv map[string][]apiv1.EnvVar
+	// If set, the resources are written to this VerticalPodAutoscaler
+	// instead of the target.
+	vpaRecommendation string
+	// The units in which quantities are written.
+	precision QuantityPrecision
+	// If set, a target with the ArgoCDManagedByAnnotation is updated
+	// through its Argo CD Application, with Helm parameters named after
+	// argoCDHelmParameter.
+	argoCDAnnotationCheck bool
+	argoCDHelmParameter   string
+	// If set, the target utilization of the HPAs which scale the target is
+	// adjusted along with its requests, through the API group in
+	// hpaGroupVersion, which is discovered on first use.
+	coordinateHPA   bool
+	hpaGroupVersion string
+	// If set, the outdated pods of a DaemonSet with the OnDelete update
+	// strategy are deleted, one per podDeletionInterval, see
+	// DeleteOutdatedPods.
+	deleteOutdatedPods  bool
+	podDeletionInterval time.Duration
+	lastPodDeletion     time.Time
+	// The template generation of the DaemonSet which the last update
+	// produced, see recordTemplateGeneration.
+	patchedGeneration string
+}
+
+// Options holds the optional behaviours of a k8sClient.
+type Options struct {
+	// If not empty, ready pods in the namespace matching this selector are
+	// counted into ClusterSize.MatchingPods.
+	PodSelector string
+	// If not empty, ready pods in the namespace whose annotations match this
+	// selector, in the syntax of label selectors, are counted into
+	// ClusterSize.MatchingPods.  With PodSelector, pods must match both.
+	PodAnnotationSelector string
+	// If set, the target's Pending pods are counted into
+	// ClusterSize.PendingPods.
+	CountPendingPods bool
+	// If set, the share of the allocatable CPU of the target's cluster which
+	// pods request is measured into ClusterSize.CPUUtilization.
+	CountCPUUtilization bool
+	// If set, nodes which report zero CPU capacity, e.g. some virtual nodes,
+	// are not counted as nodes.
+	SkipZeroCPUNodes bool
+	// If set, only nodes whose kubernetes.io/os label has this value, e.g.
+	// "linux", are counted as nodes.
+	NodeOS string
+	// If set, the counted nodes which have this taint are counted into
+	// ClusterSize.TaintedPoolNodes, and the others into
+	// ClusterSize.MainPoolNodes.
+	TaintPool *apiv1.Taint
+	// If not 0, nodes which have not been Ready for longer than this are not
+	// counted as nodes.  Nodes which are NotReady for a shorter time still
+	// are.
+	NodeReadyGracePeriod time.Duration
+	// If set, ClusterSize.Nodes is not the number of nodes but the sum of
+	// their memory capacities divided by BaseNodeMemory, so that a node
+	// with 32 times the memory counts as 32 nodes.
+	BaseNodeMemory *resource.Quantity
+	// If set, nodes with a control-plane role label count as this fraction,
+	// from 0 to 1, of a node and of their cores.  Otherwise they count fully.
+	MasterNodeWeight *float64
+	// If set, nodes with these labels count as the rules' weights of a node
+	// and of their cores, combined by WeightAggregation if several match.
+	NodeWeightRules   NodeWeightRules
+	WeightAggregation WeightAggregation
+	// If set, this metric of the namespace is read from the custom metrics
+	// API into ClusterSize.CustomMetric.
+	CustomMetric string
+	// If set, a node annotated with this key, e.g. "example.com/real-cores",
+	// is counted as having the annotation's value of cores rather than its
+	// reported CPU capacity.
+	NodeCoresAnnotation string
+	// If not 0, a cluster size with fewer nodes is assumed to be a bad
+	// report, and is returned as an error.
+	MinNodes int
+	// If not 0, a cluster size with more nodes is assumed to be a bad
+	// report, and is returned as an error.
+	MaxNodes int
+	// Other clusters, as "KUBECONFIG[#CONTEXT]", whose nodes and cores are
+	// added to those of the target's cluster.
+	AdditionalClusters []string
+	// If set, an additional cluster which can't be reached is left out of
+	// the cluster size, instead of failing it.
+	PartialClusterSizes bool
+	// How API objects are encoded, "protobuf" or "json".  Defaults to
+	// protobuf, which some aggregated API servers don't support.
+	APIContentType string
+	// If set, all requests to the target's cluster are made as this user,
+	// and as members of ImpersonateGroups.  Additional clusters impersonate
+	// as their kubeconfigs say.
+	ImpersonateUser   string
+	ImpersonateGroups []string
+	// If set, check at startup that the namespace and the target exist, and
+	// that the target has all of the Containers, see ValidateTarget.
+	ValidateTarget bool
+	// If not 0, wait at startup for up to this long for the target to be
+	// created, rather than failing if its kind isn't served yet, and ensure
+	// that it exists.
+	TargetCreationTimeout time.Duration
+	// The containers which the config names.
+	Containers []string
+	// If set, updates are computed but not applied.
+	DryRun bool
+	// How dry-run patches are printed to stdout.  Defaults to JSON.
+	DryRunFormatter PatchFormatter
+	// If set, the rolling update parameters of a Deployment are set in the
+	// same patch as its resources.
+	RolloutOverride *RolloutOverride
+	// Where the containers are in the target, for kinds which don't keep
+	// them at DefaultContainerPath.
+	ContainerPath ContainerPath
+	// The units in which quantities are written to the target, by
+	// resource.  Others are written as computed.
+	QuantityPrecision QuantityPrecision
+	// If set, and the target has the ArgoCDManagedByAnnotation, the
+	// resources are set as Helm parameters of the Argo CD Application
+	// instead, named after ArgoCDHelmParameter, which defaults to
+	// DefaultArgoCDHelmParameter.
+	ArgoCDAnnotationCheck bool
+	ArgoCDHelmParameter   string
+	// If set, and the target was created by kubectl apply, the resources are
+	// also merged into its LastAppliedAnnotation, so that the next apply
+	// doesn't revert them.
+	UpdateLastApplied bool
+	// If set, patches of the target are sent with fieldValidation=Strict, so
+	// that an API server of Kubernetes 1.25 or later rejects any unknown
+	// fields rather than dropping them.  Older API servers ignore it.
+	ServerSideValidation bool
+	// If set, labels of the target's pod template are set, along with the
+	// resources, to the most common values of node labels.
+	LabelPropagation LabelPropagation
+	// If set, the image of each of these containers is pinned to the tag,
+	// in the same patch as its resources.
+	ImageTagPins ImageTagPins
+	// If set, node groups with fewer nodes are counted as having this many,
+	// if the cloud provider was recognized from the node labels.
+	NodeGroupMinNodes NodeGroupMinNodes
+	// If set, the target is never updated.  Instead, its resources are
+	// written as the recommendation of the VerticalPodAutoscaler of this
+	// name in its namespace, for VPA tooling to pick up.
+	VPARecommendation string
+	// If set, a target of the form "replicaset/pod-template-hash=HASH" is
+	// resolved to the ReplicaSet with that label at startup, see
+	// IsReplicaSetByHash.
+	ReplicaSetByHash bool
+	// If set, once the target's requests change, the target utilization of
+	// the cpu and memory metrics of the HPAs which scale it is scaled by the
+	// ratio of the old to the new requests per pod, so that the HPAs keep
+	// the same number of replicas for the same usage.  It needs the
+	// autoscaling/v2 API, or autoscaling/v2beta2 before Kubernetes 1.23.
+	CoordinateHPA bool
+	// If set, and the target is a DaemonSet with the OnDelete update
+	// strategy, which doesn't replace its pods when their template changes,
+	// the pods whose resources are not those of the template are deleted, at
+	// most one per PodDeletionInterval, which defaults to
+	// DefaultDaemonSetPodDeletionInterval.
+	DeleteOutdatedPods  bool
+	PodDeletionInterval time.Duration
+	// If set, and there is no target, the target is the only Deployment of
+	// the namespace with the ManagedAnnotation "true", as the mutating
+	// webhook sets it, see ReadManagedConfig.
+	ManagedAnnotations bool
 }
 
-// NewK8sClient gives a k8sClient with the given dependencies.
-func NewK8sClient(namespace, target, kubeconfig string, dryRun bool) (K8sClient, error) {
+// NewK8sClient gives a k8sClient with the given dependencies.  The API
+// discovery of the target is aborted if ctx is cancelled.
+func NewK8sClient(ctx context.Context, namespace, target, kubeconfig string, opts Options) (K8sClient, error) {
 	var config *rest.Config
 	var err error
 	if kubeconfig != "" {
@@ -64,23 +384,184 @@ func NewK8sClient(namespace, target, kubeconfig string, dryRun bool) (K8sClient,
 		return nil, err
 	}
 	config.UserAgent = userAgent()
-	// Use protobufs for communication with apiserver.
-	config.ContentType = "application/vnd.kubernetes.protobuf"
+	if err := setContentType(config, opts.APIContentType); err != nil {
+		return nil, err
+	}
+	setImpersonation(config, opts.ImpersonateUser, opts.ImpersonateGroups)
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
-	tgt, err := makeTarget(clientset, target, namespace)
+	if target == "" && opts.ManagedAnnotations {
+		if target, err = findManagedDeployment(clientset, namespace); err != nil {
+			return nil, err
+		}
+	}
+	// Without a target, e.g. with --self-test, only the cluster is measured.
+	var tgt *targetSpec
+	if target != "" {
+		if tgt, err = resolveTarget(ctx, clientset, target, namespace, opts); err != nil {
+			return nil, err
+		}
+	}
+	var selector labels.Selector
+	if opts.PodSelector != "" {
+		selector, err = labels.Parse(opts.PodSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod selector %q: %v", opts.PodSelector, err)
+		}
+	}
+	var annotationSelector labels.Selector
+	if opts.PodAnnotationSelector != "" {
+		annotationSelector, err = labels.Parse(opts.PodAnnotationSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod annotations selector %q: %v", opts.PodAnnotationSelector, err)
+		}
+	}
+	formatter := opts.DryRunFormatter
+	if formatter == nil {
+		formatter = JSONPatchFormatter{}
+	}
+	var additional []*clusterSource
+	for _, entry := range opts.AdditionalClusters {
+		src, err := newClusterSource(entry, opts.APIContentType)
+		if err != nil {
+			return nil, err
+		}
+		additional = append(additional, src)
+	}
+	var pending *PendingPodsProvider
+	if opts.CountPendingPods && tgt != nil {
+		pending = &PendingPodsProvider{clientset: clientset, target: tgt}
+	}
+
+	// The CPU utilization needs the pods of all namespaces, and the pod
+	// selectors only those of the target's, which is always namespace.
+	var pods *podInformer
+	if opts.CountCPUUtilization {
+		pods = newPodInformer(ctx, clientset, "")
+	} else if selector != nil || annotationSelector != nil {
+		pods = newPodInformer(ctx, clientset, namespace)
+	}
+	var utilization *CPUUtilizationProvider
+	if opts.CountCPUUtilization {
+		utilization = &CPUUtilizationProvider{pods: pods}
+	}
+
+	var readiness *NodeReadiness
+	if opts.NodeReadyGracePeriod > 0 {
+		readiness = NewNodeReadiness(opts.NodeReadyGracePeriod, clock.RealClock{})
+	}
+
+	k := &k8sClient{
+		namespace:             namespace,
+		clientset:             clientset,
+		target:                tgt,
+		podSelector:           selector,
+		podAnnotationSelector: annotationSelector,
+		pendingPods:           pending,
+		cpuUtilization:        utilization,
+		pods:                  pods,
+		skipZeroCPUNodes:      opts.SkipZeroCPUNodes,
+		nodeOS:                opts.NodeOS,
+		taintPool:             opts.TaintPool,
+		nodeReadiness:         readiness,
+		baseNodeMemory:        opts.BaseNodeMemory,
+		masterNodeWeight:      opts.MasterNodeWeight,
+		nodeWeightRules:       opts.NodeWeightRules,
+		weightAggregation:     opts.WeightAggregation,
+		customMetric:          opts.CustomMetric,
+		nodeCoresAnnotation:   opts.NodeCoresAnnotation,
+		additionalClusters:    additional,
+		partialClusterSizes:   opts.PartialClusterSizes,
+		minNodes:              opts.MinNodes,
+		maxNodes:              opts.MaxNodes,
+		dryRun:                opts.DryRun,
+		dryRunOut:             os.Stdout,
+		dryRunFormatter:       formatter,
+		containers:            opts.Containers,
+		rollout:               opts.RolloutOverride,
+		containerPath:         opts.ContainerPath,
+		updateLastApplied:     opts.UpdateLastApplied,
+		serverSideValidation:  opts.ServerSideValidation,
+		labelPropagation:      opts.LabelPropagation,
+		imageTagPins:          opts.ImageTagPins,
+		nodeGroupMinNodes:     opts.NodeGroupMinNodes,
+		vpaRecommendation:     opts.VPARecommendation,
+		precision:             opts.QuantityPrecision,
+		argoCDAnnotationCheck: opts.ArgoCDAnnotationCheck,
+		argoCDHelmParameter:   opts.ArgoCDHelmParameter,
+		coordinateHPA:         opts.CoordinateHPA,
+		deleteOutdatedPods:    opts.DeleteOutdatedPods,
+		podDeletionInterval:   opts.PodDeletionInterval,
+	}
+	if k.podDeletionInterval == 0 {
+		k.podDeletionInterval = DefaultDaemonSetPodDeletionInterval
+	}
+	if k.argoCDHelmParameter == "" {
+		k.argoCDHelmParameter = DefaultArgoCDHelmParameter
+	}
+	if opts.ValidateTarget && tgt != nil {
+		if err := k.ValidateTarget(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// resolveTarget finds the target at startup, waiting for it to be created if
+// opts.TargetCreationTimeout is set.
+func resolveTarget(ctx context.Context, clientset kubernetes.Interface, target, namespace string, opts Options) (*targetSpec, error) {
+	var err error
+	if IsReplicaSetByHash(target) {
+		if !opts.ReplicaSetByHash {
+			return nil, fmt.Errorf("target %s selects a ReplicaSet by its pod-template-hash, which requires --allow-replicaset-by-hash", target)
+		}
+		if target, err = resolveReplicaSetByHash(clientset, target, namespace); err != nil {
+			return nil, err
+		}
+	}
+	var tgt *targetSpec
+	if opts.TargetCreationTimeout > 0 {
+		b := &backoff{initial: targetWaitInitialBackoff, max: targetWaitMaxBackoff}
+		tgt, err = waitForTarget(ctx, clientset, target, namespace, opts.ContainerPath, opts.TargetCreationTimeout, b)
+	} else {
+		tgt, err = makeTarget(ctx, clientset, target, namespace, opts.ContainerPath)
+	}
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("startup canceled: %v", err)
+		}
 		return nil, err
 	}
+	return tgt, nil
+}
 
-	return &k8sClient{
-		clientset: clientset,
-		target:    tgt,
-		dryRun:    dryRun,
-	}, nil
+// setImpersonation makes requests made with config act as user and groups.
+// An empty user leaves config's own credentials in effect.
+func setImpersonation(config *rest.Config, user string, groups []string) {
+	if user == "" {
+		return
+	}
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: user,
+		Groups:   groups,
+	}
+}
+
+// setContentType sets the encoding of API objects, "protobuf" (the default)
+// or "json".
+func setContentType(config *rest.Config, contentType string) error {
+	switch contentType {
+	case "", "protobuf":
+		config.ContentType = "application/vnd.kubernetes.protobuf"
+	case "json":
+		config.ContentType = "application/json"
+	default:
+		return fmt.Errorf("unknown API content type %q, must be protobuf or json", contentType)
+	}
+	return nil
 }
 
 func userAgent() string {
@@ -94,15 +575,38 @@ func userAgent() string {
 	return command + "/" + version.VERSION
 }
 
-func makeTarget(client kubernetes.Interface, target, namespace string) (*targetSpec, error) {
+// parseTarget splits a target of the form kind/name.
+func parseTarget(target string) (kind, name string, err error) {
 	splits := strings.Split(target, "/")
 	if len(splits) != 2 {
-		return nil, fmt.Errorf("target format error: %v", target)
+		return "", "", fmt.Errorf("target format error: %v", target)
 	}
-	kind := splits[0]
-	name := splits[1]
+	return splits[0], splits[1], nil
+}
 
-	kind, groupVersions, err := discoverAPI(client, kind)
+// makeTarget discovers the target's API, and chooses how to patch it.
+func makeTarget(ctx context.Context, client kubernetes.Interface, target, namespace string, path ContainerPath) (*targetSpec, error) {
+	tgt, err := discoverTarget(ctx, client, target, namespace, path)
+	if err != nil {
+		return nil, err
+	}
+	tgt.strategy = choosePatchStrategy(ctx, client, tgt)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tgt, nil
+}
+
+// discoverTarget is makeTarget without choosing the patch strategy, which
+// reads the apiserver's whole OpenAPI schema and so is only done once the
+// target was found.
+func discoverTarget(ctx context.Context, client kubernetes.Interface, target, namespace string, path ContainerPath) (*targetSpec, error) {
+	kind, name, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, groupVersions, err := discoverAPI(ctx, client, kind)
 	if err != nil {
 		return nil, err
 	}
@@ -111,12 +615,68 @@ func makeTarget(client kubernetes.Interface, target, namespace string) (*targetS
 	if err != nil {
 		return nil, err
 	}
+	tgt.containerPath = path
 
 	glog.V(4).Infof("Discovered target %s in %v", target, tgt.GroupVersion)
 	return tgt, nil
 }
 
-func discoverAPI(client kubernetes.Interface, kindArg string) (kind string, groupVersions map[string]bool, err error) {
+// ValidateTarget checks that the target's namespace exists, then that the
+// target does, so that a typo in either is reported as such, and finally that
+// the target has all of the configured containers.
+func (k *k8sClient) ValidateTarget() error {
+	return validateTarget(k.clientset, k.target, k.containers)
+}
+
+// ValidateContainers checks the target like ValidateTarget, but for the
+// given containers rather than those of the config at startup.
+func (k *k8sClient) ValidateContainers(containers []string) error {
+	return validateTarget(k.clientset, k.target, containers)
+}
+
+func validateTarget(client kubernetes.Interface, tgt *targetSpec, containers []string) error {
+	if _, err := client.CoreV1().Namespaces().Get(tgt.Namespace, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("namespace %q not found", tgt.Namespace)
+		}
+		return fmt.Errorf("can't get namespace %q: %v", tgt.Namespace, err)
+	}
+	obj, err := tgt.Get(client)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("%s %q not found in namespace %q", tgt.Kind, tgt.Name, tgt.Namespace)
+		}
+		return fmt.Errorf("can't get %s %s/%s: %v", tgt.Kind, tgt.Namespace, tgt.Name, err)
+	}
+	ctrs, err := tgt.containers(obj)
+	if err != nil {
+		return err
+	}
+	found := []string{}
+	for _, ctr := range ctrs {
+		found = append(found, ctr.Name)
+	}
+	for _, name := range containers {
+		if !containsString(found, name) {
+			return fmt.Errorf("container %q not found in %s %q (found: [%s])", name, tgt.Kind, tgt.Name, strings.Join(found, ", "))
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverAPI finds the group versions which serve kindArg.  The discovery
+// client doesn't take a context, so if ctx is cancelled first, its error is
+// returned without waiting for the discovery to finish.
+func discoverAPI(ctx context.Context, client kubernetes.Interface, kindArg string) (kind string, groupVersions map[string]bool, err error) {
 	var plural string
 	switch strings.ToLower(kindArg) {
 	case "deployment":
@@ -132,9 +692,25 @@ func discoverAPI(client kubernetes.Interface, kindArg string) (kind string, grou
 		return "", nil, fmt.Errorf("unknown kind %q", kindArg)
 	}
 
-	resourceLists, err := client.Discovery().ServerPreferredNamespacedResources()
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to discover apigroup for kind %q: %v", kind, err)
+	type discovery struct {
+		resourceLists []*metav1.APIResourceList
+		err           error
+	}
+	// Buffered, so that an abandoned discovery doesn't block.
+	discovered := make(chan discovery, 1)
+	go func() {
+		resourceLists, err := client.Discovery().ServerPreferredNamespacedResources()
+		discovered <- discovery{resourceLists, err}
+	}()
+	var resourceLists []*metav1.APIResourceList
+	select {
+	case d := <-discovered:
+		if d.err != nil {
+			return "", nil, fmt.Errorf("failed to discover apigroup for kind %q: %v", kind, d.err)
+		}
+		resourceLists = d.resourceLists
+	case <-ctx.Done():
+		return "", nil, fmt.Errorf("discovery of apigroup for kind %q aborted: %v", kind, ctx.Err())
 	}
 
 	groupVersions = map[string]bool{}
@@ -157,6 +733,9 @@ type targetSpec struct {
 	Namespace    string
 	Name         string
 	patcher      patchFunc
+	strategy     patchStrategy
+	// Where the containers are in the target.
+	containerPath ContainerPath
 }
 
 // Captures the namespace and name to patch, and calls the best
@@ -182,6 +761,96 @@ func (tgt *targetSpec) Patch(client kubernetes.Interface, pt types.PatchType, da
 	return tgt.patcher(client, tgt.Namespace, tgt.Name, pt, data)
 }
 
+// PatchStrict patches the target like Patch, but asks the API server to
+// reject any fields of data which the target's schema doesn't know.  The
+// typed clients can't pass the parameter, so this uses the REST client.
+func (tgt *targetSpec) PatchStrict(client kubernetes.Interface, pt types.PatchType, data []byte) error {
+	rc, err := restClientFor(client, tgt.GroupVersion)
+	if err != nil {
+		return err
+	}
+	_, err = rc.Patch(pt).
+		Namespace(tgt.Namespace).
+		Resource(strings.ToLower(tgt.Kind)+"s").
+		Name(tgt.Name).
+		Param("fieldValidation", "Strict").
+		Body(data).
+		DoRaw()
+	return err
+}
+
+// targetObject holds the parts of a target object that we read.  All of the
+// supported kinds share this layout.
+type targetObject struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Selector *metav1.LabelSelector `json:"selector,omitempty"`
+		Template apiv1.PodTemplateSpec `json:"template,omitempty"`
+		Replicas *int32                `json:"replicas,omitempty"`
+		// Only Deployments have a strategy.
+		Strategy *appsv1.DeploymentStrategy `json:"strategy,omitempty"`
+		// Only DaemonSets have an update strategy.
+		UpdateStrategy *appsv1.DaemonSetUpdateStrategy `json:"updateStrategy,omitempty"`
+	} `json:"spec,omitempty"`
+	Status struct {
+		ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+		Replicas           int32 `json:"replicas,omitempty"`
+		UpdatedReplicas    int32 `json:"updatedReplicas,omitempty"`
+		AvailableReplicas  int32 `json:"availableReplicas,omitempty"`
+		// Only of DaemonSets.
+		NumberUnavailable int32 `json:"numberUnavailable,omitempty"`
+	} `json:"status,omitempty"`
+	// The object as it was read, for containers at another path.
+	raw []byte
+}
+
+// Get fetches the current state of the target.
+func (tgt *targetSpec) Get(client kubernetes.Interface) (*targetObject, error) {
+	rc, err := restClientFor(client, tgt.GroupVersion)
+	if err != nil {
+		return nil, err
+	}
+	// Always ask for JSON, since targetObject is not a registered type.
+	data, err := rc.Get().
+		Namespace(tgt.Namespace).
+		Resource(strings.ToLower(tgt.Kind)+"s").
+		Name(tgt.Name).
+		SetHeader("Accept", "application/json").
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	obj := &targetObject{raw: data}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, fmt.Errorf("can't decode %s %s/%s: %v", tgt.Kind, tgt.Namespace, tgt.Name, err)
+	}
+	return obj, nil
+}
+
+// containers returns the containers of obj, from where the target keeps them.
+func (tgt *targetSpec) containers(obj *targetObject) ([]apiv1.Container, error) {
+	if tgt.containerPath.isDefault() {
+		return obj.Spec.Template.Spec.Containers, nil
+	}
+	return tgt.containerPath.containers(obj.raw)
+}
+
+// restClientFor returns the REST client for one of the group-versions that
+// findPatcher can return.
+func restClientFor(client kubernetes.Interface, groupVersion string) (rest.Interface, error) {
+	switch groupVersion {
+	case "apps/v1":
+		return client.AppsV1().RESTClient(), nil
+	case "apps/v1beta2":
+		return client.AppsV1beta2().RESTClient(), nil
+	case "apps/v1beta1":
+		return client.AppsV1beta1().RESTClient(), nil
+	case "extensions/v1beta1":
+		return client.ExtensionsV1beta1().RESTClient(), nil
+	}
+	return nil, fmt.Errorf("unsupported API group: %s", groupVersion)
+}
+
 // findPatcher returns a groupVersion string and a patch function for the
 // specified kind.  This is needed because, at least in theory, the schema of a
 // resource could change dramatically, and we should use statically versioned
@@ -291,68 +960,807 @@ func findReplicaSetPatcher(groupVersions map[string]bool) (string, patchFunc, er
 type ClusterSize struct {
 	Nodes int
 	Cores int
+	// ListedNodes is the number of nodes before any were filtered out, see
+	// Nodes.
+	ListedNodes int
+	// MatchingPods is the number of ready pods matching the pod selector, if
+	// one was given.
+	MatchingPods int
+	// PendingPods is the number of the target's pods which are Pending, if
+	// they are counted.
+	PendingPods int
+	// AverageNodeCores is Cores divided by Nodes, rounded up.  The number of
+	// nodes may be floored, see the --min-effective-nodes flag.
+	AverageNodeCores int
+	// Memory is the total memory capacity of the counted nodes.
+	Memory resource.Quantity
+	// CPURequested and CPUAllocatable are the CPU requested by pods, and the
+	// allocatable CPU, of the counted nodes of the target's cluster, if they
+	// are measured.  CPUUtilization is the former as a percentage of the
+	// latter, rounded down.
+	CPURequested   resource.Quantity
+	CPUAllocatable resource.Quantity
+	CPUUtilization int
+	// GPUs is the number of GPUs of the counted nodes.
+	GPUs int
+	// CustomMetric is the value of the custom metric, if one is read.
+	CustomMetric int
+	// NodeGroups is the number of counted nodes in each node group, e.g. a
+	// GKE node pool, by the name of the group, if the cloud provider was
+	// recognized from the node labels.  Nodes without a group are left out.
+	NodeGroups map[string]int
+	// MainPoolNodes and TaintedPoolNodes are the numbers of counted nodes
+	// without and with the --taint-toleration-match taint, if one is given.
+	// They are not weighted.
+	MainPoolNodes    int
+	TaintedPoolNodes int
+}
+
+// Equal returns whether two cluster sizes are the same.  Memory is compared
+// by value, so that e.g. 1Gi and 1024Mi are equal.
+func (c *ClusterSize) Equal(o *ClusterSize) bool {
+	return c.Nodes == o.Nodes &&
+		c.Cores == o.Cores &&
+		c.ListedNodes == o.ListedNodes &&
+		c.MatchingPods == o.MatchingPods &&
+		c.PendingPods == o.PendingPods &&
+		c.AverageNodeCores == o.AverageNodeCores &&
+		c.Memory.Cmp(o.Memory) == 0 &&
+		c.CPURequested.Cmp(o.CPURequested) == 0 &&
+		c.CPUAllocatable.Cmp(o.CPUAllocatable) == 0 &&
+		c.CPUUtilization == o.CPUUtilization &&
+		c.GPUs == o.GPUs &&
+		c.CustomMetric == o.CustomMetric &&
+		c.MainPoolNodes == o.MainPoolNodes &&
+		c.TaintedPoolNodes == o.TaintedPoolNodes &&
+		reflect.DeepEqual(c.NodeGroups, o.NodeGroups)
+}
+
+func (k *k8sClient) GetClusterSize() (*ClusterSize, error) {
+	return k.GetClusterSizeWithContext(context.Background())
 }
 
-func (k *k8sClient) GetClusterSize() (clusterStatus *ClusterSize, err error) {
-	opt := metav1.ListOptions{Watch: false}
+func (k *k8sClient) GetClusterSizeWithContext(ctx context.Context) (clusterStatus *ClusterSize, err error) {
+	nodes, err := listNodes(ctx, k.clientset)
+	if err != nil {
+		return nil, err
+	}
+	return k.clusterSizeOf(ctx, nodes)
+}
 
-	nodes, err := k.clientset.CoreV1().Nodes().List(opt)
-	if err != nil || nodes == nil {
+// clusterSizeOf measures the cluster size given the nodes of the target's
+// cluster.
+func (k *k8sClient) clusterSizeOf(ctx context.Context, nodes []apiv1.Node) (clusterStatus *ClusterSize, err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	listed := len(nodes)
+	if !k.cloudDetected && listed > 0 {
+		k.detectCloudProvider(nodes)
+	}
+	counted := k.filterNodes(nodes)
+	// Pods are only listed in the target's cluster.
+	local := counted
+	for _, src := range k.additionalClusters {
+		more, err := listNodes(ctx, src.clientset)
+		if err != nil {
+			if !k.partialClusterSizes || ctx.Err() != nil {
+				return nil, fmt.Errorf("can't list the nodes of cluster %s: %v", src.name, err)
+			}
+			glog.Warningf("Counting without cluster %s, whose nodes can't be listed: %v", src.name, err)
+			continue
+		}
+		listed += len(more)
+		counted = append(counted, k.filterNodes(more)...)
+	}
+	if k.nodeReadiness != nil {
+		k.nodeReadiness.Sweep()
+	}
+	if k.labelPropagation != nil {
+		k.templateLabels = k.labelPropagation.Labels(counted)
+		glog.V(4).Infof("Labels to propagate %v", k.templateLabels)
+	}
+	if err := k.checkNodeCount(len(counted)); err != nil {
 		return nil, err
 	}
 	clusterStatus = &ClusterSize{}
-	clusterStatus.Nodes = len(nodes.Items)
-	var tc resource.Quantity
+	clusterStatus.ListedNodes = listed
+	var tc, tm resource.Quantity
+	overridden, weighted := 0, 0
+	var nodesByWeight, coresByWeight float64
 	// All nodes are considered, even those that are marked as unshedulable,
-	// this includes the master.
-	for _, node := range nodes.Items {
-		tc.Add(node.Status.Capacity[apiv1.ResourceCPU])
+	// this includes the master, unless --master-node-weight says otherwise.
+	for _, node := range counted {
+		cpu, found := nodeCores(&node, k.nodeCoresAnnotation)
+		if found {
+			overridden++
+		}
+		if weight, matched := k.matchNodeWeight(&node); matched {
+			weighted++
+			nodesByWeight += weight
+			coresByWeight += weight * float64(cpu.MilliValue()) / 1000
+		} else {
+			tc.Add(cpu)
+		}
+		tm.Add(node.Status.Capacity[apiv1.ResourceMemory])
+	}
+	if overridden > 0 {
+		glog.V(2).Infof("Read the cores of %d nodes from their %s annotation", overridden, k.nodeCoresAnnotation)
 	}
 
 	tcInt64, tcOk := tc.AsInt64()
 	if !tcOk {
 		return nil, fmt.Errorf("unable to compute integer values of cores in the cluster")
 	}
+	clusterStatus.Nodes = len(counted)
 	clusterStatus.Cores = int(tcInt64)
+	if weighted > 0 {
+		clusterStatus.Nodes = len(counted) - weighted + int(math.Round(nodesByWeight))
+		clusterStatus.Cores += int(math.Round(coresByWeight))
+		glog.V(2).Infof("Counted %d weighted nodes as %v nodes with %v cores", weighted, nodesByWeight, coresByWeight)
+	}
+	clusterStatus.AverageNodeCores = AverageNodeCores(clusterStatus.Cores, clusterStatus.Nodes, 1)
+	clusterStatus.Memory = tm
+	clusterStatus.GPUs = countGPUs(counted)
+	if k.cloudProvider != nil {
+		clusterStatus.NodeGroups = cloud.CountNodeGroups(k.cloudProvider, counted)
+	}
+	if k.taintPool != nil {
+		clusterStatus.MainPoolNodes, clusterStatus.TaintedPoolNodes = countTaintPools(counted, k.taintPool)
+	}
+	if k.baseNodeMemory != nil {
+		clusterStatus.Nodes = weightedNodes(counted, *k.baseNodeMemory, k.nodeWeight)
+	}
+	if clusterStatus.NodeGroups != nil && k.nodeGroupMinNodes != nil {
+		if added := k.nodeGroupMinNodes.apply(clusterStatus.NodeGroups); added > 0 {
+			clusterStatus.Nodes += added
+			glog.V(2).Infof("Counted %d more nodes for node groups below their minimum", added)
+		}
+	}
+
+	if k.podSelector != nil || k.podAnnotationSelector != nil {
+		n, err := k.countMatchingPods(ctx)
+		if err != nil {
+			return nil, err
+		}
+		clusterStatus.MatchingPods = n
+	}
+	if k.cpuUtilization != nil {
+		requested, allocatable, err := k.cpuUtilization.Measure(ctx, local)
+		if err != nil {
+			return nil, err
+		}
+		clusterStatus.CPURequested = requested
+		clusterStatus.CPUAllocatable = allocatable
+		clusterStatus.CPUUtilization = CPUUtilization(requested, allocatable)
+	}
+	if k.pendingPods != nil {
+		n, err := k.pendingPods.Count(ctx)
+		if err != nil {
+			return nil, err
+		}
+		clusterStatus.PendingPods = n
+	}
+	if k.customMetric != "" {
+		n, err := k.readCustomMetric(ctx, k.customMetric)
+		if err != nil {
+			return nil, err
+		}
+		clusterStatus.CustomMetric = n
+	}
 	k.clusterStatus = clusterStatus
 	return clusterStatus, nil
 }
 
+// detectCloudProvider recognizes the cloud provider from the labels of the
+// target cluster's nodes, once.
+func (k *k8sClient) detectCloudProvider(nodes []apiv1.Node) {
+	k.cloudDetected = true
+	k.cloudProvider = cloud.Detect(nodes)
+	if k.cloudProvider == nil {
+		glog.V(2).Infof("No cloud provider recognized from the node labels, not counting node groups")
+		return
+	}
+	glog.V(0).Infof("Detected cloud provider %s, counting node groups by the %s label", k.cloudProvider.Name(), k.cloudProvider.NodeGroupLabel())
+}
+
+// checkNodeCount rejects implausible numbers of nodes, e.g. an empty list
+// during a transient API problem, so that resources are not scaled to them.
+func (k *k8sClient) checkNodeCount(nodes int) error {
+	if k.minNodes > 0 && nodes < k.minNodes {
+		return fmt.Errorf("found %d nodes, fewer than the minimum of %d", nodes, k.minNodes)
+	}
+	if k.maxNodes > 0 && nodes > k.maxNodes {
+		return fmt.Errorf("found %d nodes, more than the maximum of %d", nodes, k.maxNodes)
+	}
+	return nil
+}
+
+// filterNodes returns the nodes which should be counted.
+func (k *k8sClient) filterNodes(nodes []apiv1.Node) []apiv1.Node {
+	if !k.skipZeroCPUNodes && k.nodeOS == "" && k.nodeReadiness == nil {
+		return nodes
+	}
+	counted := make([]apiv1.Node, 0, len(nodes))
+	zeroCPU, otherOS, notReady := 0, 0, 0
+	for _, node := range nodes {
+		if k.nodeOS != "" && nodeOS(&node) != k.nodeOS {
+			otherOS++
+			continue
+		}
+		cpu, _ := nodeCores(&node, k.nodeCoresAnnotation)
+		if k.skipZeroCPUNodes && cpu.IsZero() {
+			zeroCPU++
+			continue
+		}
+		if k.nodeReadiness != nil && !k.nodeReadiness.Counts(&node) {
+			notReady++
+			continue
+		}
+		counted = append(counted, node)
+	}
+	if otherOS > 0 {
+		glog.V(2).Infof("Excluded %d nodes whose OS is not %s", otherOS, k.nodeOS)
+	}
+	if zeroCPU > 0 {
+		glog.V(2).Infof("Excluded %d nodes with zero CPU capacity", zeroCPU)
+	}
+	if notReady > 0 {
+		glog.V(2).Infof("Excluded %d nodes which have not been Ready for longer than %v", notReady, k.nodeReadiness.gracePeriod)
+	}
+	return counted
+}
+
+// nodeCores returns the node's CPU capacity, or the whole number of cores in
+// its annotation if one is given and the node has a valid one, and whether it
+// was the annotation.  Some bare-metal kubelets misreport the capacity.
+func nodeCores(node *apiv1.Node, annotation string) (resource.Quantity, bool) {
+	if annotation != "" {
+		if value, found := node.Annotations[annotation]; found {
+			cores, err := strconv.Atoi(strings.TrimSpace(value))
+			if err == nil && cores >= 0 {
+				return *resource.NewQuantity(int64(cores), resource.DecimalSI), true
+			}
+			glog.V(2).Infof("Ignoring the invalid %s annotation %q of node %s", annotation, value, node.Name)
+		}
+	}
+	return node.Status.Capacity[apiv1.ResourceCPU], false
+}
+
+// weightedNodes returns the number of nodes of base memory which the nodes'
+// memory capacities add up to, rounded to the nearest one.  Any node counts
+// as at least one in total, so that a cluster of small nodes is not empty.
+func weightedNodes(nodes []apiv1.Node, base resource.Quantity, weight func(*apiv1.Node) float64) int {
+	if len(nodes) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, node := range nodes {
+		mem := node.Status.Capacity[apiv1.ResourceMemory]
+		sum += weight(&node) * float64(mem.Value()) / float64(base.Value())
+	}
+	if n := int(math.Round(sum)); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// nodeWeight returns how much a node counts, see matchNodeWeight.
+func (k *k8sClient) nodeWeight(node *apiv1.Node) float64 {
+	weight, _ := k.matchNodeWeight(node)
+	return weight
+}
+
+// matchNodeWeight returns how much a node counts, and whether any rule
+// matched it.  The --master-node-weight of a control-plane node, if it is
+// set, is the first rule, followed by the --node-label-weight rules in order.
+// The weights of all rules that match are combined by the aggregation.  A
+// node which matches none counts as 1.
+func (k *k8sClient) matchNodeWeight(node *apiv1.Node) (float64, bool) {
+	var weights []float64
+	if k.masterNodeWeight != nil && isControlPlane(node) {
+		weights = append(weights, *k.masterNodeWeight)
+	}
+	weights = append(weights, k.nodeWeightRules.matching(node)...)
+	if len(weights) == 0 {
+		return 1, false
+	}
+	return k.weightAggregation.combine(weights), true
+}
+
+// controlPlaneLabels are the role labels of control-plane nodes.  Clusters
+// before 1.20 only set the master one.
+var controlPlaneLabels = []string{
+	"node-role.kubernetes.io/control-plane",
+	"node-role.kubernetes.io/master",
+}
+
+// isControlPlane returns whether the node has a control-plane role label.
+func isControlPlane(node *apiv1.Node) bool {
+	for _, label := range controlPlaneLabels {
+		if _, found := node.Labels[label]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeOS returns the operating system which the kubelet reports in the
+// node's labels, or "" if it doesn't.  Kubelets before 1.14 only set the
+// beta label.
+func nodeOS(node *apiv1.Node) string {
+	if value, found := node.Labels["kubernetes.io/os"]; found {
+		return value
+	}
+	return node.Labels["beta.kubernetes.io/os"]
+}
+
+// AverageNodeCores returns the average number of cores per node, rounded up.
+// The number of nodes is floored at minNodes, so that a transiently tiny
+// cluster does not make the whole cluster look like one huge node.
+func AverageNodeCores(cores, nodes, minNodes int) int {
+	if minNodes < 1 {
+		minNodes = 1
+	}
+	if nodes < minNodes {
+		nodes = minNodes
+	}
+	return (cores + nodes - 1) / nodes
+}
+
+// countMatchingPods counts the ready pods in the namespace which match the pod
+// selector and the pod annotations selector, whichever are set.  The pods are
+// read from the pod informer's cache.
+func (k *k8sClient) countMatchingPods(ctx context.Context) (int, error) {
+	pods, err := k.pods.list(ctx, k.target.Namespace, k.podSelector)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, pod := range pods {
+		if k.podAnnotationSelector != nil && !k.podAnnotationSelector.Matches(labels.Set(pod.Annotations)) {
+			continue
+		}
+		if isPodReady(pod) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func isPodReady(pod *apiv1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == apiv1.PodReady {
+			return cond.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
+
 func (k *k8sClient) UpdateResources(resources map[string]apiv1.ResourceRequirements) error {
-	ctrs := []interface{}{}
-	for ctrName, res := range resources {
-		ctrs = append(ctrs, map[string]interface{}{
-			"name":      ctrName,
-			"resources": res,
-		})
+	obj, err := k.target.Get(k.clientset)
+	if apierrors.IsNotFound(err) {
+		glog.V(2).Infof("%s %s/%s is gone, not updating it", k.target.Kind, k.target.Namespace, k.target.Name)
+		return ErrTargetGone
 	}
-	patch := map[string]interface{}{
-		"apiVersion": fmt.Sprintf("%s", k.target.GroupVersion),
-		"kind":       k.target.Kind,
-		"metadata": map[string]interface{}{
-			"name": k.target.Name,
-		},
-		"spec": map[string]interface{}{
-			"template": map[string]interface{}{
-				"spec": map[string]interface{}{
-					"containers": ctrs,
-				},
-			},
-		},
+	if err != nil {
+		return fmt.Errorf("can't get target: %v", err)
+	}
+	if obj.DeletionTimestamp != nil {
+		glog.V(2).Infof("%s %s/%s is terminating, not updating it", k.target.Kind, k.target.Namespace, k.target.Name)
+		return ErrTargetGone
+	}
+	resources = skipContainers(resources, obj.Spec.Template.Annotations[SkipContainersAnnotation])
+	if len(resources) == 0 {
+		glog.V(4).Infof("All containers are skipped, nothing to update")
+		return nil
+	}
+	resources = k.precision.Apply(resources)
+	if k.vpaRecommendation != "" {
+		return k.writeVPARecommendation(resources)
 	}
 
-	jb, err := json.Marshal(patch)
+	ctrs, err := k.target.containers(obj)
+	if err != nil {
+		return err
+	}
+	if ref := obj.Annotations[ArgoCDManagedByAnnotation]; k.argoCDAnnotationCheck && ref != "" {
+		current := map[string]apiv1.ResourceRequirements{}
+		for _, ctr := range ctrs {
+			current[ctr.Name] = ctr.Resources
+		}
+		return k.updateArgoCDApplication(ref, resources, current)
+	}
+	var pt types.PatchType
+	var jb []byte
+	switch k.target.strategy {
+	case jsonPatchByIndex:
+		pt, jb, err = jsonPatchContainers(ctrs, resources, k.target.containerPath)
+	default:
+		pt, jb, err = k.strategicMergeContainers(resources)
+	}
 	if err != nil {
 		return fmt.Errorf("can't marshal patch to JSON: %v", err)
 	}
+	if k.imageTagPins != nil {
+		jb, err = addPinnedImages(pt, jb, ctrs, k.imageTagPins.pinnedImages(ctrs, resources), k.target.containerPath)
+		if err != nil {
+			return fmt.Errorf("can't add the pinned images to the patch: %v", err)
+		}
+	}
+	k.mu.Lock()
+	env := k.containerEnv
+	k.mu.Unlock()
+	if env != nil {
+		jb, err = addContainerEnv(pt, jb, ctrs, envChanges(ctrs, resources, env), k.target.containerPath)
+		if err != nil {
+			return fmt.Errorf("can't add the environment variables to the patch: %v", err)
+		}
+	}
+	if k.rollout != nil && k.rollout.applies(k.target.Kind, obj) {
+		jb, err = k.rollout.addRolloutOverride(pt, jb, obj)
+		if err != nil {
+			return fmt.Errorf("can't add the rolling update parameters to the patch: %v", err)
+		}
+	}
+	if k.labelPropagation != nil {
+		jb, err = k.addTemplateLabels(pt, jb, obj)
+		if err != nil {
+			return fmt.Errorf("can't add the propagated labels to the patch: %v", err)
+		}
+	}
+	if k.updateLastApplied {
+		jb, err = k.addLastApplied(pt, jb, obj, resources)
+		if err != nil {
+			return fmt.Errorf("can't add the last-applied configuration to the patch: %v", err)
+		}
+	}
 
 	if k.dryRun {
 		glog.Infof("Performing dry-run, no updates will take affect.")
+		current := map[string]apiv1.ResourceRequirements{}
+		for _, ctr := range ctrs {
+			current[ctr.Name] = ctr.Resources
+		}
+		patch := &DryRunPatch{
+			Target:      fmt.Sprintf("%s %s/%s", k.target.Kind, k.target.Namespace, k.target.Name),
+			PatchType:   pt,
+			Data:        jb,
+			Current:     current,
+			Recommended: resources,
+		}
+		if err := k.dryRunFormatter.Format(k.dryRunOut, patch); err != nil {
+			return fmt.Errorf("can't print patch: %v", err)
+		}
+		if k.coordinateHPA {
+			k.coordinateHPAs(ctrs, resources)
+		}
 		return nil
 	}
-	if err := k.target.Patch(k.clientset, types.StrategicMergePatchType, jb); err != nil {
+	if err := k.patchTarget(pt, jb); err != nil {
+		// The target was deleted since it was read.
+		if apierrors.IsNotFound(err) {
+			glog.V(2).Infof("%s %s/%s is gone, not updating it", k.target.Kind, k.target.Namespace, k.target.Name)
+			return ErrTargetGone
+		}
 		return fmt.Errorf("patch failed: %v", err)
 	}
+	k.recordPatch(pt, jb)
+	if k.deleteOutdatedPods {
+		k.recordTemplateGeneration(obj)
+	}
+	if k.coordinateHPA {
+		k.coordinateHPAs(ctrs, resources)
+	}
+
+	return nil
+}
+
+// patchTarget applies a patch to the target, with server-side field
+// validation if it was asked for.
+func (k *k8sClient) patchTarget(pt types.PatchType, data []byte) error {
+	if k.serverSideValidation {
+		return k.target.PatchStrict(k.clientset, pt, data)
+	}
+	return k.target.Patch(k.clientset, pt, data)
+}
+
+// addLastApplied adds the target's last-applied configuration, with the
+// resources merged into it, to the patch.  A configuration which can't be
+// decoded is left alone, and the next kubectl apply reverts the resources.
+func (k *k8sClient) addLastApplied(pt types.PatchType, data []byte, obj *targetObject, resources map[string]apiv1.ResourceRequirements) ([]byte, error) {
+	merged, err := mergeLastApplied(obj.Annotations[LastAppliedAnnotation], k.target.containerPath, resources)
+	if err != nil {
+		glog.Warningf("Not updating the last-applied configuration of %s %s/%s: %v", k.target.Kind, k.target.Namespace, k.target.Name, err)
+		return data, nil
+	}
+	if merged == "" {
+		return data, nil
+	}
+	return addAnnotation(pt, data, obj.Annotations, LastAppliedAnnotation, merged)
+}
 
+// strategicMergeContainers builds a strategic merge patch which sets the
+// resources of each container by name.
+func (k *k8sClient) strategicMergeContainers(resources map[string]apiv1.ResourceRequirements) (types.PatchType, []byte, error) {
+	// In the order of their names, so that the same resources always give
+	// the same patch.
+	names := []string{}
+	for ctrName := range resources {
+		names = append(names, ctrName)
+	}
+	sort.Strings(names)
+	ctrs := []interface{}{}
+	for _, ctrName := range names {
+		ctrs = append(ctrs, map[string]interface{}{
+			"name":      ctrName,
+			"resources": resources[ctrName],
+		})
+	}
+	patch := k.target.containerPath.nest(ctrs)
+	patch["apiVersion"] = fmt.Sprintf("%s", k.target.GroupVersion)
+	patch["kind"] = k.target.Kind
+	patch["metadata"] = map[string]interface{}{
+		"name": k.target.Name,
+	}
+	jb, err := json.Marshal(patch)
+	return types.StrategicMergePatchType, jb, err
+}
+
+// skipContainers returns a copy of resources without the containers named in
+// the comma-separated skipList.
+func skipContainers(resources map[string]apiv1.ResourceRequirements, skipList string) map[string]apiv1.ResourceRequirements {
+	if skipList == "" {
+		return resources
+	}
+	skip := map[string]bool{}
+	for _, name := range strings.Split(skipList, ",") {
+		skip[strings.TrimSpace(name)] = true
+	}
+	out := map[string]apiv1.ResourceRequirements{}
+	for ctrName, res := range resources {
+		if skip[ctrName] {
+			glog.V(0).Infof("Skipping container %q, per the %s annotation", ctrName, SkipContainersAnnotation)
+			continue
+		}
+		out[ctrName] = res
+	}
+	return out
+}
+
+func (k *k8sClient) GetCurrentResources() (map[string]apiv1.ResourceRequirements, error) {
+	obj, err := k.target.Get(k.clientset)
+	if err != nil {
+		return nil, fmt.Errorf("can't get target: %v", err)
+	}
+	ctrs, err := k.target.containers(obj)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]apiv1.ResourceRequirements{}
+	for _, ctr := range ctrs {
+		current[ctr.Name] = ctr.Resources
+	}
+	return current, nil
+}
+
+// podMetricsList holds the parts of a metrics.k8s.io PodMetricsList that we
+// read.
+type podMetricsList struct {
+	Items []struct {
+		Containers []struct {
+			Name  string             `json:"name"`
+			Usage apiv1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+func (k *k8sClient) GetContainerUsage(ctx context.Context) (map[string]apiv1.ResourceList, error) {
+	obj, err := k.target.Get(k.clientset)
+	if err != nil {
+		return nil, fmt.Errorf("can't get target: %v", err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target selector: %v", err)
+	}
+
+	data, err := k.clientset.Discovery().RESTClient().Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", k.target.Namespace, "pods").
+		Param("labelSelector", selector.String()).
+		SetHeader("Accept", "application/json").
+		Context(ctx).
+		DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("can't get pod metrics: %v", err)
+	}
+	metrics := &podMetricsList{}
+	if err := json.Unmarshal(data, metrics); err != nil {
+		return nil, fmt.Errorf("can't decode pod metrics: %v", err)
+	}
+
+	// Sum per container, then average over the pods that had it.
+	sums := map[string]apiv1.ResourceList{}
+	counts := map[string]int64{}
+	for _, pod := range metrics.Items {
+		for _, ctr := range pod.Containers {
+			if sums[ctr.Name] == nil {
+				sums[ctr.Name] = apiv1.ResourceList{}
+			}
+			for res, q := range ctr.Usage {
+				sum := sums[ctr.Name][res]
+				sum.Add(q)
+				sums[ctr.Name][res] = sum
+			}
+			counts[ctr.Name]++
+		}
+	}
+	usage := map[string]apiv1.ResourceList{}
+	for ctr, sum := range sums {
+		usage[ctr] = apiv1.ResourceList{}
+		for res, q := range sum {
+			usage[ctr][res] = *resource.NewMilliQuantity(q.MilliValue()/counts[ctr], q.Format)
+		}
+	}
+	return usage, nil
+}
+
+// hpaRescaleReason is the reason of the events that the HPA controller emits
+// when it changes the number of replicas.
+const hpaRescaleReason = "SuccessfulRescale"
+
+func (k *k8sClient) WatchHPAEvents(ctx context.Context, handler func()) error {
+	opt := metav1.ListOptions{
+		FieldSelector: fields.SelectorFromSet(fields.Set{
+			"reason":              hpaRescaleReason,
+			"involvedObject.kind": "HorizontalPodAutoscaler",
+		}).String(),
+	}
+	events := k.clientset.CoreV1().Events(k.namespace)
+
+	// Start from the current state, so old events don't trigger anything.
+	list, err := events.List(opt)
+	if err != nil {
+		return fmt.Errorf("can't list events: %v", err)
+	}
+	opt.ResourceVersion = list.ResourceVersion
+
+	for {
+		w, err := events.Watch(opt)
+		if err != nil {
+			return fmt.Errorf("can't watch events: %v", err)
+		}
+		rv, err := k.handleHPAEvents(ctx, w, handler)
+		w.Stop()
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The watch timed out, resume where it left off.
+		if rv != "" {
+			opt.ResourceVersion = rv
+		}
+	}
+}
+
+// handleHPAEvents calls handler for each new event from w of an HPA which
+// scales the target, until w is closed or ctx is cancelled.  It returns the
+// last resource version seen.
+func (k *k8sClient) handleHPAEvents(ctx context.Context, w watch.Interface, handler func()) (string, error) {
+	rv := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return rv, nil
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return rv, nil
+			}
+			switch ev.Type {
+			case watch.Added, watch.Modified:
+				event, ok := ev.Object.(*apiv1.Event)
+				if !ok {
+					continue
+				}
+				rv = event.ResourceVersion
+				if !k.hpaScalesTarget(event.InvolvedObject) {
+					continue
+				}
+				glog.V(2).Infof("HPA event for %s/%s: %s", event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Message)
+				handler()
+			case watch.Error:
+				return rv, fmt.Errorf("error watching events: %v", apierrors.FromObject(ev.Object))
+			}
+		}
+	}
+}
+
+// hpaScalesTarget returns whether obj is an HPA whose scaleTargetRef is the
+// target.  An HPA which can't be read, e.g. because it was deleted since, is
+// taken not to.
+func (k *k8sClient) hpaScalesTarget(obj apiv1.ObjectReference) bool {
+	if obj.Kind != "HorizontalPodAutoscaler" {
+		return false
+	}
+	k.mu.Lock()
+	tgt := k.target
+	k.mu.Unlock()
+	if tgt == nil {
+		return false
+	}
+	hpa, err := k.clientset.AutoscalingV1().HorizontalPodAutoscalers(obj.Namespace).Get(obj.Name, metav1.GetOptions{})
+	if err != nil {
+		glog.V(2).Infof("Ignoring event of HorizontalPodAutoscaler %s/%s: %v", obj.Namespace, obj.Name, err)
+		return false
+	}
+	ref := hpa.Spec.ScaleTargetRef
+	return hpa.Namespace == tgt.Namespace && strings.EqualFold(ref.Kind, tgt.Kind) && ref.Name == tgt.Name
+}
+
+func (k *k8sClient) SetTarget(target string, path ContainerPath) error {
+	tgt, err := makeTarget(context.Background(), k.clientset, target, k.namespace, path)
+	if err != nil {
+		return err
+	}
+	obj, err := tgt.Get(k.clientset)
+	if err != nil {
+		return fmt.Errorf("can't get new target %s: %v", target, err)
+	}
+	// Check the path before patching, as a wrong one could add a
+	// containers array where none belongs.
+	if _, err := tgt.containers(obj); err != nil {
+		return fmt.Errorf("new target %s: %v", target, err)
+	}
+	k.mu.Lock()
+	k.target = tgt
+	k.containerPath = path
+	// The new target's pods are only rolled after it was updated.
+	k.patchedGeneration = ""
+	if k.pendingPods != nil {
+		k.pendingPods.target = tgt
+	}
+	k.mu.Unlock()
+	glog.V(0).Infof("Switched target to %s %s/%s", tgt.Kind, tgt.Namespace, tgt.Name)
+	return nil
+}
+
+// eventSource is the component that our events are attributed to.
+const eventSource = "cluster-proportional-vertical-autoscaler"
+
+func (k *k8sClient) RecordPodEvent(namespace, name, reason, message string) error {
+	// The UID is needed for the event to show up in "kubectl describe".
+	pod, err := k.clientset.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("can't get pod %s/%s: %v", namespace, name, err)
+	}
+	now := metav1.Now()
+	event := &apiv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: name + ".",
+			Namespace:    namespace,
+		},
+		InvolvedObject: apiv1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "Pod",
+			Namespace:       namespace,
+			Name:            name,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           apiv1.EventTypeNormal,
+		Source:         apiv1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := k.clientset.CoreV1().Events(namespace).Create(event); err != nil {
+		return fmt.Errorf("can't create event: %v", err)
+	}
 	return nil
 }
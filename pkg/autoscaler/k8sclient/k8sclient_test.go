@@ -17,15 +17,28 @@ limitations under the License.
 package k8sclient
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	clientset "k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 )
@@ -87,7 +100,7 @@ func TestDiscoverAPI(t *testing.T) {
 	defer server.Close()
 
 	for _, tc := range testCases {
-		_, _, err := discoverAPI(
+		_, _, err := discoverAPI(context.Background(),
 			clientset.NewForConfigOrDie(&restclient.Config{
 				Host: server.URL,
 				ContentConfig: restclient.ContentConfig{
@@ -104,6 +117,62 @@ func TestDiscoverAPI(t *testing.T) {
 	}
 }
 
+func TestNewK8sClientCanceledDuringDiscovery(t *testing.T) {
+	// An apiserver which doesn't answer discovery until the test is over.
+	reached := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case reached <- struct{}{}:
+		default:
+		}
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	dir, err := ioutil.TempDir("", "cpva-kubeconfig")
+	if err != nil {
+		t.Fatalf("can't create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := ioutil.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: slow
+  cluster:
+    server: `+server.URL+`
+contexts:
+- name: slow
+  context:
+    cluster: slow
+current-context: slow
+`), 0600); err != nil {
+		t.Fatalf("can't write kubeconfig: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-reached
+		cancel()
+	}()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := NewK8sClient(ctx, "default", "deployment/foo", kubeconfig, Options{})
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if err == nil || !strings.Contains(err.Error(), "startup canceled") {
+			t.Errorf("expected a startup canceled error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("NewK8sClient didn't return after its context was cancelled")
+	}
+}
+
 func TestUpdateResources(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		var obj interface{}
@@ -175,7 +244,7 @@ func TestUpdateResources(t *testing.T) {
 			ContentConfig: restclient.ContentConfig{
 				GroupVersion: &schema.GroupVersion{Group: tc.kind, Version: "extensions/v1beta1"}}})
 
-		target, err := makeTarget(client, tc.target, "default")
+		target, err := makeTarget(context.Background(), client, tc.target, "default", nil)
 		if err != nil {
 			t.Fatalf("error making target %q: %v", tc.target, err)
 		}
@@ -197,3 +266,1115 @@ func TestUpdateResources(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdateResourcesTerminatingTarget(t *testing.T) {
+	deleted := metav1.Now()
+	testCases := []struct {
+		name      string
+		target    *appsv1.Deployment
+		getCode   int
+		patchCode int
+		expPatch  bool
+		expGone   bool
+		expError  bool
+	}{
+		{"live", &appsv1.Deployment{}, http.StatusOK, http.StatusOK, true, false, false},
+		{"terminating", &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deleted}}, http.StatusOK, http.StatusOK, false, true, false},
+		{"gone before the read", nil, http.StatusNotFound, http.StatusOK, false, true, false},
+		{"gone before the patch", &appsv1.Deployment{}, http.StatusOK, http.StatusNotFound, true, true, false},
+		{"read fails", nil, http.StatusInternalServerError, http.StatusOK, false, false, true},
+		{"patch fails", &appsv1.Deployment{}, http.StatusOK, http.StatusInternalServerError, true, false, true},
+	}
+	for _, tc := range testCases {
+		patched := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var obj interface{}
+			code := http.StatusOK
+			switch req.URL.Path {
+			case "/api":
+				obj = &metav1.APIVersions{}
+			case "/apis":
+				obj = &metav1.APIGroupList{Groups: []metav1.APIGroup{{
+					Name:     "apps",
+					Versions: []metav1.GroupVersionForDiscovery{{GroupVersion: "apps/v1", Version: "v1"}},
+				}}}
+			case "/apis/apps/v1":
+				obj = &metav1.APIResourceList{
+					GroupVersion: "apps/v1",
+					APIResources: []metav1.APIResource{{Name: "deployments", Namespaced: true, Kind: "Deployment"}},
+				}
+			case "/apis/apps/v1/namespaces/default/deployments/thing":
+				if req.Method == "PATCH" {
+					patched = true
+					obj, code = &appsv1.Deployment{}, tc.patchCode
+				} else {
+					obj, code = tc.target, tc.getCode
+				}
+			default:
+				code = http.StatusNotFound
+			}
+			if code != http.StatusOK {
+				w.WriteHeader(code)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(obj)
+		}))
+
+		client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+		target, err := makeTarget(context.Background(), client, "deployment/thing", "default", nil)
+		if err != nil {
+			t.Fatalf("%s: error making target: %v", tc.name, err)
+		}
+		k8scli := &k8sClient{clientset: client, target: target}
+		err = k8scli.UpdateResources(map[string]apiv1.ResourceRequirements{
+			"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")}},
+		})
+		server.Close()
+		if gone := err == ErrTargetGone; gone != tc.expGone {
+			t.Errorf("%s: expected the target to be gone: %v, got %v", tc.name, tc.expGone, err)
+		}
+		if tc.expError && (err == nil || err == ErrTargetGone) {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.expError && err != nil && err != ErrTargetGone {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if patched != tc.expPatch {
+			t.Errorf("%s: expected patched to be %v, got %v", tc.name, tc.expPatch, patched)
+		}
+		if recorded := k8scli.TakeSnapshot().LastPatch != nil; recorded != (tc.expPatch && !tc.expError && tc.patchCode == http.StatusOK) {
+			t.Errorf("%s: expected the patch to be recorded: %v, got %v", tc.name, !recorded, recorded)
+		}
+	}
+}
+
+// newNodeServer returns a server which lists the given nodes.
+func newNodeServer(t *testing.T, nodes []apiv1.Node) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/nodes" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		output, err := json.Marshal(&apiv1.NodeList{Items: nodes})
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(output)
+	}))
+}
+
+func nodeWithCPU(cpu string) apiv1.Node {
+	return apiv1.Node{Status: apiv1.NodeStatus{Capacity: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu)}}}
+}
+
+func TestGetClusterSizeWithContext(t *testing.T) {
+	server := newNodeServer(t, []apiv1.Node{nodeWithCPU("2"), nodeWithCPU("4")})
+	defer server.Close()
+
+	k8scli := &k8sClient{
+		clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+	}
+
+	sz, err := k8scli.GetClusterSizeWithContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sz.Nodes != 2 || sz.Cores != 6 {
+		t.Errorf("expected 2 nodes and 6 cores, got %d nodes and %d cores", sz.Nodes, sz.Cores)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := k8scli.GetClusterSizeWithContext(ctx); err == nil {
+		t.Errorf("expected error for cancelled context, got none")
+	}
+}
+
+func TestSkipContainers(t *testing.T) {
+	resources := map[string]apiv1.ResourceRequirements{
+		"app":         {},
+		"istio-proxy": {},
+		"logger":      {},
+	}
+	testCases := []struct {
+		skipList string
+		expCtrs  []string
+	}{
+		{"", []string{"app", "istio-proxy", "logger"}},
+		{"istio-proxy", []string{"app", "logger"}},
+		{"istio-proxy, logger", []string{"app"}},
+		{"app,istio-proxy,logger", []string{}},
+		{"not-there", []string{"app", "istio-proxy", "logger"}},
+	}
+
+	for _, tc := range testCases {
+		out := skipContainers(resources, tc.skipList)
+		if len(out) != len(tc.expCtrs) {
+			t.Errorf("skip list %q: expected %v, got %v", tc.skipList, tc.expCtrs, out)
+			continue
+		}
+		for _, ctr := range tc.expCtrs {
+			if _, found := out[ctr]; !found {
+				t.Errorf("skip list %q: expected container %q, got %v", tc.skipList, ctr, out)
+			}
+		}
+	}
+	if len(resources) != 3 {
+		t.Errorf("input was modified: %v", resources)
+	}
+}
+
+func TestHandleHPAEvents(t *testing.T) {
+	hpas := map[string]string{
+		"web":   "Deployment/web",
+		"other": "Deployment/other",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, "/apis/autoscaling/v1/namespaces/default/horizontalpodautoscalers/")
+		ref, found := hpas[name]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		kindName := strings.SplitN(ref, "/", 2)
+		hpa := &autoscalingv1.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{Kind: kindName[0], Name: kindName[1]},
+			},
+		}
+		output, err := json.Marshal(hpa)
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+	defer server.Close()
+
+	event := func(rv, kind, name string) *apiv1.Event {
+		return &apiv1.Event{
+			ObjectMeta:     metav1.ObjectMeta{ResourceVersion: rv},
+			InvolvedObject: apiv1.ObjectReference{Kind: kind, Namespace: "default", Name: name},
+			Reason:         hpaRescaleReason,
+		}
+	}
+	w := watch.NewFakeWithChanSize(6, false)
+	w.Add(event("1", "HorizontalPodAutoscaler", "web"))
+	w.Modify(event("2", "HorizontalPodAutoscaler", "web"))
+	w.Add(event("3", "HorizontalPodAutoscaler", "other"))
+	w.Add(event("4", "HorizontalPodAutoscaler", "deleted"))
+	w.Add(event("5", "Deployment", "web"))
+	w.Delete(event("6", "HorizontalPodAutoscaler", "web"))
+	w.Stop()
+
+	calls := 0
+	k8scli := &k8sClient{
+		clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+		target:    &targetSpec{Kind: "deployment", Namespace: "default", Name: "web"},
+	}
+	rv, err := k8scli.handleHPAEvents(context.Background(), w, func() { calls++ })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+	if rv != "5" {
+		t.Errorf("expected resource version 5, got %q", rv)
+	}
+}
+
+func TestCountPending(t *testing.T) {
+	now := metav1.Now()
+	pods := []apiv1.Pod{
+		{Status: apiv1.PodStatus{Phase: apiv1.PodPending}},
+		{Status: apiv1.PodStatus{Phase: apiv1.PodRunning}},
+		{Status: apiv1.PodStatus{Phase: apiv1.PodPending}},
+		{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}, Status: apiv1.PodStatus{Phase: apiv1.PodPending}},
+		{Status: apiv1.PodStatus{Phase: apiv1.PodSucceeded}},
+	}
+	if n := countPending(pods); n != 2 {
+		t.Errorf("expected 2 pending pods, got %d", n)
+	}
+}
+
+func TestAverageNodeCores(t *testing.T) {
+	testCases := []struct {
+		cores    int
+		nodes    int
+		minNodes int
+		expAvg   int
+	}{
+		{64, 16, 1, 4},
+		{65, 16, 1, 5},
+		{64, 1, 1, 64},
+		{64, 0, 1, 64},
+		{0, 0, 1, 0},
+		{64, 1, 4, 16},
+		{64, 3, 4, 16},
+		{64, 4, 4, 16},
+		{64, 5, 4, 13},
+		{64, 0, 0, 64},
+	}
+	for _, tc := range testCases {
+		if avg := AverageNodeCores(tc.cores, tc.nodes, tc.minNodes); avg != tc.expAvg {
+			t.Errorf("cores %d, nodes %d, min nodes %d: expected %d, got %d", tc.cores, tc.nodes, tc.minNodes, tc.expAvg, avg)
+		}
+	}
+}
+
+func TestGetClusterSizeSkipZeroCPUNodes(t *testing.T) {
+	server := newNodeServer(t, []apiv1.Node{nodeWithCPU("2"), nodeWithCPU("0"), nodeWithCPU("4"), {}})
+	defer server.Close()
+
+	testCases := []struct {
+		skip     bool
+		expNodes int
+		expCores int
+	}{
+		{false, 4, 6},
+		{true, 2, 6},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset:        clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			skipZeroCPUNodes: tc.skip,
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sz.Nodes != tc.expNodes || sz.Cores != tc.expCores {
+			t.Errorf("skip %v: expected %d nodes and %d cores, got %d nodes and %d cores",
+				tc.skip, tc.expNodes, tc.expCores, sz.Nodes, sz.Cores)
+		}
+		if sz.ListedNodes != 4 {
+			t.Errorf("skip %v: expected 4 listed nodes, got %d", tc.skip, sz.ListedNodes)
+		}
+	}
+}
+
+func TestGetClusterSizeMemory(t *testing.T) {
+	withMemory := func(cpu, mem string) apiv1.Node {
+		node := nodeWithCPU(cpu)
+		node.Status.Capacity[apiv1.ResourceMemory] = resource.MustParse(mem)
+		return node
+	}
+	server := newNodeServer(t, []apiv1.Node{withMemory("2", "8Gi"), withMemory("0", "4Gi"), withMemory("4", "16Gi")})
+	defer server.Close()
+
+	testCases := []struct {
+		skip      bool
+		expMemory string
+	}{
+		{false, "28Gi"},
+		{true, "24Gi"},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset:        clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			skipZeroCPUNodes: tc.skip,
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if exp := resource.MustParse(tc.expMemory); sz.Memory.Cmp(exp) != 0 {
+			t.Errorf("skip %v: expected %s of memory, got %s", tc.skip, tc.expMemory, sz.Memory.String())
+		}
+	}
+}
+
+func TestNodeCores(t *testing.T) {
+	withAnnotation := func(cpu, value string) apiv1.Node {
+		node := nodeWithCPU(cpu)
+		node.Annotations = map[string]string{"example.com/real-cores": value}
+		return node
+	}
+
+	testCases := []struct {
+		name       string
+		node       apiv1.Node
+		annotation string
+		expCores   string
+		expFound   bool
+	}{
+		{"no annotation configured", withAnnotation("4", "32"), "", "4", false},
+		{"not annotated", nodeWithCPU("4"), "example.com/real-cores", "4", false},
+		{"integer", withAnnotation("4", "32"), "example.com/real-cores", "32", true},
+		{"millicores", withAnnotation("4", "1500m"), "example.com/real-cores", "4", false},
+		{"whitespace", withAnnotation("4", " 16 "), "example.com/real-cores", "16", true},
+		{"zero", withAnnotation("4", "0"), "example.com/real-cores", "0", true},
+		{"unparseable", withAnnotation("4", "lots"), "example.com/real-cores", "4", false},
+		{"empty", withAnnotation("4", ""), "example.com/real-cores", "4", false},
+		{"negative", withAnnotation("4", "-8"), "example.com/real-cores", "4", false},
+		{"other annotation", withAnnotation("4", "32"), "example.com/cores", "4", false},
+	}
+	for _, tc := range testCases {
+		cores, found := nodeCores(&tc.node, tc.annotation)
+		if exp := resource.MustParse(tc.expCores); cores.Cmp(exp) != 0 || found != tc.expFound {
+			t.Errorf("%s: expected %s cores and %v, got %s and %v", tc.name, tc.expCores, tc.expFound, cores.String(), found)
+		}
+	}
+}
+
+func TestGetClusterSizeNodeCoresAnnotation(t *testing.T) {
+	withAnnotation := func(cpu, value string) apiv1.Node {
+		node := nodeWithCPU(cpu)
+		node.Annotations = map[string]string{"example.com/real-cores": value}
+		return node
+	}
+	server := newNodeServer(t, []apiv1.Node{withAnnotation("1", "32"), withAnnotation("0", "16"), withAnnotation("4", "bogus"), nodeWithCPU("8")})
+	defer server.Close()
+
+	testCases := []struct {
+		annotation string
+		skip       bool
+		expNodes   int
+		expCores   int
+	}{
+		{"", false, 4, 13},
+		{"", true, 3, 13},
+		{"example.com/real-cores", false, 4, 60},
+		{"example.com/real-cores", true, 4, 60},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset:           clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			nodeCoresAnnotation: tc.annotation,
+			skipZeroCPUNodes:    tc.skip,
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sz.Nodes != tc.expNodes || sz.Cores != tc.expCores {
+			t.Errorf("annotation %q, skip %v: expected %d nodes and %d cores, got %d nodes and %d cores",
+				tc.annotation, tc.skip, tc.expNodes, tc.expCores, sz.Nodes, sz.Cores)
+		}
+	}
+}
+
+func TestGetClusterSizeMemoryWeightedNodes(t *testing.T) {
+	withMemory := func(cpu, mem string) apiv1.Node {
+		node := nodeWithCPU(cpu)
+		node.Status.Capacity[apiv1.ResourceMemory] = resource.MustParse(mem)
+		return node
+	}
+
+	testCases := []struct {
+		name     string
+		nodes    []apiv1.Node
+		base     string
+		expNodes int
+	}{
+		{"uniform", []apiv1.Node{withMemory("4", "16Gi"), withMemory("4", "16Gi")}, "16Gi", 2},
+		{"one big node", []apiv1.Node{withMemory("4", "16Gi"), withMemory("64", "512Gi")}, "16Gi", 33},
+		{"rounded", []apiv1.Node{withMemory("2", "8Gi"), withMemory("2", "8Gi"), withMemory("2", "8Gi")}, "16Gi", 2},
+		{"small nodes", []apiv1.Node{withMemory("1", "2Gi")}, "16Gi", 1},
+		{"no nodes", nil, "16Gi", 0},
+	}
+	for _, tc := range testCases {
+		server := newNodeServer(t, tc.nodes)
+		base := resource.MustParse(tc.base)
+		k8scli := &k8sClient{
+			clientset:      clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			baseNodeMemory: &base,
+		}
+		sz, err := k8scli.GetClusterSize()
+		server.Close()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if sz.Nodes != tc.expNodes {
+			t.Errorf("%s: expected %d nodes, got %d", tc.name, tc.expNodes, sz.Nodes)
+		}
+		if sz.ListedNodes != len(tc.nodes) {
+			t.Errorf("%s: expected %d listed nodes, got %d", tc.name, len(tc.nodes), sz.ListedNodes)
+		}
+	}
+}
+
+func TestGetClusterSizeNodeOS(t *testing.T) {
+	withOS := func(node apiv1.Node, label, os string) apiv1.Node {
+		node.Labels = map[string]string{label: os}
+		return node
+	}
+	server := newNodeServer(t, []apiv1.Node{
+		withOS(nodeWithCPU("2"), "kubernetes.io/os", "linux"),
+		withOS(nodeWithCPU("4"), "kubernetes.io/os", "linux"),
+		withOS(nodeWithCPU("8"), "kubernetes.io/os", "windows"),
+		withOS(nodeWithCPU("16"), "beta.kubernetes.io/os", "linux"),
+		withOS(nodeWithCPU("0"), "kubernetes.io/os", "linux"),
+		nodeWithCPU("32"),
+	})
+	defer server.Close()
+
+	testCases := []struct {
+		os       string
+		skip     bool
+		expNodes int
+		expCores int
+	}{
+		{"", false, 6, 62},
+		{"linux", false, 4, 22},
+		{"linux", true, 3, 22},
+		{"windows", false, 1, 8},
+		{"darwin", false, 0, 0},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset:        clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			nodeOS:           tc.os,
+			skipZeroCPUNodes: tc.skip,
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sz.Nodes != tc.expNodes || sz.Cores != tc.expCores {
+			t.Errorf("os %q, skip %v: expected %d nodes and %d cores, got %d nodes and %d cores",
+				tc.os, tc.skip, tc.expNodes, tc.expCores, sz.Nodes, sz.Cores)
+		}
+		if sz.ListedNodes != 6 {
+			t.Errorf("os %q: expected 6 listed nodes, got %d", tc.os, sz.ListedNodes)
+		}
+	}
+}
+
+func TestCountMatchingPodsByAnnotations(t *testing.T) {
+	readyPod := func(app string, annotations map[string]string, ready bool) apiv1.Pod {
+		status := apiv1.ConditionFalse
+		if ready {
+			status = apiv1.ConditionTrue
+		}
+		return apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Labels: map[string]string{"app": app}, Annotations: annotations},
+			Status:     apiv1.PodStatus{Conditions: []apiv1.PodCondition{{Type: apiv1.PodReady, Status: status}}},
+		}
+	}
+	pods := []apiv1.Pod{
+		readyPod("web", map[string]string{"example.com/session": "heavy"}, true),
+		readyPod("web", map[string]string{"example.com/session": "heavy"}, true),
+		readyPod("web", map[string]string{"example.com/session": "heavy"}, false),
+		readyPod("web", map[string]string{"example.com/session": "light"}, true),
+		readyPod("web", nil, true),
+		readyPod("db", map[string]string{"example.com/session": "heavy"}, true),
+	}
+	for i := range pods {
+		pods[i].Name = fmt.Sprintf("pod-%d", i)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/namespaces/default/pods" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.URL.Query().Get("watch") == "true" {
+			holdWatch(w, req)
+			return
+		}
+		output, err := json.Marshal(&apiv1.PodList{Items: pods})
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cs := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+	informer := newPodInformer(ctx, cs, "default")
+
+	testCases := []struct {
+		labels      string
+		annotations string
+		expCount    int
+	}{
+		{"", "example.com/session=heavy", 3},
+		{"", "example.com/session", 4},
+		{"", "example.com/session!=heavy", 2},
+		{"app=web", "example.com/session=heavy", 2},
+		{"app=web", "example.com/session in (heavy,light)", 3},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset: cs,
+			target:    &targetSpec{Namespace: "default"},
+			pods:      informer,
+		}
+		if tc.labels != "" {
+			k8scli.podSelector = labels.SelectorFromSet(labels.Set{"app": "web"})
+		}
+		k8scli.podAnnotationSelector, _ = labels.Parse(tc.annotations)
+		count, err := k8scli.countMatchingPods(context.Background())
+		if err != nil {
+			t.Fatalf("%q %q: unexpected error: %v", tc.labels, tc.annotations, err)
+		}
+		if count != tc.expCount {
+			t.Errorf("%q %q: expected %d pods, got %d", tc.labels, tc.annotations, tc.expCount, count)
+		}
+	}
+}
+
+func TestGetClusterSizeAdditionalClusters(t *testing.T) {
+	local := newNodeServer(t, []apiv1.Node{nodeWithCPU("2")})
+	defer local.Close()
+	other := newNodeServer(t, []apiv1.Node{nodeWithCPU("4"), nodeWithCPU("4")})
+	defer other.Close()
+	down := newNodeServer(t, nil)
+	down.Close()
+
+	clusterAt := func(server *httptest.Server) *clusterSource {
+		return &clusterSource{name: server.URL, clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})}
+	}
+	testCases := []struct {
+		name     string
+		clusters []*clusterSource
+		partial  bool
+		expNodes int
+		expCores int
+		expError bool
+	}{
+		{"local only", nil, false, 1, 2, false},
+		{"summed", []*clusterSource{clusterAt(other)}, false, 3, 10, false},
+		{"unreachable fails", []*clusterSource{clusterAt(other), clusterAt(down)}, false, 0, 0, true},
+		{"unreachable left out", []*clusterSource{clusterAt(other), clusterAt(down)}, true, 3, 10, false},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset:           clientset.NewForConfigOrDie(&restclient.Config{Host: local.URL}),
+			additionalClusters:  tc.clusters,
+			partialClusterSizes: tc.partial,
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%s: expected an error", tc.name)
+			continue
+		}
+		if sz.Nodes != tc.expNodes || sz.Cores != tc.expCores {
+			t.Errorf("%s: expected %d nodes and %d cores, got %d nodes and %d cores",
+				tc.name, tc.expNodes, tc.expCores, sz.Nodes, sz.Cores)
+		}
+	}
+}
+
+func TestParseClusterSource(t *testing.T) {
+	testCases := []struct {
+		entry         string
+		expKubeconfig string
+		expContext    string
+		expError      bool
+	}{
+		{"/etc/fleet/kubeconfig", "/etc/fleet/kubeconfig", "", false},
+		{"/etc/fleet/kubeconfig#eu-west", "/etc/fleet/kubeconfig", "eu-west", false},
+		{"/etc/fleet/kubeconfig#arn:aws:eks:us-east-1:1234:cluster/fleet", "/etc/fleet/kubeconfig", "arn:aws:eks:us-east-1:1234:cluster/fleet", false},
+		{"/etc/fleet/kubeconfig#", "", "", true},
+		{"#eu-west", "", "", true},
+	}
+	for _, tc := range testCases {
+		kubeconfig, context, err := ParseClusterSource(tc.entry)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%q: unexpected error: %v", tc.entry, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%q: expected an error", tc.entry)
+			continue
+		}
+		if kubeconfig != tc.expKubeconfig || context != tc.expContext {
+			t.Errorf("%q: expected %q and %q, got %q and %q", tc.entry, tc.expKubeconfig, tc.expContext, kubeconfig, context)
+		}
+	}
+}
+
+func TestSetContentType(t *testing.T) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		accept = req.Header.Get("Accept")
+		output, err := json.Marshal(&apiv1.NodeList{})
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		contentType string
+		expAccept   string
+		expError    bool
+	}{
+		{"", "application/vnd.kubernetes.protobuf", false},
+		{"protobuf", "application/vnd.kubernetes.protobuf", false},
+		{"json", "application/json", false},
+		{"yaml", "", true},
+	}
+	for _, tc := range testCases {
+		config := &restclient.Config{Host: server.URL}
+		if err := setContentType(config, tc.contentType); err != nil {
+			if !tc.expError {
+				t.Errorf("%q: unexpected error: %v", tc.contentType, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%q: expected an error", tc.contentType)
+			continue
+		}
+		accept = ""
+		if _, err := listNodes(context.Background(), clientset.NewForConfigOrDie(config)); err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.contentType, err)
+		}
+		if !strings.HasPrefix(accept, tc.expAccept) {
+			t.Errorf("%q: expected Accept %q, got %q", tc.contentType, tc.expAccept, accept)
+		}
+	}
+}
+
+func TestSetImpersonation(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header = req.Header
+		output, err := json.Marshal(&apiv1.NodeList{})
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		user      string
+		groups    []string
+		expUser   string
+		expGroups []string
+	}{
+		{"", nil, "", nil},
+		{"", []string{"tenant-a"}, "", nil},
+		{"system:serviceaccount:tenant-a:cpvpa", nil, "system:serviceaccount:tenant-a:cpvpa", nil},
+		{"alice", []string{"tenant-a", "tenant-b"}, "alice", []string{"tenant-a", "tenant-b"}},
+	}
+	for _, tc := range testCases {
+		config := &restclient.Config{Host: server.URL}
+		setImpersonation(config, tc.user, tc.groups)
+		header = nil
+		if _, err := listNodes(context.Background(), clientset.NewForConfigOrDie(config)); err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.user, err)
+		}
+		if got := header.Get("Impersonate-User"); got != tc.expUser {
+			t.Errorf("%q: expected Impersonate-User %q, got %q", tc.user, tc.expUser, got)
+		}
+		if got := header["Impersonate-Group"]; !reflect.DeepEqual(got, tc.expGroups) {
+			t.Errorf("%q: expected Impersonate-Group %v, got %v", tc.user, tc.expGroups, got)
+		}
+	}
+}
+
+func TestGetClusterSizeNodeBounds(t *testing.T) {
+	server := newNodeServer(t, []apiv1.Node{nodeWithCPU("2"), nodeWithCPU("2"), nodeWithCPU("2")})
+	defer server.Close()
+
+	testCases := []struct {
+		minNodes int
+		maxNodes int
+		expError bool
+	}{
+		{0, 0, false},
+		{3, 3, false},
+		{1, 10, false},
+		{4, 0, true},
+		{0, 2, true},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			minNodes:  tc.minNodes,
+			maxNodes:  tc.maxNodes,
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("bounds [%d, %d]: unexpected error: %v", tc.minNodes, tc.maxNodes, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("bounds [%d, %d]: expected an error, got %d nodes", tc.minNodes, tc.maxNodes, sz.Nodes)
+		}
+	}
+}
+
+func TestSetTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var obj interface{}
+		switch req.URL.Path {
+		case "/api":
+			obj = &metav1.APIVersions{Versions: []string{"extensions/v1beta1"}}
+		case "/apis/extensions/v1beta1":
+			obj = &metav1.APIResourceList{
+				GroupVersion: "extensions/v1beta1",
+				APIResources: []metav1.APIResource{
+					{Name: "deployments", Namespaced: true, Kind: "Deployment"},
+					{Name: "daemonsets", Namespaced: true, Kind: "DaemonSet"},
+				},
+			}
+		case "/apis/extensions/v1beta1/namespaces/default/deployments/thing",
+			"/apis/extensions/v1beta1/namespaces/default/daemonsets/other":
+			obj = &targetObject{}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		output, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(output)
+	}))
+	defer server.Close()
+
+	client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+	target, err := makeTarget(context.Background(), client, "deployment/thing", "default", nil)
+	if err != nil {
+		t.Fatalf("error making target: %v", err)
+	}
+	k8scli := &k8sClient{
+		namespace:   "default",
+		clientset:   client,
+		target:      target,
+		pendingPods: &PendingPodsProvider{clientset: client, target: target},
+	}
+
+	for _, bad := range []string{"deployment/missing", "replicationcontroller/thing", "thing"} {
+		if err := k8scli.SetTarget(bad, nil); err == nil {
+			t.Errorf("expected an error switching to %q", bad)
+		}
+		if k8scli.target != target {
+			t.Errorf("target changed after failing to switch to %q", bad)
+		}
+	}
+
+	missing, err := ParseContainerPath(".spec.worker.template.spec.containers")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := k8scli.SetTarget("daemonset/other", missing); err == nil {
+		t.Errorf("expected an error switching to a target without containers at %s", missing)
+	}
+	if k8scli.target != target {
+		t.Errorf("target changed after failing to switch to containers at %s", missing)
+	}
+
+	if err := k8scli.SetTarget("daemonset/other", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if k8scli.target.Kind != "DaemonSet" || k8scli.target.Name != "other" {
+		t.Errorf("unexpected target: %+v", k8scli.target)
+	}
+	if k8scli.pendingPods.target != k8scli.target {
+		t.Errorf("pending pods still count the old target")
+	}
+}
+
+func TestValidateTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var obj interface{}
+		switch req.URL.Path {
+		case "/api/v1/namespaces/default":
+			obj = &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+		case "/apis/apps/v1/namespaces/default/deployments/thing":
+			thing := &targetObject{}
+			thing.Spec.Template.Spec.Containers = []apiv1.Container{{Name: "app"}, {Name: "sidecar"}}
+			obj = thing
+		case "/api/v1/namespaces/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		output, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(output)
+	}))
+	defer server.Close()
+	client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+
+	testCases := []struct {
+		namespace  string
+		name       string
+		containers []string
+		expError   string
+	}{
+		{"default", "thing", nil, ""},
+		{"default", "thing", []string{"app", "sidecar"}, ""},
+		{"default", "thing", []string{"app", "proxy"}, `container "proxy" not found in Deployment "thing" (found: [app, sidecar])`},
+		{"defualt", "thing", nil, `namespace "defualt" not found`},
+		{"default", "thnig", nil, `Deployment "thnig" not found in namespace "default"`},
+	}
+	for _, tc := range testCases {
+		tgt := &targetSpec{Kind: "Deployment", GroupVersion: "apps/v1", Namespace: tc.namespace, Name: tc.name}
+		err := validateTarget(client, tgt, tc.containers)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tc.expError {
+			t.Errorf("%s/%s: expected error %q, got %q", tc.namespace, tc.name, tc.expError, got)
+		}
+	}
+
+	tgt := &targetSpec{Kind: "Deployment", GroupVersion: "apps/v1", Namespace: "forbidden", Name: "thing"}
+	if err := validateTarget(client, tgt, nil); err == nil {
+		t.Errorf("expected an error for a forbidden namespace")
+	}
+}
+
+func TestGetClusterSizeMasterNodeWeight(t *testing.T) {
+	withRole := func(node apiv1.Node, role string) apiv1.Node {
+		node.Labels = map[string]string{"node-role.kubernetes.io/" + role: ""}
+		node.Status.Capacity[apiv1.ResourceMemory] = resource.MustParse("16Gi")
+		return node
+	}
+	worker := nodeWithCPU("8")
+	worker.Status.Capacity[apiv1.ResourceMemory] = resource.MustParse("16Gi")
+	nodes := []apiv1.Node{
+		worker, worker, worker,
+		withRole(nodeWithCPU("4"), "master"),
+		withRole(nodeWithCPU("4"), "control-plane"),
+		withRole(nodeWithCPU("4"), "control-plane"),
+	}
+
+	testCases := []struct {
+		name     string
+		weight   *float64
+		memory   bool
+		expNodes int
+		expCores int
+	}{
+		{"unset", nil, false, 6, 36},
+		{"full weight", floatPtr(1), false, 6, 36},
+		{"half weight", floatPtr(0.5), false, 5, 30},
+		{"low weight", floatPtr(0.1), false, 3, 25},
+		{"excluded", floatPtr(0), false, 3, 24},
+		{"half weight by memory", floatPtr(0.5), true, 5, 30},
+		{"excluded by memory", floatPtr(0), true, 3, 24},
+	}
+	server := newNodeServer(t, nodes)
+	defer server.Close()
+	base := resource.MustParse("16Gi")
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset:        clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			masterNodeWeight: tc.weight,
+		}
+		if tc.memory {
+			k8scli.baseNodeMemory = &base
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if sz.Nodes != tc.expNodes || sz.Cores != tc.expCores {
+			t.Errorf("%s: expected %d nodes and %d cores, got %d nodes and %d cores", tc.name, tc.expNodes, tc.expCores, sz.Nodes, sz.Cores)
+		}
+		if sz.ListedNodes != len(nodes) {
+			t.Errorf("%s: expected %d listed nodes, got %d", tc.name, len(nodes), sz.ListedNodes)
+		}
+	}
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestGetClusterSizeNodeGroups(t *testing.T) {
+	inPool := func(node apiv1.Node, pool string) apiv1.Node {
+		node.Labels = map[string]string{"cloud.google.com/gke-nodepool": pool}
+		return node
+	}
+	server := newNodeServer(t, []apiv1.Node{
+		inPool(nodeWithCPU("2"), "default-pool"),
+		inPool(nodeWithCPU("2"), "default-pool"),
+		inPool(nodeWithCPU("8"), "gpu-pool"),
+		nodeWithCPU("4"),
+	})
+	defer server.Close()
+	plain := newNodeServer(t, []apiv1.Node{nodeWithCPU("4")})
+	defer plain.Close()
+
+	k8scli := &k8sClient{
+		clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+	}
+	sz, err := k8scli.GetClusterSize()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]int{"default-pool": 2, "gpu-pool": 1}
+	if !reflect.DeepEqual(sz.NodeGroups, expected) || sz.Nodes != 4 {
+		t.Errorf("expected 4 nodes in groups %v, got %d in %v", expected, sz.Nodes, sz.NodeGroups)
+	}
+
+	// The GPU pool is raised to 2 nodes, and the empty spot pool to 1.
+	k8scli.nodeGroupMinNodes = NodeGroupMinNodes{"gpu-pool": 2, "spot-pool": 1}
+	if sz, err = k8scli.GetClusterSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = map[string]int{"default-pool": 2, "gpu-pool": 2, "spot-pool": 1}
+	if !reflect.DeepEqual(sz.NodeGroups, expected) || sz.Nodes != 6 || sz.Cores != 16 {
+		t.Errorf("expected 6 nodes and 16 cores in groups %v, got %d and %d in %v", expected, sz.Nodes, sz.Cores, sz.NodeGroups)
+	}
+
+	k8scli = &k8sClient{
+		clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: plain.URL}),
+	}
+	if sz, err = k8scli.GetClusterSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sz.NodeGroups != nil || !k8scli.cloudDetected {
+		t.Errorf("expected no node groups without a cloud provider, got %v", sz.NodeGroups)
+	}
+}
+
+func TestWaitForTarget(t *testing.T) {
+	// The deployment is created after a few attempts.
+	gets, schemaFetches := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var obj interface{}
+		switch req.URL.Path {
+		case "/openapi/v2":
+			schemaFetches++
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "/api":
+			obj = &metav1.APIVersions{Versions: []string{"apps/v1"}}
+		case "/apis/apps/v1":
+			obj = &metav1.APIResourceList{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{{Name: "deployments", Namespaced: true, Kind: "Deployment"}},
+			}
+		case "/apis/apps/v1/namespaces/default/deployments/foo":
+			gets++
+			if gets < 3 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			obj = &targetObject{}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		output, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+	defer server.Close()
+	client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+
+	b := &backoff{initial: time.Millisecond, max: 2 * time.Millisecond}
+	tgt, err := waitForTarget(context.Background(), client, "deployment/foo", "default", nil, time.Minute, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tgt.Name != "foo" || gets != 3 {
+		t.Errorf("expected deployment foo after 3 attempts, got %q after %d", tgt.Name, gets)
+	}
+	if schemaFetches != 1 {
+		t.Errorf("expected the OpenAPI schema to be read once, got %d reads", schemaFetches)
+	}
+
+	b.Reset()
+	if _, err := waitForTarget(context.Background(), client, "deployment/bar", "default", nil, 10*time.Millisecond, b); err == nil || !strings.Contains(err.Error(), "not found within 10ms") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if _, err := waitForTarget(context.Background(), client, "bar", "default", nil, time.Minute, b); err == nil || !strings.Contains(err.Error(), "target format error") {
+		t.Errorf("expected a format error, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := waitForTarget(ctx, client, "deployment/bar", "default", nil, time.Minute, b); err == nil {
+		t.Errorf("expected an error for a cancelled context")
+	}
+}
+
+func TestPatchTargetServerSideValidation(t *testing.T) {
+	var path, fieldValidation string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPatch {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		path = req.URL.Path
+		fieldValidation = req.URL.Query().Get("fieldValidation")
+		if fieldValidation == "Strict" {
+			// As an API server does for a patch with an unknown field.
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","message":"unknown field \"spec.template.spec.containerz\"","reason":"BadRequest","code":400}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	tgt, err := newTargetSpec("deployment", map[string]bool{"apps/v1": true}, "default", "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, strict := range []bool{false, true} {
+		k8scli := &k8sClient{
+			clientset:            clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			target:               tgt,
+			serverSideValidation: strict,
+		}
+		path, fieldValidation = "", ""
+		err := k8scli.patchTarget(types.MergePatchType, []byte(`{"spec":{"template":{"spec":{"containerz":[]}}}}`))
+		if path != "/apis/apps/v1/namespaces/default/deployments/foo" {
+			t.Errorf("strict=%v: expected a patch of the deployment, got %q", strict, path)
+		}
+		if strict {
+			if fieldValidation != "Strict" {
+				t.Errorf("expected fieldValidation=Strict, got %q", fieldValidation)
+			}
+			if err == nil {
+				t.Errorf("expected the rejected patch to fail")
+			}
+			continue
+		}
+		if fieldValidation != "" {
+			t.Errorf("expected no fieldValidation, got %q", fieldValidation)
+		}
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
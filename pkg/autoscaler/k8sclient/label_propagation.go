@@ -0,0 +1,173 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// LabelPropagation maps labels of the target's pod template to the node
+// labels whose most common value among the counted nodes they are set to,
+// e.g. "cpva.io/instance-type" to "node.kubernetes.io/instance-type".
+type LabelPropagation map[string]string
+
+// ParseLabelPropagation parses a comma-separated list of POD_LABEL=NODE_LABEL,
+// e.g. "cpva.io/instance-type=node.kubernetes.io/instance-type".
+func ParseLabelPropagation(s string) (LabelPropagation, error) {
+	if s == "" {
+		return nil, nil
+	}
+	p := LabelPropagation{}
+	for _, entry := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("label propagation %q must be POD_LABEL=NODE_LABEL", entry)
+		}
+		for _, key := range kv {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, "; "))
+			}
+		}
+		if _, found := p[kv[0]]; found {
+			return nil, fmt.Errorf("label %s given twice", kv[0])
+		}
+		p[kv[0]] = kv[1]
+	}
+	return p, nil
+}
+
+// Labels returns the value of each pod template label, from the most common
+// value of its node label among nodes.  Ties go to the value which sorts
+// first, so that the result is stable.  A label is left out if no node has
+// its node label.
+func (p LabelPropagation) Labels(nodes []apiv1.Node) map[string]string {
+	labels := map[string]string{}
+	for podLabel, nodeLabel := range p {
+		counts := map[string]int{}
+		for i := range nodes {
+			if value, found := nodes[i].Labels[nodeLabel]; found {
+				counts[value]++
+			}
+		}
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		best := ""
+		for _, value := range values {
+			if best == "" || counts[value] > counts[best] {
+				best = value
+			}
+		}
+		if len(values) > 0 {
+			labels[podLabel] = best
+		}
+	}
+	return labels
+}
+
+// addTemplateLabels adds the labels last computed from the nodes to a patch
+// of the target.  They are only set on the pod template of the built-in
+// kinds.
+func (k *k8sClient) addTemplateLabels(pt types.PatchType, data []byte, obj *targetObject) ([]byte, error) {
+	k.mu.Lock()
+	labels := k.templateLabels
+	k.mu.Unlock()
+	if len(labels) == 0 {
+		return data, nil
+	}
+	if !k.target.containerPath.isDefault() {
+		glog.Warningf("Not propagating labels to %s %s/%s, whose pod template isn't at the default path", k.target.Kind, k.target.Namespace, k.target.Name)
+		return data, nil
+	}
+	return addTemplateLabels(pt, data, obj, labels)
+}
+
+// addTemplateLabels adds the labels which obj's pod template doesn't have
+// yet, or has with another value, to a patch of its containers.
+func addTemplateLabels(pt types.PatchType, data []byte, obj *targetObject, labels map[string]string) ([]byte, error) {
+	current := obj.Spec.Template.Labels
+	changed := map[string]string{}
+	for key, value := range labels {
+		if v, found := current[key]; !found || v != value {
+			changed[key] = value
+		}
+	}
+	if len(changed) == 0 {
+		return data, nil
+	}
+
+	switch pt {
+	case types.JSONPatchType:
+		ops := []interface{}{}
+		if err := json.Unmarshal(data, &ops); err != nil {
+			return nil, err
+		}
+		if current == nil {
+			ops = append(ops, map[string]interface{}{
+				"op":    "add",
+				"path":  "/spec/template/metadata/labels",
+				"value": changed,
+			})
+			return json.Marshal(ops)
+		}
+		keys := make([]string, 0, len(changed))
+		for key := range changed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			ops = append(ops, map[string]interface{}{
+				"op":    "add",
+				"path":  "/spec/template/metadata/labels/" + strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1),
+				"value": changed[key],
+			})
+		}
+		return json.Marshal(ops)
+	case types.StrategicMergePatchType, types.MergePatchType:
+		patch := map[string]interface{}{}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return nil, err
+		}
+		nestedMap(patch, "spec", "template", "metadata")["labels"] = changed
+		return json.Marshal(patch)
+	}
+	return nil, fmt.Errorf("unsupported patch type %s", pt)
+}
+
+// nestedMap returns the object at the fields of obj, adding any which are
+// missing.
+func nestedMap(obj map[string]interface{}, fields ...string) map[string]interface{} {
+	for _, field := range fields {
+		next, _ := obj[field].(map[string]interface{})
+		if next == nil {
+			next = map[string]interface{}{}
+			obj[field] = next
+		}
+		obj = next
+	}
+	return obj
+}
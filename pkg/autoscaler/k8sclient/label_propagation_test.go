@@ -0,0 +1,149 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const instanceTypeLabel = "node.kubernetes.io/instance-type"
+
+func TestParseLabelPropagation(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expected LabelPropagation
+		expError bool
+	}{
+		{"", nil, false},
+		{"cpva.io/instance-type=" + instanceTypeLabel, LabelPropagation{"cpva.io/instance-type": instanceTypeLabel}, false},
+		{"a=zone, b=region", LabelPropagation{"a": "zone", "b": "region"}, false},
+		{"instance-type", nil, true},
+		{"a=zone,a=region", nil, true},
+		{"a b=zone", nil, true},
+		{"a=", nil, true},
+	}
+	for _, tc := range testCases {
+		p, err := ParseLabelPropagation(tc.in)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%q: unexpected error: %v", tc.in, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%q: expected an error, got none", tc.in)
+			continue
+		}
+		if !reflect.DeepEqual(p, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.in, tc.expected, p)
+		}
+	}
+}
+
+func TestLabelPropagationLabels(t *testing.T) {
+	node := func(instanceType string) apiv1.Node {
+		n := apiv1.Node{}
+		if instanceType != "" {
+			n.Labels = map[string]string{instanceTypeLabel: instanceType}
+		}
+		return n
+	}
+	p := LabelPropagation{"instance-type": instanceTypeLabel}
+	testCases := []struct {
+		nodes    []apiv1.Node
+		expected map[string]string
+	}{
+		{[]apiv1.Node{node("m5.large"), node("r5.xlarge"), node("m5.large")}, map[string]string{"instance-type": "m5.large"}},
+		// Ties go to the value which sorts first.
+		{[]apiv1.Node{node("r5.xlarge"), node("m5.large")}, map[string]string{"instance-type": "m5.large"}},
+		// Nodes without the label aren't counted.
+		{[]apiv1.Node{node(""), node(""), node("r5.xlarge")}, map[string]string{"instance-type": "r5.xlarge"}},
+		{[]apiv1.Node{node("")}, map[string]string{}},
+		{nil, map[string]string{}},
+	}
+	for i, tc := range testCases {
+		if labels := p.Labels(tc.nodes); !reflect.DeepEqual(labels, tc.expected) {
+			t.Errorf("case %d: expected %v, got %v", i, tc.expected, labels)
+		}
+	}
+}
+
+func TestAddTemplateLabels(t *testing.T) {
+	labels := map[string]string{"cpva.io/instance-type": "m5.large", "app": "web"}
+	withLabels := func(l map[string]string) *targetObject {
+		obj := &targetObject{}
+		obj.Spec.Template.ObjectMeta = metav1.ObjectMeta{Labels: l}
+		return obj
+	}
+	testCases := []struct {
+		name     string
+		pt       types.PatchType
+		data     string
+		obj      *targetObject
+		expected string
+	}{
+		{
+			"strategic merge",
+			types.StrategicMergePatchType,
+			`{"spec":{"template":{"spec":{"containers":[]}}}}`,
+			withLabels(map[string]string{"app": "web"}),
+			`{"spec":{"template":{"metadata":{"labels":{"cpva.io/instance-type":"m5.large"}},"spec":{"containers":[]}}}}`,
+		},
+		{
+			"up to date",
+			types.StrategicMergePatchType,
+			`{"spec":{}}`,
+			withLabels(map[string]string{"app": "web", "cpva.io/instance-type": "m5.large"}),
+			`{"spec":{}}`,
+		},
+		{
+			"json patch",
+			types.JSONPatchType,
+			`[]`,
+			withLabels(map[string]string{"app": "web", "cpva.io/instance-type": "m4.large"}),
+			`[{"op":"add","path":"/spec/template/metadata/labels/cpva.io~1instance-type","value":"m5.large"}]`,
+		},
+		{
+			"json patch without labels",
+			types.JSONPatchType,
+			`[]`,
+			withLabels(nil),
+			`[{"op":"add","path":"/spec/template/metadata/labels","value":{"app":"web","cpva.io/instance-type":"m5.large"}}]`,
+		},
+	}
+	for _, tc := range testCases {
+		out, err := addTemplateLabels(tc.pt, []byte(tc.data), tc.obj, labels)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		var got, expected interface{}
+		if err := json.Unmarshal(out, &got); err != nil {
+			t.Fatalf("%s: invalid patch %s: %v", tc.name, out, err)
+		}
+		json.Unmarshal([]byte(tc.expected), &expected)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, out)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// LastAppliedAnnotation is where kubectl apply keeps the configuration it
+// last applied, which it diffs against on the next apply.
+const LastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// mergeLastApplied returns the target's last-applied configuration with the
+// resources set, or "" if the target has none, or none of the containers are
+// in it.  Requests and limits are merged into those which are already there,
+// like the patch merges them into the target.
+func mergeLastApplied(annotation string, path ContainerPath, resources map[string]apiv1.ResourceRequirements) (string, error) {
+	if annotation == "" {
+		return "", nil
+	}
+	config := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(annotation), &config); err != nil {
+		return "", fmt.Errorf("can't decode the %s annotation: %v", LastAppliedAnnotation, err)
+	}
+	var node interface{} = config
+	for _, field := range path.fields() {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return "", nil
+		}
+		node = obj[field]
+	}
+	ctrs, _ := node.([]interface{})
+	changed := false
+	for _, c := range ctrs {
+		ctr, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := ctr["name"].(string)
+		res, found := resources[name]
+		if !found {
+			continue
+		}
+		current, _ := ctr["resources"].(map[string]interface{})
+		if current == nil {
+			current = map[string]interface{}{}
+			ctr["resources"] = current
+		}
+		mergeResourceList(current, "requests", res.Requests)
+		mergeResourceList(current, "limits", res.Limits)
+		changed = true
+	}
+	if !changed {
+		return "", nil
+	}
+	jb, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	// kubectl ends the annotation with a newline.
+	return string(jb) + "\n", nil
+}
+
+func mergeResourceList(resources map[string]interface{}, key string, list apiv1.ResourceList) {
+	if len(list) == 0 {
+		return
+	}
+	current, _ := resources[key].(map[string]interface{})
+	if current == nil {
+		current = map[string]interface{}{}
+		resources[key] = current
+	}
+	for name, q := range list {
+		current[string(name)] = q.String()
+	}
+}
+
+// addAnnotation adds an annotation to a patch of the target, which has the
+// given annotations.
+func addAnnotation(pt types.PatchType, data []byte, annotations map[string]string, key, value string) ([]byte, error) {
+	switch pt {
+	case types.JSONPatchType:
+		ops := []interface{}{}
+		if err := json.Unmarshal(data, &ops); err != nil {
+			return nil, err
+		}
+		if annotations == nil {
+			ops = append(ops, map[string]interface{}{
+				"op":    "add",
+				"path":  "/metadata/annotations",
+				"value": map[string]string{key: value},
+			})
+		} else {
+			ops = append(ops, map[string]interface{}{
+				"op":    "add",
+				"path":  "/metadata/annotations/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key),
+				"value": value,
+			})
+		}
+		return json.Marshal(ops)
+	case types.StrategicMergePatchType, types.MergePatchType:
+		patch := map[string]interface{}{}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return nil, err
+		}
+		metadata, _ := patch["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+			patch["metadata"] = metadata
+		}
+		patchAnnotations, _ := metadata["annotations"].(map[string]interface{})
+		if patchAnnotations == nil {
+			patchAnnotations = map[string]interface{}{}
+			metadata["annotations"] = patchAnnotations
+		}
+		patchAnnotations[key] = value
+		return json.Marshal(patch)
+	}
+	return nil, fmt.Errorf("can't add an annotation to a %s patch", pt)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMergeLastApplied(t *testing.T) {
+	resources := map[string]apiv1.ResourceRequirements{
+		"app": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("200m")},
+			Limits:   apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+	}
+	testCases := []struct {
+		name       string
+		annotation string
+		expected   string
+		expError   bool
+	}{
+		{"no annotation", "", "", false},
+		{
+			"merged into existing resources",
+			`{"kind":"Deployment","spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"100m","memory":"64Mi"}}},{"name":"sidecar"}]}}}}`,
+			`{"kind":"Deployment","spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"limits":{"memory":"1Gi"},"requests":{"cpu":"200m","memory":"64Mi"}}},{"name":"sidecar"}]}}}}` + "\n",
+			false,
+		},
+		{
+			"no resources yet",
+			`{"spec":{"template":{"spec":{"containers":[{"name":"app","image":"app:1"}]}}}}`,
+			`{"spec":{"template":{"spec":{"containers":[{"image":"app:1","name":"app","resources":{"limits":{"memory":"1Gi"},"requests":{"cpu":"200m"}}}]}}}}` + "\n",
+			false,
+		},
+		{"container not listed", `{"spec":{"template":{"spec":{"containers":[{"name":"sidecar"}]}}}}`, "", false},
+		{"no containers", `{"spec":{"replicas":3}}`, "", false},
+		{"invalid", `{"spec":`, "", true},
+	}
+	for _, tc := range testCases {
+		got, err := mergeLastApplied(tc.annotation, nil, resources)
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%s: expected error, got %s", tc.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestAddAnnotation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		pt          types.PatchType
+		data        string
+		annotations map[string]string
+		expected    interface{}
+	}{
+		{
+			"strategic merge",
+			types.StrategicMergePatchType,
+			`{"metadata":{"name":"thing"},"spec":{}}`,
+			map[string]string{"other": "x"},
+			map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":        "thing",
+					"annotations": map[string]interface{}{LastAppliedAnnotation: "{}"},
+				},
+				"spec": map[string]interface{}{},
+			},
+		},
+		{
+			"strategic merge with annotations",
+			types.StrategicMergePatchType,
+			`{"metadata":{"annotations":{"a":"b"}}}`,
+			map[string]string{"other": "x"},
+			map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{"a": "b", LastAppliedAnnotation: "{}"},
+				},
+			},
+		},
+		{
+			"json patch",
+			types.JSONPatchType,
+			`[]`,
+			map[string]string{"other": "x"},
+			[]interface{}{map[string]interface{}{
+				"op":    "add",
+				"path":  "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration",
+				"value": "{}",
+			}},
+		},
+		{
+			"json patch without annotations",
+			types.JSONPatchType,
+			`[]`,
+			nil,
+			[]interface{}{map[string]interface{}{
+				"op":    "add",
+				"path":  "/metadata/annotations",
+				"value": map[string]interface{}{LastAppliedAnnotation: "{}"},
+			}},
+		},
+	}
+	for _, tc := range testCases {
+		jb, err := addAnnotation(tc.pt, []byte(tc.data), tc.annotations, LastAppliedAnnotation, "{}")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		var got interface{}
+		if err := json.Unmarshal(jb, &got); err != nil {
+			t.Fatalf("%s: invalid patch %s: %v", tc.name, jb, err)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %s", tc.name, tc.expected, jb)
+		}
+	}
+}
+
+func TestAddLastApplied(t *testing.T) {
+	resources := map[string]apiv1.ResourceRequirements{
+		"app": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("200m")}},
+	}
+	k8scli := &k8sClient{target: &targetSpec{Kind: "Deployment", GroupVersion: "apps/v1", Name: "thing"}, updateLastApplied: true}
+	pt, data, err := k8scli.strategicMergeContainers(resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	obj := &targetObject{}
+	obj.Annotations = map[string]string{LastAppliedAnnotation: `{"spec":{"template":{"spec":{"containers":[{"name":"app"}]}}}}`}
+	jb, err := k8scli.addLastApplied(pt, data, obj, resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"spec\":{\"template\":{\"spec\":{\"containers\":[{\"name\":\"app\",\"resources\":{\"requests\":{\"cpu\":\"200m\"}}}]}}}}\n"},"name":"thing"},"spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"200m"}}}]}}}}`
+	if string(jb) != exp {
+		t.Errorf("expected %s, got %s", exp, string(jb))
+	}
+
+	// A target which wasn't created by kubectl apply is patched as usual, and
+	// so is one whose annotation is broken.
+	for _, annotations := range []map[string]string{nil, {LastAppliedAnnotation: "{"}} {
+		obj.Annotations = annotations
+		jb, err := k8scli.addLastApplied(pt, data, obj, resources)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(jb) != string(data) {
+			t.Errorf("expected the patch to be unchanged, got %s", string(jb))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The annotations which the mutating webhook puts on new Deployments, and
+// which the autoscaler reads with Options.ManagedAnnotations.
+const (
+	// ManagedAnnotation opts a target into autoscaling if "true".
+	ManagedAnnotation = "cpva.io/managed"
+	// PolicyConfigMapAnnotation names the ConfigMap, in the target's
+	// namespace, whose key of the same name holds the target's config.
+	PolicyConfigMapAnnotation = "cpva.io/policy-configmap"
+)
+
+// ManagedConfig is the config of a target, from the ConfigMap named by its
+// PolicyConfigMapAnnotation.
+type ManagedConfig struct {
+	// The target, e.g. "deployment/foo".
+	Target string
+	// The ConfigMap, the resourceVersion it was read at, and its config.
+	ConfigMap       string
+	ResourceVersion string
+	Data            []byte
+}
+
+// findManagedDeployment returns the only Deployment of namespace with the
+// ManagedAnnotation "true", as a target, e.g. "deployment/foo".
+func findManagedDeployment(clientset kubernetes.Interface, namespace string) (string, error) {
+	list, err := clientset.AppsV1().Deployments(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("can't list the Deployments of %s: %v", namespace, err)
+	}
+	names := []string{}
+	for _, d := range list.Items {
+		if d.Annotations[ManagedAnnotation] == "true" {
+			names = append(names, d.Name)
+		}
+	}
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("no Deployment of %s has the annotation %s=true", namespace, ManagedAnnotation)
+	case 1:
+		return "deployment/" + names[0], nil
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("the Deployments %s of %s all have the annotation %s=true, choose one with --target", strings.Join(names, ", "), namespace, ManagedAnnotation)
+}
+
+// ReadManagedConfig returns the config of the target from the ConfigMap named
+// by its PolicyConfigMapAnnotation.  It fails if the target doesn't have the
+// ManagedAnnotation "true".
+func (k *k8sClient) ReadManagedConfig() (*ManagedConfig, error) {
+	k.mu.Lock()
+	tgt := k.target
+	k.mu.Unlock()
+	if tgt == nil {
+		return nil, fmt.Errorf("no target")
+	}
+	obj, err := tgt.Get(k.clientset)
+	if err != nil {
+		return nil, fmt.Errorf("can't get target: %v", err)
+	}
+	target := strings.ToLower(tgt.Kind) + "/" + tgt.Name
+	if managed := obj.Annotations[ManagedAnnotation]; managed != "true" {
+		return nil, fmt.Errorf("not scaling %s, its annotation %s is %q rather than \"true\"", target, ManagedAnnotation, managed)
+	}
+	name := obj.Annotations[PolicyConfigMapAnnotation]
+	if name == "" {
+		return nil, fmt.Errorf("%s has no %s annotation", target, PolicyConfigMapAnnotation)
+	}
+	cm, err := k.clientset.CoreV1().ConfigMaps(tgt.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't get the ConfigMap %s of %s: %v", name, target, err)
+	}
+	data, found := cm.Data[name]
+	if !found {
+		return nil, fmt.Errorf("the ConfigMap %s of %s has no key %s", name, target, name)
+	}
+	return &ManagedConfig{
+		Target:          target,
+		ConfigMap:       name,
+		ResourceVersion: cm.ResourceVersion,
+		Data:            []byte(data),
+	}, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// managedServer serves the Deployments of kube-system with these
+// annotations, and the ConfigMap dns-policy.
+func managedServer(t *testing.T, annotations map[string]map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var obj interface{}
+		switch req.URL.Path {
+		case "/api":
+			obj = &metav1.APIVersions{Versions: []string{"apps/v1"}}
+		case "/apis/apps/v1":
+			obj = &metav1.APIResourceList{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{{Name: "deployments", Namespaced: true, Kind: "Deployment"}},
+			}
+		case "/apis/apps/v1/namespaces/kube-system/deployments":
+			list := &appsv1.DeploymentList{}
+			for name, a := range annotations {
+				list.Items = append(list.Items, appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: a}})
+			}
+			obj = list
+		case "/apis/apps/v1/namespaces/kube-system/deployments/dns":
+			target := &targetObject{}
+			target.Annotations = annotations["dns"]
+			obj = target
+		case "/api/v1/namespaces/kube-system/configmaps/dns-policy":
+			obj = &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "dns-policy", ResourceVersion: "7"},
+				Data:       map[string]string{"dns-policy": `{"dns": {}}`},
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		output, err := json.Marshal(obj)
+		if err != nil {
+			t.Errorf("unexpected encoding error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+}
+
+func TestFindManagedDeployment(t *testing.T) {
+	managed := map[string]string{ManagedAnnotation: "true"}
+	testCases := []struct {
+		desc        string
+		annotations map[string]map[string]string
+		expected    string
+		expError    bool
+	}{
+		{
+			desc:        "one managed",
+			annotations: map[string]map[string]string{"dns": managed, "web": nil, "db": {ManagedAnnotation: "false"}},
+			expected:    "deployment/dns",
+		},
+		{
+			desc:        "none managed",
+			annotations: map[string]map[string]string{"web": nil},
+			expError:    true,
+		},
+		{
+			desc:        "several managed",
+			annotations: map[string]map[string]string{"dns": managed, "web": managed},
+			expError:    true,
+		},
+	}
+	for _, tc := range testCases {
+		server := managedServer(t, tc.annotations)
+		client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+		target, err := findManagedDeployment(client, "kube-system")
+		server.Close()
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", tc.desc, target)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.desc, err)
+			continue
+		}
+		if target != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.desc, tc.expected, target)
+		}
+	}
+}
+
+func TestReadManagedConfig(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    *ManagedConfig
+	}{
+		{
+			desc:        "managed",
+			annotations: map[string]string{ManagedAnnotation: "true", PolicyConfigMapAnnotation: "dns-policy"},
+			expected: &ManagedConfig{
+				Target:          "deployment/dns",
+				ConfigMap:       "dns-policy",
+				ResourceVersion: "7",
+				Data:            []byte(`{"dns": {}}`),
+			},
+		},
+		{
+			desc:        "not managed",
+			annotations: map[string]string{ManagedAnnotation: "false", PolicyConfigMapAnnotation: "dns-policy"},
+		},
+		{
+			desc:        "no ConfigMap",
+			annotations: map[string]string{ManagedAnnotation: "true"},
+		},
+		{
+			desc:        "missing ConfigMap",
+			annotations: map[string]string{ManagedAnnotation: "true", PolicyConfigMapAnnotation: "web-policy"},
+		},
+	}
+	for _, tc := range testCases {
+		server := managedServer(t, map[string]map[string]string{"dns": tc.annotations})
+		client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+		tgt, err := makeTarget(context.Background(), client, "deployment/dns", "kube-system", nil)
+		if err != nil {
+			server.Close()
+			t.Fatalf("%s: error making target: %v", tc.desc, err)
+		}
+		k8scli := &k8sClient{clientset: client, target: tgt}
+		config, err := k8scli.ReadManagedConfig()
+		server.Close()
+		if tc.expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", tc.desc, config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(config, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, config)
+		}
+	}
+}
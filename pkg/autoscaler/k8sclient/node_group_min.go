@@ -0,0 +1,66 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NodeGroupMinNodes is the least number of nodes, by node group name, which
+// each node group is counted as having, e.g. so that a pool which is scaled
+// to zero, or was just added, doesn't size its workloads for no nodes.
+type NodeGroupMinNodes map[string]int
+
+// ParseNodeGroupMinNodes parses entries of the form GROUP=N, e.g.
+// "gpu-pool=2".
+func ParseNodeGroupMinNodes(entries []string) (NodeGroupMinNodes, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	mins := NodeGroupMinNodes{}
+	for _, entry := range entries {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("node group minimum %q must be GROUP=N", entry)
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("minimum nodes of node group %s must be a positive integer, got %q", kv[0], kv[1])
+		}
+		if _, found := mins[kv[0]]; found {
+			return nil, fmt.Errorf("minimum nodes of node group %s given twice", kv[0])
+		}
+		mins[kv[0]] = n
+	}
+	return mins, nil
+}
+
+// apply raises the count of each node group in groups to its minimum,
+// including groups without any nodes, and returns the number of nodes which
+// were added.
+func (m NodeGroupMinNodes) apply(groups map[string]int) int {
+	added := 0
+	for group, min := range m {
+		if groups[group] < min {
+			added += min - groups[group]
+			groups[group] = min
+		}
+	}
+	return added
+}
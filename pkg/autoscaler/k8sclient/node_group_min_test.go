@@ -0,0 +1,81 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNodeGroupMinNodes(t *testing.T) {
+	testCases := []struct {
+		entries  []string
+		expected NodeGroupMinNodes
+		expError bool
+	}{
+		{nil, nil, false},
+		{[]string{"gpu-pool=2"}, NodeGroupMinNodes{"gpu-pool": 2}, false},
+		{[]string{"gpu-pool=2", " default-pool=1 "}, NodeGroupMinNodes{"gpu-pool": 2, "default-pool": 1}, false},
+		{[]string{"gpu-pool"}, nil, true},
+		{[]string{"=2"}, nil, true},
+		{[]string{"gpu-pool="}, nil, true},
+		{[]string{"gpu-pool=0"}, nil, true},
+		{[]string{"gpu-pool=-1"}, nil, true},
+		{[]string{"gpu-pool=1.5"}, nil, true},
+		{[]string{"gpu-pool=1", "gpu-pool=2"}, nil, true},
+	}
+	for _, tc := range testCases {
+		mins, err := ParseNodeGroupMinNodes(tc.entries)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%q: unexpected error: %v", tc.entries, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%q: expected an error, got none", tc.entries)
+			continue
+		}
+		if !reflect.DeepEqual(mins, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.entries, tc.expected, mins)
+		}
+	}
+}
+
+func TestNodeGroupMinNodesApply(t *testing.T) {
+	testCases := []struct {
+		name     string
+		groups   map[string]int
+		expected map[string]int
+		expAdded int
+	}{
+		{"all above", map[string]int{"default-pool": 3, "gpu-pool": 4}, map[string]int{"default-pool": 3, "gpu-pool": 4}, 0},
+		{"at the minimum", map[string]int{"default-pool": 3, "gpu-pool": 2}, map[string]int{"default-pool": 3, "gpu-pool": 2}, 0},
+		{"below", map[string]int{"default-pool": 3, "gpu-pool": 1}, map[string]int{"default-pool": 3, "gpu-pool": 2}, 1},
+		{"scaled to zero", map[string]int{"default-pool": 3}, map[string]int{"default-pool": 3, "gpu-pool": 2}, 2},
+		{"both below", map[string]int{}, map[string]int{"default-pool": 1, "gpu-pool": 2}, 3},
+	}
+	mins := NodeGroupMinNodes{"default-pool": 1, "gpu-pool": 2}
+	for _, tc := range testCases {
+		if added := mins.apply(tc.groups); added != tc.expAdded {
+			t.Errorf("%s: expected %d nodes to be added, got %d", tc.name, tc.expAdded, added)
+		}
+		if !reflect.DeepEqual(tc.groups, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, tc.groups)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// NodeReadiness excludes the nodes which have not been Ready for longer than
+// a grace period.  A node which only briefly goes NotReady, e.g. while its
+// kubelet restarts, keeps being counted, so that the cluster size doesn't
+// flap with it.
+type NodeReadiness struct {
+	gracePeriod time.Duration
+	clock       clock.Clock
+	// When each node, by UID, was last seen Ready, and whether it was seen
+	// since the last Sweep.
+	lastReady map[types.UID]time.Time
+	seen      map[types.UID]bool
+}
+
+// NewNodeReadiness returns a NodeReadiness with the given grace period.
+func NewNodeReadiness(gracePeriod time.Duration, clock clock.Clock) *NodeReadiness {
+	return &NodeReadiness{
+		gracePeriod: gracePeriod,
+		clock:       clock,
+		lastReady:   map[types.UID]time.Time{},
+		seen:        map[types.UID]bool{},
+	}
+}
+
+// Counts returns whether the node should be counted: if it is Ready, or
+// hasn't been NotReady for longer than the grace period.  A node which was
+// never seen Ready is assumed to have been Ready until its Ready condition
+// last changed, or, without one, until it was created.
+func (r *NodeReadiness) Counts(node *apiv1.Node) bool {
+	now := r.clock.Now()
+	r.seen[node.UID] = true
+	ready, since := nodeReady(node)
+	if ready {
+		r.lastReady[node.UID] = now
+		return true
+	}
+	last, found := r.lastReady[node.UID]
+	if !found {
+		last = since
+		if last.IsZero() {
+			last = now
+		}
+		r.lastReady[node.UID] = last
+	}
+	return now.Sub(last) <= r.gracePeriod
+}
+
+// Sweep forgets the nodes which were not passed to Counts since the last
+// Sweep, e.g. because they were deleted.
+func (r *NodeReadiness) Sweep() {
+	for uid := range r.lastReady {
+		if !r.seen[uid] {
+			delete(r.lastReady, uid)
+		}
+	}
+	r.seen = map[types.UID]bool{}
+}
+
+// nodeReady returns whether the node's Ready condition is true, and when the
+// condition last changed, or, if the node has none, when it was created.
+func nodeReady(node *apiv1.Node) (bool, time.Time) {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == apiv1.NodeReady {
+			return cond.Status == apiv1.ConditionTrue, cond.LastTransitionTime.Time
+		}
+	}
+	return false, node.CreationTimestamp.Time
+}
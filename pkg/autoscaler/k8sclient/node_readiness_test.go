@@ -0,0 +1,138 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func nodeWithReadiness(uid string, status apiv1.ConditionStatus, since time.Time) apiv1.Node {
+	node := nodeWithCPU("2")
+	node.UID = types.UID(uid)
+	node.Status.Conditions = []apiv1.NodeCondition{
+		{Type: apiv1.NodeReady, Status: status, LastTransitionTime: metav1.NewTime(since)},
+	}
+	return node
+}
+
+func TestNodeReadinessFlapping(t *testing.T) {
+	start := time.Now()
+	clk := clock.NewFakeClock(start)
+	r := NewNodeReadiness(5*time.Minute, clk)
+
+	// The node flaps, and is only excluded once it has stayed NotReady for
+	// longer than the grace period.
+	steps := []struct {
+		after    time.Duration
+		status   apiv1.ConditionStatus
+		expected bool
+	}{
+		{0, apiv1.ConditionTrue, true},
+		{time.Minute, apiv1.ConditionFalse, true},
+		{2 * time.Minute, apiv1.ConditionTrue, true},
+		{3 * time.Minute, apiv1.ConditionUnknown, true},
+		{4 * time.Minute, apiv1.ConditionTrue, true},
+		{5 * time.Minute, apiv1.ConditionFalse, true},
+		{9 * time.Minute, apiv1.ConditionFalse, true},
+		{10 * time.Minute, apiv1.ConditionFalse, false},
+		{11 * time.Minute, apiv1.ConditionTrue, true},
+	}
+	for _, step := range steps {
+		clk.SetTime(start.Add(step.after))
+		// The kubelet's transition time doesn't matter once the node was
+		// seen Ready.
+		node := nodeWithReadiness("flapping", step.status, start.Add(step.after))
+		if got := r.Counts(&node); got != step.expected {
+			t.Errorf("after %v, %s: expected %v, got %v", step.after, step.status, step.expected, got)
+		}
+	}
+}
+
+func TestNodeReadinessNeverSeenReady(t *testing.T) {
+	now := time.Now()
+	r := NewNodeReadiness(5*time.Minute, clock.NewFakeClock(now))
+	testCases := []struct {
+		node     apiv1.Node
+		expected bool
+	}{
+		{nodeWithReadiness("recent", apiv1.ConditionFalse, now.Add(-time.Minute)), true},
+		{nodeWithReadiness("down", apiv1.ConditionFalse, now.Add(-time.Hour)), false},
+		{nodeWithReadiness("unknown", apiv1.ConditionUnknown, now.Add(-time.Hour)), false},
+	}
+	for _, tc := range testCases {
+		if got := r.Counts(&tc.node); got != tc.expected {
+			t.Errorf("node %s: expected %v, got %v", tc.node.UID, tc.expected, got)
+		}
+	}
+	// Without a Ready condition, a node counts from its creation.
+	node := nodeWithCPU("2")
+	node.UID = "new"
+	node.CreationTimestamp = metav1.NewTime(now.Add(-time.Minute))
+	if !r.Counts(&node) {
+		t.Errorf("expected a new node without a Ready condition to be counted")
+	}
+	node.UID = "old"
+	node.CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+	if r.Counts(&node) {
+		t.Errorf("expected an old node without a Ready condition not to be counted")
+	}
+}
+
+func TestNodeReadinessSweep(t *testing.T) {
+	r := NewNodeReadiness(time.Minute, clock.NewFakeClock(time.Now()))
+	a := nodeWithReadiness("a", apiv1.ConditionTrue, time.Time{})
+	b := nodeWithReadiness("b", apiv1.ConditionTrue, time.Time{})
+	r.Counts(&a)
+	r.Counts(&b)
+	r.Sweep()
+	r.Counts(&a)
+	r.Sweep()
+	if _, found := r.lastReady["b"]; found || len(r.lastReady) != 1 {
+		t.Errorf("expected only node a to be remembered, got %v", r.lastReady)
+	}
+}
+
+func TestGetClusterSizeNodeReadyGracePeriod(t *testing.T) {
+	now := time.Now()
+	server := newNodeServer(t, []apiv1.Node{
+		nodeWithReadiness("ready", apiv1.ConditionTrue, now.Add(-time.Hour)),
+		nodeWithReadiness("flapped", apiv1.ConditionFalse, now.Add(-time.Minute)),
+		nodeWithReadiness("down", apiv1.ConditionFalse, now.Add(-time.Hour)),
+	})
+	defer server.Close()
+
+	k8scli := &k8sClient{
+		clientset:     clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+		nodeReadiness: NewNodeReadiness(5*time.Minute, clock.NewFakeClock(now)),
+	}
+	sz, err := k8scli.GetClusterSizeWithContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sz.Nodes != 2 || sz.Cores != 4 || sz.ListedNodes != 3 {
+		t.Errorf("expected 2 of 3 nodes with 4 cores, got %d of %d nodes with %d cores", sz.Nodes, sz.ListedNodes, sz.Cores)
+	}
+}
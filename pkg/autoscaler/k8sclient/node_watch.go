@@ -0,0 +1,271 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/cloud"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// The delays between attempts to list and watch the nodes after errors.
+const (
+	nodeWatchInitialBackoff = time.Second
+	nodeWatchMaxBackoff     = 5 * time.Minute
+)
+
+// backoff is an exponential backoff: every delay is twice the last, up to
+// max, until it is reset.
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	next    time.Duration
+}
+
+// Step returns the next delay.
+func (b *backoff) Step() time.Duration {
+	if b.next == 0 {
+		b.next = b.initial
+	}
+	delay := b.next
+	b.next *= 2
+	if b.next > b.max {
+		b.next = b.max
+	}
+	return delay
+}
+
+// Reset makes the next delay the initial one again.
+func (b *backoff) Reset() {
+	b.next = 0
+}
+
+// nodeWatcher keeps a copy of the nodes of the target's cluster up to date
+// from a watch, and measures the cluster size whenever they change.
+type nodeWatcher struct {
+	k        *k8sClient
+	onChange func(*ClusterSize)
+	backoff  backoff
+	// The node labels whose values are counted, see countedLabels.
+	labels []string
+	// The nodes by name, and the resource version to watch from.
+	nodes map[string]apiv1.Node
+	rv    string
+	// The last cluster size passed to onChange.
+	last *ClusterSize
+}
+
+func (k *k8sClient) WatchNodes(ctx context.Context, onChange func(*ClusterSize)) error {
+	w := &nodeWatcher{
+		k:        k,
+		onChange: onChange,
+		backoff:  backoff{initial: nodeWatchInitialBackoff, max: nodeWatchMaxBackoff},
+		labels:   k.countedLabels(),
+	}
+	return w.run(ctx)
+}
+
+// run lists and then watches the nodes until ctx is cancelled, and returns
+// ctx.Err().  A watch which times out is resumed where it left off, and one
+// whose resource version is too old to resume from starts over with a list.
+func (w *nodeWatcher) run(ctx context.Context) error {
+	relist := true
+	for {
+		var err error
+		if relist {
+			err = w.list(ctx)
+		}
+		if err == nil {
+			relist, err = w.watch(ctx)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			continue
+		}
+		delay := w.backoff.Step()
+		glog.Warningf("Error watching nodes, retrying in %v: %v", delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// list replaces the nodes with a fresh list of them.
+func (w *nodeWatcher) list(ctx context.Context) error {
+	list, err := listNodeList(ctx, w.k.clientset)
+	if err != nil {
+		return fmt.Errorf("can't list nodes: %v", err)
+	}
+	w.backoff.Reset()
+	w.nodes = make(map[string]apiv1.Node, len(list.Items))
+	for _, node := range list.Items {
+		w.nodes[node.Name] = node
+	}
+	w.rv = list.ResourceVersion
+	w.update(ctx)
+	return nil
+}
+
+// watch applies the changes to the nodes until the watch is closed or ctx is
+// cancelled, and returns whether the nodes must be listed again.
+func (w *nodeWatcher) watch(ctx context.Context) (bool, error) {
+	opt := metav1.ListOptions{
+		Watch:               true,
+		ResourceVersion:     w.rv,
+		AllowWatchBookmarks: true,
+	}
+	// The typed Nodes() client does not take a context, so build the same
+	// request by hand.
+	wi, err := w.k.clientset.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		VersionedParams(&opt, scheme.ParameterCodec).
+		Context(ctx).
+		Watch()
+	if err != nil {
+		if expired(err) {
+			glog.V(2).Infof("Can't resume watching nodes, listing them again: %v", err)
+			return true, nil
+		}
+		return false, fmt.Errorf("can't watch nodes: %v", err)
+	}
+	defer wi.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case ev, ok := <-wi.ResultChan():
+			if !ok {
+				// The watch timed out, resume where it left off.
+				return false, nil
+			}
+			switch ev.Type {
+			case watch.Added, watch.Modified, watch.Deleted:
+				node, ok := ev.Object.(*apiv1.Node)
+				if !ok {
+					continue
+				}
+				w.backoff.Reset()
+				w.rv = node.ResourceVersion
+				if w.apply(ev.Type, node) {
+					w.update(ctx)
+				}
+			case watch.Bookmark:
+				// Only the resource version is set, to resume from.
+				if node, ok := ev.Object.(*apiv1.Node); ok {
+					w.rv = node.ResourceVersion
+				}
+			case watch.Error:
+				err := apierrors.FromObject(ev.Object)
+				if expired(err) {
+					glog.V(2).Infof("Node watch expired, listing the nodes again: %v", err)
+					return true, nil
+				}
+				return false, fmt.Errorf("error watching nodes: %v", err)
+			}
+		}
+	}
+}
+
+// expired returns whether err means that the resource version to watch from
+// is too old.
+func expired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// apply applies a watch event to the nodes, and returns whether it may change
+// the cluster size.  Nodes are modified all the time, e.g. by their
+// heartbeats, but that only matters if their capacity, OS, cores annotation,
+// taints or counted labels change.
+func (w *nodeWatcher) apply(t watch.EventType, node *apiv1.Node) bool {
+	old, found := w.nodes[node.Name]
+	if t == watch.Deleted {
+		delete(w.nodes, node.Name)
+		return found
+	}
+	w.nodes[node.Name] = *node
+	return !found || nodeFingerprint(&old, w.k.nodeCoresAnnotation, w.labels) != nodeFingerprint(node, w.k.nodeCoresAnnotation, w.labels)
+}
+
+// countedLabels returns the node labels whose values are counted: those of
+// the --node-label-weight rules and --label-propagation, and the node group
+// labels of all cloud providers, since the provider is only detected once
+// there are nodes.
+func (k *k8sClient) countedLabels() []string {
+	labels := []string{}
+	for _, rule := range k.nodeWeightRules {
+		labels = append(labels, rule.Label)
+	}
+	for _, nodeLabel := range k.labelPropagation {
+		labels = append(labels, nodeLabel)
+	}
+	for _, p := range cloud.Providers {
+		labels = append(labels, p.NodeGroupLabel())
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// nodeFingerprint sums up what is counted of a node, including the values of
+// the given labels.
+func nodeFingerprint(node *apiv1.Node, annotation string, labels []string) string {
+	cpu := node.Status.Capacity[apiv1.ResourceCPU]
+	memory := node.Status.Capacity[apiv1.ResourceMemory]
+	taints := []string{}
+	for _, taint := range node.Spec.Taints {
+		// Not String(), which leaves out an empty value.
+		taints = append(taints, fmt.Sprintf("%s=%s:%s", taint.Key, taint.Value, taint.Effect))
+	}
+	values := []string{}
+	for _, label := range labels {
+		value, found := node.Labels[label]
+		values = append(values, fmt.Sprintf("%t=%s", found, value))
+	}
+	return fmt.Sprintf("%s/%s/%s/%t/%q/%q/%q", cpu.String(), memory.String(), nodeOS(node), isControlPlane(node), node.Annotations[annotation], taints, values)
+}
+
+// update measures the cluster size with the current nodes, and passes it to
+// onChange if it changed.
+func (w *nodeWatcher) update(ctx context.Context) {
+	nodes := make([]apiv1.Node, 0, len(w.nodes))
+	for _, node := range w.nodes {
+		nodes = append(nodes, node)
+	}
+	size, err := w.k.clusterSizeOf(ctx, nodes)
+	if err != nil {
+		glog.Errorf("Error getting cluster size for the watched nodes: %v", err)
+		return
+	}
+	if w.last != nil && w.last.Equal(size) {
+		return
+	}
+	w.last = copyClusterSize(size)
+	w.onChange(size)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func watchedNode(name, cpu, rv string) *apiv1.Node {
+	return &apiv1.Node{
+		TypeMeta:   metav1.TypeMeta{Kind: "Node", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: rv},
+		Status:     apiv1.NodeStatus{Capacity: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu)}},
+	}
+}
+
+func TestWatchNodes(t *testing.T) {
+	type event struct {
+		Type   watch.EventType `json:"type"`
+		Object interface{}     `json:"object"`
+	}
+	lists := [][]*apiv1.Node{
+		{watchedNode("a", "2", "")},
+		{watchedNode("a", "2", ""), watchedNode("b", "4", ""), watchedNode("c", "8", "")},
+	}
+	expired := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Code:     http.StatusGone,
+		Reason:   metav1.StatusReasonExpired,
+		Message:  "too old resource version",
+	}
+	// The responses to the watches, in order: nil fails the request.
+	watches := [][]event{
+		{
+			{watch.Added, watchedNode("b", "4", "11")},
+			// A heartbeat doesn't change the cluster size.
+			{watch.Modified, watchedNode("a", "2", "12")},
+			{watch.Bookmark, &apiv1.Node{TypeMeta: metav1.TypeMeta{Kind: "Node", APIVersion: "v1"}, ObjectMeta: metav1.ObjectMeta{ResourceVersion: "13"}}},
+			{watch.Error, expired},
+		},
+		nil,
+		{
+			{watch.Deleted, watchedNode("c", "8", "21")},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var watchedFrom []string
+	listed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.URL.Path != "/api/v1/nodes" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("watch") != "true" {
+			listed++
+			list := &apiv1.NodeList{ListMeta: metav1.ListMeta{ResourceVersion: fmt.Sprint(10 * listed)}}
+			for _, node := range lists[listed-1] {
+				list.Items = append(list.Items, *node)
+			}
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+		if req.URL.Query().Get("allowWatchBookmarks") != "true" {
+			t.Errorf("expected bookmarks to be allowed, got %s", req.URL.RawQuery)
+		}
+		watchedFrom = append(watchedFrom, req.URL.Query().Get("resourceVersion"))
+		if len(watches) == 0 {
+			// Everything has been seen.
+			cancel()
+			return
+		}
+		events := watches[0]
+		watches = watches[1:]
+		if events == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		enc := json.NewEncoder(w)
+		for _, ev := range events {
+			enc.Encode(ev)
+		}
+	}))
+	defer server.Close()
+
+	var sizes [][2]int
+	nw := &nodeWatcher{
+		k:        &k8sClient{clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})},
+		onChange: func(size *ClusterSize) { sizes = append(sizes, [2]int{size.Nodes, size.Cores}) },
+		backoff:  backoff{initial: time.Millisecond, max: time.Millisecond},
+	}
+	if err := nw.run(ctx); err != context.Canceled {
+		t.Errorf("expected the watch to end with the context, got %v", err)
+	}
+	expSizes := [][2]int{{1, 2}, {2, 6}, {3, 14}, {2, 6}}
+	if !reflect.DeepEqual(sizes, expSizes) {
+		t.Errorf("expected sizes (nodes, cores) %v, got %v", expSizes, sizes)
+	}
+	// Relisted after the watch expired, resumed after the failure and
+	// after the watch was closed.
+	expFrom := []string{"10", "20", "20", "21"}
+	if !reflect.DeepEqual(watchedFrom, expFrom) {
+		t.Errorf("expected watches from %v, got %v", expFrom, watchedFrom)
+	}
+}
+
+func TestNodeFingerprint(t *testing.T) {
+	base := watchedNode("a", "2", "1")
+	for _, tt := range []struct {
+		name      string
+		modify    func(node *apiv1.Node)
+		expChange bool
+	}{
+		{"heartbeat", func(node *apiv1.Node) { node.ResourceVersion = "2" }, false},
+		{"resized", func(node *apiv1.Node) { node.Status.Capacity[apiv1.ResourceCPU] = resource.MustParse("4") }, true},
+		{"tainted", func(node *apiv1.Node) {
+			node.Spec.Taints = []apiv1.Taint{{Key: "dedicated", Value: "gpu", Effect: apiv1.TaintEffectNoSchedule}}
+		}, true},
+		{"labelled", func(node *apiv1.Node) {
+			node.Labels = map[string]string{"node.kubernetes.io/instance-type": "m5.large"}
+		}, true},
+		{"labelled with another label", func(node *apiv1.Node) { node.Labels = map[string]string{"team": "a"} }, false},
+		{"labelled with an empty value", func(node *apiv1.Node) {
+			node.Labels = map[string]string{"node.kubernetes.io/instance-type": ""}
+		}, true},
+	} {
+		node := base.DeepCopy()
+		tt.modify(node)
+		labels := []string{"node.kubernetes.io/instance-type"}
+		if changed := nodeFingerprint(base, "", labels) != nodeFingerprint(node, "", labels); changed != tt.expChange {
+			t.Errorf("%s: expected a change %v, got %v", tt.name, tt.expChange, changed)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := backoff{initial: time.Second, max: 5 * time.Second}
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		delays = append(delays, b.Step())
+	}
+	b.Reset()
+	delays = append(delays, b.Step())
+	exp := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second, time.Second}
+	if !reflect.DeepEqual(delays, exp) {
+		t.Errorf("expected delays %v, got %v", exp, delays)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NodeWeightRule weighs the nodes with a label, e.g. of an instance type or
+// a zone, as Weight nodes with Weight times their cores.
+type NodeWeightRule struct {
+	Label  string
+	Value  string
+	Weight float64
+}
+
+// NodeWeightRules are the rules in the order they were given.
+type NodeWeightRules []NodeWeightRule
+
+// ParseNodeWeightRules parses entries of the form LABEL=VALUE:WEIGHT, e.g.
+// "node.kubernetes.io/instance-type=m5.large:0.5".
+func ParseNodeWeightRules(entries []string) (NodeWeightRules, error) {
+	var rules NodeWeightRules
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		i := strings.LastIndex(entry, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("node weight %q must be LABEL=VALUE:WEIGHT", entry)
+		}
+		kv := strings.SplitN(entry[:i], "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("node weight %q must be LABEL=VALUE:WEIGHT", entry)
+		}
+		if errs := validation.IsQualifiedName(kv[0]); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label %q: %s", kv[0], strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(kv[1]); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label value %q: %s", kv[1], strings.Join(errs, "; "))
+		}
+		weight, err := strconv.ParseFloat(entry[i+1:], 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("weight of %s=%s must be a non-negative number, got %q", kv[0], kv[1], entry[i+1:])
+		}
+		rules = append(rules, NodeWeightRule{Label: kv[0], Value: kv[1], Weight: weight})
+	}
+	return rules, nil
+}
+
+// matching returns the weights of the rules which the node matches, in
+// order.
+func (r NodeWeightRules) matching(node *apiv1.Node) []float64 {
+	var weights []float64
+	for _, rule := range r {
+		if value, found := node.Labels[rule.Label]; found && value == rule.Value {
+			weights = append(weights, rule.Weight)
+		}
+	}
+	return weights
+}
+
+// WeightAggregation says how the weights of a node which matches more than
+// one rule are combined.
+type WeightAggregation string
+
+const (
+	// WeightFirstMatch uses the weight of the first rule the node matches.
+	// This is the default.
+	WeightFirstMatch WeightAggregation = "first-match"
+	// WeightMultiply multiplies the weights, e.g. of an instance type and a
+	// zone.
+	WeightMultiply WeightAggregation = "multiply"
+	// WeightMax uses the largest of the weights.
+	WeightMax WeightAggregation = "max"
+)
+
+// ParseWeightAggregation checks an aggregation, and returns the default for
+// an empty one.
+func ParseWeightAggregation(s string) (WeightAggregation, error) {
+	switch WeightAggregation(s) {
+	case "":
+		return WeightFirstMatch, nil
+	case WeightFirstMatch, WeightMultiply, WeightMax:
+		return WeightAggregation(s), nil
+	}
+	return "", fmt.Errorf("unknown aggregation %q, must be %q, %q or %q", s, WeightFirstMatch, WeightMultiply, WeightMax)
+}
+
+// combine returns the weight of a node which matched rules of the given
+// weights, of which there is at least one.
+func (a WeightAggregation) combine(weights []float64) float64 {
+	w := weights[0]
+	switch a {
+	case WeightMultiply:
+		for _, v := range weights[1:] {
+			w *= v
+		}
+	case WeightMax:
+		for _, v := range weights[1:] {
+			if v > w {
+				w = v
+			}
+		}
+	}
+	return w
+}
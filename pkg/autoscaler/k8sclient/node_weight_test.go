@@ -0,0 +1,182 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestParseNodeWeightRules(t *testing.T) {
+	testCases := []struct {
+		entries  []string
+		expected NodeWeightRules
+		expError bool
+	}{
+		{nil, nil, false},
+		{[]string{"node.kubernetes.io/instance-type=m5.large:0.5"}, NodeWeightRules{{"node.kubernetes.io/instance-type", "m5.large", 0.5}}, false},
+		{
+			[]string{"node.kubernetes.io/instance-type=m5.4xlarge:2", " topology.kubernetes.io/zone=us-east-1a:0 "},
+			NodeWeightRules{{"node.kubernetes.io/instance-type", "m5.4xlarge", 2}, {"topology.kubernetes.io/zone", "us-east-1a", 0}},
+			false,
+		},
+		{[]string{"spot=:0.5"}, NodeWeightRules{{"spot", "", 0.5}}, false},
+		{[]string{"node.kubernetes.io/instance-type=m5.large"}, nil, true},
+		{[]string{"node.kubernetes.io/instance-type:0.5"}, nil, true},
+		{[]string{"node.kubernetes.io/instance-type=m5.large:half"}, nil, true},
+		{[]string{"node.kubernetes.io/instance-type=m5.large:-1"}, nil, true},
+		{[]string{"not a label=m5.large:1"}, nil, true},
+		{[]string{"node.kubernetes.io/instance-type=not a value:1"}, nil, true},
+	}
+	for _, tc := range testCases {
+		rules, err := ParseNodeWeightRules(tc.entries)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%q: unexpected error: %v", tc.entries, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%q: expected an error, got none", tc.entries)
+			continue
+		}
+		if !reflect.DeepEqual(rules, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.entries, tc.expected, rules)
+		}
+	}
+}
+
+func TestParseWeightAggregation(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expected WeightAggregation
+		expError bool
+	}{
+		{"", WeightFirstMatch, false},
+		{"first-match", WeightFirstMatch, false},
+		{"multiply", WeightMultiply, false},
+		{"max", WeightMax, false},
+		{"sum", "", true},
+		{"Max", "", true},
+	}
+	for _, tc := range testCases {
+		agg, err := ParseWeightAggregation(tc.in)
+		if (err != nil) != tc.expError {
+			t.Errorf("%q: expected error %v, got %v", tc.in, tc.expError, err)
+		}
+		if agg != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.expected, agg)
+		}
+	}
+}
+
+func TestGetClusterSizeNodeWeightAggregation(t *testing.T) {
+	node := func(cpu, instanceType, zone string) apiv1.Node {
+		n := nodeWithCPU(cpu)
+		n.Labels = map[string]string{
+			"node.kubernetes.io/instance-type": instanceType,
+			"topology.kubernetes.io/zone":      zone,
+		}
+		n.Status.Capacity[apiv1.ResourceMemory] = resource.MustParse("16Gi")
+		return n
+	}
+	// The first two nodes match both rules, the third only the zone's, and
+	// the last none.
+	nodes := []apiv1.Node{
+		node("16", "m5.4xlarge", "us-east-1a"),
+		node("16", "m5.4xlarge", "us-east-1a"),
+		node("4", "m5.xlarge", "us-east-1a"),
+		node("4", "m5.xlarge", "us-east-1b"),
+	}
+	rules := NodeWeightRules{
+		{"node.kubernetes.io/instance-type", "m5.4xlarge", 4},
+		{"topology.kubernetes.io/zone", "us-east-1a", 0.5},
+	}
+	server := newNodeServer(t, nodes)
+	defer server.Close()
+	base := resource.MustParse("16Gi")
+
+	testCases := []struct {
+		name        string
+		aggregation WeightAggregation
+		master      *float64
+		memory      bool
+		expNodes    int
+		expCores    int
+	}{
+		// 4 + 4 + 0.5 + 1 nodes, 64 + 64 + 2 + 4 cores.
+		{"first match", WeightFirstMatch, nil, false, 10, 134},
+		{"default is first match", "", nil, false, 10, 134},
+		// 2 + 2 + 0.5 + 1 nodes, 32 + 32 + 2 + 4 cores.
+		{"multiply", WeightMultiply, nil, false, 6, 70},
+		// Like the first match, as the instance type's weight is larger.
+		{"max", WeightMax, nil, false, 10, 134},
+		// The memory of the nodes counts at the same weights.
+		{"multiply by memory", WeightMultiply, nil, true, 6, 70},
+		// No node is a control-plane node.
+		{"with a master weight", WeightFirstMatch, floatPtr(0), false, 10, 134},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset:         clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			masterNodeWeight:  tc.master,
+			nodeWeightRules:   rules,
+			weightAggregation: tc.aggregation,
+		}
+		if tc.memory {
+			k8scli.baseNodeMemory = &base
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if sz.Nodes != tc.expNodes || sz.Cores != tc.expCores {
+			t.Errorf("%s: expected %d nodes and %d cores, got %d nodes and %d cores", tc.name, tc.expNodes, tc.expCores, sz.Nodes, sz.Cores)
+		}
+	}
+}
+
+func TestMatchNodeWeightWithControlPlane(t *testing.T) {
+	node := &apiv1.Node{}
+	node.Labels = map[string]string{
+		"node-role.kubernetes.io/control-plane": "",
+		"node.kubernetes.io/instance-type":      "m5.large",
+	}
+	rules := NodeWeightRules{{"node.kubernetes.io/instance-type", "m5.large", 0.8}}
+	testCases := []struct {
+		aggregation WeightAggregation
+		expWeight   float64
+	}{
+		{WeightFirstMatch, 0.5},
+		{WeightMultiply, 0.4},
+		{WeightMax, 0.8},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{masterNodeWeight: floatPtr(0.5), nodeWeightRules: rules, weightAggregation: tc.aggregation}
+		if weight, matched := k8scli.matchNodeWeight(node); !matched || weight != tc.expWeight {
+			t.Errorf("%s: expected a weight of %v, got %v, %v", tc.aggregation, tc.expWeight, weight, matched)
+		}
+	}
+	if weight, matched := (&k8sClient{}).matchNodeWeight(node); matched || weight != 1 {
+		t.Errorf("expected a weight of 1 without rules, got %v, %v", weight, matched)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// DryRunPatch is a patch that was computed, but not applied, in a dry run.
+type DryRunPatch struct {
+	// The target, as kind/namespace/name.
+	Target    string
+	PatchType types.PatchType
+	Data      []byte
+	// The resources of the containers before and after the patch.
+	Current     map[string]apiv1.ResourceRequirements
+	Recommended map[string]apiv1.ResourceRequirements
+}
+
+// PatchFormatter prints a dry-run patch.
+type PatchFormatter interface {
+	Format(w io.Writer, patch *DryRunPatch) error
+}
+
+// NewPatchFormatter returns the formatter for an output format: "json",
+// "yaml" or "table".
+func NewPatchFormatter(format string) (PatchFormatter, error) {
+	switch format {
+	case "json":
+		return JSONPatchFormatter{}, nil
+	case "yaml":
+		return YAMLPatchFormatter{}, nil
+	case "table":
+		return TablePatchFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, must be json, yaml or table", format)
+}
+
+// JSONPatchFormatter prints the patch as indented JSON.
+type JSONPatchFormatter struct{}
+
+func (JSONPatchFormatter) Format(w io.Writer, patch *DryRunPatch) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, patch.Data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// YAMLPatchFormatter prints the patch as YAML.
+type YAMLPatchFormatter struct{}
+
+func (YAMLPatchFormatter) Format(w io.Writer, patch *DryRunPatch) error {
+	data, err := yaml.JSONToYAML(patch.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// TablePatchFormatter prints the change to each resource of each container,
+// rather than the patch itself.
+type TablePatchFormatter struct{}
+
+func (TablePatchFormatter) Format(w io.Writer, patch *DryRunPatch) error {
+	fmt.Fprintf(w, "%s:\n", patch.Target)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tRESOURCE\tCURRENT\tRECOMMENDED\tCHANGE")
+	ctrs := []string{}
+	for ctr := range patch.Recommended {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	for _, ctr := range ctrs {
+		writeRows(tw, ctr, "requests", patch.Current[ctr].Requests, patch.Recommended[ctr].Requests)
+		writeRows(tw, ctr, "limits", patch.Current[ctr].Limits, patch.Recommended[ctr].Limits)
+	}
+	return tw.Flush()
+}
+
+func writeRows(w io.Writer, ctr, kind string, current, recommended apiv1.ResourceList) {
+	names := []string{}
+	for res := range recommended {
+		names = append(names, string(res))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res := apiv1.ResourceName(name)
+		rec := recommended[res]
+		cur, found := current[res]
+		fmt.Fprintf(w, "%s\t%s[%s]\t%s\t%s\t%s\n", ctr, kind, res,
+			quantityOrNone(cur, found), rec.String(), changePercent(cur, rec, found))
+	}
+}
+
+func quantityOrNone(q resource.Quantity, found bool) string {
+	if !found {
+		return "<none>"
+	}
+	return q.String()
+}
+
+// changePercent formats the relative change from cur to rec, e.g. "+25.0%".
+func changePercent(cur, rec resource.Quantity, found bool) string {
+	if !found || cur.MilliValue() == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", float64(rec.MilliValue()-cur.MilliValue())*100/float64(cur.MilliValue()))
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"bytes"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPatchFormatters(t *testing.T) {
+	patch := &DryRunPatch{
+		Target:    "Deployment default/thing",
+		PatchType: types.StrategicMergePatchType,
+		Data:      []byte(`{"spec":{"template":{"spec":{"containers":[{"name":"thing","resources":{"requests":{"cpu":"125m"}}}]}}}}`),
+		Current: map[string]apiv1.ResourceRequirements{
+			"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+		},
+		Recommended: map[string]apiv1.ResourceRequirements{
+			"thing": {
+				Requests: apiv1.ResourceList{
+					apiv1.ResourceCPU:    resource.MustParse("125m"),
+					apiv1.ResourceMemory: resource.MustParse("64Mi"),
+				},
+			},
+		},
+	}
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{"json", `{
+  "spec": {
+    "template": {
+      "spec": {
+        "containers": [
+          {
+            "name": "thing",
+            "resources": {
+              "requests": {
+                "cpu": "125m"
+              }
+            }
+          }
+        ]
+      }
+    }
+  }
+}
+`},
+		{"yaml", `spec:
+  template:
+    spec:
+      containers:
+      - name: thing
+        resources:
+          requests:
+            cpu: 125m
+`},
+		{"table", `Deployment default/thing:
+CONTAINER  RESOURCE          CURRENT  RECOMMENDED  CHANGE
+thing      requests[cpu]     100m     125m         +25.0%
+thing      requests[memory]  <none>   64Mi         n/a
+`},
+	}
+	for _, tc := range testCases {
+		f, err := NewPatchFormatter(tc.format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.format, err)
+		}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, patch); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.format, err)
+		}
+		if buf.String() != tc.expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", tc.format, tc.expected, buf.String())
+		}
+	}
+
+	if _, err := NewPatchFormatter("xml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/golang/glog"
+)
+
+// patchStrategy is how the containers of the target are patched.
+type patchStrategy int
+
+const (
+	// Strategic merge, which relies on containers being merged by name.
+	strategicMergeByName patchStrategy = iota
+	// JSON patch, addressing each container by its index.
+	jsonPatchByIndex
+)
+
+func (ps patchStrategy) String() string {
+	switch ps {
+	case strategicMergeByName:
+		return "strategic-merge"
+	case jsonPatchByIndex:
+		return "json-patch"
+	}
+	return fmt.Sprintf("patchStrategy(%d)", int(ps))
+}
+
+// openAPISchema holds the parts of an OpenAPI v2 schema that we read.
+type openAPISchema struct {
+	Ref           string                    `json:"$ref"`
+	Properties    map[string]*openAPISchema `json:"properties"`
+	PatchMergeKey string                    `json:"x-kubernetes-patch-merge-key"`
+	GVKs          []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+type openAPIDocument struct {
+	Definitions map[string]*openAPISchema `json:"definitions"`
+}
+
+// getOpenAPIDocument fetches the OpenAPI schema of the client's apiserver.
+// It is large, so it is not kept once the patch strategy was chosen.
+func getOpenAPIDocument(ctx context.Context, client kubernetes.Interface) (*openAPIDocument, error) {
+	data, err := client.Discovery().RESTClient().Get().
+		AbsPath("/openapi/v2").
+		SetHeader("Accept", "application/json").
+		Context(ctx).
+		DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("can't read OpenAPI schema: %v", err)
+	}
+	doc := &openAPIDocument{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("can't decode OpenAPI schema: %v", err)
+	}
+	return doc, nil
+}
+
+// choosePatchStrategy looks up the target kind in the apiserver's OpenAPI
+// schema.  If the pod template's container list has no merge key, a strategic
+// merge patch would replace the whole list, so the containers are patched by
+// index instead.  If the schema can't be read, strategic merge is assumed,
+// since that is right for all of the built-in kinds.
+func choosePatchStrategy(ctx context.Context, client kubernetes.Interface, tgt *targetSpec) patchStrategy {
+	doc, err := getOpenAPIDocument(ctx, client)
+	if err != nil {
+		glog.Warningf("Using %s patches for %s: %v", strategicMergeByName, tgt.Kind, err)
+		return strategicMergeByName
+	}
+
+	key, err := doc.containersMergeKey(tgt.GroupVersion, tgt.Kind, tgt.containerPath)
+	if err != nil {
+		glog.Warningf("Using %s patches for %s: %v", strategicMergeByName, tgt.Kind, err)
+		return strategicMergeByName
+	}
+	if key != "name" {
+		glog.V(0).Infof("Using %s patches for %s: containers have merge key %q, not \"name\"", jsonPatchByIndex, tgt.Kind, key)
+		return jsonPatchByIndex
+	}
+	glog.V(4).Infof("Using %s patches for %s: containers are merged by name", strategicMergeByName, tgt.Kind)
+	return strategicMergeByName
+}
+
+// containersMergeKey returns the patch merge key of the containers at path in
+// the given kind.
+func (doc *openAPIDocument) containersMergeKey(groupVersion, kind string, path ContainerPath) (string, error) {
+	group, version := "", groupVersion
+	if i := strings.Index(groupVersion, "/"); i >= 0 {
+		group, version = groupVersion[:i], groupVersion[i+1:]
+	}
+	var schema *openAPISchema
+	for _, def := range doc.Definitions {
+		for _, gvk := range def.GVKs {
+			if gvk.Group == group && gvk.Version == version && gvk.Kind == kind {
+				schema = def
+			}
+		}
+	}
+	if schema == nil {
+		return "", fmt.Errorf("no OpenAPI definition for %s %s", groupVersion, kind)
+	}
+
+	for _, field := range path.fields() {
+		schema = doc.resolve(schema)
+		if schema == nil || schema.Properties[field] == nil {
+			return "", fmt.Errorf("no OpenAPI definition for %s field %q", kind, field)
+		}
+		schema = schema.Properties[field]
+	}
+	return schema.PatchMergeKey, nil
+}
+
+// resolve follows $ref links to definitions.
+func (doc *openAPIDocument) resolve(schema *openAPISchema) *openAPISchema {
+	for i := 0; schema != nil && schema.Ref != "" && i < 10; i++ {
+		schema = doc.Definitions[strings.TrimPrefix(schema.Ref, "#/definitions/")]
+	}
+	return schema
+}
+
+// jsonPatchContainers builds a JSON patch which sets the resources of each
+// container at its index in the target's current container list, at path.
+// Each index is first tested to still hold the container of that name, so
+// that the patch fails rather than changes another container if the list
+// changed since it was read.
+func jsonPatchContainers(current []apiv1.Container, resources map[string]apiv1.ResourceRequirements, path ContainerPath) (types.PatchType, []byte, error) {
+	ops := []interface{}{}
+	for i, ctr := range current {
+		res, found := resources[ctr.Name]
+		if !found {
+			continue
+		}
+		ops = append(ops, map[string]interface{}{
+			"op":    "test",
+			"path":  fmt.Sprintf("%s/%d/name", path.Pointer(), i),
+			"value": ctr.Name,
+		})
+		ops = append(ops, map[string]interface{}{
+			"op":    "add",
+			"path":  fmt.Sprintf("%s/%d/resources", path.Pointer(), i),
+			"value": res,
+		})
+	}
+	jb, err := json.Marshal(ops)
+	return types.JSONPatchType, jb, err
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+const testOpenAPIDoc = `
+{
+  "definitions": {
+    "io.k8s.api.apps.v1.Deployment": {
+      "properties": {"spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}},
+      "x-kubernetes-group-version-kind": [{"group": "apps", "kind": "Deployment", "version": "v1"}]
+    },
+    "io.k8s.api.apps.v1.DeploymentSpec": {
+      "properties": {"template": {"$ref": "#/definitions/io.k8s.api.core.v1.PodTemplateSpec"}}
+    },
+    "io.k8s.api.core.v1.PodTemplateSpec": {
+      "properties": {"spec": {"$ref": "#/definitions/io.k8s.api.core.v1.PodSpec"}}
+    },
+    "io.k8s.api.core.v1.PodSpec": {
+      "properties": {"containers": {"type": "array", "x-kubernetes-patch-merge-key": "name"}}
+    },
+    "com.example.v1.Thing": {
+      "properties": {
+        "spec": {
+          "properties": {
+            "template": {
+              "properties": {
+                "spec": {
+                  "properties": {"containers": {"type": "array"}}
+                }
+              }
+            }
+          }
+        }
+      },
+      "x-kubernetes-group-version-kind": [{"group": "example.com", "kind": "Thing", "version": "v1"}]
+    }
+  }
+}
+`
+
+func TestContainersMergeKey(t *testing.T) {
+	doc := &openAPIDocument{}
+	if err := json.Unmarshal([]byte(testOpenAPIDoc), doc); err != nil {
+		t.Fatalf("unexpected decoding error: %v", err)
+	}
+
+	testCases := []struct {
+		groupVersion string
+		kind         string
+		expKey       string
+		expError     bool
+	}{
+		{"apps/v1", "Deployment", "name", false},
+		{"example.com/v1", "Thing", "", false},
+		{"apps/v1", "DaemonSet", "", true},
+	}
+	for _, tc := range testCases {
+		key, err := doc.containersMergeKey(tc.groupVersion, tc.kind, nil)
+		if err != nil && !tc.expError {
+			t.Errorf("%s %s: unexpected error: %v", tc.groupVersion, tc.kind, err)
+			continue
+		} else if err == nil && tc.expError {
+			t.Errorf("%s %s: expected error, got none", tc.groupVersion, tc.kind)
+			continue
+		}
+		if key != tc.expKey {
+			t.Errorf("%s %s: expected key %q, got %q", tc.groupVersion, tc.kind, tc.expKey, key)
+		}
+	}
+}
+
+func TestChoosePatchStrategy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/openapi/v2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testOpenAPIDoc))
+	}))
+	defer server.Close()
+
+	client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+	testCases := []struct {
+		tgt         *targetSpec
+		expStrategy patchStrategy
+	}{
+		{&targetSpec{Kind: "Deployment", GroupVersion: "apps/v1"}, strategicMergeByName},
+		{&targetSpec{Kind: "Thing", GroupVersion: "example.com/v1"}, jsonPatchByIndex},
+	}
+	for _, tc := range testCases {
+		if strategy := choosePatchStrategy(context.Background(), client, tc.tgt); strategy != tc.expStrategy {
+			t.Errorf("%s %s: expected %s, got %s", tc.tgt.GroupVersion, tc.tgt.Kind, tc.expStrategy, strategy)
+		}
+	}
+}
+
+func TestJSONPatchContainers(t *testing.T) {
+	current := []apiv1.Container{{Name: "sidecar"}, {Name: "app"}}
+	resources := map[string]apiv1.ResourceRequirements{
+		"app": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+	}
+	_, jb, err := jsonPatchContainers(current, resources, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := `[{"op":"test","path":"/spec/template/spec/containers/1/name","value":"app"},{"op":"add","path":"/spec/template/spec/containers/1/resources","value":{"requests":{"cpu":"100m"}}}]`
+	if string(jb) != exp {
+		t.Errorf("expected %s, got %s", exp, string(jb))
+	}
+}
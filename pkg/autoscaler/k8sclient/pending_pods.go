@@ -0,0 +1,70 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// PendingPodsProvider counts the pods of the target which are in the Pending
+// phase, e.g. because they don't fit on any node.
+type PendingPodsProvider struct {
+	clientset kubernetes.Interface
+	target    *targetSpec
+}
+
+// Count returns the number of the target's pods which are Pending.
+func (p *PendingPodsProvider) Count(ctx context.Context) (int, error) {
+	obj, err := p.target.Get(p.clientset)
+	if err != nil {
+		return 0, fmt.Errorf("can't get target: %v", err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+	if err != nil {
+		return 0, fmt.Errorf("invalid target selector: %v", err)
+	}
+
+	opt := metav1.ListOptions{LabelSelector: selector.String()}
+	pods := &apiv1.PodList{}
+	err = p.clientset.CoreV1().RESTClient().Get().
+		Namespace(p.target.Namespace).
+		Resource("pods").
+		VersionedParams(&opt, scheme.ParameterCodec).
+		Context(ctx).
+		Do().
+		Into(pods)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pods of the target: %v", err)
+	}
+	return countPending(pods.Items), nil
+}
+
+func countPending(pods []apiv1.Pod) int {
+	count := 0
+	for i := range pods {
+		if pods[i].Status.Phase == apiv1.PodPending && pods[i].DeletionTimestamp == nil {
+			count++
+		}
+	}
+	return count
+}
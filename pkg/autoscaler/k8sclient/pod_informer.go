@@ -0,0 +1,78 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// activePodsFieldSelector leaves out the pods which have finished: they
+// don't hold their requests any more, and aren't ready.
+const activePodsFieldSelector = "status.phase!=Succeeded,status.phase!=Failed"
+
+// podCacheSyncTimeout is how long a measurement waits for the first list of
+// the pods.
+const podCacheSyncTimeout = time.Minute
+
+// podInformer keeps the active pods in a cache, which a watch keeps up to
+// date, so that polls read them without listing them from the API server.
+type podInformer struct {
+	informer cache.SharedIndexInformer
+	lister   corelisters.PodLister
+}
+
+// newPodInformer starts an informer of the active pods of namespace, or of
+// all namespaces if it is empty, which runs until ctx is cancelled.
+func newPodInformer(ctx context.Context, clientset kubernetes.Interface, namespace string) *podInformer {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = activePodsFieldSelector
+		}))
+	pods := factory.Core().V1().Pods()
+	p := &podInformer{informer: pods.Informer(), lister: pods.Lister()}
+	factory.Start(ctx.Done())
+	return p
+}
+
+// list returns the cached pods of namespace, or of all namespaces if it is
+// empty, which match selector.  Until the first list of the pods is in, it
+// waits for up to podCacheSyncTimeout.
+func (p *podInformer) list(ctx context.Context, namespace string, selector labels.Selector) ([]*apiv1.Pod, error) {
+	ctx, cancel := context.WithTimeout(ctx, podCacheSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), p.informer.HasSynced) {
+		return nil, fmt.Errorf("failed to list pods: the pod cache isn't synced: %v", ctx.Err())
+	}
+	if selector == nil {
+		selector = labels.Everything()
+	}
+	if namespace == "" {
+		return p.lister.List(selector)
+	}
+	return p.lister.Pods(namespace).List(selector)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// QuantityPrecision is the unit, by resource, in which quantities are written
+// to the target, e.g. "1m" for whole millicores or "1Mi" for whole mebibytes.
+// It only changes how the computed resources are written, not how they are
+// computed: a quantity is rounded up to a whole number of units, and written
+// in the unit's format.  Resources without a unit are written as computed.
+type QuantityPrecision map[apiv1.ResourceName]resource.Quantity
+
+// ParseQuantityPrecision parses a comma-separated list of RESOURCE=UNIT, e.g.
+// "cpu=1m,memory=1Mi".  CPU units must be whole millicores in decimal, and
+// memory and ephemeral-storage units whole bytes.
+func ParseQuantityPrecision(s string) (QuantityPrecision, error) {
+	if s == "" {
+		return nil, nil
+	}
+	p := QuantityPrecision{}
+	for _, entry := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("precision %q must be RESOURCE=UNIT", entry)
+		}
+		res := apiv1.ResourceName(kv[0])
+		if _, found := p[res]; found {
+			return nil, fmt.Errorf("precision of %s given twice", res)
+		}
+		unit, err := resource.ParseQuantity(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid precision of %s %q: %v", res, kv[1], err)
+		}
+		if err := validatePrecision(res, unit); err != nil {
+			return nil, err
+		}
+		p[res] = unit
+	}
+	return p, nil
+}
+
+// validatePrecision checks that unit is a sensible unit of res.
+func validatePrecision(res apiv1.ResourceName, unit resource.Quantity) error {
+	if unit.Sign() <= 0 {
+		return fmt.Errorf("precision of %s must be positive, got %q", res, unit.String())
+	}
+	switch res {
+	case apiv1.ResourceCPU:
+		if unit.Format == resource.BinarySI {
+			return fmt.Errorf("precision of cpu must be a decimal quantity, e.g. \"1m\", got %q", unit.String())
+		}
+		if unit.Cmp(*resource.NewMilliQuantity(unit.MilliValue(), unit.Format)) != 0 {
+			return fmt.Errorf("precision of cpu must be a whole number of millicores, got %q", unit.String())
+		}
+	case apiv1.ResourceMemory, apiv1.ResourceEphemeralStorage:
+		if unit.MilliValue()%1000 != 0 {
+			return fmt.Errorf("precision of %s must be a whole number of bytes, got %q", res, unit.String())
+		}
+	default:
+		return fmt.Errorf("precision of %s is not supported, only of cpu, memory and ephemeral-storage", res)
+	}
+	return nil
+}
+
+// Apply returns a copy of resources with every quantity in the precision of
+// its resource.
+func (p QuantityPrecision) Apply(resources map[string]apiv1.ResourceRequirements) map[string]apiv1.ResourceRequirements {
+	if len(p) == 0 {
+		return resources
+	}
+	out := map[string]apiv1.ResourceRequirements{}
+	for ctr, reqs := range resources {
+		out[ctr] = apiv1.ResourceRequirements{
+			Requests: p.applyList(reqs.Requests),
+			Limits:   p.applyList(reqs.Limits),
+		}
+	}
+	return out
+}
+
+func (p QuantityPrecision) applyList(list apiv1.ResourceList) apiv1.ResourceList {
+	if list == nil {
+		return nil
+	}
+	out := apiv1.ResourceList{}
+	for res, q := range list {
+		if unit, found := p[res]; found {
+			q = roundUpToUnit(q, unit, precisionScale(res))
+		}
+		out[res] = q
+	}
+	return out
+}
+
+// precisionScale is the scale in which the quantities of res are rounded:
+// millicores for cpu, and bytes otherwise.
+func precisionScale(res apiv1.ResourceName) resource.Scale {
+	if res == apiv1.ResourceCPU {
+		return resource.Milli
+	}
+	return 0
+}
+
+// roundUpToUnit rounds q up to a whole number of units, at scale, and gives it
+// the unit's format.
+func roundUpToUnit(q, unit resource.Quantity, scale resource.Scale) resource.Quantity {
+	// ScaledValue rounds up, so that nothing is under-provisioned.
+	v, u := q.ScaledValue(scale), unit.ScaledValue(scale)
+	if rem := v % u; rem > 0 {
+		v += u - rem
+	}
+	rounded := resource.NewScaledQuantity(v, scale)
+	rounded.Format = unit.Format
+	return *rounded
+}
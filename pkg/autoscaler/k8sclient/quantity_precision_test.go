@@ -0,0 +1,110 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseQuantityPrecision(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expError bool
+	}{
+		{"", false},
+		{"cpu=1m", false},
+		{"cpu=10m,memory=1Mi", false},
+		{"cpu=1, memory=1M, ephemeral-storage=1Gi", false},
+		{"cpu", true},
+		{"cpu=fast", true},
+		{"cpu=0", true},
+		{"cpu=-1m", true},
+		{"cpu=1Ki", true},
+		{"cpu=100u", true},
+		{"memory=1m", true},
+		{"memory=1.5", true},
+		{"nvidia.com/gpu=1", true},
+		{"cpu=1m,cpu=10m", true},
+	}
+	for _, tc := range testCases {
+		_, err := ParseQuantityPrecision(tc.value)
+		if tc.expError && err == nil {
+			t.Errorf("%q: expected an error", tc.value)
+		}
+		if !tc.expError && err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.value, err)
+		}
+	}
+}
+
+func TestQuantityPrecisionApply(t *testing.T) {
+	computed := func() map[string]apiv1.ResourceRequirements {
+		// As the computation can leave them, e.g. from a base in one
+		// format and steps in another.
+		cpu := resource.MustParse("123456u")
+		memory := resource.MustParse("100M")
+		memory.Add(resource.MustParse("1Mi"))
+		storage := resource.MustParse("1536Mi")
+		return map[string]apiv1.ResourceRequirements{
+			"foo": {
+				Requests: apiv1.ResourceList{
+					apiv1.ResourceCPU:              cpu,
+					apiv1.ResourceMemory:           memory,
+					apiv1.ResourceEphemeralStorage: storage,
+				},
+				Limits: apiv1.ResourceList{
+					apiv1.ResourceMemory: resource.MustParse("2G"),
+				},
+			},
+		}
+	}
+	testCases := []struct {
+		precision string
+		expected  string
+	}{
+		{"", `{"limits":{"memory":"2G"},"requests":{"cpu":"123456u","ephemeral-storage":"1536Mi","memory":"101048576"}}`},
+		{"cpu=1m", `{"limits":{"memory":"2G"},"requests":{"cpu":"124m","ephemeral-storage":"1536Mi","memory":"101048576"}}`},
+		{"cpu=100m", `{"limits":{"memory":"2G"},"requests":{"cpu":"200m","ephemeral-storage":"1536Mi","memory":"101048576"}}`},
+		{"cpu=1", `{"limits":{"memory":"2G"},"requests":{"cpu":"1","ephemeral-storage":"1536Mi","memory":"101048576"}}`},
+		{"memory=1Mi", `{"limits":{"memory":"1908Mi"},"requests":{"cpu":"123456u","ephemeral-storage":"1536Mi","memory":"97Mi"}}`},
+		{"memory=1M", `{"limits":{"memory":"2G"},"requests":{"cpu":"123456u","ephemeral-storage":"1536Mi","memory":"102M"}}`},
+		{"memory=1Gi,ephemeral-storage=1Gi", `{"limits":{"memory":"2Gi"},"requests":{"cpu":"123456u","ephemeral-storage":"2Gi","memory":"1Gi"}}`},
+	}
+	for _, tc := range testCases {
+		precision, err := ParseQuantityPrecision(tc.precision)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.precision, err)
+		}
+		resources := computed()
+		out := precision.Apply(resources)
+		data, err := json.Marshal(out["foo"])
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.precision, err)
+		}
+		if string(data) != tc.expected {
+			t.Errorf("%q: expected %s, got %s", tc.precision, tc.expected, data)
+		}
+		// The computed resources are left alone.
+		if data, _ := json.Marshal(resources["foo"]); string(data) != testCases[0].expected {
+			t.Errorf("%q: the computed resources changed to %s", tc.precision, data)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// replicaSetHashPrefix starts the name of a target which selects a
+// ReplicaSet by its pod-template-hash label instead of by its name, e.g.
+// "replicaset/pod-template-hash=5d4f8c7b9".
+const replicaSetHashPrefix = "pod-template-hash="
+
+// IsReplicaSetByHash returns whether target selects a ReplicaSet by its
+// pod-template-hash label.
+func IsReplicaSetByHash(target string) bool {
+	kind, name, err := parseTarget(target)
+	return err == nil && strings.ToLower(kind) == "replicaset" && strings.HasPrefix(name, replicaSetHashPrefix)
+}
+
+// resolveReplicaSetByHash returns the target of the one ReplicaSet in
+// namespace whose pod-template-hash label has the value in target, by name.
+// The Deployment which owns it, if any, may revert its resources at any time,
+// which is only logged, as it is the point of experimenting with a single
+// generation.
+func resolveReplicaSetByHash(client kubernetes.Interface, target, namespace string) (string, error) {
+	_, name, err := parseTarget(target)
+	if err != nil {
+		return "", err
+	}
+	hash := strings.TrimPrefix(name, replicaSetHashPrefix)
+	if errs := validation.IsValidLabelValue(hash); len(errs) > 0 || hash == "" {
+		return "", fmt.Errorf("invalid pod-template-hash %q: %s", hash, strings.Join(errs, "; "))
+	}
+	selector := labels.SelectorFromSet(labels.Set{"pod-template-hash": hash})
+	list, err := client.AppsV1().ReplicaSets(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return "", fmt.Errorf("can't list the ReplicaSets in namespace %s: %v", namespace, err)
+	}
+	switch len(list.Items) {
+	case 0:
+		return "", fmt.Errorf("no ReplicaSet in namespace %s has pod-template-hash %s", namespace, hash)
+	case 1:
+	default:
+		names := []string{}
+		for _, rs := range list.Items {
+			names = append(names, rs.Name)
+		}
+		return "", fmt.Errorf("%d ReplicaSets in namespace %s have pod-template-hash %s: %s", len(names), namespace, hash, strings.Join(names, ", "))
+	}
+	rs := list.Items[0]
+	if owner := metav1.GetControllerOf(&rs); owner != nil {
+		glog.Warningf("Targeting ReplicaSet %s/%s by pod-template-hash %s. It is owned by %s %s, which may overwrite its resources at any time, and won't roll out this autoscaler's changes. This is for experiments only.",
+			namespace, rs.Name, hash, owner.Kind, owner.Name)
+	} else {
+		glog.Warningf("Targeting ReplicaSet %s/%s by pod-template-hash %s. This is for experiments only.", namespace, rs.Name, hash)
+	}
+	return "replicaset/" + rs.Name, nil
+}
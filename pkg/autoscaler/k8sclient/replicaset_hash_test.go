@@ -0,0 +1,122 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestIsReplicaSetByHash(t *testing.T) {
+	testCases := []struct {
+		target   string
+		expected bool
+	}{
+		{"replicaset/pod-template-hash=5d4f8c7b9", true},
+		{"ReplicaSet/pod-template-hash=5d4f8c7b9", true},
+		{"replicaset/thing-5d4f8c7b9", false},
+		{"deployment/pod-template-hash=5d4f8c7b9", false},
+		{"replicaset", false},
+	}
+	for _, tc := range testCases {
+		if got := IsReplicaSetByHash(tc.target); got != tc.expected {
+			t.Errorf("%q: expected %v, got %v", tc.target, tc.expected, got)
+		}
+	}
+}
+
+func TestResolveReplicaSetByHash(t *testing.T) {
+	isController := true
+	replicaSet := func(name, hash string) appsv1.ReplicaSet {
+		return appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"app": "thing", "pod-template-hash": hash},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "thing", Controller: &isController},
+			},
+		}}
+	}
+	replicaSets := []appsv1.ReplicaSet{
+		replicaSet("thing-5d4f8c7b9", "5d4f8c7b9"),
+		replicaSet("thing-7c9d6b5f4", "7c9d6b5f4"),
+		// Only possible if the label was set by hand.
+		replicaSet("copy-1", "6f8b9c7d5"),
+		replicaSet("copy-2", "6f8b9c7d5"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/apis/apps/v1/namespaces/default/replicasets" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		selector, err := labels.Parse(req.URL.Query().Get("labelSelector"))
+		if err != nil {
+			t.Fatalf("invalid label selector: %v", err)
+		}
+		list := &appsv1.ReplicaSetList{}
+		for _, rs := range replicaSets {
+			if selector.Matches(labels.Set(rs.Labels)) {
+				list.Items = append(list.Items, rs)
+			}
+		}
+		output, err := json.Marshal(list)
+		if err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(output)
+	}))
+	defer server.Close()
+	client := clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})
+
+	testCases := []struct {
+		target    string
+		expTarget string
+		expError  bool
+	}{
+		{"replicaset/pod-template-hash=7c9d6b5f4", "replicaset/thing-7c9d6b5f4", false},
+		{"replicaset/pod-template-hash=5d4f8c7b9", "replicaset/thing-5d4f8c7b9", false},
+		{"replicaset/pod-template-hash=0000000", "", true},
+		{"replicaset/pod-template-hash=6f8b9c7d5", "", true},
+		{"replicaset/pod-template-hash=", "", true},
+		{"replicaset/pod-template-hash=a,app=thing", "", true},
+	}
+	for _, tc := range testCases {
+		target, err := resolveReplicaSetByHash(client, tc.target, "default")
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", tc.target, target)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.target, err)
+			continue
+		}
+		if target != tc.expTarget {
+			t.Errorf("%s: expected %s, got %s", tc.target, tc.expTarget, target)
+		}
+	}
+}
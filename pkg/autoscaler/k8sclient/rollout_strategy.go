@@ -0,0 +1,242 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// OriginalRollingUpdateAnnotation holds the rolling update parameters which a
+// Deployment had before an update overrode them, as JSON, until they are
+// restored.
+const OriginalRollingUpdateAnnotation = "cpva.kubernetes.io/original-rolling-update"
+
+// RolloutOverride sets the rolling update parameters of a Deployment in the
+// same patch as its resources, so that the restart which the new resources
+// cause rolls out at that pace.
+type RolloutOverride struct {
+	// Either may be nil to leave it as it is.
+	MaxUnavailable *intstr.IntOrString
+	MaxSurge       *intstr.IntOrString
+	// If set, the previous parameters are saved in the
+	// OriginalRollingUpdateAnnotation, and put back once the rollout is
+	// complete.
+	Restore bool
+}
+
+// ParseRolloutOverride parses the parameters, each a number of pods or a
+// percentage such as "25%", or "" to leave it as it is.  It returns nil if
+// both are "".
+func ParseRolloutOverride(maxUnavailable, maxSurge string, restore bool) (*RolloutOverride, error) {
+	if maxUnavailable == "" && maxSurge == "" {
+		return nil, nil
+	}
+	o := &RolloutOverride{Restore: restore}
+	var err error
+	if o.MaxUnavailable, err = parseIntOrPercent(maxUnavailable); err != nil {
+		return nil, fmt.Errorf("invalid maxUnavailable: %v", err)
+	}
+	if o.MaxSurge, err = parseIntOrPercent(maxSurge); err != nil {
+		return nil, fmt.Errorf("invalid maxSurge: %v", err)
+	}
+	return o, nil
+}
+
+func parseIntOrPercent(s string) (*intstr.IntOrString, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v := intstr.Parse(s)
+	if v.Type == intstr.Int {
+		if v.IntVal < 0 {
+			return nil, fmt.Errorf("%q is negative", s)
+		}
+		return &v, nil
+	}
+	var n int
+	if !strings.HasSuffix(s, "%") {
+		return nil, fmt.Errorf("%q is neither a number nor a percentage", s)
+	}
+	if _, err := fmt.Sscanf(s, "%d%%", &n); err != nil || n < 0 || fmt.Sprintf("%d%%", n) != s {
+		return nil, fmt.Errorf("%q is not a valid percentage", s)
+	}
+	return &v, nil
+}
+
+// applies returns whether the override can be applied to obj, which must be
+// a Deployment with the RollingUpdate strategy.
+func (o *RolloutOverride) applies(kind string, obj *targetObject) bool {
+	if !strings.EqualFold(kind, "deployment") {
+		glog.V(2).Infof("Not overriding the rolling update parameters of a %s, only Deployments have them", kind)
+		return false
+	}
+	strategy := obj.Spec.Strategy
+	if strategy == nil || strategy.Type == appsv1.RecreateDeploymentStrategyType || strategy.RollingUpdate == nil {
+		glog.Warningf("Not overriding the rolling update parameters of %s, it doesn't use the RollingUpdate strategy", obj.Name)
+		return false
+	}
+	return true
+}
+
+// rollingUpdate returns the parameters with the override applied to current.
+func (o *RolloutOverride) rollingUpdate(current *appsv1.RollingUpdateDeployment) *appsv1.RollingUpdateDeployment {
+	out := current.DeepCopy()
+	if o.MaxUnavailable != nil {
+		out.MaxUnavailable = o.MaxUnavailable
+	}
+	if o.MaxSurge != nil {
+		out.MaxSurge = o.MaxSurge
+	}
+	return out
+}
+
+// addRolloutOverride adds the override to a patch of obj's containers, and
+// if the parameters are to be restored and haven't been saved yet, saves them
+// in the OriginalRollingUpdateAnnotation.  While an earlier override hasn't
+// been restored, the parameters from before it are kept.
+func (o *RolloutOverride) addRolloutOverride(pt types.PatchType, data []byte, obj *targetObject) ([]byte, error) {
+	rollingUpdate := o.rollingUpdate(obj.Spec.Strategy.RollingUpdate)
+	var original string
+	if _, saved := obj.Annotations[OriginalRollingUpdateAnnotation]; o.Restore && !saved {
+		jb, err := json.Marshal(obj.Spec.Strategy.RollingUpdate)
+		if err != nil {
+			return nil, err
+		}
+		original = string(jb)
+	}
+
+	switch pt {
+	case types.JSONPatchType:
+		ops := []interface{}{}
+		if err := json.Unmarshal(data, &ops); err != nil {
+			return nil, err
+		}
+		ops = append(ops, map[string]interface{}{
+			"op":    "add",
+			"path":  "/spec/strategy/rollingUpdate",
+			"value": rollingUpdate,
+		})
+		if original != "" {
+			if obj.Annotations == nil {
+				ops = append(ops, map[string]interface{}{
+					"op":    "add",
+					"path":  "/metadata/annotations",
+					"value": map[string]string{OriginalRollingUpdateAnnotation: original},
+				})
+			} else {
+				ops = append(ops, map[string]interface{}{
+					"op":    "add",
+					"path":  "/metadata/annotations/" + strings.Replace(OriginalRollingUpdateAnnotation, "/", "~1", -1),
+					"value": original,
+				})
+			}
+		}
+		return json.Marshal(ops)
+	case types.StrategicMergePatchType, types.MergePatchType:
+		patch := map[string]interface{}{}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return nil, err
+		}
+		spec, _ := patch["spec"].(map[string]interface{})
+		if spec == nil {
+			spec = map[string]interface{}{}
+			patch["spec"] = spec
+		}
+		spec["strategy"] = map[string]interface{}{"rollingUpdate": rollingUpdate}
+		if original != "" {
+			metadata, _ := patch["metadata"].(map[string]interface{})
+			if metadata == nil {
+				metadata = map[string]interface{}{}
+				patch["metadata"] = metadata
+			}
+			metadata["annotations"] = map[string]string{OriginalRollingUpdateAnnotation: original}
+		}
+		return json.Marshal(patch)
+	}
+	return nil, fmt.Errorf("can't add the rolling update parameters to a %s patch", pt)
+}
+
+// rolloutComplete returns whether all of obj's pods run its current template,
+// and are available, as `kubectl rollout status` decides it.
+func rolloutComplete(obj *targetObject) bool {
+	if obj.Status.ObservedGeneration < obj.Generation {
+		return false
+	}
+	replicas := int32(1)
+	if obj.Spec.Replicas != nil {
+		replicas = *obj.Spec.Replicas
+	}
+	return obj.Status.UpdatedReplicas >= replicas &&
+		obj.Status.Replicas == obj.Status.UpdatedReplicas &&
+		obj.Status.AvailableReplicas >= obj.Status.UpdatedReplicas
+}
+
+// RestoreRolloutStrategy puts back the rolling update parameters saved in the
+// target's OriginalRollingUpdateAnnotation, once the rollout is complete, and
+// removes the annotation.
+func (k *k8sClient) RestoreRolloutStrategy() error {
+	if k.rollout == nil || !k.rollout.Restore || k.dryRun || !strings.EqualFold(k.target.Kind, "deployment") {
+		return nil
+	}
+	obj, err := k.target.Get(k.clientset)
+	if err != nil {
+		return fmt.Errorf("can't get target: %v", err)
+	}
+	saved, found := obj.Annotations[OriginalRollingUpdateAnnotation]
+	if !found {
+		return nil
+	}
+	if !rolloutComplete(obj) {
+		glog.V(4).Infof("Waiting for the rollout of %s to complete before restoring its rolling update parameters", k.target.Name)
+		return nil
+	}
+	original := &appsv1.RollingUpdateDeployment{}
+	if err := json.Unmarshal([]byte(saved), original); err != nil {
+		return fmt.Errorf("invalid %s annotation %q: %v", OriginalRollingUpdateAnnotation, saved, err)
+	}
+	// A merge patch replaces nested maps key by key, so a parameter which
+	// wasn't set before is removed with null.
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{OriginalRollingUpdateAnnotation: nil},
+		},
+		"spec": map[string]interface{}{
+			"strategy": map[string]interface{}{
+				"rollingUpdate": map[string]interface{}{
+					"maxUnavailable": original.MaxUnavailable,
+					"maxSurge":       original.MaxSurge,
+				},
+			},
+		},
+	}
+	jb, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	if err := k.patchTarget(types.MergePatchType, jb); err != nil {
+		return fmt.Errorf("patch failed: %v", err)
+	}
+	glog.V(0).Infof("Restored the rolling update parameters of %s to %s", k.target.Name, saved)
+	return nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestParseRolloutOverride(t *testing.T) {
+	testCases := []struct {
+		maxUnavailable string
+		maxSurge       string
+		expNil         bool
+		expError       bool
+	}{
+		{"", "", true, false},
+		{"0", "", false, false},
+		{"1", "25%", false, false},
+		{"", "100%", false, false},
+		{"-1", "", false, true},
+		{"", "lots", false, true},
+		{"", "1.5%", false, true},
+		{"10%%", "", false, true},
+	}
+	for _, tc := range testCases {
+		o, err := ParseRolloutOverride(tc.maxUnavailable, tc.maxSurge, false)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%q/%q: unexpected error: %v", tc.maxUnavailable, tc.maxSurge, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%q/%q: expected an error", tc.maxUnavailable, tc.maxSurge)
+			continue
+		}
+		if (o == nil) != tc.expNil {
+			t.Errorf("%q/%q: expected nil %v, got %v", tc.maxUnavailable, tc.maxSurge, tc.expNil, o)
+		}
+	}
+}
+
+// rollingDeployment returns a Deployment with the given rolling update
+// parameters and annotations.
+func rollingDeployment(maxUnavailable, maxSurge string, annotations map[string]string) *targetObject {
+	obj := &targetObject{}
+	obj.Name = "thing"
+	obj.Annotations = annotations
+	mu, ms := intstr.Parse(maxUnavailable), intstr.Parse(maxSurge)
+	obj.Spec.Strategy = &appsv1.DeploymentStrategy{
+		Type:          appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxUnavailable: &mu, MaxSurge: &ms},
+	}
+	obj.Spec.Template.Spec.Containers = []apiv1.Container{{Name: "thing"}}
+	return obj
+}
+
+func TestAddRolloutOverride(t *testing.T) {
+	o, err := ParseRolloutOverride("0", "1", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resources := map[string]apiv1.ResourceRequirements{
+		"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+	}
+	k8scli := &k8sClient{target: &targetSpec{Kind: "Deployment", GroupVersion: "apps/v1", Name: "thing"}}
+	smp := func() (types.PatchType, []byte) {
+		pt, jb, err := k8scli.strategicMergeContainers(resources)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return pt, jb
+	}
+	jp := func() (types.PatchType, []byte) {
+		pt, jb, err := jsonPatchContainers([]apiv1.Container{{Name: "thing"}}, resources, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return pt, jb
+	}
+	const saved = `{"maxUnavailable":"25%","maxSurge":"25%"}`
+	const expRollingUpdate = `{"maxSurge":1,"maxUnavailable":0}`
+
+	testCases := []struct {
+		name        string
+		patch       func() (types.PatchType, []byte)
+		obj         *targetObject
+		expOriginal string // The saved annotation, if it is added.
+	}{
+		{"strategic merge", smp, rollingDeployment("25%", "25%", nil), saved},
+		{"strategic merge, already saved", smp, rollingDeployment("0", "1", map[string]string{OriginalRollingUpdateAnnotation: saved}), ""},
+		{"json patch", jp, rollingDeployment("25%", "25%", nil), saved},
+		{"json patch, other annotations", jp, rollingDeployment("25%", "25%", map[string]string{"foo": "bar"}), saved},
+		{"json patch, already saved", jp, rollingDeployment("0", "1", map[string]string{OriginalRollingUpdateAnnotation: saved}), ""},
+	}
+	for _, tc := range testCases {
+		pt, jb := tc.patch()
+		out, err := o.addRolloutOverride(pt, jb, tc.obj)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		// Find the parameters and the annotation in either kind of patch.
+		var rollingUpdate, original interface{}
+		if pt == types.JSONPatchType {
+			ops := []map[string]interface{}{}
+			if err := json.Unmarshal(out, &ops); err != nil {
+				t.Fatalf("%s: invalid patch %s: %v", tc.name, out, err)
+			}
+			if len(ops) < 3 || ops[1]["path"] != "/spec/template/spec/containers/0/resources" {
+				t.Errorf("%s: expected the resources to be patched first, got %s", tc.name, out)
+			}
+			for _, op := range ops {
+				switch op["path"] {
+				case "/spec/strategy/rollingUpdate":
+					rollingUpdate = op["value"]
+				case "/metadata/annotations":
+					original = op["value"].(map[string]interface{})[OriginalRollingUpdateAnnotation]
+				case "/metadata/annotations/cpva.kubernetes.io~1original-rolling-update":
+					original = op["value"]
+				}
+			}
+		} else {
+			patch := struct {
+				Metadata struct {
+					Annotations map[string]string
+				}
+				Spec struct {
+					Template struct {
+						Spec struct {
+							Containers []interface{}
+						}
+					}
+					Strategy struct {
+						RollingUpdate interface{}
+					}
+				}
+			}{}
+			if err := json.Unmarshal(out, &patch); err != nil {
+				t.Fatalf("%s: invalid patch %s: %v", tc.name, out, err)
+			}
+			if len(patch.Spec.Template.Spec.Containers) != 1 {
+				t.Errorf("%s: expected the resources to be patched, got %s", tc.name, out)
+			}
+			rollingUpdate = patch.Spec.Strategy.RollingUpdate
+			if v, found := patch.Metadata.Annotations[OriginalRollingUpdateAnnotation]; found {
+				original = v
+			}
+		}
+		if jb, _ := json.Marshal(rollingUpdate); string(jb) != expRollingUpdate {
+			t.Errorf("%s: expected rollingUpdate %s, got %s", tc.name, expRollingUpdate, jb)
+		}
+		if tc.expOriginal == "" && original != nil {
+			t.Errorf("%s: expected the saved parameters to be kept, got %v", tc.name, original)
+		}
+		if tc.expOriginal != "" && original != tc.expOriginal {
+			t.Errorf("%s: expected %s to be saved, got %v", tc.name, tc.expOriginal, original)
+		}
+	}
+}
+
+func TestRolloutOverrideApplies(t *testing.T) {
+	recreate := rollingDeployment("1", "1", nil)
+	recreate.Spec.Strategy = &appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	testCases := []struct {
+		name string
+		kind string
+		obj  *targetObject
+		exp  bool
+	}{
+		{"rolling deployment", "Deployment", rollingDeployment("1", "1", nil), true},
+		{"recreated deployment", "Deployment", recreate, false},
+		{"daemonset", "DaemonSet", &targetObject{}, false},
+	}
+	o := &RolloutOverride{}
+	for _, tc := range testCases {
+		if got := o.applies(tc.kind, tc.obj); got != tc.exp {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.exp, got)
+		}
+	}
+}
+
+func TestRestoreRolloutStrategy(t *testing.T) {
+	const saved = `{"maxUnavailable":"25%"}`
+	testCases := []struct {
+		name       string
+		annotation string
+		generation int64
+		observed   int64
+		updated    int32
+		available  int32
+		expPatch   string
+	}{
+		{"nothing saved", "", 2, 2, 3, 3, ""},
+		{"not observed yet", saved, 2, 1, 3, 3, ""},
+		{"not all updated", saved, 2, 2, 2, 3, ""},
+		{"not all available", saved, 2, 2, 3, 2, ""},
+		{"complete", saved, 2, 2, 3, 3,
+			`{"metadata":{"annotations":{"cpva.kubernetes.io/original-rolling-update":null}},"spec":{"strategy":{"rollingUpdate":{"maxSurge":null,"maxUnavailable":"25%"}}}}`},
+	}
+	for _, tc := range testCases {
+		var patch, patchType string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/apis/apps/v1/namespaces/default/deployments/thing" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if req.Method == "PATCH" {
+				body, _ := ioutil.ReadAll(req.Body)
+				patch, patchType = string(body), req.Header.Get("Content-Type")
+			}
+			replicas := int32(3)
+			obj := &appsv1.Deployment{}
+			obj.Name = "thing"
+			obj.Generation = tc.generation
+			if tc.annotation != "" {
+				obj.Annotations = map[string]string{OriginalRollingUpdateAnnotation: tc.annotation}
+			}
+			obj.Spec.Replicas = &replicas
+			obj.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: tc.observed,
+				Replicas:           3,
+				UpdatedReplicas:    tc.updated,
+				AvailableReplicas:  tc.available,
+			}
+			output, err := json.Marshal(obj)
+			if err != nil {
+				t.Fatalf("unexpected encoding error: %v", err)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(output)
+		}))
+
+		target, err := newTargetSpec("Deployment", map[string]bool{"apps/v1": true}, "default", "thing")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		k8scli := &k8sClient{
+			clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			target:    target,
+			rollout:   &RolloutOverride{Restore: true},
+		}
+		if err := k8scli.RestoreRolloutStrategy(); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		server.Close()
+		if tc.expPatch == "" {
+			if patch != "" {
+				t.Errorf("%s: expected no patch, got %s", tc.name, patch)
+			}
+			continue
+		}
+		if patchType != string(types.MergePatchType) {
+			t.Errorf("%s: expected a merge patch, got %s", tc.name, patchType)
+		}
+		var got, exp interface{}
+		json.Unmarshal([]byte(patch), &got)
+		json.Unmarshal([]byte(tc.expPatch), &exp)
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s: expected patch %s, got %s", tc.name, tc.expPatch, patch)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/golang/glog"
+)
+
+// SchedulingGate is the scheduling gate which holds the target's pods until
+// their resources have been set.  It goes in the target's pod template, so
+// that every new pod starts with it.
+const SchedulingGate = "cpva.io/resources-not-set"
+
+// GatedPod is a pod of the target which still has the SchedulingGate.
+type GatedPod struct {
+	Namespace string
+	Name      string
+	// The resources of the pod's containers, by name.
+	Resources map[string]apiv1.ResourceRequirements
+}
+
+// gatedPodList is the part of a PodList which ListGatedPods reads.  The
+// vendored API types predate scheduling gates, which are new in Kubernetes
+// 1.26.
+type gatedPodList struct {
+	Items []struct {
+		Metadata struct {
+			Namespace         string       `json:"namespace"`
+			Name              string       `json:"name"`
+			DeletionTimestamp *metav1.Time `json:"deletionTimestamp,omitempty"`
+		} `json:"metadata"`
+		Spec struct {
+			SchedulingGates []struct {
+				Name string `json:"name"`
+			} `json:"schedulingGates,omitempty"`
+			Containers []apiv1.Container `json:"containers"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// ListGatedPods returns the target's pods which have the SchedulingGate.
+// Pods which are being deleted are left out.
+func (k *k8sClient) ListGatedPods(ctx context.Context) ([]GatedPod, error) {
+	obj, err := k.target.Get(k.clientset)
+	if err != nil {
+		return nil, fmt.Errorf("can't get target: %v", err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target selector: %v", err)
+	}
+
+	// As JSON, since protobuf would drop the scheduling gates.
+	opt := metav1.ListOptions{LabelSelector: selector.String()}
+	data, err := k.clientset.CoreV1().RESTClient().Get().
+		Namespace(k.target.Namespace).
+		Resource("pods").
+		VersionedParams(&opt, scheme.ParameterCodec).
+		SetHeader("Accept", "application/json").
+		Context(ctx).
+		DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of the target: %v", err)
+	}
+	return parseGatedPods(data)
+}
+
+func parseGatedPods(data []byte) ([]GatedPod, error) {
+	list := &gatedPodList{}
+	if err := json.Unmarshal(data, list); err != nil {
+		return nil, fmt.Errorf("can't decode pods of the target: %v", err)
+	}
+	gated := []GatedPod{}
+	for _, pod := range list.Items {
+		if pod.Metadata.DeletionTimestamp != nil {
+			continue
+		}
+		for _, gate := range pod.Spec.SchedulingGates {
+			if gate.Name != SchedulingGate {
+				continue
+			}
+			resources := map[string]apiv1.ResourceRequirements{}
+			for _, ctr := range pod.Spec.Containers {
+				resources[ctr.Name] = ctr.Resources
+			}
+			gated = append(gated, GatedPod{
+				Namespace: pod.Metadata.Namespace,
+				Name:      pod.Metadata.Name,
+				Resources: resources,
+			})
+			break
+		}
+	}
+	return gated, nil
+}
+
+// RemoveSchedulingGate removes the SchedulingGate from the pod, so that it
+// can be scheduled.  The pod's other gates are left alone.
+func (k *k8sClient) RemoveSchedulingGate(podName, namespace string) error {
+	if k.dryRun {
+		glog.Infof("Performing dry-run, not removing scheduling gate %s from pod %s/%s.", SchedulingGate, namespace, podName)
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"schedulingGates": []map[string]string{
+				{"$patch": "delete", "name": SchedulingGate},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := k.clientset.CoreV1().Pods(namespace).Patch(podName, types.StrategicMergePatchType, patch); err != nil {
+		return fmt.Errorf("can't remove scheduling gate from pod %s/%s: %v", namespace, podName, err)
+	}
+	return nil
+}
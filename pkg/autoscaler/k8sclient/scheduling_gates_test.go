@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestParseGatedPods(t *testing.T) {
+	data := []byte(`{"items": [
+		{"metadata": {"namespace": "default", "name": "gated"},
+		 "spec": {"schedulingGates": [{"name": "example.com/other"}, {"name": "cpva.io/resources-not-set"}],
+		          "containers": [{"name": "foo", "resources": {"requests": {"cpu": "100m"}}}]}},
+		{"metadata": {"namespace": "default", "name": "other-gate"},
+		 "spec": {"schedulingGates": [{"name": "example.com/other"}],
+		          "containers": [{"name": "foo"}]}},
+		{"metadata": {"namespace": "default", "name": "scheduled"},
+		 "spec": {"containers": [{"name": "foo"}]}},
+		{"metadata": {"namespace": "default", "name": "deleted", "deletionTimestamp": "2026-01-02T03:04:05Z"},
+		 "spec": {"schedulingGates": [{"name": "cpva.io/resources-not-set"}],
+		          "containers": [{"name": "foo"}]}}
+	]}`)
+	pods, err := parseGatedPods(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []GatedPod{{
+		Namespace: "default",
+		Name:      "gated",
+		Resources: map[string]apiv1.ResourceRequirements{
+			"foo": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+		},
+	}}
+	if !reflect.DeepEqual(pods, expected) {
+		t.Errorf("expected %+v, got %+v", expected, pods)
+	}
+
+	if _, err := parseGatedPods([]byte("not json")); err == nil {
+		t.Errorf("expected an error for a malformed list")
+	}
+}
+
+func TestRemoveSchedulingGate(t *testing.T) {
+	var method, path, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		method, path, contentType, body = req.Method, req.URL.Path, req.Header.Get("Content-Type"), string(data)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind": "Pod", "apiVersion": "v1"}`))
+	}))
+	defer server.Close()
+
+	k8scli := &k8sClient{clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL})}
+	if err := k8scli.RemoveSchedulingGate("foo-1", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if method != "PATCH" || path != "/api/v1/namespaces/default/pods/foo-1" {
+		t.Errorf("unexpected request %s %s", method, path)
+	}
+	if contentType != "application/strategic-merge-patch+json" {
+		t.Errorf("unexpected patch type %q", contentType)
+	}
+	expected := `{"spec":{"schedulingGates":[{"$patch":"delete","name":"cpva.io/resources-not-set"}]}}`
+	if body != expected {
+		t.Errorf("expected patch %s, got %s", expected, body)
+	}
+
+	method = ""
+	k8scli.dryRun = true
+	if err := k8scli.RemoveSchedulingGate("foo-2", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if method != "" {
+		t.Errorf("dry-run made a request: %s %s", method, path)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ClusterSizeSnapshot is what the client last measured and patched, for
+// debugging an autoscaler without access to its cluster.
+type ClusterSizeSnapshot struct {
+	// Target is the target, e.g. "Deployment default/foo".
+	Target string
+	// ClusterSize is the last cluster size measured, or nil if none was
+	// yet.
+	ClusterSize *ClusterSize
+	// LastPatch is the last patch which was applied to the target, of
+	// LastPatchType, at LastPatchTime.  It is nil if none was yet.
+	LastPatch     []byte
+	LastPatchType types.PatchType
+	LastPatchTime time.Time
+}
+
+// TakeSnapshot returns what the client last measured and patched.
+func (k *k8sClient) TakeSnapshot() *ClusterSizeSnapshot {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	snapshot := &ClusterSizeSnapshot{
+		LastPatch:     k.lastPatch,
+		LastPatchType: k.lastPatchType,
+		LastPatchTime: k.lastPatchTime,
+	}
+	if k.target != nil {
+		snapshot.Target = fmt.Sprintf("%s %s/%s", k.target.Kind, k.target.Namespace, k.target.Name)
+	}
+	if k.clusterStatus != nil {
+		size := *k.clusterStatus
+		snapshot.ClusterSize = &size
+	}
+	return snapshot
+}
+
+// recordPatch remembers a patch which was applied to the target.
+func (k *k8sClient) recordPatch(pt types.PatchType, data []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.lastPatch, k.lastPatchType, k.lastPatchTime = data, pt, time.Now()
+}
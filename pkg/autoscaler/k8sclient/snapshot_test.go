@@ -0,0 +1,58 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestTakeSnapshot(t *testing.T) {
+	server := newNodeServer(t, []apiv1.Node{nodeWithCPU("2"), nodeWithCPU("4")})
+	defer server.Close()
+	k8scli := &k8sClient{
+		clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+		target:    &targetSpec{Kind: "Deployment", Namespace: "default", Name: "foo"},
+	}
+
+	snapshot := k8scli.TakeSnapshot()
+	if snapshot.Target != "Deployment default/foo" || snapshot.ClusterSize != nil || snapshot.LastPatch != nil || !snapshot.LastPatchTime.IsZero() {
+		t.Errorf("expected an empty snapshot of the target, got %+v", snapshot)
+	}
+
+	if _, err := k8scli.GetClusterSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	k8scli.recordPatch(types.StrategicMergePatchType, []byte(`{"spec":{}}`))
+	snapshot = k8scli.TakeSnapshot()
+	if snapshot.ClusterSize == nil || snapshot.ClusterSize.Nodes != 2 || snapshot.ClusterSize.Cores != 6 {
+		t.Errorf("expected 2 nodes and 6 cores, got %+v", snapshot.ClusterSize)
+	}
+	if string(snapshot.LastPatch) != `{"spec":{}}` || snapshot.LastPatchType != types.StrategicMergePatchType || snapshot.LastPatchTime.IsZero() {
+		t.Errorf("expected the patch, got %q of type %q at %v", snapshot.LastPatch, snapshot.LastPatchType, snapshot.LastPatchTime)
+	}
+
+	// Later measurements don't change a snapshot.
+	snapshot.ClusterSize.Nodes = 100
+	if k8scli.TakeSnapshot().ClusterSize.Nodes != 2 {
+		t.Errorf("the snapshot shares the cluster size of the client")
+	}
+}
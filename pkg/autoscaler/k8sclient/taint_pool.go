@@ -0,0 +1,80 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ParseTaintMatch parses a taint of the form KEY=VALUE:EFFECT, or KEY:EFFECT
+// for one without a value, e.g. "dedicated=gpu:NoSchedule", as in kubectl
+// taint.
+func ParseTaintMatch(s string) (*apiv1.Taint, error) {
+	if s == "" {
+		return nil, nil
+	}
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("taint %q must be KEY=VALUE:EFFECT or KEY:EFFECT", s)
+	}
+	taint := &apiv1.Taint{Effect: apiv1.TaintEffect(s[i+1:])}
+	kv := strings.SplitN(s[:i], "=", 2)
+	taint.Key = kv[0]
+	if len(kv) == 2 {
+		taint.Value = kv[1]
+	}
+	if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid taint key %q: %s", taint.Key, strings.Join(errs, "; "))
+	}
+	if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid taint value %q: %s", taint.Value, strings.Join(errs, "; "))
+	}
+	switch taint.Effect {
+	case apiv1.TaintEffectNoSchedule, apiv1.TaintEffectPreferNoSchedule, apiv1.TaintEffectNoExecute:
+	default:
+		return nil, fmt.Errorf("unknown taint effect %q, must be %s, %s or %s", taint.Effect,
+			apiv1.TaintEffectNoSchedule, apiv1.TaintEffectPreferNoSchedule, apiv1.TaintEffectNoExecute)
+	}
+	return taint, nil
+}
+
+// hasTaint returns whether the node has a taint with the key, value and
+// effect of taint.
+func hasTaint(node *apiv1.Node, taint *apiv1.Taint) bool {
+	for _, t := range node.Spec.Taints {
+		if t.Key == taint.Key && t.Value == taint.Value && t.Effect == taint.Effect {
+			return true
+		}
+	}
+	return false
+}
+
+// countTaintPools returns the number of nodes without and with taint.
+func countTaintPools(nodes []apiv1.Node, taint *apiv1.Taint) (main, tainted int) {
+	for i := range nodes {
+		if hasTaint(&nodes[i], taint) {
+			tainted++
+		} else {
+			main++
+		}
+	}
+	return main, tainted
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestParseTaintMatch(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expTaint *apiv1.Taint
+		expError bool
+	}{
+		{"", nil, false},
+		{"dedicated=gpu:NoSchedule", &apiv1.Taint{Key: "dedicated", Value: "gpu", Effect: apiv1.TaintEffectNoSchedule}, false},
+		{"example.com/spot:PreferNoSchedule", &apiv1.Taint{Key: "example.com/spot", Effect: apiv1.TaintEffectPreferNoSchedule}, false},
+		{"dedicated=:NoExecute", &apiv1.Taint{Key: "dedicated", Effect: apiv1.TaintEffectNoExecute}, false},
+		{"dedicated=gpu", nil, true},
+		{"dedicated=gpu:Never", nil, true},
+		{"=gpu:NoSchedule", nil, true},
+		{"dedicated=g p u:NoSchedule", nil, true},
+	}
+	for _, tc := range testCases {
+		taint, err := ParseTaintMatch(tc.in)
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(taint, tc.expTaint) {
+			t.Errorf("%q: expected %v, got %v", tc.in, tc.expTaint, taint)
+		}
+	}
+}
+
+func TestGetClusterSizeTaintPools(t *testing.T) {
+	withTaints := func(node apiv1.Node, taints ...apiv1.Taint) apiv1.Node {
+		node.Spec.Taints = taints
+		return node
+	}
+	gpu := apiv1.Taint{Key: "dedicated", Value: "gpu", Effect: apiv1.TaintEffectNoSchedule}
+	server := newNodeServer(t, []apiv1.Node{
+		nodeWithCPU("2"),
+		nodeWithCPU("4"),
+		withTaints(nodeWithCPU("8"), gpu),
+		withTaints(nodeWithCPU("8"), apiv1.Taint{Key: "other", Effect: apiv1.TaintEffectNoSchedule}, gpu),
+		// Another value or effect is another taint.
+		withTaints(nodeWithCPU("16"), apiv1.Taint{Key: "dedicated", Value: "db", Effect: apiv1.TaintEffectNoSchedule}),
+		withTaints(nodeWithCPU("16"), apiv1.Taint{Key: "dedicated", Value: "gpu", Effect: apiv1.TaintEffectNoExecute}),
+	})
+	defer server.Close()
+
+	testCases := []struct {
+		name       string
+		taint      *apiv1.Taint
+		expMain    int
+		expTainted int
+	}{
+		{"none", nil, 0, 0},
+		{"gpu", &gpu, 4, 2},
+	}
+	for _, tc := range testCases {
+		k8scli := &k8sClient{
+			clientset: clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+			taintPool: tc.taint,
+		}
+		sz, err := k8scli.GetClusterSize()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sz.MainPoolNodes != tc.expMain || sz.TaintedPoolNodes != tc.expTainted {
+			t.Errorf("%s: expected %d main and %d tainted pool nodes, got %d and %d",
+				tc.name, tc.expMain, tc.expTainted, sz.MainPoolNodes, sz.TaintedPoolNodes)
+		}
+		if sz.Nodes != 6 {
+			t.Errorf("%s: expected 6 nodes, got %d", tc.name, sz.Nodes)
+		}
+	}
+}
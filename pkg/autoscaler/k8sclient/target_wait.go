@@ -0,0 +1,70 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The delays between attempts to find the target while waiting for it to
+// be created.
+const (
+	targetWaitInitialBackoff = time.Second
+	targetWaitMaxBackoff     = 30 * time.Second
+)
+
+// waitForTarget makes the target like makeTarget, and also waits for it to
+// exist, trying again with backoff b until timeout has passed.  This way the
+// autoscaler can start before its target, e.g. when both are installed by
+// the same Helm chart, rather than crash-looping until the target appears.
+// A target which can't be named is not retried, and the patch strategy is
+// only chosen once the target exists.
+func waitForTarget(ctx context.Context, client kubernetes.Interface, target, namespace string, path ContainerPath, timeout time.Duration, b *backoff) (*targetSpec, error) {
+	if _, _, err := parseTarget(target); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		tgt, err := discoverTarget(ctx, client, target, namespace, path)
+		if err == nil {
+			if _, err = tgt.Get(client); err == nil {
+				tgt.strategy = choosePatchStrategy(ctx, client, tgt)
+				return tgt, ctx.Err()
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		delay := b.Step()
+		if remaining := time.Until(deadline); remaining <= 0 {
+			return nil, fmt.Errorf("target %s in namespace %s not found within %v: %v", target, namespace, timeout, err)
+		} else if delay > remaining {
+			delay = remaining
+		}
+		glog.Warningf("Waiting %v for target %s in namespace %s to be created: %v", delay, target, namespace, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -17,24 +17,167 @@ limitations under the License.
 package k8sclient
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 var _ = k8sclient.K8sClient(&MockK8sClient{})
 
 // MockK8sClient implements K8sClientInterface
 type MockK8sClient struct {
-	NumOfNodes int
-	NumOfCores int
+	NumOfNodes        int
+	NumOfCores        int
+	NumOfMatchingPods int
+	NumOfPendingPods  int
+	CPUUtilization    int
+	Memory            resource.Quantity
+	Current           map[string]apiv1.ResourceRequirements
+	Usage             map[string]apiv1.ResourceList
+	// The last target and container path passed to SetTarget.
+	Target        string
+	ContainerPath k8sclient.ContainerPath
+	// Messages of the events recorded by RecordPodEvent.
+	Events []string
+	// If set, GetClusterSize fails with this error.
+	ClusterSizeErr error
+	// If set, UpdateResources fails with this error.
+	UpdateErr error
+	// If set, ValidateContainers fails with this error.
+	ContainersErr error
+	// The resources of every successful UpdateResources.
+	Updates []map[string]apiv1.ResourceRequirements
+	// The pods which ListGatedPods returns.  RemoveSchedulingGate removes
+	// them.
+	GatedPods []k8sclient.GatedPod
+	// The "namespace/name" of the pods passed to RemoveSchedulingGate.
+	Ungated []string
+	// The last environment variables passed to SetContainerEnv.
+	Env map[string][]apiv1.EnvVar
+	// The config which ReadManagedConfig returns, or else
+	// ManagedConfigErr.
+	ManagedConfig    *k8sclient.ManagedConfig
+	ManagedConfigErr error
 }
 
 // GetClusterSize mocks counting schedulable nodes and cores in the cluster
 func (k *MockK8sClient) GetClusterSize() (*k8sclient.ClusterSize, error) {
-	return &k8sclient.ClusterSize{Nodes: k.NumOfNodes, Cores: k.NumOfCores}, nil
+	if k.ClusterSizeErr != nil {
+		return nil, k.ClusterSizeErr
+	}
+	return &k8sclient.ClusterSize{Nodes: k.NumOfNodes, ListedNodes: k.NumOfNodes, Cores: k.NumOfCores, MatchingPods: k.NumOfMatchingPods, PendingPods: k.NumOfPendingPods, Memory: k.Memory, CPUUtilization: k.CPUUtilization}, nil
+}
+
+// GetClusterSizeWithContext mocks counting schedulable nodes and cores in the cluster
+func (k *MockK8sClient) GetClusterSizeWithContext(ctx context.Context) (*k8sclient.ClusterSize, error) {
+	return k.GetClusterSize()
 }
 
 // UpdateResources mocks updating resources needs for containers in the target
 func (k *MockK8sClient) UpdateResources(resources map[string]apiv1.ResourceRequirements) error {
+	if k.UpdateErr != nil {
+		return k.UpdateErr
+	}
+	k.Updates = append(k.Updates, resources)
+	return nil
+}
+
+// GetCurrentResources mocks reading the resources of the containers in the target
+func (k *MockK8sClient) GetCurrentResources() (map[string]apiv1.ResourceRequirements, error) {
+	return k.Current, nil
+}
+
+// GetContainerUsage mocks reading container usage from the metrics API
+func (k *MockK8sClient) GetContainerUsage(ctx context.Context) (map[string]apiv1.ResourceList, error) {
+	if k.Usage == nil {
+		return nil, fmt.Errorf("no metrics")
+	}
+	return k.Usage, nil
+}
+
+// WatchHPAEvents mocks watching for HPA events, and never sees any
+func (k *MockK8sClient) WatchHPAEvents(ctx context.Context, handler func()) error {
+	<-ctx.Done()
+	return nil
+}
+
+// WatchNodes mocks watching the nodes, which never change
+func (k *MockK8sClient) WatchNodes(ctx context.Context, onChange func(*k8sclient.ClusterSize)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// ValidateTarget mocks checking the target, which is always valid
+func (k *MockK8sClient) ValidateTarget() error {
+	return nil
+}
+
+// ValidateContainers mocks validating the containers of the target
+func (k *MockK8sClient) ValidateContainers(containers []string) error {
+	return k.ContainersErr
+}
+
+// DeleteOutdatedPods mocks deleting outdated pods, of which there are none
+func (k *MockK8sClient) DeleteOutdatedPods() error {
 	return nil
 }
+
+// RestoreRolloutStrategy mocks restoring the rolling update parameters, of
+// which there are none
+func (k *MockK8sClient) RestoreRolloutStrategy() error {
+	return nil
+}
+
+// SetTarget mocks switching to another target, which always exists
+func (k *MockK8sClient) SetTarget(target string, path k8sclient.ContainerPath) error {
+	k.Target = target
+	k.ContainerPath = path
+	return nil
+}
+
+// RecordPodEvent mocks creating an event, and remembers its message
+func (k *MockK8sClient) RecordPodEvent(namespace, name, reason, message string) error {
+	k.Events = append(k.Events, message)
+	return nil
+}
+
+// ListGatedPods mocks listing the target's gated pods
+func (k *MockK8sClient) ListGatedPods(ctx context.Context) ([]k8sclient.GatedPod, error) {
+	return k.GatedPods, nil
+}
+
+// RemoveSchedulingGate mocks removing the scheduling gate from a pod, and
+// remembers it
+func (k *MockK8sClient) RemoveSchedulingGate(podName, namespace string) error {
+	k.Ungated = append(k.Ungated, namespace+"/"+podName)
+	pods := []k8sclient.GatedPod{}
+	for _, pod := range k.GatedPods {
+		if pod.Namespace != namespace || pod.Name != podName {
+			pods = append(pods, pod)
+		}
+	}
+	k.GatedPods = pods
+	return nil
+}
+
+// SetContainerEnv mocks setting the environment variables of the next updates
+func (k *MockK8sClient) SetContainerEnv(env map[string][]apiv1.EnvVar) {
+	k.Env = env
+}
+
+// TakeSnapshot mocks a snapshot, of the current cluster size and no patch
+func (k *MockK8sClient) TakeSnapshot() *k8sclient.ClusterSizeSnapshot {
+	size, _ := k.GetClusterSize()
+	return &k8sclient.ClusterSizeSnapshot{Target: k.Target, ClusterSize: size}
+}
+
+// ReadManagedConfig mocks reading the config named by the target's annotations
+func (k *MockK8sClient) ReadManagedConfig() (*k8sclient.ManagedConfig, error) {
+	if k.ManagedConfig == nil && k.ManagedConfigErr == nil {
+		return nil, fmt.Errorf("no managed config")
+	}
+	return k.ManagedConfig, k.ManagedConfigErr
+}
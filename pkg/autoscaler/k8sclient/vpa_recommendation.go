@@ -0,0 +1,197 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// VPAGroupVersion is the API of the VerticalPodAutoscaler objects which
+// recommendations are written to.
+const VPAGroupVersion = "autoscaling.k8s.io/v1"
+
+// VPARecommenderName is the recommender which VerticalPodAutoscaler objects
+// that we create name, so that the VPA's own recommender leaves them alone.
+const VPARecommenderName = "cluster-proportional-vertical-autoscaler"
+
+// vpaObject holds the parts of a VerticalPodAutoscaler that we write.
+type vpaObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              *vpaSpec   `json:"spec,omitempty"`
+	Status            *vpaStatus `json:"status,omitempty"`
+}
+
+type vpaSpec struct {
+	TargetRef struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Name       string `json:"name"`
+	} `json:"targetRef"`
+	UpdatePolicy struct {
+		UpdateMode string `json:"updateMode"`
+	} `json:"updatePolicy"`
+	Recommenders []vpaRecommenderRef `json:"recommenders,omitempty"`
+}
+
+type vpaRecommenderRef struct {
+	Name string `json:"name"`
+}
+
+type vpaStatus struct {
+	Recommendation struct {
+		ContainerRecommendations []vpaContainerRecommendation `json:"containerRecommendations"`
+	} `json:"recommendation"`
+	Conditions []vpaCondition `json:"conditions"`
+}
+
+// vpaContainerRecommendation is the recommendation for one container.  Ours
+// are exact, so the bounds are all the target.
+type vpaContainerRecommendation struct {
+	ContainerName  string             `json:"containerName"`
+	Target         apiv1.ResourceList `json:"target"`
+	LowerBound     apiv1.ResourceList `json:"lowerBound"`
+	UpperBound     apiv1.ResourceList `json:"upperBound"`
+	UncappedTarget apiv1.ResourceList `json:"uncappedTarget"`
+}
+
+type vpaCondition struct {
+	Type               string      `json:"type"`
+	Status             string      `json:"status"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	Message            string      `json:"message,omitempty"`
+}
+
+// newVPAStatus returns the status of a VerticalPodAutoscaler which recommends
+// the requests of resources.  VPA only recommends requests, so limits are
+// left out, as are containers without requests.
+func newVPAStatus(resources map[string]apiv1.ResourceRequirements, now time.Time) *vpaStatus {
+	status := &vpaStatus{}
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	recs := []vpaContainerRecommendation{}
+	for _, name := range names {
+		reqs := resources[name].Requests
+		if len(reqs) == 0 {
+			continue
+		}
+		recs = append(recs, vpaContainerRecommendation{
+			ContainerName:  name,
+			Target:         reqs,
+			LowerBound:     reqs,
+			UpperBound:     reqs,
+			UncappedTarget: reqs,
+		})
+	}
+	status.Recommendation.ContainerRecommendations = recs
+	status.Conditions = []vpaCondition{{
+		Type:               "RecommendationProvided",
+		Status:             "True",
+		LastTransitionTime: metav1.NewTime(now),
+		Message:            "Recommended by " + VPARecommenderName,
+	}}
+	return status
+}
+
+// newVPAObject returns a VerticalPodAutoscaler for tgt, which never updates
+// it.
+func newVPAObject(name string, tgt *targetSpec) *vpaObject {
+	spec := &vpaSpec{}
+	spec.TargetRef.APIVersion = tgt.GroupVersion
+	spec.TargetRef.Kind = tgt.Kind
+	spec.TargetRef.Name = tgt.Name
+	spec.UpdatePolicy.UpdateMode = "Off"
+	spec.Recommenders = []vpaRecommenderRef{{Name: VPARecommenderName}}
+	return &vpaObject{
+		TypeMeta: metav1.TypeMeta{APIVersion: VPAGroupVersion, Kind: "VerticalPodAutoscaler"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: tgt.Namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": VPARecommenderName},
+		},
+		Spec: spec,
+	}
+}
+
+// writeVPARecommendation writes resources as the recommendation of the
+// VerticalPodAutoscaler k.vpaRecommendation, creating it if it doesn't
+// exist.  If the VPA CRD is not installed, it logs a warning and returns
+// nil, so that the autoscaler keeps running.
+func (k *k8sClient) writeVPARecommendation(resources map[string]apiv1.ResourceRequirements) error {
+	err := k.patchVPAStatus(resources)
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err := k.createVPA(); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("can't create VerticalPodAutoscaler %s/%s: %v", k.target.Namespace, k.vpaRecommendation, err)
+		}
+		if _, derr := k.clientset.Discovery().ServerResourcesForGroupVersion(VPAGroupVersion); apierrors.IsNotFound(derr) {
+			glog.Warningf("The VerticalPodAutoscaler CRD (%s) is not installed, not writing the recommendation for %s %s/%s",
+				VPAGroupVersion, k.target.Kind, k.target.Namespace, k.target.Name)
+			return nil
+		}
+		return fmt.Errorf("can't create VerticalPodAutoscaler %s/%s: %v", k.target.Namespace, k.vpaRecommendation, err)
+	}
+	glog.V(0).Infof("Created VerticalPodAutoscaler %s/%s", k.target.Namespace, k.vpaRecommendation)
+	return k.patchVPAStatus(resources)
+}
+
+// vpaPath returns the path of the VerticalPodAutoscalers in the target's
+// namespace, followed by elems.
+func (k *k8sClient) vpaPath(elems ...string) []string {
+	return append([]string{"/apis", VPAGroupVersion, "namespaces", k.target.Namespace, "verticalpodautoscalers"}, elems...)
+}
+
+// patchVPAStatus sets the recommendation through the status subresource.
+func (k *k8sClient) patchVPAStatus(resources map[string]apiv1.ResourceRequirements) error {
+	data, err := json.Marshal(&vpaObject{Status: newVPAStatus(resources, time.Now())})
+	if err != nil {
+		return err
+	}
+	_, err = k.clientset.Discovery().RESTClient().Patch(types.MergePatchType).
+		AbsPath(k.vpaPath(k.vpaRecommendation, "status")...).
+		Body(data).
+		DoRaw()
+	return err
+}
+
+// createVPA creates the VerticalPodAutoscaler for the target.
+func (k *k8sClient) createVPA() error {
+	data, err := json.Marshal(newVPAObject(k.vpaRecommendation, k.target))
+	if err != nil {
+		return err
+	}
+	_, err = k.clientset.Discovery().RESTClient().Post().
+		AbsPath(k.vpaPath()...).
+		SetHeader("Content-Type", "application/json").
+		Body(data).
+		DoRaw()
+	return err
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestNewVPAStatus(t *testing.T) {
+	cpu := apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}
+	now := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	status := newVPAStatus(map[string]apiv1.ResourceRequirements{
+		"b":       {Requests: cpu, Limits: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")}},
+		"a":       {Requests: cpu},
+		"no-reqs": {Limits: cpu},
+	}, now)
+	want := []vpaContainerRecommendation{
+		{ContainerName: "a", Target: cpu, LowerBound: cpu, UpperBound: cpu, UncappedTarget: cpu},
+		{ContainerName: "b", Target: cpu, LowerBound: cpu, UpperBound: cpu, UncappedTarget: cpu},
+	}
+	if got := status.Recommendation.ContainerRecommendations; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected recommendations %+v, got %+v", want, got)
+	}
+	if len(status.Conditions) != 1 || status.Conditions[0].Type != "RecommendationProvided" || !status.Conditions[0].LastTransitionTime.Time.Equal(now) {
+		t.Errorf("unexpected conditions %+v", status.Conditions)
+	}
+}
+
+func TestWriteVPARecommendation(t *testing.T) {
+	const (
+		vpas   = "/apis/autoscaling.k8s.io/v1/namespaces/default/verticalpodautoscalers"
+		status = vpas + "/thing-vpa/status"
+	)
+	for _, tc := range []struct {
+		name      string
+		installed bool
+		exists    bool
+		createErr int
+		calls     []string
+		expError  bool
+	}{
+		{
+			name: "existing", installed: true, exists: true,
+			calls: []string{"PATCH " + status},
+		},
+		{
+			name: "created", installed: true,
+			calls: []string{"PATCH " + status, "POST " + vpas, "PATCH " + status},
+		},
+		{
+			name:  "CRD not installed",
+			calls: []string{"PATCH " + status, "POST " + vpas, "GET /apis/autoscaling.k8s.io/v1"},
+		},
+		{
+			name: "forbidden", installed: true, createErr: http.StatusForbidden,
+			calls:    []string{"PATCH " + status, "POST " + vpas},
+			expError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			var created *vpaObject
+			var patched *vpaObject
+			exists := tc.exists
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls = append(calls, req.Method+" "+req.URL.Path)
+				body, _ := ioutil.ReadAll(req.Body)
+				code := http.StatusNotFound
+				switch req.Method + " " + req.URL.Path {
+				case "GET /apis/autoscaling.k8s.io/v1":
+					if tc.installed {
+						code = http.StatusOK
+					}
+				case "POST " + vpas:
+					if tc.installed {
+						code = http.StatusCreated
+						if tc.createErr != 0 {
+							code = tc.createErr
+						} else {
+							exists = true
+							created = &vpaObject{}
+							if err := json.Unmarshal(body, created); err != nil {
+								t.Errorf("can't decode the created object: %v", err)
+							}
+						}
+					}
+				case "PATCH " + status:
+					if exists {
+						code = http.StatusOK
+						if req.Header.Get("Content-Type") != "application/merge-patch+json" {
+							t.Errorf("expected a merge patch, got %q", req.Header.Get("Content-Type"))
+						}
+						patched = &vpaObject{}
+						if err := json.Unmarshal(body, patched); err != nil {
+							t.Errorf("can't decode the patch: %v", err)
+						}
+					}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(code)
+				switch code {
+				case http.StatusNotFound:
+					json.NewEncoder(w).Encode(&metav1.Status{Status: metav1.StatusFailure, Code: int32(code), Reason: metav1.StatusReasonNotFound})
+					return
+				case http.StatusForbidden:
+					json.NewEncoder(w).Encode(&metav1.Status{Status: metav1.StatusFailure, Code: int32(code), Reason: metav1.StatusReasonForbidden})
+					return
+				}
+				w.Write([]byte("{}"))
+			}))
+			defer server.Close()
+
+			k := &k8sClient{
+				clientset:         clientset.NewForConfigOrDie(&restclient.Config{Host: server.URL}),
+				target:            &targetSpec{Kind: "Deployment", GroupVersion: "apps/v1", Namespace: "default", Name: "thing"},
+				vpaRecommendation: "thing-vpa",
+			}
+			err := k.writeVPARecommendation(map[string]apiv1.ResourceRequirements{
+				"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+			})
+			if (err != nil) != tc.expError {
+				t.Errorf("expected error %v, got %v", tc.expError, err)
+			}
+			if !reflect.DeepEqual(calls, tc.calls) {
+				t.Errorf("expected calls %v, got %v", tc.calls, calls)
+			}
+			if created != nil {
+				if ref := created.Spec.TargetRef; ref.APIVersion != "apps/v1" || ref.Kind != "Deployment" || ref.Name != "thing" {
+					t.Errorf("unexpected target of the created object: %+v", ref)
+				}
+				if created.Spec.UpdatePolicy.UpdateMode != "Off" || created.Name != "thing-vpa" || created.Namespace != "default" {
+					t.Errorf("unexpected created object: %+v", created)
+				}
+			}
+			if tc.installed && tc.createErr == 0 {
+				if patched == nil || patched.Status == nil || len(patched.Status.Recommendation.ContainerRecommendations) != 1 {
+					t.Errorf("expected the recommendation to be written, got %+v", patched)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+
+	"github.com/golang/glog"
+)
+
+// LadderConfig holds step functions of cluster metrics.  Each ladder is an
+// independent axis; the result is the largest value from any of them.
+//
+// Example:
+//
+//	CoreLadder = [{Threshold: 0, Value: 100m}, {Threshold: 64, Value: 500m}]
+//
+//	With 16 cores the value is 100m, with 64 or more it is 500m.
+//
+// With SoakSeconds, a higher rung only applies once the count has been at or
+// above its threshold for that long, see LadderSoak.
+//
+// With InterpolationLinear, the rungs are the anchors of a piecewise-linear
+// curve instead: a count between two rungs gets the value on the line between
+// them, e.g. 300m with 40 cores in the example above, and beyond the first or
+// last rung the curve is flat.
+type LadderConfig struct {
+	// Rungs indexed by the number of cores.
+	CoreLadder []LadderRung
+	// Rungs indexed by the number of nodes.
+	NodeLadder []LadderRung
+	// Rungs indexed by the number of the target's Pending pods.
+	PendingPodsLadder []LadderRung
+	// Rungs indexed by the total memory of the nodes, in GiB.
+	MemoryLadder []MemoryLadderRung
+	// Rungs indexed by the percentage of the allocatable CPU which pods
+	// request, see --count-cpu-utilization.
+	CPUUtilizationLadder []LadderRung
+	// Rungs indexed by the count of the --scale-on metric.
+	MetricLadder []LadderRung
+	// Rungs indexed by the number of nodes without and with the
+	// --taint-toleration-match taint.
+	MainPoolNodeLadder    []LadderRung
+	TaintedPoolNodeLadder []LadderRung
+	// How long, in seconds, the count must be at or above the threshold of
+	// a higher rung before it applies.  0 applies it at once.
+	SoakSeconds int
+	// How counts between rungs are evaluated.  It can't be linear with a
+	// SoakSeconds.
+	Interpolation Interpolation
+}
+
+// LadderRung is a single step of a ladder.
+type LadderRung struct {
+	// The smallest count at which this rung applies.
+	Threshold int
+	// The quantity to use from this rung up.
+	Value *resource.Quantity
+}
+
+// MemoryLadderRung is a single step of a memory ladder.
+type MemoryLadderRung struct {
+	// The smallest cluster memory at which this rung applies.
+	Threshold GiB
+	// The quantity to use from this rung up.
+	Value *resource.Quantity
+}
+
+// GiB is an amount of memory in whole gibibytes.  In JSON it is either a
+// number of GiB, or a quantity string such as "32Gi" or "1Ti".
+type GiB int
+
+// UnmarshalJSON accepts a number of GiB or a quantity string.
+func (g *GiB) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*g = GiB(n)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("memory threshold must be a number of GiB or a quantity, got %s", data)
+	}
+	q, err := resource.ParseQuantity(str)
+	if err != nil {
+		return fmt.Errorf("invalid memory threshold %q: %v", str, err)
+	}
+	n, err = ParseGiB(q)
+	if err != nil {
+		return fmt.Errorf("invalid memory threshold %q: %v", str, err)
+	}
+	*g = GiB(n)
+	return nil
+}
+
+// ParseGiB converts a quantity of memory to GiB.  It must be a whole number
+// of GiB.
+func ParseGiB(q resource.Quantity) (int, error) {
+	bytes, ok := q.AsInt64()
+	if !ok || bytes < 0 || bytes%(1<<30) != 0 {
+		return 0, fmt.Errorf("must be a whole, non-negative number of GiB")
+	}
+	return int(bytes >> 30), nil
+}
+
+// memoryGiB returns the memory of the cluster in whole GiB, rounded down.
+func memoryGiB(cluster *k8sclient.ClusterSize) int {
+	// Value rounds up fractions of a byte, which don't matter here.
+	return int(cluster.Memory.Value() >> 30)
+}
+
+// value returns the largest value of any axis, in milli-units, and whether
+// any rung applied at all.
+func (lc LadderConfig) value(cluster *k8sclient.ClusterSize) (int64, bool) {
+	return lc.soakedValue(cluster, k8sclient.ScaleMetric{}, nil, "")
+}
+
+// soakedValue is like value, but the metric ladder counts on, and if soak is
+// not nil and the ladder has a soak period, the higher rungs are held back by
+// soak.  key identifies the ladder.
+func (lc LadderConfig) soakedValue(cluster *k8sclient.ClusterSize, on k8sclient.ScaleMetric, soak *LadderSoak, key string) (int64, bool) {
+	var want int64
+	found := false
+	for _, axis := range []struct {
+		name   string
+		ladder []LadderRung
+		count  int
+	}{
+		{"coreLadder", lc.CoreLadder, cluster.Cores},
+		{"nodeLadder", lc.NodeLadder, cluster.Nodes},
+		{"pendingPodsLadder", lc.PendingPodsLadder, cluster.PendingPods},
+		{"memoryLadder", memoryRungs(lc.MemoryLadder), memoryGiB(cluster)},
+		{"cpuUtilizationLadder", lc.CPUUtilizationLadder, cluster.CPUUtilization},
+		{"metricLadder", lc.MetricLadder, cluster.Count(on)},
+		{"mainPoolNodeLadder", lc.MainPoolNodeLadder, cluster.MainPoolNodes},
+		{"taintedPoolNodeLadder", lc.TaintedPoolNodeLadder, cluster.TaintedPoolNodes},
+	} {
+		var v int64
+		var ok bool
+		if soak != nil && lc.SoakSeconds > 0 && len(axis.ladder) > 0 {
+			v, ok = soak.climb(key+"/"+axis.name, axis.ladder, axis.count, time.Duration(lc.SoakSeconds)*time.Second)
+		} else if lc.Interpolation == InterpolationLinear {
+			v, ok = interpolate(axis.ladder, axis.count)
+		} else {
+			v, ok = climb(axis.ladder, axis.count)
+		}
+		if ok {
+			if !found || v > want {
+				want = v
+			}
+			found = true
+		}
+	}
+	return want, found
+}
+
+// climb finds the rung with the highest threshold not above count.  Rungs
+// need not be sorted.
+func climb(ladder []LadderRung, count int) (int64, bool) {
+	var best *LadderRung
+	for i := range ladder {
+		rung := &ladder[i]
+		if rung.Value == nil || rung.Threshold > count {
+			continue
+		}
+		if best == nil || rung.Threshold > best.Threshold {
+			best = rung
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return asInt64(best.Value), true
+}
+
+// interpolate is like climb, but a count between two rungs gets the value on
+// the line between them, rounded to the nearest milli-unit.  Below the lowest
+// rung it is that rung's value, and above the highest rung that rung's.  It
+// only doesn't apply to a ladder without rungs.
+func interpolate(ladder []LadderRung, count int) (int64, bool) {
+	var lo, hi *LadderRung
+	for i := range ladder {
+		rung := &ladder[i]
+		if rung.Value == nil {
+			continue
+		}
+		if rung.Threshold <= count && (lo == nil || rung.Threshold > lo.Threshold) {
+			lo = rung
+		}
+		if rung.Threshold > count && (hi == nil || rung.Threshold < hi.Threshold) {
+			hi = rung
+		}
+	}
+	switch {
+	case lo == nil && hi == nil:
+		return 0, false
+	case lo == nil:
+		return asInt64(hi.Value), true
+	case hi == nil:
+		return asInt64(lo.Value), true
+	}
+	from, to := asInt64(lo.Value), asInt64(hi.Value)
+	frac := float64(count-lo.Threshold) / float64(hi.Threshold-lo.Threshold)
+	return from + int64(math.Round(frac*float64(to-from))), true
+}
+
+// validate checks the interpolation, and that it isn't linear with a soak
+// period.
+func (lc LadderConfig) validate() error {
+	if lc.SoakSeconds < 0 {
+		return fmt.Errorf("ladder soakSeconds cannot be negative")
+	}
+	if err := lc.Interpolation.validate(); err != nil {
+		return fmt.Errorf("ladder: %v", err)
+	}
+	if lc.Interpolation == InterpolationLinear && lc.SoakSeconds > 0 {
+		return fmt.Errorf("ladder soakSeconds cannot be used with linear interpolation")
+	}
+	return nil
+}
+
+// memoryRungs converts memory rungs to plain rungs, indexed by GiB.
+func memoryRungs(ladder []MemoryLadderRung) []LadderRung {
+	out := make([]LadderRung, len(ladder))
+	for i, rung := range ladder {
+		out[i] = LadderRung{Threshold: int(rung.Threshold), Value: rung.Value}
+	}
+	return out
+}
+
+func (lc LadderConfig) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("{ ")
+	if len(lc.CoreLadder) > 0 {
+		buf.WriteString(fmt.Sprintf("cores=%s ", rungsString(lc.CoreLadder)))
+	}
+	if len(lc.NodeLadder) > 0 {
+		buf.WriteString(fmt.Sprintf("nodes=%s ", rungsString(lc.NodeLadder)))
+	}
+	if len(lc.PendingPodsLadder) > 0 {
+		buf.WriteString(fmt.Sprintf("pending=%s ", rungsString(lc.PendingPodsLadder)))
+	}
+	if len(lc.MemoryLadder) > 0 {
+		buf.WriteString(fmt.Sprintf("memoryGiB=%s ", rungsString(memoryRungs(lc.MemoryLadder))))
+	}
+	if len(lc.CPUUtilizationLadder) > 0 {
+		buf.WriteString(fmt.Sprintf("cpuUtilization=%s ", rungsString(lc.CPUUtilizationLadder)))
+	}
+	if len(lc.MetricLadder) > 0 {
+		buf.WriteString(fmt.Sprintf("metric=%s ", rungsString(lc.MetricLadder)))
+	}
+	if len(lc.MainPoolNodeLadder) > 0 {
+		buf.WriteString(fmt.Sprintf("mainPoolNodes=%s ", rungsString(lc.MainPoolNodeLadder)))
+	}
+	if len(lc.TaintedPoolNodeLadder) > 0 {
+		buf.WriteString(fmt.Sprintf("taintedPoolNodes=%s ", rungsString(lc.TaintedPoolNodeLadder)))
+	}
+	if lc.SoakSeconds > 0 {
+		buf.WriteString(fmt.Sprintf("soak=%ds ", lc.SoakSeconds))
+	}
+	if lc.Interpolation != "" {
+		buf.WriteString(fmt.Sprintf("interpolation=%s ", lc.Interpolation))
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+func rungsString(ladder []LadderRung) string {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, rung := range ladder {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(fmt.Sprintf("%d:%s", rung.Threshold, rung.Value))
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
+
+func (lc LadderConfig) DeepCopy() LadderConfig {
+	return LadderConfig{
+		CoreLadder:            copyRungs(lc.CoreLadder),
+		NodeLadder:            copyRungs(lc.NodeLadder),
+		PendingPodsLadder:     copyRungs(lc.PendingPodsLadder),
+		MemoryLadder:          copyMemoryRungs(lc.MemoryLadder),
+		CPUUtilizationLadder:  copyRungs(lc.CPUUtilizationLadder),
+		MetricLadder:          copyRungs(lc.MetricLadder),
+		MainPoolNodeLadder:    copyRungs(lc.MainPoolNodeLadder),
+		TaintedPoolNodeLadder: copyRungs(lc.TaintedPoolNodeLadder),
+		SoakSeconds:           lc.SoakSeconds,
+		Interpolation:         lc.Interpolation,
+	}
+}
+
+func copyRungs(ladder []LadderRung) []LadderRung {
+	if ladder == nil {
+		return nil
+	}
+	out := make([]LadderRung, len(ladder))
+	for i, rung := range ladder {
+		out[i].Threshold = rung.Threshold
+		if rung.Value != nil {
+			out[i].Value = rung.Value.Copy()
+		}
+	}
+	return out
+}
+
+func copyMemoryRungs(ladder []MemoryLadderRung) []MemoryLadderRung {
+	if ladder == nil {
+		return nil
+	}
+	out := make([]MemoryLadderRung, len(ladder))
+	for i, rung := range ladder {
+		out[i].Threshold = rung.Threshold
+		if rung.Value != nil {
+			out[i].Value = rung.Value.Copy()
+		}
+	}
+	return out
+}
+
+// MultiAxisEvaluator computes the resources for a container.  Each resource is
+// evaluated against its own configured axes (linear steps by cores, nodes, or
+// pods, and ladders), and the results are merged into one set of
+// requirements.
+type MultiAxisEvaluator struct {
+	// If set, holds back the higher rungs of ladders with a soak period.
+	Soak *LadderSoak
+	// The metric of the metricPerStep and metricLadder axes, see --scale-on.
+	ScaleOn k8sclient.ScaleMetric
+}
+
+// Evaluate returns the requirements for one container.
+func (e MultiAxisEvaluator) Evaluate(ctr string, cfg ContainerScaleConfig, cluster *k8sclient.ClusterSize) apiv1.ResourceRequirements {
+	reqs := apiv1.ResourceRequirements{
+		Requests: map[apiv1.ResourceName]resource.Quantity{},
+		Limits:   map[apiv1.ResourceName]resource.Quantity{},
+	}
+	for res, rcfg := range cfg.Requests {
+		r := newQuantity(res, rcfg, calculateSoaked(rcfg, cluster, e.ScaleOn, e.Soak, ctr+"/requests/"+res))
+		reqs.Requests[apiv1.ResourceName(res)] = *r
+		glog.V(4).Infof("Calculated %s requests[%q] = %v", ctr, res, r)
+	}
+	for res, rcfg := range cfg.Limits {
+		r := newQuantity(res, rcfg, calculateSoaked(rcfg, cluster, e.ScaleOn, e.Soak, ctr+"/limits/"+res))
+		reqs.Limits[apiv1.ResourceName(res)] = *r
+		glog.V(4).Infof("Calculated %s limits[%q] = %v", ctr, res, r)
+	}
+	applyLookupTable(ctr, cfg, cluster.Nodes, reqs)
+	return reqs
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// LadderSoak holds back higher rungs of ladders which have a soak period,
+// until the count has stayed at or above the rung's threshold for that long.
+// A brief spike past a threshold then doesn't change the resources, and
+// restart the pods, only to change them back.  Lower rungs apply at once.
+type LadderSoak struct {
+	clock clock.Clock
+	// Since when the count of each ladder axis has been at or above each
+	// rung's threshold, by axis and threshold.
+	aboveSince map[string]map[int]time.Time
+	// The axes which have a rung being held back.
+	pending map[string]bool
+}
+
+// NewLadderSoak returns a LadderSoak which has seen no counts yet.
+func NewLadderSoak(clock clock.Clock) *LadderSoak {
+	return &LadderSoak{
+		clock:      clock,
+		aboveSince: map[string]map[int]time.Time{},
+		pending:    map[string]bool{},
+	}
+}
+
+// climb is like the package's climb, but skips the rungs which the count
+// has not yet been at or above for soak.  key identifies the ladder axis.
+// The first count of an axis is trusted, as there is nothing to compare it
+// to.
+func (s *LadderSoak) climb(key string, ladder []LadderRung, count int, soak time.Duration) (int64, bool) {
+	now := s.clock.Now()
+	since, seen := s.aboveSince[key]
+	if !seen {
+		since = map[int]time.Time{}
+		s.aboveSince[key] = since
+	}
+	s.pending[key] = false
+	var best *LadderRung
+	for i := range ladder {
+		rung := &ladder[i]
+		if rung.Value == nil || rung.Threshold > count {
+			delete(since, rung.Threshold)
+			continue
+		}
+		at, found := since[rung.Threshold]
+		if !found {
+			at = now
+			if !seen {
+				at = time.Time{}
+			}
+			since[rung.Threshold] = at
+		}
+		if now.Sub(at) < soak {
+			glog.V(2).Infof("Holding back rung %d of %s until %v", rung.Threshold, key, at.Add(soak))
+			s.pending[key] = true
+			continue
+		}
+		if best == nil || rung.Threshold > best.Threshold {
+			best = rung
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return asInt64(best.Value), true
+}
+
+// Pending returns whether any rung is being held back, so that the cluster
+// size must be evaluated again even if it doesn't change.
+func (s *LadderSoak) Pending() bool {
+	for _, pending := range s.pending {
+		if pending {
+			return true
+		}
+	}
+	return false
+}
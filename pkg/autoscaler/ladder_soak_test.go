@@ -0,0 +1,91 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestLadderSoak(t *testing.T) {
+	cfg := ScaleConfig{}
+	if _, err := parseConfigFile([]byte(`{"agent": {"requests": {"cpu": {"ladder": {
+		"nodeLadder": [{"threshold": 0, "value": "100m"}, {"threshold": 10, "value": "500m"}, {"threshold": 20, "value": "1"}],
+		"soakSeconds": 300}}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	clk := clock.NewFakeClock(time.Now())
+	mockK8s := &k8sclient.MockK8sClient{}
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		currentConfig: cfg,
+		deltaScaler:   &DeltaScaler{Threshold: 1},
+		ladderSoak:    NewLadderSoak(clk),
+		clock:         clk,
+	}
+
+	for i, step := range []struct {
+		advance time.Duration
+		nodes   int
+		expCPU  string
+	}{
+		// The first count is trusted.
+		{0, 5, "100m"},
+		// A brief spike is held back.
+		{time.Minute, 12, "100m"},
+		{time.Minute, 12, "100m"},
+		{time.Minute, 5, "100m"},
+		// It soaks from when it was seen again.
+		{time.Minute, 12, "100m"},
+		{4 * time.Minute, 12, "100m"},
+		{time.Minute, 12, "500m"},
+		// Higher rungs soak on their own, and then apply at once.
+		{time.Minute, 25, "500m"},
+		{5 * time.Minute, 25, "1"},
+		// Lower rungs apply at once.
+		{time.Minute, 3, "100m"},
+	} {
+		clk.Step(step.advance)
+		mockK8s.NumOfNodes = step.nodes
+		autoScaler.pollAPIServer(context.Background())
+		got := autoScaler.lastReqs["agent"].Requests[apiv1.ResourceCPU]
+		if expected := resource.MustParse(step.expCPU); got.Cmp(expected) != 0 {
+			t.Errorf("step %d: %d nodes: expected cpu %v, got %v", i, step.nodes, &expected, &got)
+		}
+	}
+}
+
+func TestLadderSoakTrustsFirstCount(t *testing.T) {
+	soak := NewLadderSoak(clock.NewFakeClock(time.Now()))
+	ladder := []LadderRung{
+		{Threshold: 0, Value: resource.NewMilliQuantity(100, resource.DecimalSI)},
+		{Threshold: 10, Value: resource.NewMilliQuantity(500, resource.DecimalSI)},
+	}
+	v, ok := soak.climb("agent/requests/cpu/nodeLadder", ladder, 12, time.Hour)
+	if !ok || v != 500 {
+		t.Errorf("expected the top rung at once, got %d", v)
+	}
+	if soak.Pending() {
+		t.Errorf("expected nothing to be held back")
+	}
+}
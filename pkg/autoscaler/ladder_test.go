@@ -0,0 +1,508 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"testing"
+
+	realk8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMultiAxisEvaluator(t *testing.T) {
+	var asConfig = `
+{
+  "fake-agent": {
+    "requests": {
+      "cpu": {
+        "ladder": {
+          "coreLadder": [
+            {"threshold": 0, "value": "100m"},
+            {"threshold": 64, "value": "500m"},
+            {"threshold": 16, "value": "200m"}
+          ]
+        }
+      },
+      "memory": {
+        "max": "1Gi",
+        "ladder": {
+          "nodeLadder": [
+            {"threshold": 1, "value": "64Mi"},
+            {"threshold": 10, "value": "256Mi"},
+            {"threshold": 100, "value": "2Gi"}
+          ],
+          "pendingPodsLadder": [
+            {"threshold": 1, "value": "512Mi"}
+          ]
+        }
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		numNodes   int
+		numCores   int
+		numPending int
+		expCPU     string
+		expMem     string
+	}{
+		{"bottom rungs", 1, 4, 0, "100m", "64Mi"},
+		{"middle rungs", 12, 48, 0, "200m", "256Mi"},
+		{"top rungs, bounded by max", 150, 600, 0, "500m", "1Gi"},
+		{"below lowest node rung", 0, 0, 0, "100m", "0"},
+		{"pending pods", 12, 48, 3, "200m", "512Mi"},
+	} {
+		mockK8s := k8sclient.MockK8sClient{
+			NumOfNodes:       tt.numNodes,
+			NumOfCores:       tt.numCores,
+			NumOfPendingPods: tt.numPending,
+		}
+		sz, err := mockK8s.GetClusterSize()
+		if err != nil {
+			t.Errorf("failed to get cluster size")
+		}
+		reqs := MultiAxisEvaluator{}.Evaluate("fake-agent", cfg["fake-agent"], sz)
+		cpu := reqs.Requests[apiv1.ResourceCPU]
+		if exp := resource.MustParse(tt.expCPU); cpu.Cmp(exp) != 0 {
+			t.Errorf("%s: expected cpu %s got %s", tt.name, tt.expCPU, cpu.String())
+		}
+		mem := reqs.Requests[apiv1.ResourceMemory]
+		if exp := resource.MustParse(tt.expMem); mem.Cmp(exp) != 0 {
+			t.Errorf("%s: expected memory %s got %s", tt.name, tt.expMem, mem.String())
+		}
+	}
+}
+
+func TestMemoryLadder(t *testing.T) {
+	var asConfig = `
+{
+  "cache": {
+    "requests": {
+      "memory": {
+        "ladder": {
+          "memoryLadder": [
+            {"threshold": 0, "value": "1Gi"},
+            {"threshold": "32Gi", "value": "4Gi"},
+            {"threshold": 128, "value": "16Gi"}
+          ]
+        }
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		memory string
+		expMem string
+	}{
+		{"bottom rung", "16Gi", "1Gi"},
+		{"exactly at threshold", "32Gi", "4Gi"},
+		{"just below threshold", "32767Mi", "1Gi"},
+		{"top rung", "1Ti", "16Gi"},
+	} {
+		mockK8s := k8sclient.MockK8sClient{NumOfNodes: 1, Memory: resource.MustParse(tt.memory)}
+		sz, err := mockK8s.GetClusterSize()
+		if err != nil {
+			t.Errorf("failed to get cluster size")
+		}
+		reqs := MultiAxisEvaluator{}.Evaluate("cache", cfg["cache"], sz)
+		mem := reqs.Requests[apiv1.ResourceMemory]
+		if exp := resource.MustParse(tt.expMem); mem.Cmp(exp) != 0 {
+			t.Errorf("%s: expected memory %s got %s", tt.name, tt.expMem, mem.String())
+		}
+	}
+}
+
+func TestLinearLadder(t *testing.T) {
+	var asConfig = `
+{
+  "app": {
+    "requests": {
+      "cpu": {
+        "ladder": {
+          "nodeLadder": [
+            {"threshold": 10, "value": "1000m"},
+            {"threshold": 20, "value": "2000m"},
+            {"threshold": 23, "value": "2001m"}
+          ],
+          "interpolation": "linear"
+        }
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		nodes  int
+		expCPU string
+	}{
+		{"no nodes", 0, "1"},
+		{"below the first rung", 5, "1"},
+		{"at a rung", 10, "1"},
+		{"a quarter of the way", 12, "1200m"},
+		{"halfway", 15, "1500m"},
+		{"at the next rung", 20, "2"},
+		// 2000m plus 1/3 and 2/3 of a millicore.
+		{"rounded down", 21, "2000m"},
+		{"rounded up", 22, "2001m"},
+		{"at the last rung", 23, "2001m"},
+		{"above the last rung", 100, "2001m"},
+	} {
+		mockK8s := k8sclient.MockK8sClient{NumOfNodes: tt.nodes}
+		sz, err := mockK8s.GetClusterSize()
+		if err != nil {
+			t.Errorf("failed to get cluster size")
+		}
+		reqs := MultiAxisEvaluator{}.Evaluate("app", cfg["app"], sz)
+		cpu := reqs.Requests[apiv1.ResourceCPU]
+		if exp := resource.MustParse(tt.expCPU); cpu.Cmp(exp) != 0 {
+			t.Errorf("%s: expected cpu %s got %s", tt.name, tt.expCPU, cpu.String())
+		}
+	}
+}
+
+func TestLinearLadderCurve(t *testing.T) {
+	// Unsorted anchors, with a falling segment, capped by max.
+	var asConfig = `
+{
+  "app": {
+    "requests": {
+      "memory": {
+        "max": "3Gi",
+        "ladder": {
+          "nodeLadder": [
+            {"threshold": 50, "value": "4Gi"},
+            {"threshold": 2, "value": "1Gi"},
+            {"threshold": 10, "value": "2Gi"},
+            {"threshold": 20, "value": "1Gi"}
+          ],
+          "interpolation": "linear"
+        }
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		nodes int
+		exp   string
+	}{
+		{"below the first anchor", 1, "1Gi"},
+		{"at the first anchor", 2, "1Gi"},
+		{"rising midpoint", 6, "1536Mi"},
+		{"at the peak", 10, "2Gi"},
+		{"falling midpoint", 15, "1536Mi"},
+		{"at the trough", 20, "1Gi"},
+		{"midpoint past the trough", 35, "2560Mi"},
+		{"capped by max", 45, "3Gi"},
+		{"at the last anchor, capped", 50, "3Gi"},
+		{"above the last anchor, capped", 500, "3Gi"},
+	} {
+		mockK8s := k8sclient.MockK8sClient{NumOfNodes: tt.nodes}
+		sz, err := mockK8s.GetClusterSize()
+		if err != nil {
+			t.Errorf("failed to get cluster size")
+		}
+		reqs := MultiAxisEvaluator{}.Evaluate("app", cfg["app"], sz)
+		mem := reqs.Requests[apiv1.ResourceMemory]
+		if exp := resource.MustParse(tt.exp); mem.Cmp(exp) != 0 {
+			t.Errorf("%s: expected memory %s got %s", tt.name, tt.exp, mem.String())
+		}
+	}
+}
+
+func TestTaintPoolLadders(t *testing.T) {
+	var asConfig = `
+{
+  "app": {
+    "requests": {
+      "cpu": {
+        "ladder": {
+          "mainPoolNodeLadder": [{"threshold": 0, "value": "100m"}, {"threshold": 10, "value": "200m"}]
+        }
+      },
+      "memory": {
+        "ladder": {
+          "taintedPoolNodeLadder": [{"threshold": 1, "value": "1Gi"}, {"threshold": 4, "value": "4Gi"}]
+        }
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name          string
+		main, tainted int
+		expCPU        string
+		expMem        string
+	}{
+		{"no tainted nodes", 12, 0, "200m", "0"},
+		{"small pools", 8, 2, "100m", "1Gi"},
+		// The total of 11 nodes doesn't matter.
+		{"large tainted pool", 5, 6, "100m", "4Gi"},
+	} {
+		sz := &realk8sclient.ClusterSize{
+			Nodes:            tt.main + tt.tainted,
+			MainPoolNodes:    tt.main,
+			TaintedPoolNodes: tt.tainted,
+		}
+		reqs := MultiAxisEvaluator{}.Evaluate("app", cfg["app"], sz)
+		cpu := reqs.Requests[apiv1.ResourceCPU]
+		if exp := resource.MustParse(tt.expCPU); cpu.Cmp(exp) != 0 {
+			t.Errorf("%s: expected cpu %s got %s", tt.name, tt.expCPU, cpu.String())
+		}
+		mem := reqs.Requests[apiv1.ResourceMemory]
+		if exp := resource.MustParse(tt.expMem); mem.Cmp(exp) != 0 {
+			t.Errorf("%s: expected memory %s got %s", tt.name, tt.expMem, mem.String())
+		}
+	}
+}
+
+func TestValidateLadderInterpolation(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ladder   string
+		expError bool
+	}{
+		{"step", `{"nodeLadder": [{"threshold": 0, "value": "1"}], "interpolation": "step"}`, false},
+		{"linear", `{"nodeLadder": [{"threshold": 0, "value": "1"}], "interpolation": "linear"}`, false},
+		{"step with soak", `{"nodeLadder": [{"threshold": 0, "value": "1"}], "soakSeconds": 60}`, false},
+		{"unknown", `{"nodeLadder": [{"threshold": 0, "value": "1"}], "interpolation": "cubic"}`, true},
+		{"linear with soak", `{"nodeLadder": [{"threshold": 0, "value": "1"}], "interpolation": "linear", "soakSeconds": 60}`, true},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"ladder": `+tc.ladder+`}}}}`), &cfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tc.name, err)
+		}
+		err := cfg.Validate()
+		if tc.expError && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.expError && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+}
+
+func TestValidatePools(t *testing.T) {
+	testCases := []struct {
+		name      string
+		ladder    string
+		taintPool bool
+		expError  bool
+	}{
+		{"nodes", `{"nodeLadder": [{"threshold": 0, "value": "1"}]}`, false, false},
+		{"main pool", `{"mainPoolNodeLadder": [{"threshold": 0, "value": "1"}]}`, true, false},
+		{"tainted pool", `{"taintedPoolNodeLadder": [{"threshold": 0, "value": "1"}]}`, true, false},
+		{"main pool without a taint", `{"mainPoolNodeLadder": [{"threshold": 0, "value": "1"}]}`, false, true},
+		{"tainted pool without a taint", `{"taintedPoolNodeLadder": [{"threshold": 0, "value": "1"}]}`, false, true},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"ladder": `+tc.ladder+`}}}}`), &cfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tc.name, err)
+		}
+		err := cfg.validatePools(tc.taintPool)
+		if tc.expError && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.expError && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+}
+
+func TestCPUUtilizationLadder(t *testing.T) {
+	var asConfig = `
+{
+  "metrics-server": {
+    "requests": {
+      "cpu": {
+        "base": "100m",
+        "ladder": {
+          "cpuUtilizationLadder": [
+            {"threshold": 50, "value": "200m"},
+            {"threshold": 80, "value": "500m"}
+          ]
+        }
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		utilization int
+		expCPU      string
+	}{
+		{"not measured", 0, "100m"},
+		{"below lowest rung", 49, "100m"},
+		{"exactly at threshold", 50, "200m"},
+		{"top rung", 95, "500m"},
+	} {
+		mockK8s := k8sclient.MockK8sClient{NumOfNodes: 1, CPUUtilization: tt.utilization}
+		sz, err := mockK8s.GetClusterSize()
+		if err != nil {
+			t.Errorf("failed to get cluster size")
+		}
+		reqs := MultiAxisEvaluator{}.Evaluate("metrics-server", cfg["metrics-server"], sz)
+		cpu := reqs.Requests[apiv1.ResourceCPU]
+		if exp := resource.MustParse(tt.expCPU); cpu.Cmp(exp) != 0 {
+			t.Errorf("%s: expected cpu %s got %s", tt.name, tt.expCPU, cpu.String())
+		}
+	}
+}
+
+func TestScaleOn(t *testing.T) {
+	asConfig := `
+{
+  "gpu-plugin": {
+    "requests": {
+      "cpu": {
+        "base": "100m",
+        "step": "50m",
+        "metricPerStep": 4
+      },
+      "memory": {
+        "base": "64Mi",
+        "ladder": {
+          "metricLadder": [
+            {"threshold": 8, "value": "128Mi"},
+            {"threshold": 32, "value": "256Mi"}
+          ]
+        }
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+
+	sz := &realk8sclient.ClusterSize{
+		Nodes:        4,
+		Cores:        64,
+		Memory:       resource.MustParse("256Gi"),
+		MatchingPods: 12,
+		GPUs:         8,
+		CustomMetric: 40,
+	}
+	for _, tt := range []struct {
+		on     realk8sclient.ScaleMetric
+		expCPU string
+		expMem string
+	}{
+		{realk8sclient.ScaleMetric{}, "150m", "64Mi"},
+		{realk8sclient.ScaleMetric{Kind: realk8sclient.ScaleOnNodes}, "150m", "64Mi"},
+		{realk8sclient.ScaleMetric{Kind: realk8sclient.ScaleOnCores}, "900m", "256Mi"},
+		{realk8sclient.ScaleMetric{Kind: realk8sclient.ScaleOnMemory}, "3300m", "256Mi"},
+		{realk8sclient.ScaleMetric{Kind: realk8sclient.ScaleOnPods}, "250m", "128Mi"},
+		{realk8sclient.ScaleMetric{Kind: realk8sclient.ScaleOnGPUs}, "200m", "128Mi"},
+		{realk8sclient.ScaleMetric{Kind: realk8sclient.ScaleOnCustom, Name: "queue_length"}, "600m", "256Mi"},
+	} {
+		reqs := MultiAxisEvaluator{ScaleOn: tt.on}.Evaluate("gpu-plugin", cfg["gpu-plugin"], sz)
+		cpu := reqs.Requests[apiv1.ResourceCPU]
+		if exp := resource.MustParse(tt.expCPU); cpu.Cmp(exp) != 0 {
+			t.Errorf("%s: expected cpu %s got %s", tt.on, tt.expCPU, cpu.String())
+		}
+		mem := reqs.Requests[apiv1.ResourceMemory]
+		if exp := resource.MustParse(tt.expMem); mem.Cmp(exp) != 0 {
+			t.Errorf("%s: expected memory %s got %s", tt.on, tt.expMem, mem.String())
+		}
+	}
+}
+
+func TestGiBUnmarshal(t *testing.T) {
+	for _, tt := range []struct {
+		data     string
+		exp      GiB
+		expError bool
+	}{
+		{`32`, 32, false},
+		{`"32Gi"`, 32, false},
+		{`"1Ti"`, 1024, false},
+		{`"0"`, 0, false},
+		{`"1.5Gi"`, 0, true},
+		{`"64G"`, 0, true},
+		{`"-1Gi"`, 0, true},
+		{`"lots"`, 0, true},
+		{`true`, 0, true},
+	} {
+		var g GiB
+		err := json.Unmarshal([]byte(tt.data), &g)
+		if err != nil {
+			if !tt.expError {
+				t.Errorf("%s: unexpected error: %v", tt.data, err)
+			}
+			continue
+		}
+		if tt.expError {
+			t.Errorf("%s: expected an error, got %d", tt.data, g)
+			continue
+		}
+		if g != tt.exp {
+			t.Errorf("%s: expected %d, got %d", tt.data, tt.exp, g)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/golang/glog"
+)
+
+// Interpolation is how a LookupTable computes the resources for a node count
+// between two of its rows, and a ladder its value for a count between two of
+// its rungs.
+type Interpolation string
+
+const (
+	// InterpolationStep uses the row with the highest node count not above
+	// the actual one, like a ladder.  This is the default.
+	InterpolationStep Interpolation = "step"
+	// InterpolationLinear interpolates linearly between the rows around the
+	// actual node count.
+	InterpolationLinear Interpolation = "linear"
+)
+
+func (i Interpolation) validate() error {
+	switch i {
+	case "", InterpolationStep, InterpolationLinear:
+		return nil
+	}
+	return fmt.Errorf("unknown interpolation %q, must be %q or %q", string(i), InterpolationStep, InterpolationLinear)
+}
+
+// LookupTableConfig computes the cpu and memory requests of a container from
+// a table of node counts in a CSV file, as an alternative to ladders.  The
+// table is loaded by ScaleConfig.LoadLookupTables, and loaded again whenever
+// its file changes.
+//
+// Example file:
+//
+//	node_count,cpu,memory
+//	0,100m,128Mi
+//	50,250m,256Mi
+//	200,1,1Gi
+type LookupTableConfig struct {
+	// The CSV file of node_count,cpu,memory rows, e.g. in a mounted
+	// ConfigMap.
+	File string
+	// How node counts between rows are looked up.
+	Interpolation Interpolation
+
+	// The table and the modification time of its file, once loaded.
+	table   *LookupTable
+	modTime time.Time
+}
+
+func (ltc *LookupTableConfig) validate() error {
+	if ltc.File == "" {
+		return fmt.Errorf("lookupTable needs a file")
+	}
+	return ltc.Interpolation.validate()
+}
+
+// load reads the table from the file.
+func (ltc *LookupTableConfig) load() error {
+	f, err := os.Open(ltc.File)
+	if err != nil {
+		return fmt.Errorf("can't read lookup table: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("can't read lookup table: %v", err)
+	}
+	table, err := ParseLookupTable(f)
+	if err != nil {
+		return fmt.Errorf("invalid lookup table %q: %v", ltc.File, err)
+	}
+	ltc.table = table
+	ltc.modTime = fi.ModTime()
+	return nil
+}
+
+// changed returns whether the file changed since the table was loaded, or
+// can't be read any more.
+func (ltc *LookupTableConfig) changed() bool {
+	fi, err := os.Stat(ltc.File)
+	return err != nil || !fi.ModTime().Equal(ltc.modTime)
+}
+
+func (ltc *LookupTableConfig) String() string {
+	return fmt.Sprintf("{ file=%s interpolation=%s }", ltc.File, ltc.Interpolation)
+}
+
+// DeepCopy copies the config.  The loaded table is shared, as it is never
+// changed.
+func (ltc *LookupTableConfig) DeepCopy() *LookupTableConfig {
+	out := *ltc
+	return &out
+}
+
+// LoadLookupTables loads the lookup table of every container which has one.
+func (sc ScaleConfig) LoadLookupTables() error {
+	for _, ctr := range sortedConfigNames(sc) {
+		if ltc := sc[ctr].LookupTable; ltc != nil {
+			if err := ltc.load(); err != nil {
+				return fmt.Errorf("container %q: %v", ctr, err)
+			}
+		}
+	}
+	return nil
+}
+
+// reloadChangedLookupTables loads the lookup tables whose files changed
+// again, and returns whether any did.  A table whose file is now invalid
+// is kept.
+func (sc ScaleConfig) reloadChangedLookupTables() (bool, error) {
+	reloaded := false
+	for _, ctr := range sortedConfigNames(sc) {
+		ltc := sc[ctr].LookupTable
+		if ltc == nil || !ltc.changed() {
+			continue
+		}
+		if err := ltc.load(); err != nil {
+			return reloaded, fmt.Errorf("container %q: %v", ctr, err)
+		}
+		glog.V(0).Infof("Reloaded the lookup table of container %q from %s", ctr, ltc.File)
+		reloaded = true
+	}
+	return reloaded, nil
+}
+
+// LookupRow is a row of a LookupTable.
+type LookupRow struct {
+	Nodes  int
+	CPU    resource.Quantity
+	Memory resource.Quantity
+}
+
+// LookupTable maps node counts to cpu and memory, sorted by node count.
+type LookupTable struct {
+	Rows []LookupRow
+}
+
+// lookupTableHeader is the optional first row of a lookup table.
+var lookupTableHeader = []string{"node_count", "cpu", "memory"}
+
+// ParseLookupTable reads a lookup table from CSV, with an optional header.
+// Every row must have a whole, non-negative node count, which no other row
+// has, and non-negative quantities of cpu and memory.  Lines starting with
+// '#' are ignored.
+func ParseLookupTable(r io.Reader) (*LookupTable, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = len(lookupTableHeader)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && strings.EqualFold(strings.TrimSpace(records[0][0]), lookupTableHeader[0]) {
+		for i, name := range lookupTableHeader {
+			if !strings.EqualFold(strings.TrimSpace(records[0][i]), name) {
+				return nil, fmt.Errorf("header must be %s", strings.Join(lookupTableHeader, ","))
+			}
+		}
+		records = records[1:]
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no rows")
+	}
+	table := &LookupTable{}
+	seen := map[int]bool{}
+	for i, record := range records {
+		row, err := parseLookupRow(record)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		if seen[row.Nodes] {
+			return nil, fmt.Errorf("row %d: node count %d is repeated", i+1, row.Nodes)
+		}
+		seen[row.Nodes] = true
+		table.Rows = append(table.Rows, row)
+	}
+	sort.Slice(table.Rows, func(i, j int) bool {
+		return table.Rows[i].Nodes < table.Rows[j].Nodes
+	})
+	return table, nil
+}
+
+func parseLookupRow(record []string) (LookupRow, error) {
+	row := LookupRow{}
+	nodes, err := strconv.Atoi(strings.TrimSpace(record[0]))
+	if err != nil || nodes < 0 {
+		return row, fmt.Errorf("node count must be a whole, non-negative number, got %q", record[0])
+	}
+	row.Nodes = nodes
+	for i, q := range []*resource.Quantity{&row.CPU, &row.Memory} {
+		name := lookupTableHeader[i+1]
+		parsed, err := resource.ParseQuantity(strings.TrimSpace(record[i+1]))
+		if err != nil {
+			return row, fmt.Errorf("invalid %s %q: %v", name, record[i+1], err)
+		}
+		if parsed.Sign() < 0 {
+			return row, fmt.Errorf("%s cannot be negative, got %q", name, record[i+1])
+		}
+		*q = parsed
+	}
+	return row, nil
+}
+
+// Lookup returns the cpu and memory for the number of nodes.  Below the first
+// row, the first row applies, and above the last row, the last one.
+// Interpolated values are rounded up, to whole millicores and bytes.
+func (t *LookupTable) Lookup(nodes int, interpolation Interpolation) (cpu, memory resource.Quantity) {
+	// The first row above nodes.
+	i := sort.Search(len(t.Rows), func(i int) bool { return t.Rows[i].Nodes > nodes })
+	if i == 0 {
+		return t.Rows[0].CPU.DeepCopy(), t.Rows[0].Memory.DeepCopy()
+	}
+	lo := t.Rows[i-1]
+	if i == len(t.Rows) || interpolation != InterpolationLinear {
+		return lo.CPU.DeepCopy(), lo.Memory.DeepCopy()
+	}
+	hi := t.Rows[i]
+	frac := float64(nodes-lo.Nodes) / float64(hi.Nodes-lo.Nodes)
+	between := func(a, b int64) int64 {
+		return int64(math.Ceil(float64(a) + frac*float64(b-a)))
+	}
+	cpu = *resource.NewMilliQuantity(between(lo.CPU.MilliValue(), hi.CPU.MilliValue()), resource.DecimalSI)
+	memory = *resource.NewQuantity(between(lo.Memory.Value(), hi.Memory.Value()), resource.BinarySI)
+	return cpu, memory
+}
+
+// applyLookupTable sets the cpu and memory requests from the container's
+// lookup table, if it has a loaded one.
+func applyLookupTable(ctr string, cfg ContainerScaleConfig, nodes int, reqs apiv1.ResourceRequirements) {
+	if cfg.LookupTable == nil || cfg.LookupTable.table == nil {
+		return
+	}
+	cpu, memory := cfg.LookupTable.table.Lookup(nodes, cfg.LookupTable.Interpolation)
+	reqs.Requests[apiv1.ResourceCPU] = cpu
+	reqs.Requests[apiv1.ResourceMemory] = memory
+	glog.V(4).Infof("Looked up %s requests for %d nodes: cpu %v, memory %v", ctr, nodes, &cpu, &memory)
+}
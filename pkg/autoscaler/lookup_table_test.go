@@ -0,0 +1,217 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	realk8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestParseLookupTable(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expNodes []int
+		expError bool
+	}{
+		{"header", "node_count,cpu,memory\n0,100m,128Mi\n50,250m,256Mi\n", []int{0, 50}, false},
+		{"no header", "0,100m,128Mi\n50,250m,256Mi\n", []int{0, 50}, false},
+		{"unsorted", "200,1,1Gi\n0,100m,128Mi\n50,250m,256Mi\n", []int{0, 50, 200}, false},
+		{"comments and spaces", "# Capacity plan\nnode_count, cpu, memory\n10, 100m, 128Mi\n", []int{10}, false},
+		{"empty", "", nil, true},
+		{"header only", "node_count,cpu,memory\n", nil, true},
+		{"wrong header", "nodes,cpu,memory\n0,100m,128Mi\n", nil, true},
+		{"misnamed header", "node_count,memory,cpu\n0,100m,128Mi\n", nil, true},
+		{"missing column", "0,100m\n", nil, true},
+		{"extra column", "0,100m,128Mi,1\n", nil, true},
+		{"fractional node count", "1.5,100m,128Mi\n", nil, true},
+		{"negative node count", "-1,100m,128Mi\n", nil, true},
+		{"repeated node count", "10,100m,128Mi\n10,200m,256Mi\n", nil, true},
+		{"invalid cpu", "0,lots,128Mi\n", nil, true},
+		{"negative memory", "0,100m,-128Mi\n", nil, true},
+	}
+	for _, tc := range testCases {
+		table, err := ParseLookupTable(strings.NewReader(tc.data))
+		if tc.expError {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tc.name, table.Rows)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		var nodes []int
+		for _, row := range table.Rows {
+			nodes = append(nodes, row.Nodes)
+		}
+		if len(nodes) != len(tc.expNodes) {
+			t.Errorf("%s: expected rows for %v nodes, got %v", tc.name, tc.expNodes, nodes)
+			continue
+		}
+		for i := range nodes {
+			if nodes[i] != tc.expNodes[i] {
+				t.Errorf("%s: expected rows for %v nodes, got %v", tc.name, tc.expNodes, nodes)
+				break
+			}
+		}
+	}
+}
+
+func TestLookupTable(t *testing.T) {
+	table, err := ParseLookupTable(strings.NewReader("10,100m,100Mi\n50,300m,200Mi\n100,1,1Gi\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testCases := []struct {
+		nodes         int
+		interpolation Interpolation
+		expCPU        string
+		expMemory     string
+	}{
+		{0, InterpolationStep, "100m", "100Mi"},
+		{10, InterpolationStep, "100m", "100Mi"},
+		{49, InterpolationStep, "100m", "100Mi"},
+		{50, InterpolationStep, "300m", "200Mi"},
+		{500, InterpolationStep, "1", "1Gi"},
+		{0, InterpolationLinear, "100m", "100Mi"},
+		{30, InterpolationLinear, "200m", "150Mi"},
+		{31, InterpolationLinear, "205m", "156160Ki"},
+		{75, InterpolationLinear, "650m", "612Mi"},
+		{100, InterpolationLinear, "1", "1Gi"},
+		{500, InterpolationLinear, "1", "1Gi"},
+		{30, "", "100m", "100Mi"},
+	}
+	for _, tc := range testCases {
+		cpu, memory := table.Lookup(tc.nodes, tc.interpolation)
+		if exp := resource.MustParse(tc.expCPU); cpu.Cmp(exp) != 0 {
+			t.Errorf("%d nodes, %q: expected cpu %s, got %s", tc.nodes, tc.interpolation, tc.expCPU, cpu.String())
+		}
+		if exp := resource.MustParse(tc.expMemory); memory.Cmp(exp) != 0 {
+			t.Errorf("%d nodes, %q: expected memory %s, got %s", tc.nodes, tc.interpolation, tc.expMemory, memory.String())
+		}
+	}
+}
+
+func TestLookupTableConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpva-lookup")
+	if err != nil {
+		t.Fatalf("can't create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "dns.csv")
+	write := func(data string, modTime time.Time) {
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatalf("can't write lookup table: %v", err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("can't set modification time: %v", err)
+		}
+	}
+	now := time.Now()
+	write("node_count,cpu,memory\n0,100m,128Mi\n10,200m,256Mi\n", now)
+
+	cfg := ScaleConfig{}
+	asConfig := `{"dns": {"lookupTable": {"file": "` + file + `", "interpolation": "linear"}, "limits": {"memory": {"base": "1Gi"}}}}`
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     &k8sclient.MockK8sClient{},
+		target:        "deployment/dns",
+		defaultTarget: "deployment/dns",
+		defaultConfig: cfg,
+	}
+	if _, err := autoScaler.refreshConfig(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect := func(step string, nodes int, expCPU, expMemory string) {
+		t.Helper()
+		reqs := autoScaler.recommend(&realk8sclient.ClusterSize{Nodes: nodes})["dns"]
+		cpu := reqs.Requests[apiv1.ResourceCPU]
+		memory := reqs.Requests[apiv1.ResourceMemory]
+		if cpu.Cmp(resource.MustParse(expCPU)) != 0 || memory.Cmp(resource.MustParse(expMemory)) != 0 {
+			t.Errorf("%s: expected cpu %s and memory %s, got %s and %s", step, expCPU, expMemory, cpu.String(), memory.String())
+		}
+		limit := reqs.Limits[apiv1.ResourceMemory]
+		if limit.Cmp(resource.MustParse("1Gi")) != 0 {
+			t.Errorf("%s: expected the memory limit to be computed as usual, got %s", step, limit.String())
+		}
+	}
+	expect("loaded", 5, "150m", "192Mi")
+
+	// An unchanged file is not loaded again.
+	if changed, err := autoScaler.refreshConfig(); changed || err != nil {
+		t.Errorf("expected no change, got %v, %v", changed, err)
+	}
+
+	// A malformed table is rejected, and the old one kept.
+	write("node_count,cpu,memory\n0,100m\n", now.Add(time.Minute))
+	if _, err := autoScaler.refreshConfig(); err == nil {
+		t.Errorf("expected an error for a malformed table")
+	}
+	expect("malformed", 5, "150m", "192Mi")
+
+	write("node_count,cpu,memory\n0,1,1Gi\n", now.Add(2*time.Minute))
+	if changed, err := autoScaler.refreshConfig(); !changed || err != nil {
+		t.Errorf("expected the table to be reloaded, got %v, %v", changed, err)
+	}
+	expect("reloaded", 5, "1", "1Gi")
+}
+
+func TestValidateLookupTableConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expError bool
+	}{
+		{"step", `{"foo": {"lookupTable": {"file": "/etc/cpva/foo.csv"}}}`, false},
+		{"linear", `{"foo": {"lookupTable": {"file": "/etc/cpva/foo.csv", "interpolation": "linear"}}}`, false},
+		{"no file", `{"foo": {"lookupTable": {"interpolation": "linear"}}}`, true},
+		{"unknown interpolation", `{"foo": {"lookupTable": {"file": "/etc/cpva/foo.csv", "interpolation": "cubic"}}}`, true},
+		{"cpu also configured", `{"foo": {"lookupTable": {"file": "/etc/cpva/foo.csv"}, "requests": {"cpu": {"base": "10m"}}}}`, true},
+		{"other resources configured", `{"foo": {"lookupTable": {"file": "/etc/cpva/foo.csv"}, "requests": {"ephemeral-storage": {"base": "1Gi"}}}}`, false},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(tc.data), &cfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tc.name, err)
+		}
+		err := cfg.Validate()
+		if tc.expError && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.expError && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+}
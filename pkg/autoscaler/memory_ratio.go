@@ -0,0 +1,78 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"math/big"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// MemoryToCPURatio bounds the memory per core of every container, to catch
+// configs which recommend e.g. 100 cores with 1Mi of memory.  A nil bound is
+// not checked.
+type MemoryToCPURatio struct {
+	// The least and most memory per core, e.g. "512Mi" and "16Gi".
+	Min *resource.Quantity
+	Max *resource.Quantity
+}
+
+// Check returns an error for the first container whose requests or limits
+// are out of bounds.  Only resource lists which have both a memory and a
+// positive CPU quantity are checked.
+func (r *MemoryToCPURatio) Check(reqs map[string]apiv1.ResourceRequirements) error {
+	names := map[string]bool{}
+	for ctr := range reqs {
+		names[ctr] = true
+	}
+	for _, ctr := range sortedNames(names) {
+		for _, kind := range []struct {
+			name string
+			list apiv1.ResourceList
+		}{
+			{"requests", reqs[ctr].Requests},
+			{"limits", reqs[ctr].Limits},
+		} {
+			cpu, hasCPU := kind.list[apiv1.ResourceCPU]
+			mem, hasMem := kind.list[apiv1.ResourceMemory]
+			if !hasCPU || !hasMem || cpu.Sign() <= 0 {
+				continue
+			}
+			if r.Min != nil && compareRatio(mem, cpu, r.Min) < 0 {
+				return fmt.Errorf("container %q: %s of %s memory for %s CPU are below the minimum of %s per core",
+					ctr, kind.name, mem.String(), cpu.String(), r.Min.String())
+			}
+			if r.Max != nil && compareRatio(mem, cpu, r.Max) > 0 {
+				return fmt.Errorf("container %q: %s of %s memory for %s CPU are above the maximum of %s per core",
+					ctr, kind.name, mem.String(), cpu.String(), r.Max.String())
+			}
+		}
+	}
+	return nil
+}
+
+// compareRatio compares mem/cpu, the memory per core, with ratio, the way
+// that Quantity.Cmp does.  It multiplies rather than divides, so that it is
+// exact.
+func compareRatio(mem, cpu resource.Quantity, ratio *resource.Quantity) int {
+	// mem / (cpuMilli / 1000) <=> ratio  iff  mem * 1000 <=> ratio * cpuMilli
+	left := new(big.Int).Mul(big.NewInt(mem.Value()), big.NewInt(1000))
+	right := new(big.Int).Mul(big.NewInt(ratio.Value()), big.NewInt(cpu.MilliValue()))
+	return left.Cmp(right)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestMemoryToCPURatio(t *testing.T) {
+	q := func(s string) *resource.Quantity {
+		v := resource.MustParse(s)
+		return &v
+	}
+	list := func(cpu, mem string) apiv1.ResourceList {
+		l := apiv1.ResourceList{}
+		if cpu != "" {
+			l[apiv1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if mem != "" {
+			l[apiv1.ResourceMemory] = resource.MustParse(mem)
+		}
+		return l
+	}
+	ratio := &MemoryToCPURatio{Min: q("512Mi"), Max: q("8Gi")}
+	for _, tc := range []struct {
+		name     string
+		ratio    *MemoryToCPURatio
+		reqs     apiv1.ResourceRequirements
+		expError bool
+	}{
+		{"within bounds", ratio, apiv1.ResourceRequirements{Requests: list("2", "4Gi")}, false},
+		{"at the minimum", ratio, apiv1.ResourceRequirements{Requests: list("500m", "256Mi")}, false},
+		{"at the maximum", ratio, apiv1.ResourceRequirements{Requests: list("250m", "2Gi")}, false},
+		{"below the minimum", ratio, apiv1.ResourceRequirements{Requests: list("100", "1Mi")}, true},
+		{"above the maximum", ratio, apiv1.ResourceRequirements{Requests: list("10m", "1Gi")}, true},
+		{"limits out of bounds", ratio, apiv1.ResourceRequirements{Requests: list("1", "1Gi"), Limits: list("1", "64Gi")}, true},
+		{"no memory", ratio, apiv1.ResourceRequirements{Requests: list("100", "")}, false},
+		{"no CPU", ratio, apiv1.ResourceRequirements{Requests: list("", "64Gi")}, false},
+		{"zero CPU", ratio, apiv1.ResourceRequirements{Requests: list("0", "64Gi")}, false},
+		{"no minimum", &MemoryToCPURatio{Max: q("8Gi")}, apiv1.ResourceRequirements{Requests: list("100", "1Mi")}, false},
+		{"no maximum", &MemoryToCPURatio{Min: q("512Mi")}, apiv1.ResourceRequirements{Requests: list("10m", "1Gi")}, false},
+	} {
+		err := tc.ratio.Check(map[string]apiv1.ResourceRequirements{"foo": tc.reqs})
+		if (err != nil) != tc.expError {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.expError, err)
+		}
+	}
+}
+
+func TestMemoryToCPURatioSkipsTheUpdate(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "1", "step": "1", "nodesPerStep": 1}, "memory": {"base": "1Gi"}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	maxRatio := resource.MustParse("512Mi")
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 1, NumOfCores: 4}
+	autoScaler := &AutoScaler{
+		namespace:        "default",
+		target:           "deployment/foo",
+		defaultTarget:    "deployment/foo",
+		k8sClient:        mockK8s,
+		defaultConfig:    cfg,
+		memoryToCPURatio: &MemoryToCPURatio{Max: &maxRatio},
+	}
+	// 2 cores with 1Gi is within bounds.
+	autoScaler.pollAPIServer(context.Background())
+	if autoScaler.lastReqs == nil {
+		t.Fatalf("expected the recommendation to be applied")
+	}
+	// 1 core with 1Gi is not.
+	autoScaler.currentConfig = nil
+	autoScaler.defaultConfig = ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "1"}, "memory": {"base": "1Gi"}}}}`), &autoScaler.defaultConfig); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	autoScaler.pollAPIServer(context.Background())
+	cpu := autoScaler.lastReqs["foo"].Requests[apiv1.ResourceCPU]
+	if cpu.String() != "2" {
+		t.Errorf("expected the unbalanced recommendation to be skipped, got %s", cpu.String())
+	}
+	if len(autoScaler.updateFailures) != 1 {
+		t.Errorf("expected the skipped update to be counted as a failure, got %v", autoScaler.updateFailures)
+	}
+}
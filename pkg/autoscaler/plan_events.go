@@ -0,0 +1,88 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+
+	"github.com/golang/glog"
+)
+
+// planEventReason is the reason of the events which PlanEventRecorder emits.
+const planEventReason = "ComputedPlan"
+
+// PlanEventRecorder summarizes the cluster size and the computed resources as
+// events on the autoscaler's own pod.  An event is recorded when the summary
+// changes, and otherwise at most once per Period.
+type PlanEventRecorder struct {
+	PodNamespace string
+	PodName      string
+	Period       time.Duration
+
+	lastMessage string
+	lastTime    time.Time
+}
+
+// Record emits an event for the plan if it is due.
+func (r *PlanEventRecorder) Record(client k8sclient.K8sClient, now time.Time, clusterSize *k8sclient.ClusterSize, reqs map[string]apiv1.ResourceRequirements) {
+	msg := planMessage(clusterSize, reqs)
+	if msg == r.lastMessage && now.Sub(r.lastTime) < r.Period {
+		return
+	}
+	if err := client.RecordPodEvent(r.PodNamespace, r.PodName, planEventReason, msg); err != nil {
+		glog.Errorf("Failed to record event on pod %s/%s: %v", r.PodNamespace, r.PodName, err)
+		return
+	}
+	r.lastMessage = msg
+	r.lastTime = now
+}
+
+// planMessage formats e.g. "nodes: 3, cores: 12; foo: cpu=100m memory=64Mi".
+func planMessage(clusterSize *k8sclient.ClusterSize, reqs map[string]apiv1.ResourceRequirements) string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("nodes: %d, cores: %d", clusterSize.Nodes, clusterSize.Cores))
+	ctrs := []string{}
+	for ctr := range reqs {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	for i, ctr := range ctrs {
+		if i == 0 {
+			buf.WriteString("; ")
+		} else {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(ctr + ":")
+		resNames := []string{}
+		for res := range reqs[ctr].Requests {
+			resNames = append(resNames, string(res))
+		}
+		sort.Strings(resNames)
+		for _, res := range resNames {
+			q := reqs[ctr].Requests[apiv1.ResourceName(res)]
+			buf.WriteString(fmt.Sprintf(" %s=%s", res, q.String()))
+		}
+	}
+	return buf.String()
+}
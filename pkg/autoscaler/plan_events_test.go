@@ -0,0 +1,61 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"testing"
+	"time"
+
+	realk8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPlanEventRecorder(t *testing.T) {
+	reqs := map[string]apiv1.ResourceRequirements{
+		"foo": {Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse("100m"),
+			apiv1.ResourceMemory: resource.MustParse("64Mi"),
+		}},
+	}
+	small := &realk8sclient.ClusterSize{Nodes: 3, Cores: 12}
+	big := &realk8sclient.ClusterSize{Nodes: 4, Cores: 16}
+
+	mockK8s := &k8sclient.MockK8sClient{}
+	r := &PlanEventRecorder{PodNamespace: "kube-system", PodName: "cpva", Period: 10 * time.Minute}
+	start := time.Now()
+
+	r.Record(mockK8s, start, small, reqs)
+	r.Record(mockK8s, start.Add(time.Minute), small, reqs) // Unchanged.
+	r.Record(mockK8s, start.Add(2*time.Minute), big, reqs)
+	r.Record(mockK8s, start.Add(12*time.Minute), big, reqs) // Period elapsed.
+
+	expected := []string{
+		"nodes: 3, cores: 12; foo: cpu=100m memory=64Mi",
+		"nodes: 4, cores: 16; foo: cpu=100m memory=64Mi",
+		"nodes: 4, cores: 16; foo: cpu=100m memory=64Mi",
+	}
+	if len(mockK8s.Events) != len(expected) {
+		t.Fatalf("expected events %q, got %q", expected, mockK8s.Events)
+	}
+	for i := range expected {
+		if mockK8s.Events[i] != expected[i] {
+			t.Errorf("event %d: expected %q, got %q", i, expected[i], mockK8s.Events[i])
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testutil checks scaling policies, i.e. configs as given to
+// --default-config, against golden files of the resources they compute.
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+var update = flag.Bool("update", false, "Write the golden files of GoldenTest instead of comparing against them.")
+
+// ClusterSize is one entry of a cluster size file, e.g.
+// "{name: small, nodes: 3, cores: 12, memory: 48Gi}".  The average number of
+// cores per node is derived from the cores and nodes.
+type ClusterSize struct {
+	Name         string `json:"name"`
+	Nodes        int    `json:"nodes"`
+	Cores        int    `json:"cores"`
+	MatchingPods int    `json:"matchingPods"`
+	PendingPods  int    `json:"pendingPods"`
+	// The percentage of the allocatable CPU which pods request.
+	CPUUtilization int               `json:"cpuUtilization"`
+	Memory         resource.Quantity `json:"memory"`
+}
+
+// result is what a policy computes at one cluster size.
+type result struct {
+	Name       string                                `json:"name"`
+	Containers map[string]apiv1.ResourceRequirements `json:"containers"`
+}
+
+// GoldenTest evaluates the policy in policyFile, a JSON config, at each of the
+// cluster sizes in clusterSizeFile, a YAML list of ClusterSize, and compares
+// the resources with the golden file named after both, e.g.
+// "cores.sizes.golden" for "cores.json" and "sizes.yaml", in the directory of
+// policyFile.  With -update, the golden file is written instead.
+func GoldenTest(t *testing.T, policyFile, clusterSizeFile string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(policyFile)
+	if err != nil {
+		t.Fatalf("can't read policy: %v", err)
+	}
+	policy := autoscaler.ScaleConfig{}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		t.Fatalf("invalid policy %s: %v", policyFile, err)
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("invalid policy %s: %v", policyFile, err)
+	}
+	data, err = ioutil.ReadFile(clusterSizeFile)
+	if err != nil {
+		t.Fatalf("can't read cluster sizes: %v", err)
+	}
+	sizes := []ClusterSize{}
+	if err := yaml.UnmarshalStrict(data, &sizes); err != nil {
+		t.Fatalf("invalid cluster sizes %s: %v", clusterSizeFile, err)
+	}
+
+	results := []result{}
+	for _, size := range sizes {
+		cluster := &k8sclient.ClusterSize{
+			Nodes:            size.Nodes,
+			ListedNodes:      size.Nodes,
+			Cores:            size.Cores,
+			MatchingPods:     size.MatchingPods,
+			PendingPods:      size.PendingPods,
+			AverageNodeCores: k8sclient.AverageNodeCores(size.Cores, size.Nodes, 1),
+			Memory:           size.Memory,
+			CPUUtilization:   size.CPUUtilization,
+		}
+		r := result{Name: size.Name, Containers: map[string]apiv1.ResourceRequirements{}}
+		for ctr, cfg := range policy {
+			r.Containers[ctr] = autoscaler.MultiAxisEvaluator{}.Evaluate(ctr, cfg, cluster)
+		}
+		results = append(results, r)
+	}
+	got, err := yaml.Marshal(results)
+	if err != nil {
+		t.Fatalf("can't encode results: %v", err)
+	}
+
+	golden := filepath.Join(filepath.Dir(policyFile), baseName(policyFile)+"."+baseName(clusterSizeFile)+".golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("can't write golden file: %v", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("can't read golden file, run with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s at %s differs from %s (-want +got):\n%s", policyFile, clusterSizeFile, golden, diffLines(string(want), string(got)))
+	}
+}
+
+func baseName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// diffLines lists the lines which differ, by line number.  It doesn't look
+// for moved lines, which is enough to spot a changed quantity.
+func diffLines(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var buf bytes.Buffer
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w == g {
+			continue
+		}
+		if i < len(wl) {
+			fmt.Fprintf(&buf, "%4d - %s\n", i+1, w)
+		}
+		if i < len(gl) {
+			fmt.Fprintf(&buf, "%4d + %s\n", i+1, g)
+		}
+	}
+	return buf.String()
+}
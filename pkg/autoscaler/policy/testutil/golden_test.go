@@ -0,0 +1,58 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestPolicies checks every policy in testdata against the golden files.  Run
+// with -update after changing a policy or the way that resources are
+// computed, and review the changes to the golden files.
+func TestPolicies(t *testing.T) {
+	policies, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policies) == 0 {
+		t.Fatalf("no policies in testdata")
+	}
+	for _, policy := range policies {
+		policy := policy
+		t.Run(baseName(policy), func(t *testing.T) {
+			GoldenTest(t, policy, "testdata/sizes.yaml")
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	testCases := []struct {
+		want string
+		got  string
+		exp  string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\n", "a\nc\n", "   2 - b\n   2 + c\n"},
+		{"a\n", "a\nb\n", "   2 - \n   2 + b\n"},
+	}
+	for _, tc := range testCases {
+		if got := diffLines(tc.want, tc.got); got != tc.exp {
+			t.Errorf("%q vs %q: expected:\n%s\ngot:\n%s", tc.want, tc.got, tc.exp, got)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+// PolicyStore holds the policy in effect, and one which is about to replace
+// it.  A policy which fails to parse never replaces the active one, so that
+// a broken update of the config file doesn't stop the autoscaler; it keeps
+// scaling with the last valid policy until the file is fixed.
+type PolicyStore struct {
+	active  ScaleConfig
+	pending []byte
+	// The number of policies which failed to parse since startup.
+	parseErrors int
+}
+
+// Stage sets data as the pending policy, replacing any earlier one which was
+// neither promoted nor rejected.
+func (p *PolicyStore) Stage(data []byte) {
+	p.pending = data
+}
+
+// Pending returns the pending policy, or nil if there is none.
+func (p *PolicyStore) Pending() []byte {
+	return p.pending
+}
+
+// Promote makes cfg, parsed from the pending policy or set through the REST
+// API, the active policy, and drops the pending one.
+func (p *PolicyStore) Promote(cfg ScaleConfig) {
+	p.active = cfg
+	p.pending = nil
+}
+
+// Reject drops the pending policy, which failed to parse, and counts the
+// failure.  It returns whether there is an active policy to fall back on.
+func (p *PolicyStore) Reject() bool {
+	p.pending = nil
+	p.parseErrors++
+	return p.active != nil
+}
+
+// Active returns the policy in effect, or nil if none was ever promoted.
+func (p *PolicyStore) Active() ScaleConfig {
+	return p.active
+}
+
+// ParseErrors returns the number of policies which failed to parse since
+// startup.
+func (p *PolicyStore) ParseErrors() int {
+	return p.parseErrors
+}
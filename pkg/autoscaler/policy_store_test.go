@@ -0,0 +1,144 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestPolicyStore(t *testing.T) {
+	store := PolicyStore{}
+	store.Stage([]byte("{"))
+	if store.Reject() {
+		t.Errorf("expected no policy to fall back on")
+	}
+	cfg := ScaleConfig{"foo": {}}
+	store.Stage([]byte(`{"foo": {}}`))
+	store.Promote(cfg)
+	if store.Pending() != nil {
+		t.Errorf("expected the pending policy to be dropped once promoted")
+	}
+	store.Stage([]byte("{"))
+	if !store.Reject() {
+		t.Errorf("expected to fall back on the active policy")
+	}
+	if store.Pending() != nil {
+		t.Errorf("expected the pending policy to be dropped once rejected")
+	}
+	if _, found := store.Active()["foo"]; !found {
+		t.Errorf("expected the active policy to be kept, got %v", store.Active())
+	}
+	if store.ParseErrors() != 2 {
+		t.Errorf("expected 2 parse errors, got %d", store.ParseErrors())
+	}
+}
+
+func TestRefreshConfigKeepsLastValidConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpva-config")
+	if err != nil {
+		t.Fatalf("can't create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.json")
+	// Replaced like a ConfigMap volume, so that the file changes.
+	write := func(data string) {
+		tmp := filepath.Join(dir, "tmp")
+		if err := ioutil.WriteFile(tmp, []byte(data), 0644); err != nil {
+			t.Fatalf("can't write config file: %v", err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			t.Fatalf("can't replace config file: %v", err)
+		}
+	}
+
+	autoScaler := &AutoScaler{
+		k8sClient:     &k8sclient.MockK8sClient{},
+		target:        "deployment/thing",
+		defaultTarget: "deployment/thing",
+		configFile:    file,
+	}
+	write(`{"foo": {"requests": {"cpu": {"base": "10m"}}}}`)
+	if changed, err := autoScaler.refreshConfig(); err != nil || !changed {
+		t.Fatalf("expected the config to change, got %v, %v", changed, err)
+	}
+
+	write(`{"bar": {"requests": {"cpu": {"base": "10m"}}`)
+	if changed, err := autoScaler.refreshConfig(); err != nil || changed {
+		t.Fatalf("expected the last valid config to be kept, got %v, %v", changed, err)
+	}
+	if _, found := autoScaler.currentConfig["foo"]; !found || len(autoScaler.currentConfig) != 1 {
+		t.Errorf("unexpected config: %v", autoScaler.currentConfig)
+	}
+	if n := autoScaler.policies.ParseErrors(); n != 1 {
+		t.Errorf("expected 1 parse error, got %d", n)
+	}
+	// The broken file isn't parsed again.
+	if _, err := autoScaler.refreshConfig(); err != nil || autoScaler.policies.ParseErrors() != 1 {
+		t.Errorf("expected the broken file to be skipped, got %v and %d parse errors", err, autoScaler.policies.ParseErrors())
+	}
+
+	write(`{"bar": {"requests": {"cpu": {"base": "10m"}}}}`)
+	if changed, err := autoScaler.refreshConfig(); err != nil || !changed {
+		t.Fatalf("expected the config to change, got %v, %v", changed, err)
+	}
+	if _, found := autoScaler.currentConfig["bar"]; !found || len(autoScaler.currentConfig) != 1 {
+		t.Errorf("unexpected config: %v", autoScaler.currentConfig)
+	}
+}
+
+func TestRefreshConfigValidatesContainers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpva-config")
+	if err != nil {
+		t.Fatalf("can't create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(file, []byte(`{"bar": {"requests": {"cpu": {"base": "10m"}}}}`), 0644); err != nil {
+		t.Fatalf("can't write config file: %v", err)
+	}
+
+	mockK8s := &k8sclient.MockK8sClient{ContainersErr: errors.New(`container "bar" not found`)}
+	autoScaler := &AutoScaler{
+		k8sClient:      mockK8s,
+		target:         "deployment/thing",
+		defaultTarget:  "deployment/thing",
+		defaultConfig:  ScaleConfig{"foo": {}},
+		configFile:     file,
+		validateTarget: true,
+	}
+	if changed, err := autoScaler.refreshConfig(); err == nil || changed {
+		t.Fatalf("expected the config not to be loaded, got %v, %v", changed, err)
+	}
+	if autoScaler.currentConfig != nil {
+		t.Errorf("unexpected config: %v", autoScaler.currentConfig)
+	}
+
+	// Once the target has the container, the same file is loaded.
+	mockK8s.ContainersErr = nil
+	if changed, err := autoScaler.refreshConfig(); err != nil || !changed {
+		t.Fatalf("expected the config to change, got %v, %v", changed, err)
+	}
+	if _, found := autoScaler.currentConfig["bar"]; !found {
+		t.Errorf("unexpected config: %v", autoScaler.currentConfig)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// PollBackoff lengthens the poll period while the scale cycles fail, so that
+// a struggling apiserver isn't polled as often: every failed cycle doubles
+// it, up to Max.  It goes back to Base after ResetSuccesses successful
+// cycles in a row; with more than 1, an intermittent outage doesn't flap
+// between fast and slow polling.
+type PollBackoff struct {
+	Base           time.Duration
+	Max            time.Duration
+	ResetSuccesses int
+
+	period    time.Duration
+	successes int
+}
+
+// NewPollBackoff returns a PollBackoff which polls every base period until a
+// cycle fails.
+func NewPollBackoff(base, max time.Duration, resetSuccesses int) *PollBackoff {
+	return &PollBackoff{Base: base, Max: max, ResetSuccesses: resetSuccesses, period: base}
+}
+
+// Record records the outcome of a scale cycle, which failed if err isn't nil.
+func (b *PollBackoff) Record(err error) {
+	if err != nil {
+		b.successes = 0
+		if b.period < b.Max {
+			b.period *= 2
+			if b.period > b.Max {
+				b.period = b.Max
+			}
+			glog.V(0).Infof("Backing off to polling every %v after a failed cycle", b.period)
+		}
+		return
+	}
+	if b.period == b.Base {
+		return
+	}
+	b.successes++
+	if b.successes < b.ResetSuccesses {
+		glog.V(2).Infof("%d of %d successful cycles before polling every %v again", b.successes, b.ResetSuccesses, b.Base)
+		return
+	}
+	glog.V(0).Infof("Polling every %v again after %d successful cycles", b.Base, b.successes)
+	b.period = b.Base
+	b.successes = 0
+}
+
+// Period returns how long to wait until the next poll.
+func (b *PollBackoff) Period() time.Duration {
+	return b.period
+}
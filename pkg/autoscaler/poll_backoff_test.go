@@ -0,0 +1,88 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestPollBackoff(t *testing.T) {
+	failed := errors.New("apiserver unavailable")
+	// An intermittent outage: failures interleaved with single successes,
+	// then a recovery.
+	cycles := []error{failed, failed, nil, failed, nil, failed, failed, failed, failed, nil, nil, nil, nil}
+	testCases := []struct {
+		name           string
+		resetSuccesses int
+		expPeriods     []time.Duration
+	}{
+		{
+			"reset after the first success", 1,
+			[]time.Duration{20, 40, 10, 20, 10, 20, 40, 60, 60, 10, 10, 10, 10},
+		},
+		{
+			"reset after three successes", 3,
+			[]time.Duration{20, 40, 40, 60, 60, 60, 60, 60, 60, 60, 60, 10, 10},
+		},
+	}
+	for _, tc := range testCases {
+		b := NewPollBackoff(10*time.Second, 60*time.Second, tc.resetSuccesses)
+		if b.Period() != 10*time.Second {
+			t.Errorf("%s: expected an initial period of 10s, got %v", tc.name, b.Period())
+		}
+		for i, err := range cycles {
+			b.Record(err)
+			if exp := tc.expPeriods[i] * time.Second; b.Period() != exp {
+				t.Errorf("%s: cycle %d: expected a period of %v, got %v", tc.name, i, exp, b.Period())
+			}
+		}
+	}
+}
+
+func TestPollRecordsBackoff(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "100m", "nodesPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 1, NumOfCores: 4, UpdateErr: errors.New("conflict")}
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		defaultTarget: "deployment/foo",
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+		pollBackoff:   NewPollBackoff(10*time.Second, time.Minute, 1),
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+	autoScaler.pollAPIServer(context.Background())
+	if p := autoScaler.pollBackoff.Period(); p != 20*time.Second {
+		t.Errorf("expected a period of 20s after a failed update, got %v", p)
+	}
+	mockK8s.UpdateErr = nil
+	autoScaler.pollAPIServer(context.Background())
+	if p := autoScaler.pollBackoff.Period(); p != 10*time.Second {
+		t.Errorf("expected a period of 10s after a successful update, got %v", p)
+	}
+}
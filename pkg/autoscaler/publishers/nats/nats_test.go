@@ -0,0 +1,224 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/publishers"
+)
+
+// serveOne accepts one connection, completes the handshake, and sends the
+// first published message on msgs as "subject payload".
+func serveOne(t *testing.T, l net.Listener, msgs chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\"}\r\n")
+	for _, prefix := range []string{"CONNECT ", "PING"} {
+		line, err := r.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, prefix) {
+			t.Errorf("expected %s, got %q (%v)", prefix, line, err)
+			return
+		}
+	}
+	fmt.Fprintf(conn, "PONG\r\n")
+
+	var subject string
+	var size int
+	line, err := r.ReadString('\n')
+	if _, err2 := fmt.Sscanf(line, "PUB %s %d\r\n", &subject, &size); err != nil || err2 != nil {
+		t.Errorf("expected PUB, got %q (%v)", line, err)
+		return
+	}
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Errorf("can't read payload: %v", err)
+		return
+	}
+	msgs <- subject + " " + string(payload[:size])
+}
+
+func TestPublish(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %v", err)
+	}
+	defer l.Close()
+	msgs := make(chan string, 1)
+	go serveOne(t, l, msgs)
+
+	p, err := NewNATSPublisher("nats://" + l.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Close()
+	ev := &publishers.ScaleEvent{
+		Timestamp: time.Unix(1500000000, 0),
+		Plan:      publishers.ScalePlan{Namespace: "kube-system", TargetKind: "deployment", TargetName: "dns.v2", Nodes: 3},
+	}
+	if err := p.Publish(ev); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	payload, err := ev.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case msg := <-msgs:
+		expected := "cpva.scale.kube-system.dns_v2 " + string(payload)
+		if msg != expected {
+			t.Errorf("expected %q, got %q", expected, msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message received")
+	}
+}
+
+// unreachableURL returns the URL of a port with nothing listening.
+func unreachableURL(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return "nats://" + addr
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	p, err := newNATSPublisher(unreachableURL(t), queueSize)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	expected := []time.Duration{minBackoff, 2 * minBackoff, 4 * minBackoff}
+	for i, backoff := range expected {
+		wait, err := p.send("PING\r\n")
+		if err == nil || !strings.Contains(err.Error(), "can't connect") {
+			t.Fatalf("attempt %d: expected a connection error, got %v", i, err)
+		}
+		if p.backoff != backoff || wait != backoff {
+			t.Errorf("attempt %d: expected backoff %v, got %v and wait %v", i, backoff, p.backoff, wait)
+		}
+		// Too soon to try again.
+		now = now.Add(backoff / 2)
+		wait, err = p.send("PING\r\n")
+		if err == nil || !strings.Contains(err.Error(), "reconnecting in") {
+			t.Errorf("attempt %d: expected to wait, got %v", i, err)
+		}
+		if wait != backoff/2 {
+			t.Errorf("attempt %d: expected to wait %v, got %v", i, backoff/2, wait)
+		}
+		now = now.Add(backoff / 2)
+	}
+}
+
+func TestPublishQueueFull(t *testing.T) {
+	// Nothing sends the queued events.
+	p, err := newNATSPublisher(unreachableURL(t), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, expError := range []bool{false, false, true, true} {
+		err := p.Publish(&publishers.ScaleEvent{})
+		if err != nil && !expError {
+			t.Errorf("event %d: unexpected error: %v", i, err)
+		} else if err == nil && expError {
+			t.Errorf("event %d: expected an error, got none", i)
+		}
+	}
+	if p.Dropped() != 2 {
+		t.Errorf("expected 2 dropped events, got %d", p.Dropped())
+	}
+}
+
+func TestCloseDropsUnsentEvents(t *testing.T) {
+	p, err := NewNATSPublisher(unreachableURL(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := p.Publish(&publishers.ScaleEvent{}); err != nil {
+			t.Fatalf("event %d: unexpected error: %v", i, err)
+		}
+	}
+	p.Close()
+	if p.Dropped() != 3 {
+		t.Errorf("expected 3 dropped events, got %d", p.Dropped())
+	}
+}
+
+func TestSubject(t *testing.T) {
+	testCases := []struct {
+		namespace  string
+		name       string
+		expSubject string
+	}{
+		{"kube-system", "dns", "cpva.scale.kube-system.dns"},
+		{"kube-system", "dns.v2", "cpva.scale.kube-system.dns_v2"},
+		{"kube-system", "", "cpva.scale.kube-system"},
+		{"", "", "cpva.scale"},
+	}
+	for _, tc := range testCases {
+		subject := Subject(&publishers.ScalePlan{Namespace: tc.namespace, TargetName: tc.name})
+		if subject != tc.expSubject {
+			t.Errorf("%s/%s: expected %q, got %q", tc.namespace, tc.name, tc.expSubject, subject)
+		}
+	}
+}
+
+func TestNewNATSPublisher(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expAddr  string
+		expUser  string
+		expError bool
+	}{
+		{"nats://nats", "nats:4222", "", false},
+		{"nats://u:p@nats:4333", "nats:4333", "u", false},
+		{"http://nats:4222", "", "", true},
+		{"nats-host:4222", "", "", true},
+	}
+	for _, tc := range testCases {
+		p, err := NewNATSPublisher(tc.url)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%s: unexpected error: %v", tc.url, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%s: expected an error", tc.url)
+			continue
+		}
+		if p.addr != tc.expAddr || p.user != tc.expUser {
+			t.Errorf("%s: expected %s (%q), got %s (%q)", tc.url, tc.expAddr, tc.expUser, p.addr, p.user)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package publishers defines how the autoscaler announces its scaling
+// decisions to external systems.  Each system lives in a sub-package.
+package publishers
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/cpvapb"
+)
+
+// ScalePlan is what the autoscaler decided for a target.
+type ScalePlan struct {
+	// The namespace of the target.
+	Namespace string `json:"namespace"`
+	// The kind of the target, as given by --target, e.g. "deployment".
+	TargetKind string `json:"targetKind"`
+	// The name of the target.
+	TargetName string `json:"targetName"`
+	// The cluster size the plan was computed from.
+	Nodes            int `json:"nodes"`
+	Cores            int `json:"cores"`
+	MatchingPods     int `json:"matchingPods"`
+	PendingPods      int `json:"pendingPods"`
+	AverageNodeCores int `json:"averageNodeCores"`
+	// The resources applied to each container of the target, by container
+	// name.
+	Resources map[string]apiv1.ResourceRequirements `json:"resources"`
+}
+
+// ScaleEvent announces that a plan was applied.
+type ScaleEvent struct {
+	// When the plan was applied.
+	Timestamp time.Time
+	Plan      ScalePlan
+	// The resources of the containers before the plan was applied, by
+	// container name.  Nil if unknown.  Not part of the wire format.
+	Previous map[string]apiv1.ResourceRequirements
+	// Identifies the config the plan was computed from.  Not part of the
+	// wire format.
+	ConfigVersion string
+}
+
+// EventPublisher announces scaling decisions to an external system.
+type EventPublisher interface {
+	// Name identifies the publisher in logs.
+	Name() string
+	// Publish announces one event.
+	Publish(ev *ScaleEvent) error
+}
+
+// DroppingPublisher is a publisher which may drop events, e.g. while its
+// system is unreachable, rather than fail to publish them.
+type DroppingPublisher interface {
+	EventPublisher
+	// Dropped returns the number of events which were dropped since
+	// startup.
+	Dropped() int
+}
+
+// Marshal encodes the event in the protobuf wire format, as described by
+// scale_event.proto.  Maps are encoded in the order of their keys.
+func (ev *ScaleEvent) Marshal() ([]byte, error) {
+	p := &ev.Plan
+	msg := &cpvapb.ScaleEvent{
+		Plan: &cpvapb.ScalePlan{
+			Namespace:        p.Namespace,
+			TargetKind:       p.TargetKind,
+			TargetName:       p.TargetName,
+			Nodes:            int64(p.Nodes),
+			Cores:            int64(p.Cores),
+			MatchingPods:     int64(p.MatchingPods),
+			PendingPods:      int64(p.PendingPods),
+			AverageNodeCores: int64(p.AverageNodeCores),
+			Containers:       cpvapb.ContainerResourcesOf(p.Resources),
+		},
+	}
+	if !ev.Timestamp.IsZero() {
+		msg.TimestampUnixNanos = ev.Timestamp.UnixNano()
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
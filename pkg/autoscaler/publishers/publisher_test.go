@@ -0,0 +1,54 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publishers
+
+import (
+	"bytes"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMarshal(t *testing.T) {
+	ev := &ScaleEvent{
+		Plan: ScalePlan{
+			Namespace: "ns",
+			Nodes:     3,
+			Resources: map[string]apiv1.ResourceRequirements{
+				"c": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+			},
+		},
+	}
+	expected := []byte{
+		0x12, 0x18, // plan
+		0x0a, 0x02, 'n', 's', // namespace
+		0x20, 0x03, // nodes
+		0x4a, 0x10, // containers
+		0x0a, 0x01, 'c', // name
+		0x12, 0x0b, // requests
+		0x0a, 0x03, 'c', 'p', 'u',
+		0x12, 0x04, '1', '0', '0', 'm',
+	}
+	got, err := ev.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("expected % x, got % x", expected, got)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// Readiness tracks whether the scale cycles succeed, for the readiness probe.
+// The autoscaler is ready from its first successful cycle on, until
+// FailureThreshold cycles in a row have failed, so that a brief outage of the
+// apiserver doesn't flap the probe.  It is ready again after the next
+// successful cycle.
+type Readiness struct {
+	FailureThreshold int
+
+	// The poll loop records cycles while the probe is served.
+	mu        sync.Mutex
+	failures  int
+	lastErr   error
+	succeeded bool
+}
+
+// NewReadiness returns a Readiness which is unready after threshold failed
+// cycles in a row.
+func NewReadiness(threshold int) *Readiness {
+	return &Readiness{FailureThreshold: threshold}
+}
+
+// Record records the outcome of a scale cycle, which failed if err isn't nil.
+func (r *Readiness) Record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		if r.failures >= r.FailureThreshold && r.succeeded {
+			glog.V(0).Infof("Ready again after %d failed cycles", r.failures)
+		}
+		r.failures = 0
+		r.lastErr = nil
+		r.succeeded = true
+		return
+	}
+	r.failures++
+	r.lastErr = err
+	if r.failures == r.FailureThreshold && r.succeeded {
+		glog.Warningf("Not ready after %d failed cycles in a row, the last with: %v", r.failures, err)
+	}
+}
+
+// Ready returns whether the autoscaler is ready, and why not if it isn't.
+func (r *Readiness) Ready() (bool, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.succeeded {
+		if r.lastErr != nil {
+			return false, fmt.Sprintf("no cycle has succeeded yet, the last failed with: %v", r.lastErr)
+		}
+		return false, "no cycle has succeeded yet"
+	}
+	if r.failures >= r.FailureThreshold {
+		return false, fmt.Sprintf("%d cycles in a row have failed, the last with: %v", r.failures, r.lastErr)
+	}
+	return true, "ok"
+}
+
+// ServeHTTP answers readiness probes: 200 if ready, and 503 otherwise.
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ready, reason := r.Ready()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, reason)
+}
+
+// startHealthServer serves /readyz from r, and /healthz, which is always ok,
+// at addr, e.g. ":9105", until the process exits.  It returns the address it
+// listens on.
+func startHealthServer(addr string, r *Readiness) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't serve the health checks on %q: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/readyz", r)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			glog.Errorf("Stopped serving the health checks: %v", err)
+		}
+	}()
+	return l.Addr(), nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestReadiness(t *testing.T) {
+	failed := errors.New("apiserver unavailable")
+	testCases := []struct {
+		name      string
+		threshold int
+		cycles    []error
+		expReady  bool
+	}{
+		{"no cycle yet", 3, nil, false},
+		{"never succeeded", 3, []error{failed}, false},
+		{"succeeded", 3, []error{nil}, true},
+		{"below threshold", 3, []error{nil, failed, failed}, true},
+		{"at threshold", 3, []error{nil, failed, failed, failed}, false},
+		{"above threshold", 3, []error{nil, failed, failed, failed, failed}, false},
+		{"recovered", 3, []error{nil, failed, failed, failed, nil}, true},
+		{"not in a row", 3, []error{nil, failed, failed, nil, failed, failed}, true},
+		{"first failure", 1, []error{nil, failed}, false},
+	}
+	for _, tc := range testCases {
+		r := NewReadiness(tc.threshold)
+		for _, err := range tc.cycles {
+			r.Record(err)
+		}
+		if ready, reason := r.Ready(); ready != tc.expReady {
+			t.Errorf("%s: expected ready %v, got %v (%s)", tc.name, tc.expReady, ready, reason)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		expCode := http.StatusOK
+		if !tc.expReady {
+			expCode = http.StatusServiceUnavailable
+		}
+		if rec.Code != expCode {
+			t.Errorf("%s: expected status %d, got %d", tc.name, expCode, rec.Code)
+		}
+	}
+}
+
+func TestPollReadiness(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "100m", "nodesPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 1, NumOfCores: 4}
+	autoScaler := &AutoScaler{
+		namespace:     "default",
+		target:        "deployment/foo",
+		defaultTarget: "deployment/foo",
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+		readiness:     NewReadiness(2),
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+	for i, step := range []struct {
+		nodes    int
+		err      error
+		expReady bool
+	}{
+		{1, nil, true},
+		// One failed update isn't enough.
+		{2, errors.New("conflict"), true},
+		{3, errors.New("conflict"), false},
+		{4, nil, true},
+		// Nothing to update is a success too.
+		{4, errors.New("conflict"), true},
+	} {
+		mockK8s.NumOfNodes = step.nodes
+		mockK8s.UpdateErr = step.err
+		autoScaler.pollAPIServer(context.Background())
+		if ready, reason := autoScaler.readiness.Ready(); ready != step.expReady {
+			t.Errorf("step %d: expected ready %v, got %v (%s)", i, step.expReady, ready, reason)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package recommender asks an external service over HTTP for the resources of
+// the target's containers, so that the recommendation logic can live out of
+// process while the autoscaler reads the cluster and patches the target.
+package recommender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// Request is the body which is posted to the recommender on every poll.
+type Request struct {
+	// Target is the resource being scaled, e.g. "deployment/foo".
+	Target    string `json:"target"`
+	Namespace string `json:"namespace"`
+	// Containers are the containers which the config names.  The response
+	// must have the resources of each of them.
+	Containers  []string    `json:"containers"`
+	ClusterSize ClusterSize `json:"clusterSize"`
+}
+
+// ClusterSize is what the autoscaler counted in the cluster.
+type ClusterSize struct {
+	Nodes            int               `json:"nodes"`
+	Cores            int               `json:"cores"`
+	ListedNodes      int               `json:"listedNodes"`
+	MatchingPods     int               `json:"matchingPods"`
+	PendingPods      int               `json:"pendingPods"`
+	AverageNodeCores int               `json:"averageNodeCores"`
+	Memory           resource.Quantity `json:"memory"`
+	CPUUtilization   int               `json:"cpuUtilization"`
+	GPUs             int               `json:"gpus"`
+	CustomMetric     int               `json:"customMetric"`
+	NodeGroups       map[string]int    `json:"nodeGroups,omitempty"`
+}
+
+// NewClusterSize converts a cluster size for a Request.
+func NewClusterSize(size *k8sclient.ClusterSize) ClusterSize {
+	return ClusterSize{
+		Nodes:            size.Nodes,
+		Cores:            size.Cores,
+		ListedNodes:      size.ListedNodes,
+		MatchingPods:     size.MatchingPods,
+		PendingPods:      size.PendingPods,
+		AverageNodeCores: size.AverageNodeCores,
+		Memory:           size.Memory,
+		CPUUtilization:   size.CPUUtilization,
+		GPUs:             size.GPUs,
+		CustomMetric:     size.CustomMetric,
+		NodeGroups:       size.NodeGroups,
+	}
+}
+
+// Response is the body which the recommender answers with.
+type Response struct {
+	// Resources are the requests and limits of each container.
+	Resources map[string]apiv1.ResourceRequirements `json:"resources"`
+}
+
+// HTTPRecommender posts a Request to a URL, and reads the resources to apply
+// from the Response.
+type HTTPRecommender struct {
+	url            string
+	authHeaderFile string
+	client         *http.Client
+}
+
+// NewHTTPRecommender returns a recommender which posts to rawURL and gives up
+// after timeout.  If authHeaderFile is set, its content is sent as the
+// Authorization header, e.g. "Bearer TOKEN".  It is read for every request,
+// so that a rotated token is picked up.
+func NewHTTPRecommender(rawURL string, timeout time.Duration, authHeaderFile string) (*HTTPRecommender, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recommender URL %q: %v", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid recommender URL %q: must be http:// or https://", rawURL)
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("recommender timeout must be positive, got %v", timeout)
+	}
+	return &HTTPRecommender{
+		url:            rawURL,
+		authHeaderFile: authHeaderFile,
+		client:         &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Recommend posts req, and returns the resources of each of its containers.
+// A response which isn't valid is an error.
+func (r *HTTPRecommender) Recommend(ctx context.Context, req *Request) (map[string]apiv1.ResourceRequirements, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest("POST", r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	if r.authHeaderFile != "" {
+		auth, err := ioutil.ReadFile(r.authHeaderFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the recommender's authorization: %v", err)
+		}
+		httpReq.Header.Set("Authorization", strings.TrimSpace(string(auth)))
+	}
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("posting to the recommender failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading the recommendation failed: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("the recommender failed: %s: %s", resp.Status, data)
+	}
+	var out Response
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("can't decode the recommendation: %v", err)
+	}
+	if err := validate(out.Resources, req.Containers); err != nil {
+		return nil, fmt.Errorf("invalid recommendation: %v", err)
+	}
+	return out.Resources, nil
+}
+
+// validate checks that resources has each of containers and no others, that
+// no quantity is negative, and that no limit is below its request.
+func validate(resources map[string]apiv1.ResourceRequirements, containers []string) error {
+	want := map[string]bool{}
+	for _, ctr := range containers {
+		want[ctr] = true
+		if _, found := resources[ctr]; !found {
+			return fmt.Errorf("no resources for container %q", ctr)
+		}
+	}
+	for ctr, res := range resources {
+		if !want[ctr] {
+			return fmt.Errorf("unknown container %q", ctr)
+		}
+		for kind, list := range map[string]apiv1.ResourceList{"requests": res.Requests, "limits": res.Limits} {
+			for name, q := range list {
+				if q.Sign() < 0 {
+					return fmt.Errorf("%s %s[%q] is negative: %s", ctr, kind, name, q.String())
+				}
+			}
+		}
+		for name, limit := range res.Limits {
+			if req, found := res.Requests[name]; found && limit.Cmp(req) < 0 {
+				return fmt.Errorf("%s limits[%q] of %s is below its request of %s", ctr, name, limit.String(), req.String())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package recommender
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+func TestNewHTTPRecommender(t *testing.T) {
+	testCases := []struct {
+		url      string
+		timeout  time.Duration
+		expError bool
+	}{
+		{"http://recommender.default.svc:8080/recommend", time.Second, false},
+		{"https://recommender.example.com", time.Second, false},
+		{"recommender:8080", time.Second, true},
+		{"ftp://recommender", time.Second, true},
+		{"http://", time.Second, true},
+		{"http://recommender", 0, true},
+	}
+	for _, tc := range testCases {
+		_, err := NewHTTPRecommender(tc.url, tc.timeout, "")
+		if err != nil && !tc.expError {
+			t.Errorf("%q: unexpected error: %v", tc.url, err)
+		} else if err == nil && tc.expError {
+			t.Errorf("%q: expected an error, got none", tc.url)
+		}
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recommender")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	authFile := filepath.Join(dir, "auth")
+	if err := ioutil.WriteFile(authFile, []byte("Bearer s3cret\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got Request
+	var auth string
+	response := ""
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth = req.Header.Get("Authorization")
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if response == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	req := &Request{
+		Target:     "deployment/foo",
+		Namespace:  "default",
+		Containers: []string{"app", "sidecar"},
+		ClusterSize: NewClusterSize(&k8sclient.ClusterSize{
+			Nodes:  4,
+			Cores:  16,
+			Memory: resource.MustParse("64Gi"),
+		}),
+	}
+	testCases := []struct {
+		name     string
+		response string
+		status   int
+		expError bool
+	}{
+		{"valid", `{"resources": {"app": {"requests": {"cpu": "500m"}, "limits": {"cpu": "1"}}, "sidecar": {"requests": {"memory": "64Mi"}}}}`, http.StatusOK, false},
+		{"missing container", `{"resources": {"app": {"requests": {"cpu": "500m"}}}}`, http.StatusOK, true},
+		{"unknown container", `{"resources": {"app": {}, "sidecar": {}, "other": {}}}`, http.StatusOK, true},
+		{"negative quantity", `{"resources": {"app": {"requests": {"cpu": "-1"}}, "sidecar": {}}}`, http.StatusOK, true},
+		{"limit below request", `{"resources": {"app": {"requests": {"cpu": "2"}, "limits": {"cpu": "1"}}, "sidecar": {}}}`, http.StatusOK, true},
+		{"invalid quantity", `{"resources": {"app": {"requests": {"cpu": "lots"}}, "sidecar": {}}}`, http.StatusOK, true},
+		{"server error", `oops`, http.StatusInternalServerError, true},
+		{"timeout", "slow", http.StatusOK, true},
+	}
+	for _, tc := range testCases {
+		r, err := NewHTTPRecommender(server.URL, 100*time.Millisecond, authFile)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		response, status = tc.response, tc.status
+		got, auth = Request{}, ""
+		resources, err := r.Recommend(context.Background(), req)
+		if err != nil {
+			if !tc.expError {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if tc.expError {
+			t.Errorf("%s: expected an error, got %v", tc.name, resources)
+			continue
+		}
+		if auth != "Bearer s3cret" {
+			t.Errorf("%s: expected the authorization from the file, got %q", tc.name, auth)
+		}
+		if got.Target != "deployment/foo" || got.ClusterSize.Cores != 16 || got.ClusterSize.Memory.Cmp(resource.MustParse("64Gi")) != 0 {
+			t.Errorf("%s: unexpected request %+v", tc.name, got)
+		}
+		cpu := resources["app"].Requests["cpu"]
+		if cpu.MilliValue() != 500 {
+			t.Errorf("%s: expected a cpu request of 500m, got %s", tc.name, cpu.String())
+		}
+	}
+}
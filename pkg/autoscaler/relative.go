@@ -0,0 +1,137 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// RelativeConfig sizes a resource as a percentage of the same resource of
+// another container in the target, e.g. a sidecar as a quarter of the main
+// container, regardless of the cluster size.
+type RelativeConfig struct {
+	// The reference container.
+	Container string
+	// The percentage of the reference container's quantity, for the same
+	// kind (requests or limits) and resource.
+	Percent int
+}
+
+func (rc *RelativeConfig) validate(ctr string) error {
+	if rc.Container == "" {
+		return fmt.Errorf("relativeTo must name a container")
+	}
+	if rc.Container == ctr {
+		return fmt.Errorf("relativeTo can't refer to the container itself")
+	}
+	if rc.Percent <= 0 {
+		return fmt.Errorf("relativeTo percent must be positive, got %d", rc.Percent)
+	}
+	return nil
+}
+
+// validateReference checks that res of the reference container isn't
+// relative itself, as relative resources are only resolved once.
+func (sc ScaleConfig) validateReference(kind, res, ref string) error {
+	cfgs := sc[ref].Requests
+	if kind == "limits" {
+		cfgs = sc[ref].Limits
+	}
+	if cfgs[res].RelativeTo != nil {
+		return fmt.Errorf("relativeTo container %q, whose %s[%q] is relative too", ref, kind, res)
+	}
+	return nil
+}
+
+// hasRelative reports whether any resource in sc is relative to another
+// container.
+func (sc ScaleConfig) hasRelative() bool {
+	for _, ctrcfg := range sc {
+		for _, cfgs := range []map[string]ResourceScaleConfig{ctrcfg.Requests, ctrcfg.Limits} {
+			for _, rcfg := range cfgs {
+				if rcfg.RelativeTo != nil {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// resolveRelative fills in the resources in reqs, as recommended by cfg,
+// which are relative to another container.  The live target is only read if
+// there are any.
+func (s *AutoScaler) resolveRelative(cfg ScaleConfig, reqs map[string]apiv1.ResourceRequirements) error {
+	if !cfg.hasRelative() {
+		return nil
+	}
+	current, err := s.k8sClient.GetCurrentResources()
+	if err != nil {
+		return fmt.Errorf("can't read the current resources of %s: %v", s.target, err)
+	}
+	applyRelative(cfg, reqs, current)
+	return nil
+}
+
+// applyRelative sets the resources of cfg which are relative to another
+// container in reqs.  A reference container which is configured itself is
+// taken at its new value in reqs, and any other at its value in current.  If
+// the reference has no such quantity, the relative resource stays at its
+// base, which is also the floor; it is capped at its max.
+func applyRelative(cfg ScaleConfig, reqs, current map[string]apiv1.ResourceRequirements) {
+	for ctr, ctrcfg := range cfg {
+		for _, kind := range []struct {
+			name string
+			cfgs map[string]ResourceScaleConfig
+			list func(apiv1.ResourceRequirements) apiv1.ResourceList
+		}{
+			{"requests", ctrcfg.Requests, func(r apiv1.ResourceRequirements) apiv1.ResourceList { return r.Requests }},
+			{"limits", ctrcfg.Limits, func(r apiv1.ResourceRequirements) apiv1.ResourceList { return r.Limits }},
+		} {
+			for res, rcfg := range kind.cfgs {
+				if rcfg.RelativeTo == nil {
+					continue
+				}
+				name := apiv1.ResourceName(res)
+				refs := current
+				if _, found := cfg[rcfg.RelativeTo.Container]; found {
+					refs = reqs
+				}
+				ref, found := kind.list(refs[rcfg.RelativeTo.Container])[name]
+				if !found {
+					glog.V(4).Infof("%s %s[%q] is relative to container %q, which has none, using the base",
+						ctr, kind.name, res, rcfg.RelativeTo.Container)
+					continue
+				}
+				want := ref.MilliValue() * int64(rcfg.RelativeTo.Percent) / 100
+				if rcfg.Base != nil && want < asInt64(rcfg.Base) {
+					want = asInt64(rcfg.Base)
+				}
+				if rcfg.Max != nil && asInt64(rcfg.Max) > 0 && want > asInt64(rcfg.Max) {
+					want = asInt64(rcfg.Max)
+				}
+				r := newQuantity(res, rcfg, rcfg.CPUUnits.round(want, rcfg.Rounding))
+				kind.list(reqs[ctr])[name] = *r
+				glog.V(4).Infof("Calculated %s %s[%q] = %v, %d%% of container %q",
+					ctr, kind.name, res, r, rcfg.RelativeTo.Percent, rcfg.RelativeTo.Container)
+			}
+		}
+	}
+}
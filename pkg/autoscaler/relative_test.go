@@ -0,0 +1,169 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestApplyRelative(t *testing.T) {
+	main := apiv1.ResourceRequirements{
+		Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse("2"),
+			apiv1.ResourceMemory: resource.MustParse("4Gi"),
+		},
+		Limits: apiv1.ResourceList{
+			apiv1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+	}
+	testCases := []struct {
+		name      string
+		config    string
+		current   map[string]apiv1.ResourceRequirements
+		expCPU    string // Of the sidecar's requests.
+		expMemory string // Of the sidecar's limits, if set.
+	}{
+		{
+			"percent of the live reference",
+			`{"sidecar": {"requests": {"cpu": {"base": "10m", "relativeTo": {"container": "main", "percent": 25}}}}}`,
+			map[string]apiv1.ResourceRequirements{"main": main},
+			"500m", "",
+		},
+		{
+			"reference without a request",
+			`{"sidecar": {"requests": {"cpu": {"base": "10m", "relativeTo": {"container": "main", "percent": 25}}}}}`,
+			map[string]apiv1.ResourceRequirements{"main": {}},
+			"10m", "",
+		},
+		{
+			"reference missing from the target",
+			`{"sidecar": {"requests": {"cpu": {"base": "10m", "relativeTo": {"container": "main", "percent": 25}}}}}`,
+			map[string]apiv1.ResourceRequirements{},
+			"10m", "",
+		},
+		{
+			"floored at base",
+			`{"sidecar": {"requests": {"cpu": {"base": "1", "relativeTo": {"container": "main", "percent": 25}}}}}`,
+			map[string]apiv1.ResourceRequirements{"main": main},
+			"1", "",
+		},
+		{
+			"capped at max",
+			`{"sidecar": {"requests": {"cpu": {"base": "10m", "max": "300m", "relativeTo": {"container": "main", "percent": 25}}}}}`,
+			map[string]apiv1.ResourceRequirements{"main": main},
+			"300m", "",
+		},
+		{
+			"configured reference",
+			`{"main": {"requests": {"cpu": {"base": "4"}}}, "sidecar": {"requests": {"cpu": {"base": "10m", "relativeTo": {"container": "main", "percent": 10}}}}}`,
+			map[string]apiv1.ResourceRequirements{"main": main},
+			"400m", "",
+		},
+		{
+			"limits are relative to limits",
+			`{"sidecar": {"requests": {"cpu": {"base": "10m"}}, "limits": {"memory": {"base": "64Mi", "relativeTo": {"container": "main", "percent": 50}}}}}`,
+			map[string]apiv1.ResourceRequirements{"main": main},
+			"10m", "4Gi",
+		},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{}
+		if _, err := parseConfigFile([]byte(tc.config), &cfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tc.name, err)
+		}
+		mockK8s := k8sclient.MockK8sClient{NumOfNodes: 10, NumOfCores: 40}
+		sz, _ := mockK8s.GetClusterSize()
+		reqs := recommendFor(cfg, sz, MultiAxisEvaluator{})
+		applyRelative(cfg, reqs, tc.current)
+
+		got := reqs["sidecar"].Requests[apiv1.ResourceCPU]
+		if expected := resource.MustParse(tc.expCPU); got.Cmp(expected) != 0 {
+			t.Errorf("%s: expected cpu %v, got %v", tc.name, &expected, &got)
+		}
+		if tc.expMemory == "" {
+			continue
+		}
+		got = reqs["sidecar"].Limits[apiv1.ResourceMemory]
+		if expected := resource.MustParse(tc.expMemory); got.Cmp(expected) != 0 {
+			t.Errorf("%s: expected memory limit %v, got %v", tc.name, &expected, &got)
+		}
+	}
+}
+
+func TestValidateRelative(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   string
+		expError bool
+	}{
+		{"valid", `{"sidecar": {"requests": {"cpu": {"relativeTo": {"container": "main", "percent": 25}}}}}`, false},
+		{"no container", `{"sidecar": {"requests": {"cpu": {"relativeTo": {"percent": 25}}}}}`, true},
+		{"itself", `{"sidecar": {"requests": {"cpu": {"relativeTo": {"container": "sidecar", "percent": 25}}}}}`, true},
+		{"zero percent", `{"sidecar": {"requests": {"cpu": {"relativeTo": {"container": "main"}}}}}`, true},
+		{"chained", `{"main": {"requests": {"cpu": {"relativeTo": {"container": "other", "percent": 50}}}}, "sidecar": {"requests": {"cpu": {"relativeTo": {"container": "main", "percent": 25}}}}}`, true},
+		{"other resource of a relative reference", `{"main": {"requests": {"memory": {"relativeTo": {"container": "other", "percent": 50}}}}, "sidecar": {"requests": {"cpu": {"relativeTo": {"container": "main", "percent": 25}}}}}`, false},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{}
+		_, err := parseConfigFile([]byte(tc.config), &cfg)
+		if err != nil && !tc.expError {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if err == nil && tc.expError {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestPollReadsRelativeReference(t *testing.T) {
+	cfg := ScaleConfig{}
+	if _, err := parseConfigFile([]byte(`{"sidecar": {"requests": {"memory": {"base": "32Mi", "relativeTo": {"container": "main", "percent": 10}}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 16,
+		Current: map[string]apiv1.ResourceRequirements{
+			"main": {Requests: apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("1000Mi")}},
+		},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		currentConfig: cfg,
+		clock:         clock.NewFakeClock(time.Now()),
+	}
+	autoScaler.pollAPIServer(context.Background())
+	got := autoScaler.lastReqs["sidecar"].Requests[apiv1.ResourceMemory]
+	if expected := resource.MustParse("100Mi"); got.Cmp(expected) != 0 {
+		t.Errorf("expected memory %v, got %v", &expected, &got)
+	}
+
+	// The main container is resized by someone else.
+	mockK8s.Current["main"].Requests[apiv1.ResourceMemory] = resource.MustParse("2000Mi")
+	autoScaler.pollAPIServer(context.Background())
+	got = autoScaler.lastReqs["sidecar"].Requests[apiv1.ResourceMemory]
+	if expected := resource.MustParse("200Mi"); got.Cmp(expected) != 0 {
+		t.Errorf("expected memory %v, got %v", &expected, &got)
+	}
+}
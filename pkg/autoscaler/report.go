@@ -0,0 +1,104 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/golang/glog"
+)
+
+// Report computes the recommended requests for the target once, and writes
+// them to w alongside the current requests and usage of each container.  It
+// does not change the target.
+func (s *AutoScaler) Report(ctx context.Context, w io.Writer) error {
+	clusterSize, err := s.getClusterSize(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting cluster size: %v", err)
+	}
+	if _, err := s.refreshConfig(); err != nil {
+		return err
+	}
+	recommended := s.recommend(clusterSize)
+
+	current, err := s.k8sClient.GetCurrentResources()
+	if err != nil {
+		return err
+	}
+	applyRelative(s.currentConfig, recommended, current)
+	usage, err := s.k8sClient.GetContainerUsage(ctx)
+	if err != nil {
+		// Not every cluster runs metrics-server.
+		glog.Warningf("Usage is not available: %v", err)
+	}
+
+	fmt.Fprintf(w, "Nodes: %d, cores: %d\n\n", clusterSize.Nodes, clusterSize.Cores)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tRESOURCE\tREQUEST\tUSAGE\tRECOMMENDED\tSTATUS")
+	ctrs := []string{}
+	for ctr := range recommended {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	for _, ctr := range ctrs {
+		resNames := []string{}
+		for res := range recommended[ctr].Requests {
+			resNames = append(resNames, string(res))
+		}
+		sort.Strings(resNames)
+		for _, name := range resNames {
+			res := apiv1.ResourceName(name)
+			rec := recommended[ctr].Requests[res]
+			req, haveReq := current[ctr].Requests[res]
+			use, haveUse := usage[ctr][res]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", ctr, res,
+				quantityOrNA(req, haveReq), quantityOrNA(use, haveUse), rec.String(),
+				provisioning(rec, use, haveUse))
+		}
+	}
+	return tw.Flush()
+}
+
+func quantityOrNA(q resource.Quantity, ok bool) string {
+	if !ok {
+		return "n/a"
+	}
+	return q.String()
+}
+
+// provisioning compares a recommendation to observed usage.  Recommendations
+// below usage are under-provisioned; recommendations more than twice the usage
+// are over-provisioned.
+func provisioning(rec, use resource.Quantity, haveUse bool) string {
+	if !haveUse {
+		return "n/a"
+	}
+	if rec.Cmp(use) < 0 {
+		return "UNDER"
+	}
+	if rec.MilliValue() > 2*use.MilliValue() {
+		return "OVER"
+	}
+	return "ok"
+}
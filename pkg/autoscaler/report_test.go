@@ -0,0 +1,109 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestReport(t *testing.T) {
+	var asConfig = `
+{
+  "fake-agent": {
+    "requests": {
+      "cpu": {
+        "base": "100m", "step":"10m", "nodesPerStep":1
+      },
+      "memory": {
+        "base": "100Mi"
+      }
+    }
+  },
+  "sidecar": {
+    "requests": {
+      "cpu": {
+        "base": "10m"
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	mockK8s := k8sclient.MockK8sClient{
+		NumOfNodes: 10,
+		NumOfCores: 40,
+		Current: map[string]apiv1.ResourceRequirements{
+			"fake-agent": {Requests: apiv1.ResourceList{
+				apiv1.ResourceCPU: resource.MustParse("150m"),
+			}},
+		},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     &mockK8s,
+		defaultConfig: cfg,
+	}
+
+	// Without metrics.
+	var buf bytes.Buffer
+	if err := autoScaler.Report(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, exp := range []string{
+		"fake-agent  cpu       150m     n/a    200m         n/a",
+		"fake-agent  memory    n/a      n/a    104857600    n/a",
+		"sidecar     cpu       n/a      n/a    10m          n/a",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("expected %q in report:\n%s", exp, buf.String())
+		}
+	}
+
+	// With metrics.
+	mockK8s.Usage = map[string]apiv1.ResourceList{
+		"fake-agent": {
+			apiv1.ResourceCPU:    resource.MustParse("250m"),
+			apiv1.ResourceMemory: resource.MustParse("20Mi"),
+		},
+		"sidecar": {
+			apiv1.ResourceCPU: resource.MustParse("8m"),
+		},
+	}
+	buf.Reset()
+	if err := autoScaler.Report(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, exp := range []string{
+		"fake-agent  cpu       150m     250m   200m         UNDER",
+		"fake-agent  memory    n/a      20Mi   104857600    OVER",
+		"sidecar     cpu       n/a      8m     10m          ok",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("expected %q in report:\n%s", exp, buf.String())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"math"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+
+	"github.com/golang/glog"
+)
+
+// ResourceBudget is the cores and memory of the cluster, which are split
+// across the containers of the config by their budgetFraction.  A container's
+// requests are capped at its share of the budget.  Zero cores or memory, e.g.
+// before the cluster size is known, are not split.
+type ResourceBudget struct {
+	Cores  int
+	Memory resource.Quantity
+}
+
+// NewResourceBudget returns the budget of a cluster of the given size.
+func NewResourceBudget(clusterSize *k8sclient.ClusterSize) ResourceBudget {
+	return ResourceBudget{Cores: clusterSize.Cores, Memory: clusterSize.Memory}
+}
+
+// Share returns fraction of the budget's cpu and memory, rounded down.
+// Resources of which the budget has none are left out.
+func (b ResourceBudget) Share(fraction float64) apiv1.ResourceList {
+	share := apiv1.ResourceList{}
+	if b.Cores > 0 {
+		milli := int64(math.Floor(float64(b.Cores) * 1000 * fraction))
+		share[apiv1.ResourceCPU] = *resource.NewMilliQuantity(milli, resource.DecimalSI)
+	}
+	if b.Memory.Sign() > 0 {
+		bytes := int64(math.Floor(float64(b.Memory.Value()) * fraction))
+		share[apiv1.ResourceMemory] = *resource.NewQuantity(bytes, resource.BinarySI)
+	}
+	return share
+}
+
+// Cap lowers the cpu and memory requests of every container which has a
+// budgetFraction to its share of the budget.  If the requests of all of the
+// containers still add up to more than the budget, a warning is logged.
+func (b ResourceBudget) Cap(cfg ScaleConfig, reqs map[string]apiv1.ResourceRequirements) {
+	for _, ctr := range sortedConfigNames(cfg) {
+		fraction := cfg[ctr].BudgetFraction
+		if fraction == nil {
+			continue
+		}
+		share := b.Share(*fraction)
+		for res, limit := range share {
+			q, found := reqs[ctr].Requests[res]
+			if !found || q.Cmp(limit) <= 0 {
+				continue
+			}
+			glog.V(2).Infof("Capping the %s request of container %s at its budget of %s, from %s", res, ctr, limit.String(), q.String())
+			reqs[ctr].Requests[res] = limit
+		}
+	}
+	for res, total := range b.total() {
+		sum := resource.Quantity{}
+		for _, ctrReqs := range reqs {
+			if q, found := ctrReqs.Requests[res]; found {
+				sum.Add(q)
+			}
+		}
+		if sum.Cmp(total) > 0 {
+			glog.Warningf("The %s requests of all containers add up to %s, more than the cluster's %s", res, sum.String(), total.String())
+		}
+	}
+}
+
+// total returns all of the budget.
+func (b ResourceBudget) total() apiv1.ResourceList {
+	return b.Share(1)
+}
+
+// validateBudgetFractions checks that every budgetFraction is more than 0 and
+// at most 1, and that they don't add up to more than 1.
+func (sc ScaleConfig) validateBudgetFractions() error {
+	sum := 0.0
+	for _, ctr := range sortedConfigNames(sc) {
+		fraction := sc[ctr].BudgetFraction
+		if fraction == nil {
+			continue
+		}
+		if *fraction <= 0 || *fraction > 1 {
+			return fmt.Errorf("container %q: budgetFraction must be more than 0 and at most 1, got %v", ctr, *fraction)
+		}
+		sum += *fraction
+	}
+	// Allow for the rounding of e.g. three thirds.
+	if sum > 1+1e-9 {
+		return fmt.Errorf("the budgetFractions of the containers add up to %v, more than 1", sum)
+	}
+	return nil
+}
+
+// hasBudget tells whether any container has a budgetFraction.
+func (sc ScaleConfig) hasBudget() bool {
+	for _, ctrcfg := range sc {
+		if ctrcfg.BudgetFraction != nil {
+			return true
+		}
+	}
+	return false
+}
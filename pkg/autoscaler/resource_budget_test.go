@@ -0,0 +1,132 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"testing"
+
+	realk8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestResourceBudgetShare(t *testing.T) {
+	testCases := []struct {
+		budget    ResourceBudget
+		fraction  float64
+		expCPU    string
+		expMemory string
+	}{
+		{ResourceBudget{Cores: 16, Memory: resource.MustParse("64Gi")}, 0.25, "4", "16Gi"},
+		{ResourceBudget{Cores: 3, Memory: resource.MustParse("1Gi")}, 0.3, "900m", "322122547"},
+		{ResourceBudget{Cores: 16}, 0.5, "8", ""},
+		{ResourceBudget{Memory: resource.MustParse("8Gi")}, 0.5, "", "4Gi"},
+	}
+	for _, tc := range testCases {
+		share := tc.budget.Share(tc.fraction)
+		for _, c := range []struct {
+			res apiv1.ResourceName
+			exp string
+		}{
+			{apiv1.ResourceCPU, tc.expCPU},
+			{apiv1.ResourceMemory, tc.expMemory},
+		} {
+			q, found := share[c.res]
+			if c.exp == "" {
+				if found {
+					t.Errorf("%+v, %v: expected no %s, got %s", tc.budget, tc.fraction, c.res, q.String())
+				}
+				continue
+			}
+			if !found || q.Cmp(resource.MustParse(c.exp)) != 0 {
+				t.Errorf("%+v, %v: expected %s %s, got %s", tc.budget, tc.fraction, c.res, c.exp, q.String())
+			}
+		}
+	}
+}
+
+func TestResourceBudgetCap(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{
+		"big": {"budgetFraction": 0.5, "requests": {"cpu": {"base": "12"}, "memory": {"base": "12Gi"}}},
+		"small": {"budgetFraction": 0.25, "requests": {"cpu": {"base": "1"}, "memory": {"base": "1Gi"}}},
+		"free": {"requests": {"cpu": {"base": "20"}}}
+	}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	autoScaler := &AutoScaler{currentConfig: cfg}
+	reqs := autoScaler.recommend(&realk8sclient.ClusterSize{Nodes: 4, Cores: 16, Memory: resource.MustParse("16Gi")})
+
+	expected := map[string]apiv1.ResourceList{
+		"big": {
+			apiv1.ResourceCPU:    resource.MustParse("8"),
+			apiv1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+		"small": {
+			apiv1.ResourceCPU:    resource.MustParse("1"),
+			apiv1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+		"free": {
+			apiv1.ResourceCPU: resource.MustParse("20"),
+		},
+	}
+	for ctr, exp := range expected {
+		for res, q := range exp {
+			got := reqs[ctr].Requests[res]
+			if got.Cmp(q) != 0 {
+				t.Errorf("%s: expected %s request %s, got %s", ctr, res, q.String(), got.String())
+			}
+		}
+	}
+
+	// Before the cluster size is known, nothing is capped.
+	reqs = autoScaler.recommend(&realk8sclient.ClusterSize{})
+	if got := reqs["big"].Requests[apiv1.ResourceCPU]; got.Cmp(resource.MustParse("12")) != 0 {
+		t.Errorf("expected the cpu request of an empty cluster not to be capped, got %s", got.String())
+	}
+}
+
+func TestValidateBudgetFractions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expError bool
+	}{
+		{"none", `{"foo": {}, "bar": {}}`, false},
+		{"some", `{"foo": {"budgetFraction": 0.5}, "bar": {}}`, false},
+		{"thirds", `{"a": {"budgetFraction": 0.3333333333}, "b": {"budgetFraction": 0.3333333333}, "c": {"budgetFraction": 0.3333333334}}`, false},
+		{"all", `{"foo": {"budgetFraction": 1}}`, false},
+		{"zero", `{"foo": {"budgetFraction": 0}}`, true},
+		{"negative", `{"foo": {"budgetFraction": -0.5}}`, true},
+		{"more than all", `{"foo": {"budgetFraction": 1.5}}`, true},
+		{"sum more than all", `{"foo": {"budgetFraction": 0.6}, "bar": {"budgetFraction": 0.6}}`, true},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{}
+		if err := json.Unmarshal([]byte(tc.data), &cfg); err != nil {
+			t.Fatalf("%s: invalid config: %v", tc.name, err)
+		}
+		err := cfg.Validate()
+		if tc.expError && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.expError && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+
+	"github.com/golang/glog"
+)
+
+// releaseGatedPods removes the scheduling gate from the target's pods whose
+// requests are those last applied, i.e. which were created from the updated
+// pod template.  Pods from an older template keep the gate, and are replaced
+// by the rollout of the new one.
+func (s *AutoScaler) releaseGatedPods(ctx context.Context) {
+	if !s.schedulingGate || s.lastReqs == nil {
+		return
+	}
+	pods, err := s.k8sClient.ListGatedPods(ctx)
+	if err != nil {
+		glog.Errorf("Can't list the gated pods of %s: %v", s.target, err)
+		return
+	}
+	for _, pod := range pods {
+		if !requestsApplied(pod.Resources, s.lastReqs) {
+			glog.V(2).Infof("Not ungating pod %s/%s, whose requests are not those last applied", pod.Namespace, pod.Name)
+			continue
+		}
+		if err := s.k8sClient.RemoveSchedulingGate(pod.Name, pod.Namespace); err != nil {
+			glog.Errorf("%v", err)
+			continue
+		}
+		glog.V(0).Infof("Removed scheduling gate %s from pod %s/%s", k8sclient.SchedulingGate, pod.Namespace, pod.Name)
+	}
+}
+
+// requestsApplied tells whether a pod has all of the requests in applied.
+// Containers which the pod doesn't have, e.g. skipped ones, are ignored.
+func requestsApplied(pod, applied map[string]apiv1.ResourceRequirements) bool {
+	for ctr, reqs := range applied {
+		have, found := pod[ctr]
+		if !found {
+			continue
+		}
+		for res, want := range reqs.Requests {
+			got, found := have.Requests[res]
+			if !found || got.Cmp(want) != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
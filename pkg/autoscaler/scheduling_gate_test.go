@@ -0,0 +1,87 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	realk8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestReleaseGatedPods(t *testing.T) {
+	requests := func(cpu, memory string) apiv1.ResourceRequirements {
+		return apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse(cpu),
+			apiv1.ResourceMemory: resource.MustParse(memory),
+		}}
+	}
+	applied := map[string]apiv1.ResourceRequirements{
+		"foo": requests("100m", "64Mi"),
+		"bar": requests("50m", "32Mi"),
+	}
+	gated := func(name string, resources map[string]apiv1.ResourceRequirements) realk8sclient.GatedPod {
+		return realk8sclient.GatedPod{Namespace: "default", Name: name, Resources: resources}
+	}
+	pods := []realk8sclient.GatedPod{
+		gated("current", map[string]apiv1.ResourceRequirements{
+			"foo": requests("100m", "64Mi"),
+			"bar": requests("50m", "32Mi"),
+		}),
+		gated("older-template", map[string]apiv1.ResourceRequirements{
+			"foo": requests("90m", "64Mi"),
+			"bar": requests("50m", "32Mi"),
+		}),
+		gated("missing-request", map[string]apiv1.ResourceRequirements{
+			"foo": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+			"bar": requests("50m", "32Mi"),
+		}),
+		// Same quantities, in other units.
+		gated("skipped-container", map[string]apiv1.ResourceRequirements{
+			"foo":     requests("0.1", "65536Ki"),
+			"sidecar": requests("10m", "8Mi"),
+		}),
+	}
+
+	testCases := []struct {
+		name     string
+		enabled  bool
+		lastReqs map[string]apiv1.ResourceRequirements
+		expected []string
+	}{
+		{"disabled", false, applied, nil},
+		{"nothing applied yet", true, nil, nil},
+		{"applied", true, applied, []string{"default/current", "default/skipped-container"}},
+	}
+	for _, tc := range testCases {
+		mockK8s := &k8sclient.MockK8sClient{GatedPods: pods}
+		autoScaler := &AutoScaler{
+			k8sClient:      mockK8s,
+			target:         "deployment/foo",
+			schedulingGate: tc.enabled,
+			lastReqs:       tc.lastReqs,
+		}
+		autoScaler.releaseGatedPods(context.Background())
+		if !reflect.DeepEqual(mockK8s.Ungated, tc.expected) {
+			t.Errorf("%s: expected to ungate %v, got %v", tc.name, tc.expected, mockK8s.Ungated)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// SelfTest measures the cluster once, with all the configured node and pod
+// filters, and writes its size and the resources which the config would
+// recommend to w.  It needs no target, so that an installation can be
+// checked before one exists; relative resources whose reference container
+// is not configured stay at their base.  An error measuring the cluster is
+// returned.
+func (s *AutoScaler) SelfTest(ctx context.Context, w io.Writer) error {
+	clusterSize, err := s.getClusterSize(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting cluster size: %v", err)
+	}
+	if _, err := s.refreshConfig(); err != nil {
+		return err
+	}
+	recommended := s.recommend(clusterSize)
+	applyRelative(s.currentConfig, recommended, nil)
+
+	fmt.Fprintf(w, "Nodes: %d (of %d listed), cores: %d, memory: %s, GPUs: %d\n",
+		clusterSize.Nodes, clusterSize.ListedNodes, clusterSize.Cores, clusterSize.Memory.String(), clusterSize.GPUs)
+	fmt.Fprintf(w, "Matching pods: %d, pending pods: %d, CPU utilization: %d%%\n",
+		clusterSize.MatchingPods, clusterSize.PendingPods, clusterSize.CPUUtilization)
+	groups := []string{}
+	for group := range clusterSize.NodeGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		fmt.Fprintf(w, "Node group %s: %d nodes\n", group, clusterSize.NodeGroups[group])
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tKIND\tRESOURCE\tRECOMMENDED")
+	ctrs := []string{}
+	for ctr := range recommended {
+		ctrs = append(ctrs, ctr)
+	}
+	sort.Strings(ctrs)
+	for _, ctr := range ctrs {
+		for _, kind := range []struct {
+			name string
+			list apiv1.ResourceList
+		}{
+			{"requests", recommended[ctr].Requests},
+			{"limits", recommended[ctr].Limits},
+		} {
+			resNames := []string{}
+			for res := range kind.list {
+				resNames = append(resNames, string(res))
+			}
+			sort.Strings(resNames)
+			for _, name := range resNames {
+				q := kind.list[apiv1.ResourceName(name)]
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", ctr, kind.name, name, q.String())
+			}
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSelfTest(t *testing.T) {
+	var asConfig = `
+{
+  "fake-agent": {
+    "requests": {
+      "cpu": {
+        "base": "100m", "step":"10m", "nodesPerStep":1
+      }
+    },
+    "limits": {
+      "memory": {
+        "base": "100Mi"
+      }
+    }
+  }
+}
+`
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(asConfig), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	mockK8s := k8sclient.MockK8sClient{
+		NumOfNodes: 10,
+		NumOfCores: 40,
+		Memory:     resource.MustParse("64Gi"),
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     &mockK8s,
+		defaultConfig: cfg,
+	}
+
+	var buf bytes.Buffer
+	if err := autoScaler.SelfTest(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, exp := range []string{
+		"Nodes: 10 (of 10 listed), cores: 40, memory: 64Gi, GPUs: 0",
+		"fake-agent  requests  cpu       200m",
+		"fake-agent  limits    memory    104857600",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("expected %q in self-test output:\n%s", exp, buf.String())
+		}
+	}
+
+	mockK8s.ClusterSizeErr = errors.New("forbidden")
+	buf.Reset()
+	if err := autoScaler.SelfTest(context.Background(), &buf); err == nil {
+		t.Errorf("expected an error when the cluster can't be measured")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output on error, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UpdateWindow is a recurring time window during which the target may be
+// updated.
+//
+// Example:
+//
+//	"Sat,Sun 02:00-06:00" allows updates on weekends, early in the morning.
+//	"22:00-02:00" allows updates every night; the window may cross midnight,
+//	in which case the days refer to the day on which it opens.
+type UpdateWindow struct {
+	// The days on which the window opens.  Empty means every day.
+	days map[time.Weekday]bool
+	// Minutes after midnight.
+	start, end int
+	loc        *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseUpdateWindow parses a window spec of the form "[days ]HH:MM-HH:MM",
+// where days is a comma-separated list of weekdays (e.g. "Mon,Tue").  The
+// times are in the named timezone, or UTC if it is empty.
+func ParseUpdateWindow(spec, timezone string) (*UpdateWindow, error) {
+	w := &UpdateWindow{days: map[time.Weekday]bool{}, loc: time.UTC}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %v", timezone, err)
+		}
+		w.loc = loc
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) == 2 {
+		for _, d := range strings.Split(fields[0], ",") {
+			wd, found := weekdays[strings.ToLower(d)]
+			if !found {
+				return nil, fmt.Errorf("invalid day %q in update window %q", d, spec)
+			}
+			w.days[wd] = true
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("invalid update window %q, must be [days ]HH:MM-HH:MM", spec)
+	}
+	times := strings.Split(fields[0], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("invalid update window %q, must be [days ]HH:MM-HH:MM", spec)
+	}
+	var err error
+	if w.start, err = parseClock(times[0]); err != nil {
+		return nil, err
+	}
+	if w.end, err = parseClock(times[1]); err != nil {
+		return nil, err
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("update window %q is empty", spec)
+	}
+	return w, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, must be HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains returns true if t is within the window.
+func (w *UpdateWindow) Contains(t time.Time) bool {
+	t = t.In(w.loc)
+	m := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	if w.start < w.end {
+		return w.opensOn(today) && m >= w.start && m < w.end
+	}
+	// The window crosses midnight.
+	return (w.opensOn(today) && m >= w.start) || (w.opensOn(yesterday) && m < w.end)
+}
+
+func (w *UpdateWindow) opensOn(day time.Weekday) bool {
+	return len(w.days) == 0 || w.days[day]
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateWindow(t *testing.T) {
+	// 2017-07-14 is a Friday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2017, 7, day, hour, min, 0, 0, time.UTC)
+	}
+	for _, tt := range []struct {
+		spec   string
+		t      time.Time
+		expVal bool
+	}{
+		{"02:00-04:00", at(14, 1, 59), false},
+		{"02:00-04:00", at(14, 2, 0), true},
+		{"02:00-04:00", at(14, 3, 59), true},
+		{"02:00-04:00", at(14, 4, 0), false},
+		{"Sat,Sun 02:00-04:00", at(14, 3, 0), false},
+		{"Sat,Sun 02:00-04:00", at(15, 3, 0), true},
+		{"Sat,Sun 02:00-04:00", at(16, 3, 0), true},
+		{"22:00-02:00", at(14, 23, 0), true},
+		{"22:00-02:00", at(14, 1, 0), true},
+		{"22:00-02:00", at(14, 12, 0), false},
+		{"Fri 22:00-02:00", at(14, 23, 0), true},
+		{"Fri 22:00-02:00", at(15, 1, 0), true},
+		{"Fri 22:00-02:00", at(14, 1, 0), false},
+	} {
+		w, err := ParseUpdateWindow(tt.spec, "")
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.spec, err)
+		}
+		if val := w.Contains(tt.t); val != tt.expVal {
+			t.Errorf("%q at %v: expected %v got %v", tt.spec, tt.t, tt.expVal, val)
+		}
+	}
+}
+
+func TestUpdateWindowTimezone(t *testing.T) {
+	w, err := ParseUpdateWindow("02:00-04:00", "America/New_York")
+	if err != nil {
+		t.Skipf("timezone data not available: %v", err)
+	}
+	// 07:00 UTC is 03:00 EDT.
+	if !w.Contains(time.Date(2017, 7, 14, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 07:00 UTC to be within 02:00-04:00 America/New_York")
+	}
+	if w.Contains(time.Date(2017, 7, 14, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 03:00 UTC to be outside of 02:00-04:00 America/New_York")
+	}
+}
+
+func TestParseUpdateWindowErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"02:00",
+		"2am-4am",
+		"Funday 02:00-04:00",
+		"02:00-02:00",
+		"Mon 02:00-04:00 extra",
+	} {
+		if _, err := ParseUpdateWindow(spec, ""); err == nil {
+			t.Errorf("%q: expected error, got none", spec)
+		}
+	}
+	if _, err := ParseUpdateWindow("02:00-04:00", "Not/AZone"); err == nil {
+		t.Errorf("expected error for invalid timezone, got none")
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+
+	"github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+
+	"github.com/golang/glog"
+)
+
+// ZeroNodesPolicy says what to do when no nodes are counted, which is more
+// likely a transient problem than a real cluster size.
+type ZeroNodesPolicy string
+
+const (
+	// ZeroNodesSkip skips the poll, leaving the target alone.
+	ZeroNodesSkip ZeroNodesPolicy = "skip"
+	// ZeroNodesFloor scales to zero nodes, i.e. to the bases of the config.
+	ZeroNodesFloor ZeroNodesPolicy = "floor"
+	// ZeroNodesLastGood scales to the last cluster size with any nodes.  The
+	// poll is skipped if there was none.
+	ZeroNodesLastGood ZeroNodesPolicy = "last-good"
+)
+
+// ParseZeroNodesPolicy validates a policy name.
+func ParseZeroNodesPolicy(name string) (ZeroNodesPolicy, error) {
+	switch p := ZeroNodesPolicy(name); p {
+	case ZeroNodesSkip, ZeroNodesFloor, ZeroNodesLastGood:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown zero nodes policy %q, must be skip, floor or last-good", name)
+}
+
+// handleZeroNodes applies the policy if no nodes were counted.  It returns
+// the cluster size to scale to, or false to skip the poll.
+func (s *AutoScaler) handleZeroNodes(clusterSize *k8sclient.ClusterSize) (*k8sclient.ClusterSize, bool) {
+	if clusterSize.Nodes > 0 {
+		s.lastGoodSize = clusterSize
+		return clusterSize, true
+	}
+	reason := "the API returned no nodes"
+	if clusterSize.ListedNodes > 0 {
+		reason = fmt.Sprintf("all %d nodes were filtered out", clusterSize.ListedNodes)
+	}
+	switch s.zeroNodesPolicy {
+	case ZeroNodesFloor:
+		glog.Warningf("Found zero nodes (%s), scaling to the floor", reason)
+		return clusterSize, true
+	case ZeroNodesLastGood:
+		if s.lastGoodSize != nil {
+			glog.Warningf("Found zero nodes (%s), reusing the last good size of %d nodes", reason, s.lastGoodSize.Nodes)
+			return s.lastGoodSize, true
+		}
+		glog.Warningf("Found zero nodes (%s), and no good size yet, skipping this poll", reason)
+		return nil, false
+	default:
+		glog.Warningf("Found zero nodes (%s), skipping this poll", reason)
+		return nil, false
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	k8sclient "github.com/kubernetes-incubator/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestZeroNodesPolicy(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"foo": {"requests": {"cpu": {"base": "100m", "step": "10m", "nodesPerStep": 1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	testCases := []struct {
+		policy   ZeroNodesPolicy
+		expNodes int    // Of lastSize after the zero-node poll.
+		expCPU   string // Of lastReqs after the zero-node poll.
+	}{
+		{ZeroNodesSkip, 4, "140m"},
+		{ZeroNodesFloor, 0, "100m"},
+		{ZeroNodesLastGood, 4, "140m"},
+	}
+	for _, tc := range testCases {
+		mockK8s := &k8sclient.MockK8sClient{NumOfNodes: 4, NumOfCores: 16}
+		autoScaler := &AutoScaler{
+			k8sClient:       mockK8s,
+			defaultConfig:   cfg,
+			zeroNodesPolicy: tc.policy,
+			clock:           clock.NewFakeClock(time.Now()),
+		}
+		autoScaler.pollAPIServer(context.Background())
+		mockK8s.NumOfNodes, mockK8s.NumOfCores = 0, 0
+		autoScaler.pollAPIServer(context.Background())
+
+		if autoScaler.lastSize == nil || autoScaler.lastSize.Nodes != tc.expNodes {
+			t.Errorf("%s: expected last size of %d nodes, got %+v", tc.policy, tc.expNodes, autoScaler.lastSize)
+		}
+		got := autoScaler.lastReqs["foo"].Requests[apiv1.ResourceCPU]
+		if expected := resource.MustParse(tc.expCPU); got.Cmp(expected) != 0 {
+			t.Errorf("%s: expected cpu %v, got %v", tc.policy, &expected, &got)
+		}
+	}
+}
+
+func TestLastGoodWithoutGoodSize(t *testing.T) {
+	autoScaler := &AutoScaler{
+		k8sClient:       &k8sclient.MockK8sClient{},
+		zeroNodesPolicy: ZeroNodesLastGood,
+	}
+	clusterSize, err := autoScaler.getClusterSize(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := autoScaler.handleZeroNodes(clusterSize); ok {
+		t.Errorf("expected the poll to be skipped without a good size")
+	}
+}
+
+func TestParseZeroNodesPolicy(t *testing.T) {
+	for _, name := range []string{"skip", "floor", "last-good"} {
+		if _, err := ParseZeroNodesPolicy(name); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+	if _, err := ParseZeroNodesPolicy("ignore"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}